@@ -376,6 +376,10 @@ func GetBlockchainInfo(network models.Network) (*PostGetBlockchainInfoResult, er
 	return response.Result, nil
 }
 
+func SendRawTransaction(network models.Network, transaction *wire.MsgTx) (txid string, err error) {
+	return sendRawTransaction(network, transaction)
+}
+
 func IsTxConfirmed(network models.Network, txid string) (isConfirmed bool) {
 	getTransactionResult, err := PostGetRawTransaction(network, txid, int(VerbosityJson))
 	if err != nil {
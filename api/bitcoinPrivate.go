@@ -9,6 +9,7 @@ import (
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
 	"io"
 	"net/http"
 	"strconv"
@@ -195,6 +196,23 @@ func getRawTransaction(network models.Network, txid string) (transaction *btcuti
 	return response, nil
 }
 
+func sendRawTransaction(network models.Network, transaction *wire.MsgTx) (txid string, err error) {
+	connCfg, err := getBitcoinConnConfig(network)
+	if err != nil {
+		return "", err
+	}
+	client, err := rpcclient.New(connCfg, nil)
+	if err != nil {
+		return
+	}
+	defer client.Shutdown()
+	hash, err := client.SendRawTransaction(transaction, false)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
 func getTransaction(network models.Network, txid string) (transaction *btcjson.GetTransactionResult, err error) {
 	connCfg, err := getBitcoinConnConfig(network)
 	if err != nil {
@@ -99,6 +99,12 @@ func SendAssetAddrSliceAndGetResponse(addrSlice []string, feeRate int) (*taprpc.
 	return sendAssetAddrSlice(addrSlice, feeRate)
 }
 
+// SendAssetAddrSliceWithLabelAndGetResponse labels the transfer, so FindTransferByLabel can tell whether
+// a send whose response was lost reached tapd.
+func SendAssetAddrSliceWithLabelAndGetResponse(addrSlice []string, feeRate int, label string) (*taprpc.SendAssetResponse, error) {
+	return sendAssetAddrSliceWithLabel(addrSlice, feeRate, label)
+}
+
 func GetDecodedAddrInfo(addr string) (*taprpc.Addr, error) {
 	return decodeAddr(addr)
 }
@@ -213,6 +219,28 @@ func ListTransfersAndGetResponse() (*taprpc.ListTransfersResponse, error) {
 	return listTransfers()
 }
 
+// transferLabelClockSkew is how far a transfer's timestamp may lag the send time the caller recorded.
+const transferLabelClockSkew = 5 * 60
+
+// FindTransferByLabel returns the transfer labelled with label that was made at or after since, or nil when
+// tapd has none. tapd lists transfers oldest first, so only the transfers made since are scanned.
+func FindTransferByLabel(label string, since int64) (*taprpc.AssetTransfer, error) {
+	response, err := listTransfers()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(response.Transfers) - 1; i >= 0; i-- {
+		transfer := response.Transfers[i]
+		if transfer.TransferTimestamp < since-transferLabelClockSkew {
+			break
+		}
+		if transfer.Label == label {
+			return transfer, nil
+		}
+	}
+	return nil, nil
+}
+
 func GetAllOutPointsOfListTransfersResponse(listTransfersResponse *taprpc.ListTransfersResponse) []string {
 	var allOutPoints []string
 	for _, listTransfer := range listTransfersResponse.Transfers {
@@ -352,6 +352,10 @@ func sendAsset(tapAddrs string, feeRate int) (*taprpc.SendAssetResponse, error)
 }
 
 func sendAssetAddrSlice(addrSlice []string, feeRate int) (*taprpc.SendAssetResponse, error) {
+	return sendAssetAddrSliceWithLabel(addrSlice, feeRate, "")
+}
+
+func sendAssetAddrSliceWithLabel(addrSlice []string, feeRate int, label string) (*taprpc.SendAssetResponse, error) {
 	grpcHost := config.GetLoadConfig().ApiConfig.Tapd.Host + ":" + strconv.Itoa(config.GetLoadConfig().ApiConfig.Tapd.Port)
 	tlsCertPath := config.GetLoadConfig().ApiConfig.Tapd.TlsCertPath
 	macaroonPath := config.GetLoadConfig().ApiConfig.Tapd.MacaroonPath
@@ -361,6 +365,7 @@ func sendAssetAddrSlice(addrSlice []string, feeRate int) (*taprpc.SendAssetRespo
 	request := &taprpc.SendAssetRequest{
 		TapAddrs: addrSlice,
 		FeeRate:  uint32(feeRate),
+		Label:    label,
 	}
 	response, err := client.SendAsset(context.Background(), request)
 	if err != nil {
@@ -128,7 +128,10 @@ var (
 	boxDeviceLogFile                   *os.File
 	boxChannelInfosLogFile             *os.File
 
-	lntLogFile *os.File
+	lntLogFile             *os.File
+	poolCandleStickLogFile *os.File
+	poolLimitOrderLogFile  *os.File
+	tradeOrderLogFile      *os.File
 )
 
 func getLogFile(dirPath string, fileName string) (*os.File, error) {
@@ -279,6 +282,18 @@ func openLogFile() error {
 	if err != nil {
 		return err
 	}
+	poolCandleStickLogFile, err = utils.GetLogFile("./logs/trade.pool_candle_stick.log")
+	if err != nil {
+		return err
+	}
+	poolLimitOrderLogFile, err = utils.GetLogFile("./logs/trade.pool_limit_order.log")
+	if err != nil {
+		return err
+	}
+	tradeOrderLogFile, err = utils.GetLogFile("./logs/trade.trade_order.log")
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -326,6 +341,9 @@ var (
 	BoxDeviceBackup             *ServicesLogger
 	Lnt                         *ServicesLogger
 	FWDT                        *ServicesLogger
+	PoolCandleStick             *ServicesLogger
+	PoolLimitOrder              *ServicesLogger
+	TradeOrder                  *ServicesLogger
 )
 
 func loadDefaultLog() {
@@ -368,5 +386,8 @@ func loadDefaultLog() {
 		BoxDevice = NewLogger("BDVC", Level, nil, true, defaultLogFile, boxDeviceLogFile)
 		BoxChannelInfos = NewLogger("BCIN", Level, nil, true, defaultLogFile, boxChannelInfosLogFile)
 		Lnt = NewLogger("LNT", Level, nil, true, defaultLogFile, lntLogFile)
+		PoolCandleStick = NewLogger("PCDL", Level, nil, true, defaultLogFile, poolCandleStickLogFile)
+		PoolLimitOrder = NewLogger("PLOD", Level, nil, true, defaultLogFile, poolLimitOrderLogFile)
+		TradeOrder = NewLogger("TDOD", Level, nil, true, defaultLogFile, tradeOrderLogFile)
 	}
 }
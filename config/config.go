@@ -16,7 +16,12 @@ type Config struct {
 		LocalPort string `yaml:"local_port" json:"local_port"`
 	} `yaml:"gin_config" json:"gin_config"`
 	CustodyConfig struct {
-		ClearBlockAccountBalance bool `yaml:"clear_block_account_balance" json:"clear_block_account_balance"`
+		ClearBlockAccountBalance bool   `yaml:"clear_block_account_balance" json:"clear_block_account_balance"`
+		LockBackend              string `yaml:"lock_backend" json:"lock_backend"`
+		LockTtlSecond            int    `yaml:"lock_ttl_second" json:"lock_ttl_second"`
+		LockWaitSecond           int    `yaml:"lock_wait_second" json:"lock_wait_second"`
+		// AllowUnsignedPayToUser lets users pay each other without a signed v2 invoice, for clients that predate them.
+		AllowUnsignedPayToUser bool `yaml:"allow_unsigned_pay_to_user" json:"allow_unsigned_pay_to_user"`
 	} `yaml:"custody_config" json:"custody_config"`
 	GormConfig struct {
 		Mysql struct {
@@ -192,6 +197,53 @@ type Config struct {
 		Withdraw []string `yaml:"withdraw" json:"withdraw"`
 	} `yaml:"pool_feature_disable_by_asset_id" json:"pool_feature_disable_by_asset_id"`
 	FWDTransNodePubkey string `yaml:"fwd_trans_node_pubkey" json:"fwd_trans_node_pubkey"`
+	SatBackQueue       struct {
+		Endpoint          string `yaml:"endpoint" json:"endpoint"`
+		TimeoutSecond     int    `yaml:"timeout_second" json:"timeout_second"`
+		DispatchBatchSize int    `yaml:"dispatch_batch_size" json:"dispatch_batch_size"`
+		MaxAttempts       int    `yaml:"max_attempts" json:"max_attempts"`
+		BaseBackoffSecond int    `yaml:"base_backoff_second" json:"base_backoff_second"`
+		MaxBackoffSecond  int    `yaml:"max_backoff_second" json:"max_backoff_second"`
+	} `yaml:"sat_back_queue" json:"sat_back_queue"`
+	Session struct {
+		AccessTokenExpirationMinute int `yaml:"access_token_expiration_minute" json:"access_token_expiration_minute"`
+		RefreshTokenExpirationHour  int `yaml:"refresh_token_expiration_hour" json:"refresh_token_expiration_hour"`
+	} `yaml:"session" json:"session"`
+	SecondRouter struct {
+		TimestampToleranceSecond int                   `yaml:"timestamp_tolerance_second" json:"timestamp_tolerance_second"`
+		Services                 []SecondRouterService `yaml:"services" json:"services"`
+		Tls                      struct {
+			CertPath     string `yaml:"cert_path" json:"cert_path"`
+			KeyPath      string `yaml:"key_path" json:"key_path"`
+			ClientCaPath string `yaml:"client_ca_path" json:"client_ca_path"`
+		} `yaml:"tls" json:"tls"`
+	} `yaml:"second_router" json:"second_router"`
+	Reconciliation struct {
+		DefaultAlertThreshold float64            `yaml:"default_alert_threshold" json:"default_alert_threshold"`
+		AlertThresholds       map[string]float64 `yaml:"alert_thresholds" json:"alert_thresholds"`
+		DingTalk              struct {
+			AccessToken string `yaml:"access_token" json:"access_token"`
+			Secret      string `yaml:"secret" json:"secret"`
+		} `yaml:"ding_talk" json:"ding_talk"`
+	} `yaml:"reconciliation" json:"reconciliation"`
+	OutsideMission struct {
+		IntervalSecond     int  `yaml:"interval_second" json:"interval_second"`
+		BatchSize          int  `yaml:"batch_size" json:"batch_size"`
+		BatchAcrossAssets  bool `yaml:"batch_across_assets" json:"batch_across_assets"`
+		MaxAttempts        int  `yaml:"max_attempts" json:"max_attempts"`
+		BaseBackoffSecond  int  `yaml:"base_backoff_second" json:"base_backoff_second"`
+		MaxBackoffSecond   int  `yaml:"max_backoff_second" json:"max_backoff_second"`
+		LeaseSecond        int  `yaml:"lease_second" json:"lease_second"`
+		StuckAfterMinute   int  `yaml:"stuck_after_minute" json:"stuck_after_minute"`
+		BumpIntervalMinute int  `yaml:"bump_interval_minute" json:"bump_interval_minute"`
+		MaxBumps           int  `yaml:"max_bumps" json:"max_bumps"`
+		MaxFeeRate         int  `yaml:"max_fee_rate" json:"max_fee_rate"`
+	} `yaml:"outside_mission" json:"outside_mission"`
+}
+
+type SecondRouterService struct {
+	Name   string `yaml:"name" json:"name"`
+	Secret string `yaml:"secret" json:"secret"`
 }
 
 type BasicAuth struct {
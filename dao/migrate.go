@@ -1,6 +1,9 @@
 package dao
 
 import (
+	"fmt"
+	"gorm.io/gorm"
+	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
 	"trade/models/custodyModels"
@@ -18,9 +21,17 @@ import (
 
 func Migrate() error {
 	var err error
+	if err = custodyLedgerAmountMigrate(); err != nil {
+		return err
+	}
 	defaultMigrate := []interface{}{
 		&models.Balance{},
 		&models.User{},
+		&models.UserSession{},
+		&models.SecondRouterAuditLog{},
+		&models.IdempotencyRecord{},
+		&models.WorkflowTask{},
+		&models.WorkflowEvent{},
 		&models.UserConfig{},
 		&models.ScheduledTask{},
 		&models.Invoice{},
@@ -62,6 +73,7 @@ func Migrate() error {
 		&models.AssetMeta{},
 		&models.NftPresaleBatchGroup{},
 		&models.NftPresaleWhitelist{},
+		&models.NftPresaleWhitelistTier{},
 		&models.AssetList{},
 		&models.DateIpLogin{},
 		&models.DateLogin{},
@@ -70,7 +82,10 @@ func Migrate() error {
 		&models.AssetBalanceHistory{},
 		&satBackQueue.PushQueueRecord{},
 		&satBackQueue.SwapTrPushQueueRecord{},
+		&satBackQueue.PushOutboxEvent{},
 		&models.RestRecord{},
+		&models.TradeOrder{},
+		&models.TradeHistory{},
 		&services.NftPresaleOfflinePurchaseData{},
 		&models.BtcUtxo{},
 		&models.BtcUtxoHistory{},
@@ -95,6 +110,12 @@ func Migrate() error {
 		&pool.PoolShareLpAwardCumulative{},
 		&pool.PoolPureAddLiquidityRecord{},
 		&pool.PoolBeforeSwapFee{},
+		&pool.PoolCandleStick{},
+		&pool.PoolCandleStickCursor{},
+		&pool.PoolLimitOrder{},
+		&pool.PoolLimitOrderFill{},
+		&pool.PoolPairFeeTier{},
+		&pool.PoolPairPriceObservation{},
 		&satBackQueue.GenLiquidity{},
 		&satBackQueue.GenLiquidityPushQueueRecord{},
 		&models.LitConf{},
@@ -161,6 +182,10 @@ func custody(err error) error {
 		&custodyModels.LimitBill{},
 		&custodyModels.LimitLevel{},
 		&custodyModels.LimitType{},
+		&custodyModels.LimitRule{},
+		&custodyModels.LimitUsage{},
+		&custodyModels.WithdrawalReview{},
+		&custodyModels.LockFence{},
 		&custodyModels.BlockedRecord{},
 		&custodyModels.AssetFee{},
 		&custodyswap.ReceiveConfig{},
@@ -168,7 +193,10 @@ func custody(err error) error {
 		&custodyswap.SwapSupplier{},
 		&custodyswap.SwapBill{},
 		&custodyModels.Control{},
+		&custodyModels.ControlWindow{},
+		&custodyModels.ControlHistory{},
 		&custodyModels.AccountInsideMission{},
+		&custodyModels.PayToNpubKeyPaid{},
 		&custodyModels.AccountOutsideMission{},
 		&custodyModels.AccountBalanceChange{},
 		custodyModels.OutBtcOnChain{},
@@ -183,6 +211,10 @@ func custody(err error) error {
 		&custodyModels.AccountBalance{},
 		&custodyModels.PayOutside{},
 		&custodyModels.PayOutsideTx{},
+		&custodyModels.PayOutsideBatch{},
+		&custodyModels.SolvencySnapshot{},
+		&custodyModels.JournalEntry{},
+		&custodyModels.JournalLine{},
 		&store.ReviewAward{},
 		&game.Recharge{},
 		&game.Withdraw{},
@@ -192,3 +224,79 @@ func custody(err error) error {
 	}
 	return err
 }
+
+type ledgerAmountColumn struct {
+	model  interface{}
+	table  string
+	column string
+	field  string
+}
+
+var ledgerAmountColumns = []ledgerAmountColumn{
+	{&custodyModels.AccountBalance{}, "user_account_balance", "amount", "Amount"},
+	{&custodyModels.AccountBtcBalance{}, "user_account_balance_btc", "amount", "Amount"},
+	{&models.Balance{}, "bill_balance", "amount", "Amount"},
+	{&models.Balance{}, "bill_balance", "server_fee", "ServerFee"},
+	{&custodyModels.AccountBalanceChange{}, "user_account_changes", "amount", "ChangeAmount"},
+	{&custodyModels.AccountBalanceChange{}, "user_account_changes", "final_balance", "FinalBalance"},
+	{&custodyModels.LockBalance{}, "user_lock_balance", "amount", "Amount"},
+	{&custodyModels.LockBalance{}, "user_lock_balance", "Tag1", "Tag1"},
+	{&custodyModels.LockBill{}, "user_lock_bill", "amount", "Amount"},
+	{&custodyModels.LockBillExt{}, "user_lock_bill_ext", "amount", "Amount"},
+	{&pAccount.PAccountBalance{}, "custody_pool_account_balances", "balance", "Balance"},
+	{&pAccount.PAccountBill{}, "custody_pool_account_bills", "amount", "Amount"},
+	{&pAccount.PAccountBalanceChange{}, "custody_pool_account_balance_change", "amount", "Amount"},
+	{&pAccount.PAccountBalanceChange{}, "custody_pool_account_balance_change", "final_balance", "FinalBalance"},
+	{&pool.PoolPairTokenAccountBalance{}, "pool_pair_token_account_balances", "balance", "Balance"},
+}
+
+// custodyLedgerAmountMigrate moves the custody, lock and pool account ledger
+// columns from decimal(25,2) to integral base units. Remainders the float64
+// ledger left below a base unit are recorded in LedgerAmountAdjustment and
+// truncated before the column is altered, so the ALTER never rounds. It runs
+// before AutoMigrate and skips columns which are already integral.
+func custodyLedgerAmountMigrate() error {
+	err := middleware.DB.AutoMigrate(&custodyModels.LedgerAmountAdjustment{})
+	if err != nil {
+		return err
+	}
+	for _, column := range ledgerAmountColumns {
+		if !middleware.DB.Migrator().HasColumn(column.model, column.field) {
+			continue
+		}
+		var scale int
+		err = middleware.DB.Raw("SELECT NUMERIC_SCALE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?", column.table, column.column).
+			Scan(&scale).Error
+		if err != nil {
+			return fmt.Errorf("custodyLedgerAmountMigrate %s.%s scale: %w", column.table, column.column, err)
+		}
+		if scale == 0 {
+			continue
+		}
+		err = middleware.DB.Transaction(func(tx *gorm.DB) error {
+			fractional := fmt.Sprintf("`%s` <> TRUNCATE(`%s`, 0)", column.column, column.column)
+			err := tx.Exec(fmt.Sprintf("INSERT INTO custody_ledger_amount_adjustment (created_at, updated_at, ledger_table, ledger_column, row_id, old_amount, new_amount) "+
+				"SELECT NOW(), NOW(), ?, ?, id, `%s`, TRUNCATE(`%s`, 0) FROM `%s` WHERE %s", column.column, column.column, column.table, fractional),
+				column.table, column.column).Error
+			if err != nil {
+				return err
+			}
+			result := tx.Exec(fmt.Sprintf("UPDATE `%s` SET `%s` = TRUNCATE(`%s`, 0) WHERE %s", column.table, column.column, column.column, fractional))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				btlLog.CUST.Warning("custodyLedgerAmountMigrate %s.%s truncated %d fractional rows", column.table, column.column, result.RowsAffected)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("custodyLedgerAmountMigrate %s.%s backfill: %w", column.table, column.column, err)
+		}
+		err = middleware.DB.Migrator().AlterColumn(column.model, column.field)
+		if err != nil {
+			return fmt.Errorf("custodyLedgerAmountMigrate %s.%s alter: %w", column.table, column.column, err)
+		}
+	}
+	return nil
+}
@@ -31,6 +31,7 @@ require (
 	github.com/lightningnetwork/lnd v0.19.1-beta
 	github.com/pkg/errors v0.9.1
 	github.com/robfig/cron/v3 v3.0.1
+	github.com/shopspring/decimal v1.4.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/tencentyun/cos-go-sdk-v5 v0.7.65
 	github.com/vincent-petithory/dataurl v1.0.0
@@ -198,7 +199,6 @@ require (
 	github.com/rivo/uniseg v0.2.0
 	github.com/rogpeppe/fastuuid v1.2.0
 	github.com/russross/blackfriday/v2 v2.1.0
-	github.com/shopspring/decimal v1.4.0
 	github.com/soheilhy/cmux v0.1.5
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/objx v0.5.2
@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"net/http"
 	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
+	"trade/models/custodyModels"
 	"trade/services/custodyAccount/lockPayment"
 )
 
@@ -17,10 +19,10 @@ type GetBalanceRequest struct {
 	AssetId string `json:"assetId"`
 }
 type GetBalanceResponse struct {
-	UnlockedBalance float64 `json:"unlockedBalance"`
-	LockedBalance   float64 `json:"lockedBalance"`
-	LockedId        string  `json:"lockedId"`
-	Tag1Balance     float64 `json:"tag1Balance"`
+	UnlockedBalance custodyModels.Amount `json:"unlockedBalance"`
+	LockedBalance   custodyModels.Amount `json:"lockedBalance"`
+	LockedId        string               `json:"lockedId"`
+	Tag1Balance     custodyModels.Amount `json:"tag1Balance"`
 }
 
 func GetBalance(c *gin.Context) {
@@ -37,18 +39,18 @@ func GetBalance(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
-	res.UnlockedBalance = unlockedBalance
-	res.LockedBalance = lockedBalance
-	res.Tag1Balance = tag1
+	res.UnlockedBalance = custodyModels.NewAmount(unlockedBalance)
+	res.LockedBalance = custodyModels.NewAmount(lockedBalance)
+	res.Tag1Balance = custodyModels.NewAmount(tag1)
 	c.JSON(http.StatusOK, res)
 }
 
 type LockRequest struct {
-	Npubkey  string  `json:"npubkey"`
-	LockedId string  `json:"lockedId"`
-	AssetId  string  `json:"assetId"`
-	Amount   float64 `json:"amount"`
-	Tag      int     `json:"tag"`
+	Npubkey  string          `json:"npubkey"`
+	LockedId string          `json:"lockedId"`
+	AssetId  string          `json:"assetId"`
+	Amount   decimal.Decimal `json:"amount"`
+	Tag      int             `json:"tag"`
 }
 type LockResponse struct {
 	Error string `json:"error"`
@@ -74,11 +76,11 @@ func Lock(c *gin.Context) {
 }
 
 type UnlockRequest struct {
-	Npubkey  string  `json:"npubkey"`
-	LockedId string  `json:"lockedId"`
-	AssetId  string  `json:"assetId"`
-	Amount   float64 `json:"amount"`
-	Tag      int     `json:"tag"`
+	Npubkey  string          `json:"npubkey"`
+	LockedId string          `json:"lockedId"`
+	AssetId  string          `json:"assetId"`
+	Amount   decimal.Decimal `json:"amount"`
+	Tag      int             `json:"tag"`
 }
 type UnlockResponse struct {
 	Error string `json:"error"`
@@ -104,13 +106,13 @@ func Unlock(c *gin.Context) {
 }
 
 type PayByLockedRequest struct {
-	LockedId        string  `json:"lockedId"`
-	PayerNpubkey    string  `json:"payerNpubkey"`
-	ReceiverNpubkey string  `json:"receiverNpubkey"`
-	AssetId         string  `json:"assetId"`
-	Amount          float64 `json:"amount"`
-	PayType         int8    `json:"payType"`
-	Tag             int     `json:"tag"`
+	LockedId        string          `json:"lockedId"`
+	PayerNpubkey    string          `json:"payerNpubkey"`
+	ReceiverNpubkey string          `json:"receiverNpubkey"`
+	AssetId         string          `json:"assetId"`
+	Amount          decimal.Decimal `json:"amount"`
+	PayType         int8            `json:"payType"`
+	Tag             int             `json:"tag"`
 }
 type PayType int8
 
@@ -0,0 +1,37 @@
+package SecondHandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"trade/btlLog"
+	"trade/models"
+	"trade/services/btldb"
+)
+
+func QueryAuditLogsHandler(c *gin.Context) {
+	var creds models.SecondRouterAuditLogQuery
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if creds.PageNum <= 0 {
+		creds.PageNum = 1
+	}
+	if creds.PageSize <= 0 {
+		creds.PageSize = 10
+	}
+	count, records, err := btldb.ReadSecondRouterAuditLogs(&creds, creds.PageSize, (creds.PageNum-1)*creds.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	results := struct {
+		Count   int64                          `json:"count"`
+		Records *[]models.SecondRouterAuditLog `json:"records"`
+	}{
+		Count:   count,
+		Records: records,
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: results})
+}
@@ -3,6 +3,7 @@ package SecondHandler
 import (
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 	"net/http"
 	"trade/btlLog"
 	"trade/models"
@@ -56,7 +57,7 @@ func PutInSatoshiAward(c *gin.Context) {
 		})
 		return
 	case "locked":
-		award, err := lockPayment.PutInAwardLockBTC(e.UserInfo, float64(creds.Amount), &creds.Memo, creds.LockedId)
+		award, err := lockPayment.PutInAwardLockBTC(e.UserInfo, decimal.NewFromInt(int64(creds.Amount)), &creds.Memo, creds.LockedId)
 		if err != nil {
 			btlLog.CUST.Error("%v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -119,7 +120,7 @@ func PutAssetAward(c *gin.Context) {
 		})
 		return
 	case "locked":
-		award, err := lockPayment.PutInAwardLockAsset(e.UserInfo, creds.AssetId, float64(creds.Amount), &creds.Memo, creds.LockedId)
+		award, err := lockPayment.PutInAwardLockAsset(e.UserInfo, creds.AssetId, decimal.NewFromInt(int64(creds.Amount)), &creds.Memo, creds.LockedId)
 		if err != nil {
 			btlLog.CUST.Error("%v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -0,0 +1,53 @@
+package SecondHandler
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+	"trade/btlLog"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
+)
+
+func VerifyJournalHandler(c *gin.Context) {
+	report, err := custodyJournal.Verify()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: report})
+}
+
+func ExportJournalHandler(c *gin.Context) {
+	var creds = struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	start, err := time.ParseInLocation(time.DateOnly, creds.Start, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: "start is invalid", Data: nil})
+		return
+	}
+	end, err := time.ParseInLocation(time.DateOnly, creds.End, time.Local)
+	if err != nil || end.Before(start) {
+		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: "end is invalid", Data: nil})
+		return
+	}
+	// The end date is included.
+	end = end.AddDate(0, 0, 1)
+
+	filename := fmt.Sprintf("journal-%s-%s.csv", creds.Start, creds.End)
+	c.Writer.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	c.Writer.Header().Set("Content-Type", "text/csv")
+	c.Writer.WriteHeader(http.StatusOK)
+	err = custodyJournal.ExportJournal(c.Writer, start, end)
+	if err != nil {
+		// The header is already sent, the truncated file is all that can be returned.
+		btlLog.CUST.Error("ExportJournal error:%v", err)
+	}
+}
@@ -1,9 +1,11 @@
 package SecondHandler
 
 import (
+	"encoding/hex"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"trade/btlLog"
+	"trade/models/custodyModels"
 	"trade/services/custodyAccount/custodyBase/control"
 	"trade/services/custodyAccount/custodyBase/custodyLimit"
 )
@@ -193,7 +195,7 @@ func GetControlHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: err.Error(), Data: nil})
 		return
 	}
-	if creds.AssetId != "00" && creds.AssetId != "asset" {
+	if !validControlAssetId(creds.AssetId) {
 		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: "assetId is invalid", Data: nil})
 		return
 	}
@@ -206,6 +208,7 @@ func SetControlHandler(c *gin.Context) {
 		AssetId string `json:"assetId"`
 		Type    int    `json:"type"`
 		Control bool   `json:"control"`
+		Reason  string `json:"reason"`
 	}{}
 	if err := c.ShouldBindJSON(&creds); err != nil {
 		btlLog.CUST.Error("%v", err)
@@ -219,11 +222,197 @@ func SetControlHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: err.Error(), Data: nil})
 		return
 	}
-	if creds.AssetId != "00" && creds.AssetId != "asset" {
+	if !validControlAssetId(creds.AssetId) {
 		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: "assetId is invalid", Data: nil})
 		return
 	}
-	err = control.SetTransferControl(creds.AssetId, t, creds.Control)
+	err = control.SetTransferControl(creds.AssetId, t, creds.Control, controlOperator(c), creds.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: nil})
+}
+
+// validControlAssetId accepts "00" for btc, "asset" for all assets, or a hex asset id.
+func validControlAssetId(assetId string) bool {
+	if assetId == "00" || assetId == "asset" {
+		return true
+	}
+	b, err := hex.DecodeString(assetId)
+	return err == nil && len(b) == 32
+}
+
+// controlOperator names who changes a control, the authenticated service or else the remote address.
+func controlOperator(c *gin.Context) string {
+	if caller := c.GetString("caller"); caller != "" {
+		return caller
+	}
+	return c.RemoteIP()
+}
+
+func AddControlWindowHandler(c *gin.Context) {
+	var creds = struct {
+		AssetId string `json:"assetId"`
+		Type    int    `json:"type"`
+		Start   string `json:"start"`
+		End     string `json:"end"`
+		Reason  string `json:"reason"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	var t control.TransferControl
+	err := t.FromInt(creds.Type)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if !validControlAssetId(creds.AssetId) {
+		c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: "assetId is invalid", Data: nil})
+		return
+	}
+	window, err := control.AddControlWindow(creds.AssetId, t, creds.Start, creds.End, controlOperator(c), creds.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: window})
+}
+
+func DeleteControlWindowHandler(c *gin.Context) {
+	var creds = struct {
+		Id     uint   `json:"id"`
+		Reason string `json:"reason"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	err := control.DeleteControlWindow(creds.Id, controlOperator(c), creds.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: nil})
+}
+
+func GetControlWindowsHandler(c *gin.Context) {
+	windows, err := control.ListControlWindows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: windows})
+}
+
+func GetControlHistoryHandler(c *gin.Context) {
+	var creds = struct {
+		AssetId  string `json:"assetId"`
+		Type     int    `json:"type"`
+		PageNum  int    `json:"pageNum"`
+		PageSize int    `json:"pageSize"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if creds.PageNum <= 0 {
+		creds.PageNum = 1
+	}
+	if creds.PageSize <= 0 {
+		creds.PageSize = 10
+	}
+	controlName := ""
+	if creds.AssetId != "" {
+		var t control.TransferControl
+		err := t.FromInt(creds.Type)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Result{Errno: 400, ErrMsg: err.Error(), Data: nil})
+			return
+		}
+		controlName = control.ControlName(creds.AssetId, t)
+	}
+	history, count, err := control.ListControlHistory(controlName, creds.PageNum, creds.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	results := struct {
+		Count   int64                          `json:"count"`
+		History []custodyModels.ControlHistory `json:"history"`
+	}{
+		Count:   count,
+		History: history,
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: results})
+}
+
+func GetLimitRulesHandle(c *gin.Context) {
+	var creds = struct {
+		LimitName string `json:"limitName"`
+		PageNum   int    `json:"pageNum"`
+		PageSize  int    `json:"pageSize"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if creds.PageNum <= 0 {
+		creds.PageNum = 1
+	}
+	if creds.PageSize <= 0 {
+		creds.PageSize = 10
+	}
+
+	rules, count, err := custodyLimit.GetLimitRules(creds.LimitName, creds.PageNum, creds.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	rulesResults := struct {
+		Count int64                     `json:"count"`
+		Rules *[]custodyLimit.LimitRule `json:"rules"`
+	}{
+		Count: count,
+		Rules: rules,
+	}
+
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: rulesResults})
+}
+
+func CreateOrUpdateLimitRuleHandle(c *gin.Context) {
+	var creds custodyLimit.LimitRule
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+
+	err := custodyLimit.CreateOrUpdateLimitRule(&creds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: creds})
+}
+
+func DeleteLimitRuleHandle(c *gin.Context) {
+	var creds = struct {
+		Id uint `json:"id"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+
+	err := custodyLimit.DeleteLimitRule(creds.Id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
 		return
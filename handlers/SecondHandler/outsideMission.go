@@ -0,0 +1,80 @@
+package SecondHandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"trade/btlLog"
+	"trade/models/custodyModels"
+	"trade/services/custodyAccount/defaultAccount/custodyAssets"
+)
+
+func QueryOutsideMissionsHandler(c *gin.Context) {
+	var creds = struct {
+		Status   *int `json:"status"`
+		PageNum  int  `json:"pageNum"`
+		PageSize int  `json:"pageSize"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if creds.PageNum <= 0 {
+		creds.PageNum = 1
+	}
+	if creds.PageSize <= 0 {
+		creds.PageSize = 10
+	}
+	status := -1
+	if creds.Status != nil {
+		status = *creds.Status
+	}
+	missions, count, err := custodyAssets.ListOutsideMissions(status, creds.PageNum, creds.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	results := struct {
+		Count    int64                      `json:"count"`
+		Missions []custodyModels.PayOutside `json:"missions"`
+	}{
+		Count:    count,
+		Missions: missions,
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: results})
+}
+
+func CancelOutsideMissionHandler(c *gin.Context) {
+	var creds = struct {
+		Id     uint   `json:"id"`
+		Reason string `json:"reason"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	err := custodyAssets.CancelOutsideMission(creds.Id, creds.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: nil})
+}
+
+func RetryOutsideMissionHandler(c *gin.Context) {
+	var creds = struct {
+		Id uint `json:"id"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	err := custodyAssets.RetryOutsideMission(creds.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: nil})
+}
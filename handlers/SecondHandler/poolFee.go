@@ -0,0 +1,80 @@
+package SecondHandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"trade/btlLog"
+	"trade/services/pool"
+)
+
+func SetPoolPairFeeTierHandler(c *gin.Context) {
+	var creds pool.PoolSetPairFeeTierRequest
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	tier, err := pool.SetPoolPairFeeTier(&creds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: tier})
+}
+
+func GetPoolPairFeeTiersHandler(c *gin.Context) {
+	var creds = struct {
+		TokenA   string `json:"tokenA"`
+		TokenB   string `json:"tokenB"`
+		PageNum  int    `json:"pageNum"`
+		PageSize int    `json:"pageSize"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if creds.PageNum <= 0 {
+		creds.PageNum = 1
+	}
+	if creds.PageSize <= 0 {
+		creds.PageSize = 10
+	}
+	count, err := pool.QueryPoolPairFeeTiersCount(creds.TokenA, creds.TokenB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	tiers, err := pool.QueryPoolPairFeeTiers(creds.TokenA, creds.TokenB, creds.PageSize, (creds.PageNum-1)*creds.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	results := struct {
+		Count int64                   `json:"count"`
+		Tiers *[]pool.PoolPairFeeTier `json:"tiers"`
+	}{
+		Count: count,
+		Tiers: tiers,
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: results})
+}
+
+func GetEffectivePoolPairFeeHandler(c *gin.Context) {
+	var creds = struct {
+		TokenA    string `json:"tokenA"`
+		TokenB    string `json:"tokenB"`
+		Timestamp int64  `json:"timestamp"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	fee, err := pool.QueryEffectivePoolPairFee(creds.TokenA, creds.TokenB, creds.Timestamp)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: fee})
+}
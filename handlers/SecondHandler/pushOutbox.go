@@ -0,0 +1,61 @@
+package SecondHandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"trade/btlLog"
+	"trade/services/satBackQueue"
+)
+
+func GetStuckPushOutboxEventsHandler(c *gin.Context) {
+	var creds = struct {
+		PageNum  int `json:"pageNum"`
+		PageSize int `json:"pageSize"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if creds.PageNum <= 0 {
+		creds.PageNum = 1
+	}
+	if creds.PageSize <= 0 {
+		creds.PageSize = 10
+	}
+	count, err := satBackQueue.QueryStuckOutboxEventsCount()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	events, err := satBackQueue.QueryStuckOutboxEvents(creds.PageSize, (creds.PageNum-1)*creds.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	results := struct {
+		Count  int64                           `json:"count"`
+		Events *[]satBackQueue.PushOutboxEvent `json:"events"`
+	}{
+		Count:  count,
+		Events: events,
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: results})
+}
+
+func ReplayPushOutboxEventHandler(c *gin.Context) {
+	var creds = struct {
+		Id uint `json:"id"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	err := satBackQueue.ReplayOutboxEvent(creds.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: nil})
+}
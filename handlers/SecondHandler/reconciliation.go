@@ -0,0 +1,25 @@
+package SecondHandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"trade/btlLog"
+	"trade/services/custodyAccount/reconciliation"
+)
+
+func GetSolvencyReportHandler(c *gin.Context) {
+	var creds = struct {
+		Date string `json:"date"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	snapshots, err := reconciliation.QuerySolvencyReport(creds.Date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: snapshots})
+}
@@ -0,0 +1,71 @@
+package SecondHandler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"trade/btlLog"
+	"trade/models/custodyModels"
+	"trade/services/custodyAccount/defaultAccount/custodyAssets"
+)
+
+func QueryWithdrawalReviewsHandler(c *gin.Context) {
+	var creds = struct {
+		Status   *int `json:"status"`
+		PageNum  int  `json:"pageNum"`
+		PageSize int  `json:"pageSize"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	if creds.PageNum <= 0 {
+		creds.PageNum = 1
+	}
+	if creds.PageSize <= 0 {
+		creds.PageSize = 10
+	}
+	status := -1
+	if creds.Status != nil {
+		status = *creds.Status
+	}
+	reviews, count, err := custodyAssets.ListWithdrawalReviews(status, creds.PageNum, creds.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	results := struct {
+		Count   int64                            `json:"count"`
+		Reviews []custodyModels.WithdrawalReview `json:"reviews"`
+	}{
+		Count:   count,
+		Reviews: reviews,
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: results})
+}
+
+func ReviewWithdrawalHandler(c *gin.Context) {
+	var creds = struct {
+		Id      uint   `json:"id"`
+		Approve bool   `json:"approve"`
+		Memo    string `json:"memo"`
+	}{}
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		btlLog.CUST.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	// The caller is the service authenticated by ServiceAuthMiddleware.
+	reviewer := c.GetString("caller")
+	var err error
+	if creds.Approve {
+		err = custodyAssets.ApproveWithdrawalReview(creds.Id, reviewer, creds.Memo)
+	} else {
+		err = custodyAssets.RejectWithdrawalReview(creds.Id, reviewer, creds.Memo)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Result{Errno: 500, ErrMsg: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Result{Errno: 0, ErrMsg: "", Data: nil})
+}
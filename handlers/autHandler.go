@@ -56,7 +56,7 @@ func GetDeviceIdHandler(c *gin.Context) {
 }
 
 func LoginHandler(c *gin.Context) {
-	var req models.User
+	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -72,46 +72,46 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	token, err := services.Login(&req)
+	ip := c.ClientIP()
+	tokens, err := services.Login(&req, ip)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	ip := c.ClientIP()
 	path := c.Request.URL.Path
-	go middleware.InsertLoginInfo(req.Username, ip, path)
+	go middleware.InsertLoginInfo(req.Username, ip, path, tokens.SessionId)
 	{
 		go middleware.RecodeDateIpLogin(req.Username, time.Now().Format(time.DateOnly), ip)
 		go middleware.RecodeDateLogin(req.Username, time.Now().Format(time.DateOnly))
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
 }
 
 func ReChangeHandler(c *gin.Context) {
-	var creds models.User
+	var creds models.LoginRequest
 	if err := c.ShouldBindJSON(&creds); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	token, err := services.ValidateUserAndReChange(&creds)
+	ip := c.ClientIP()
+	tokens, err := services.ValidateUserAndReChange(&creds, ip)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	ip := c.ClientIP()
 	path := c.Request.URL.Path
-	go middleware.InsertLoginInfo(creds.Username, ip, path)
+	go middleware.InsertLoginInfo(creds.Username, ip, path, tokens.SessionId)
 	{
 		go middleware.RecodeDateIpLogin(creds.Username, time.Now().Format(time.DateOnly), ip)
 		go middleware.RecodeDateLogin(creds.Username, time.Now().Format(time.DateOnly))
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
 }
 
 func RefreshTokenHandler(c *gin.Context) {
-	var creds models.User
+	var creds models.LoginRequest
 	if err := c.ShouldBindJSON(&creds); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -121,20 +121,70 @@ func RefreshTokenHandler(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Checksum error"})
 		return
 	}
-	token, err := services.ValidateUserAndGenerateToken(creds)
+	ip := c.ClientIP()
+	tokens, err := services.ValidateUserAndGenerateToken(creds, ip)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	ip := c.ClientIP()
 	path := c.Request.URL.Path
-	go middleware.InsertLoginInfo(creds.Username, ip, path)
+	go middleware.InsertLoginInfo(creds.Username, ip, path, tokens.SessionId)
 	{
 		go middleware.RecodeDateIpLogin(creds.Username, time.Now().Format(time.DateOnly), ip)
 		go middleware.RecodeDateLogin(creds.Username, time.Now().Format(time.DateOnly))
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RefreshSessionHandler rotates the refresh token of a session and issues a new access token.
+func RefreshSessionHandler(c *gin.Context) {
+	var req models.RefreshSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tokens, err := services.RefreshSession(&req, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func ListSessionsHandler(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	sessions, err := services.ListUserSessions(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.MakeJsonErrorResultForHttp(models.DefaultErr, "server error", nil))
+		return
+	}
+	c.JSON(http.StatusOK, models.MakeJsonErrorResultForHttp(models.SUCCESS, "", struct {
+		CurrentSessionId string               `json:"currentSessionId"`
+		Sessions         []models.UserSession `json:"sessions"`
+	}{
+		CurrentSessionId: c.GetString("sessionId"),
+		Sessions:         sessions,
+	}))
+}
+
+// RevokeSessionHandler signs out one of the user's sessions, the current one when no session id is given.
+func RevokeSessionHandler(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	var req models.RevokeSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SessionId == "" {
+		req.SessionId = c.GetString("sessionId")
+	}
+	err := services.RevokeUserSession(username, req.SessionId)
+	if err != nil {
+		c.JSON(http.StatusOK, models.MakeJsonErrorResultForHttp(models.DefaultErr, err.Error(), nil))
+		return
+	}
+	c.JSON(http.StatusOK, models.MakeJsonErrorResultForHttp(models.SUCCESS, "", nil))
 }
 
 func UserInfoHandler(c *gin.Context) {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"trade/btlLog"
 	"trade/models"
+	"trade/models/custodyModels"
 	"trade/services/custodyAccount"
 	"trade/services/custodyAccount/lockPayment"
 )
@@ -14,10 +15,10 @@ type GetBalanceRequest struct {
 	AssetId string `json:"assetId"`
 }
 type GetBalanceResponse struct {
-	TotalBalance    float64 `json:"totalBalance"`
-	UnlockedBalance float64 `json:"unlockedBalance"`
-	LockedBalance   float64 `json:"lockedBalance"`
-	Tag1Balance     float64 `json:"tag1Balance"`
+	TotalBalance    custodyModels.Amount `json:"totalBalance"`
+	UnlockedBalance custodyModels.Amount `json:"unlockedBalance"`
+	LockedBalance   custodyModels.Amount `json:"lockedBalance"`
+	Tag1Balance     custodyModels.Amount `json:"tag1Balance"`
 }
 
 func GetBalance(c *gin.Context) {
@@ -34,10 +35,10 @@ func GetBalance(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, res)
 		return
 	}
-	res.UnlockedBalance = unlockedBalance
-	res.LockedBalance = lockedBalance
-	res.TotalBalance = unlockedBalance + lockedBalance
-	res.Tag1Balance = tag1
+	res.UnlockedBalance = custodyModels.NewAmount(unlockedBalance)
+	res.LockedBalance = custodyModels.NewAmount(lockedBalance)
+	res.TotalBalance = custodyModels.NewAmount(unlockedBalance.Add(lockedBalance))
+	res.Tag1Balance = custodyModels.NewAmount(tag1)
 	c.JSON(http.StatusOK, res)
 }
 
@@ -109,13 +109,14 @@ func PayUserBtc(c *gin.Context) {
 	pay := struct {
 		NpubKey string  `json:"npub_key"`
 		Amount  float64 `json:"amount"`
+		Invoice string  `json:"invoice"`
 	}{}
 	if err := c.ShouldBindJSON(&pay); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error() + "请求参数错误"})
 		return
 	}
 
-	err = e.SendPaymentToUser(pay.NpubKey, pay.Amount)
+	err = e.SendPaymentToUser(pay.NpubKey, pay.Amount, pay.Invoice)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"error": "SendPayment error:" + err.Error()})
 		return
@@ -150,13 +150,14 @@ func SendToUserAsset(c *gin.Context) {
 		NpubKey string  `json:"npub_key"`
 		AssetId string  `json:"asset_id"`
 		Amount  float64 `json:"amount"`
+		Invoice string  `json:"invoice"`
 	}{}
 	if err = c.ShouldBindJSON(&pay); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error() + "请求参数错误"})
 		return
 	}
 
-	err = e.SendPaymentToUser(pay.NpubKey, pay.Amount, pay.AssetId)
+	err = e.SendPaymentToUser(pay.NpubKey, pay.Amount, pay.AssetId, pay.Invoice)
 	if err != nil {
 		c.JSON(http.StatusOK, models.MakeJsonErrorResultForHttp(models.DefaultErr, err.Error(), nil))
 		return
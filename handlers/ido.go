@@ -356,3 +356,44 @@ func SetIdoParticipateInfo(c *gin.Context) {
 		Data:    nil,
 	})
 }
+
+func SetIdoRefundAddr(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	userId, err := services.NameToId(username)
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.NameToIdErr,
+			Data:    nil,
+		})
+		return
+	}
+	var setIdoRefundAddrRequest models.SetIdoRefundAddrRequest
+	err = c.ShouldBindJSON(&setIdoRefundAddrRequest)
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ShouldBindJsonErr,
+			Data:    nil,
+		})
+		return
+	}
+	err = services.SetIdoRefundAddr(userId, setIdoRefundAddrRequest.IdoPublishInfoID, setIdoRefundAddrRequest.EncodedAddr)
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.SetIdoRefundAddrErr,
+			Data:    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.JsonResult{
+		Success: true,
+		Error:   "",
+		Code:    models.SUCCESS,
+		Data:    nil,
+	})
+}
@@ -503,6 +503,46 @@ func QueryNftPresaleBatchGroup(c *gin.Context) {
 	})
 }
 
+func GetNftPresaleBatchGroupPriceQuote(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	_, err := services.NameToId(username)
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.NameToIdErr,
+			Data:    nil,
+		})
+		return
+	}
+	batchGroupId, err := strconv.Atoi(c.Query("batch_group_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.AtoiErr,
+			Data:    nil,
+		})
+		return
+	}
+	priceQuote, err := services.GetNftPresaleBatchGroupPriceQuote(batchGroupId)
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.GetNftPresaleBatchGroupPriceQuoteErr,
+			Data:    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.JsonResult{
+		Success: true,
+		Error:   models.SUCCESS.Error(),
+		Code:    models.SUCCESS,
+		Data:    priceQuote,
+	})
+}
+
 func GetPurchasedNftPresaleInfo(c *gin.Context) {
 	nftPresaleInfos, err := services.GetPurchasedNftPresaleInfo()
 	if err != nil {
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 	"trade/models"
 	"trade/services"
 )
@@ -36,3 +38,106 @@ func AddNftPresaleWhitelists(c *gin.Context) {
 		Data:    nil,
 	})
 }
+
+func ImportNftPresaleWhitelistCsv(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.FormFileErr,
+			Data:    nil,
+		})
+		return
+	}
+	if file.Size > 15*1024*1024 {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   errors.New("file too large, its size is more than 15MB").Error(),
+			Code:    models.FileSizeTooLargeErr,
+			Data:    nil,
+		})
+		return
+	}
+	whitelistType, err := strconv.Atoi(c.PostForm("whitelist_type"))
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.AtoiErr,
+			Data:    nil,
+		})
+		return
+	}
+	var batchGroupId int
+	if batchGroupIdStr := c.PostForm("batch_group_id"); batchGroupIdStr != "" {
+		batchGroupId, err = strconv.Atoi(batchGroupIdStr)
+		if err != nil {
+			c.JSON(http.StatusOK, models.JsonResult{
+				Success: false,
+				Error:   err.Error(),
+				Code:    models.AtoiErr,
+				Data:    nil,
+			})
+			return
+		}
+	}
+	assetId := c.PostForm("asset_id")
+	reader, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.FormFileErr,
+			Data:    nil,
+		})
+		return
+	}
+	defer reader.Close()
+	result, err := services.ImportNftPresaleWhitelistCsv(models.WhitelistType(whitelistType), assetId, batchGroupId, reader)
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.ImportNftPresaleWhitelistCsvErr,
+			Data:    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.JsonResult{
+		Success: true,
+		Error:   "",
+		Code:    models.SUCCESS,
+		Data:    result,
+	})
+}
+
+func GetNftPresaleWhitelistMerkleProof(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	batchGroupId, err := strconv.Atoi(c.Query("batch_group_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.AtoiErr,
+			Data:    nil,
+		})
+		return
+	}
+	merkleProof, err := services.GetNftPresaleWhitelistMerkleProof(batchGroupId, username)
+	if err != nil {
+		c.JSON(http.StatusOK, models.JsonResult{
+			Success: false,
+			Error:   err.Error(),
+			Code:    models.GetNftPresaleWhitelistMerkleProofErr,
+			Data:    nil,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.JsonResult{
+		Success: true,
+		Error:   "",
+		Code:    models.SUCCESS,
+		Data:    merkleProof,
+	})
+}
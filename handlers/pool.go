@@ -1319,7 +1319,7 @@ func CalcBurnLiquidity(c *gin.Context) {
 		return
 	}
 
-	amountA, amountB, err := pool.CalcBurnLiquidity(tokenA, tokenB, liquidity, username, pool.RemoveLiquidityFeeK)
+	amountA, amountB, err := pool.CalcBurnLiquidity(tokenA, tokenB, liquidity, username, pool.MaxRemoveLiquidityFeeK)
 	if err != nil {
 		c.JSON(http.StatusOK, Result2{
 			Errno:  models.CalcBurnLiquidityErr.Code(),
@@ -2465,3 +2465,692 @@ func GetPoolAccountInfo(c *gin.Context) {
 		Data:   pAccountInfo,
 	})
 }
+
+func CalcSwapExactTokensForTokens(c *gin.Context) {
+	requestUser := c.MustGet("username").(string)
+	var req pool.PoolSwapExactTokensForTokensRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.ShouldBindJsonErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CalcSwapExactTokensForTokensResponse),
+		})
+		return
+	}
+
+	if !strings.Contains(requestUser, req.Username) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.UsernameNotMatchErr.Code(),
+			ErrMsg: "username not match",
+			Data:   new(pool.CalcSwapExactTokensForTokensResponse),
+		})
+		return
+	}
+
+	swapRecords, amounts, err := pool.CalcSwapExactTokensForTokens(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.CalcSwapExactTokensForTokensErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CalcSwapExactTokensForTokensResponse),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data: &pool.CalcSwapExactTokensForTokensResponse{
+			Path:        req.Path,
+			Amounts:     amounts,
+			AmountOut:   amounts[len(amounts)-1],
+			SwapRecords: pool.SwapRecordsToSwapRecordInfos(swapRecords),
+		},
+	})
+}
+
+func CalcSwapTokensForExactTokens(c *gin.Context) {
+	requestUser := c.MustGet("username").(string)
+	var req pool.PoolSwapTokensForExactTokensRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.ShouldBindJsonErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CalcSwapTokensForExactTokensResponse),
+		})
+		return
+	}
+
+	if !strings.Contains(requestUser, req.Username) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.UsernameNotMatchErr.Code(),
+			ErrMsg: "username not match",
+			Data:   new(pool.CalcSwapTokensForExactTokensResponse),
+		})
+		return
+	}
+
+	swapRecords, amounts, err := pool.CalcSwapTokensForExactTokens(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.CalcSwapTokensForExactTokensErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CalcSwapTokensForExactTokensResponse),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data: &pool.CalcSwapTokensForExactTokensResponse{
+			Path:        req.Path,
+			Amounts:     amounts,
+			AmountIn:    amounts[0],
+			SwapRecords: pool.SwapRecordsToSwapRecordInfos(swapRecords),
+		},
+	})
+}
+
+func CalcBestPathExactIn(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	tokenIn := c.Query("token_in")
+	tokenOut := c.Query("token_out")
+	amountIn := c.Query("amount_in")
+	if amountIn == "" {
+		err := errors.New("amount_in is empty")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryParamEmptyErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.BestSwapPathResponse),
+		})
+		return
+	}
+
+	path, amounts, err := pool.FindBestPathExactIn(tokenIn, tokenOut, amountIn, username)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FindBestPathErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.BestSwapPathResponse),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data: &pool.BestSwapPathResponse{
+			Path:    path,
+			Amounts: amounts,
+		},
+	})
+}
+
+func CalcBestPathExactOut(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	tokenIn := c.Query("token_in")
+	tokenOut := c.Query("token_out")
+	amountOut := c.Query("amount_out")
+	if amountOut == "" {
+		err := errors.New("amount_out is empty")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryParamEmptyErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.BestSwapPathResponse),
+		})
+		return
+	}
+
+	path, amounts, err := pool.FindBestPathExactOut(tokenIn, tokenOut, amountOut, username)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FindBestPathErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.BestSwapPathResponse),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data: &pool.BestSwapPathResponse{
+			Path:    path,
+			Amounts: amounts,
+		},
+	})
+}
+
+func SwapExactTokensForTokens(c *gin.Context) {
+
+	if config.GetConfig().PoolFeatureDisable.SwapE {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FeatureIsDisabled.Code(),
+			ErrMsg: featureDisabled.Error(),
+			Data:   nil,
+		})
+		return
+	}
+
+	requestUser := c.MustGet("username").(string)
+	var req pool.PoolSwapExactTokensForTokensRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.ShouldBindJsonErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.SwapExactTokensForTokensResult),
+		})
+		return
+	}
+
+	if pool.IsPathTokenDisabled(req.Path, config.GetConfig().PoolFeatureDisableByAssetId.Withdraw) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FeatureIsDisabled.Code(),
+			ErrMsg: featureDisabled.Error(),
+			Data:   nil,
+		})
+		return
+	}
+
+	if !strings.Contains(requestUser, req.Username) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.UsernameNotMatchErr.Code(),
+			ErrMsg: "username not match",
+			Data:   new(pool.SwapExactTokensForTokensResult),
+		})
+		return
+	}
+
+	result, err := pool.ProcessSwapExactTokensForTokensRequest(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.SwapExactTokensForTokensErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.SwapExactTokensForTokensResult),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   result,
+	})
+}
+
+func SwapTokensForExactTokens(c *gin.Context) {
+
+	if config.GetConfig().PoolFeatureDisable.SwapT {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FeatureIsDisabled.Code(),
+			ErrMsg: featureDisabled.Error(),
+			Data:   nil,
+		})
+		return
+	}
+
+	requestUser := c.MustGet("username").(string)
+	var req pool.PoolSwapTokensForExactTokensRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.ShouldBindJsonErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.SwapTokensForExactTokensResult),
+		})
+		return
+	}
+
+	if pool.IsPathTokenDisabled(req.Path, config.GetConfig().PoolFeatureDisableByAssetId.Withdraw) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FeatureIsDisabled.Code(),
+			ErrMsg: featureDisabled.Error(),
+			Data:   nil,
+		})
+		return
+	}
+
+	if !strings.Contains(requestUser, req.Username) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.UsernameNotMatchErr.Code(),
+			ErrMsg: "username not match",
+			Data:   new(pool.SwapTokensForExactTokensResult),
+		})
+		return
+	}
+
+	result, err := pool.ProcessSwapTokensForExactTokensRequest(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.SwapTokensForExactTokensErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.SwapTokensForExactTokensResult),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   result,
+	})
+}
+
+func getCandleStickTimeRange(c *gin.Context) (start int64, end int64, err error) {
+	startStr := c.Query("start")
+	endStr := c.Query("end")
+	if startStr != "" {
+		start, err = strconv.ParseInt(startStr, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, end, nil
+}
+
+func QueryCandleSticksCount(c *gin.Context) {
+	tokenA := c.Query("token_a")
+	tokenB := c.Query("token_b")
+	interval := pool.CandleStickInterval(c.Query("interval"))
+
+	start, end, err := getCandleStickTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.InvalidTimeRangeErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   0,
+		})
+		return
+	}
+
+	count, err := pool.QueryCandleSticksCount(tokenA, tokenB, interval, start, end)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryCandleSticksCountErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   0,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   count,
+	})
+}
+
+func QueryCandleSticks(c *gin.Context) {
+	tokenA := c.Query("token_a")
+	tokenB := c.Query("token_b")
+	interval := pool.CandleStickInterval(c.Query("interval"))
+	limit := c.Query("limit")
+	offset := c.Query("offset")
+
+	start, end, err := getCandleStickTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.InvalidTimeRangeErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+
+	if limit == "" {
+		err = errors.New("limit is empty")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.LimitEmptyErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+	limitInt, err := strconv.Atoi(limit)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.AtoiErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+	if limitInt < 0 {
+		err = errors.New("limit is less than 0")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.LimitLessThanZeroErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+
+	if offset == "" {
+		err = errors.New("offset is empty")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.OffsetEmptyErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+	offsetInt, err := strconv.Atoi(offset)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.AtoiErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+	if offsetInt < 0 {
+		err = errors.New("offset is less than 0")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.OffsetLessThanZeroErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+
+	charts, err := pool.QueryCandleSticks(tokenA, tokenB, interval, start, end, limitInt, offsetInt)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryCandleSticksErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.CandleStickCharts),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   charts,
+	})
+}
+
+func CreateLimitOrder(c *gin.Context) {
+
+	if config.GetConfig().PoolFeatureDisable.SwapE {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FeatureIsDisabled.Code(),
+			ErrMsg: featureDisabled.Error(),
+			Data:   nil,
+		})
+		return
+	}
+
+	requestUser := c.MustGet("username").(string)
+	var req pool.PoolCreateLimitOrderRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.ShouldBindJsonErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.PoolLimitOrder),
+		})
+		return
+	}
+
+	if pool.IsPathTokenDisabled([]string{req.TokenIn, req.TokenOut}, config.GetConfig().PoolFeatureDisableByAssetId.Withdraw) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.FeatureIsDisabled.Code(),
+			ErrMsg: featureDisabled.Error(),
+			Data:   nil,
+		})
+		return
+	}
+
+	if !strings.Contains(requestUser, req.Username) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.UsernameNotMatchErr.Code(),
+			ErrMsg: "username not match",
+			Data:   new(pool.PoolLimitOrder),
+		})
+		return
+	}
+
+	order, err := pool.CreateLimitOrder(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.CreateLimitOrderErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.PoolLimitOrder),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   order,
+	})
+}
+
+func CancelLimitOrder(c *gin.Context) {
+	requestUser := c.MustGet("username").(string)
+	var req pool.PoolCancelLimitOrderRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.ShouldBindJsonErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.PoolLimitOrder),
+		})
+		return
+	}
+
+	if !strings.Contains(requestUser, req.Username) {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.UsernameNotMatchErr.Code(),
+			ErrMsg: "username not match",
+			Data:   new(pool.PoolLimitOrder),
+		})
+		return
+	}
+
+	order, err := pool.CancelLimitOrder(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.CancelLimitOrderErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.PoolLimitOrder),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   order,
+	})
+}
+
+func QueryUserLimitOrdersCount(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	var count int64
+	var err error
+
+	count, err = pool.QueryUserLimitOrdersCount(username)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryUserLimitOrdersCountErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   0,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   count,
+	})
+}
+
+func QueryUserLimitOrders(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	limit := c.Query("limit")
+	offset := c.Query("offset")
+
+	if limit == "" {
+		err := errors.New("limit is empty")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.LimitEmptyErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrder{},
+		})
+		return
+	}
+	limitInt, err := strconv.Atoi(limit)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.AtoiErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrder{},
+		})
+		return
+	}
+	if limitInt < 0 {
+		err := errors.New("limit is less than 0")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.LimitLessThanZeroErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrder{},
+		})
+		return
+	}
+	if offset == "" {
+		err := errors.New("offset is empty")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.OffsetEmptyErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrder{},
+		})
+		return
+	}
+	offsetInt, err := strconv.Atoi(offset)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.AtoiErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrder{},
+		})
+		return
+	}
+	if offsetInt < 0 {
+		err := errors.New("offset is less than 0")
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.OffsetLessThanZeroErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrder{},
+		})
+		return
+	}
+	var orders *[]pool.PoolLimitOrder
+
+	orders, err = pool.QueryUserLimitOrders(username, limitInt, offsetInt)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryUserLimitOrdersErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrder{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   orders,
+	})
+}
+
+func QueryUserLimitOrderFills(c *gin.Context) {
+	username := c.MustGet("username").(string)
+	orderId, err := strconv.ParseUint(c.Query("order_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.AtoiErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrderFill{},
+		})
+		return
+	}
+
+	fills, err := pool.QueryUserLimitOrderFills(username, uint(orderId))
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryUserLimitOrderFillsErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   &[]pool.PoolLimitOrderFill{},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   fills,
+	})
+}
+
+func QueryPoolPairFee(c *gin.Context) {
+	_ = c.MustGet("username").(string)
+	tokenA := c.Query("token_a")
+	tokenB := c.Query("token_b")
+
+	fee, err := pool.QueryEffectivePoolPairFee(tokenA, tokenB, 0)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryPoolPairFeeErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.PoolPairFee),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   fee,
+	})
+}
+
+func QueryPoolTwap(c *gin.Context) {
+	tokenA := c.Query("token_a")
+	tokenB := c.Query("token_b")
+
+	start, end, err := getCandleStickTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.InvalidTimeRangeErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.PoolTwap),
+		})
+		return
+	}
+
+	twap, err := pool.QueryPoolTwap(tokenA, tokenB, start, end)
+	if err != nil {
+		c.JSON(http.StatusOK, Result2{
+			Errno:  models.QueryPoolTwapErr.Code(),
+			ErrMsg: err.Error(),
+			Data:   new(pool.PoolTwap),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Result2{
+		Errno:  0,
+		ErrMsg: models.SUCCESS.Error(),
+		Data:   twap,
+	})
+}
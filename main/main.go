@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -128,9 +130,23 @@ func main() {
 		Addr:    r2bind + ":" + localPort,
 		Handler: r2,
 	}
+	secondTls := loadConfig.SecondRouter.Tls
+	if secondTls.ClientCaPath != "" {
+		srv2.TLSConfig, err = clientCertTlsConfig(secondTls.ClientCaPath)
+		if err != nil {
+			log.Printf("Failed to load second router client ca: %v", err)
+			return
+		}
+	}
 
 	go func() {
-		if err := srv2.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if srv2.TLSConfig != nil {
+			err = srv2.ListenAndServeTLS(secondTls.CertPath, secondTls.KeyPath)
+		} else {
+			err = srv2.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			fmt.Printf("listen: %s\n", err)
 		}
 	}()
@@ -288,3 +304,20 @@ func closeLitd(cfg *config.Config) {
 		log.Println("Shutting down the Lit node...")
 	}
 }
+
+// clientCertTlsConfig makes the listener require client certificates signed by the CA at caPath.
+func clientCertTlsConfig(caPath string) (*tls.Config, error) {
+	caPem, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, errors.New("no certificate found in " + caPath)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
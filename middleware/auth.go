@@ -54,7 +54,7 @@ func AuthMiddleware() gin.HandlerFunc {
 
 			ip := c.ClientIP()
 			path := c.Request.URL.Path
-			go InsertLoginInfo(username, ip, path)
+			go InsertLoginInfo(username, ip, path, "")
 			{
 				go RecodeDateIpLogin(username, time.Now().Format(time.DateOnly), ip)
 				go RecodeDateLogin(username, time.Now().Format(time.DateOnly))
@@ -94,13 +94,14 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		ip := c.ClientIP()
 		path := c.Request.URL.Path
-		go InsertLoginInfo(claims.Username, ip, path)
+		go InsertLoginInfo(claims.Username, ip, path, claims.SessionId)
 		{
 			go RecodeDateIpLogin(claims.Username, time.Now().Format(time.DateOnly), ip)
 			go RecodeDateLogin(claims.Username, time.Now().Format(time.DateOnly))
 		}
 
 		c.Set("username", claims.Username)
+		c.Set("sessionId", claims.SessionId)
 		c.Next()
 	}
 }
@@ -217,7 +218,7 @@ func hashWeakButFastPassword(password string) (string, error) {
 
 var LoginInfoMutex = sync.Mutex{}
 
-func InsertLoginInfo(userName, ip, path string) {
+func InsertLoginInfo(userName, ip, path, sessionId string) {
 	LoginInfoMutex.Lock()
 	defer LoginInfoMutex.Unlock()
 
@@ -240,6 +241,7 @@ func InsertLoginInfo(userName, ip, path string) {
 		RecentIpAddresses: user.RecentIpAddresses,
 		Path:              path,
 		LoginTime:         user.RecentLoginTime,
+		SessionId:         sessionId,
 	}
 	err = DB.Create(&record).Error
 	if err != nil {
@@ -0,0 +1,46 @@
+// Package dbtest opens the in-memory SQLite databases the package tests run against.
+package dbtest
+
+import (
+	"testing"
+	"trade/middleware"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open opens an in-memory database named after the test, migrates the models into it and closes it when the test ends.
+// The cache is shared, so every connection of the pool sees the same database.
+func Open(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	if len(models) != 0 {
+		if err = db.AutoMigrate(models...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// Use opens a database like Open and sets it as middleware.DB until the test ends.
+func Use(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+	db := Open(t, models...)
+	oldDB := middleware.DB
+	middleware.DB = db
+	t.Cleanup(func() {
+		middleware.DB = oldDB
+	})
+	return db
+}
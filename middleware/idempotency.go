@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+	"trade/btlLog"
+	"trade/models"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	maxIdempotencyKeyLength = 128
+	idempotencyTtl          = 24 * time.Hour
+	// idempotencyProcessingLease is how long a run holds its key. The run renews it every
+	// idempotencyLeaseRenewal while its handler works, so only a run whose process died lets it lapse
+	// and a retry claim the key.
+	idempotencyProcessingLease = 5 * time.Minute
+	idempotencyLeaseRenewal    = idempotencyProcessingLease / 3
+)
+
+// idempotencyScope is who the key belongs to: the service calling the second router, or else the user.
+func idempotencyScope(c *gin.Context) string {
+	if caller := c.GetString("caller"); caller != "" {
+		return "service:" + caller
+	}
+	if username := c.GetString("username"); username != "" {
+		return "user:" + username
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// claimIdempotencyKey inserts the processing record of the key. When the key is taken it returns the
+// record holding it, and nil when this request may run.
+func claimIdempotencyKey(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	for {
+		err := DB.Create(record).Error
+		if err == nil {
+			return nil, nil
+		}
+		var mysqlErr *mysql.MySQLError
+		if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+			return nil, err
+		}
+		var existing models.IdempotencyRecord
+		err = DB.Where("scope = ? AND idempotency_key = ?", record.Scope, record.Key).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, nil
+		}
+		// The key has expired and may be used again.
+		err = DB.Unscoped().Where("id = ? AND expires_at <= ?", existing.ID, time.Now()).Delete(&models.IdempotencyRecord{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// renewIdempotencyLease extends the lease of the processing record until stop is closed.
+func renewIdempotencyLease(id uint, stop <-chan struct{}) {
+	ticker := time.NewTicker(idempotencyLeaseRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			result := DB.Model(&models.IdempotencyRecord{}).
+				Where("id = ? AND status = ?", id, models.IdempotencyStatusProcessing).
+				Update("expires_at", time.Now().Add(idempotencyProcessingLease))
+			if result.Error != nil {
+				btlLog.CUST.Error("renew idempotency record %v: %v", id, result.Error)
+			} else if result.RowsAffected == 0 {
+				return
+			}
+		}
+	}
+}
+
+// IdempotencyMiddleware makes a route safe to retry. A request carrying an Idempotency-Key runs once per
+// key and caller, retries with the same key get the stored response of the first run. Reusing a key for a
+// different request is rejected, as is a retry while the first run is still in progress. The run keeps
+// its key leased while the handler works, a retry only takes over the key of a run that stopped renewing it. Requests without the header run as usual. Keys are kept for a day.
+//
+// Use it after the authentication of the route, which names the caller, on the custody send and lock
+// endpoints and the pool add liquidity, remove liquidity, swap and withdraw award requests.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "idempotency key is too long"})
+			return
+		}
+		body, err := readBody(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "read body: " + err.Error()})
+			return
+		}
+		record := models.IdempotencyRecord{
+			Scope:       idempotencyScope(c),
+			Key:         key,
+			Fingerprint: hashPayload(append([]byte(c.Request.Method+" "+c.Request.URL.RequestURI()+"\n"), body...)),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			Status:      models.IdempotencyStatusProcessing,
+			ExpiresAt:   time.Now().Add(idempotencyProcessingLease),
+		}
+		existing, err := claimIdempotencyKey(&record)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "check idempotency key: " + err.Error()})
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != record.Fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "idempotency key has been used for a different request"})
+			case existing.Status == models.IdempotencyStatusProcessing:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "request with this idempotency key is still in progress"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.StatusCode, existing.ContentType, []byte(existing.ResponseBody))
+				c.Abort()
+			}
+			return
+		}
+
+		stop := make(chan struct{})
+		go renewIdempotencyLease(record.ID, stop)
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			close(stop)
+			if r := recover(); r != nil {
+				// Nothing was answered, so the key is freed for the retry.
+				if err := DB.Unscoped().Delete(&record).Error; err != nil {
+					btlLog.CUST.Error("delete idempotency record %v: %v", record.ID, err)
+				}
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		// A retry that reclaimed the key after a lapsed lease replaced the record, the update then matches nothing.
+		result := DB.Model(&record).Where("status = ?", models.IdempotencyStatusProcessing).Updates(map[string]any{
+			"status":        models.IdempotencyStatusCompleted,
+			"status_code":   writer.Status(),
+			"content_type":  writer.Header().Get("Content-Type"),
+			"response_body": writer.body.String(),
+			"expires_at":    time.Now().Add(idempotencyTtl),
+		})
+		if result.Error != nil {
+			btlLog.CUST.Error("complete idempotency record %v: %v", record.ID, result.Error)
+		} else if result.RowsAffected == 0 {
+			btlLog.CUST.Warning("idempotency record %v was reclaimed before the request finished", record.ID)
+		}
+	}
+}
+
+// CleanExpiredIdempotencyRecords deletes the records whose keys have expired.
+func CleanExpiredIdempotencyRecords() error {
+	return DB.Unscoped().Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyRecord{}).Error
+}
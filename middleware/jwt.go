@@ -3,9 +3,7 @@ package middleware
 import (
 	"errors"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/go-redis/redis/v8"
 	"time"
-	"trade/config"
 )
 
 var (
@@ -13,57 +11,39 @@ var (
 )
 
 type Claims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	SessionId string `json:"session_id,omitempty"`
+	DeviceId  string `json:"device_id,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(username string) (string, error) {
-	expirationTimeMinute := config.GetLoadConfig().Redis.ExpirationTimeMinute
-	if expirationTimeMinute == 0 {
-		expirationTimeMinute = 100 * 365 * 24 * 60
-	}
-	expirationTime := time.Now().Add(time.Duration(expirationTimeMinute) * time.Minute)
+// generateAccessToken issues a short-lived access token for the session.
+func generateAccessToken(username string, sessionId string, deviceId string) (string, int64, error) {
+	expiresAt := time.Now().Add(accessTokenLifetime()).Unix()
 	claims := &Claims{
-		Username: username,
+		Username:  username,
+		SessionId: sessionId,
+		DeviceId:  deviceId,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        sessionId,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(jwtKey)
 	if err != nil {
-		return "", err
-	}
-	validateToken, err := RedisGet(username)
-	if validateToken != "" {
-
-		return validateToken, nil
-	}
-
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return "", err
-	}
-
-	redisSetTimeMinute := config.GetLoadConfig().Redis.RedisSetTimeMinute
-	err = RedisSet(username, tokenString, time.Duration(redisSetTimeMinute)*time.Minute)
-	if err != nil {
-		return "", err
-	}
-	err = RedisSet(tokenString, username, time.Duration(redisSetTimeMinute)*time.Minute)
-	if err != nil {
-		return "", err
+		return "", 0, err
 	}
-	return tokenString, nil
+	return tokenString, expiresAt, nil
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-
-	_, err := RedisGet(tokenString)
-	if err != nil {
-		return nil, errors.New("invalid token")
-	}
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
 		return jwtKey, nil
 	})
 	if err != nil {
@@ -72,5 +52,20 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	if !token.Valid {
 		return nil, errors.New("invalid token")
 	}
+	if claims.SessionId == "" {
+		// Tokens issued before sessions are only valid while cached in redis.
+		_, err = RedisGet(tokenString)
+		if err != nil {
+			return nil, errors.New("invalid token")
+		}
+		return claims, nil
+	}
+	revoked, err := IsSessionRevoked(claims.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrSessionRevoked
+	}
 	return claims, nil
 }
@@ -99,3 +99,23 @@ func RedisDel1(key string) (int64, error) {
 	}
 	return result.Val(), nil
 }
+
+// RenewLock extends the expiration of a lock still held by identifier.
+func RenewLock(key string, identifier string, expiration time.Duration) (bool, error) {
+	luaScript := `
+    if redis.call("get", KEYS[1]) == ARGV[1] then
+        return redis.call("pexpire", KEYS[1], ARGV[2])
+    else
+        return 0
+    end
+    `
+	result, err := Client.Eval(ctx, luaScript, []string{key}, identifier, expiration.Milliseconds()).Result()
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+func RedisIncr(key string) (int64, error) {
+	return Client.Incr(ctx, key).Result()
+}
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"trade/btlLog"
+	"trade/config"
+	"trade/models"
+)
+
+const (
+	ServiceNameHeader      = "X-Service-Name"
+	ServiceTimestampHeader = "X-Timestamp"
+	ServiceNonceHeader     = "X-Nonce"
+	ServiceSignatureHeader = "X-Signature"
+
+	defaultTimestampToleranceSecond = 300
+	maxAuditResultLength            = 2048
+
+	serviceNonceKeyPrefix = "second_router_nonce_"
+)
+
+// auditUserFields are the payload fields of the second router requests that name the users a call acts on.
+var auditUserFields = []string{"npubkey", "username", "payerNpubkey", "receiverNpubkey"}
+
+func timestampTolerance() time.Duration {
+	second := config.GetConfig().SecondRouter.TimestampToleranceSecond
+	if second <= 0 {
+		second = defaultTimestampToleranceSecond
+	}
+	return time.Duration(second) * time.Second
+}
+
+func serviceSecret(name string) (string, bool) {
+	for _, service := range config.GetConfig().SecondRouter.Services {
+		if service.Name == name && service.Secret != "" {
+			return service.Secret, true
+		}
+	}
+	return "", false
+}
+
+func hashPayload(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// ServiceRequestSignature is the hex HMAC-SHA256, keyed with the service secret, of
+// method, request uri, timestamp, nonce and the hex sha256 of the body, joined by newlines.
+func ServiceRequestSignature(secret string, method string, requestUri string, timestamp string, nonce string, payloadHash string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, requestUri, timestamp, nonce, payloadHash}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func readBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// ServiceAuthMiddleware authenticates the services calling the second router. A caller either presents a
+// client certificate verified by the router's TLS listener, or signs the request with its shared secret.
+// Signed requests carry a timestamp and a nonce, each nonce is accepted once within the timestamp tolerance.
+func ServiceAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := readBody(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "read body: " + err.Error()})
+			return
+		}
+		payloadHash := hashPayload(body)
+		c.Set("payloadHash", payloadHash)
+
+		if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			c.Set("caller", c.Request.TLS.VerifiedChains[0][0].Subject.CommonName)
+			c.Set("authMethod", models.SecondRouterAuthMtls)
+			c.Next()
+			return
+		}
+
+		name := c.GetHeader(ServiceNameHeader)
+		timestamp := c.GetHeader(ServiceTimestampHeader)
+		nonce := c.GetHeader(ServiceNonceHeader)
+		signature := c.GetHeader(ServiceSignatureHeader)
+		if name == "" || timestamp == "" || nonce == "" || signature == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "service signature headers are required"})
+			return
+		}
+		secret, ok := serviceSecret(name)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unknown service"})
+			return
+		}
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid timestamp"})
+			return
+		}
+		tolerance := timestampTolerance()
+		skew := time.Since(time.Unix(unix, 0))
+		if skew > tolerance || skew < -tolerance {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "timestamp out of range"})
+			return
+		}
+		expected := ServiceRequestSignature(secret, c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, payloadHash)
+		if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+		// The nonce is remembered for twice the tolerance, which covers every timestamp still accepted.
+		fresh, err := Client.SetNX(ctx, serviceNonceKeyPrefix+name+"_"+nonce, timestamp, 2*tolerance).Result()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "check nonce: " + err.Error()})
+			return
+		}
+		if !fresh {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "nonce has already been used"})
+			return
+		}
+
+		c.Set("caller", name)
+		c.Set("authMethod", models.SecondRouterAuthHmac)
+		c.Set("nonce", nonce)
+		c.Next()
+	}
+}
+
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// affectedUsers collects the users named by the payload, in the order they appear in auditUserFields.
+func affectedUsers(body []byte) string {
+	var payload map[string]any
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	var users []string
+	seen := make(map[string]bool)
+	add := func(value any) {
+		user, ok := value.(string)
+		if ok && user != "" && !seen[user] {
+			seen[user] = true
+			users = append(users, user)
+		}
+	}
+	for _, field := range auditUserFields {
+		switch value := payload[field].(type) {
+		case []any:
+			for _, v := range value {
+				add(v)
+			}
+		default:
+			add(value)
+		}
+	}
+	return strings.Join(users, ",")
+}
+
+// AuditMiddleware writes a SecondRouterAuditLog for every call of the route it guards. It must run after
+// ServiceAuthMiddleware, which identifies the caller.
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		body, err := readBody(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "read body: " + err.Error()})
+			return
+		}
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		result := writer.body.String()
+		if len(result) > maxAuditResultLength {
+			result = result[:maxAuditResultLength]
+		}
+		authMethod, _ := c.Get("authMethod")
+		method, _ := authMethod.(models.SecondRouterAuthMethod)
+		record := models.SecondRouterAuditLog{
+			Caller:       c.GetString("caller"),
+			AuthMethod:   method,
+			Nonce:        c.GetString("nonce"),
+			ClientIp:     c.ClientIP(),
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.Path,
+			PayloadHash:  hashPayload(body),
+			AffectedUser: affectedUsers(body),
+			StatusCode:   writer.Status(),
+			Result:       result,
+			DurationMs:   time.Since(start).Milliseconds(),
+		}
+		err = DB.Create(&record).Error
+		if err != nil {
+			btlLog.CUST.Error("create second router audit log %v: %v", record, err)
+		}
+	}
+}
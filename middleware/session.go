@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+	"trade/config"
+	"trade/models"
+)
+
+const (
+	defaultAccessTokenExpirationMinute = 15
+	defaultRefreshTokenExpirationHour  = 30 * 24
+
+	revokedSessionKeyPrefix = "revoked_session_"
+)
+
+var (
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrSessionRevoked       = errors.New("session has been revoked")
+	ErrSessionExpired       = errors.New("session has expired")
+	ErrSessionDeviceChanged = errors.New("refresh token does not belong to this device")
+	ErrRefreshTokenReused   = errors.New("refresh token has already been used, session revoked")
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+)
+
+type SessionTokens struct {
+	SessionId             string `json:"sessionId"`
+	AccessToken           string `json:"token"`
+	AccessTokenExpiresAt  int64  `json:"expiresAt"`
+	RefreshToken          string `json:"refreshToken"`
+	RefreshTokenExpiresAt int64  `json:"refreshExpiresAt"`
+}
+
+func accessTokenLifetime() time.Duration {
+	minute := config.GetConfig().Session.AccessTokenExpirationMinute
+	if minute <= 0 {
+		minute = defaultAccessTokenExpirationMinute
+	}
+	return time.Duration(minute) * time.Minute
+}
+
+func refreshTokenLifetime() time.Duration {
+	hour := config.GetConfig().Session.RefreshTokenExpirationHour
+	if hour <= 0 {
+		hour = defaultRefreshTokenExpirationHour
+	}
+	return time.Duration(hour) * time.Hour
+}
+
+// newRefreshToken returns an opaque refresh token for the session and the hash stored in its place.
+func newRefreshToken(sessionId string) (string, string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken := sessionId + "." + hex.EncodeToString(secret)
+	return refreshToken, hashRefreshToken(refreshToken), nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
+}
+
+func sessionIdOfRefreshToken(refreshToken string) (string, error) {
+	sessionId, _, found := strings.Cut(refreshToken, ".")
+	if !found || sessionId == "" {
+		return "", ErrInvalidRefreshToken
+	}
+	return sessionId, nil
+}
+
+func issueSessionTokens(session *models.UserSession, refreshToken string) (*SessionTokens, error) {
+	accessToken, expiresAt, err := generateAccessToken(session.Username, session.SessionId, session.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionTokens{
+		SessionId:             session.SessionId,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// CreateSession signs the user in on the device. A device holds one session at a time, signing in
+// again on the same device revokes its previous session.
+func CreateSession(username string, deviceId string, ip string) (*SessionTokens, error) {
+	var user models.User
+	err := DB.Where("user_name = ?", username).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	if deviceId != "" {
+		var sessionIds []string
+		err = DB.Model(&models.UserSession{}).
+			Where("username = ? AND device_id = ? AND revoked_at = 0", username, deviceId).
+			Pluck("session_id", &sessionIds).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, sessionId := range sessionIds {
+			err = revokeSession(username, sessionId)
+			if err != nil && !errors.Is(err, ErrSessionNotFound) {
+				return nil, err
+			}
+		}
+	}
+
+	sessionId := uuid.New().String()
+	refreshToken, refreshTokenHash, err := newRefreshToken(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.UserSession{
+		SessionId:        sessionId,
+		UserId:           user.ID,
+		Username:         username,
+		DeviceId:         deviceId,
+		RefreshTokenHash: refreshTokenHash,
+		Ip:               ip,
+		ExpiresAt:        now.Add(refreshTokenLifetime()).Unix(),
+		LastUsedAt:       now.Unix(),
+	}
+	err = DB.Create(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return issueSessionTokens(&session, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new refresh token.
+// A refresh token is accepted once; presenting it again revokes the whole session.
+func RefreshSession(refreshToken string, deviceId string, ip string) (*SessionTokens, error) {
+	sessionId, err := sessionIdOfRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	var session models.UserSession
+	err = DB.Where("session_id = ?", sessionId).First(&session).Error
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != 0 {
+		return nil, ErrSessionRevoked
+	}
+	now := time.Now()
+	if now.Unix() >= session.ExpiresAt {
+		return nil, ErrSessionExpired
+	}
+	if session.DeviceId != "" && session.DeviceId != deviceId {
+		return nil, ErrSessionDeviceChanged
+	}
+	presentedHash := hashRefreshToken(refreshToken)
+	if presentedHash != session.RefreshTokenHash {
+		_ = revokeSession(session.Username, session.SessionId)
+		return nil, ErrRefreshTokenReused
+	}
+
+	newToken, newTokenHash, err := newRefreshToken(session.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := now.Add(refreshTokenLifetime()).Unix()
+	// The hash condition makes the rotation atomic, of two concurrent refreshes with the same token only one wins.
+	result := DB.Model(&models.UserSession{}).
+		Where("session_id = ? AND refresh_token_hash = ? AND revoked_at = 0", session.SessionId, presentedHash).
+		Updates(map[string]any{
+			"refresh_token_hash": newTokenHash,
+			"ip":                 ip,
+			"expires_at":         expiresAt,
+			"last_used_at":       now.Unix(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		_ = revokeSession(session.Username, session.SessionId)
+		return nil, ErrRefreshTokenReused
+	}
+	session.ExpiresAt = expiresAt
+	return issueSessionTokens(&session, newToken)
+}
+
+// ListUserSessions returns the user's sessions that are neither revoked nor expired, most recently used first.
+func ListUserSessions(username string) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := DB.Where("username = ? AND revoked_at = 0 AND expires_at > ?", username, time.Now().Unix()).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs the session out. Its access tokens are rejected from now on and its refresh token can no longer be used.
+func RevokeSession(username string, sessionId string) error {
+	return revokeSession(username, sessionId)
+}
+
+func revokeSession(username string, sessionId string) error {
+	result := DB.Model(&models.UserSession{}).
+		Where("username = ? AND session_id = ? AND revoked_at = 0", username, sessionId).
+		Update("revoked_at", time.Now().Unix())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	// Access tokens of the session outlive it by at most their lifetime, so the mark can expire with them.
+	return RedisSet(revokedSessionKeyPrefix+sessionId, username, accessTokenLifetime())
+}
+
+// IsSessionRevoked reports whether the session was revoked while its access tokens are still unexpired.
+func IsSessionRevoked(sessionId string) (bool, error) {
+	_, err := RedisGet(revokedSessionKeyPrefix + sessionId)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
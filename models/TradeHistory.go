@@ -5,11 +5,15 @@ import (
 	"time"
 )
 
+// TradeHistory is one completed trade. OrderID is unique, so a TradeOrder is recorded once.
 type TradeHistory struct {
 	gorm.Model
-	TradePair string    `gorm:"size:20;not null"`
-	TradeTime time.Time `gorm:"not null"`
+	OrderID   string    `gorm:"size:64;uniqueIndex"`
+	TradePair string    `gorm:"size:20;not null;index:idx_trade_pair_trade_time"`
+	TradeTime time.Time `gorm:"not null;index:idx_trade_pair_trade_time"`
 	UnitPrice float64   `gorm:"type:decimal(15,2);not null"`
+	Quantity  float64   `gorm:"type:decimal(15,2);not null"`
+	Amount    float64   `gorm:"type:decimal(15,2);not null"`
 	Buyer     string    `gorm:"size:100;not null"`
 	Seller    string    `gorm:"size:100;not null"`
 }
@@ -2,9 +2,17 @@ package models
 
 import "time"
 
+// AggregatedTradeData is one bucket of trade history. Volume is the traded asset quantity,
+// Amount is the traded sats and Vwap is the volume weighted average unit price.
 type AggregatedTradeData struct {
-	Period        time.Time
-	AvgPrice      float64
-	TotalQuantity float64
-	TradeCount    int
+	Period     time.Time `json:"period"`
+	TradePair  string    `json:"trade_pair"`
+	Open       float64   `json:"open"`
+	High       float64   `json:"high"`
+	Low        float64   `json:"low"`
+	Close      float64   `json:"close"`
+	Vwap       float64   `json:"vwap"`
+	Volume     float64   `json:"volume"`
+	Amount     float64   `json:"amount"`
+	TradeCount int       `json:"trade_count"`
 }
@@ -2,20 +2,21 @@ package models
 
 import (
 	"gorm.io/gorm"
+	"trade/models/custodyModels"
 )
 
 type Balance struct {
 	gorm.Model
-	AccountId   uint         `gorm:"column:account_id;type:bigint unsigned" json:"accountId"`
-	BillType    BalanceType  `gorm:"column:bill_type;type:smallint" json:"billType"`
-	Away        BalanceAway  `gorm:"column:away;type:smallint" json:"away"`
-	Amount      float64      `gorm:"column:amount;type:decimal(25,2)" json:"amount"`
-	Unit        BalanceUnit  `gorm:"column:Unit;type:smallint" json:"unit"`
-	ServerFee   float64      `gorm:"column:server_fee;type:decimal(25,2)" json:"serverFee"`
-	AssetId     *string      `gorm:"column:asset_id;type:varchar(512);default:'00'" json:"assetId"`
-	Invoice     *string      `gorm:"column:invoice;type:varchar(1024)" json:"invoice"`
-	PaymentHash *string      `gorm:"column:payment_hash;type:varchar(100)" json:"paymentHash"`
-	State       BalanceState `gorm:"column:State;type:smallint" json:"State"`
+	AccountId   uint                 `gorm:"column:account_id;type:bigint unsigned" json:"accountId"`
+	BillType    BalanceType          `gorm:"column:bill_type;type:smallint" json:"billType"`
+	Away        BalanceAway          `gorm:"column:away;type:smallint" json:"away"`
+	Amount      custodyModels.Amount `gorm:"column:amount;type:decimal(38,0)" json:"amount"`
+	Unit        BalanceUnit          `gorm:"column:Unit;type:smallint" json:"unit"`
+	ServerFee   custodyModels.Amount `gorm:"column:server_fee;type:decimal(38,0)" json:"serverFee"`
+	AssetId     *string              `gorm:"column:asset_id;type:varchar(512);default:'00'" json:"assetId"`
+	Invoice     *string              `gorm:"column:invoice;type:varchar(1024)" json:"invoice"`
+	PaymentHash *string              `gorm:"column:payment_hash;type:varchar(100)" json:"paymentHash"`
+	State       BalanceState         `gorm:"column:State;type:smallint" json:"State"`
 	TypeExt     *BalanceTypeExt
 }
 
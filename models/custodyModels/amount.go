@@ -0,0 +1,84 @@
+package custodyModels
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+)
+
+// AmountScale is the number of fraction digits of every ledger amount. Sat
+// and asset amounts are integral base units and the ledger columns are
+// decimal(38,0), so a float64 value is rounded to a whole unit on read.
+const AmountScale = 0
+
+// maxExactFloatAmount is the largest integer a float64 holds exactly (2^53).
+var maxExactFloatAmount = decimal.New(1<<53, 0)
+
+var (
+	ErrFractionalAmount = errors.New("amount is not an integral number of base units")
+	ErrAmountOverflow   = errors.New("amount exceeds the float64 exact integer range")
+)
+
+// Amount is a ledger amount on a decimal column. It encodes as a JSON
+// number like the float64 amounts it replaced.
+type Amount struct {
+	decimal.Decimal
+}
+
+func NewAmount(value decimal.Decimal) Amount {
+	return Amount{Decimal: value}
+}
+
+// NewAmountFromInt converts an integral base-unit amount.
+func NewAmountFromInt(value int64) Amount {
+	return Amount{Decimal: decimal.NewFromInt(value)}
+}
+
+// NewAmountFromFloat64 converts a float64 amount of a caller still working in
+// float64, see AmountFromFloat64.
+func NewAmountFromFloat64(f float64) Amount {
+	return Amount{Decimal: AmountFromFloat64(f)}
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.Decimal.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	return a.Decimal.UnmarshalJSON(data)
+}
+
+// AmountFromBigInt converts a pool base-unit amount to a ledger amount.
+func AmountFromBigInt(bi *big.Int) decimal.Decimal {
+	if bi == nil {
+		return decimal.Zero
+	}
+	return decimal.NewFromBigInt(bi, 0)
+}
+
+// AmountToBigInt converts a ledger amount back to pool base units.
+func AmountToBigInt(amount decimal.Decimal) (*big.Int, error) {
+	if !amount.IsInteger() {
+		return nil, ErrFractionalAmount
+	}
+	return amount.BigInt(), nil
+}
+
+// AmountFromFloat64 converts a value read from a legacy float64 column,
+// rounding away binary representation error at the ledger scale.
+func AmountFromFloat64(f float64) decimal.Decimal {
+	return decimal.NewFromFloat(f).Round(AmountScale)
+}
+
+// AmountToFloat64 converts a ledger amount for callers still working in
+// float64. It refuses values a float64 cannot represent exactly.
+func AmountToFloat64(amount decimal.Decimal) (float64, error) {
+	if !amount.IsInteger() {
+		return 0, ErrFractionalAmount
+	}
+	if amount.Abs().GreaterThan(maxExactFloatAmount) {
+		return 0, ErrAmountOverflow
+	}
+	return amount.InexactFloat64(), nil
+}
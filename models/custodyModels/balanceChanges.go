@@ -6,9 +6,9 @@ type AccountBalanceChange struct {
 	gorm.Model
 	AccountId    uint       `gorm:"column:account_id;type:bigint unsigned;" json:"accountId"`
 	AssetId      string     `gorm:"column:asset_id;type:varchar(128);" json:"assetId"`
-	ChangeAmount float64    `gorm:"type:decimal(25,2);column:amount" json:"amount"`
+	ChangeAmount Amount     `gorm:"type:decimal(38,0);column:amount" json:"amount"`
 	Away         ChangeAway `gorm:"column:away;type:tinyint unsigned" json:"away"`
-	FinalBalance float64    `gorm:"type:decimal(25,2);column:final_balance" json:"finalBalance"`
+	FinalBalance Amount     `gorm:"type:decimal(38,0);column:final_balance" json:"finalBalance"`
 	BalanceId    uint       `gorm:"column:balance_id;type:bigint unsigned;index:idx_balance_id" json:"balanceId"`
 	ChangeType   ChangeType `gorm:"column:change_type;type:varchar(128)" json:"changeType"`
 }
@@ -35,6 +35,7 @@ const (
 
 	ChangeTypeBtcPayOnchain     = "pay_onchain_btc"
 	ChangeTypeBtcReceiveOnchain = "receive_onchain_btc"
+	ChangeTypeBtcRefundOnchain  = "refund_onchain_btc"
 
 	ChangeTypeBtcFee        = "btc_fee"
 	ChangeTypeAssetFee      = "asset_fee"
@@ -56,6 +57,7 @@ const (
 	ChangeTypeAssetPayLocal       = "pay_local_asset"
 	ChangeTypeAssetReceiveLocal   = "receive_local_asset"
 	ChangeTypeAssetReceiveOutside = "receive_outside_asset"
+	ChangeTypeAssetRefundOutside  = "refund_outside_asset"
 
 	ChangeTypeLock           = "lock"
 	ChangeTypeUnlock         = "unlock"
@@ -1,10 +1,54 @@
 package custodyModels
 
+import "gorm.io/gorm"
+
 type Control struct {
 	ControlName string `gorm:"primarykey" json:"control_name"`
 	Status      bool   `gorm:"not null" json:"status"`
+	UpdatedBy   string `gorm:"type:varchar(128)" json:"updated_by"`
+	Reason      string `gorm:"type:varchar(255)" json:"reason"`
+	UpdatedAt   int64  `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 func (Control) TableName() string {
 	return "user_account_controls"
 }
+
+// ControlWindow disables a control every day from StartMinute to EndMinute, minutes after local midnight.
+// A window whose end is before its start runs past midnight.
+type ControlWindow struct {
+	gorm.Model
+	ControlName string `gorm:"type:varchar(255);index;not null" json:"control_name"`
+	StartMinute int    `gorm:"not null" json:"start_minute"`
+	EndMinute   int    `gorm:"not null" json:"end_minute"`
+	CreatedBy   string `gorm:"type:varchar(128)" json:"created_by"`
+	Reason      string `gorm:"type:varchar(255)" json:"reason"`
+}
+
+func (ControlWindow) TableName() string {
+	return "user_account_control_windows"
+}
+
+// ControlHistory records every change of a control and who made it.
+type ControlHistory struct {
+	gorm.Model
+	ControlName string        `gorm:"type:varchar(255);index;not null" json:"control_name"`
+	Action      ControlAction `gorm:"type:varchar(32);not null" json:"action"`
+	OldStatus   bool          `json:"old_status"`
+	NewStatus   bool          `json:"new_status"`
+	WindowId    uint          `json:"window_id"`
+	Operator    string        `gorm:"type:varchar(128)" json:"operator"`
+	Reason      string        `gorm:"type:varchar(255)" json:"reason"`
+}
+
+func (ControlHistory) TableName() string {
+	return "user_account_control_history"
+}
+
+type ControlAction string
+
+const (
+	ControlActionSet          ControlAction = "set"
+	ControlActionAddWindow    ControlAction = "add_window"
+	ControlActionDeleteWindow ControlAction = "delete_window"
+)
@@ -4,9 +4,9 @@ import "gorm.io/gorm"
 
 type AccountBalance struct {
 	gorm.Model
-	AccountID uint    `gorm:"column:account_id;type:bigint unsigned;uniqueIndex:idx_account_id_asset_id" json:"accountId"`
-	AssetId   string  `gorm:"column:asset_id;type:varchar(128);uniqueIndex:idx_account_id_asset_id" json:"assetId"`
-	Amount    float64 `gorm:"type:decimal(25,2);column:amount" json:"amount"`
+	AccountID uint   `gorm:"column:account_id;type:bigint unsigned;uniqueIndex:idx_account_id_asset_id" json:"accountId"`
+	AssetId   string `gorm:"column:asset_id;type:varchar(128);uniqueIndex:idx_account_id_asset_id" json:"assetId"`
+	Amount    Amount `gorm:"type:decimal(38,0);column:amount" json:"amount"`
 }
 
 func (AccountBalance) TableName() string {
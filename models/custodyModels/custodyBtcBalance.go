@@ -4,8 +4,8 @@ import "gorm.io/gorm"
 
 type AccountBtcBalance struct {
 	gorm.Model
-	AccountId uint    `gorm:"column:account_id;type:bigint unsigned;uniqueIndex:idx_account_id" json:"accountId"`
-	Amount    float64 `gorm:"type:decimal(25,2);column:amount" json:"amount"`
+	AccountId uint   `gorm:"column:account_id;type:bigint unsigned;uniqueIndex:idx_account_id" json:"accountId"`
+	Amount    Amount `gorm:"type:decimal(38,0);column:amount" json:"amount"`
 }
 
 func (AccountBtcBalance) TableName() string {
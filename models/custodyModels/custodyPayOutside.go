@@ -10,7 +10,17 @@ type PayOutside struct {
 	Amount    float64          `gorm:"type:decimal(25,2);column:amount" json:"amount"`
 	TxHash    string           `gorm:"column:tx_hash;type:varchar(100)" json:"txHash"`
 	BalanceId uint             `gorm:"column:balance_id;type:bigint;default:0" json:"balance_id"`
-	Status    PayOutsideStatus `gorm:"column:status;type:smallint" json:"status"`
+	Status    PayOutsideStatus `gorm:"column:status;type:smallint;index:idx_status_next_attempt_at" json:"status"`
+
+	BatchId        string `gorm:"column:batch_id;type:varchar(64);index:idx_batch_id" json:"batchId"`
+	Attempts       int    `gorm:"column:attempts;default:0" json:"attempts"`
+	NextAttemptAt  int64  `gorm:"column:next_attempt_at;default:0;index:idx_status_next_attempt_at" json:"nextAttemptAt"`
+	LastError      string `gorm:"column:last_error;type:text" json:"lastError"`
+	LeaseOwner     string `gorm:"column:lease_owner;type:varchar(128)" json:"leaseOwner"`
+	LeaseExpiresAt int64  `gorm:"column:lease_expires_at;default:0" json:"leaseExpiresAt"`
+	Memo           string `gorm:"column:memo;type:varchar(255)" json:"memo"`
+	// HeightHint is the best block height when a btc mission was sent, its wallet transaction is not older.
+	HeightHint int32 `gorm:"column:height_hint;default:0" json:"heightHint"`
 }
 
 func (PayOutside) TableName() string {
@@ -19,8 +29,49 @@ func (PayOutside) TableName() string {
 
 type PayOutsideStatus int16
 
+// A mission waits in Pending until a worker leases it into Sending. Sending ends in Paid once the anchor
+// transaction is broadcast, or back in Pending for a retry; Paid ends in Success once it confirms.
+// Missions out of retries wait in Failed, where admins can retry them or cancel them into Cancelled.
+// Over limit missions start in Review and enter Pending once an admin approves them. Btc missions, asset
+// id 00, are claimed into Sending by the withdrawal, the approval of its review or an admin retry, and sent
+// right away in a wallet transaction labelled after the mission. Sending ends in Success once the wallet
+// has the transaction, or in Failed when it has none.
+const (
+	PayOutsideStatusPending   PayOutsideStatus = 0
+	PayOutsideStatusPaid      PayOutsideStatus = 1
+	PayOutsideStatusSuccess   PayOutsideStatus = 2
+	PayOutsideStatusFailed    PayOutsideStatus = 3
+	PayOutsideStatusCancelled PayOutsideStatus = 4
+	PayOutsideStatusSending   PayOutsideStatus = 5
+	PayOutsideStatusReview    PayOutsideStatus = 6
+)
+
+// PayOutsideBatch is one SendAsset call paying a batch of PayOutside missions in a single anchor transaction.
+// The batch id is the transfer label, so a batch whose worker died mid send can be found in tapd's transfers.
+// ChangeOutput is the anchor transaction's btc change output that fee bumps spend, -1 when there is none.
+type PayOutsideBatch struct {
+	gorm.Model
+	BatchId      string                `gorm:"column:batch_id;type:varchar(64);uniqueIndex" json:"batchId"`
+	Status       PayOutsideBatchStatus `gorm:"column:status;type:smallint;index" json:"status"`
+	TxHash       string                `gorm:"column:tx_hash;type:varchar(100);index" json:"txHash"`
+	AnchorTx     string                `gorm:"column:anchor_tx;type:mediumtext" json:"-"`
+	ChainFees    int64                 `gorm:"column:chain_fees" json:"chainFees"`
+	ChangeOutput int32                 `gorm:"column:change_output;default:-1" json:"changeOutput"`
+	BroadcastAt  int64                 `gorm:"column:broadcast_at" json:"broadcastAt"`
+	BumpCount    int                   `gorm:"column:bump_count;default:0" json:"bumpCount"`
+	LastBumpAt   int64                 `gorm:"column:last_bump_at;default:0" json:"lastBumpAt"`
+	LastError    string                `gorm:"column:last_error;type:text" json:"lastError"`
+}
+
+func (PayOutsideBatch) TableName() string {
+	return "user_account_outside_asset_batch"
+}
+
+type PayOutsideBatchStatus int16
+
 const (
-	PayOutsideStatusPending PayOutsideStatus = 0
-	PayOutsideStatusPaid    PayOutsideStatus = 1
-	PayOutsideStatusSuccess PayOutsideStatus = 2
+	PayOutsideBatchStatusSending   PayOutsideBatchStatus = 0
+	PayOutsideBatchStatusBroadcast PayOutsideBatchStatus = 1
+	PayOutsideBatchStatusConfirmed PayOutsideBatchStatus = 2
+	PayOutsideBatchStatusFailed    PayOutsideBatchStatus = 3
 )
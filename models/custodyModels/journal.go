@@ -0,0 +1,50 @@
+package custodyModels
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// JournalEntry is one custody operation posted to the double-entry journal. The amounts of its lines sum to
+// zero in every asset.
+type JournalEntry struct {
+	gorm.Model
+	Operation JournalOperation `gorm:"column:operation;type:varchar(32);index:idx_operation" json:"operation"`
+	Reference string           `gorm:"column:reference;type:varchar(255);index:idx_reference" json:"reference"`
+	Lines     []JournalLine    `gorm:"foreignKey:EntryId" json:"lines"`
+}
+
+func (JournalEntry) TableName() string {
+	return "custody_journal_entry"
+}
+
+// JournalLine debits an account with a positive amount and credits it with a negative one.
+type JournalLine struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index:idx_created_at" json:"createdAt"`
+	EntryId   uint      `gorm:"column:entry_id;type:bigint unsigned;index:idx_entry_id" json:"entryId"`
+	Account   string    `gorm:"column:account;type:varchar(64);index:idx_account_asset_id" json:"account"`
+	AssetId   string    `gorm:"column:asset_id;type:varchar(128);index:idx_account_asset_id" json:"assetId"`
+	Amount    Amount    `gorm:"column:amount;type:decimal(38,0)" json:"amount"`
+}
+
+func (JournalLine) TableName() string {
+	return "custody_journal_line"
+}
+
+type JournalOperation string
+
+const (
+	JournalOperationOpening        JournalOperation = "opening"
+	JournalOperationInsideTransfer JournalOperation = "inside_transfer"
+	JournalOperationOutsidePayment JournalOperation = "outside_payment"
+	JournalOperationOutsideRefund  JournalOperation = "outside_refund"
+	JournalOperationLock           JournalOperation = "lock"
+	JournalOperationUnlock         JournalOperation = "unlock"
+	JournalOperationLockedTransfer JournalOperation = "locked_transfer"
+	JournalOperationPoolTransfer   JournalOperation = "pool_transfer"
+	JournalOperationAward          JournalOperation = "award"
+	JournalOperationFee            JournalOperation = "fee"
+	JournalOperationFeeRefund      JournalOperation = "fee_refund"
+	JournalOperationReplaceAsset   JournalOperation = "replace_asset"
+)
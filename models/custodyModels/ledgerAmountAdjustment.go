@@ -0,0 +1,18 @@
+package custodyModels
+
+import "gorm.io/gorm"
+
+// LedgerAmountAdjustment records a ledger value the ledger amount migration truncated to integral base
+// units. The float64 ledger left such sub-unit remainders, reconciliation accounts for them from here.
+type LedgerAmountAdjustment struct {
+	gorm.Model
+	LedgerTable  string `gorm:"column:ledger_table;type:varchar(64);index:idx_ledger_table_row_id" json:"ledgerTable"`
+	LedgerColumn string `gorm:"column:ledger_column;type:varchar(64)" json:"ledgerColumn"`
+	RowId        uint   `gorm:"column:row_id;type:bigint unsigned;index:idx_ledger_table_row_id" json:"rowId"`
+	OldAmount    string `gorm:"column:old_amount;type:varchar(64)" json:"oldAmount"`
+	NewAmount    string `gorm:"column:new_amount;type:varchar(64)" json:"newAmount"`
+}
+
+func (LedgerAmountAdjustment) TableName() string {
+	return "custody_ledger_amount_adjustment"
+}
@@ -0,0 +1,51 @@
+package custodyModels
+
+import "gorm.io/gorm"
+
+// LimitRule caps what a user may move through a LimitType within a rolling window. Level 0 applies the rule
+// to every level. MaxAmountSat caps the sat value moved in the window and MaxCount the number of transfers,
+// so a one hour window with only MaxCount set is a velocity rule. Zero leaves a cap unset.
+type LimitRule struct {
+	gorm.Model
+	LimitTypeId  uint            `gorm:"column:limit_type_id;type:bigint unsigned;index:idx_limit_type_id_level;not null" json:"limitTypeId"`
+	Level        uint            `gorm:"column:level;type:bigint unsigned;index:idx_limit_type_id_level;default:0" json:"level"`
+	WindowSecond int64           `gorm:"column:window_second;not null" json:"windowSecond"`
+	MaxAmountSat float64         `gorm:"column:max_amount_sat;type:decimal(25,2);default:0" json:"maxAmountSat"`
+	MaxCount     uint            `gorm:"column:max_count;type:bigint unsigned;default:0" json:"maxCount"`
+	Action       LimitRuleAction `gorm:"column:action;type:smallint;default:0" json:"action"`
+	Enabled      bool            `gorm:"column:enabled;default:true" json:"enabled"`
+	Memo         string          `gorm:"column:memo;type:varchar(128)" json:"memo"`
+}
+
+func (LimitRule) TableName() string {
+	return "user_limit_rule"
+}
+
+type LimitRuleAction int16
+
+const (
+	LimitRuleActionReject LimitRuleAction = 0
+	LimitRuleActionReview LimitRuleAction = 1
+)
+
+const (
+	LimitWindowHour  int64 = 60 * 60
+	LimitWindowDay   int64 = 24 * LimitWindowHour
+	LimitWindowWeek  int64 = 7 * LimitWindowDay
+	LimitWindowMonth int64 = 30 * LimitWindowDay
+)
+
+// LimitUsage is one transfer counted against the rolling limit rules.
+type LimitUsage struct {
+	gorm.Model
+	UserId    uint    `gorm:"column:user_id;type:bigint unsigned;index:idx_user_id_limit_type_created_at;not null" json:"userId"`
+	LimitType uint    `gorm:"column:limit_type;type:bigint unsigned;index:idx_user_id_limit_type_created_at;not null" json:"limitType"`
+	AssetId   string  `gorm:"column:asset_id;type:varchar(128)" json:"assetId"`
+	Amount    float64 `gorm:"column:amount;type:decimal(25,2)" json:"amount"`
+	AmountSat float64 `gorm:"column:amount_sat;type:decimal(25,2)" json:"amountSat"`
+	BalanceId uint    `gorm:"column:balance_id;type:bigint unsigned" json:"balanceId"`
+}
+
+func (LimitUsage) TableName() string {
+	return "user_limit_usage"
+}
@@ -0,0 +1,15 @@
+package custodyModels
+
+import "gorm.io/gorm"
+
+// LockFence is the highest fencing token that has written under a custody lock. A holder whose token is
+// lower has lost the lock to a newer holder and must not write.
+type LockFence struct {
+	gorm.Model
+	LockKey string `gorm:"column:lock_key;type:varchar(128);uniqueIndex;not null" json:"lockKey"`
+	Token   int64  `gorm:"column:token;not null" json:"token"`
+}
+
+func (LockFence) TableName() string {
+	return "custody_lock_fence"
+}
@@ -1,10 +1,12 @@
 package pAccount
 
+import "trade/models/custodyModels"
+
 type PAccountBalance struct {
-	Id            uint    `gorm:"primary_key"`
-	PoolAccountId uint    `gorm:"index;column:pool_account_id;uniqueIndex:unique_pool_asset;not null"`
-	AssetId       string  `gorm:"column:asset_id;type:varchar(128);uniqueIndex:unique_pool_asset;not null"`
-	Balance       float64 `gorm:"column:balance;type:decimal(25,2);"`
+	Id            uint                 `gorm:"primary_key"`
+	PoolAccountId uint                 `gorm:"index;column:pool_account_id;uniqueIndex:unique_pool_asset;not null"`
+	AssetId       string               `gorm:"column:asset_id;type:varchar(128);uniqueIndex:unique_pool_asset;not null"`
+	Balance       custodyModels.Amount `gorm:"column:balance;type:decimal(38,0);"`
 
 	PoolAccount *PoolAccount `gorm:"foreignkey:PoolAccountId"`
 }
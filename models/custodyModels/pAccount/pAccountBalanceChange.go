@@ -1,12 +1,14 @@
 package pAccount
 
+import "trade/models/custodyModels"
+
 type PAccountBalanceChange struct {
-	Id            uint    `gorm:"primary_key"`
-	PoolAccountId uint    `gorm:"index;column:pool_account_id;not null"`
-	AssetId       string  `gorm:"column:asset_id;varchar(128);not null"`
-	BillId        uint    `gorm:"column:bill_id;unique;"`
-	Amount        float64 `gorm:"column:amount;type:decimal(25,2);"`
-	FinalBalance  float64 `gorm:"column:final_balance;type:decimal(25,2);not null"`
+	Id            uint                 `gorm:"primary_key"`
+	PoolAccountId uint                 `gorm:"index;column:pool_account_id;not null"`
+	AssetId       string               `gorm:"column:asset_id;varchar(128);not null"`
+	BillId        uint                 `gorm:"column:bill_id;unique;"`
+	Amount        custodyModels.Amount `gorm:"column:amount;type:decimal(38,0);"`
+	FinalBalance  custodyModels.Amount `gorm:"column:final_balance;type:decimal(38,0);not null"`
 
 	PoolAccount *PoolAccount `gorm:"foreignkey:PoolAccountId"`
 }
@@ -1,16 +1,19 @@
 package pAccount
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"trade/models/custodyModels"
+)
 
 type PAccountBill struct {
 	gorm.Model
-	PoolAccountId uint             `gorm:"index;column:pool_account_id;not null"`
-	Away          PAccountBillAway `gorm:"column:away;type:smallint" json:"away"`
-	Target        string           `gorm:"column:target;type:varchar(100)" json:"target"`
-	Amount        float64          `gorm:"column:amount;type:decimal(25,2)" json:"amount"`
-	AssetId       string           `gorm:"column:asset_id;varchar(128);default:'00'" json:"assetId"`
-	PaymentHash   string           `gorm:"column:payment_hash;type:varchar(100)" json:"paymentHash"`
-	State         PAccountState    `gorm:"column:State;type:smallint" json:"State"`
+	PoolAccountId uint                 `gorm:"index;column:pool_account_id;not null"`
+	Away          PAccountBillAway     `gorm:"column:away;type:smallint" json:"away"`
+	Target        string               `gorm:"column:target;type:varchar(100)" json:"target"`
+	Amount        custodyModels.Amount `gorm:"column:amount;type:decimal(38,0)" json:"amount"`
+	AssetId       string               `gorm:"column:asset_id;varchar(128);default:'00'" json:"assetId"`
+	PaymentHash   string               `gorm:"column:payment_hash;type:varchar(100)" json:"paymentHash"`
+	State         PAccountState        `gorm:"column:State;type:smallint" json:"State"`
 
 	PoolAccount *PoolAccount `gorm:"foreignkey:PoolAccountId"`
 }
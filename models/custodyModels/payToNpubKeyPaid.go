@@ -0,0 +1,16 @@
+package custodyModels
+
+import "gorm.io/gorm"
+
+// PayToNpubKeyPaid records a paid v2 pay to npub key invoice. The unique payment hash makes an invoice payable once.
+type PayToNpubKeyPaid struct {
+	gorm.Model
+	PaymentHash    string `gorm:"column:payment_hash;type:varchar(64);uniqueIndex"`
+	NpubKey        string `gorm:"column:npub_key;type:varchar(255)"`
+	PayerAccountId uint   `gorm:"column:payer_account_id;index"`
+	Invoice        string `gorm:"column:invoice;type:text"`
+}
+
+func (PayToNpubKeyPaid) TableName() string {
+	return "user_ptn_invoice_paid"
+}
@@ -0,0 +1,24 @@
+package custodyModels
+
+import "gorm.io/gorm"
+
+// SolvencySnapshot compares what custody owes its users in one asset with what the nodes hold.
+// There is one snapshot per asset and day, each reconciliation run of the day overwrites it.
+type SolvencySnapshot struct {
+	gorm.Model
+	Date            string `gorm:"column:date;type:varchar(10);uniqueIndex:idx_date_asset_id" json:"date"`
+	AssetId         string `gorm:"column:asset_id;type:varchar(128);uniqueIndex:idx_date_asset_id" json:"assetId"`
+	UserLiability   Amount `gorm:"column:user_liability;type:decimal(38,0)" json:"userLiability"`
+	LockLiability   Amount `gorm:"column:lock_liability;type:decimal(38,0)" json:"lockLiability"`
+	PoolLiability   Amount `gorm:"column:pool_liability;type:decimal(38,0)" json:"poolLiability"`
+	TotalLiability  Amount `gorm:"column:total_liability;type:decimal(38,0)" json:"totalLiability"`
+	NodeHolding     Amount `gorm:"column:node_holding;type:decimal(38,0)" json:"nodeHolding"`
+	InFlightOutside Amount `gorm:"column:in_flight_outside;type:decimal(38,0)" json:"inFlightOutside"`
+	Delta           Amount `gorm:"column:delta;type:decimal(38,0)" json:"delta"`
+	Threshold       Amount `gorm:"column:threshold;type:decimal(38,0)" json:"threshold"`
+	Alerted         bool   `gorm:"column:alerted" json:"alerted"`
+}
+
+func (SolvencySnapshot) TableName() string {
+	return "custody_solvency_snapshot"
+}
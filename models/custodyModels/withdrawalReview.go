@@ -0,0 +1,35 @@
+package custodyModels
+
+import "gorm.io/gorm"
+
+// WithdrawalReview holds an over limit withdrawal for an admin. The user's funds are debited when the
+// withdrawal is created and stay out of the balance until the review is approved or rejected and refunded.
+type WithdrawalReview struct {
+	gorm.Model
+	UserId     uint                   `gorm:"column:user_id;type:bigint unsigned;index;not null" json:"userId"`
+	AccountId  uint                   `gorm:"column:account_id;type:bigint unsigned" json:"accountId"`
+	LimitType  uint                   `gorm:"column:limit_type;type:bigint unsigned" json:"limitType"`
+	RuleId     uint                   `gorm:"column:rule_id;type:bigint unsigned" json:"ruleId"`
+	AssetId    string                 `gorm:"column:asset_id;type:varchar(128)" json:"assetId"`
+	Amount     float64                `gorm:"column:amount;type:decimal(25,2)" json:"amount"`
+	AmountSat  float64                `gorm:"column:amount_sat;type:decimal(25,2)" json:"amountSat"`
+	BalanceId  uint                   `gorm:"column:balance_id;type:bigint unsigned" json:"balanceId"`
+	MissionId  uint                   `gorm:"column:mission_id;type:bigint unsigned;uniqueIndex" json:"missionId"`
+	Status     WithdrawalReviewStatus `gorm:"column:status;type:smallint;index" json:"status"`
+	Reason     string                 `gorm:"column:reason;type:varchar(255)" json:"reason"`
+	Reviewer   string                 `gorm:"column:reviewer;type:varchar(128)" json:"reviewer"`
+	ReviewedAt int64                  `gorm:"column:reviewed_at;default:0" json:"reviewedAt"`
+	Memo       string                 `gorm:"column:memo;type:varchar(255)" json:"memo"`
+}
+
+func (WithdrawalReview) TableName() string {
+	return "user_withdrawal_review"
+}
+
+type WithdrawalReviewStatus int16
+
+const (
+	WithdrawalReviewStatusPending  WithdrawalReviewStatus = 0
+	WithdrawalReviewStatusApproved WithdrawalReviewStatus = 1
+	WithdrawalReviewStatusRejected WithdrawalReviewStatus = 2
+)
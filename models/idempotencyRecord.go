@@ -0,0 +1,33 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type IdempotencyStatus uint8
+
+const (
+	IdempotencyStatusProcessing IdempotencyStatus = 0
+	IdempotencyStatusCompleted  IdempotencyStatus = 1
+)
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key and the response it got, so a retry
+// with the same key gets the same response instead of running again. Keys are unique per caller.
+type IdempotencyRecord struct {
+	gorm.Model
+	Scope        string            `json:"scope" gorm:"type:varchar(255);uniqueIndex:idx_scope_key"`
+	Key          string            `json:"key" gorm:"column:idempotency_key;type:varchar(128);uniqueIndex:idx_scope_key"`
+	Fingerprint  string            `json:"fingerprint" gorm:"type:varchar(64)"`
+	Method       string            `json:"method" gorm:"type:varchar(16)"`
+	Path         string            `json:"path" gorm:"type:varchar(255)"`
+	Status       IdempotencyStatus `json:"status" gorm:"type:tinyint unsigned"`
+	StatusCode   int               `json:"status_code"`
+	ContentType  string            `json:"content_type" gorm:"type:varchar(255)"`
+	ResponseBody string            `json:"response_body" gorm:"type:mediumtext"`
+	ExpiresAt    time.Time         `json:"expires_at" gorm:"index"`
+}
+
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_record"
+}
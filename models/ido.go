@@ -52,6 +52,9 @@ type IdoPublishInfo struct {
 	UserID            int              `json:"user_id"`
 	PayMethod         FeePaymentMethod `json:"pay_method"`
 	FeePaidID         int              `json:"fee_paid_id"`
+	FeePayTime        int              `json:"fee_pay_time"`
+	FeeBackID         int              `json:"fee_back_id"`
+	FeeBackTime       int              `json:"fee_back_time"`
 	PaidSuccessTime   int              `json:"paid_success_time"`
 	EncodedAddr       string           `json:"encoded_addr" gorm:"type:varchar(512)"`
 	ScriptKey         string           `json:"script_key" gorm:"type:varchar(255)"`
@@ -60,6 +63,10 @@ type IdoPublishInfo struct {
 	ProofCourierAddr  string           `json:"proof_courier_addr" gorm:"type:varchar(512)"`
 	ParticipateAmount int              `json:"participate_amount"`
 	IsParticipateAll  bool             `json:"is_participate_all"`
+	RefundEncodedAddr string           `json:"refund_encoded_addr" gorm:"type:varchar(512)"`
+	RefundTxHash      string           `json:"refund_tx_hash" gorm:"type:varchar(255)"`
+	RefundLabel       string           `json:"refund_label" gorm:"type:varchar(64)"`
+	RefundSendTime    int              `json:"refund_send_time"`
 	Status            IdoStatus        `json:"status" default:"1" gorm:"default:1"`
 	State             IdoPublishState  `json:"state"`
 	ProcessNumber     int              `json:"process_number"`
@@ -78,6 +85,9 @@ type IdoParticipateInfo struct {
 	UserID           int                 `json:"user_id"`
 	PayMethod        FeePaymentMethod    `json:"pay_method"`
 	FeePaidID        int                 `json:"fee_paid_id"`
+	FeePayTime       int                 `json:"fee_pay_time"`
+	FeeBackID        int                 `json:"fee_back_id"`
+	FeeBackTime      int                 `json:"fee_back_time"`
 	PaidSuccessTime  int                 `json:"paid_success_time"`
 	EncodedAddr      string              `json:"encoded_addr" gorm:"type:varchar(512)"`
 	ScriptKey        string              `json:"script_key" gorm:"type:varchar(255)"`
@@ -86,6 +96,7 @@ type IdoParticipateInfo struct {
 	ProofCourierAddr string              `json:"proof_courier_addr" gorm:"type:varchar(512)"`
 	SendAssetTime    int                 `json:"send_asset_time"`
 	IsAddrSent       bool                `json:"is_addr_sent"`
+	SendLabel        string              `json:"send_label" gorm:"type:varchar(64);index"`
 	OutpointTxHash   string              `json:"outpoint_tx_hash" gorm:"type:varchar(255)"`
 	Outpoint         string              `json:"outpoint" gorm:"type:varchar(255)"`
 	Address          string              `json:"address" gorm:"type:varchar(255)"`
@@ -113,6 +124,11 @@ type ParticipateIdoRequest struct {
 	EncodedAddr      string `json:"encoded_addr" gorm:"type:varchar(512)"`
 }
 
+type SetIdoRefundAddrRequest struct {
+	IdoPublishInfoID int    `json:"ido_publish_info_id"`
+	EncodedAddr      string `json:"encoded_addr"`
+}
+
 type IdoParticipateUserInfo struct {
 	gorm.Model
 	UserID               int       `json:"user_id" gorm:"not null"`
@@ -8,6 +8,7 @@ type LoginRecord struct {
 	RecentIpAddresses string `json:"recent_ip_addresses" gorm:"type:varchar(255);index"`
 	Path              string `json:"path" gorm:"type:varchar(128);index"`
 	LoginTime         int    `json:"login_time" gorm:"type:bigint;index"`
+	SessionId         string `json:"session_id" gorm:"type:varchar(64);index"`
 }
 
 func (LoginRecord) TableName() string {
@@ -37,6 +37,8 @@ type NftPresale struct {
 	ProcessNumber   int              `json:"process_number"`
 	IsReLaunched    bool             `json:"is_re_launched"`
 	IsPushedQueue   bool             `json:"is_pushed_queue"`
+	BoughtPrice     int              `json:"bought_price"`
+	WhitelistTierId uint             `json:"whitelist_tier_id" gorm:"index"`
 }
 
 type (
@@ -72,10 +74,12 @@ type NftPresaleSetRequest struct {
 	Price        int    `json:"price"`
 }
 
+// BuyNftPresaleRequest buys at no more than MaxPrice, the price the client was quoted, zero takes any price.
 type BuyNftPresaleRequest struct {
 	AssetId     string `json:"asset_id"`
 	ReceiveAddr string `json:"receive_addr"`
 	DeviceId    string `json:"device_id"`
+	MaxPrice    int    `json:"max_price"`
 }
 
 type NftPresaleSimplified struct {
@@ -110,6 +114,8 @@ type NftPresaleSimplified struct {
 	State           NftPresaleState  `json:"state" gorm:"index"`
 	ProcessNumber   int              `json:"process_number"`
 	IsReLaunched    bool             `json:"is_re_launched"`
+	BoughtPrice     int              `json:"bought_price"`
+	WhitelistTierId uint             `json:"whitelist_tier_id"`
 	MetaStr         string           `json:"meta_str"`
 	Whitelist       *[]string        `json:"whitelist" `
 }
@@ -7,15 +7,22 @@ import (
 
 type NftPresaleBatchGroup struct {
 	gorm.Model
-	GroupKey     string `json:"group_key" gorm:"type:varchar(255);index"`
-	GroupName    string `json:"group_name" gorm:"type:varchar(255);index"`
-	SoldNumber   int    `json:"sold_number"`
-	Supply       int    `json:"supply"`
-	LowestPrice  int    `json:"lowest_price"`
-	HighestPrice int    `json:"highest_price"`
-	StartTime    int    `json:"start_time"`
-	EndTime      int    `json:"end_time"`
-	Info         string `json:"info"`
+	GroupKey            string                `json:"group_key" gorm:"type:varchar(255);index"`
+	GroupName           string                `json:"group_name" gorm:"type:varchar(255);index"`
+	SoldNumber          int                   `json:"sold_number"`
+	Supply              int                   `json:"supply"`
+	LowestPrice         int                   `json:"lowest_price"`
+	HighestPrice        int                   `json:"highest_price"`
+	StartTime           int                   `json:"start_time"`
+	EndTime             int                   `json:"end_time"`
+	Info                string                `json:"info"`
+	WhitelistMerkleRoot string                `json:"whitelist_merkle_root" gorm:"type:varchar(64)"`
+	PricingMode         NftPresalePricingMode `json:"pricing_mode"`
+	StartPrice          int                   `json:"start_price"`
+	EndPrice            int                   `json:"end_price"`
+	PriceStep           int                   `json:"price_step"`
+	PriceInterval       int                   `json:"price_interval"`
+	GrowthRateBp        int                   `json:"growth_rate_bp"`
 }
 
 type NftPresaleBatchGroupSetRequest struct {
@@ -25,21 +32,35 @@ type NftPresaleBatchGroupSetRequest struct {
 	StartTime int    `json:"start_time"`
 	EndTime   int    `json:"end_time"`
 	Info      string `json:"info"`
+
+	PricingMode   NftPresalePricingMode `json:"pricing_mode"`
+	StartPrice    int                   `json:"start_price"`
+	EndPrice      int                   `json:"end_price"`
+	PriceStep     int                   `json:"price_step"`
+	PriceInterval int                   `json:"price_interval"`
+	GrowthRateBp  int                   `json:"growth_rate_bp"`
 }
 
 type NftPresaleBatchGroupSimplified struct {
-	ID           uint `gorm:"primarykey"`
-	UpdatedAt    time.Time
-	GroupKey     string `json:"group_key" gorm:"type:varchar(255);index"`
-	GroupName    string `json:"group_name" gorm:"type:varchar(255);index"`
-	SoldNumber   int    `json:"sold_number"`
-	Supply       int    `json:"supply"`
-	LowestPrice  int    `json:"lowest_price"`
-	HighestPrice int    `json:"highest_price"`
-	StartTime    int    `json:"start_time"`
-	EndTime      int    `json:"end_time"`
-	Info         string `json:"info"`
-	FirstAssetId string `json:"first_asset_id"`
+	ID                  uint `gorm:"primarykey"`
+	UpdatedAt           time.Time
+	GroupKey            string                `json:"group_key" gorm:"type:varchar(255);index"`
+	GroupName           string                `json:"group_name" gorm:"type:varchar(255);index"`
+	SoldNumber          int                   `json:"sold_number"`
+	Supply              int                   `json:"supply"`
+	LowestPrice         int                   `json:"lowest_price"`
+	HighestPrice        int                   `json:"highest_price"`
+	StartTime           int                   `json:"start_time"`
+	EndTime             int                   `json:"end_time"`
+	Info                string                `json:"info"`
+	FirstAssetId        string                `json:"first_asset_id"`
+	WhitelistMerkleRoot string                `json:"whitelist_merkle_root"`
+	PricingMode         NftPresalePricingMode `json:"pricing_mode"`
+	StartPrice          int                   `json:"start_price"`
+	EndPrice            int                   `json:"end_price"`
+	PriceStep           int                   `json:"price_step"`
+	PriceInterval       int                   `json:"price_interval"`
+	GrowthRateBp        int                   `json:"growth_rate_bp"`
 }
 
 type NftPresaleBatchGroupLaunchRequest struct {
@@ -55,3 +76,30 @@ const (
 	NftPresaleBatchGroupStateNotStart
 	NftPresaleBatchGroupStateEnd
 )
+
+// NftPresalePricingMode is how the presales of a batch group are priced.
+//
+// Fixed sells each presale at its own price. DutchAuction starts at StartPrice and drops by PriceStep every
+// PriceInterval seconds after the start time, down to EndPrice. LinearCurve adds PriceStep for every presale
+// sold, ExponentialCurve raises the price by GrowthRateBp basis points for every presale sold, both start at
+// StartPrice and stop at EndPrice, which ExponentialCurve requires and LinearCurve leaves uncapped when zero.
+type NftPresalePricingMode int
+
+const (
+	NftPresalePricingModeFixed NftPresalePricingMode = iota
+	NftPresalePricingModeDutchAuction
+	NftPresalePricingModeLinearCurve
+	NftPresalePricingModeExponentialCurve
+)
+
+// NftPresaleBatchGroupPriceQuote is the price of the next sale of a batch group and the one after it.
+// NextPriceTime is when a Dutch auction drops to NextPrice, zero when NextPrice applies to the next sale.
+type NftPresaleBatchGroupPriceQuote struct {
+	BatchGroupId  int                   `json:"batch_group_id"`
+	PricingMode   NftPresalePricingMode `json:"pricing_mode"`
+	Sold          int                   `json:"sold"`
+	Supply        int                   `json:"supply"`
+	CurrentPrice  int                   `json:"current_price"`
+	NextPrice     int                   `json:"next_price"`
+	NextPriceTime int                   `json:"next_price_time"`
+}
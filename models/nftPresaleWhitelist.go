@@ -7,10 +7,11 @@ import (
 type NftPresaleWhitelist struct {
 	gorm.Model
 	WhitelistType WhitelistType `json:"whitelist_type" gorm:"index"`
-	AssetId       string        `json:"asset_id" gorm:"type:varchar(255);index"`
-	BatchGroupId  int           `json:"batch_group_id" gorm:"index"`
+	AssetId       string        `json:"asset_id" gorm:"type:varchar(255);index;index:idx_asset_id_username"`
+	BatchGroupId  int           `json:"batch_group_id" gorm:"index;index:idx_batch_group_id_username"`
 	UserId        int           `json:"user_id" gorm:"index"`
-	Username      string        `json:"username" gorm:"type:varchar(255);index"`
+	Username      string        `json:"username" gorm:"type:varchar(255);index;index:idx_asset_id_username;index:idx_batch_group_id_username"`
+	TierId        uint          `json:"tier_id" gorm:"index"`
 }
 
 type WhitelistType int
@@ -26,3 +27,40 @@ type NftPresaleWhitelistSetRequest struct {
 	BatchGroupId  int           `json:"batch_group_id" gorm:"index"`
 	Username      string        `json:"username" gorm:"type:varchar(255);index"`
 }
+
+// NftPresaleWhitelistTier holds the terms of a group of whitelisted users. A zero Price keeps the price of
+// the presale, a zero MaxPurchases does not limit the purchases of a user, and zero times keep the time
+// window of the presale.
+type NftPresaleWhitelistTier struct {
+	gorm.Model
+	WhitelistType WhitelistType `json:"whitelist_type" gorm:"uniqueIndex:idx_whitelist_tier"`
+	AssetId       string        `json:"asset_id" gorm:"type:varchar(255);uniqueIndex:idx_whitelist_tier"`
+	BatchGroupId  int           `json:"batch_group_id" gorm:"uniqueIndex:idx_whitelist_tier"`
+	Name          string        `json:"name" gorm:"type:varchar(255);uniqueIndex:idx_whitelist_tier"`
+	Price         int           `json:"price"`
+	MaxPurchases  int           `json:"max_purchases"`
+	StartTime     int           `json:"start_time"`
+	EndTime       int           `json:"end_time"`
+}
+
+type NftPresaleWhitelistImportResult struct {
+	TierNumber      int    `json:"tier_number"`
+	WhitelistNumber int    `json:"whitelist_number"`
+	MerkleRoot      string `json:"merkle_root"`
+}
+
+// NftPresaleWhitelistMerkleProof lets a user check their whitelist entry against the merkle root of the
+// batch group. Leaf is batch_group_id, username, price, max_purchases, start_time and end_time, each as its 4
+// byte big-endian length followed by the field, numbers in decimal. It is hashed as sha256(0x00‖leaf) and a
+// pair of nodes as sha256(0x01‖pair in sorted order).
+type NftPresaleWhitelistMerkleProof struct {
+	BatchGroupId int      `json:"batch_group_id"`
+	Username     string   `json:"username"`
+	Price        int      `json:"price"`
+	MaxPurchases int      `json:"max_purchases"`
+	StartTime    int      `json:"start_time"`
+	EndTime      int      `json:"end_time"`
+	Leaf         string   `json:"leaf"`
+	Proof        []string `json:"proof"`
+	MerkleRoot   string   `json:"merkle_root"`
+}
@@ -440,6 +440,27 @@ const (
 	GetCountriesEnErr
 
 	CreateContactInfoErr
+
+	ValidatePathErr
+	CalcSwapExactTokensForTokensErr
+	CalcSwapTokensForExactTokensErr
+	FindBestPathErr
+	SwapExactTokensForTokensErr
+	SwapTokensForExactTokensErr
+	QueryCandleSticksCountErr
+	QueryCandleSticksErr
+	InvalidTimeRangeErr
+	CreateLimitOrderErr
+	CancelLimitOrderErr
+	QueryUserLimitOrdersCountErr
+	QueryUserLimitOrdersErr
+	QueryUserLimitOrderFillsErr
+	QueryPoolPairFeeErr
+	QueryPoolTwapErr
+	SetIdoRefundAddrErr
+	ImportNftPresaleWhitelistCsvErr
+	GetNftPresaleWhitelistMerkleProofErr
+	GetNftPresaleBatchGroupPriceQuoteErr
 )
 
 const (
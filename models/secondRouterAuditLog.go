@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+type SecondRouterAuthMethod string
+
+const (
+	SecondRouterAuthHmac SecondRouterAuthMethod = "hmac"
+	SecondRouterAuthMtls SecondRouterAuthMethod = "mtls"
+)
+
+// SecondRouterAuditLog records one mutating call to the second router. Records are only ever inserted,
+// so it has neither UpdatedAt nor a DeletedAt to soft delete it with. The json names are the ones gorm.Model gave.
+type SecondRouterAuditLog struct {
+	ID           uint                   `json:"ID" gorm:"primarykey"`
+	CreatedAt    time.Time              `json:"CreatedAt" gorm:"index"`
+	Caller       string                 `json:"caller" gorm:"type:varchar(255);index"`
+	AuthMethod   SecondRouterAuthMethod `json:"auth_method" gorm:"type:varchar(32)"`
+	Nonce        string                 `json:"nonce" gorm:"type:varchar(128)"`
+	ClientIp     string                 `json:"client_ip" gorm:"type:varchar(255)"`
+	Method       string                 `json:"method" gorm:"type:varchar(16)"`
+	Path         string                 `json:"path" gorm:"type:varchar(255);index"`
+	PayloadHash  string                 `json:"payload_hash" gorm:"type:varchar(64)"`
+	AffectedUser string                 `json:"affected_user" gorm:"type:varchar(1024);index:,length:255"`
+	StatusCode   int                    `json:"status_code"`
+	Result       string                 `json:"result" gorm:"type:text"`
+	DurationMs   int64                  `json:"duration_ms"`
+}
+
+func (SecondRouterAuditLog) TableName() string {
+	return "second_router_audit_log"
+}
+
+type SecondRouterAuditLogQuery struct {
+	Caller       string `json:"caller"`
+	Path         string `json:"path"`
+	AffectedUser string `json:"affectedUser"`
+	Start        int64  `json:"start"`
+	End          int64  `json:"end"`
+	PageNum      int    `json:"pageNum"`
+	PageSize     int    `json:"pageSize"`
+}
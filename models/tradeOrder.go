@@ -2,6 +2,17 @@ package models
 
 import "gorm.io/gorm"
 
+// TradeOrderStatus values of TradeOrder.Status. An order moves forward one state at a time,
+// Failed is reachable from every state before Confirmed.
+const (
+	TradeOrderStatusCreated int16 = iota
+	TradeOrderStatusAccepted
+	TradeOrderStatusSigned
+	TradeOrderStatusBroadcast
+	TradeOrderStatusConfirmed
+	TradeOrderStatusFailed
+)
+
 type TradeOrder struct {
 	gorm.Model
 	OrderID       string  `gorm:"column:order_id" json:"order_id"`
@@ -20,6 +31,12 @@ type TradeOrder struct {
 	PSBTBuyer     string  `gorm:"column:psbt_buyer" json:"psbt_buyer,omitempty"`
 	Type          string  `gorm:"column:Type" json:"type"`
 	Status        int16   `gorm:"column:status;type:smallint" json:"status"`
+	// SellerBtcAddress receives BitcoinAmount sats, BuyerAssetAddress is the taproot asset address receiving the asset.
+	SellerBtcAddress  string `gorm:"column:seller_btc_address;type:varchar(255)" json:"seller_btc_address,omitempty"`
+	BuyerAssetAddress string `gorm:"column:buyer_asset_address;type:text" json:"buyer_asset_address,omitempty"`
+	Txid              string `gorm:"column:txid;type:varchar(64);index" json:"txid,omitempty"`
+	RawTx             string `gorm:"column:raw_tx;type:text" json:"raw_tx,omitempty"`
+	FailReason        string `gorm:"column:fail_reason;type:varchar(255)" json:"fail_reason,omitempty"`
 }
 
 func (TradeOrder) TableName() string {
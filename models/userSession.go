@@ -0,0 +1,39 @@
+package models
+
+import "gorm.io/gorm"
+
+// UserSession is one signed in device of a user. Only the hash of the current refresh token is stored;
+// every refresh replaces it, so presenting an older refresh token means it has leaked.
+type UserSession struct {
+	gorm.Model
+	SessionId        string `gorm:"type:varchar(64);uniqueIndex" json:"session_id"`
+	UserId           uint   `gorm:"column:user_id;type:bigint unsigned;index" json:"user_id"`
+	Username         string `gorm:"type:varchar(255);index" json:"username"`
+	DeviceId         string `gorm:"type:varchar(255);index" json:"device_id"`
+	RefreshTokenHash string `gorm:"type:varchar(64)" json:"-"`
+	Ip               string `gorm:"type:varchar(255)" json:"ip"`
+	ExpiresAt        int64  `gorm:"index" json:"expires_at"`
+	LastUsedAt       int64  `json:"last_used_at"`
+	RevokedAt        int64  `gorm:"index" json:"revoked_at"`
+}
+
+func (UserSession) TableName() string {
+	return "user_session"
+}
+
+type LoginRequest struct {
+	User
+	// EncryptDeviceID and EncodedSalt are the values returned by GetDeviceIdHandler.
+	EncryptDeviceID string `json:"encryptDeviceID"`
+	EncodedSalt     string `json:"encodedSalt"`
+}
+
+type RefreshSessionRequest struct {
+	RefreshToken    string `json:"refreshToken"`
+	EncryptDeviceID string `json:"encryptDeviceID"`
+	EncodedSalt     string `json:"encodedSalt"`
+}
+
+type RevokeSessionRequest struct {
+	SessionId string `json:"sessionId"`
+}
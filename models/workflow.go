@@ -0,0 +1,40 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// WorkflowTask is the run state the workflow engine keeps for one entity of a workflow, like a fair launch
+// or an nft presale. Attempts counts the failed runs of the current state and is reset when the state changes.
+type WorkflowTask struct {
+	gorm.Model
+	Workflow     string    `json:"workflow" gorm:"type:varchar(64);uniqueIndex:idx_workflow_entity"`
+	EntityID     uint      `json:"entity_id" gorm:"uniqueIndex:idx_workflow_entity"`
+	State        int       `json:"state"`
+	Attempts     int       `json:"attempts"`
+	NextRunAt    time.Time `json:"next_run_at" gorm:"index"`
+	LastError    string    `json:"last_error" gorm:"type:text"`
+	IsFailed     bool      `json:"is_failed"`
+	FailedReason string    `json:"failed_reason" gorm:"type:text"`
+}
+
+func (WorkflowTask) TableName() string {
+	return "workflow_task"
+}
+
+// WorkflowEvent records a state change of a workflow entity, with the error of the run when the change is a
+// terminal failure or was not declared.
+type WorkflowEvent struct {
+	gorm.Model
+	Workflow  string `json:"workflow" gorm:"type:varchar(64);index:idx_workflow_event_entity"`
+	EntityID  uint   `json:"entity_id" gorm:"index:idx_workflow_event_entity"`
+	FromState int    `json:"from_state"`
+	ToState   int    `json:"to_state"`
+	Attempt   int    `json:"attempt"`
+	Error     string `json:"error" gorm:"type:text"`
+}
+
+func (WorkflowEvent) TableName() string {
+	return "workflow_event"
+}
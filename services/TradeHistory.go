@@ -1,6 +1,10 @@
 package services
 
 import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 	"trade/middleware"
 	"trade/models"
 )
@@ -24,21 +28,59 @@ func Delete(id uint) error {
 	return middleware.DB.Delete(&models.TradeHistory{}, id).Error
 }
 
-func GetAggregatedTradeData(interval string) ([]models.AggregatedTradeData, error) {
-	var results []models.AggregatedTradeData
+// tradePeriodExprs truncate trade_time to the start of its bucket, weeks start on Monday.
+var tradePeriodExprs = map[string]string{
+	"minute": "CAST(DATE_FORMAT(trade_time, '%Y-%m-%d %H:%i:00') AS DATETIME)",
+	"hour":   "CAST(DATE_FORMAT(trade_time, '%Y-%m-%d %H:00:00') AS DATETIME)",
+	"day":    "CAST(DATE(trade_time) AS DATETIME)",
+	"week":   "CAST(DATE_SUB(DATE(trade_time), INTERVAL WEEKDAY(trade_time) DAY) AS DATETIME)",
+	"month":  "CAST(DATE_FORMAT(trade_time, '%Y-%m-01') AS DATETIME)",
+}
+
+// GetAggregatedTradeData returns open, high, low, close, vwap, volume and trade count of every
+// interval bucket, per trade pair. An empty tradePair aggregates every pair.
+func GetAggregatedTradeData(tradePair string, interval string) ([]models.AggregatedTradeData, error) {
+	period, ok := tradePeriodExprs[interval]
+	if !ok {
+		return nil, errors.New("invalid interval(" + interval + ")")
+	}
+	// Open and close take the first element of an ordered GROUP_CONCAT, which group_concat_max_len cannot truncate.
 	query := `
         SELECT
-            date_trunc(?, trade_time) AS period,
-            AVG(price) AS avg_price,
-            SUM(quantity) AS total_quantity,
+            ` + period + ` AS period,
+            trade_pair,
+            CAST(SUBSTRING_INDEX(GROUP_CONCAT(unit_price ORDER BY trade_time, id), ',', 1) AS DECIMAL(15,2)) AS open,
+            MAX(unit_price) AS high,
+            MIN(unit_price) AS low,
+            CAST(SUBSTRING_INDEX(GROUP_CONCAT(unit_price ORDER BY trade_time DESC, id DESC), ',', 1) AS DECIMAL(15,2)) AS close,
+            IFNULL(SUM(unit_price * quantity) / NULLIF(SUM(quantity), 0), 0) AS vwap,
+            SUM(quantity) AS volume,
+            SUM(amount) AS amount,
             COUNT(*) AS trade_count
         FROM
             trade_history
+        WHERE
+            deleted_at IS NULL AND (? = '' OR trade_pair = ?)
         GROUP BY
-            date_trunc(?, trade_time)
+            period, trade_pair
         ORDER BY
-            period;
+            period, trade_pair;
     `
-	err := middleware.DB.Raw(query, interval, interval).Scan(&results).Error
+	var results []models.AggregatedTradeData
+	err := middleware.DB.Raw(query, tradePair, tradePair).Scan(&results).Error
 	return results, err
 }
+
+// RecordTradeHistory records a completed trade order, recording the same order again does nothing.
+func RecordTradeHistory(tx *gorm.DB, order *models.TradeOrder) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.TradeHistory{
+		OrderID:   order.OrderID,
+		TradePair: order.TradingPair,
+		TradeTime: time.Now(),
+		UnitPrice: order.UnitPrice,
+		Quantity:  order.TapRootAmount,
+		Amount:    order.BitcoinAmount,
+		Buyer:     order.Buyer,
+		Seller:    order.Seller,
+	}).Error
+}
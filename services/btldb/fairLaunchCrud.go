@@ -123,6 +123,7 @@ func ReadNotSentFairLaunchMintedInfos() (*[]models.FairLaunchMintedInfo, error)
 	return &fairLaunchMintedInfos, nil
 }
 
+// Deprecated: see services.GetFairLaunchMintedInfoWhoseProcessNumberIsMoreThanTenThousand.
 func ReadFairLaunchMintedInfoWhoseProcessNumberIsMoreThanTenThousand() (*[]models.FairLaunchMintedInfo, error) {
 	var fairLaunchMintedInfos []models.FairLaunchMintedInfo
 	err := middleware.DB.Where("state BETWEEN ? AND ? AND process_number > ?", models.FairLaunchMintedStateNoPay, models.FairLaunchMintedStateSentPending, 10000).Find(&fairLaunchMintedInfos).Error
@@ -55,3 +55,33 @@ func DeleteNftPresaleWhitelist(id uint) error {
 	var nftPresaleWhitelist models.NftPresaleWhitelist
 	return middleware.DB.Delete(&nftPresaleWhitelist, id).Error
 }
+
+func ReadNftPresaleWhitelistByAssetIdAndUsername(assetId string, username string) (*models.NftPresaleWhitelist, error) {
+	var nftPresaleWhitelist models.NftPresaleWhitelist
+	err := middleware.DB.Where("whitelist_type = ? AND asset_id = ? AND username = ?", models.WhitelistTypeAsset, assetId, username).Last(&nftPresaleWhitelist).Error
+	return &nftPresaleWhitelist, err
+}
+
+func ReadNftPresaleWhitelistByBatchGroupIdAndUsername(batchGroupId int, username string) (*models.NftPresaleWhitelist, error) {
+	var nftPresaleWhitelist models.NftPresaleWhitelist
+	err := middleware.DB.Where("whitelist_type = ? AND batch_group_id = ? AND username = ?", models.WhitelistTypeGroupBatch, batchGroupId, username).Last(&nftPresaleWhitelist).Error
+	return &nftPresaleWhitelist, err
+}
+
+func IsNftPresaleWhitelistOfAssetIdExist(assetId string) (bool, error) {
+	var nftPresaleWhitelists []models.NftPresaleWhitelist
+	err := middleware.DB.Select("id").Where("whitelist_type = ? AND asset_id = ?", models.WhitelistTypeAsset, assetId).Limit(1).Find(&nftPresaleWhitelists).Error
+	return len(nftPresaleWhitelists) > 0, err
+}
+
+func IsNftPresaleWhitelistOfBatchGroupIdExist(batchGroupId int) (bool, error) {
+	var nftPresaleWhitelists []models.NftPresaleWhitelist
+	err := middleware.DB.Select("id").Where("whitelist_type = ? AND batch_group_id = ?", models.WhitelistTypeGroupBatch, batchGroupId).Limit(1).Find(&nftPresaleWhitelists).Error
+	return len(nftPresaleWhitelists) > 0, err
+}
+
+func ReadNftPresaleWhitelistTier(id uint) (*models.NftPresaleWhitelistTier, error) {
+	var nftPresaleWhitelistTier models.NftPresaleWhitelistTier
+	err := middleware.DB.First(&nftPresaleWhitelistTier, id).Error
+	return &nftPresaleWhitelistTier, err
+}
@@ -0,0 +1,35 @@
+package btldb
+
+import (
+	"time"
+	"trade/middleware"
+	"trade/models"
+)
+
+// ReadSecondRouterAuditLogs pages through the audit records matching the query, newest first.
+func ReadSecondRouterAuditLogs(query *models.SecondRouterAuditLogQuery, limit int, offset int) (int64, *[]models.SecondRouterAuditLog, error) {
+	db := middleware.DB.Model(&models.SecondRouterAuditLog{})
+	if query.Caller != "" {
+		db = db.Where("caller = ?", query.Caller)
+	}
+	if query.Path != "" {
+		db = db.Where("path = ?", query.Path)
+	}
+	if query.AffectedUser != "" {
+		db = db.Where("affected_user LIKE ?", "%"+query.AffectedUser+"%")
+	}
+	if query.Start != 0 {
+		db = db.Where("created_at >= ?", time.Unix(query.Start, 0))
+	}
+	if query.End != 0 {
+		db = db.Where("created_at < ?", time.Unix(query.End, 0))
+	}
+	var count int64
+	err := db.Count(&count).Error
+	if err != nil {
+		return 0, nil, err
+	}
+	var records []models.SecondRouterAuditLog
+	err = db.Order("id desc").Limit(limit).Offset(offset).Find(&records).Error
+	return count, &records, err
+}
@@ -11,6 +11,7 @@ import (
 	"trade/config"
 	"trade/middleware"
 	"trade/models"
+	"trade/services/custodyAccount/reconciliation"
 	"trade/services/lntOfficial"
 	"trade/services/pool"
 	"trade/services/psbtTlSwap"
@@ -58,6 +59,34 @@ func CheckIfAutoUpdateScheduledTask() {
 		if err != nil {
 			btlLog.ScheduledTask.Info("%v", err)
 		}
+		err = CreatePoolCandleStickProcessions()
+		if err != nil {
+			btlLog.ScheduledTask.Info("%v", err)
+		}
+		err = CreatePoolLimitOrderProcessions()
+		if err != nil {
+			btlLog.ScheduledTask.Info("%v", err)
+		}
+		err = CreatePushOutboxProcessions()
+		if err != nil {
+			btlLog.ScheduledTask.Info("%v", err)
+		}
+		err = CreateTradeOrderProcessions()
+		if err != nil {
+			btlLog.ScheduledTask.Info("%v", err)
+		}
+		err = CreateReconciliationProcessions()
+		if err != nil {
+			btlLog.ScheduledTask.Info("%v", err)
+		}
+		err = CreateIdempotencyCleanupProcessions()
+		if err != nil {
+			btlLog.ScheduledTask.Info("%v", err)
+		}
+		err = CreateIdoProcessions()
+		if err != nil {
+			btlLog.ScheduledTask.Info("%v", err)
+		}
 	}
 }
 
@@ -430,6 +459,242 @@ func (cs *CronService) GetAndPushSwapTrs() {
 	satBackQueue.GetAndPushSwapTrs()
 }
 
+func CreatePushOutboxProcessions() (err error) {
+	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
+		{
+			Name:           "DispatchPushOutboxEvents",
+			CronExpression: "*/10 * * * * *",
+			FunctionName:   "DispatchPushOutboxEvents",
+			Package:        "services",
+		},
+	})
+}
+
+func (cs *CronService) DispatchPushOutboxEvents() {
+	satBackQueue.DispatchOutboxEvents()
+}
+
+func CreateTradeOrderProcessions() (err error) {
+	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
+		{
+			Name:           "CheckBroadcastTradeOrders",
+			CronExpression: "0 */1 * * * *",
+			FunctionName:   "CheckBroadcastTradeOrders",
+			Package:        "services",
+		},
+	})
+}
+
+func (cs *CronService) CheckBroadcastTradeOrders() {
+	err := RebroadcastSignedTradeOrders()
+	if err != nil {
+		btlLog.ScheduledTask.Error("%v", err)
+	}
+	err = CheckBroadcastTradeOrders()
+	if err != nil {
+		btlLog.ScheduledTask.Error("%v", err)
+	}
+}
+
+func CreateReconciliationProcessions() (err error) {
+	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
+		{
+			Name:           "RunCustodyReconciliation",
+			CronExpression: "0 0 * * * *",
+			FunctionName:   "RunCustodyReconciliation",
+			Package:        "services",
+		},
+	})
+}
+
+func (cs *CronService) RunCustodyReconciliation() {
+	err := reconciliation.RunReconciliation()
+	if err != nil {
+		btlLog.ScheduledTask.Error("%v", err)
+	}
+}
+
+func CreateIdempotencyCleanupProcessions() (err error) {
+	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
+		{
+			Name:           "CleanExpiredIdempotencyRecords",
+			CronExpression: "0 30 * * * *",
+			FunctionName:   "CleanExpiredIdempotencyRecords",
+			Package:        "services",
+		},
+	})
+}
+
+func (cs *CronService) CleanExpiredIdempotencyRecords() {
+	err := middleware.CleanExpiredIdempotencyRecords()
+	if err != nil {
+		btlLog.ScheduledTask.Error("%v", err)
+	}
+}
+
+func CreateIdoProcessions() (err error) {
+	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
+		{
+			Name:           "ProcessIdoPublishNoPay",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoPublishNoPay",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoPublishPaidPending",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoPublishPaidPending",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoPublishPaidNoPublish",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoPublishPaidNoPublish",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoPublishPublishedPending",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoPublishPublishedPending",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoPublishSettle",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoPublishSettle",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoPublishRefundedPending",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoPublishRefundedPending",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoParticipateNoPay",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoParticipateNoPay",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoParticipatePaidPending",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoParticipatePaidPending",
+			Package:        "services",
+		}, {
+			Name:           "SendIdoParticipateAsset",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "SendIdoParticipateAsset",
+			Package:        "services",
+		}, {
+			Name:           "ProcessIdoParticipateSentPending",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ProcessIdoParticipateSentPending",
+			Package:        "services",
+		},
+	})
+}
+
+func (cs *CronService) ProcessIdoPublishNoPay() {
+	tx := middleware.DB.Begin()
+	ProcessIdoPublishNoPay(tx)
+	err := TaskCountRecordByRedis("ProcessIdoPublishNoPay")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) ProcessIdoPublishPaidPending() {
+	tx := middleware.DB.Begin()
+	ProcessIdoPublishPaidPending(tx)
+	err := TaskCountRecordByRedis("ProcessIdoPublishPaidPending")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) ProcessIdoPublishPaidNoPublish() {
+	tx := middleware.DB.Begin()
+	ProcessIdoPublishPaidNoPublish(tx)
+	err := TaskCountRecordByRedis("ProcessIdoPublishPaidNoPublish")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) ProcessIdoPublishPublishedPending() {
+	tx := middleware.DB.Begin()
+	ProcessIdoPublishPublishedPending(tx)
+	err := TaskCountRecordByRedis("ProcessIdoPublishPublishedPending")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) ProcessIdoPublishSettle() {
+	tx := middleware.DB.Begin()
+	ProcessIdoPublishSettle(tx)
+	err := TaskCountRecordByRedis("ProcessIdoPublishSettle")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) ProcessIdoPublishRefundedPending() {
+	tx := middleware.DB.Begin()
+	ProcessIdoPublishRefundedPending(tx)
+	err := TaskCountRecordByRedis("ProcessIdoPublishRefundedPending")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) ProcessIdoParticipateNoPay() {
+	tx := middleware.DB.Begin()
+	ProcessIdoParticipateNoPay(tx)
+	err := TaskCountRecordByRedis("ProcessIdoParticipateNoPay")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) ProcessIdoParticipatePaidPending() {
+	tx := middleware.DB.Begin()
+	ProcessIdoParticipatePaidPending(tx)
+	err := TaskCountRecordByRedis("ProcessIdoParticipatePaidPending")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
+func (cs *CronService) SendIdoParticipateAsset() {
+	SendIdoParticipateAsset()
+	err := TaskCountRecordByRedis("SendIdoParticipateAsset")
+	if err != nil {
+		return
+	}
+}
+
+func (cs *CronService) ProcessIdoParticipateSentPending() {
+	tx := middleware.DB.Begin()
+	ProcessIdoParticipateSentPending(tx)
+	err := TaskCountRecordByRedis("ProcessIdoParticipateSentPending")
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	tx.Commit()
+}
+
 func (cs *CronService) GetAndPushGenLiquidity() {
 	satBackQueue.GetAndPushGenLiquidity()
 }
@@ -453,6 +718,57 @@ func (cs *CronService) UpdatePoolPairTokenAccountBalance() {
 	}
 }
 
+func CreatePoolCandleStickProcessions() (err error) {
+	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
+		{
+			Name:           "UpdatePoolCandleSticks",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "UpdatePoolCandleSticks",
+			Package:        "services",
+		},
+	})
+}
+
+func (cs *CronService) UpdatePoolCandleSticks() {
+	err := pool.UpdateAllPoolCandleSticks()
+	if err != nil {
+		btlLog.PoolCandleStick.Error("%v", err)
+		return
+	}
+}
+
+func CreatePoolLimitOrderProcessions() (err error) {
+	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
+		{
+			Name:           "MatchPoolLimitOrders",
+			CronExpression: "*/10 * * * * *",
+			FunctionName:   "MatchPoolLimitOrders",
+			Package:        "services",
+		}, {
+			Name:           "ExpirePoolLimitOrders",
+			CronExpression: "*/30 * * * * *",
+			FunctionName:   "ExpirePoolLimitOrders",
+			Package:        "services",
+		},
+	})
+}
+
+func (cs *CronService) MatchPoolLimitOrders() {
+	err := pool.MatchPoolLimitOrders()
+	if err != nil {
+		btlLog.PoolLimitOrder.Error("%v", err)
+		return
+	}
+}
+
+func (cs *CronService) ExpirePoolLimitOrders() {
+	err := pool.ExpirePoolLimitOrders()
+	if err != nil {
+		btlLog.PoolLimitOrder.Error("%v", err)
+		return
+	}
+}
+
 func CreatePsbtTlSwapProcessPendingTx() (err error) {
 	return CreateOrUpdateScheduledTasks(&[]models.ScheduledTask{
 		{
@@ -10,6 +10,7 @@ import (
 	"trade/models"
 	cModels "trade/models/custodyModels"
 	"trade/services/btldb"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 )
 
 const interval = 20 * time.Second
@@ -31,22 +32,41 @@ type UserInfo struct {
 	RpcMux        sync.Mutex
 	LastActiveMux sync.Mutex
 	LastActive    time.Time
+	payLock       custodyMutex.Lock
 }
 
+// PayLock takes the user's payment lock. PaymentMux serializes the payments of this process and the
+// custody lock those of every instance.
 func (u *UserInfo) PayLock() bool {
 	currentTime := time.Now()
 	if currentTime.Sub(u.LastPayTime) < interval {
 		return false
 	}
 	u.PaymentMux.Lock()
+	lock, err := custodyMutex.Obtain(fmt.Sprintf("custody_pay_%d", u.User.ID))
+	if err != nil {
+		btlLog.CUST.Error("obtain pay lock of %s error:%v", u.User.Username, err)
+		u.PaymentMux.Unlock()
+		return false
+	}
+	u.payLock = lock
 	return true
 }
 
 func (u *UserInfo) PayUnlock() {
 	u.LastPayTime = time.Now()
+	if u.payLock != nil {
+		u.payLock.Unlock()
+		u.payLock = nil
+	}
 	u.PaymentMux.Unlock()
 }
 
+// HeldPayLock returns the payment lock while PayLock holds it, for payments to Fence their writes.
+func (u *UserInfo) HeldPayLock() custodyMutex.Lock {
+	return u.payLock
+}
+
 type UserPool struct {
 	users            map[string]*UserInfo
 	mutex            sync.RWMutex
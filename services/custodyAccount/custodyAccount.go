@@ -20,7 +20,7 @@ func GetAssetBalanceList(userName string) (*[]cBase.Balance, error) {
 	}
 	list["00"] = &cBase.Balance{
 		AssetId: "00",
-		Amount:  int64(unlockedBalance + lockedBalance),
+		Amount:  unlockedBalance.Add(lockedBalance).IntPart(),
 	}
 
 	temp, err := custodyBalance.GetAssetsBalances(middleware.DB, e.UserInfo.Account.ID)
@@ -31,11 +31,11 @@ func GetAssetBalanceList(userName string) (*[]cBase.Balance, error) {
 		for _, v := range *temp {
 			_, exists := list[v.AssetId]
 			if exists {
-				list[v.AssetId].Amount += int64(v.Amount)
+				list[v.AssetId].Amount += v.Amount.IntPart()
 			} else {
 				list[v.AssetId] = &cBase.Balance{
 					AssetId: v.AssetId,
-					Amount:  int64(v.Amount),
+					Amount:  v.Amount.IntPart(),
 				}
 			}
 		}
@@ -49,11 +49,11 @@ func GetAssetBalanceList(userName string) (*[]cBase.Balance, error) {
 		for _, v := range *getBalances {
 			_, exists := list[v.AssetId]
 			if exists {
-				list[v.AssetId].Amount += int64(v.Amount)
+				list[v.AssetId].Amount += v.Amount.IntPart()
 			} else {
 				list[v.AssetId] = &cBase.Balance{
 					AssetId: v.AssetId,
-					Amount:  int64(v.Amount),
+					Amount:  v.Amount.IntPart(),
 				}
 			}
 		}
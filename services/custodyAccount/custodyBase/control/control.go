@@ -5,64 +5,132 @@ import (
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 	"strings"
+	"sync/atomic"
 	"time"
 	"trade/btlLog"
 	"trade/middleware"
 	"trade/models/custodyModels"
 )
 
-var controlMap = make(map[string]bool)
+// controlState is an immutable snapshot of the controls, swapped as a whole on every reload.
+type controlState struct {
+	statuses map[string]bool
+	windows  map[string][]custodyModels.ControlWindow
+}
+
+var state atomic.Pointer[controlState]
+
+func init() {
+	state.Store(&controlState{
+		statuses: make(map[string]bool),
+		windows:  make(map[string][]custodyModels.ControlWindow),
+	})
+}
 
+// GetTransferControl reports whether the transfer type is enabled for assetId right now. Controls never
+// set are enabled, a control inside one of its windows is disabled.
 func GetTransferControl(assetId string, transferType TransferControl) bool {
 	t := transferControlString{
 		AssetId: assetId,
 		Type:    transferType,
 	}
 	str := t.toString()
-	if value, exists := controlMap[str]; exists {
-		return value
-	} else {
-		return true
+	current := state.Load()
+	if value, exists := current.statuses[str]; exists && !value {
+		return false
+	}
+	now := time.Now()
+	minute := now.Hour()*60 + now.Minute()
+	for _, window := range current.windows[str] {
+		if inWindow(window, minute) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetAssetTransferControl reports whether the transfer type is enabled both for all assets and for assetId.
+func GetAssetTransferControl(assetId string, transferType TransferControl) bool {
+	return GetTransferControl("asset", transferType) && GetTransferControl(assetId, transferType)
+}
+
+func inWindow(window custodyModels.ControlWindow, minute int) bool {
+	if window.StartMinute <= window.EndMinute {
+		return minute >= window.StartMinute && minute < window.EndMinute
 	}
+	return minute >= window.StartMinute || minute < window.EndMinute
 }
 
-func SetTransferControl(assetId string, transferType TransferControl, control bool) error {
+func SetTransferControl(assetId string, transferType TransferControl, control bool, operator string, reason string) error {
 	t := transferControlString{
 		AssetId: assetId,
 		Type:    transferType,
 	}
 	str := t.toString()
 
-	ctrl := custodyModels.Control{
-		ControlName: str,
-	}
-	err := middleware.DB.First(&ctrl).Error
+	tx, back := middleware.GetTx()
+	defer back()
+	ctrl := custodyModels.Control{}
+	err := tx.Where("control_name = ?", str).First(&ctrl).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		btlLog.CLMT.Error("set control failed:%v", err)
 		return err
 	}
-	if ctrl.Status != control || ctrl.Status == false {
-		ctrl.Status = control
-		err = middleware.DB.Save(&ctrl).Error
-		if err != nil {
-			btlLog.CLMT.Error("set control failed:%v", err)
-			return err
-		}
+	exists := err == nil
+	oldStatus := !exists || ctrl.Status
+	ctrl.ControlName = str
+	ctrl.Status = control
+	ctrl.UpdatedBy = operator
+	ctrl.Reason = reason
+	err = tx.Save(&ctrl).Error
+	if err != nil {
+		btlLog.CLMT.Error("set control failed:%v", err)
+		return err
+	}
+	err = tx.Create(&custodyModels.ControlHistory{
+		ControlName: str,
+		Action:      custodyModels.ControlActionSet,
+		OldStatus:   oldStatus,
+		NewStatus:   control,
+		Operator:    operator,
+		Reason:      reason,
+	}).Error
+	if err != nil {
+		btlLog.CLMT.Error("set control failed:%v", err)
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
 	}
-	loadingControlMap()
+	reloadAndPublish()
 	return nil
 }
 
-func loadingControlMap() {
+func loadingControlMap() error {
 	var controls []custodyModels.Control
 	err := middleware.DB.Find(&controls).Error
 	if err != nil {
 		btlLog.CLMT.Error("loading control map failed:%v", err)
-		return
+		return err
+	}
+	var windows []custodyModels.ControlWindow
+	err = middleware.DB.Find(&windows).Error
+	if err != nil {
+		btlLog.CLMT.Error("loading control windows failed:%v", err)
+		return err
+	}
+	next := controlState{
+		statuses: make(map[string]bool, len(controls)),
+		windows:  make(map[string][]custodyModels.ControlWindow),
 	}
 	for _, control := range controls {
-		controlMap[control.ControlName] = control.Status
+		next.statuses[control.ControlName] = control.Status
 	}
+	for _, window := range windows {
+		next.windows[window.ControlName] = append(next.windows[window.ControlName], window)
+	}
+	state.Store(&next)
+	return nil
 }
 
 type transferControlString struct {
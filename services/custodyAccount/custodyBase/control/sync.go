@@ -0,0 +1,52 @@
+package control
+
+import (
+	"context"
+	"os"
+	"time"
+	"trade/btlLog"
+	"trade/middleware"
+)
+
+const (
+	controlChannel = "custody_transfer_control"
+	// controlReloadInterval bounds how stale the controls get when a pub/sub message is lost.
+	controlReloadInterval = time.Minute
+)
+
+// StartControlSync loads the controls and keeps them in sync with every other instance. Changes are
+// announced on a Redis channel, and the controls are also reloaded every controlReloadInterval.
+func StartControlSync(ctx context.Context) {
+	_ = loadingControlMap()
+	pubsub := middleware.Client.Subscribe(ctx, controlChannel)
+	go func() {
+		defer pubsub.Close()
+		ticker := time.NewTicker(controlReloadInterval)
+		defer ticker.Stop()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				btlLog.CLMT.Info("control changed on %v, reloading", msg.Payload)
+				_ = loadingControlMap()
+			case <-ticker.C:
+				_ = loadingControlMap()
+			}
+		}
+	}()
+}
+
+// reloadAndPublish reloads this instance's controls and tells the other instances to reload theirs.
+func reloadAndPublish() {
+	_ = loadingControlMap()
+	host, _ := os.Hostname()
+	err := middleware.Client.Publish(context.Background(), controlChannel, host).Err()
+	if err != nil {
+		btlLog.CLMT.Error("publish control change failed:%v", err)
+	}
+}
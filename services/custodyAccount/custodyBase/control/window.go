@@ -0,0 +1,124 @@
+package control
+
+import (
+	"fmt"
+	"time"
+	"trade/middleware"
+	"trade/models/custodyModels"
+)
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// AddControlWindow disables the transfer type for assetId every day from start to end, both "HH:MM" local time.
+func AddControlWindow(assetId string, transferType TransferControl, start string, end string, operator string, reason string) (*custodyModels.ControlWindow, error) {
+	startMinute, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	endMinute, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+	if startMinute == endMinute {
+		return nil, fmt.Errorf("window start and end are both %s", start)
+	}
+	t := transferControlString{
+		AssetId: assetId,
+		Type:    transferType,
+	}
+	window := custodyModels.ControlWindow{
+		ControlName: t.toString(),
+		StartMinute: startMinute,
+		EndMinute:   endMinute,
+		CreatedBy:   operator,
+		Reason:      reason,
+	}
+
+	tx, back := middleware.GetTx()
+	defer back()
+	if err = tx.Create(&window).Error; err != nil {
+		return nil, err
+	}
+	err = tx.Create(&custodyModels.ControlHistory{
+		ControlName: window.ControlName,
+		Action:      custodyModels.ControlActionAddWindow,
+		WindowId:    window.ID,
+		Operator:    operator,
+		Reason:      fmt.Sprintf("%s-%s %s", start, end, reason),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	reloadAndPublish()
+	return &window, nil
+}
+
+func DeleteControlWindow(id uint, operator string, reason string) error {
+	tx, back := middleware.GetTx()
+	defer back()
+	var window custodyModels.ControlWindow
+	if err := tx.First(&window, id).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&window).Error; err != nil {
+		return err
+	}
+	err := tx.Create(&custodyModels.ControlHistory{
+		ControlName: window.ControlName,
+		Action:      custodyModels.ControlActionDeleteWindow,
+		WindowId:    window.ID,
+		Operator:    operator,
+		Reason:      reason,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	reloadAndPublish()
+	return nil
+}
+
+func ListControlWindows() ([]custodyModels.ControlWindow, error) {
+	var windows []custodyModels.ControlWindow
+	err := middleware.DB.Order("control_name, start_minute").Find(&windows).Error
+	return windows, err
+}
+
+// ListControlHistory returns the changes of controlName, or of every control when it is empty, newest first.
+func ListControlHistory(controlName string, page, pageSize int) ([]custodyModels.ControlHistory, int64, error) {
+	db := middleware.DB.Model(&custodyModels.ControlHistory{})
+	if controlName != "" {
+		db = db.Where("control_name = ?", controlName)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var history []custodyModels.ControlHistory
+	err := db.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&history).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return history, total, nil
+}
+
+// ControlName is the key of the control of transferType for assetId, as stored in history and windows.
+func ControlName(assetId string, transferType TransferControl) string {
+	t := transferControlString{
+		AssetId: assetId,
+		Type:    transferType,
+	}
+	return t.toString()
+}
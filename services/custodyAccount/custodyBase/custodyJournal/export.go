@@ -0,0 +1,66 @@
+package custodyJournal
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+	"trade/middleware"
+	"trade/models/custodyModels"
+)
+
+const exportBatchSize = 1000
+
+// ExportJournal writes the journal lines posted in [start, end) as csv, one row per line with its entry.
+func ExportJournal(w io.Writer, start, end time.Time) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"entry_id", "created_at", "operation", "reference", "account", "asset_id", "debit", "credit"})
+	if err != nil {
+		return err
+	}
+	var lastId uint
+	for {
+		var rows []struct {
+			custodyModels.JournalLine
+			Operation string
+			Reference string
+		}
+		err = middleware.DB.Table("custody_journal_line AS l").
+			Select("l.*, e.operation, e.reference").
+			Joins("JOIN custody_journal_entry AS e ON e.id = l.entry_id").
+			Where("l.created_at >= ? AND l.created_at < ? AND l.id > ?", start, end, lastId).
+			Order("l.id").
+			Limit(exportBatchSize).
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			debit, credit := "", ""
+			if row.Amount.IsPositive() {
+				debit = row.Amount.StringFixed(custodyModels.AmountScale)
+			} else {
+				credit = row.Amount.Neg().StringFixed(custodyModels.AmountScale)
+			}
+			err = writer.Write([]string{
+				strconv.Itoa(int(row.EntryId)),
+				row.CreatedAt.Format(time.DateTime),
+				row.Operation,
+				row.Reference,
+				row.Account,
+				row.AssetId,
+				debit,
+				credit,
+			})
+			if err != nil {
+				return err
+			}
+			lastId = row.ID
+		}
+		if len(rows) < exportBatchSize {
+			break
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
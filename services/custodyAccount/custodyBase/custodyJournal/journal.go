@@ -0,0 +1,103 @@
+package custodyJournal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"trade/models/custodyModels"
+)
+
+var ErrUnbalanced = errors.New("journal entry is not balanced")
+
+// Account names a journal account. The accounts of users, locks and pools hold what custody owes, their
+// balance is the negated sum of their lines. The custody accounts are the other side of money entering or
+// leaving custody.
+type Account string
+
+const (
+	// ExternalAccount is what the nodes hold for custody. Money paid out of custody is credited to it,
+	// so its lines sum to the total custody owes.
+	ExternalAccount Account = "custody:external"
+	// FeeAccount collects the service fees.
+	FeeAccount Account = "custody:fee"
+	// TransitAccount holds transfers whose payer and receiver are booked in separate transactions.
+	TransitAccount Account = "custody:transit"
+)
+
+const btcAssetId = "00"
+
+const (
+	userAccountPrefix = "user:"
+	lockAccountPrefix = "lock:"
+	poolAccountPrefix = "pool:"
+)
+
+func UserAccount(accountId uint) Account {
+	return Account(fmt.Sprintf("%s%d", userAccountPrefix, accountId))
+}
+
+func LockAccount(lockAccountId uint) Account {
+	return Account(fmt.Sprintf("%s%d", lockAccountPrefix, lockAccountId))
+}
+
+func PoolAccount(poolAccountId uint) Account {
+	return Account(fmt.Sprintf("%s%d", poolAccountPrefix, poolAccountId))
+}
+
+// Reference builds the reference of an entry from the kind and id of the record it posts, like "lock:abc".
+func Reference(kind string, id any) string {
+	return fmt.Sprintf("%s:%v", kind, id)
+}
+
+// Line debits Account with a positive Amount and credits it with a negative one.
+type Line struct {
+	Account Account
+	AssetId string
+	Amount  decimal.Decimal
+}
+
+// Post writes an entry of balanced lines in tx, so the journal commits with the balance changes it records.
+// Line amounts are rounded to the whole base units of the ledgers before they are balanced.
+func Post(tx *gorm.DB, operation custodyModels.JournalOperation, reference string, lines ...Line) error {
+	sums := make(map[string]decimal.Decimal)
+	entry := custodyModels.JournalEntry{
+		Operation: operation,
+		Reference: reference,
+	}
+	for _, line := range lines {
+		amount := line.Amount.Round(custodyModels.AmountScale)
+		sums[line.AssetId] = sums[line.AssetId].Add(amount)
+		if amount.IsZero() {
+			continue
+		}
+		entry.Lines = append(entry.Lines, custodyModels.JournalLine{
+			Account: string(line.Account),
+			AssetId: line.AssetId,
+			Amount:  custodyModels.NewAmount(amount),
+		})
+	}
+	for assetId, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s %s off by %s", ErrUnbalanced, operation, assetId, sum)
+		}
+	}
+	if len(entry.Lines) == 0 {
+		return nil
+	}
+	return tx.Create(&entry).Error
+}
+
+// Transfer posts amount of the asset moving from one account to another.
+func Transfer(tx *gorm.DB, operation custodyModels.JournalOperation, reference string, assetId string, from, to Account, amount float64) error {
+	value := custodyModels.AmountFromFloat64(amount)
+	return Post(tx, operation, reference,
+		Line{Account: from, AssetId: assetId, Amount: value},
+		Line{Account: to, AssetId: assetId, Amount: value.Neg()},
+	)
+}
+
+// PayFee posts a service fee, which custody always charges in btc.
+func PayFee(tx *gorm.DB, reference string, accountId uint, fee float64) error {
+	return Transfer(tx, custodyModels.JournalOperationFee, reference, btcAssetId, UserAccount(accountId), FeeAccount, fee)
+}
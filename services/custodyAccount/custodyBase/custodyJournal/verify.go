@@ -0,0 +1,202 @@
+package custodyJournal
+
+import (
+	"fmt"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"sort"
+	"trade/middleware"
+	"trade/models/custodyModels"
+)
+
+type accountAsset struct {
+	Account Account
+	AssetId string
+}
+
+type balanceRow struct {
+	Id      uint
+	AssetId string
+	Amount  decimal.Decimal
+}
+
+// accountBalances reads what the balance tables say custody owes each user, lock and pool account.
+func accountBalances(db *gorm.DB) (map[accountAsset]decimal.Decimal, error) {
+	balances := make(map[accountAsset]decimal.Decimal)
+	queries := []struct {
+		sql     string
+		account func(uint) Account
+	}{
+		{"select account_id as id, asset_id, amount from user_account_balance where deleted_at is null", UserAccount},
+		{"select account_id as id, '00' as asset_id, amount from user_account_balance_btc where deleted_at is null", UserAccount},
+		{"select account_id as id, asset_id, amount from user_lock_balance where deleted_at is null", LockAccount},
+		{"select pool_account_id as id, asset_id, balance as amount from custody_pool_account_balances", PoolAccount},
+	}
+	for _, q := range queries {
+		var rows []balanceRow
+		if err := db.Raw(q.sql).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			key := accountAsset{Account: q.account(row.Id), AssetId: row.AssetId}
+			balances[key] = balances[key].Add(row.Amount)
+		}
+	}
+	return balances, nil
+}
+
+// journalBalances sums the journal lines of the user, lock and pool accounts into their balances.
+func journalBalances(db *gorm.DB) (map[accountAsset]decimal.Decimal, error) {
+	var rows []struct {
+		Account string
+		AssetId string
+		Amount  decimal.Decimal
+	}
+	err := db.Model(&custodyModels.JournalLine{}).
+		Select("account, asset_id, -SUM(amount) AS amount").
+		Where("account LIKE ? OR account LIKE ? OR account LIKE ?", userAccountPrefix+"%", lockAccountPrefix+"%", poolAccountPrefix+"%").
+		Group("account, asset_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[accountAsset]decimal.Decimal)
+	for _, row := range rows {
+		balances[accountAsset{Account: Account(row.Account), AssetId: row.AssetId}] = row.Amount
+	}
+	return balances, nil
+}
+
+// AccountMismatch is an account whose balance differs from its journal.
+type AccountMismatch struct {
+	Account string               `json:"account"`
+	AssetId string               `json:"assetId"`
+	Balance custodyModels.Amount `json:"balance"`
+	Journal custodyModels.Amount `json:"journal"`
+}
+
+func mismatches(balances, journal map[accountAsset]decimal.Decimal) []AccountMismatch {
+	keys := make(map[accountAsset]struct{})
+	for key := range balances {
+		keys[key] = struct{}{}
+	}
+	for key := range journal {
+		keys[key] = struct{}{}
+	}
+	var result []AccountMismatch
+	for key := range keys {
+		if balances[key].Equal(journal[key]) {
+			continue
+		}
+		result = append(result, AccountMismatch{
+			Account: string(key.Account),
+			AssetId: key.AssetId,
+			Balance: custodyModels.NewAmount(balances[key]),
+			Journal: custodyModels.NewAmount(journal[key]),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Account != result[j].Account {
+			return result[i].Account < result[j].Account
+		}
+		return result[i].AssetId < result[j].AssetId
+	})
+	return result
+}
+
+// EntryImbalance is an entry, or with EntryId 0 the whole journal, whose lines do not sum to zero in an asset.
+type EntryImbalance struct {
+	EntryId uint                 `json:"entryId"`
+	AssetId string               `json:"assetId"`
+	Sum     custodyModels.Amount `json:"sum"`
+}
+
+type VerifyReport struct {
+	Balanced   bool              `json:"balanced"`
+	Imbalances []EntryImbalance  `json:"imbalances"`
+	Mismatches []AccountMismatch `json:"mismatches"`
+}
+
+// Verify proves that every entry and the whole journal sum to zero in each asset, and that the balance of
+// every user, lock and pool account equals its journal. Run it while custody is quiet, a transfer committing
+// between the reads shows up as a mismatch.
+func Verify() (*VerifyReport, error) {
+	db := middleware.DB
+	report := VerifyReport{}
+	err := db.Model(&custodyModels.JournalLine{}).
+		Select("0 AS entry_id, asset_id, SUM(amount) AS sum").
+		Group("asset_id").
+		Having("SUM(amount) <> 0").
+		Scan(&report.Imbalances).Error
+	if err != nil {
+		return nil, err
+	}
+	var entries []EntryImbalance
+	err = db.Model(&custodyModels.JournalLine{}).
+		Select("entry_id, asset_id, SUM(amount) AS sum").
+		Group("entry_id, asset_id").
+		Having("SUM(amount) <> 0").
+		Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	report.Imbalances = append(report.Imbalances, entries...)
+
+	balances, err := accountBalances(db)
+	if err != nil {
+		return nil, err
+	}
+	journal, err := journalBalances(db)
+	if err != nil {
+		return nil, err
+	}
+	report.Mismatches = mismatches(balances, journal)
+	report.Balanced = len(report.Imbalances) == 0 && len(report.Mismatches) == 0
+	return &report, nil
+}
+
+// OpenJournal posts the difference between the balance tables and the journal of every account as an opening
+// entry against ExternalAccount, so balances from before the journal existed are accounted for. It does
+// nothing once the journal has been opened.
+func OpenJournal() error {
+	tx, back := middleware.GetTx()
+	defer back()
+	var count int64
+	err := tx.Model(&custodyModels.JournalEntry{}).Where("operation = ?", custodyModels.JournalOperationOpening).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	balances, err := accountBalances(tx)
+	if err != nil {
+		return err
+	}
+	journal, err := journalBalances(tx)
+	if err != nil {
+		return err
+	}
+	var lines []Line
+	external := make(map[string]decimal.Decimal)
+	for _, m := range mismatches(balances, journal) {
+		diff := m.Balance.Sub(m.Journal.Decimal)
+		lines = append(lines, Line{Account: Account(m.Account), AssetId: m.AssetId, Amount: diff.Neg()})
+		external[m.AssetId] = external[m.AssetId].Add(diff)
+	}
+	for assetId, amount := range external {
+		lines = append(lines, Line{Account: ExternalAccount, AssetId: assetId, Amount: amount})
+	}
+	// An empty custody still gets its opening entry, so it is not opened again later.
+	entry := custodyModels.JournalEntry{Operation: custodyModels.JournalOperationOpening, Reference: "opening"}
+	if len(lines) == 0 {
+		if err = tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		return tx.Commit().Error
+	}
+	if err = Post(tx, entry.Operation, entry.Reference, lines...); err != nil {
+		return fmt.Errorf("post opening entry: %w", err)
+	}
+	return tx.Commit().Error
+}
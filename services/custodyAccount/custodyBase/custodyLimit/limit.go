@@ -4,10 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
-	"sync"
 	"time"
 	"trade/models/custodyModels"
 	caccount "trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 )
 
 const (
@@ -17,7 +17,11 @@ const (
 var (
 	ErrLimitEntirely = errors.New("ErrLimitEntirely")
 )
-var limitMux = new(sync.Mutex)
+
+// limitLockKey is the custody lock serializing the limit bills of a user.
+func limitLockKey(userId uint) string {
+	return fmt.Sprintf("custody_limit_%d", userId)
+}
 
 func GetLimit(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.LimitType) (*custodyModels.LimitBill, error) {
 	err := db.Where(limitType).First(limitType).Error
@@ -29,8 +33,11 @@ func GetLimit(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.Lim
 
 		return nil, err
 	}
-	limitMux.Lock()
-	defer limitMux.Unlock()
+	lock, err := custodyMutex.Obtain(limitLockKey(user.User.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
 
 	limitBill := custodyModels.LimitBill{
 		UserId:    user.User.ID,
@@ -97,25 +104,12 @@ func GetLimit(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.Lim
 }
 
 func CheckLimit(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.LimitType, amount float64) error {
-	limitBill, err := GetLimit(db, user, limitType)
+	decision, err := EvaluateLimit(db, user, limitType, amount)
 	if err != nil {
 		return err
 	}
-
-	if limitBill == nil {
-
-		return nil
-	}
-
-	if limitBill.UseAbleAmount < amount {
-		return fmt.Errorf("%w,剩余额度：%v", errors.New("今日可用交易额度不足"), limitBill.UseAbleAmount)
-	}
-	if limitBill.UseAbleCount <= 0 {
-		return fmt.Errorf("%w,剩余交易次数：%v", errors.New("今日可用交易次数不足"), limitBill.UseAbleCount)
-	}
-	sutime := time.Now().Sub(limitBill.LocalTime).Seconds()
-	if sutime < 5 {
-		return errors.New("交易频繁，请稍后再试")
+	if decision.Review != nil {
+		return decision.Review
 	}
 	return nil
 }
@@ -132,8 +126,16 @@ func MinusLimit(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.L
 		return err
 	}
 
-	limitMux.Lock()
-	defer limitMux.Unlock()
+	lock, err := custodyMutex.Obtain(limitLockKey(user.User.ID))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	err = recordLimitUsage(db, user, limitType, amount)
+	if err != nil {
+		return err
+	}
 
 	limitBill := custodyModels.LimitBill{
 		UserId:    user.User.ID,
@@ -172,6 +174,41 @@ func MinusLimit(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.L
 	return nil
 }
 
+// MinusApprovedLimit bills a withdrawal an admin approved over the limits. It counts the transfer like MinusLimit,
+// but the approval overrides the day's bill, which may go below zero.
+func MinusApprovedLimit(db *gorm.DB, userId uint, limitTypeId uint, assetId string, amount float64, amountSat float64) error {
+	if limitTypeId == 0 {
+		return nil
+	}
+	lock, err := custodyMutex.Obtain(limitLockKey(userId))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	err = RecordLimitUsage(db, userId, limitTypeId, assetId, amount, amountSat)
+	if err != nil {
+		return err
+	}
+	limitBill := custodyModels.LimitBill{
+		UserId:    userId,
+		LimitType: limitTypeId,
+	}
+	err = db.Where("created_at >= CURDATE() AND created_at < CURDATE() + INTERVAL 1 DAY").Where(limitBill).First(&limitBill).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	limitBill.UseAbleAmount -= amount
+	if limitBill.UseAbleCount > 0 {
+		limitBill.UseAbleCount -= 1
+	}
+	limitBill.LocalTime = time.Now()
+	return db.Save(&limitBill).Error
+}
+
 func AddLimit(limitType int, userId int, limit int) {
 
 }
@@ -9,6 +9,7 @@ import (
 	"trade/middleware"
 	"trade/models"
 	"trade/models/custodyModels"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 )
 
 var limitSync = sync.Mutex{}
@@ -72,9 +73,6 @@ func SetUserLimitLevel(userName, limitType string, level int) error {
 	limitSync.Lock()
 	defer limitSync.Unlock()
 
-	limitMux.Lock()
-	defer limitMux.Unlock()
-
 	db := middleware.DB
 	GetUserTypeLimitMap()
 
@@ -87,6 +85,11 @@ func SetUserLimitLevel(userName, limitType string, level int) error {
 	if err != nil {
 		return err
 	}
+	lock, err := custodyMutex.Obtain(limitLockKey(usr.ID))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 	if level <= 0 {
 		level = 0
 	}
@@ -109,8 +112,6 @@ func SetUserTodayLimit(userName, limitType string, amount int, count int) error
 	limitSync.Lock()
 	defer limitSync.Unlock()
 
-	limitMux.Lock()
-	defer limitMux.Unlock()
 	if amount < 0 || count < 0 {
 		return fmt.Errorf("金额或次数不能为负数")
 	}
@@ -126,6 +127,11 @@ func SetUserTodayLimit(userName, limitType string, amount int, count int) error
 	if err != nil {
 		return err
 	}
+	lock, err := custodyMutex.Obtain(limitLockKey(usr.ID))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
 	userLimit := custodyModels.Limit{}
 	err = db.Where("user_id =? and limit_type =?", usr.ID, TypeID).First(&userLimit).Error
@@ -0,0 +1,285 @@
+package custodyLimit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"trade/btlLog"
+	"trade/middleware"
+	"trade/models"
+	"trade/models/custodyModels"
+	caccount "trade/services/custodyAccount/account"
+)
+
+// LimitReviewError is returned for a transfer over a limit that an admin may still approve.
+type LimitReviewError struct {
+	RuleId uint
+	Reason string
+}
+
+func (e *LimitReviewError) Error() string {
+	return e.Reason
+}
+
+// LimitDecision is the outcome of EvaluateLimit. Review is set when the transfer has to wait for an admin.
+type LimitDecision struct {
+	LimitTypeId uint
+	AmountSat   float64
+	Review      *LimitReviewError
+}
+
+var satPriceSource func(assetId string) (decimal.Decimal, error)
+
+// SetSatPriceSource sets how asset amounts are valued in sats. custodyLimit can not import the pools that
+// price assets, so the custody service sets the source at startup.
+func SetSatPriceSource(source func(assetId string) (decimal.Decimal, error)) {
+	satPriceSource = source
+}
+
+func amountInSat(assetId string, amount float64) (float64, error) {
+	if assetId == "00" {
+		return amount, nil
+	}
+	if satPriceSource == nil {
+		return 0, errors.New("no sat price source")
+	}
+	price, err := satPriceSource(assetId)
+	if err != nil {
+		return 0, err
+	}
+	return decimal.NewFromFloat(amount).Mul(price).Floor().InexactFloat64(), nil
+}
+
+func userLimitLevel(db *gorm.DB, userId uint, limitTypeId uint) (uint, error) {
+	limit := custodyModels.Limit{}
+	err := db.Where("user_id = ? AND limit_type = ?", userId, limitTypeId).First(&limit).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return defaultLimitLevel, nil
+		}
+		return 0, err
+	}
+	return limit.Level, nil
+}
+
+// LockLimit locks the user's row until tx ends. Take it before EvaluateLimit when the same tx goes on to
+// MinusLimit, so two transfers of the user can not both pass the check before either is billed.
+func LockLimit(tx *gorm.DB, user *caccount.UserInfo) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, user.User.ID).Error
+}
+
+// EvaluateLimit checks a transfer against the user's daily limit bill and the rolling limit rules of
+// its LimitType. Rules with the reject action fail the transfer, everything else over a limit asks for review.
+func EvaluateLimit(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.LimitType, amount float64) (*LimitDecision, error) {
+	limitBill, err := GetLimit(db, user, limitType)
+	if err != nil {
+		return nil, err
+	}
+	decision := LimitDecision{LimitTypeId: limitType.ID}
+	if limitType.ID == 0 {
+		return &decision, nil
+	}
+
+	if limitBill != nil {
+		switch {
+		case limitBill.UseAbleAmount < amount:
+			decision.Review = &LimitReviewError{Reason: fmt.Sprintf("今日可用交易额度不足,剩余额度：%v", limitBill.UseAbleAmount)}
+		case limitBill.UseAbleCount <= 0:
+			decision.Review = &LimitReviewError{Reason: fmt.Sprintf("今日可用交易次数不足,剩余交易次数：%v", limitBill.UseAbleCount)}
+		case time.Now().Sub(limitBill.LocalTime).Seconds() < 5:
+			return nil, errors.New("交易频繁，请稍后再试")
+		}
+	}
+
+	level, err := userLimitLevel(db, user.User.ID, limitType.ID)
+	if err != nil {
+		return nil, err
+	}
+	var rules []custodyModels.LimitRule
+	err = db.Where("limit_type_id = ? AND level IN ? AND enabled = ?", limitType.ID, []uint{0, level}, true).
+		Order("window_second").
+		Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return &decision, nil
+	}
+
+	amountSat, priceErr := amountInSat(limitType.AssetId, amount)
+	decision.AmountSat = amountSat
+	now := time.Now()
+	for _, rule := range rules {
+		var used struct {
+			AmountSat float64
+			Count     uint
+		}
+		err = db.Model(&custodyModels.LimitUsage{}).
+			Select("COALESCE(SUM(amount_sat), 0) AS amount_sat, COUNT(*) AS count").
+			Where("user_id = ? AND limit_type = ? AND created_at >= ?", user.User.ID, limitType.ID, now.Add(-time.Duration(rule.WindowSecond)*time.Second)).
+			Scan(&used).Error
+		if err != nil {
+			return nil, err
+		}
+
+		var reason string
+		switch {
+		case rule.MaxCount > 0 && used.Count+1 > rule.MaxCount:
+			reason = fmt.Sprintf("%v秒内交易次数超过%v次", rule.WindowSecond, rule.MaxCount)
+		case rule.MaxAmountSat > 0 && priceErr != nil:
+			reason = fmt.Sprintf("无法获取资产价格：%v", priceErr)
+		case rule.MaxAmountSat > 0 && used.AmountSat+amountSat > rule.MaxAmountSat:
+			reason = fmt.Sprintf("%v秒内交易额度超过%v聪,已用：%v", rule.WindowSecond, rule.MaxAmountSat, used.AmountSat)
+		default:
+			continue
+		}
+		if rule.Action == custodyModels.LimitRuleActionReject {
+			return nil, errors.New(reason)
+		}
+		if decision.Review == nil {
+			decision.Review = &LimitReviewError{RuleId: rule.ID, Reason: reason}
+		}
+	}
+	return &decision, nil
+}
+
+// CreateWithdrawalReview queues an over limit withdrawal mission for an admin.
+func CreateWithdrawalReview(tx *gorm.DB, usr *caccount.UserInfo, mission *custodyModels.PayOutside, decision *LimitDecision) error {
+	review := custodyModels.WithdrawalReview{
+		UserId:    usr.User.ID,
+		AccountId: mission.AccountID,
+		LimitType: decision.LimitTypeId,
+		RuleId:    decision.Review.RuleId,
+		AssetId:   mission.AssetId,
+		Amount:    mission.Amount,
+		AmountSat: decision.AmountSat,
+		BalanceId: mission.BalanceId,
+		MissionId: mission.ID,
+		Status:    custodyModels.WithdrawalReviewStatusPending,
+		Reason:    decision.Review.Reason,
+	}
+	err := tx.Create(&review).Error
+	if err != nil {
+		return err
+	}
+	btlLog.CUST.Info("outside mission %v waits for review: %v", mission.ID, review.Reason)
+	return nil
+}
+
+// RecordLimitUsage counts a transfer against the rolling limit rules of its LimitType.
+func RecordLimitUsage(db *gorm.DB, userId uint, limitTypeId uint, assetId string, amount float64, amountSat float64) error {
+	if limitTypeId == 0 {
+		return nil
+	}
+	return db.Create(&custodyModels.LimitUsage{
+		UserId:    userId,
+		LimitType: limitTypeId,
+		AssetId:   assetId,
+		Amount:    amount,
+		AmountSat: amountSat,
+	}).Error
+}
+
+func recordLimitUsage(db *gorm.DB, user *caccount.UserInfo, limitType *custodyModels.LimitType, amount float64) error {
+	amountSat, err := amountInSat(limitType.AssetId, amount)
+	if err != nil {
+		// The transfer still counts towards the velocity rules.
+		amountSat = 0
+	}
+	return RecordLimitUsage(db, user.User.ID, limitType.ID, limitType.AssetId, amount, amountSat)
+}
+
+type LimitRule struct {
+	Id           uint    `json:"id"`
+	LimitName    string  `json:"limitName"`
+	Level        uint    `json:"level"`
+	WindowSecond int64   `json:"windowSecond"`
+	MaxAmountSat float64 `json:"maxAmountSat"`
+	MaxCount     uint    `json:"maxCount"`
+	Action       int     `json:"action"`
+	Enabled      bool    `json:"enabled"`
+	Memo         string  `json:"memo"`
+}
+
+func GetLimitRules(limitName string, page, pageSize int) (*[]LimitRule, int64, error) {
+	db := middleware.DB
+	var limitTypes custodyModels.LimitType
+	err := db.Table("user_limit_type").Where("memo =?", limitName).First(&limitTypes).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("限额类型不存在: %s", limitName)
+	}
+	var total int64
+	err = db.Model(&custodyModels.LimitRule{}).Where("limit_type_id =?", limitTypes.ID).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var rules []custodyModels.LimitRule
+	err = db.Where("limit_type_id =?", limitTypes.ID).Offset((page - 1) * pageSize).Limit(pageSize).Find(&rules).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var ruleArr []LimitRule
+	for _, rule := range rules {
+		ruleArr = append(ruleArr, LimitRule{
+			Id:           rule.ID,
+			LimitName:    limitName,
+			Level:        rule.Level,
+			WindowSecond: rule.WindowSecond,
+			MaxAmountSat: rule.MaxAmountSat,
+			MaxCount:     rule.MaxCount,
+			Action:       int(rule.Action),
+			Enabled:      rule.Enabled,
+			Memo:         rule.Memo,
+		})
+	}
+	return &ruleArr, total, nil
+}
+
+// CreateOrUpdateLimitRule saves the rule, creating it when Id is 0.
+func CreateOrUpdateLimitRule(rule *LimitRule) error {
+	if rule.WindowSecond <= 0 || rule.MaxAmountSat < 0 {
+		return fmt.Errorf("时间窗口或金额无效")
+	}
+	if rule.MaxAmountSat == 0 && rule.MaxCount == 0 {
+		return fmt.Errorf("金额和次数不能同时为空")
+	}
+	action := custodyModels.LimitRuleAction(rule.Action)
+	if action != custodyModels.LimitRuleActionReject && action != custodyModels.LimitRuleActionReview {
+		return fmt.Errorf("未知的处理方式: %d", rule.Action)
+	}
+	db := middleware.DB
+	var limitTypes custodyModels.LimitType
+	err := db.Table("user_limit_type").Where("memo =?", rule.LimitName).First(&limitTypes).Error
+	if err != nil {
+		return fmt.Errorf("限额类型不存在: %s", rule.LimitName)
+	}
+
+	limitRule := custodyModels.LimitRule{}
+	if rule.Id != 0 {
+		err = db.First(&limitRule, rule.Id).Error
+		if err != nil {
+			return err
+		}
+	}
+	limitRule.LimitTypeId = limitTypes.ID
+	limitRule.Level = rule.Level
+	limitRule.WindowSecond = rule.WindowSecond
+	limitRule.MaxAmountSat = rule.MaxAmountSat
+	limitRule.MaxCount = rule.MaxCount
+	limitRule.Action = action
+	limitRule.Enabled = rule.Enabled
+	limitRule.Memo = rule.Memo
+	err = db.Save(&limitRule).Error
+	if err != nil {
+		return err
+	}
+	rule.Id = limitRule.ID
+	return nil
+}
+
+func DeleteLimitRule(id uint) error {
+	return middleware.DB.Delete(&custodyModels.LimitRule{}, id).Error
+}
@@ -0,0 +1,39 @@
+package custodyMutex
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"trade/models/custodyModels"
+)
+
+// Fence records the fencing tokens of the locks in tx and fails with ErrLockLost when a later holder of
+// any of them has already written, so a holder whose lease expired can not commit over the new holder.
+// Call it in the transaction doing the writes, just before commit. Locks without a token are skipped.
+func Fence(tx *gorm.DB, locks ...Lock) error {
+	for _, lock := range locks {
+		if lock == nil || lock.Token() == 0 {
+			continue
+		}
+		var fence custodyModels.LockFence
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("lock_key = ?", lock.Key()).First(&fence).Error
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			err = tx.Create(&custodyModels.LockFence{LockKey: lock.Key(), Token: lock.Token()}).Error
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if fence.Token > lock.Token() {
+			return ErrLockLost
+		}
+		err = tx.Model(&fence).Update("token", lock.Token()).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
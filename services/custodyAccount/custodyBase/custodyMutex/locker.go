@@ -0,0 +1,78 @@
+package custodyMutex
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+	"trade/config"
+)
+
+var (
+	ErrLockTimeout = errors.New("获取锁超时，请稍后再试")
+	ErrLockLost    = errors.New("锁已失效，操作已取消")
+)
+
+const (
+	defaultLockTtl  = 30 * time.Second
+	defaultLockWait = 10 * time.Second
+)
+
+// Lock is a held custody lock. Token is its fencing token, larger for every later holder of the same key,
+// or 0 when the backend does not fence. Unlock releases it once, later calls do nothing.
+type Lock interface {
+	Key() string
+	Token() int64
+	Unlock()
+}
+
+// Locker hands out custody locks. Obtain waits for the lock, TryObtain returns false when it is held.
+type Locker interface {
+	Obtain(key string) (Lock, error)
+	TryObtain(key string) (Lock, bool, error)
+}
+
+var locker atomic.Value
+
+func init() {
+	locker.Store(lockerHolder{NewMemoryLocker()})
+}
+
+// lockerHolder keeps the stored type constant, atomic.Value panics on values of a different type.
+type lockerHolder struct {
+	Locker
+}
+
+// SetLocker replaces the locker used by Obtain and TryObtain.
+func SetLocker(l Locker) {
+	locker.Store(lockerHolder{l})
+}
+
+func GetLocker() Locker {
+	return locker.Load().(lockerHolder).Locker
+}
+
+func Obtain(key string) (Lock, error) {
+	return GetLocker().Obtain(key)
+}
+
+func TryObtain(key string) (Lock, bool, error) {
+	return GetLocker().TryObtain(key)
+}
+
+// InitLocker picks the locker from CustodyConfig.LockBackend. Every instance of a multi node deployment
+// must use "redis", the default in memory locker only serializes the goroutines of one process.
+func InitLocker(cfg *config.Config) {
+	custodyConfig := cfg.CustodyConfig
+	if custodyConfig.LockBackend != "redis" {
+		SetLocker(NewMemoryLocker())
+		return
+	}
+	ttl, wait := defaultLockTtl, defaultLockWait
+	if custodyConfig.LockTtlSecond > 0 {
+		ttl = time.Duration(custodyConfig.LockTtlSecond) * time.Second
+	}
+	if custodyConfig.LockWaitSecond > 0 {
+		wait = time.Duration(custodyConfig.LockWaitSecond) * time.Second
+	}
+	SetLocker(NewRedisLocker(ttl, wait))
+}
@@ -0,0 +1,43 @@
+package custodyMutex
+
+import "sync"
+
+type memoryLocker struct{}
+
+type memoryLock struct {
+	key   string
+	mutex *sync.Mutex
+	once  sync.Once
+}
+
+// NewMemoryLocker returns a locker backed by the process local mutexes of GetCustodyMutex. Its locks
+// carry no fencing token.
+func NewMemoryLocker() Locker {
+	return memoryLocker{}
+}
+
+func (memoryLocker) Obtain(key string) (Lock, error) {
+	mutex := GetCustodyMutex(key)
+	mutex.Lock()
+	return &memoryLock{key: key, mutex: mutex}, nil
+}
+
+func (memoryLocker) TryObtain(key string) (Lock, bool, error) {
+	mutex := GetCustodyMutex(key)
+	if !mutex.TryLock() {
+		return nil, false, nil
+	}
+	return &memoryLock{key: key, mutex: mutex}, true, nil
+}
+
+func (l *memoryLock) Key() string {
+	return l.key
+}
+
+func (l *memoryLock) Token() int64 {
+	return 0
+}
+
+func (l *memoryLock) Unlock() {
+	l.once.Do(l.mutex.Unlock)
+}
@@ -0,0 +1,110 @@
+package custodyMutex
+
+import (
+	"sync"
+	"time"
+	"trade/btlLog"
+	"trade/middleware"
+)
+
+const (
+	redisLockPrefix  = "custody_lock_"
+	redisFencePrefix = "custody_lock_fence_"
+	redisRetryDelay  = 50 * time.Millisecond
+)
+
+type redisLocker struct {
+	ttl  time.Duration
+	wait time.Duration
+}
+
+type redisLock struct {
+	key        string
+	identifier string
+	token      int64
+	ttl        time.Duration
+	stop       chan struct{}
+	once       sync.Once
+}
+
+// NewRedisLocker returns a locker shared by every instance using the same Redis. A lock expires after ttl
+// unless its holder is alive to renew it, and Obtain gives up after waiting wait.
+func NewRedisLocker(ttl time.Duration, wait time.Duration) Locker {
+	return &redisLocker{ttl: ttl, wait: wait}
+}
+
+func (r *redisLocker) Obtain(key string) (Lock, error) {
+	deadline := time.Now().Add(r.wait)
+	for {
+		lock, ok, err := r.TryObtain(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return lock, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(redisRetryDelay)
+	}
+}
+
+func (r *redisLocker) TryObtain(key string) (Lock, bool, error) {
+	identifier, ok := middleware.AcquireLock(redisLockPrefix+key, r.ttl)
+	if !ok {
+		return nil, false, nil
+	}
+	token, err := middleware.RedisIncr(redisFencePrefix + key)
+	if err != nil {
+		middleware.ReleaseLock(redisLockPrefix+key, identifier)
+		return nil, false, err
+	}
+	lock := &redisLock{
+		key:        key,
+		identifier: identifier,
+		token:      token,
+		ttl:        r.ttl,
+		stop:       make(chan struct{}),
+	}
+	go lock.renew()
+	return lock, true, nil
+}
+
+// renew extends the lease every third of its ttl until the lock is released or lost.
+func (l *redisLock) renew() {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ok, err := middleware.RenewLock(redisLockPrefix+l.key, l.identifier, l.ttl)
+			if err != nil {
+				btlLog.CUST.Error("renew custody lock %s error:%v", l.key, err)
+				continue
+			}
+			if !ok {
+				// Writes under the lost lock are rejected by Fence.
+				btlLog.CUST.Error("custody lock %s lost (token %d)", l.key, l.token)
+				return
+			}
+		}
+	}
+}
+
+func (l *redisLock) Key() string {
+	return l.key
+}
+
+func (l *redisLock) Token() int64 {
+	return l.token
+}
+
+func (l *redisLock) Unlock() {
+	l.once.Do(func() {
+		close(l.stop)
+		middleware.ReleaseLock(redisLockPrefix+l.key, l.identifier)
+	})
+}
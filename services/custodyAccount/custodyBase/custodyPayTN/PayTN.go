@@ -8,6 +8,8 @@ import (
 	"strings"
 )
 
+// PayToNpubKey is a pay to npub key invoice. Vision 2 invoices are signed by the recipient, see invoiceV2.go,
+// and use the 'ptnv2' prefix. Earlier visions are unsigned and keep the 'ptn' prefix.
 type PayToNpubKey struct {
 	NpubKey     string
 	AssetId     string
@@ -15,6 +17,10 @@ type PayToNpubKey struct {
 	Time        int64
 	FromNpubKey string
 	Vision      uint8
+	Expiry      int64  `json:",omitempty"`
+	Memo        string `json:",omitempty"`
+	PaymentHash string `json:",omitempty"`
+	Signature   string `json:",omitempty"`
 }
 
 func (p *PayToNpubKey) Encode() (string, error) {
@@ -23,6 +29,9 @@ func (p *PayToNpubKey) Encode() (string, error) {
 		return "", err
 	}
 	hexData := hex.EncodeToString(data)
+	if p.Vision >= VisionV2 {
+		return prefixV2 + hexData, nil
+	}
 	return "ptn" + hexData, nil
 }
 func (p *PayToNpubKey) Decode(encoded string) error {
@@ -31,6 +40,9 @@ func (p *PayToNpubKey) Decode(encoded string) error {
 	}
 
 	hexData := encoded[3:]
+	if strings.HasPrefix(encoded, prefixV2) {
+		hexData = encoded[len(prefixV2):]
+	}
 	data, err := hex.DecodeString(hexData)
 	if err != nil {
 		return err
@@ -0,0 +1,197 @@
+package custodyPayTN
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+	"trade/config"
+	"trade/models/custodyModels"
+)
+
+const (
+	VisionV2 uint8 = 2
+
+	prefixV2        = "ptnv2"
+	canonicalTagV2  = "ptn-v2"
+	paymentHashSize = 32
+)
+
+var (
+	InvalidSignatureErr  = errors.New("发票签名无效")
+	InvoiceExpiredErr    = errors.New("发票已过期")
+	InvoiceAlreadyPaid   = errors.New("发票已支付")
+	InvoiceNotSignedErr  = errors.New("发票未签名，请使用新版发票")
+	InvoiceMismatchedErr = errors.New("发票内容与支付请求不一致")
+	InvoiceSwapPayErr    = errors.New("签名发票不支持兑换支付")
+)
+
+// npubKeyToPubKey decodes a bech32 npub or a hex x-only key into the recipient's schnorr public key.
+func npubKeyToPubKey(npubKey string) (*btcec.PublicKey, error) {
+	var key []byte
+	if strings.HasPrefix(npubKey, "npub1") {
+		hrp, data, err := bech32.Decode(npubKey)
+		if err != nil {
+			return nil, err
+		}
+		if hrp != "npub" {
+			return nil, errors.New("invalid npub hrp(" + hrp + ")")
+		}
+		key, err = bech32.ConvertBits(data, 5, 8, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		key, err = hex.DecodeString(npubKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return schnorr.ParsePubKey(key)
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+// canonicalV2 is the byte string a v2 invoice signs. Every field is length prefixed, so no two
+// invoices serialize to the same bytes.
+func (p *PayToNpubKey) canonicalV2() []byte {
+	var buf bytes.Buffer
+	writeCanonicalString(&buf, canonicalTagV2)
+	buf.WriteByte(p.Vision)
+	writeCanonicalString(&buf, p.NpubKey)
+	writeCanonicalString(&buf, p.FromNpubKey)
+	writeCanonicalString(&buf, p.AssetId)
+	writeCanonicalString(&buf, strconv.FormatFloat(p.Amount, 'f', -1, 64))
+	_ = binary.Write(&buf, binary.BigEndian, p.Time)
+	_ = binary.Write(&buf, binary.BigEndian, p.Expiry)
+	writeCanonicalString(&buf, p.Memo)
+	writeCanonicalString(&buf, p.PaymentHash)
+	return buf.Bytes()
+}
+
+func (p *PayToNpubKey) sigHashV2() []byte {
+	hash := sha256.Sum256(p.canonicalV2())
+	return hash[:]
+}
+
+// Sign signs the invoice with the recipient's key and makes it a v2 invoice.
+func (p *PayToNpubKey) Sign(privKey *btcec.PrivateKey) error {
+	p.Vision = VisionV2
+	signature, err := schnorr.Sign(privKey, p.sigHashV2())
+	if err != nil {
+		return err
+	}
+	p.Signature = hex.EncodeToString(signature.Serialize())
+	return nil
+}
+
+// VerifySignature checks that the invoice is signed by the key behind NpubKey.
+func (p *PayToNpubKey) VerifySignature() error {
+	if p.Vision < VisionV2 || p.Signature == "" {
+		return InvoiceNotSignedErr
+	}
+	if len(p.PaymentHash) != paymentHashSize*2 {
+		return errors.New("invalid payment hash length(" + strconv.Itoa(len(p.PaymentHash)) + ")")
+	}
+	pubKey, err := npubKeyToPubKey(p.NpubKey)
+	if err != nil {
+		return errors.Join(InvalidSignatureErr, err)
+	}
+	sigBytes, err := hex.DecodeString(p.Signature)
+	if err != nil {
+		return errors.Join(InvalidSignatureErr, err)
+	}
+	signature, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return errors.Join(InvalidSignatureErr, err)
+	}
+	if !signature.Verify(p.sigHashV2(), pubKey) {
+		return InvalidSignatureErr
+	}
+	return nil
+}
+
+// IsExpired reports whether the invoice has expired at now. Invoices without expiry never expire.
+func (p *PayToNpubKey) IsExpired(now int64) bool {
+	return p.Expiry != 0 && now >= p.Expiry
+}
+
+// DecodeAndVerify decodes a v2 invoice and rejects it when the signature is invalid or it has expired at now.
+func DecodeAndVerify(encoded string, now int64) (*PayToNpubKey, error) {
+	var p PayToNpubKey
+	err := p.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	err = p.VerifySignature()
+	if err != nil {
+		return nil, err
+	}
+	if p.IsExpired(now) {
+		return nil, InvoiceExpiredErr
+	}
+	return &p, nil
+}
+
+// MatchPayment checks that the invoice asks for exactly this payment. An invoice naming a payer in
+// FromNpubKey can only be paid by that payer.
+func (p *PayToNpubKey) MatchPayment(payerUserName string, receiverUserName string, amount float64, assetId string) error {
+	if p.NpubKey != receiverUserName || p.Amount != amount || p.AssetId != assetId {
+		return InvoiceMismatchedErr
+	}
+	if p.FromNpubKey != "" && p.FromNpubKey != payerUserName {
+		return InvoiceMismatchedErr
+	}
+	return nil
+}
+
+// VerifyPayment checks the invoice of a user to user payment and returns it decoded. The invoice must be a
+// signed, unexpired v2 invoice for exactly this payment. An empty invoice is only accepted, returning nil,
+// when AllowUnsignedPayToUser is configured.
+func VerifyPayment(invoice string, payerUserName string, receiverUserName string, amount float64, assetId string, now int64) (*PayToNpubKey, error) {
+	if invoice == "" {
+		if config.GetConfig().CustodyConfig.AllowUnsignedPayToUser {
+			return nil, nil
+		}
+		return nil, InvoiceNotSignedErr
+	}
+	p, err := DecodeAndVerify(invoice, now)
+	if err != nil {
+		return nil, err
+	}
+	err = p.MatchPayment(payerUserName, receiverUserName, amount, assetId)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MarkPaid records the invoice as paid by the payer, failing with InvoiceAlreadyPaid on a second payment.
+// Call it in the tx that debits the payer, so a payment that rolls back leaves the invoice unpaid.
+func MarkPaid(tx *gorm.DB, p *PayToNpubKey, payerAccountId uint, invoice string) error {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&custodyModels.PayToNpubKeyPaid{
+		PaymentHash:    p.PaymentHash,
+		NpubKey:        p.NpubKey,
+		PayerAccountId: payerAccountId,
+		Invoice:        invoice,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return InvoiceAlreadyPaid
+	}
+	return nil
+}
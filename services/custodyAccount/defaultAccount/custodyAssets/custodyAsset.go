@@ -20,7 +20,9 @@ import (
 	cBase "trade/services/custodyAccount/custodyBase"
 	"trade/services/custodyAccount/custodyBase/control"
 	"trade/services/custodyAccount/custodyBase/custodyFee"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
 	"trade/services/custodyAccount/custodyBase/custodyLimit"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 	"trade/services/custodyAccount/custodyBase/custodyPayTN"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
 	"trade/services/custodyAccount/defaultAccount/custodyBtc"
@@ -74,7 +76,7 @@ func (e *AssetEvent) GetBalances() ([]cBase.Balance, error) {
 		for _, b := range *temp {
 			balances = append(balances, cBase.Balance{
 				AssetId: b.AssetId,
-				Amount:  int64(b.Amount),
+				Amount:  b.Amount.IntPart(),
 			})
 		}
 	}
@@ -180,12 +182,18 @@ func (e *AssetEvent) ApplyChannelPayReq(applyRequest *AssetInvoiceApplyResponse)
 		Amount:  applyRequest.Amount}, nil
 }
 
-func (e *AssetEvent) SendPaymentToUser(receiverUserName string, amount float64, assetId string) error {
-	if !control.GetTransferControl("asset", control.TransferControlLocal) {
+// SendPaymentToUser pays the user. The invoice must be a signed, unexpired and unpaid v2 pay to npub key
+// invoice for exactly this payment, see custodyPayTN.VerifyPayment.
+func (e *AssetEvent) SendPaymentToUser(receiverUserName string, amount float64, assetId string, invoice string) (err error) {
+	if !control.GetAssetTransferControl(assetId, control.TransferControlLocal) {
 		return errors.New("当前服务调用失败，请稍后再试")
 	}
 
-	var err error
+	ptn, err := custodyPayTN.VerifyPayment(invoice, e.UserInfo.User.Username, receiverUserName, amount, assetId, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
 	limitType := custodyModels.LimitType{
 		AssetId:      assetId,
 		TransferType: custodyModels.LimitTransferTypeLocal,
@@ -212,6 +220,7 @@ func (e *AssetEvent) SendPaymentToUser(receiverUserName string, amount float64,
 	if err != nil {
 		return fmt.Errorf("获取对方可接收资产列表失败")
 	}
+
 	assetIdSupplier, _ := swap.GetSupplier(assetId)
 	if assetIdSupplier != "" && assetIdSupplier == receiverUserName || character == custodyswap.ReceiveCharacterConsumer {
 		reciveList.AssetList = []string{assetId}
@@ -241,13 +250,17 @@ func (e *AssetEvent) SendPaymentToUser(receiverUserName string, amount float64,
 		}
 		m.Fee = assetFee
 		custodyBtc.LogAIM(middleware.DB, &m)
-		err = RunInsideStepByUserId(e.UserInfo, receiver, &m)
+		err = RunInsideStepByUserId(e.UserInfo, receiver, &m, ptn, invoice)
 		if err != nil {
 			return err
 		}
 		return nil
 	case len(reciveList.AssetList) > 1,
 		len(reciveList.AssetList) == 1 && reciveList.AssetList[0] != assetId:
+		// The swap pays in its own tx, where the invoice cannot be marked paid.
+		if ptn != nil {
+			return custodyPayTN.InvoiceSwapPayErr
+		}
 		err := swap.PayBySwap(&swap.PTNSQuest{
 			Payer:             e.UserInfo,
 			PayAsset:          assetId,
@@ -271,7 +284,7 @@ func (e *AssetEvent) SendPayment(bt *AssetPacket) error {
 		return err
 	}
 	if bt.isInsideMission != nil {
-		if !control.GetTransferControl("asset", control.TransferControlLocal) {
+		if !control.GetAssetTransferControl(bt.isInsideMission.insideInvoice.AssetId, control.TransferControlLocal) {
 			return errors.New("当前服务调用失败，请稍后再试")
 		}
 
@@ -279,7 +292,11 @@ func (e *AssetEvent) SendPayment(bt *AssetPacket) error {
 		go e.payToInside(bt)
 	} else {
 
-		if !control.GetTransferControl("asset", control.TransferControlOnChain) {
+		assetId := *e.AssetId
+		if bt.DecodeAddr != nil {
+			assetId = hex.EncodeToString(bt.DecodeAddr.AssetId)
+		}
+		if !control.GetAssetTransferControl(assetId, control.TransferControlOnChain) {
 			return errors.New("当前服务调用失败，请稍后再试")
 		}
 
@@ -343,23 +360,36 @@ func (e *AssetEvent) payToOutsideOnChain(bt *AssetPacket) {
 
 	assetId := hex.EncodeToString(bt.DecodeAddr.AssetId)
 
+	err = custodyLimit.LockLimit(tx, e.UserInfo)
+	if err != nil {
+		bt.err <- fmt.Errorf("payToOutsideOnChain limit error: %s", err.Error())
+		return
+	}
 	limitType := custodyModels.LimitType{
 		AssetId:      assetId,
 		TransferType: custodyModels.LimitTransferTypeOutside,
 	}
-	err = custodyLimit.MinusLimit(tx, e.UserInfo, &limitType, float64(bt.DecodeAddr.Amount))
+	decision, err := custodyLimit.EvaluateLimit(tx, e.UserInfo, &limitType, float64(bt.DecodeAddr.Amount))
 	if err != nil {
 		bt.err <- fmt.Errorf("payToOutsideOnChain limit error: %s", err.Error())
 		return
 	}
+	// Withdrawals waiting for review are counted against the limits once they are approved.
+	if decision.Review == nil {
+		err = custodyLimit.MinusLimit(tx, e.UserInfo, &limitType, float64(bt.DecodeAddr.Amount))
+		if err != nil {
+			bt.err <- fmt.Errorf("payToOutsideOnChain limit error: %s", err.Error())
+			return
+		}
+	}
 
 	outsideBalance := models.Balance{
 		AccountId: e.UserInfo.Account.ID,
 		BillType:  models.BillTypeAssetTransfer,
 		Away:      models.AWAY_OUT,
-		Amount:    float64(bt.DecodeAddr.Amount),
+		Amount:    custodyModels.NewAmountFromInt(int64(bt.DecodeAddr.Amount)),
 		Unit:      models.UNIT_ASSET_NORMAL,
-		ServerFee: float64(mempool.GetCustodyAssetFee()),
+		ServerFee: custodyModels.NewAmountFromInt(int64(mempool.GetCustodyAssetFee())),
 		AssetId:   &assetId,
 		Invoice:   &bt.PayReq,
 		State:     models.STATE_UNKNOW,
@@ -373,16 +403,26 @@ func (e *AssetEvent) payToOutsideOnChain(bt *AssetPacket) {
 		return
 	}
 
-	_, err = custodyBalance.LessAssetBalance(tx, e.UserInfo, outsideBalance.Amount, outsideBalance.ID, *outsideBalance.AssetId, custodyModels.ChangeTypeAssetPayOutside)
+	_, err = custodyBalance.LessAssetBalance(tx, e.UserInfo, outsideBalance.Amount.InexactFloat64(), outsideBalance.ID, *outsideBalance.AssetId, custodyModels.ChangeTypeAssetPayOutside)
 	if err != nil {
 		bt.err <- fmt.Errorf("payToOutsideOnChain asset balance error: %s", err.Error())
 		return
 	}
-	err = custodyBalance.PayFee(tx, e.UserInfo, float64(outsideBalance.ServerFee), outsideBalance.ID, &bt.PayReq, nil)
+	err = custodyBalance.PayFee(tx, e.UserInfo, outsideBalance.ServerFee.InexactFloat64(), outsideBalance.ID, &bt.PayReq, nil)
 	if err != nil {
 		btlLog.CUST.Error("PayFee error:%s", err)
 		return
 	}
+	reference := custodyJournal.Reference("bill_balance", outsideBalance.ID)
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationOutsidePayment, reference,
+		assetId, custodyJournal.UserAccount(e.UserInfo.Account.ID), custodyJournal.ExternalAccount, outsideBalance.Amount.InexactFloat64())
+	if err == nil {
+		err = custodyJournal.PayFee(tx, reference, e.UserInfo.Account.ID, outsideBalance.ServerFee.InexactFloat64())
+	}
+	if err != nil {
+		bt.err <- fmt.Errorf("payToOutsideOnChain journal error: %s", err.Error())
+		return
+	}
 
 	outside := custodyModels.PayOutside{
 		AccountID: e.UserInfo.Account.ID,
@@ -392,9 +432,27 @@ func (e *AssetEvent) payToOutsideOnChain(bt *AssetPacket) {
 		BalanceId: outsideBalance.ID,
 		Status:    custodyModels.PayOutsideStatusPending,
 	}
-	err = btldb.CreatePayOutside(&outside)
+	if decision.Review != nil {
+		outside.Status = custodyModels.PayOutsideStatusReview
+	}
+	// The mission is created in the same transaction as the debit, so a crash can not lose a paid for mission.
+	err = tx.Create(&outside).Error
 	if err != nil {
 		btlLog.CUST.Error("payToOutsideOnChain db error")
+		bt.err <- fmt.Errorf("payToOutsideOnChain mission error: %s", err.Error())
+		return
+	}
+	if decision.Review != nil {
+		err = custodyLimit.CreateWithdrawalReview(tx, e.UserInfo, &outside, decision)
+		if err != nil {
+			bt.err <- fmt.Errorf("payToOutsideOnChain review error: %s", err.Error())
+			return
+		}
+	}
+	err = custodyMutex.Fence(tx, e.UserInfo.HeldPayLock())
+	if err != nil {
+		bt.err <- err
+		return
 	}
 	if tx.Commit().Error != nil {
 		btlLog.CUST.Error("payToOutsideOnChain commit error")
@@ -413,7 +471,7 @@ func (e *AssetEvent) payToOutsideInChannel(bt *AssetPacket) {
 	balanceModel.AccountId = e.UserInfo.Account.ID
 	balanceModel.BillType = models.BillTypeAssetTransfer
 	balanceModel.Away = models.AWAY_OUT
-	balanceModel.Amount = float64(bt.DecodeInvoice.AssetAmount)
+	balanceModel.Amount = custodyModels.NewAmountFromInt(int64(bt.DecodeInvoice.AssetAmount))
 	balanceModel.Unit = models.UNIT_ASSET_NORMAL
 	balanceModel.AssetId = e.AssetId
 	balanceModel.Invoice = &bt.PayReq
@@ -564,10 +622,10 @@ func (e *AssetEvent) GetTransactionHistory(query *cBase.PaymentRequest) (*cBase.
 			} else {
 				r.PaymentHash = &empty
 			}
-			r.Amount = v.Amount
+			r.Amount = v.Amount.InexactFloat64()
 			r.AssetId = a[i].AssetId
 			r.State = v.State
-			r.Fee = uint64(v.ServerFee)
+			r.Fee = uint64(v.ServerFee.IntPart())
 			results.PaymentList = append(results.PaymentList, r)
 		}
 	}
@@ -12,6 +12,7 @@ import (
 	"trade/models/custodyModels"
 	"trade/models/custodyModels/game"
 	"trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
 	"trade/services/custodyAccount/custodyBase/custodyLimit"
 	"trade/services/custodyAccount/custodyBase/custodyPayTN"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
@@ -23,6 +24,9 @@ type invoiceInfo struct {
 	Invoice string
 	AssetId string
 	Hash    *string
+	// Paid is marked paid in the tx that debits the payer.
+	Paid        *custodyPayTN.PayToNpubKey
+	PaidInvoice string
 }
 
 func RunInsideStep(usr *account.UserInfo, mission *custodyModels.AccountInsideMission) error {
@@ -65,7 +69,8 @@ func RunInsideStep(usr *account.UserInfo, mission *custodyModels.AccountInsideMi
 	}
 }
 
-func RunInsideStepByUserId(usr *account.UserInfo, receiveUsr *account.UserInfo, mission *custodyModels.AccountInsideMission) error {
+// RunInsideStepByUserId runs a pay to npub key mission. A non nil paid is the signed invoice the mission settles.
+func RunInsideStepByUserId(usr *account.UserInfo, receiveUsr *account.UserInfo, mission *custodyModels.AccountInsideMission, paid *custodyPayTN.PayToNpubKey, paidInvoice string) error {
 	db := middleware.DB
 
 	if usr == nil {
@@ -96,9 +101,11 @@ func RunInsideStepByUserId(usr *account.UserInfo, receiveUsr *account.UserInfo,
 	invoice, _ := PTN.Encode()
 	h, _ := custodyPayTN.HashEncodedString(invoice)
 	i := invoiceInfo{
-		Invoice: invoice,
-		AssetId: mission.AssetId,
-		Hash:    &h,
+		Invoice:     invoice,
+		AssetId:     mission.AssetId,
+		Hash:        &h,
+		Paid:        paid,
+		PaidInvoice: paidInvoice,
 	}
 	for {
 		InsideSteps(usr, mission, i)
@@ -121,6 +128,16 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 		tx, back := middleware.GetTx()
 		defer back()
 
+		if i.Paid != nil {
+			err = custodyPayTN.MarkPaid(tx, i.Paid, usr.Account.ID, i.PaidInvoice)
+			if err != nil {
+				btlLog.CUST.Error("MarkPaid error:%s", err)
+				mission.Error = err.Error()
+				mission.State = custodyModels.AIMStateDone
+				return
+			}
+		}
+
 		balance := getBillBalanceModel(usr, mission.Amount, i.AssetId, models.AWAY_OUT, i)
 		if err = tx.Create(balance).Error; err != nil {
 			btlLog.CUST.Error("CreateBillBalance error:%s", err)
@@ -145,7 +162,18 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 			mission.State = custodyModels.AIMStateDone
 			return
 		}
-		balance.ServerFee = mission.Fee
+		err = custodyJournal.Transfer(tx, custodyModels.JournalOperationInsideTransfer, custodyJournal.Reference("inside_mission", mission.ID),
+			i.AssetId, custodyJournal.UserAccount(usr.Account.ID), custodyJournal.TransitAccount, mission.Amount)
+		if err == nil {
+			err = custodyJournal.PayFee(tx, custodyJournal.Reference("inside_mission", mission.ID), usr.Account.ID, mission.Fee)
+		}
+		if err != nil {
+			btlLog.CUST.Error("PostJournal error:%s", err)
+			mission.Error = err.Error()
+			mission.State = custodyModels.AIMStateDone
+			return
+		}
+		balance.ServerFee = custodyModels.NewAmountFromFloat64(mission.Fee)
 
 		err = tx.Save(balance).Error
 		if err != nil {
@@ -205,6 +233,14 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 			mission.Error = err.Error()
 			return
 		}
+		err = custodyJournal.Transfer(tx, custodyModels.JournalOperationInsideTransfer, custodyJournal.Reference("inside_mission", mission.ID),
+			i.AssetId, custodyJournal.TransitAccount, custodyJournal.UserAccount(rusr.Account.ID), mission.Amount)
+		if err != nil {
+			btlLog.CUST.Error("PostJournal error:%s", err)
+			mission.Retries += 1
+			mission.Error = err.Error()
+			return
+		}
 		mission.State = custodyModels.AIMStateSuccess
 		if rusr.Account.Type == models.GameReceiveAccount {
 			if i.AssetId == mempool.GameAssetId && rusr.Account.UserName == mempool.GameUser {
@@ -246,7 +282,7 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 func getBillBalanceModel(usr *account.UserInfo, amount float64, assetId string, away models.BalanceAway, invoice invoiceInfo) *models.Balance {
 	ba := models.Balance{}
 	ba.AccountId = usr.Account.ID
-	ba.Amount = amount
+	ba.Amount = custodyModels.NewAmountFromFloat64(amount)
 	ba.AssetId = &assetId
 	ba.Unit = models.UNIT_ASSET_NORMAL
 	ba.BillType = models.BillTypeAssetTransfer
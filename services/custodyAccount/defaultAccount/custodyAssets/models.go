@@ -139,6 +139,11 @@ func (p *AssetPacket) VerifyPayReq(event *AssetEvent) error {
 		limitType.TransferType = custodyModels.LimitTransferTypeOutside
 	}
 	err = custodyLimit.CheckLimit(middleware.DB, event.UserInfo, &limitType, float64(amount))
+	var reviewErr *custodyLimit.LimitReviewError
+	// On chain withdrawals over a limit wait for an admin instead of failing.
+	if errors.As(err, &reviewErr) && flag == "ta" && p.isInsideMission == nil {
+		err = nil
+	}
 	if err != nil {
 		return err
 	}
@@ -1,176 +1,615 @@
 package custodyAssets
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 	"trade/btlLog"
+	"trade/config"
 	"trade/middleware"
 	"trade/models"
 	"trade/models/custodyModels"
 	"trade/services/btldb"
+	caccount "trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
+	"trade/services/custodyAccount/defaultAccount/custodyBalance"
+	"trade/services/custodyAccount/defaultAccount/custodyBtc"
 	rpc "trade/services/servicesrpc"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/google/uuid"
+	"github.com/lightninglabs/taproot-assets/taprpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultOutsideIntervalSecond    = 60
+	defaultOutsideBatchSize         = 8
+	defaultOutsideMaxAttempts       = 5
+	defaultOutsideBaseBackoffSecond = 60
+	defaultOutsideMaxBackoffSecond  = 3600
+	defaultOutsideLeaseSecond       = 600
+
+	// outsideAnchorSatPerOutput is the btc each anchor output and its share of the fee is expected to need.
+	outsideAnchorSatPerOutput = 1000
+)
+
+var (
+	outsideRunning  atomic.Bool
+	outsideWorkerId = outsideWorkerName()
 )
 
-var isAble = true
+func outsideWorkerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid()) + "-" + uuid.NewString()[:8]
+}
+
+func outsideConfig() (interval, batchSize, maxAttempts int, lease time.Duration) {
+	cfg := config.GetConfig().OutsideMission
+	interval, batchSize, maxAttempts = cfg.IntervalSecond, cfg.BatchSize, cfg.MaxAttempts
+	if interval <= 0 {
+		interval = defaultOutsideIntervalSecond
+	}
+	if batchSize <= 0 {
+		batchSize = defaultOutsideBatchSize
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultOutsideMaxAttempts
+	}
+	leaseSecond := cfg.LeaseSecond
+	if leaseSecond <= 0 {
+		leaseSecond = defaultOutsideLeaseSecond
+	}
+	return interval, batchSize, maxAttempts, time.Duration(leaseSecond) * time.Second
+}
+
+// outsideBackoff is the wait before the attempt after the given failed attempts, doubling up to MaxBackoffSecond.
+func outsideBackoff(attempts int) time.Duration {
+	cfg := config.GetConfig().OutsideMission
+	base, limit := cfg.BaseBackoffSecond, cfg.MaxBackoffSecond
+	if base <= 0 {
+		base = defaultOutsideBaseBackoffSecond
+	}
+	if limit <= 0 {
+		limit = defaultOutsideMaxBackoffSecond
+	}
+	backoff := base
+	for i := 1; i < attempts && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return time.Duration(backoff) * time.Second
+}
 
+// GoOutsideMission starts the worker paying PayOutside missions on chain. Missions are leased before they
+// are sent, so any number of instances can run the worker without paying a mission twice.
 func GoOutsideMission() {
-	ticker := time.NewTicker(1 * time.Minute)
+	interval, _, _, _ := outsideConfig()
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	go func() {
 		for {
-
-			if isAble {
-				isAble = !isAble
-				startOutsideMission()
-				isAble = !isAble
+			if outsideRunning.CompareAndSwap(false, true) {
+				runOutsideMission()
+				outsideRunning.Store(false)
 			}
 			<-ticker.C
 		}
 	}()
 }
 
+func runOutsideMission() {
+	custodyBtc.RecoverOutsideOnChain()
+	recoverOutsideLeases()
+	startOutsideMission()
+	checkOutsideBatches()
+}
+
+// startOutsideMission sends the due missions, one anchor transaction per asset, or one for all assets
+// when BatchAcrossAssets is set.
 func startOutsideMission() {
-	var results []struct {
-		AssetID      string    `gorm:"column:asset_id"`
-		MinCreatedAt time.Time `gorm:"column:min_created_at"`
-	}
+	_, batchSize, _, _ := outsideConfig()
 	db := middleware.DB
-	db.Table("user_account_outside_asset_mission").
-		Select("asset_id, MIN(created_at) as min_created_at").
-		Where("status = ?", 0).
-		Group("asset_id").
-		Order("min_created_at").
-		Scan(&results)
-	if len(results) == 0 {
+	var due []custodyModels.PayOutside
+	err := db.Where("status = ? AND next_attempt_at <= ?", custodyModels.PayOutsideStatusPending, time.Now().Unix()).
+		Where("asset_id <> ?", custodyBalance.BtcId).
+		Order("id").
+		Limit(batchSize * 10).
+		Find(&due).Error
+	if err != nil {
+		btlLog.CUST.Error("load outside missions error:%v", err)
+		return
+	}
+	if len(due) == 0 {
 		return
 	}
 
 	assets, err := rpc.ListAssets()
 	if err != nil {
+		btlLog.CUST.Error("rpc.ListAssets error:%v", err)
 		return
 	}
-	list := make(map[string]uint64)
+	available := make(map[string]uint64)
 	for _, asset := range assets.Assets {
 		assetId := hex.EncodeToString(asset.AssetGenesis.AssetId)
-		list[assetId] += asset.Amount
+		available[assetId] += asset.Amount
 	}
+	balance, err := rpc.GetBalance()
+	if err != nil {
+		btlLog.CUST.Error("rpc.GetBalance error:%v", err)
+		return
+	}
+	satBudget := balance.AccountBalance["default"].ConfirmedBalance
 
-	for _, result := range results {
-		if list[result.AssetID] == 0 {
-			continue
+	for _, group := range groupOutsideMissions(due) {
+		missions := selectOutsideBatch(group, available, batchSize)
+		// Trim the batch to what the wallet can anchor instead of skipping it.
+		if fit := int(satBudget / outsideAnchorSatPerOutput); len(missions) > fit {
+			missions = missions[:fit]
 		}
-		var outsideMissions []custodyModels.PayOutside
-		db.Where("asset_id =? and status =?", result.AssetID, custodyModels.PayOutsideStatusPending).Limit(8).Find(&outsideMissions)
-		if outsideMissions == nil || len(outsideMissions) == 0 {
+		if len(missions) == 0 {
 			continue
 		}
+		satBudget -= int64(len(missions) * outsideAnchorSatPerOutput)
+		payToOutside(missions)
+	}
+}
 
-		missions := removeDuplicates(outsideMissions, list)
-		if len(missions) == 0 {
-			continue
+func groupOutsideMissions(due []custodyModels.PayOutside) [][]custodyModels.PayOutside {
+	if config.GetConfig().OutsideMission.BatchAcrossAssets {
+		return [][]custodyModels.PayOutside{due}
+	}
+	var groups [][]custodyModels.PayOutside
+	index := make(map[string]int)
+	for _, mission := range due {
+		i, ok := index[mission.AssetId]
+		if !ok {
+			i = len(groups)
+			index[mission.AssetId] = i
+			groups = append(groups, nil)
 		}
+		groups[i] = append(groups[i], mission)
+	}
+	return groups
+}
 
-		balance, err := rpc.GetBalance()
-		if err != nil || balance.AccountBalance["default"].ConfirmedBalance < int64(len(missions)*1000) {
+// selectOutsideBatch picks up to batchSize missions the node holds enough of each asset for.
+// An address can only be paid once per transfer, so missions repeating an address wait for the next batch.
+func selectOutsideBatch(missions []custodyModels.PayOutside, available map[string]uint64, batchSize int) []custodyModels.PayOutside {
+	addresses := make(map[string]bool)
+	result := make([]custodyModels.PayOutside, 0, batchSize)
+	for _, mission := range missions {
+		if len(result) == batchSize {
+			break
+		}
+		amount := uint64(mission.Amount)
+		if addresses[mission.Address] || available[mission.AssetId] < amount {
 			continue
 		}
-
-		payToOutside(&missions)
+		addresses[mission.Address] = true
+		available[mission.AssetId] -= amount
+		result = append(result, mission)
 	}
+	return result
 }
-func payToOutside(missions *[]custodyModels.PayOutside) {
-	tx, back := middleware.GetTx()
 
-	defer back()
-	var err error
+// leaseOutsideMissions moves the missions still pending into Sending under a new batch and returns the ones this worker won.
+func leaseOutsideMissions(missions []custodyModels.PayOutside) (string, []custodyModels.PayOutside, error) {
+	_, _, _, lease := outsideConfig()
+	ids := make([]uint, 0, len(missions))
+	for _, mission := range missions {
+		ids = append(ids, mission.ID)
+	}
+	batchId := uuid.NewString()
+	db := middleware.DB
+	err := db.Model(&custodyModels.PayOutside{}).
+		Where("id IN ? AND status = ?", ids, custodyModels.PayOutsideStatusPending).
+		Updates(map[string]any{
+			"status":           custodyModels.PayOutsideStatusSending,
+			"batch_id":         batchId,
+			"lease_owner":      outsideWorkerId,
+			"lease_expires_at": time.Now().Add(lease).Unix(),
+		}).Error
+	if err != nil {
+		return "", nil, err
+	}
+	var leased []custodyModels.PayOutside
+	err = db.Where("batch_id = ? AND status = ? AND lease_owner = ?", batchId, custodyModels.PayOutsideStatusSending, outsideWorkerId).
+		Order("id").
+		Find(&leased).Error
+	if err != nil {
+		return "", nil, err
+	}
+	return batchId, leased, nil
+}
 
-	var addr []string
-	var balances []*models.Balance
-	for index := range *missions {
+func payToOutside(missions []custodyModels.PayOutside) {
+	batchId, leased, err := leaseOutsideMissions(missions)
+	if err != nil {
+		btlLog.CUST.Error("lease outside missions error:%v", err)
+		return
+	}
+	if len(leased) == 0 {
+		return
+	}
+	batch := custodyModels.PayOutsideBatch{
+		BatchId:      batchId,
+		Status:       custodyModels.PayOutsideBatchStatusSending,
+		ChangeOutput: -1,
+	}
+	err = middleware.DB.Create(&batch).Error
+	if err != nil {
+		btlLog.CUST.Error("create outside batch error:%v", err)
+		releaseOutsideMissions(batchId, err)
+		return
+	}
 
-		(*missions)[index].Status = custodyModels.PayOutsideStatusPaid
-		err = btldb.UpdatePayOutside(tx, &(*missions)[index])
-		if err != nil {
-			btlLog.CUST.Error("btldb.UpdatePayOutside error:%w", err)
+	addr := make([]string, 0, len(leased))
+	for _, mission := range leased {
+		addr = append(addr, mission.Address)
+	}
+	// The send gives up at half the lease, so recoverOutsideLeases never judges a batch tapd is still sending.
+	_, _, _, lease := outsideConfig()
+	response, err := rpc.SendAssetsWithLabel(addr, batchId, lease/2)
+	if err != nil {
+		btlLog.CUST.Error("rpc.SendAssetsWithLabel error:%v,%v", err, addr)
+		// The send may have reached tapd before the error, in which case the transfer carries our label.
+		transfer, findErr := rpc.FindTransferByLabel(batchId, batch.CreatedAt.Unix())
+		if findErr != nil {
+			// Whether tapd sent the batch is unknown, the missions stay in Sending until recovery finds out.
+			btlLog.CUST.Error("rpc.FindTransferByLabel error:%v", findErr)
 			return
 		}
+		if transfer == nil {
+			if status.Code(err) == codes.DeadlineExceeded {
+				// tapd may still finish the send after we stopped waiting, leave it to recovery.
+				return
+			}
+			failOutsideBatch(&batch, err)
+			return
+		}
+		err = markOutsideBatchBroadcast(&batch, transfer)
+	} else {
+		err = markOutsideBatchBroadcast(&batch, response.Transfer)
+	}
+	if err != nil {
+		btlLog.CUST.Error("mark outside batch %v broadcast error:%v", batchId, err)
+	}
+}
+
+// anchorTxId returns the anchor txid in its usual byte order, tapd reports the hash reversed.
+func anchorTxId(transfer *taprpc.AssetTransfer) string {
+	b := bytes.Clone(transfer.AnchorTxHash)
+	for i := 0; i < len(b)/2; i++ {
+		b[i], b[len(b)-i-1] = b[len(b)-i-1], b[i]
+	}
+	return hex.EncodeToString(b)
+}
+
+// anchorChangeOutput finds the anchor transaction output that carries no asset commitment.
+func anchorChangeOutput(transfer *taprpc.AssetTransfer, txId string) int32 {
+	if len(transfer.AnchorTx) == 0 {
+		return -1
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(transfer.AnchorTx)); err != nil {
+		return -1
+	}
+	anchors := make(map[string]bool)
+	for _, output := range transfer.Outputs {
+		if output.Anchor != nil {
+			anchors[output.Anchor.Outpoint] = true
+		}
+	}
+	for i := range msgTx.TxOut {
+		if !anchors[txId+":"+strconv.Itoa(i)] {
+			return int32(i)
+		}
+	}
+	return -1
+}
 
-		balance, err := btldb.ReadBalance((*missions)[index].BalanceId)
+// markOutsideBatchBroadcast records the anchor transaction of the batch and marks its missions paid.
+func markOutsideBatchBroadcast(batch *custodyModels.PayOutsideBatch, transfer *taprpc.AssetTransfer) error {
+	txId := anchorTxId(transfer)
+	tx, back := middleware.GetTx()
+	defer back()
+
+	var missions []custodyModels.PayOutside
+	err := tx.Where("batch_id = ? AND status = ?", batch.BatchId, custodyModels.PayOutsideStatusSending).Find(&missions).Error
+	if err != nil {
+		return err
+	}
+	for index := range missions {
+		missions[index].Status = custodyModels.PayOutsideStatusPaid
+		missions[index].TxHash = txId
+		missions[index].LeaseOwner = ""
+		missions[index].LeaseExpiresAt = 0
+		missions[index].LastError = ""
+		err = btldb.UpdatePayOutside(tx, &missions[index])
 		if err != nil {
-			return
+			return err
+		}
+		var balance models.Balance
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&balance, missions[index].BalanceId).Error
+		if err != nil {
+			return err
 		}
-		balances = append(balances, balance)
 		balance.State = models.STATE_SUCCESS
-
-		err = btldb.UpdateBalance(tx, balance)
+		balance.PaymentHash = &txId
+		err = btldb.UpdateBalance(tx, &balance)
 		if err != nil {
-			btlLog.CUST.Error("payToOutsideOnChain db error")
-			return
+			return err
 		}
-		addr = append(addr, (*missions)[index].Address)
 	}
-	response, err := rpc.SendAssets(addr)
+
+	batch.Status = custodyModels.PayOutsideBatchStatusBroadcast
+	batch.TxHash = txId
+	batch.AnchorTx = hex.EncodeToString(transfer.AnchorTx)
+	batch.ChainFees = transfer.AnchorTxChainFees
+	batch.ChangeOutput = anchorChangeOutput(transfer, txId)
+	batch.BroadcastAt = time.Now().Unix()
+	batch.LastError = ""
+	err = tx.Save(batch).Error
 	if err != nil {
-		btlLog.CUST.Error("rpc.SendAssets error:%v,%v", err, addr)
-		return
+		return err
 	}
-	tx.Commit()
-
-	b := response.Transfer.AnchorTxHash
-	for i := 0; i < len(b)/2; i++ {
-		temp := b[i]
-		b[i] = b[len(b)-i-1]
-		b[len(b)-i-1] = temp
+	if err = tx.Commit().Error; err != nil {
+		return err
 	}
-	txId := hex.EncodeToString(b)
+
 	btctx := custodyModels.PayOutsideTx{
 		TxHash:     txId,
-		Timestamp:  response.Transfer.TransferTimestamp,
-		HeightHint: response.Transfer.AnchorTxHeightHint,
-		ChainFees:  response.Transfer.AnchorTxChainFees,
-		InputsNum:  uint(len(response.Transfer.Inputs)),
-		OutputsNum: uint(len(response.Transfer.Outputs)),
+		Timestamp:  transfer.TransferTimestamp,
+		HeightHint: transfer.AnchorTxHeightHint,
+		ChainFees:  transfer.AnchorTxChainFees,
+		InputsNum:  uint(len(transfer.Inputs)),
+		OutputsNum: uint(len(transfer.Outputs)),
 		Status:     custodyModels.PayOutsideStatusTXPending,
 	}
 	err = btldb.CreatePayOutsideTx(&btctx)
 	if err != nil {
-		btlLog.CUST.Error("btldb.CreatePayOutsideTx error:%w", err)
+		btlLog.CUST.Error("btldb.CreatePayOutsideTx error:%v", err)
+	}
+	btlLog.CUST.Info("outside batch %v broadcast: tx=%v,missions=%v", batch.BatchId, txId, len(missions))
+	return nil
+}
+
+// failOutsideBatch gives the missions of a batch that could not be sent back to the queue.
+func failOutsideBatch(batch *custodyModels.PayOutsideBatch, cause error) {
+	err := middleware.DB.Model(batch).Updates(map[string]any{
+		"status":     custodyModels.PayOutsideBatchStatusFailed,
+		"last_error": cause.Error(),
+	}).Error
+	if err != nil {
+		btlLog.CUST.Error("update outside batch error:%v", err)
 	}
+	releaseOutsideMissions(batch.BatchId, cause)
+}
+
+// releaseOutsideMissions counts a failed attempt for each mission of the batch and schedules its retry,
+// or parks it in Failed once it is out of attempts.
+func releaseOutsideMissions(batchId string, cause error) {
+	_, _, maxAttempts, _ := outsideConfig()
 	db := middleware.DB
-	for index := range *missions {
-		(*missions)[index].TxHash = txId
-		err = btldb.UpdatePayOutside(db, &(*missions)[index])
+	var missions []custodyModels.PayOutside
+	err := db.Where("batch_id = ? AND status = ?", batchId, custodyModels.PayOutsideStatusSending).Find(&missions).Error
+	if err != nil {
+		btlLog.CUST.Error("load outside batch missions error:%v", err)
+		return
+	}
+	for _, mission := range missions {
+		attempts := mission.Attempts + 1
+		status := custodyModels.PayOutsideStatusPending
+		if attempts >= maxAttempts {
+			status = custodyModels.PayOutsideStatusFailed
+		}
+		err = db.Model(&custodyModels.PayOutside{}).
+			Where("id = ? AND status = ? AND batch_id = ?", mission.ID, custodyModels.PayOutsideStatusSending, batchId).
+			Updates(map[string]any{
+				"status":           status,
+				"attempts":         attempts,
+				"next_attempt_at":  time.Now().Add(outsideBackoff(attempts)).Unix(),
+				"last_error":       cause.Error(),
+				"lease_owner":      "",
+				"lease_expires_at": 0,
+			}).Error
 		if err != nil {
-			btlLog.CUST.Error("btldb.UpdatePayOutside error:%w", err)
+			btlLog.CUST.Error("release outside mission %v error:%v", mission.ID, err)
 		}
 	}
-	for index := range balances {
-		balances[index].PaymentHash = &txId
-		err = btldb.UpdateBalance(db, balances[index])
+}
+
+// recoverOutsideLeases settles the batches whose worker stopped while sending them. A batch tapd
+// knows by its label was sent and is recorded as such, any other goes back to the queue.
+func recoverOutsideLeases() {
+	var batchIds []string
+	err := middleware.DB.Model(&custodyModels.PayOutside{}).
+		Where("status = ? AND lease_expires_at < ?", custodyModels.PayOutsideStatusSending, time.Now().Unix()).
+		Where("asset_id <> ?", custodyBalance.BtcId).
+		Distinct("batch_id").
+		Pluck("batch_id", &batchIds).Error
+	if err != nil {
+		btlLog.CUST.Error("load expired outside leases error:%v", err)
+		return
+	}
+	for _, batchId := range batchIds {
+		var batch custodyModels.PayOutsideBatch
+		err = middleware.DB.Where("batch_id = ?", batchId).First(&batch).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			btlLog.CUST.Error("read outside batch error:%v", err)
+			continue
+		}
+		// Without its batch row the send time is not known, so the missions' last update bounds it.
+		since := batch.CreatedAt.Unix()
+		if batch.ID == 0 {
+			var leased custodyModels.PayOutside
+			err = middleware.DB.Where("batch_id = ?", batchId).Order("updated_at").First(&leased).Error
+			if err != nil {
+				btlLog.CUST.Error("read outside batch missions error:%v", err)
+				continue
+			}
+			since = leased.UpdatedAt.Unix()
+		}
+		transfer, err := rpc.FindTransferByLabel(batchId, since)
+		if err != nil {
+			btlLog.CUST.Error("rpc.FindTransferByLabel error:%v", err)
+			continue
+		}
+		if transfer == nil {
+			if batch.ID != 0 {
+				failOutsideBatch(&batch, errors.New("lease expired before the batch was sent"))
+			} else {
+				releaseOutsideMissions(batchId, errors.New("lease expired before the batch was sent"))
+			}
+			continue
+		}
+		if batch.ID == 0 {
+			batch = custodyModels.PayOutsideBatch{BatchId: batchId, ChangeOutput: -1}
+		}
+		err = markOutsideBatchBroadcast(&batch, transfer)
 		if err != nil {
-			btlLog.CUST.Error("payToOutsideOnChain db error")
+			btlLog.CUST.Error("mark outside batch %v broadcast error:%v", batchId, err)
 		}
 	}
 }
 
-func removeDuplicates(outsideMissions []custodyModels.PayOutside, list map[string]uint64) []custodyModels.PayOutside {
-
-	unique := make(map[string]custodyModels.PayOutside)
-	amount := uint64(0)
+// ListOutsideMissions returns the outside missions in status, newest first. A negative status lists all.
+func ListOutsideMissions(status int, pageNum int, pageSize int) ([]custodyModels.PayOutside, int64, error) {
+	db := middleware.DB.Model(&custodyModels.PayOutside{})
+	if status >= 0 {
+		db = db.Where("status = ?", status)
+	}
+	var count int64
+	err := db.Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var missions []custodyModels.PayOutside
+	err = db.Order("id desc").Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&missions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return missions, count, nil
+}
 
-	for _, outsideMission := range outsideMissions {
-		if _, exist := unique[outsideMission.Address]; !exist {
-			amount += uint64(outsideMission.Amount)
-			if amount > list[outsideMission.AssetId] {
-				break
-			}
-			unique[outsideMission.Address] = outsideMission
+// RetryOutsideMission puts a failed mission back in the queue with fresh attempts. Btc missions are claimed
+// into Sending and sent again right away.
+func RetryOutsideMission(id uint) error {
+	mission, err := btldb.ReadPayOutside(id)
+	if err != nil {
+		return err
+	}
+	if mission.AssetId == custodyBalance.BtcId {
+		err = custodyBtc.ClaimOutsideOnChain(middleware.DB, id, custodyModels.PayOutsideStatusFailed)
+		if err != nil {
+			return err
 		}
+		return custodyBtc.SendOutsideOnChain(mission)
+	}
+	result := middleware.DB.Model(&custodyModels.PayOutside{}).
+		Where("id = ? AND status = ?", id, custodyModels.PayOutsideStatusFailed).
+		Updates(map[string]any{
+			"status":          custodyModels.PayOutsideStatusPending,
+			"attempts":        0,
+			"next_attempt_at": 0,
+		})
+	if result.Error != nil {
+		return result.Error
 	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("outside mission %d is not failed", id)
+	}
+	return nil
+}
+
+// CancelOutsideMission cancels a mission that has not been sent and refunds the asset and the service fee to the user.
+func CancelOutsideMission(id uint, reason string) error {
+	tx, back := middleware.GetTx()
+	defer back()
 
-	result := make([]custodyModels.PayOutside, 0, len(unique))
-	for _, outside := range unique {
-		result = append(result, outside)
+	err := refundOutsideMission(tx, id, reason, custodyModels.PayOutsideStatusPending, custodyModels.PayOutsideStatusFailed)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
 	}
+	btlLog.CUST.Info("outside mission %v cancelled and refunded: %v", id, strings.TrimSpace(reason))
+	return nil
+}
 
-	return result
+// refundOutsideMission cancels the mission if it is in one of the statuses and refunds it to the user.
+func refundOutsideMission(tx *gorm.DB, id uint, reason string, statuses ...custodyModels.PayOutsideStatus) error {
+	result := tx.Model(&custodyModels.PayOutside{}).
+		Where("id = ? AND status IN ?", id, statuses).
+		Updates(map[string]any{
+			"status": custodyModels.PayOutsideStatusCancelled,
+			"memo":   reason,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("outside mission %d can not be cancelled", id)
+	}
+	var mission custodyModels.PayOutside
+	err := tx.First(&mission, id).Error
+	if err != nil {
+		return err
+	}
+	var account models.Account
+	err = tx.Where("id = ?", mission.AccountID).First(&account).Error
+	if err != nil {
+		return err
+	}
+	usr, err := caccount.GetUserInfo(account.UserName)
+	if err != nil {
+		return err
+	}
+	balance, err := btldb.ReadBalance(mission.BalanceId)
+	if err != nil {
+		return err
+	}
+
+	if mission.AssetId == custodyBalance.BtcId {
+		_, err = custodyBalance.AddBtcBalance(tx, usr, mission.Amount, balance.ID, custodyModels.ChangeTypeBtcRefundOnchain)
+	} else {
+		_, err = custodyBalance.AddAssetBalance(tx, usr, mission.Amount, balance.ID, mission.AssetId, custodyModels.ChangeTypeAssetRefundOutside)
+	}
+	if err != nil {
+		return err
+	}
+	if balance.ServerFee.IsPositive() {
+		_, err = custodyBalance.AddBtcBalance(tx, usr, balance.ServerFee.InexactFloat64(), balance.ID, custodyModels.ChangeTypeBackFee)
+		if err != nil {
+			return err
+		}
+	}
+	reference := custodyJournal.Reference("bill_balance", balance.ID)
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationOutsideRefund, reference,
+		mission.AssetId, custodyJournal.ExternalAccount, custodyJournal.UserAccount(account.ID), mission.Amount)
+	if err != nil {
+		return err
+	}
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationFeeRefund, reference,
+		"00", custodyJournal.FeeAccount, custodyJournal.UserAccount(account.ID), balance.ServerFee.InexactFloat64())
+	if err != nil {
+		return err
+	}
+	balance.State = models.STATE_FAILED
+	return btldb.UpdateBalance(tx, balance)
 }
@@ -0,0 +1,128 @@
+package custodyAssets
+
+import (
+	"time"
+	"trade/api"
+	"trade/btlLog"
+	"trade/config"
+	"trade/middleware"
+	"trade/models/custodyModels"
+	rpc "trade/services/servicesrpc"
+)
+
+const (
+	defaultOutsideStuckAfterMinute   = 60
+	defaultOutsideBumpIntervalMinute = 30
+	defaultOutsideMaxBumps           = 3
+	defaultOutsideMaxFeeRate         = 100
+)
+
+// checkOutsideBatches settles the confirmed batches and bumps the fee of the ones stuck in the mempool.
+func checkOutsideBatches() {
+	var batches []custodyModels.PayOutsideBatch
+	err := middleware.DB.Where("status = ?", custodyModels.PayOutsideBatchStatusBroadcast).Find(&batches).Error
+	if err != nil {
+		btlLog.CUST.Error("load outside batches error:%v", err)
+		return
+	}
+	if len(batches) == 0 {
+		return
+	}
+	network, err := api.GetConfigNetwork()
+	if err != nil {
+		btlLog.CUST.Error("api.GetConfigNetwork error:%v", err)
+		return
+	}
+	for index := range batches {
+		batch := &batches[index]
+		if api.IsTxConfirmed(network, batch.TxHash) {
+			err = confirmOutsideBatch(batch)
+			if err != nil {
+				btlLog.CUST.Error("confirm outside batch %v error:%v", batch.BatchId, err)
+			}
+			continue
+		}
+		bumpOutsideBatch(batch)
+	}
+}
+
+func confirmOutsideBatch(batch *custodyModels.PayOutsideBatch) error {
+	tx, back := middleware.GetTx()
+	defer back()
+
+	err := tx.Model(&custodyModels.PayOutside{}).
+		Where("batch_id = ? AND status = ?", batch.BatchId, custodyModels.PayOutsideStatusPaid).
+		Update("status", custodyModels.PayOutsideStatusSuccess).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&custodyModels.PayOutsideTx{}).
+		Where("tx_hash = ?", batch.TxHash).
+		Update("status", custodyModels.PayOutsideStatusTXSuccess).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(batch).Update("status", custodyModels.PayOutsideBatchStatusConfirmed).Error
+	if err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// bumpOutsideBatch raises the fee of a batch unconfirmed for longer than StuckAfterMinute by spending its
+// change output at the fastest mempool rate (CPFP). The anchor transaction itself can not be replaced by
+// fee (RBF): it commits to the asset proofs tapd already handed to the receivers, and tapd can not re-sign it.
+func bumpOutsideBatch(batch *custodyModels.PayOutsideBatch) {
+	cfg := config.GetConfig().OutsideMission
+	stuckAfter, bumpInterval, maxBumps, maxFeeRate := cfg.StuckAfterMinute, cfg.BumpIntervalMinute, cfg.MaxBumps, cfg.MaxFeeRate
+	if stuckAfter <= 0 {
+		stuckAfter = defaultOutsideStuckAfterMinute
+	}
+	if bumpInterval <= 0 {
+		bumpInterval = defaultOutsideBumpIntervalMinute
+	}
+	if maxBumps <= 0 {
+		maxBumps = defaultOutsideMaxBumps
+	}
+	if maxFeeRate <= 0 {
+		maxFeeRate = defaultOutsideMaxFeeRate
+	}
+
+	now := time.Now()
+	if batch.ChangeOutput < 0 || batch.BumpCount >= maxBumps {
+		return
+	}
+	if now.Sub(time.Unix(batch.BroadcastAt, 0)) < time.Duration(stuckAfter)*time.Minute {
+		return
+	}
+	if batch.LastBumpAt != 0 && now.Sub(time.Unix(batch.LastBumpAt, 0)) < time.Duration(bumpInterval)*time.Minute {
+		return
+	}
+
+	fees, err := api.MempoolGetRecommendedFees()
+	if err != nil {
+		btlLog.CUST.Error("api.MempoolGetRecommendedFees error:%v", err)
+		return
+	}
+	feeRate := fees.FastestFee
+	if feeRate > maxFeeRate {
+		feeRate = maxFeeRate
+	}
+
+	updates := map[string]any{
+		"bump_count":   batch.BumpCount + 1,
+		"last_bump_at": now.Unix(),
+		"last_error":   "",
+	}
+	err = rpc.BumpFee(batch.TxHash, uint32(batch.ChangeOutput), uint64(feeRate))
+	if err != nil {
+		btlLog.CUST.Error("rpc.BumpFee %v error:%v", batch.TxHash, err)
+		updates["last_error"] = err.Error()
+	} else {
+		btlLog.CUST.Info("outside batch %v bumped: tx=%v,feeRate=%v", batch.BatchId, batch.TxHash, feeRate)
+	}
+	err = middleware.DB.Model(batch).Updates(updates).Error
+	if err != nil {
+		btlLog.CUST.Error("update outside batch error:%v", err)
+	}
+}
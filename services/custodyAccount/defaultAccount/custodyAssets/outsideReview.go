@@ -0,0 +1,124 @@
+package custodyAssets
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"trade/btlLog"
+	"trade/middleware"
+	"trade/models/custodyModels"
+	"trade/services/btldb"
+	"trade/services/custodyAccount/custodyBase/custodyLimit"
+	"trade/services/custodyAccount/defaultAccount/custodyBalance"
+	"trade/services/custodyAccount/defaultAccount/custodyBtc"
+)
+
+// ListWithdrawalReviews returns the withdrawal reviews in status, newest first. A negative status lists all.
+func ListWithdrawalReviews(status int, pageNum int, pageSize int) ([]custodyModels.WithdrawalReview, int64, error) {
+	db := middleware.DB.Model(&custodyModels.WithdrawalReview{})
+	if status >= 0 {
+		db = db.Where("status = ?", status)
+	}
+	var count int64
+	err := db.Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var reviews []custodyModels.WithdrawalReview
+	err = db.Order("id desc").Offset((pageNum - 1) * pageSize).Limit(pageSize).Find(&reviews).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return reviews, count, nil
+}
+
+// closeWithdrawalReview moves a pending review to status and returns it.
+func closeWithdrawalReview(tx *gorm.DB, id uint, status custodyModels.WithdrawalReviewStatus, reviewer string, memo string) (*custodyModels.WithdrawalReview, error) {
+	result := tx.Model(&custodyModels.WithdrawalReview{}).
+		Where("id = ? AND status = ?", id, custodyModels.WithdrawalReviewStatusPending).
+		Updates(map[string]any{
+			"status":      status,
+			"reviewer":    reviewer,
+			"reviewed_at": time.Now().Unix(),
+			"memo":        memo,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("withdrawal review %d is not pending", id)
+	}
+	var review custodyModels.WithdrawalReview
+	err := tx.First(&review, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ApproveWithdrawalReview releases the withdrawal to the outside mission worker and bills it against the user's limits.
+// Btc withdrawals are claimed and sent here rather than by the asset worker.
+func ApproveWithdrawalReview(id uint, reviewer string, memo string) error {
+	tx, back := middleware.GetTx()
+	defer back()
+
+	review, err := closeWithdrawalReview(tx, id, custodyModels.WithdrawalReviewStatusApproved, reviewer, memo)
+	if err != nil {
+		return err
+	}
+	if review.AssetId == custodyBalance.BtcId {
+		err = custodyBtc.ClaimOutsideOnChain(tx, review.MissionId, custodyModels.PayOutsideStatusReview)
+		if err != nil {
+			return err
+		}
+	} else {
+		result := tx.Model(&custodyModels.PayOutside{}).
+			Where("id = ? AND status = ?", review.MissionId, custodyModels.PayOutsideStatusReview).
+			Updates(map[string]any{
+				"status":          custodyModels.PayOutsideStatusPending,
+				"next_attempt_at": 0,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("outside mission %d is not waiting for review", review.MissionId)
+		}
+	}
+	err = custodyLimit.MinusApprovedLimit(tx, review.UserId, review.LimitType, review.AssetId, review.Amount, review.AmountSat)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	btlLog.CUST.Info("withdrawal review %v approved by %v", id, reviewer)
+	if review.AssetId == custodyBalance.BtcId {
+		mission, err := btldb.ReadPayOutside(review.MissionId)
+		if err != nil {
+			return err
+		}
+		return custodyBtc.SendOutsideOnChain(mission)
+	}
+	return nil
+}
+
+// RejectWithdrawalReview cancels the withdrawal and refunds the user.
+func RejectWithdrawalReview(id uint, reviewer string, memo string) error {
+	tx, back := middleware.GetTx()
+	defer back()
+
+	review, err := closeWithdrawalReview(tx, id, custodyModels.WithdrawalReviewStatusRejected, reviewer, memo)
+	if err != nil {
+		return err
+	}
+	err = refundOutsideMission(tx, review.MissionId, "withdrawal review rejected: "+memo, custodyModels.PayOutsideStatusReview)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	btlLog.CUST.Info("withdrawal review %v rejected by %v", id, reviewer)
+	return nil
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"trade/btlLog"
 	"trade/middleware"
@@ -16,11 +16,15 @@ import (
 	cBase "trade/services/custodyAccount/custodyBase"
 	"trade/services/custodyAccount/custodyBase/control"
 	"trade/services/custodyAccount/custodyBase/custodyFee"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
 	"trade/services/custodyAccount/custodyBase/custodyLimit"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 	"trade/services/custodyAccount/custodyBase/custodyPayTN"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
 	rpc "trade/services/servicesrpc"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 )
 
@@ -181,12 +185,17 @@ func (e *BtcChannelEvent) SendPayment(bt *BtcPacket) error {
 	}
 }
 
-func (e *BtcChannelEvent) SendPaymentToUser(receiverUserName string, amount float64) error {
+// SendPaymentToUser pays the user. The invoice must be a signed, unexpired and unpaid v2 pay to npub key
+// invoice for exactly this payment, see custodyPayTN.VerifyPayment.
+func (e *BtcChannelEvent) SendPaymentToUser(receiverUserName string, amount float64, invoice string) error {
 	if !control.GetTransferControl("00", control.TransferControlLocal) {
 		return errors.New("当前服务调用失败，请稍后再试")
 	}
 
-	var err error
+	ptn, err := custodyPayTN.VerifyPayment(invoice, e.UserInfo.User.Username, receiverUserName, amount, custodyBalance.BtcId, time.Now().Unix())
+	if err != nil {
+		return err
+	}
 	receiver, err := caccount.GetUserInfo(receiverUserName)
 	if err != nil {
 		btlLog.CUST.Warning("%s,UserName:%s", err.Error(), receiverUserName)
@@ -220,7 +229,7 @@ func (e *BtcChannelEvent) SendPaymentToUser(receiverUserName string, amount floa
 		State:      custodyModels.AIMStatePending,
 	}
 	LogAIM(middleware.DB, &m)
-	err = RunInsidePTNStep(e.UserInfo, receiver, &m)
+	err = RunInsidePTNStep(e.UserInfo, receiver, &m, ptn, invoice)
 	if err != nil {
 		return err
 	}
@@ -252,7 +261,7 @@ func (e *BtcChannelEvent) payToOutside(bt *BtcPacket) {
 	balanceModel.AccountId = e.UserInfo.Account.ID
 	balanceModel.BillType = models.BillTypePayment
 	balanceModel.Away = models.AWAY_OUT
-	balanceModel.Amount = float64(bt.DecodePayReq.NumSatoshis)
+	balanceModel.Amount = custodyModels.NewAmountFromInt(bt.DecodePayReq.NumSatoshis)
 	balanceModel.Unit = models.UNIT_SATOSHIS
 	balanceModel.Invoice = &bt.PayReq
 	balanceModel.PaymentHash = &bt.DecodePayReq.PaymentHash
@@ -283,44 +292,293 @@ func (e *BtcChannelEvent) payToOutside(bt *BtcPacket) {
 	bt.err <- err
 }
 
-var payToOutSideMutex = new(sync.Mutex)
+// payToOutsideLockKey is the custody lock serializing on chain btc withdrawals, they share the node wallet.
+const payToOutsideLockKey = "custody_btc_outside_onchain"
 
-func (e *BtcChannelEvent) PayToOutsideOnChain(address string, amount float64) error {
-	payToOutSideMutex.Lock()
-	defer payToOutSideMutex.Unlock()
+// outsideOnChainLease is how long a claimed btc mission may take to be sent. The send gives up at half the
+// lease, so RecoverOutsideOnChain never judges a mission lnd is still sending.
+const outsideOnChainLease = 10 * time.Minute
+
+// outsideOnChainLabel labels the wallet transaction of a btc mission, so a send whose outcome was lost can
+// be found in lnd's transactions.
+func outsideOnChainLabel(missionId uint) string {
+	return "custody_outside_" + strconv.FormatUint(uint64(missionId), 10)
+}
 
+// PayToOutsideOnChain debits the withdrawal into an outside mission and bills the limits in one tx, then
+// sends the mission with SendOutsideOnChain. A send that fails leaves the mission Failed for an admin to
+// retry or cancel. Over limit withdrawals wait for review instead and are billed once they are approved.
+func (e *BtcChannelEvent) PayToOutsideOnChain(address string, amount float64) error {
 	if !verifyBtcAddress(address) {
 		return fmt.Errorf("%s is not a valid btc address", address)
 	}
 
 	endAmount := amount + 2500
 
+	serverBalance, err := rpc.GetBalance()
+	if err != nil {
+		return fmt.Errorf("get server balance error:%s", err.Error())
+	}
+	if serverBalance.AccountBalance["default"].ConfirmedBalance-10000 < int64(endAmount) {
+		return fmt.Errorf("no enough server balance")
+	}
+
+	tx, back := middleware.GetTx()
+	defer back()
+	err = custodyLimit.LockLimit(tx, e.UserInfo)
+	if err != nil {
+		return err
+	}
 	limitType := custodyModels.LimitType{
 		AssetId:      "00",
 		TransferType: custodyModels.LimitTransferTypeOutside,
 	}
-	err := custodyLimit.CheckLimit(middleware.DB, e.UserInfo, &limitType, endAmount)
+	decision, err := custodyLimit.EvaluateLimit(tx, e.UserInfo, &limitType, endAmount)
 	if err != nil {
 		return err
 	}
-	if !custodyBalance.CheckBtcBalance(middleware.DB, e.UserInfo, float64(endAmount)) {
+	if !custodyBalance.CheckBtcBalance(tx, e.UserInfo, float64(endAmount)) {
 		return NotSufficientFunds
 	}
-	serverBalance, err := rpc.GetBalance()
+	if decision.Review != nil {
+		// Withdrawals waiting for review are counted against the limits once they are approved.
+		outside, err := e.createOutsideOnChain(tx, address, amount, endAmount-amount, custodyModels.PayOutsideStatusReview)
+		if err != nil {
+			return err
+		}
+		err = custodyLimit.CreateWithdrawalReview(tx, e.UserInfo, outside, decision)
+		if err != nil {
+			return err
+		}
+		return tx.Commit().Error
+	}
+	err = custodyLimit.MinusLimit(tx, e.UserInfo, &limitType, endAmount)
 	if err != nil {
-		return fmt.Errorf("get server balance error:%s", err.Error())
+		return err
 	}
-	if serverBalance.AccountBalance["default"].ConfirmedBalance-10000 < int64(endAmount) {
-		return fmt.Errorf("no enough server balance")
+	outside, err := e.createOutsideOnChain(tx, address, amount, endAmount-amount, custodyModels.PayOutsideStatusPending)
+	if err != nil {
+		return err
 	}
-	err = payBtcOnchain(e.UserInfo, address, amount)
+	err = ClaimOutsideOnChain(tx, outside.ID, custodyModels.PayOutsideStatusPending)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	return SendOutsideOnChain(outside)
+}
+
+// createOutsideOnChain debits a withdrawal into an outside mission in missionStatus.
+func (e *BtcChannelEvent) createOutsideOnChain(tx *gorm.DB, address string, amount float64, fee float64, missionStatus custodyModels.PayOutsideStatus) (*custodyModels.PayOutside, error) {
+	outsideBalance := models.Balance{
+		AccountId: e.UserInfo.Account.ID,
+		BillType:  models.BillTypePayment,
+		Away:      models.AWAY_OUT,
+		Amount:    custodyModels.NewAmountFromFloat64(amount),
+		Unit:      models.UNIT_SATOSHIS,
+		ServerFee: custodyModels.NewAmountFromFloat64(fee),
+		Invoice:   &address,
+		State:     models.STATE_UNKNOW,
+	}
+	err := btldb.CreateBalance(tx, &outsideBalance)
+	if err != nil {
+		return nil, err
+	}
+	_, err = custodyBalance.LessBtcBalance(tx, e.UserInfo, amount, outsideBalance.ID, custodyModels.ChangeTypeBtcPayOnchain)
+	if err != nil {
+		return nil, err
+	}
+	err = custodyBalance.PayFee(tx, e.UserInfo, fee, outsideBalance.ID, &address, nil)
+	if err != nil {
+		return nil, err
+	}
+	reference := custodyJournal.Reference("bill_balance", outsideBalance.ID)
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationOutsidePayment, reference,
+		"00", custodyJournal.UserAccount(e.UserInfo.Account.ID), custodyJournal.ExternalAccount, amount)
+	if err != nil {
+		return nil, err
+	}
+	err = custodyJournal.PayFee(tx, reference, e.UserInfo.Account.ID, fee)
+	if err != nil {
+		return nil, err
+	}
+	outside := custodyModels.PayOutside{
+		AccountID: e.UserInfo.Account.ID,
+		AssetId:   "00",
+		Address:   address,
+		Amount:    amount,
+		BalanceId: outsideBalance.ID,
+		Status:    missionStatus,
+	}
+	err = tx.Create(&outside).Error
+	if err != nil {
+		return nil, err
+	}
+	return &outside, nil
+}
+
+// ClaimOutsideOnChain moves a btc mission in one of the statuses into Sending under its label and lease.
+// Send it with SendOutsideOnChain once tx commits.
+func ClaimOutsideOnChain(tx *gorm.DB, id uint, statuses ...custodyModels.PayOutsideStatus) error {
+	result := tx.Model(&custodyModels.PayOutside{}).
+		Where("id = ? AND asset_id = ? AND status IN ?", id, custodyBalance.BtcId, statuses).
+		Updates(map[string]any{
+			"status":           custodyModels.PayOutsideStatusSending,
+			"batch_id":         outsideOnChainLabel(id),
+			"lease_expires_at": time.Now().Add(outsideOnChainLease).Unix(),
+			"next_attempt_at":  0,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("outside mission %d can not be sent", id)
+	}
+	return nil
+}
+
+// SendOutsideOnChain sends a btc mission claimed into Sending. A send lnd may still finish, or whose outcome
+// can not be looked up, leaves the mission in Sending for RecoverOutsideOnChain.
+func SendOutsideOnChain(mission *custodyModels.PayOutside) error {
+	lock, err := custodyMutex.Obtain(payToOutsideLockKey)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	best, err := rpc.Getbestblock()
 	if err != nil {
-		btlLog.CUST.Error(err.Error())
 		return err
 	}
+	// Renewing the lease fails when recovery has already judged the mission, it must not be sent then.
+	result := middleware.DB.Model(&custodyModels.PayOutside{}).
+		Where("id = ? AND status = ?", mission.ID, custodyModels.PayOutsideStatusSending).
+		Updates(map[string]any{
+			"height_hint":      best.BlockHeight,
+			"lease_expires_at": time.Now().Add(outsideOnChainLease).Unix(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("outside mission %d is not sending", mission.ID)
+	}
+	mission.HeightHint = best.BlockHeight
+
+	label := outsideOnChainLabel(mission.ID)
+	txId, err := rpc.SendCoinsWithLabel(mission.Address, int64(mission.Amount), 0, label, outsideOnChainLease/2)
+	if err != nil {
+		btlLog.CUST.Error("SendOutsideOnChain mission %v error:%v", mission.ID, err)
+		if status.Code(err) == codes.DeadlineExceeded {
+			// lnd may still finish the send after we stopped waiting, leave it to recovery.
+			return err
+		}
+		// The send may have reached lnd before the error, in which case the wallet has the labelled transaction.
+		var findErr error
+		txId, findErr = rpc.FindTransactionByLabel(label, mission.HeightHint)
+		if findErr != nil {
+			btlLog.CUST.Error("rpc.FindTransactionByLabel error:%v", findErr)
+			return err
+		}
+		if txId == "" {
+			failOutsideOnChain(mission, err)
+			return err
+		}
+	}
+	err = settleOutsideOnChain(mission, txId)
+	if err != nil {
+		btlLog.CUST.Error("outside mission %v sent in %v, update error:%v", mission.ID, txId, err)
+	}
 	return nil
 }
 
+// RecoverOutsideOnChain settles the btc missions whose lease expired in Sending. A mission the wallet has a
+// labelled transaction for was sent, any other is failed.
+func RecoverOutsideOnChain() {
+	lock, err := custodyMutex.Obtain(payToOutsideLockKey)
+	if err != nil {
+		btlLog.CUST.Error("obtain btc outside lock error:%v", err)
+		return
+	}
+	defer lock.Unlock()
+
+	var missions []custodyModels.PayOutside
+	err = middleware.DB.Where("asset_id = ? AND status = ? AND lease_expires_at < ?",
+		custodyBalance.BtcId, custodyModels.PayOutsideStatusSending, time.Now().Unix()).
+		Find(&missions).Error
+	if err != nil {
+		btlLog.CUST.Error("load expired btc outside missions error:%v", err)
+		return
+	}
+	for index := range missions {
+		mission := &missions[index]
+		txId, err := rpc.FindTransactionByLabel(outsideOnChainLabel(mission.ID), mission.HeightHint)
+		if err != nil {
+			btlLog.CUST.Error("rpc.FindTransactionByLabel error:%v", err)
+			continue
+		}
+		if txId == "" {
+			failOutsideOnChain(mission, errors.New("lease expired before the mission was sent"))
+			continue
+		}
+		err = settleOutsideOnChain(mission, txId)
+		if err != nil {
+			btlLog.CUST.Error("outside mission %v sent in %v, update error:%v", mission.ID, txId, err)
+		}
+	}
+}
+
+// settleOutsideOnChain records the wallet transaction of a sent mission and completes its bill.
+func settleOutsideOnChain(mission *custodyModels.PayOutside, txId string) error {
+	tx, back := middleware.GetTx()
+	defer back()
+
+	result := tx.Model(&custodyModels.PayOutside{}).
+		Where("id = ? AND status = ?", mission.ID, custodyModels.PayOutsideStatusSending).
+		Updates(map[string]any{
+			"status":           custodyModels.PayOutsideStatusSuccess,
+			"tx_hash":          txId,
+			"lease_expires_at": 0,
+			"last_error":       "",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("outside mission %d is not sending", mission.ID)
+	}
+	err := tx.Model(&models.Balance{}).Where("id = ?", mission.BalanceId).
+		Updates(map[string]any{
+			"state":        models.STATE_SUCCESS,
+			"payment_hash": txId,
+		}).Error
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	mission.Status = custodyModels.PayOutsideStatusSuccess
+	mission.TxHash = txId
+	return nil
+}
+
+// failOutsideOnChain leaves a mission lnd did not send Failed, for an admin to retry or cancel.
+func failOutsideOnChain(mission *custodyModels.PayOutside, cause error) {
+	err := middleware.DB.Model(&custodyModels.PayOutside{}).
+		Where("id = ? AND status = ?", mission.ID, custodyModels.PayOutsideStatusSending).
+		Updates(map[string]any{
+			"status":           custodyModels.PayOutsideStatusFailed,
+			"last_error":       cause.Error(),
+			"lease_expires_at": 0,
+		}).Error
+	if err != nil {
+		btlLog.CUST.Error("mark outside mission %v failed error:%v", mission.ID, err)
+	}
+}
+
 func (e *BtcChannelEvent) GetTransactionHistory(query *cBase.PaymentRequest) (*cBase.PaymentList, error) {
 
 	if query.Page <= 0 {
@@ -389,11 +647,11 @@ func (e *BtcChannelEvent) GetTransactionHistory(query *cBase.PaymentRequest) (*c
 			} else {
 				r.PaymentHash = &empty
 			}
-			r.Amount = v.Amount
+			r.Amount = v.Amount.InexactFloat64()
 			btcAssetId := "00"
 			r.AssetId = &btcAssetId
 			r.State = v.State
-			r.Fee = uint64(v.ServerFee)
+			r.Fee = uint64(v.ServerFee.IntPart())
 			results.PaymentList = append(results.PaymentList, r)
 		}
 	}
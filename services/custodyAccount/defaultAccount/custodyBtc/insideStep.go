@@ -10,6 +10,7 @@ import (
 	"trade/models"
 	"trade/models/custodyModels"
 	"trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
 	"trade/services/custodyAccount/custodyBase/custodyLimit"
 	"trade/services/custodyAccount/custodyBase/custodyPayTN"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
@@ -58,7 +59,8 @@ func RunInsideStep(usr *account.UserInfo, mission *custodyModels.AccountInsideMi
 
 }
 
-func RunInsidePTNStep(usr *account.UserInfo, receiveUsr *account.UserInfo, mission *custodyModels.AccountInsideMission) error {
+// RunInsidePTNStep runs a pay to npub key mission. A non nil paid is the signed invoice the mission settles.
+func RunInsidePTNStep(usr *account.UserInfo, receiveUsr *account.UserInfo, mission *custodyModels.AccountInsideMission, paid *custodyPayTN.PayToNpubKey, paidInvoice string) error {
 	db := middleware.DB
 
 	if usr == nil {
@@ -90,8 +92,10 @@ func RunInsidePTNStep(usr *account.UserInfo, receiveUsr *account.UserInfo, missi
 	h, _ := custodyPayTN.HashEncodedString(invoice)
 
 	i := invoiceInfo{
-		Invoice: invoice,
-		Hash:    h,
+		Invoice:     invoice,
+		Hash:        h,
+		Paid:        paid,
+		PaidInvoice: paidInvoice,
 	}
 
 	for {
@@ -115,6 +119,16 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 		tx, back := middleware.GetTx()
 		defer back()
 
+		if i.Paid != nil {
+			err = custodyPayTN.MarkPaid(tx, i.Paid, usr.Account.ID, i.PaidInvoice)
+			if err != nil {
+				btlLog.CUST.Error("MarkPaid error:%s", err)
+				mission.Error = err.Error()
+				mission.State = custodyModels.AIMStateDone
+				return
+			}
+		}
+
 		balance := getBillBalanceModel(usr, mission.Amount, models.AWAY_OUT, i)
 		if err = tx.Create(balance).Error; err != nil {
 			btlLog.CUST.Error("CreateBillBalance error:%s", err)
@@ -139,7 +153,18 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 			mission.State = custodyModels.AIMStateDone
 			return
 		}
-		balance.ServerFee = mission.Fee
+		err = custodyJournal.Transfer(tx, custodyModels.JournalOperationInsideTransfer, custodyJournal.Reference("inside_mission", mission.ID),
+			"00", custodyJournal.UserAccount(usr.Account.ID), custodyJournal.TransitAccount, mission.Amount)
+		if err == nil {
+			err = custodyJournal.PayFee(tx, custodyJournal.Reference("inside_mission", mission.ID), usr.Account.ID, mission.Fee)
+		}
+		if err != nil {
+			btlLog.CUST.Error("PostJournal error:%s", err)
+			mission.Error = err.Error()
+			mission.State = custodyModels.AIMStateDone
+			return
+		}
+		balance.ServerFee = custodyModels.NewAmountFromFloat64(mission.Fee)
 
 		err = tx.Model(&models.Invoice{}).
 			Where("id =?", mission.InvoiceId).
@@ -219,6 +244,14 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 			mission.Error = err.Error()
 			return
 		}
+		err = custodyJournal.Transfer(tx, custodyModels.JournalOperationInsideTransfer, custodyJournal.Reference("inside_mission", mission.ID),
+			"00", custodyJournal.TransitAccount, custodyJournal.UserAccount(rusr.Account.ID), mission.Amount)
+		if err != nil {
+			btlLog.CUST.Error("PostJournal error:%s", err)
+			mission.Retries += 1
+			mission.Error = err.Error()
+			return
+		}
 		mission.State = custodyModels.AIMStateSuccess
 		tx.Commit()
 		return
@@ -229,12 +262,15 @@ func InsideSteps(usr *account.UserInfo, mission *custodyModels.AccountInsideMiss
 type invoiceInfo struct {
 	Invoice string
 	Hash    string
+	// Paid is marked paid in the tx that debits the payer.
+	Paid        *custodyPayTN.PayToNpubKey
+	PaidInvoice string
 }
 
 func getBillBalanceModel(usr *account.UserInfo, amount float64, away models.BalanceAway, invoice invoiceInfo) *models.Balance {
 	ba := models.Balance{}
 	ba.AccountId = usr.Account.ID
-	ba.Amount = amount
+	ba.Amount = custodyModels.NewAmountFromFloat64(amount)
 	ba.Unit = models.UNIT_SATOSHIS
 	ba.BillType = models.BillTypePayment
 	ba.Away = away
@@ -12,6 +12,7 @@ import (
 	"trade/models/custodyModels"
 	"trade/services/custodyAccount/account"
 	"trade/services/custodyAccount/custodyBase/custodyFee"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
 	"trade/services/custodyAccount/custodyBase/custodyLimit"
 	"trade/services/custodyAccount/custodyBase/custodyRpc"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
@@ -36,7 +37,7 @@ func RunOutsideSteps(usr *account.UserInfo, mission *custodyModels.AccountOutsid
 		case mission.State == custodyModels.AOMStateSuccess:
 			db.Model(&models.Balance{}).
 				Where("id = ?", mission.BalanceId).
-				Updates(models.Balance{ServerFee: mission.Fee, State: models.STATE_SUCCESS})
+				Updates(models.Balance{ServerFee: custodyModels.NewAmountFromFloat64(mission.Fee), State: models.STATE_SUCCESS})
 
 			limitType := custodyModels.LimitType{
 				AssetId:      "00",
@@ -66,6 +67,14 @@ func OutsideSteps(usr *account.UserInfo, mission *custodyModels.AccountOutsideMi
 			mission.Error = err.Error()
 			return
 		}
+		err = custodyJournal.Transfer(tx, custodyModels.JournalOperationOutsidePayment, custodyJournal.Reference("outside_mission", mission.ID),
+			"00", custodyJournal.UserAccount(usr.Account.ID), custodyJournal.ExternalAccount, mission.Amount)
+		if err != nil {
+			btlLog.CUST.Error("PostJournal error:%s", err)
+			mission.State = custodyModels.AOMStateDone
+			mission.Error = err.Error()
+			return
+		}
 		payment, err := custodyRpc.PayBtcInvoice(usr, mission.Target, int64(mission.Amount), int64(mission.FeeLimit))
 		if err != nil || payment.Status != lnrpc.Payment_SUCCEEDED {
 			if err == nil {
@@ -85,11 +94,33 @@ func OutsideSteps(usr *account.UserInfo, mission *custodyModels.AccountOutsideMi
 		return
 
 	case custodyModels.AOMStateNotPayFee:
-		db := middleware.DB
+		tx, back := middleware.GetTx()
+		defer back()
+		routingFee := mission.Fee
 		mission.Fee += float64(custodyFee.ChannelBtcServiceFee)
-		err := custodyBalance.PayFee(db, usr, mission.Fee, mission.BalanceId, &mission.Target, &mission.Hash)
+		err := custodyBalance.PayFee(tx, usr, mission.Fee, mission.BalanceId, &mission.Target, &mission.Hash)
+		if err != nil {
+			btlLog.CUST.Error("PayBtcFeeError:%s", err)
+			mission.Fee = routingFee
+			mission.Retries += 1
+			return
+		}
+		// The routing fee left custody with the payment, only the service fee is custody's.
+		reference := custodyJournal.Reference("outside_mission", mission.ID)
+		err = custodyJournal.Transfer(tx, custodyModels.JournalOperationFee, reference,
+			"00", custodyJournal.UserAccount(usr.Account.ID), custodyJournal.ExternalAccount, routingFee)
+		if err == nil {
+			err = custodyJournal.PayFee(tx, reference, usr.Account.ID, float64(custodyFee.ChannelBtcServiceFee))
+		}
 		if err != nil {
+			btlLog.CUST.Error("PostJournal error:%s", err)
+			mission.Fee = routingFee
+			mission.Retries += 1
+			return
+		}
+		if err = tx.Commit().Error; err != nil {
 			btlLog.CUST.Error("PayBtcFeeError:%s", err)
+			mission.Fee = routingFee
 			mission.Retries += 1
 			return
 		}
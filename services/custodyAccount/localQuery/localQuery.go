@@ -147,8 +147,8 @@ func BillQuery(quest BillQueryQuest) (*[]BillListWithUser, int64, error) {
 			UserName:    bill.UserName,
 			BillType:    bill.BillType,
 			Away:        bill.Away,
-			Amount:      bill.Amount,
-			ServerFee:   uint64(bill.ServerFee),
+			Amount:      bill.Amount.InexactFloat64(),
+			ServerFee:   uint64(bill.ServerFee.IntPart()),
 			AssetId:     bill.AssetId,
 			Invoice:     bill.Invoice,
 			PaymentHash: bill.PaymentHash,
@@ -284,7 +284,7 @@ func BalanceQuery(quest BalanceQueryQuest) *[]BalanceQueryResp {
 			balances = append(balances, BalanceQueryResp{
 				AccountName: DefaultAccount,
 				AssetId:     "00",
-				Balance:     btcBalance.Amount,
+				Balance:     btcBalance.Amount.InexactFloat64(),
 			})
 		}
 		var accountBalances []custodyModels.AccountBalance
@@ -294,7 +294,7 @@ func BalanceQuery(quest BalanceQueryQuest) *[]BalanceQueryResp {
 				balances = append(balances, BalanceQueryResp{
 					AccountName: DefaultAccount,
 					AssetId:     balance.AssetId,
-					Balance:     balance.Amount,
+					Balance:     balance.Amount.InexactFloat64(),
 				})
 			}
 		}
@@ -312,7 +312,7 @@ func BalanceQuery(quest BalanceQueryQuest) *[]BalanceQueryResp {
 				balances = append(balances, BalanceQueryResp{
 					AccountName: LockedAccount,
 					AssetId:     balance.AssetId,
-					Balance:     balance.Amount,
+					Balance:     balance.Amount.InexactFloat64(),
 				})
 			}
 		}
@@ -495,13 +495,13 @@ type LockedBillsQueryQuest struct {
 }
 
 type LockedBillsQueryResp struct {
-	ID       uint      `gorm:"primarykey" json:"id"`
-	UserName string    `gorm:"column:user_name" json:"username"`
-	Amount   float64   `gorm:"column:amount;type:decimal(25,2)" json:"amount"`
-	AssetId  *string   `gorm:"column:asset_id;type:varchar(512);default:'00'" json:"assetId"`
-	LockedId *string   `gorm:"column:lockId;type:varchar(512)" json:"LockedId"`
-	Time     time.Time `gorm:"column:created_at" json:"time"`
-	Type     string    `gorm:"column:type" json:"type"`
+	ID       uint                 `gorm:"primarykey" json:"id"`
+	UserName string               `gorm:"column:user_name" json:"username"`
+	Amount   custodyModels.Amount `gorm:"column:amount;type:decimal(38,0)" json:"amount"`
+	AssetId  *string              `gorm:"column:asset_id;type:varchar(512);default:'00'" json:"assetId"`
+	LockedId *string              `gorm:"column:lockId;type:varchar(512)" json:"LockedId"`
+	Time     time.Time            `gorm:"column:created_at" json:"time"`
+	Type     string               `gorm:"column:type" json:"type"`
 }
 
 func LockedBillsQuery(quest LockedBillsQueryQuest) (*[]LockedBillsQueryResp, int64, error) {
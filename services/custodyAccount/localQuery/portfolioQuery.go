@@ -0,0 +1,72 @@
+package localQuery
+
+import (
+	"github.com/shopspring/decimal"
+	"trade/services/pool"
+)
+
+type PortfolioAssetValue struct {
+	AccountName string          `json:"accountName"`
+	AssetId     string          `json:"assetId"`
+	Balance     float64         `json:"balance"`
+	PriceSat    decimal.Decimal `json:"priceSat"`
+	ValueSat    decimal.Decimal `json:"valueSat"`
+	Priced      bool            `json:"priced"`
+}
+
+type PortfolioValuation struct {
+	UserName string                `json:"username"`
+	Window   int64                 `json:"window"`
+	TotalSat decimal.Decimal       `json:"totalSat"`
+	Assets   []PortfolioAssetValue `json:"assets"`
+}
+
+// ValuePortfolioInSats values every custody balance of the user at the pool TWAP over the last window seconds.
+// Assets without a sat pool or without enough price history are listed unpriced and left out of the total.
+func ValuePortfolioInSats(username string, window int64) (*PortfolioValuation, error) {
+	if window <= 0 {
+		window = pool.DefaultTwapWindowSecond
+	}
+	valuation := PortfolioValuation{
+		UserName: username,
+		Window:   window,
+		TotalSat: decimal.Zero,
+		Assets:   []PortfolioAssetValue{},
+	}
+	prices := make(map[string]decimal.Decimal)
+	unpriced := make(map[string]bool)
+
+	balances := BalanceQuery(BalanceQueryQuest{UserName: username})
+	for _, balance := range *balances {
+		value := PortfolioAssetValue{
+			AccountName: balance.AccountName,
+			AssetId:     balance.AssetId,
+			Balance:     balance.Balance,
+			PriceSat:    decimal.Zero,
+			ValueSat:    decimal.Zero,
+		}
+		token := balance.AssetId
+		if token == "00" {
+			token = pool.TokenSatTag
+		}
+		price, ok := prices[token]
+		if !ok && !unpriced[token] {
+			var err error
+			price, err = pool.QueryTokenSatTwap(token, window)
+			if err != nil {
+				unpriced[token] = true
+			} else {
+				prices[token] = price
+				ok = true
+			}
+		}
+		if ok {
+			value.Priced = true
+			value.PriceSat = price
+			value.ValueSat = decimal.NewFromFloat(balance.Balance).Mul(price).Floor()
+			valuation.TotalSat = valuation.TotalSat.Add(value.ValueSat)
+		}
+		valuation.Assets = append(valuation.Assets, value)
+	}
+	return &valuation, nil
+}
@@ -4,47 +4,54 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
 	cModels "trade/models/custodyModels"
 	caccount "trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
 )
 
-func GetAssetBalance(usr *caccount.UserInfo, assetId string) (err error, unlock float64, locked float64, tag1 float64) {
+func GetAssetBalance(usr *caccount.UserInfo, assetId string) (err error, unlock decimal.Decimal, locked decimal.Decimal, tag1 decimal.Decimal) {
 	db := middleware.DB
 	lockedBalance := cModels.LockBalance{}
 	if err = db.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, assetId).First(&lockedBalance).Error; err != nil {
 		if !errors.Is(err, gorm.ErrRecordNotFound) {
 			btlLog.CUST.Error(err.Error())
-			return ServiceError, 0, 0, 0
+			return ServiceError, decimal.Zero, decimal.Zero, decimal.Zero
 		}
-		locked = 0
+		locked = decimal.Zero
 		err = nil
 	}
-	locked = lockedBalance.Amount
-	tag1 = lockedBalance.Tag1
+	locked = lockedBalance.Amount.Decimal
+	tag1 = lockedBalance.Tag1.Decimal
 
 	assetBalance := cModels.AccountBalance{}
 	if err = db.Where("account_id =? AND asset_id =?", usr.Account.ID, assetId).First(&assetBalance).Error; err != nil {
 		if !errors.Is(err, gorm.ErrRecordNotFound) {
 			btlLog.CUST.Error(err.Error())
-			return ServiceError, 0, 0, 0
+			return ServiceError, decimal.Zero, decimal.Zero, decimal.Zero
 		}
-		unlock = 0
+		unlock = decimal.Zero
 		err = nil
 	}
-	unlock = assetBalance.Amount
+	unlock = assetBalance.Amount.Decimal
 	return
 }
 
-func LockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount float64, tag int) error {
+func LockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount decimal.Decimal, tag int, locks ...custodyMutex.Lock) error {
 
 	tx := middleware.DB.Begin()
 	defer tx.Rollback()
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	lockedBalance := cModels.LockBalance{}
 	if err = tx.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, assetId).First(&lockedBalance).Error; err != nil {
@@ -55,13 +62,13 @@ func LockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount f
 
 		lockedBalance.AssetId = assetId
 		lockedBalance.AccountID = usr.LockAccount.ID
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
-	lockedBalance.Amount += amount
+	lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Add(amount))
 	switch tag {
 	case 0:
 	case 1:
-		lockedBalance.Tag1 += amount
+		lockedBalance.Tag1 = cModels.NewAmount(lockedBalance.Tag1.Add(amount))
 	default:
 		return fmt.Errorf("invalid tag")
 	}
@@ -73,7 +80,7 @@ func LockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount f
 	lockBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   assetId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeLock,
 	}
@@ -93,9 +100,9 @@ func LockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount f
 		AccountId:   usr.Account.ID,
 		BillType:    models.BiLLTypeLock,
 		Away:        models.AWAY_OUT,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_ASSET_NORMAL,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &assetId,
 		Invoice:     &Invoice,
 		PaymentHash: &lockedId,
@@ -108,18 +115,40 @@ func LockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount f
 		btlLog.CUST.Error(err.Error())
 		return ServiceError
 	}
-	_, err = custodyBalance.LessAssetBalance(tx, usr, balanceBill.Amount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeLock)
+	_, err = custodyBalance.LessAssetBalance(tx, usr, billAmount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeLock)
 	if err != nil {
 		return err
 	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationLock, custodyJournal.Reference("lock", lockedId),
+		assetId, custodyJournal.UserAccount(usr.Account.ID), custodyJournal.LockAccount(usr.LockAccount.ID), billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	tx.Commit()
 	return nil
 }
 
-func UnlockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount float64, tag int) error {
+func UnlockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount decimal.Decimal, tag int, locks ...custodyMutex.Lock) error {
 	tx := middleware.DB.Begin()
 	defer tx.Rollback()
+	if err := unlockAsset(tx, usr, lockedId, assetId, amount, tag, locks...); err != nil {
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+func unlockAsset(tx *gorm.DB, usr *caccount.UserInfo, lockedId string, assetId string, amount decimal.Decimal, tag int, locks ...custodyMutex.Lock) error {
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	lockedBalance := cModels.LockBalance{}
 	if err = tx.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, assetId).First(&lockedBalance).Error; err != nil {
@@ -127,25 +156,25 @@ func UnlockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount
 			btlLog.CUST.Error(err.Error())
 			return ServiceError
 		}
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
 
 	if tag == 0 {
-		if lockedBalance.Amount < amount {
+		if lockedBalance.Amount.LessThan(amount) {
 			return NoEnoughBalance
 		}
-		if (lockedBalance.Amount - lockedBalance.Tag1) < amount {
-			return fmt.Errorf("%w,have  %f is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Amount.Sub(lockedBalance.Tag1.Decimal).LessThan(amount) {
+			return fmt.Errorf("%w,have  %s is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
 	} else if tag == 1 {
-		if lockedBalance.Tag1 < amount {
-			return fmt.Errorf("%w,have  %f ", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Tag1.LessThan(amount) {
+			return fmt.Errorf("%w,have  %s ", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
-		lockedBalance.Tag1 -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
+		lockedBalance.Tag1 = cModels.NewAmount(lockedBalance.Tag1.Sub(amount))
 	} else {
 		return fmt.Errorf("invalid tag")
 	}
@@ -158,7 +187,7 @@ func UnlockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount
 	unlockBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   assetId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeUnlock,
 	}
@@ -179,9 +208,9 @@ func UnlockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount
 		AccountId:   usr.Account.ID,
 		BillType:    models.BiLLTypeLock,
 		Away:        models.AWAY_IN,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_ASSET_NORMAL,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &assetId,
 		Invoice:     &Invoice,
 		PaymentHash: &lockedId,
@@ -195,19 +224,32 @@ func UnlockAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount
 		return ServiceError
 	}
 
-	_, err = custodyBalance.AddAssetBalance(tx, usr, balanceBill.Amount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeUnlock)
+	_, err = custodyBalance.AddAssetBalance(tx, usr, billAmount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeUnlock)
 	if err != nil {
 		return err
 	}
-	tx.Commit()
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationUnlock, custodyJournal.Reference("lock", lockedId),
+		assetId, custodyJournal.LockAccount(usr.LockAccount.ID), custodyJournal.UserAccount(usr.Account.ID), billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	return nil
 }
 
-func transferLockedAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount float64, toUser *caccount.UserInfo, tag int) error {
+func transferLockedAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount decimal.Decimal, toUser *caccount.UserInfo, tag int, locks ...custodyMutex.Lock) error {
 	tx := middleware.DB.Begin()
 	defer tx.Rollback()
 
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	lockedBalance := cModels.LockBalance{}
 	if err = tx.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, assetId).First(&lockedBalance).Error; err != nil {
@@ -215,24 +257,24 @@ func transferLockedAsset(usr *caccount.UserInfo, lockedId string, assetId string
 			btlLog.CUST.Error(err.Error())
 			return ServiceError
 		}
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
 	if tag == 0 {
-		if lockedBalance.Amount < amount {
+		if lockedBalance.Amount.LessThan(amount) {
 			return NoEnoughBalance
 		}
-		if (lockedBalance.Amount - lockedBalance.Tag1) < amount {
-			return fmt.Errorf("%w,have  %f is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Amount.Sub(lockedBalance.Tag1.Decimal).LessThan(amount) {
+			return fmt.Errorf("%w,have  %s is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
 	} else if tag == 1 {
-		if lockedBalance.Tag1 < amount {
-			return fmt.Errorf("%w,have  %f ", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Tag1.LessThan(amount) {
+			return fmt.Errorf("%w,have  %s ", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
-		lockedBalance.Tag1 -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
+		lockedBalance.Tag1 = cModels.NewAmount(lockedBalance.Tag1.Sub(amount))
 	} else {
 		return fmt.Errorf("invalid tag")
 	}
@@ -244,7 +286,7 @@ func transferLockedAsset(usr *caccount.UserInfo, lockedId string, assetId string
 	transferBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   assetId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeTransferByLockAsset,
 	}
@@ -265,7 +307,7 @@ func transferLockedAsset(usr *caccount.UserInfo, lockedId string, assetId string
 		PayAccType: cModels.LockBillExtPayAccTypeLock,
 		PayAccId:   usr.LockAccount.ID,
 		RevAccId:   toUser.Account.ID,
-		Amount:     amount,
+		Amount:     cModels.NewAmount(amount),
 		AssetId:    assetId,
 		Status:     cModels.LockBillExtStatusSuccess,
 	}
@@ -283,9 +325,9 @@ func transferLockedAsset(usr *caccount.UserInfo, lockedId string, assetId string
 		AccountId:   toUser.Account.ID,
 		BillType:    models.BillTypePendingOder,
 		Away:        models.AWAY_IN,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_ASSET_NORMAL,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &assetId,
 		Invoice:     &invoice,
 		PaymentHash: &lockedId,
@@ -299,26 +341,40 @@ func transferLockedAsset(usr *caccount.UserInfo, lockedId string, assetId string
 		return ServiceError
 	}
 
-	_, err = custodyBalance.AddAssetBalance(tx, toUser, balanceBill.Amount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeLockedTransfer)
+	_, err = custodyBalance.AddAssetBalance(tx, toUser, billAmount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeLockedTransfer)
 	if err != nil {
 		return err
 	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationLockedTransfer, custodyJournal.Reference("lock", lockedId),
+		assetId, custodyJournal.LockAccount(usr.LockAccount.ID), custodyJournal.UserAccount(toUser.Account.ID), billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	tx.Commit()
 	return nil
 }
 
-func transferAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount float64, toUser *caccount.UserInfo) error {
+func transferAsset(usr *caccount.UserInfo, lockedId string, assetId string, amount decimal.Decimal, toUser *caccount.UserInfo, locks ...custodyMutex.Lock) error {
 	tx := middleware.DB.Begin()
 	defer tx.Rollback()
 
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	transferBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		LockId:    lockedId,
 		AssetId:   assetId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		BillType:  cModels.LockBillTypeTransferByUnlockAsset,
 	}
 	if err = tx.Create(&transferBill).Error; err != nil {
@@ -338,7 +394,7 @@ func transferAsset(usr *caccount.UserInfo, lockedId string, assetId string, amou
 		PayAccType: cModels.LockBillExtPayAccTypeUnlock,
 		PayAccId:   usr.Account.ID,
 		RevAccId:   toUser.Account.ID,
-		Amount:     amount,
+		Amount:     cModels.NewAmount(amount),
 		AssetId:    assetId,
 		Status:     cModels.LockBillExtStatusInit,
 	}
@@ -362,9 +418,9 @@ func transferAsset(usr *caccount.UserInfo, lockedId string, assetId string, amou
 		AccountId:   usr.Account.ID,
 		BillType:    models.BillTypePendingOder,
 		Away:        models.AWAY_OUT,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_ASSET_NORMAL,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &assetId,
 		Invoice:     &payInvoice,
 		PaymentHash: &lockedId,
@@ -378,10 +434,20 @@ func transferAsset(usr *caccount.UserInfo, lockedId string, assetId string, amou
 		return ServiceError
 	}
 
-	_, err = custodyBalance.LessAssetBalance(tx, usr, balanceBill.Amount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeLockedTransfer)
+	_, err = custodyBalance.LessAssetBalance(tx, usr, billAmount, balanceBill.ID, *balanceBill.AssetId, cModels.ChangeTypeLockedTransfer)
 	if err != nil {
 		return err
 	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationLockedTransfer, custodyJournal.Reference("lock", lockedId),
+		assetId, custodyJournal.UserAccount(usr.Account.ID), custodyJournal.TransitAccount, billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	tx.Commit()
 
 	txRev := middleware.DB.Begin()
@@ -396,9 +462,9 @@ func transferAsset(usr *caccount.UserInfo, lockedId string, assetId string, amou
 		AccountId:   toUser.Account.ID,
 		BillType:    models.BillTypePendingOder,
 		Away:        models.AWAY_IN,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_ASSET_NORMAL,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &assetId,
 		Invoice:     &recInvoice,
 		PaymentHash: &lockedId,
@@ -418,10 +484,20 @@ func transferAsset(usr *caccount.UserInfo, lockedId string, assetId string, amou
 		return ServiceError
 	}
 
-	_, err = custodyBalance.AddAssetBalance(txRev, toUser, balanceBillRev.Amount, balanceBillRev.ID, *balanceBillRev.AssetId, cModels.ChangeTypeLockedTransfer)
+	_, err = custodyBalance.AddAssetBalance(txRev, toUser, billAmount, balanceBillRev.ID, *balanceBillRev.AssetId, cModels.ChangeTypeLockedTransfer)
 	if err != nil {
 		return err
 	}
+	err = custodyJournal.Transfer(txRev, cModels.JournalOperationLockedTransfer, custodyJournal.Reference("lock", lockedId),
+		assetId, custodyJournal.TransitAccount, custodyJournal.UserAccount(toUser.Account.ID), billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
+	if err = custodyMutex.Fence(txRev, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	txRev.Commit()
 	return nil
 }
@@ -4,12 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
 	cModels "trade/models/custodyModels"
 	caccount "trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
 )
 
@@ -20,14 +23,19 @@ var (
 	NoEnoughAward = fmt.Errorf("not enough award")
 )
 
-func PutInAwardLockBTC(usr *caccount.UserInfo, amount float64, memo *string, lockedId string) (*models.AccountAward, error) {
-	mutex := GetLockPaymentMutex(usr.User.ID)
-	mutex.Lock()
-	defer mutex.Unlock()
+func PutInAwardLockBTC(usr *caccount.UserInfo, amount decimal.Decimal, memo *string, lockedId string) (*models.AccountAward, error) {
+	lock, err := ObtainLockPaymentLock(usr.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
 
 	tx, back := middleware.GetTx()
 	defer back()
-	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return nil, err
+	}
 
 	lockedBalance := cModels.LockBalance{}
 	if err = tx.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, btcId).First(&lockedBalance).Error; err != nil {
@@ -39,9 +47,9 @@ func PutInAwardLockBTC(usr *caccount.UserInfo, amount float64, memo *string, loc
 
 		lockedBalance.AssetId = btcId
 		lockedBalance.AccountID = usr.LockAccount.ID
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
-	lockedBalance.Amount += amount
+	lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Add(amount))
 	if err = tx.Save(&lockedBalance).Error; err != nil {
 		tx.Rollback()
 		btlLog.CUST.Error(err.Error())
@@ -51,7 +59,7 @@ func PutInAwardLockBTC(usr *caccount.UserInfo, amount float64, memo *string, loc
 	lockBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   btcId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeAward,
 	}
@@ -69,7 +77,7 @@ func PutInAwardLockBTC(usr *caccount.UserInfo, amount float64, memo *string, loc
 	award := models.AccountAward{
 		AccountID: usr.Account.ID,
 		AssetId:   btcId,
-		Amount:    amount,
+		Amount:    billAmount,
 		Memo:      memo,
 	}
 	if err = tx.Create(&award).Error; err != nil {
@@ -111,7 +119,7 @@ func PutInAwardLockBTC(usr *caccount.UserInfo, amount float64, memo *string, loc
 	payAwardInvoice := "offerAward"
 	payba := models.Balance{}
 	payba.AccountId = adminUsr.Account.ID
-	payba.Amount = amount
+	payba.Amount = cModels.NewAmount(amount)
 	payba.Unit = models.UNIT_SATOSHIS
 	payba.BillType = models.BillTypeOfferAward
 	payba.Away = models.AWAY_OUT
@@ -133,25 +141,40 @@ func PutInAwardLockBTC(usr *caccount.UserInfo, amount float64, memo *string, loc
 		btlLog.CUST.Error(err.Error())
 		return nil, err
 	}
-	_, err = custodyBalance.LessBtcBalance(tx, adminUsr, payba.Amount, payba.ID, cModels.ChangeTypeOfferAward)
+	_, err = custodyBalance.LessBtcBalance(tx, adminUsr, billAmount, payba.ID, cModels.ChangeTypeOfferAward)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return nil, err
+	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationAward, custodyJournal.Reference("lock", lockedId),
+		btcId, custodyJournal.UserAccount(adminUsr.Account.ID), custodyJournal.LockAccount(usr.LockAccount.ID), billAmount)
 	if err != nil {
 		btlLog.CUST.Error(err.Error())
 		return nil, err
 	}
 
+	if err = custodyMutex.Fence(tx, lock); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return nil, err
+	}
 	tx.Commit()
 
 	return &award, nil
 }
 
-func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount float64, memo *string, lockedId string) (*models.AccountAward, error) {
-	mutex := GetLockPaymentMutex(usr.User.ID)
-	mutex.Lock()
-	defer mutex.Unlock()
+func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount decimal.Decimal, memo *string, lockedId string) (*models.AccountAward, error) {
+	lock, err := ObtainLockPaymentLock(usr.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
 
 	tx, back := middleware.GetTx()
 	defer back()
-	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return nil, err
+	}
 
 	var in models.AwardInventory
 	err = tx.Where("asset_Id =? ", assetId).First(&in).Error
@@ -165,7 +188,7 @@ func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount float64,
 	if in.Status != models.AwardInventoryAble {
 		return nil, AssetIdLock
 	}
-	if in.Amount < amount {
+	if in.Amount < billAmount {
 		return nil, NoEnoughAward
 	}
 
@@ -179,9 +202,9 @@ func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount float64,
 
 		lockedBalance.AssetId = assetId
 		lockedBalance.AccountID = usr.LockAccount.ID
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
-	lockedBalance.Amount += amount
+	lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Add(amount))
 	if err = tx.Save(&lockedBalance).Error; err != nil {
 		tx.Rollback()
 		btlLog.CUST.Error(err.Error())
@@ -191,7 +214,7 @@ func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount float64,
 	lockBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   assetId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeAward,
 	}
@@ -209,7 +232,7 @@ func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount float64,
 	award := models.AccountAward{
 		AccountID: usr.Account.ID,
 		AssetId:   assetId,
-		Amount:    amount,
+		Amount:    billAmount,
 		Memo:      memo,
 	}
 	if err = tx.Create(&award).Error; err != nil {
@@ -251,7 +274,7 @@ func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount float64,
 	payAwardInvoice := "offerAward"
 	payba := models.Balance{}
 	payba.AccountId = adminUsr.Account.ID
-	payba.Amount = amount
+	payba.Amount = cModels.NewAmount(amount)
 	payba.Unit = models.UNIT_ASSET_NORMAL
 	payba.BillType = models.BillTypeOfferAward
 	payba.Away = models.AWAY_OUT
@@ -273,11 +296,21 @@ func PutInAwardLockAsset(usr *caccount.UserInfo, assetId string, amount float64,
 		btlLog.CUST.Error(err.Error())
 		return nil, err
 	}
-	_, err = custodyBalance.LessAssetBalance(tx, adminUsr, payba.Amount, payba.ID, assetId, cModels.ChangeTypeOfferAward)
+	_, err = custodyBalance.LessAssetBalance(tx, adminUsr, billAmount, payba.ID, assetId, cModels.ChangeTypeOfferAward)
 	if err != nil {
 		btlLog.CUST.Error(err.Error())
 		return nil, err
 	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationAward, custodyJournal.Reference("lock", lockedId),
+		assetId, custodyJournal.UserAccount(adminUsr.Account.ID), custodyJournal.LockAccount(usr.LockAccount.ID), billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return nil, err
+	}
+	if err = custodyMutex.Fence(tx, lock); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return nil, err
+	}
 	tx.Commit()
 
 	return &award, nil
@@ -4,42 +4,49 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
 	cModels "trade/models/custodyModels"
 	caccount "trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
 	"trade/services/custodyAccount/defaultAccount/custodyBtc"
 )
 
-func GetBtcBalance(usr *caccount.UserInfo) (err error, unlock float64, locked, tag1 float64) {
+func GetBtcBalance(usr *caccount.UserInfo) (err error, unlock decimal.Decimal, locked, tag1 decimal.Decimal) {
 	db := middleware.DB
 	lockedBalance := cModels.LockBalance{}
 	if err = db.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, btcId).First(&lockedBalance).Error; err != nil {
 		if !errors.Is(err, gorm.ErrRecordNotFound) {
 			btlLog.CUST.Error(err.Error())
-			return ServiceError, 0, 0, 0
+			return ServiceError, decimal.Zero, decimal.Zero, decimal.Zero
 		}
-		locked = 0
+		locked = decimal.Zero
 	}
-	locked = lockedBalance.Amount
-	tag1 = lockedBalance.Tag1
+	locked = lockedBalance.Amount.Decimal
+	tag1 = lockedBalance.Tag1.Decimal
 	e, _ := custodyBtc.NewBtcChannelEvent(usr.User.Username)
 	balance, err := e.GetBalance()
 	if err != nil {
-		return err, 0, 0, 0
+		return err, decimal.Zero, decimal.Zero, decimal.Zero
 	}
-	unlock = float64(balance[0].Amount)
+	unlock = decimal.NewFromInt(balance[0].Amount)
 	return
 }
 
-func LockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int) error {
+func LockBTC(usr *caccount.UserInfo, lockedId string, amount decimal.Decimal, tag int, locks ...custodyMutex.Lock) error {
 	tx, back := middleware.GetTx()
 	defer back()
 
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	lockedBalance := cModels.LockBalance{}
 	if err = tx.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, btcId).First(&lockedBalance).Error; err != nil {
@@ -51,13 +58,13 @@ func LockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int) e
 
 		lockedBalance.AssetId = btcId
 		lockedBalance.AccountID = usr.LockAccount.ID
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
-	lockedBalance.Amount += amount
+	lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Add(amount))
 	switch tag {
 	case 0:
 	case 1:
-		lockedBalance.Tag1 += amount
+		lockedBalance.Tag1 = cModels.NewAmount(lockedBalance.Tag1.Add(amount))
 	default:
 		return fmt.Errorf("invalid tag")
 	}
@@ -69,7 +76,7 @@ func LockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int) e
 	lockBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   btcId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeLock,
 	}
@@ -91,9 +98,9 @@ func LockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int) e
 		AccountId:   usr.Account.ID,
 		BillType:    models.BiLLTypeLock,
 		Away:        models.AWAY_OUT,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_SATOSHIS,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &BtcId,
 		Invoice:     &Invoice,
 		PaymentHash: &lockedId,
@@ -107,19 +114,41 @@ func LockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int) e
 		return ServiceError
 	}
 
-	_, err = custodyBalance.LessBtcBalance(tx, usr, amount, balanceBill.ID, cModels.ChangeTypeLock)
+	_, err = custodyBalance.LessBtcBalance(tx, usr, billAmount, balanceBill.ID, cModels.ChangeTypeLock)
+	if err != nil {
+		return err
+	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationLock, custodyJournal.Reference("lock", lockedId),
+		btcId, custodyJournal.UserAccount(usr.Account.ID), custodyJournal.LockAccount(usr.LockAccount.ID), billAmount)
 	if err != nil {
+		btlLog.CUST.Error(err.Error())
 		return err
 	}
 
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	tx.Commit()
 	return nil
 }
 
-func UnlockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int) error {
+func UnlockBTC(usr *caccount.UserInfo, lockedId string, amount decimal.Decimal, tag int, locks ...custodyMutex.Lock) error {
 	tx, back := middleware.GetTx()
 	defer back()
+	if err := unlockBTC(tx, usr, lockedId, amount, tag, locks...); err != nil {
+		return err
+	}
+	tx.Commit()
+	return nil
+}
+
+func unlockBTC(tx *gorm.DB, usr *caccount.UserInfo, lockedId string, amount decimal.Decimal, tag int, locks ...custodyMutex.Lock) error {
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	lockedBalance := cModels.LockBalance{}
 	if err = tx.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, btcId).First(&lockedBalance).Error; err != nil {
@@ -127,25 +156,25 @@ func UnlockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int)
 			btlLog.CUST.Error(err.Error())
 			return ServiceError
 		}
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
 
 	if tag == 0 {
-		if lockedBalance.Amount < amount {
+		if lockedBalance.Amount.LessThan(amount) {
 			return NoEnoughBalance
 		}
-		if (lockedBalance.Amount - lockedBalance.Tag1) < amount {
-			return fmt.Errorf("%w,have  %f is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Amount.Sub(lockedBalance.Tag1.Decimal).LessThan(amount) {
+			return fmt.Errorf("%w,have  %s is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
 	} else if tag == 1 {
-		if lockedBalance.Tag1 < amount {
-			return fmt.Errorf("%w,have  %f ", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Tag1.LessThan(amount) {
+			return fmt.Errorf("%w,have  %s ", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
-		lockedBalance.Tag1 -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
+		lockedBalance.Tag1 = cModels.NewAmount(lockedBalance.Tag1.Sub(amount))
 	} else {
 		return fmt.Errorf("invalid tag")
 	}
@@ -158,7 +187,7 @@ func UnlockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int)
 	unlockBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   btcId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeUnlock,
 	}
@@ -180,9 +209,9 @@ func UnlockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int)
 		AccountId:   usr.Account.ID,
 		BillType:    models.BiLLTypeLock,
 		Away:        models.AWAY_IN,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_SATOSHIS,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &BtcId,
 		Invoice:     &Invoice,
 		PaymentHash: &lockedId,
@@ -196,20 +225,33 @@ func UnlockBTC(usr *caccount.UserInfo, lockedId string, amount float64, tag int)
 		return ServiceError
 	}
 
-	_, err = custodyBalance.AddBtcBalance(tx, usr, amount, balanceBill.ID, cModels.ChangeTypeUnlock)
+	_, err = custodyBalance.AddBtcBalance(tx, usr, billAmount, balanceBill.ID, cModels.ChangeTypeUnlock)
 	if err != nil {
 		return err
 	}
-	tx.Commit()
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationUnlock, custodyJournal.Reference("lock", lockedId),
+		btcId, custodyJournal.LockAccount(usr.LockAccount.ID), custodyJournal.UserAccount(usr.Account.ID), billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	return nil
 }
 
-func transferLockedBTC(usr *caccount.UserInfo, lockedId string, amount float64, toUser *caccount.UserInfo, tag int) error {
+func transferLockedBTC(usr *caccount.UserInfo, lockedId string, amount decimal.Decimal, toUser *caccount.UserInfo, tag int, locks ...custodyMutex.Lock) error {
 	tx, back := middleware.GetTx()
 	defer back()
 	BtcId := btcId
 
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	lockedBalance := cModels.LockBalance{}
 	if err = tx.Where("account_id =? AND asset_id =?", usr.LockAccount.ID, btcId).First(&lockedBalance).Error; err != nil {
@@ -218,24 +260,24 @@ func transferLockedBTC(usr *caccount.UserInfo, lockedId string, amount float64,
 			btlLog.CUST.Error(err.Error())
 			return ServiceError
 		}
-		lockedBalance.Amount = 0
+		lockedBalance.Amount = cModels.Amount{}
 	}
 	if tag == 0 {
-		if lockedBalance.Amount < amount {
+		if lockedBalance.Amount.LessThan(amount) {
 			return NoEnoughBalance
 		}
-		if (lockedBalance.Amount - lockedBalance.Tag1) < amount {
-			return fmt.Errorf("%w,have  %f is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Amount.Sub(lockedBalance.Tag1.Decimal).LessThan(amount) {
+			return fmt.Errorf("%w,have  %s is disable unlock", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
 	} else if tag == 1 {
-		if lockedBalance.Tag1 < amount {
-			return fmt.Errorf("%w,have  %f ", NoEnoughBalance, lockedBalance.Tag1)
+		if lockedBalance.Tag1.LessThan(amount) {
+			return fmt.Errorf("%w,have  %s ", NoEnoughBalance, lockedBalance.Tag1)
 		}
 
-		lockedBalance.Amount -= amount
-		lockedBalance.Tag1 -= amount
+		lockedBalance.Amount = cModels.NewAmount(lockedBalance.Amount.Sub(amount))
+		lockedBalance.Tag1 = cModels.NewAmount(lockedBalance.Tag1.Sub(amount))
 	} else {
 		return fmt.Errorf("invalid tag")
 	}
@@ -247,7 +289,7 @@ func transferLockedBTC(usr *caccount.UserInfo, lockedId string, amount float64,
 	transferBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		AssetId:   btcId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		LockId:    lockedId,
 		BillType:  cModels.LockBillTypeTransferByLockAsset,
 	}
@@ -268,7 +310,7 @@ func transferLockedBTC(usr *caccount.UserInfo, lockedId string, amount float64,
 		PayAccType: cModels.LockBillExtPayAccTypeLock,
 		PayAccId:   usr.LockAccount.ID,
 		RevAccId:   toUser.Account.ID,
-		Amount:     amount,
+		Amount:     cModels.NewAmount(amount),
 		AssetId:    btcId,
 		Status:     cModels.LockBillExtStatusSuccess,
 	}
@@ -292,9 +334,9 @@ func transferLockedBTC(usr *caccount.UserInfo, lockedId string, amount float64,
 		AccountId:   toUser.Account.ID,
 		BillType:    models.BillTypePendingOder,
 		Away:        models.AWAY_IN,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_SATOSHIS,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &BtcId,
 		Invoice:     &invoice,
 		PaymentHash: &lockedId,
@@ -308,28 +350,42 @@ func transferLockedBTC(usr *caccount.UserInfo, lockedId string, amount float64,
 		return ServiceError
 	}
 
-	_, err = custodyBalance.AddBtcBalance(tx, toUser, amount, balanceBill.ID, cModels.ChangeTypeLockedTransfer)
+	_, err = custodyBalance.AddBtcBalance(tx, toUser, billAmount, balanceBill.ID, cModels.ChangeTypeLockedTransfer)
 	if err != nil {
 		btlLog.CUST.Error(err.Error())
 		return ServiceError
 	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationLockedTransfer, custodyJournal.Reference("lock", lockedId),
+		btcId, custodyJournal.LockAccount(usr.LockAccount.ID), custodyJournal.UserAccount(toUser.Account.ID), billAmount)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return ServiceError
+	}
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	tx.Commit()
 
 	return nil
 }
 
-func transferBTC(usr *caccount.UserInfo, lockedId string, amount float64, toUser *caccount.UserInfo) error {
+func transferBTC(usr *caccount.UserInfo, lockedId string, amount decimal.Decimal, toUser *caccount.UserInfo, locks ...custodyMutex.Lock) error {
 	BtcId := btcId
 	tx, back := middleware.GetTx()
 	defer back()
 
 	var err error
+	billAmount, err := userAmount(amount)
+	if err != nil {
+		return err
+	}
 
 	transferBill := cModels.LockBill{
 		AccountID: usr.LockAccount.ID,
 		LockId:    lockedId,
 		AssetId:   btcId,
-		Amount:    amount,
+		Amount:    cModels.NewAmount(amount),
 		BillType:  cModels.LockBillTypeTransferByUnlockAsset,
 	}
 	if err = tx.Create(&transferBill).Error; err != nil {
@@ -349,7 +405,7 @@ func transferBTC(usr *caccount.UserInfo, lockedId string, amount float64, toUser
 		PayAccType: cModels.LockBillExtPayAccTypeUnlock,
 		PayAccId:   usr.Account.ID,
 		RevAccId:   toUser.Account.ID,
-		Amount:     amount,
+		Amount:     cModels.NewAmount(amount),
 		AssetId:    btcId,
 		Status:     cModels.LockBillExtStatusInit,
 	}
@@ -367,9 +423,9 @@ func transferBTC(usr *caccount.UserInfo, lockedId string, amount float64, toUser
 		AccountId:   usr.Account.ID,
 		BillType:    models.BillTypePendingOder,
 		Away:        models.AWAY_OUT,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_SATOSHIS,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &BtcId,
 		Invoice:     &payInvoice,
 		PaymentHash: &lockedId,
@@ -382,7 +438,7 @@ func transferBTC(usr *caccount.UserInfo, lockedId string, amount float64, toUser
 		btlLog.CUST.Error(err.Error())
 		return ServiceError
 	}
-	_, err = custodyBalance.LessBtcBalance(tx, usr, amount, balanceBill.ID, cModels.ChangeTypeLockedTransfer)
+	_, err = custodyBalance.LessBtcBalance(tx, usr, billAmount, balanceBill.ID, cModels.ChangeTypeLockedTransfer)
 	if err != nil {
 		return err
 	}
@@ -396,9 +452,9 @@ func transferBTC(usr *caccount.UserInfo, lockedId string, amount float64, toUser
 		AccountId:   toUser.Account.ID,
 		BillType:    models.BillTypePendingOder,
 		Away:        models.AWAY_IN,
-		Amount:      amount,
+		Amount:      cModels.NewAmount(amount),
 		Unit:        models.UNIT_SATOSHIS,
-		ServerFee:   0,
+		ServerFee:   cModels.Amount{},
 		AssetId:     &BtcId,
 		Invoice:     &recInvoice,
 		PaymentHash: &lockedId,
@@ -418,12 +474,22 @@ func transferBTC(usr *caccount.UserInfo, lockedId string, amount float64, toUser
 		return ServiceError
 	}
 
-	_, err = custodyBalance.AddBtcBalance(tx, toUser, amount, balanceBillRev.ID, cModels.ChangeTypeLockedTransfer)
+	_, err = custodyBalance.AddBtcBalance(tx, toUser, billAmount, balanceBillRev.ID, cModels.ChangeTypeLockedTransfer)
+	if err != nil {
+		btlLog.CUST.Error(err.Error())
+		return ServiceError
+	}
+	err = custodyJournal.Transfer(tx, cModels.JournalOperationLockedTransfer, custodyJournal.Reference("lock", lockedId),
+		btcId, custodyJournal.UserAccount(usr.Account.ID), custodyJournal.UserAccount(toUser.Account.ID), billAmount)
 	if err != nil {
 		btlLog.CUST.Error(err.Error())
 		return ServiceError
 	}
 
+	if err = custodyMutex.Fence(tx, locks...); err != nil {
+		btlLog.CUST.Error(err.Error())
+		return err
+	}
 	tx.Commit()
 	return nil
 }
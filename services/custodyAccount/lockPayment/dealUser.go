@@ -36,8 +36,8 @@ func RunDealUser() error {
 				btlLog.CUST.Error("GetBalance error,%s,%s", err, user.NpubKey)
 				continue
 			}
-			amount := f2 - f3
-			if amount <= 0 {
+			amount := f2.Sub(f3)
+			if !amount.IsPositive() {
 				continue
 			}
 			err = Unlock(user.NpubKey, lockedId, btcId, amount, 0)
@@ -52,8 +52,8 @@ func RunDealUser() error {
 				btlLog.CUST.Error("GetBalance error,%s,%s", err, user.NpubKey)
 				continue
 			}
-			amount := f2 - f3
-			if amount <= 0 {
+			amount := f2.Sub(f3)
+			if !amount.IsPositive() {
 				continue
 			}
 			err = Unlock(user.NpubKey, lockedId, assetId, amount, 0)
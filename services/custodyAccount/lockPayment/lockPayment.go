@@ -3,8 +3,8 @@ package lockPayment
 import (
 	"errors"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
-	"sync"
 	"trade/btlLog"
 	"trade/middleware"
 	cModels "trade/models/custodyModels"
@@ -59,23 +59,23 @@ func GetErrorCode(err error) int {
 	}
 }
 
-func GetBalance(npubkey, assetId string) (err error, unlockedBalance float64, lockedBalance, tag1 float64) {
+func GetBalance(npubkey, assetId string) (err error, unlockedBalance decimal.Decimal, lockedBalance, tag1 decimal.Decimal) {
 	if npubkey == FeeNpubkey {
 		npubkey = "admin"
 	}
 	usr, err := caccount.GetUserInfo(npubkey)
 	if err != nil {
-		return GetAccountError, 0, 0, 0
+		return GetAccountError, decimal.Zero, decimal.Zero, decimal.Zero
 	}
 	if assetId != btcId {
 		err, unlockedBalance, lockedBalance, tag1 = GetAssetBalance(usr, assetId)
 		if err != nil {
-			return err, 0, 0, 0
+			return err, decimal.Zero, decimal.Zero, decimal.Zero
 		}
 	} else {
 		err, unlockedBalance, lockedBalance, tag1 = GetBtcBalance(usr)
 		if err != nil {
-			return err, 0, 0, 0
+			return err, decimal.Zero, decimal.Zero, decimal.Zero
 		}
 	}
 	return
@@ -102,32 +102,34 @@ func GetBalances(npubkey string) (*[]cModels.LockBalance, error) {
 	return &balances, nil
 }
 
-func Lock(npubkey, lockedId, assetId string, amount float64, tag int) error {
+func Lock(npubkey, lockedId, assetId string, amount decimal.Decimal, tag int) error {
 	usr, err := caccount.GetUserInfo(npubkey)
 	if err != nil {
 		return fmt.Errorf("%w: %s", GetAccountError, err.Error())
 	}
-	mutex := GetLockPaymentMutex(usr.User.ID)
-	mutex.Lock()
-	defer mutex.Unlock()
+	lock, err := ObtainLockPaymentLock(usr.User.ID)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
 	err = CheckLockId(lockedId)
 	if err != nil {
 		return err
 	}
 
-	if amount <= 0 {
-		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%f", lockedId, assetId, amount)
+	if !amount.IsPositive() {
+		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%s", lockedId, assetId, amount)
 		return BadRequest
 	}
 
 	if assetId != btcId {
-		err := LockAsset(usr, lockedId, assetId, amount, tag)
+		err := LockAsset(usr, lockedId, assetId, amount, tag, lock)
 		if err != nil {
 			return err
 		}
 	} else {
-		err := LockBTC(usr, lockedId, amount, tag)
+		err := LockBTC(usr, lockedId, amount, tag, lock)
 		if err != nil {
 			return err
 		}
@@ -135,7 +137,7 @@ func Lock(npubkey, lockedId, assetId string, amount float64, tag int) error {
 	return nil
 }
 
-func Unlock(npubkey, lockedId, assetId string, amount float64, tag int) error {
+func Unlock(npubkey, lockedId, assetId string, amount decimal.Decimal, tag int) error {
 	usr, err := caccount.GetUserInfo(npubkey)
 	if err != nil {
 		return GetAccountError
@@ -145,22 +147,24 @@ func Unlock(npubkey, lockedId, assetId string, amount float64, tag int) error {
 		return err
 	}
 
-	mutex := GetLockPaymentMutex(usr.User.ID)
-	mutex.Lock()
-	defer mutex.Unlock()
+	lock, err := ObtainLockPaymentLock(usr.User.ID)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
-	if amount <= 0 {
-		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%f", lockedId, assetId, amount)
+	if !amount.IsPositive() {
+		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%s", lockedId, assetId, amount)
 		return BadRequest
 	}
 
 	if assetId != btcId {
-		err := UnlockAsset(usr, lockedId, assetId, amount, tag)
+		err := UnlockAsset(usr, lockedId, assetId, amount, tag, lock)
 		if err != nil {
 			return err
 		}
 	} else {
-		err := UnlockBTC(usr, lockedId, amount, tag)
+		err := UnlockBTC(usr, lockedId, amount, tag, lock)
 		if err != nil {
 			return err
 		}
@@ -168,23 +172,46 @@ func Unlock(npubkey, lockedId, assetId string, amount float64, tag int) error {
 	return nil
 }
 
-func TransferByUnlock(lockedId, npubkey, toNpubkey, assetId string, amount float64) error {
-	if npubkey == FeeNpubkey {
-		npubkey = "admin"
-	}
+// UnlockTx unlocks amount in the caller's tx, so the unlock commits or rolls back with whatever the caller
+// does with the funds. The returned lock serializes the lock payments of the user, release it after tx ends.
+func UnlockTx(tx *gorm.DB, npubkey, lockedId, assetId string, amount decimal.Decimal, tag int) (custodyMutex.Lock, error) {
 	usr, err := caccount.GetUserInfo(npubkey)
 	if err != nil {
-		return GetAccountError
+		return nil, GetAccountError
 	}
-	mutex := GetLockPaymentMutex(usr.User.ID)
-	mutex.Lock()
-	defer mutex.Unlock()
-
 	err = CheckLockId(lockedId)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !amount.IsPositive() {
+		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%s", lockedId, assetId, amount)
+		return nil, BadRequest
+	}
+
+	lock, err := ObtainLockPaymentLock(usr.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	if assetId != btcId {
+		err = unlockAsset(tx, usr, lockedId, assetId, amount, tag, lock)
+	} else {
+		err = unlockBTC(tx, usr, lockedId, amount, tag, lock)
 	}
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return lock, nil
+}
 
+func TransferByUnlock(lockedId, npubkey, toNpubkey, assetId string, amount decimal.Decimal) error {
+	if npubkey == FeeNpubkey {
+		npubkey = "admin"
+	}
+	usr, err := caccount.GetUserInfo(npubkey)
+	if err != nil {
+		return GetAccountError
+	}
 	if toNpubkey == FeeNpubkey {
 		toNpubkey = "admin"
 	}
@@ -192,22 +219,30 @@ func TransferByUnlock(lockedId, npubkey, toNpubkey, assetId string, amount float
 	if err != nil {
 		return RevNpubKeyNotFound
 	}
-	mutexTo := GetLockPaymentMutex(toUsr.User.ID)
-	mutexTo.Lock()
-	defer mutexTo.Unlock()
+	lock, lockTo, err := obtainTransferLocks(usr.User.ID, toUsr.User.ID)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	defer lockTo.Unlock()
+
+	err = CheckLockId(lockedId)
+	if err != nil {
+		return err
+	}
 
-	if amount <= 0 {
-		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%f", lockedId, assetId, amount)
+	if !amount.IsPositive() {
+		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%s", lockedId, assetId, amount)
 		return BadRequest
 	}
 
 	if assetId != btcId {
-		err := transferAsset(usr, lockedId, assetId, amount, toUsr)
+		err := transferAsset(usr, lockedId, assetId, amount, toUsr, lock, lockTo)
 		if err != nil {
 			return err
 		}
 	} else {
-		err := transferBTC(usr, lockedId, amount, toUsr)
+		err := transferBTC(usr, lockedId, amount, toUsr, lock, lockTo)
 		if err != nil {
 			return err
 		}
@@ -215,7 +250,7 @@ func TransferByUnlock(lockedId, npubkey, toNpubkey, assetId string, amount float
 	return nil
 }
 
-func TransferByLock(lockedId, npubkey, toNpubkey, assetId string, amount float64, tag int) error {
+func TransferByLock(lockedId, npubkey, toNpubkey, assetId string, amount decimal.Decimal, tag int) error {
 	if npubkey == FeeNpubkey {
 		npubkey = "admin"
 	}
@@ -223,15 +258,6 @@ func TransferByLock(lockedId, npubkey, toNpubkey, assetId string, amount float64
 	if err != nil {
 		return GetAccountError
 	}
-	mutex := GetLockPaymentMutex(usr.User.ID)
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	err = CheckLockId(lockedId)
-	if err != nil {
-		return err
-	}
-
 	if toNpubkey == FeeNpubkey {
 		toNpubkey = "admin"
 	}
@@ -239,20 +265,28 @@ func TransferByLock(lockedId, npubkey, toNpubkey, assetId string, amount float64
 	if err != nil {
 		return RevNpubKeyNotFound
 	}
-	mutexTo := GetLockPaymentMutex(toUsr.User.ID)
-	mutexTo.Lock()
-	defer mutexTo.Unlock()
-	if amount <= 0 {
-		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%f", lockedId, assetId, amount)
+	lock, lockTo, err := obtainTransferLocks(usr.User.ID, toUsr.User.ID)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	defer lockTo.Unlock()
+
+	err = CheckLockId(lockedId)
+	if err != nil {
+		return err
+	}
+	if !amount.IsPositive() {
+		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%s", lockedId, assetId, amount)
 		return BadRequest
 	}
 	if assetId != btcId {
-		err := transferLockedAsset(usr, lockedId, assetId, amount, toUsr, tag)
+		err := transferLockedAsset(usr, lockedId, assetId, amount, toUsr, tag, lock, lockTo)
 		if err != nil {
 			return err
 		}
 	} else {
-		err := transferLockedBTC(usr, lockedId, amount, toUsr, tag)
+		err := transferLockedBTC(usr, lockedId, amount, toUsr, tag, lock, lockTo)
 		if err != nil {
 			return err
 		}
@@ -260,21 +294,11 @@ func TransferByLock(lockedId, npubkey, toNpubkey, assetId string, amount float64
 	return nil
 }
 
-func TransferByLockIsLockId(lockedId string, usr *caccount.UserInfo, toNpubkey, assetId string, amount float64, tag int) error {
+func TransferByLockIsLockId(lockedId string, usr *caccount.UserInfo, toNpubkey, assetId string, amount decimal.Decimal, tag int) error {
 	if usr.User.Status == 0 {
 		return errors.New("用户已被冻结.请使用正确的接口")
 	}
 
-	var err error
-	mutex := GetLockPaymentMutex(usr.User.ID)
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	err = CheckLockId(lockedId)
-	if err != nil {
-		return err
-	}
-
 	if toNpubkey == FeeNpubkey {
 		toNpubkey = "admin"
 	}
@@ -282,20 +306,28 @@ func TransferByLockIsLockId(lockedId string, usr *caccount.UserInfo, toNpubkey,
 	if err != nil {
 		return RevNpubKeyNotFound
 	}
-	mutexTo := GetLockPaymentMutex(toUsr.User.ID)
-	mutexTo.Lock()
-	defer mutexTo.Unlock()
-	if amount <= 0 {
-		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%f", lockedId, assetId, amount)
+	lock, lockTo, err := obtainTransferLocks(usr.User.ID, toUsr.User.ID)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	defer lockTo.Unlock()
+
+	err = CheckLockId(lockedId)
+	if err != nil {
+		return err
+	}
+	if !amount.IsPositive() {
+		btlLog.CUST.Error("amount <= 0,lockedId:%s,assetId:%s,amount:%s", lockedId, assetId, amount)
 		return BadRequest
 	}
 	if assetId != btcId {
-		err := transferLockedAsset(usr, lockedId, assetId, amount, toUsr, tag)
+		err := transferLockedAsset(usr, lockedId, assetId, amount, toUsr, tag, lock, lockTo)
 		if err != nil {
 			return err
 		}
 	} else {
-		err := transferLockedBTC(usr, lockedId, amount, toUsr, tag)
+		err := transferLockedBTC(usr, lockedId, amount, toUsr, tag, lock, lockTo)
 		if err != nil {
 			return err
 		}
@@ -312,9 +344,47 @@ func CheckLockId(lockedId string) error {
 	return RepeatedLockId
 }
 
-func GetLockPaymentMutex(userId uint) *sync.Mutex {
+// userAmount converts a lock ledger amount for the float64 user balance and
+// bill models, rejecting amounts they cannot hold exactly.
+func userAmount(amount decimal.Decimal) (float64, error) {
+	f, err := cModels.AmountToFloat64(amount)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", BadRequest, err.Error())
+	}
+	return f, nil
+}
+
+// ObtainLockPaymentLock takes the custody lock serializing the lock payments of the user.
+func ObtainLockPaymentLock(userId uint) (custodyMutex.Lock, error) {
 	mutexKey := fmt.Sprintf("%s_%d", LockMutexKey, userId)
-	return custodyMutex.GetCustodyMutex(mutexKey)
+	return custodyMutex.Obtain(mutexKey)
+}
+
+// obtainTransferLocks takes the lock payment locks of both users of a transfer in user id order, so two
+// transfers between the same users in opposite directions can not deadlock. A transfer to oneself gets the
+// same lock twice, Unlock is idempotent.
+func obtainTransferLocks(fromId, toId uint) (lockFrom, lockTo custodyMutex.Lock, err error) {
+	if fromId == toId {
+		lockFrom, err = ObtainLockPaymentLock(fromId)
+		return lockFrom, lockFrom, err
+	}
+	first, second := fromId, toId
+	if first > second {
+		first, second = second, first
+	}
+	lockFirst, err := ObtainLockPaymentLock(first)
+	if err != nil {
+		return nil, nil, err
+	}
+	lockSecond, err := ObtainLockPaymentLock(second)
+	if err != nil {
+		lockFirst.Unlock()
+		return nil, nil, err
+	}
+	if first == fromId {
+		return lockFirst, lockSecond, nil
+	}
+	return lockSecond, lockFirst, nil
 }
 
 func ListTransferBTC(usr *caccount.UserInfo, assetId string, page, pageSize, away int) ([]cModels.LockBill, error) {
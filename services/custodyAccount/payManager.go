@@ -16,12 +16,19 @@ import (
 	"trade/services/btldb"
 	"trade/services/custodyAccount/account"
 	cBase "trade/services/custodyAccount/custodyBase"
+	"trade/services/custodyAccount/custodyBase/control"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
+	"trade/services/custodyAccount/custodyBase/custodyLimit"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 	"trade/services/custodyAccount/defaultAccount/costodyRecive"
 	"trade/services/custodyAccount/defaultAccount/custodyAssets"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
 	"trade/services/custodyAccount/defaultAccount/custodyBtc"
 	"trade/services/custodyAccount/defaultAccount/custodyGame"
 	"trade/services/custodyAccount/lockPayment"
+	"trade/services/pool"
+
+	"github.com/shopspring/decimal"
 )
 
 var (
@@ -47,9 +54,20 @@ type DecodeInvoiceRequest struct {
 	Invoice string `json:"invoice"`
 }
 
+// assetSatPrice prices assets for the withdrawal limits at their pool TWAP.
+func assetSatPrice(assetId string) (decimal.Decimal, error) {
+	return pool.QueryTokenSatTwap(assetId, pool.DefaultTwapWindowSecond)
+}
+
 func CustodyStart(ctx context.Context, cfg *config.Config) bool {
 	timestart := time.Now()
 
+	custodyMutex.InitLocker(cfg)
+	if err := custodyJournal.OpenJournal(); err != nil {
+		btlLog.CUST.Error("open custody journal error:%v", err)
+	}
+	control.StartControlSync(ctx)
+
 	if !checkAdminAccount() {
 		btlLog.CUST.Error("Admin account is not set")
 		return false
@@ -70,6 +88,7 @@ func CustodyStart(ctx context.Context, cfg *config.Config) bool {
 
 		costodyRecive.AddressServer.Start(ctx)
 
+		custodyLimit.SetSatPriceSource(assetSatPrice)
 		custodyAssets.GoOutsideMission()
 
 		custodyAssets.LoadAIMMission()
@@ -152,7 +171,7 @@ func LockPaymentToPaymentList(usr *account.UserInfo, assetId string, pageNum, pa
 		r.Address = &empty
 		r.Target = &v.LockId
 		r.PaymentHash = &v.LockId
-		r.Amount = v.Amount
+		r.Amount = v.Amount.InexactFloat64()
 		r.AssetId = &v.AssetId
 		r.State = models.STATE_SUCCESS
 		r.Fee = 0
@@ -193,7 +212,7 @@ func ClearBtcToAsset() {
 			btlLog.CUST.Error("ClearBtcToAsset failed:%s", err)
 			continue
 		}
-		runReplace(userinfo, v.Amount)
+		runReplace(userinfo, v.Amount.InexactFloat64())
 	}
 }
 
@@ -210,9 +229,9 @@ func runReplace(userinfo *account.UserInfo, amount float64) {
 		AccountId:   userinfo.Account.ID,
 		BillType:    models.BillTypeReplaceAsset,
 		Away:        models.AWAY_OUT,
-		Amount:      amount,
+		Amount:      custodyModels.NewAmountFromFloat64(amount),
 		Unit:        models.UNIT_SATOSHIS,
-		ServerFee:   0,
+		ServerFee:   custodyModels.Amount{},
 		Invoice:     &Invoice,
 		PaymentHash: &btcHash,
 		State:       models.STATE_SUCCESS,
@@ -233,9 +252,9 @@ func runReplace(userinfo *account.UserInfo, amount float64) {
 		AccountId:   adminacc.Account.ID,
 		BillType:    models.BillTypeReplaceAsset,
 		Away:        models.AWAY_IN,
-		Amount:      amount,
+		Amount:      custodyModels.NewAmountFromFloat64(amount),
 		Unit:        models.UNIT_SATOSHIS,
-		ServerFee:   0,
+		ServerFee:   custodyModels.Amount{},
 		Invoice:     &Invoice,
 		PaymentHash: &btcHash,
 		State:       models.STATE_SUCCESS,
@@ -259,9 +278,9 @@ func runReplace(userinfo *account.UserInfo, amount float64) {
 		AccountId:   userinfo.Account.ID,
 		BillType:    models.BillTypeReplaceAsset,
 		Away:        models.AWAY_IN,
-		Amount:      assetAmount,
+		Amount:      custodyModels.NewAmountFromFloat64(assetAmount),
 		Unit:        models.UNIT_ASSET_NORMAL,
-		ServerFee:   0,
+		ServerFee:   custodyModels.Amount{},
 		AssetId:     &assetId,
 		Invoice:     &Invoice,
 		PaymentHash: &assetHash,
@@ -284,9 +303,9 @@ func runReplace(userinfo *account.UserInfo, amount float64) {
 		AccountId:   adminacc.Account.ID,
 		BillType:    models.BillTypeReplaceAsset,
 		Away:        models.AWAY_OUT,
-		Amount:      assetAmount,
+		Amount:      custodyModels.NewAmountFromFloat64(assetAmount),
 		Unit:        models.UNIT_ASSET_NORMAL,
-		ServerFee:   0,
+		ServerFee:   custodyModels.Amount{},
 		AssetId:     &assetId,
 		Invoice:     &Invoice,
 		PaymentHash: &assetHash,
@@ -304,5 +323,15 @@ func runReplace(userinfo *account.UserInfo, amount float64) {
 		btlLog.CUST.Error("runReplace failed:%s", err)
 		return
 	}
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationReplaceAsset, btcHash,
+		"00", custodyJournal.UserAccount(userinfo.Account.ID), custodyJournal.UserAccount(adminacc.Account.ID), amount)
+	if err == nil {
+		err = custodyJournal.Transfer(tx, custodyModels.JournalOperationReplaceAsset, assetHash,
+			assetId, custodyJournal.UserAccount(adminacc.Account.ID), custodyJournal.UserAccount(userinfo.Account.ID), assetAmount)
+	}
+	if err != nil {
+		btlLog.CUST.Error("runReplace failed:%s", err)
+		return
+	}
 	tx.Commit()
 }
@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrorNotEnoughBalance = errors.New("not enough balance")
 	ErrorDbError          = errors.New("db error")
+	ErrorInvalidAmount    = errors.New("invalid amount")
 )
@@ -3,12 +3,14 @@ package poolAccount
 import (
 	"errors"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"trade/btlLog"
+	"trade/models/custodyModels"
 	"trade/models/custodyModels/pAccount"
 )
 
-func addBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64, target string, transferDesc string) (uint, error) {
+func addBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount decimal.Decimal, target string, transferDesc string) (uint, error) {
 	if !checkAssetId(tx, poolAccountId, AssetId) {
 		return 0, fmt.Errorf("AssetId not found in pool account")
 	}
@@ -19,7 +21,7 @@ func addBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64,
 		btlLog.CUST.Error("AddBtcBalance error: ", err)
 		return 0, err
 	}
-	balance.Balance += amount
+	balance.Balance = custodyModels.NewAmount(balance.Balance.Add(amount))
 	err = tx.Save(&balance).Error
 	if err != nil {
 		return 0, err
@@ -28,7 +30,7 @@ func addBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64,
 		PoolAccountId: poolAccountId,
 		Away:          pAccount.PAccountBillAwayIn,
 		AssetId:       AssetId,
-		Amount:        amount,
+		Amount:        custodyModels.NewAmount(amount),
 		Target:        target,
 		PaymentHash:   transferDesc,
 		State:         1,
@@ -41,7 +43,7 @@ func addBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64,
 		PoolAccountId: poolAccountId,
 		AssetId:       AssetId,
 		BillId:        bill.ID,
-		Amount:        amount,
+		Amount:        custodyModels.NewAmount(amount),
 		FinalBalance:  balance.Balance,
 	}
 	err = tx.Create(&change).Error
@@ -51,7 +53,7 @@ func addBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64,
 	return bill.ID, nil
 }
 
-func lessBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64, target string, transferDesc string) (uint, error) {
+func lessBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount decimal.Decimal, target string, transferDesc string) (uint, error) {
 	if !checkAssetId(tx, poolAccountId, AssetId) {
 		return 0, fmt.Errorf("AssetId not found in pool account")
 	}
@@ -62,10 +64,10 @@ func lessBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64
 		btlLog.CUST.Error("AddBtcBalance error: ", err)
 		return 0, err
 	}
-	if balance.Balance < amount {
+	if balance.Balance.LessThan(amount) {
 		return 0, ErrorNotEnoughBalance
 	}
-	balance.Balance -= amount
+	balance.Balance = custodyModels.NewAmount(balance.Balance.Sub(amount))
 	err = tx.Save(&balance).Error
 	if err != nil {
 		return 0, err
@@ -74,7 +76,7 @@ func lessBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64
 		PoolAccountId: poolAccountId,
 		Away:          pAccount.PAccountBillAwayOut,
 		AssetId:       AssetId,
-		Amount:        amount,
+		Amount:        custodyModels.NewAmount(amount),
 		Target:        target,
 		PaymentHash:   transferDesc,
 		State:         1,
@@ -87,7 +89,7 @@ func lessBalance(tx *gorm.DB, poolAccountId uint, AssetId string, amount float64
 		PoolAccountId: poolAccountId,
 		AssetId:       AssetId,
 		BillId:        bill.ID,
-		Amount:        amount,
+		Amount:        custodyModels.NewAmount(amount),
 		FinalBalance:  balance.Balance,
 	}
 	err = tx.Create(&change).Error
@@ -3,23 +3,24 @@ package poolAccount
 import (
 	"errors"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"math/big"
-	"sync"
 	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
 	"trade/models/custodyModels"
 	"trade/models/custodyModels/pAccount"
 	"trade/services/custodyAccount/account"
+	"trade/services/custodyAccount/custodyBase/custodyJournal"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
 	"trade/services/custodyAccount/defaultAccount/Award"
 	"trade/services/custodyAccount/defaultAccount/custodyBalance"
 )
 
 const btcId = "00"
 
-var poolAccountMutex = sync.Mutex{}
-
 func CreatePoolAccount(tx *gorm.DB, pairId uint, poolType uint, allowTokens []string) error {
 	if tx == nil {
 		return fmt.Errorf("tx is nil")
@@ -68,12 +69,22 @@ func GetPoolAccount(tx *gorm.DB, pairId uint, poolType uint) (*pAccount.PoolAcco
 	return &Account, nil
 }
 
+// lockPoolAccounts locks the pool account rows until tx ends, in id order so two payments between the
+// same accounts can not deadlock.
+func lockPoolAccounts(tx *gorm.DB, ids ...uint) error {
+	var accounts []pAccount.PoolAccount
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id IN ?", ids).Order("id").Find(&accounts).Error
+}
+
 func UserPayToPAccount(tx *gorm.DB, pairId uint, poolType uint, username string, token string, _amount *big.Int, transferDesc string) (uint, error) {
 	if tx == nil {
 		return 0, fmt.Errorf("tx is nil")
 	}
 
-	amount := bigIntToFloat64(_amount)
+	amount, userAmount, err := ledgerAmount(_amount)
+	if err != nil {
+		return 0, err
+	}
 
 	poolAccount, err := GetPoolAccount(tx, pairId, poolType)
 	if err != nil {
@@ -84,8 +95,14 @@ func UserPayToPAccount(tx *gorm.DB, pairId uint, poolType uint, username string,
 	if err != nil {
 		return 0, err
 	}
-	poolAccountMutex.Lock()
-	defer poolAccountMutex.Unlock()
+	if err = lockPoolAccounts(tx, poolAccount.ID); err != nil {
+		return 0, err
+	}
+	// The user balance is written like a custody payment, so a pay lock holder whose lease expired can
+	// not commit it over the next holder.
+	if err = custodyMutex.Fence(tx, usr.HeldPayLock()); err != nil {
+		return 0, err
+	}
 
 	b := getBillBalanceModel(usr, amount, token, models.AWAY_OUT, transferDesc)
 	if err = tx.Create(b).Error; err != nil {
@@ -94,7 +111,7 @@ func UserPayToPAccount(tx *gorm.DB, pairId uint, poolType uint, username string,
 
 	switch token {
 	case btcId:
-		_, err = custodyBalance.LessBtcBalance(tx, usr, amount, b.ID, custodyModels.ChangeTypePayToPoolAccount)
+		_, err = custodyBalance.LessBtcBalance(tx, usr, userAmount, b.ID, custodyModels.ChangeTypePayToPoolAccount)
 		if err != nil {
 			if errors.Is(err, custodyBalance.NotEnoughBalance) {
 				return 0, ErrorNotEnoughBalance
@@ -103,10 +120,10 @@ func UserPayToPAccount(tx *gorm.DB, pairId uint, poolType uint, username string,
 			return 0, ErrorDbError
 		}
 	default:
-		_, err = custodyBalance.LessAssetBalance(tx, usr, amount, b.ID, token, custodyModels.ChangeTypePayToPoolAccount)
+		_, err = custodyBalance.LessAssetBalance(tx, usr, userAmount, b.ID, token, custodyModels.ChangeTypePayToPoolAccount)
 		if err != nil {
 			if errors.Is(err, custodyBalance.NotEnoughAssetBalance) {
-				btlLog.CUST.Error("NotEnoughAssetBalance:%s,assetId:%, amount:%f", err, token, amount)
+				btlLog.CUST.Error("NotEnoughAssetBalance:%s,assetId:%s, amount:%s", err, token, amount)
 				return 0, ErrorNotEnoughBalance
 			}
 			btlLog.CUST.Error("LessAssetBalance error:%s", err)
@@ -114,6 +131,12 @@ func UserPayToPAccount(tx *gorm.DB, pairId uint, poolType uint, username string,
 			return 0, ErrorDbError
 		}
 	}
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationPoolTransfer, custodyJournal.Reference("pool_transfer", transferDesc),
+		token, custodyJournal.UserAccount(usr.Account.ID), custodyJournal.PoolAccount(poolAccount.ID), userAmount)
+	if err != nil {
+		btlLog.CUST.Error("PostJournal error:%s", err)
+		return 0, ErrorDbError
+	}
 	return addBalance(tx, poolAccount.ID, token, amount, username, transferDesc)
 }
 
@@ -121,7 +144,10 @@ func PAccountToUserPay(tx *gorm.DB, username string, pairId uint, poolType uint,
 	if tx == nil {
 		return 0, fmt.Errorf("tx is nil")
 	}
-	amount := bigIntToFloat64(_amount)
+	amount, userAmount, err := ledgerAmount(_amount)
+	if err != nil {
+		return 0, err
+	}
 
 	poolAccount, err := GetPoolAccount(tx, pairId, poolType)
 	if err != nil {
@@ -131,8 +157,14 @@ func PAccountToUserPay(tx *gorm.DB, username string, pairId uint, poolType uint,
 	if err != nil {
 		return 0, err
 	}
-	poolAccountMutex.Lock()
-	defer poolAccountMutex.Unlock()
+	if err = lockPoolAccounts(tx, poolAccount.ID); err != nil {
+		return 0, err
+	}
+	// The user balance is written like a custody payment, so a pay lock holder whose lease expired can
+	// not commit it over the next holder.
+	if err = custodyMutex.Fence(tx, usr.HeldPayLock()); err != nil {
+		return 0, err
+	}
 
 	b := getBillBalanceModel(usr, amount, token, models.AWAY_IN, transferDesc)
 	if err = tx.Create(b).Error; err != nil {
@@ -141,18 +173,24 @@ func PAccountToUserPay(tx *gorm.DB, username string, pairId uint, poolType uint,
 
 	switch token {
 	case btcId:
-		_, err = custodyBalance.AddBtcBalance(tx, usr, amount, b.ID, custodyModels.ChangeTypeReceiveFromPoolAccount)
+		_, err = custodyBalance.AddBtcBalance(tx, usr, userAmount, b.ID, custodyModels.ChangeTypeReceiveFromPoolAccount)
 		if err != nil {
 			btlLog.CUST.Error("AddBtcBalance error:%s", err)
 			return 0, ErrorDbError
 		}
 	default:
-		_, err = custodyBalance.AddAssetBalance(tx, usr, amount, b.ID, token, custodyModels.ChangeTypeReceiveFromPoolAccount)
+		_, err = custodyBalance.AddAssetBalance(tx, usr, userAmount, b.ID, token, custodyModels.ChangeTypeReceiveFromPoolAccount)
 		if err != nil {
 			btlLog.CUST.Error("AddAssetBalance error:%s", err)
 			return 0, ErrorDbError
 		}
 	}
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationPoolTransfer, custodyJournal.Reference("pool_transfer", transferDesc),
+		token, custodyJournal.PoolAccount(poolAccount.ID), custodyJournal.UserAccount(usr.Account.ID), userAmount)
+	if err != nil {
+		btlLog.CUST.Error("PostJournal error:%s", err)
+		return 0, ErrorDbError
+	}
 	return lessBalance(tx, poolAccount.ID, token, amount, username, transferDesc)
 }
 
@@ -160,7 +198,10 @@ func PAccountToPAccountPay(tx *gorm.DB, fromPairId uint, fromType uint, toPairId
 	if tx == nil {
 		return 0, fmt.Errorf("tx is nil")
 	}
-	amount := bigIntToFloat64(_amount)
+	amount, journalAmount, err := ledgerAmount(_amount)
+	if err != nil {
+		return 0, err
+	}
 
 	payAccount, err := GetPoolAccount(tx, fromPairId, fromType)
 	if err != nil {
@@ -170,13 +211,20 @@ func PAccountToPAccountPay(tx *gorm.DB, fromPairId uint, fromType uint, toPairId
 	if err != nil {
 		return 0, err
 	}
-	poolAccountMutex.Lock()
-	defer poolAccountMutex.Unlock()
+	if err = lockPoolAccounts(tx, payAccount.ID, receiveAccount.ID); err != nil {
+		return 0, err
+	}
 
 	_, err = lessBalance(tx, payAccount.ID, token, amount, fmt.Sprintf("poolAccount:%d", payAccount.ID), transferDesc)
 	if err != nil {
 		return 0, err
 	}
+	err = custodyJournal.Transfer(tx, custodyModels.JournalOperationPoolTransfer, custodyJournal.Reference("pool_transfer", transferDesc),
+		token, custodyJournal.PoolAccount(payAccount.ID), custodyJournal.PoolAccount(receiveAccount.ID), journalAmount)
+	if err != nil {
+		btlLog.CUST.Error("PostJournal error:%s", err)
+		return 0, ErrorDbError
+	}
 	return addBalance(tx, receiveAccount.ID, token, amount, fmt.Sprintf("poolAccount:%d", payAccount.ID), transferDesc)
 }
 
@@ -223,13 +271,15 @@ func UnlockPoolAccount(tx *gorm.DB, pairId uint, poolType uint) error {
 }
 
 func AwardSat(username string, _amount *big.Int, transferDesc string) (uint, error) {
-	amount := bigIntToFloat64(_amount)
+	if _amount == nil || !_amount.IsInt64() {
+		return 0, ErrorInvalidAmount
+	}
 	usr, err := account.GetUserInfo(username)
 	if err != nil {
 		return 0, err
 	}
 	awardType := "swapLP"
-	award, err := Award.PutInAward(usr, "", int(amount), &awardType, transferDesc)
+	award, err := Award.PutInAward(usr, "", int(_amount.Int64()), &awardType, transferDesc)
 	if err != nil {
 		return 0, err
 	}
@@ -259,14 +309,21 @@ func GetPoolAccountInfo(pairId uint, poolType uint) (*PAccountInfo, error) {
 	return &info, nil
 }
 
-func bigIntToFloat64(bi *big.Int) float64 {
-
-	intValue := bi.Int64()
-
-	return float64(intValue)
+// ledgerAmount converts a pool amount to the exact ledger amount and to the
+// float64 still taken by the custody balance and journal calls.
+func ledgerAmount(bi *big.Int) (decimal.Decimal, float64, error) {
+	if bi == nil || bi.Sign() < 0 {
+		return decimal.Zero, 0, ErrorInvalidAmount
+	}
+	amount := custodyModels.AmountFromBigInt(bi)
+	userAmount, err := custodyModels.AmountToFloat64(amount)
+	if err != nil {
+		return decimal.Zero, 0, fmt.Errorf("%w: %s", ErrorInvalidAmount, err.Error())
+	}
+	return amount, userAmount, nil
 }
 
-func getBillBalanceModel(usr *account.UserInfo, amount float64, assetId string, away models.BalanceAway, transferDesc string) *models.Balance {
+func getBillBalanceModel(usr *account.UserInfo, amount decimal.Decimal, assetId string, away models.BalanceAway, transferDesc string) *models.Balance {
 	ba := models.Balance{}
 
 	var i string
@@ -279,7 +336,7 @@ func getBillBalanceModel(usr *account.UserInfo, amount float64, assetId string,
 		typeExt = models.BTExtReceivePoolAccount
 	}
 	ba.AccountId = usr.Account.ID
-	ba.Amount = amount
+	ba.Amount = custodyModels.NewAmount(amount)
 	ba.AssetId = &assetId
 	ba.Unit = models.UNIT_ASSET_NORMAL
 	if assetId == btcId {
@@ -300,10 +357,14 @@ func CleanPoolAccount(PairId uint, PoolType uint) {
 		return
 	}
 	for _, balance := range *info.Balances {
-		if balance.Balance > 0 {
+		if balance.Balance.IsPositive() {
+			amount, err := custodyModels.AmountToBigInt(balance.Balance.Decimal)
+			if err != nil {
+				btlLog.CUST.Error("CleanPoolAccount balance %s error:%s", balance.Balance, err)
+				return
+			}
 			tx, back := middleware.GetTx()
-			amount := big.NewInt(int64(balance.Balance))
-			_, err := PAccountToUserPay(tx, "admin", PairId, PoolType, balance.AssetId, amount, "clean pool account")
+			_, err = PAccountToUserPay(tx, "admin", PairId, PoolType, balance.AssetId, amount, "clean pool account")
 			if err != nil {
 				back()
 				return
@@ -0,0 +1,29 @@
+package reconciliation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/CatchZeng/dingtalk/pkg/dingtalk"
+	"strings"
+	"trade/config"
+	"trade/models/custodyModels"
+)
+
+func sendSolvencyAlert(snapshots []*custodyModels.SolvencySnapshot) error {
+	cfg := config.GetConfig().Reconciliation.DingTalk
+	if cfg.AccessToken == "" {
+		return errors.New("ding talk access token is not configured")
+	}
+	var text strings.Builder
+	text.WriteString("### 托管对账异常\n\n")
+	text.WriteString(fmt.Sprintf("网络: %s\n\n", config.GetConfig().NetWork))
+	for _, s := range snapshots {
+		text.WriteString(fmt.Sprintf("- **%s** 差额 %s (阈值 %s)\n", s.AssetId, s.Delta, s.Threshold))
+		text.WriteString(fmt.Sprintf("  - 负债 %s = 用户 %s + 锁定 %s + 池 %s\n", s.TotalLiability, s.UserLiability, s.LockLiability, s.PoolLiability))
+		text.WriteString(fmt.Sprintf("  - 节点持有 %s + 在途外部支付 %s\n", s.NodeHolding, s.InFlightOutside))
+	}
+	client := dingtalk.NewClient(cfg.AccessToken, cfg.Secret)
+	msg := dingtalk.NewMarkdownMessage().SetMarkdown("托管对账异常", text.String())
+	_, _, err := client.Send(msg)
+	return err
+}
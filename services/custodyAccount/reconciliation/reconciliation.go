@@ -0,0 +1,265 @@
+package reconciliation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lightninglabs/taproot-assets/rfqmsg"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"trade/btlLog"
+	"trade/config"
+	"trade/middleware"
+	"trade/models/custodyModels"
+	"trade/services/pool"
+	rpc "trade/services/servicesrpc"
+)
+
+const btcId = "00"
+
+// NodeHoldings is what lnd and tapd hold, per asset id, with btc under "00".
+type NodeHoldings map[string]decimal.Decimal
+
+func (h NodeHoldings) add(assetId string, amount decimal.Decimal) {
+	h[assetId] = h[assetId].Add(amount)
+}
+
+// QueryNodeHoldings sums the lnd wallet and the local balance of every channel for btc, and the tapd
+// balances plus the local assets of the asset channels for assets.
+func QueryNodeHoldings() (NodeHoldings, error) {
+	holdings := make(NodeHoldings)
+
+	wallet, err := rpc.GetBalance()
+	if err != nil {
+		return nil, fmt.Errorf("GetBalance: %w", err)
+	}
+	holdings.add(btcId, decimal.NewFromInt(wallet.TotalBalance))
+
+	channels, err := rpc.GetChannelInfo()
+	if err != nil {
+		return nil, fmt.Errorf("GetChannelInfo: %w", err)
+	}
+	for _, channel := range channels {
+		holdings.add(btcId, decimal.NewFromInt(channel.LocalBalance))
+		if channel.CustomChannelData == nil {
+			continue
+		}
+		var customData rfqmsg.JsonAssetChannel
+		if err = json.Unmarshal(channel.CustomChannelData, &customData); err != nil {
+			return nil, fmt.Errorf("unmarshal custom data of channel %d: %w", channel.ChanId, err)
+		}
+		for _, asset := range customData.LocalAssets {
+			holdings.add(asset.AssetID, decimal.NewFromUint64(asset.Amount))
+		}
+	}
+
+	assets, err := rpc.ListAssetsBalance()
+	if err != nil {
+		return nil, fmt.Errorf("ListAssetsBalance: %w", err)
+	}
+	for assetId, balance := range assets.AssetBalances {
+		holdings.add(assetId, decimal.NewFromUint64(balance.Balance))
+	}
+	return holdings, nil
+}
+
+// reconciledAssetIds lists btc and every asset custody owes in, or the nodes hold.
+func reconciledAssetIds(holdings NodeHoldings) ([]string, error) {
+	var assetIds []string
+	err := middleware.DB.Raw(assetIdsSql).Scan(&assetIds).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{btcId: true}
+	result := []string{btcId}
+	for _, assetId := range assetIds {
+		if !seen[assetId] {
+			seen[assetId] = true
+			result = append(result, assetId)
+		}
+	}
+	for assetId := range holdings {
+		if !seen[assetId] {
+			seen[assetId] = true
+			result = append(result, assetId)
+		}
+	}
+	return result, nil
+}
+
+var assetIdsSql = `
+select distinct asset_id from user_account_balance where amount > 0
+union
+select distinct asset_id from user_lock_balance where amount > 0
+union
+select distinct asset_id from custody_pool_account_balances where balance > 0
+`
+
+func sumUserLiability(db *gorm.DB, assetId string) (total decimal.Decimal, err error) {
+	if assetId == btcId {
+		err = db.Raw("select COALESCE(sum(amount),0) from user_account_balance_btc").Scan(&total).Error
+	} else {
+		err = db.Raw("select COALESCE(sum(amount),0) from user_account_balance where asset_id = ?", assetId).Scan(&total).Error
+	}
+	return total, err
+}
+
+func sumLockLiability(db *gorm.DB, assetId string) (total decimal.Decimal, err error) {
+	err = db.Raw("select COALESCE(sum(amount),0) from user_lock_balance where asset_id = ?", assetId).Scan(&total).Error
+	return total, err
+}
+
+// sumInFlightOutside sums the outside payments the user balances and the node holdings disagree on.
+// A pending channel payment is still in the user's balance while the node has already committed it,
+// so it counts positive. An on chain withdrawal that is pending, sending or in review has left the
+// user's balance while the node still holds it, so it counts negative.
+func sumInFlightOutside(db *gorm.DB, assetId string) (total decimal.Decimal, err error) {
+	var committed, owed decimal.Decimal
+	q := db.Model(&custodyModels.AccountOutsideMission{}).Where("state = ?", custodyModels.AOMStatePending)
+	if assetId == btcId {
+		q = q.Where("type = ?", custodyModels.AOMTypeBtc)
+	} else {
+		q = q.Where("type = ? AND asset_id = ?", custodyModels.AOMTypeAsset, assetId)
+	}
+	err = q.Select("COALESCE(sum(amount),0)").Scan(&committed).Error
+	if err != nil {
+		return decimal.Zero, err
+	}
+	err = db.Model(&custodyModels.PayOutside{}).
+		Where("asset_id = ? AND status IN ?", assetId, []custodyModels.PayOutsideStatus{
+			custodyModels.PayOutsideStatusPending,
+			custodyModels.PayOutsideStatusSending,
+			custodyModels.PayOutsideStatusReview,
+		}).
+		Select("COALESCE(sum(amount),0)").Scan(&owed).Error
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return committed.Sub(owed), nil
+}
+
+func alertThreshold(assetId string) decimal.Decimal {
+	cfg := config.GetConfig().Reconciliation
+	if threshold, ok := cfg.AlertThresholds[assetId]; ok {
+		return custodyModels.AmountFromFloat64(threshold)
+	}
+	return custodyModels.AmountFromFloat64(cfg.DefaultAlertThreshold)
+}
+
+// ReconcileAsset compares the custody liabilities in one asset with the node holdings.
+// Delta is positive when the nodes hold more than custody owes.
+func ReconcileAsset(assetId string, holdings NodeHoldings) (*custodyModels.SolvencySnapshot, error) {
+	db := middleware.DB
+	userLiability, err := sumUserLiability(db, assetId)
+	if err != nil {
+		return nil, fmt.Errorf("sum user liability: %w", err)
+	}
+	lockLiability, err := sumLockLiability(db, assetId)
+	if err != nil {
+		return nil, fmt.Errorf("sum lock liability: %w", err)
+	}
+	poolLiability, err := pool.GetPoolAccountTotalBalance(assetId)
+	if err != nil {
+		return nil, fmt.Errorf("sum pool liability: %w", err)
+	}
+	inFlight, err := sumInFlightOutside(db, assetId)
+	if err != nil {
+		return nil, fmt.Errorf("sum in flight outside: %w", err)
+	}
+	_poolLiability := custodyModels.AmountFromFloat64(poolLiability)
+	totalLiability := userLiability.Add(lockLiability).Add(_poolLiability)
+	nodeHolding := holdings[assetId]
+	return &custodyModels.SolvencySnapshot{
+		Date:            time.Now().Format(time.DateOnly),
+		AssetId:         assetId,
+		UserLiability:   custodyModels.NewAmount(userLiability),
+		LockLiability:   custodyModels.NewAmount(lockLiability),
+		PoolLiability:   custodyModels.NewAmount(_poolLiability),
+		TotalLiability:  custodyModels.NewAmount(totalLiability),
+		NodeHolding:     custodyModels.NewAmount(nodeHolding),
+		InFlightOutside: custodyModels.NewAmount(inFlight),
+		Delta:           custodyModels.NewAmount(nodeHolding.Add(inFlight).Sub(totalLiability)),
+		Threshold:       custodyModels.NewAmount(alertThreshold(assetId)),
+	}, nil
+}
+
+// saveSnapshot overwrites the day's snapshot of the asset, keeping whether the day has been alerted already.
+func saveSnapshot(snapshot *custodyModels.SolvencySnapshot) (alreadyAlerted bool, err error) {
+	var existing custodyModels.SolvencySnapshot
+	err = middleware.DB.Where("date = ? AND asset_id = ?", snapshot.Date, snapshot.AssetId).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	alreadyAlerted = existing.Alerted
+	snapshot.Alerted = snapshot.Alerted || alreadyAlerted
+	err = middleware.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "date"}, {Name: "asset_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "user_liability", "lock_liability", "pool_liability",
+			"total_liability", "node_holding", "in_flight_outside", "delta", "threshold", "alerted"}),
+	}).Create(snapshot).Error
+	return alreadyAlerted, err
+}
+
+// RunReconciliation reconciles every asset, stores the day's snapshots and alerts once a day per asset
+// whose delta exceeds its threshold.
+func RunReconciliation() error {
+	holdings, err := QueryNodeHoldings()
+	if err != nil {
+		return err
+	}
+	assetIds, err := reconciledAssetIds(holdings)
+	if err != nil {
+		return fmt.Errorf("reconciledAssetIds: %w", err)
+	}
+	var breaches []*custodyModels.SolvencySnapshot
+	for _, assetId := range assetIds {
+		snapshot, err := ReconcileAsset(assetId, holdings)
+		if err != nil {
+			btlLog.CUST.Error("reconcile asset %s: %v", assetId, err)
+			continue
+		}
+		breached := snapshot.Delta.Abs().GreaterThan(snapshot.Threshold.Decimal)
+		snapshot.Alerted = breached
+		alreadyAlerted, err := saveSnapshot(snapshot)
+		if err != nil {
+			btlLog.CUST.Error("save solvency snapshot %s: %v", assetId, err)
+			continue
+		}
+		if breached && !alreadyAlerted {
+			breaches = append(breaches, snapshot)
+		}
+	}
+	if len(breaches) == 0 {
+		return nil
+	}
+	err = sendSolvencyAlert(breaches)
+	if err != nil {
+		// Let the next run retry the alert.
+		for _, snapshot := range breaches {
+			middleware.DB.Model(&custodyModels.SolvencySnapshot{}).
+				Where("date = ? AND asset_id = ?", snapshot.Date, snapshot.AssetId).
+				Update("alerted", false)
+		}
+		return fmt.Errorf("sendSolvencyAlert: %w", err)
+	}
+	return nil
+}
+
+// QuerySolvencyReport returns the snapshots of the day, the latest day with snapshots when date is empty.
+func QuerySolvencyReport(date string) (*[]custodyModels.SolvencySnapshot, error) {
+	db := middleware.DB
+	if date == "" {
+		err := db.Model(&custodyModels.SolvencySnapshot{}).Select("COALESCE(max(date),'')").Scan(&date).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	var snapshots []custodyModels.SolvencySnapshot
+	err := db.Where("date = ?", date).Order("asset_id").Find(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+	return &snapshots, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/lightninglabs/taproot-assets/taprpc"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"math"
 	"reflect"
 	"sort"
@@ -15,9 +16,11 @@ import (
 	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
+	"trade/models/custodyModels"
 	"trade/services/btldb"
 	"trade/services/custodyAccount"
 	"trade/services/custodyAccount/defaultAccount/custodyFee"
+	"trade/services/satBackQueue"
 	"trade/utils"
 )
 
@@ -153,6 +156,8 @@ func GetFairLaunchMintedInfo(id int) (*models.FairLaunchMintedInfo, error) {
 	return f.ReadFairLaunchMintedInfo(uint(id))
 }
 
+// Deprecated: minted infos no longer pile up process numbers, the workflow fails a mint once its transition
+// is out of attempts.
 func GetFairLaunchMintedInfoWhoseProcessNumberIsMoreThanTenThousand() (*[]models.FairLaunchMintedInfo, error) {
 	return btldb.ReadFairLaunchMintedInfoWhoseProcessNumberIsMoreThanTenThousand()
 }
@@ -170,9 +175,41 @@ func SetFairLaunchInfo(fairLaunchInfo *models.FairLaunchInfo) error {
 	return f.CreateFairLaunchInfo(fairLaunchInfo)
 }
 
+// SetFairLaunchMintedInfo creates the minted info and allocates its inventory in one transaction. The user row
+// is locked first, so concurrent mints of a user are checked against the mint cap one after another.
 func SetFairLaunchMintedInfo(fairLaunchMintedInfo *models.FairLaunchMintedInfo) error {
-	f := btldb.FairLaunchStore{DB: middleware.DB}
-	return f.CreateFairLaunchMintedInfo(fairLaunchMintedInfo)
+	return middleware.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, fairLaunchMintedInfo.UserID).Error
+		if err != nil {
+			return utils.AppendErrorInfo(err, "lock user")
+		}
+		var recordNumber int
+		err = tx.Model(&models.FairLaunchMintedInfo{}).
+			Where("user_id = ? AND fair_launch_info_id = ? AND state <> ?", fairLaunchMintedInfo.UserID, fairLaunchMintedInfo.FairLaunchInfoID, models.FairLaunchMintedStateFail).
+			Select("COALESCE(SUM(minted_number), 0)").
+			Scan(&recordNumber).Error
+		if err != nil {
+			return utils.AppendErrorInfo(err, "Sum minted number")
+		}
+		if recordNumber+fairLaunchMintedInfo.MintedNumber > models.MintMaxNumber {
+			return errors.New("Reach max mint number, available: " + strconv.Itoa(models.MintMaxNumber-recordNumber))
+		}
+		err = tx.Create(fairLaunchMintedInfo).Error
+		if err != nil {
+			return utils.AppendErrorInfo(err, "Create fairLaunchMintedInfo")
+		}
+		mintInventoryInfos, err := LockInventory(tx, fairLaunchMintedInfo.FairLaunchInfoID, int(fairLaunchMintedInfo.ID), fairLaunchMintedInfo.MintedNumber)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "LockInventory")
+		}
+		// The mint is worth what the rows locked above hold, which SKIP LOCKED may have picked past the
+		// rows the addr was priced against. The addr has to receive exactly that.
+		amount := CalculateInventoryAmount(mintInventoryInfos)
+		if amount != fairLaunchMintedInfo.AddrAmount {
+			return errors.New("addr amount " + strconv.Itoa(fairLaunchMintedInfo.AddrAmount) + " is not equal minted amount " + strconv.Itoa(amount))
+		}
+		return nil
+	})
 }
 
 func ProcessFairLaunchInfo(imageData string, name string, assetType int, amount int, reserved int, mintQuantity int, startTime int, endTime int, description string, feeRate int, userId int, username string) (*models.FairLaunchInfo, error) {
@@ -278,12 +315,21 @@ func ValidateStartAndEndTime(startTime int, endTime int) error {
 	return nil
 }
 
+// The fee rate, tapd and custody calls of a mint request, replaced in the tests.
+var (
+	mintGasFeeRate      = UpdateAndCalculateGasFeeRateByMempool
+	mintDecodeAddr      = api.GetDecodedAddrInfo
+	mintBalanceIsEnough = func(userId uint, amount uint64) bool {
+		return custodyFee.IsAccountBalanceEnoughByUserId(userId, amount)
+	}
+)
+
 func ProcessFairLaunchMintedInfo(fairLaunchInfoID int, mintedNumber int, mintedFeeRateSatPerKw int, addr string, userId int, username string) (*models.FairLaunchMintedInfo, error) {
 	if FeeRateSatPerKwToSatPerB(mintedFeeRateSatPerKw) > 500 {
 		return nil, errors.New("fee rate exceeds max(500)" + "; " + strconv.Itoa(mintedFeeRateSatPerKw))
 	}
 
-	feeRateResponse, err := UpdateAndCalculateGasFeeRateByMempool(mintedNumber)
+	feeRateResponse, err := mintGasFeeRate(mintedNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -312,7 +358,7 @@ func ProcessFairLaunchMintedInfo(fairLaunchInfoID int, mintedNumber int, mintedF
 		err = errors.New("not valid mint time")
 		return nil, err
 	}
-	decodedAddrInfo, err := api.GetDecodedAddrInfo(addr)
+	decodedAddrInfo, err := mintDecodeAddr(addr)
 	if err != nil {
 		return nil, utils.AppendErrorInfo(err, "GetDecodedAddrInfo")
 	}
@@ -333,7 +379,7 @@ func ProcessFairLaunchMintedInfo(fairLaunchInfoID int, mintedNumber int, mintedF
 	}
 	mintedGasFee := GetMintedTransactionGasFee(mintedFeeRateSatPerKw)
 	notPayAmount := CalculateAllNotPayAmount(username)
-	if !custodyFee.IsAccountBalanceEnoughByUserId(uint(userId), uint64(mintedGasFee)+uint64(notPayAmount)) {
+	if !mintBalanceIsEnough(uint(userId), uint64(mintedGasFee)+uint64(notPayAmount)) {
 		return nil, errors.New("account balance not enough to pay minted gas fee")
 	}
 	fairLaunchMintedInfo = models.FairLaunchMintedInfo{
@@ -562,32 +608,55 @@ func GetMintAmountByFairLaunchMintNumber(fairLaunchInfoId int, number int) (amou
 }
 
 func LockInventoryByFairLaunchMintedIdAndMintNumber(fairLaunchMintedInfoId int, number int) (*[]models.FairLaunchInventoryInfo, error) {
-	if number <= 0 {
-		err := errors.New("mint number must be greater than zero")
-		return nil, err
-	}
 	fairLaunchMintedInfo, err := GetFairLaunchMintedInfo(fairLaunchMintedInfoId)
 	if err != nil {
 		return nil, utils.AppendErrorInfo(err, "GetFairLaunchMintedInfo")
 	}
-	fairLaunchInventoryInfos, err := GetInventoryCouldBeMintedByFairLaunchInfoId(fairLaunchMintedInfo.FairLaunchInfoID)
+	var mintInventoryInfos *[]models.FairLaunchInventoryInfo
+	err = middleware.DB.Transaction(func(tx *gorm.DB) error {
+		mintInventoryInfos, err = LockInventory(tx, fairLaunchMintedInfo.FairLaunchInfoID, fairLaunchMintedInfoId, number)
+		return err
+	})
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "LockInventory")
+	}
+	return mintInventoryInfos, nil
+}
+
+// LockInventory allocates number open inventories of the fair launch to the minted info. The rows are selected
+// FOR UPDATE SKIP LOCKED, so concurrent mints take different rows, and stay locked until tx ends.
+func LockInventory(tx *gorm.DB, fairLaunchInfoId int, fairLaunchMintedInfoId int, number int) (*[]models.FairLaunchInventoryInfo, error) {
+	if number <= 0 {
+		err := errors.New("mint number must be greater than zero")
+		return nil, err
+	}
+	var mintInventoryInfos []models.FairLaunchInventoryInfo
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("fair_launch_info_id = ? AND is_minted = ? AND state = ?", fairLaunchInfoId, false, models.FairLaunchInventoryStateOpen).
+		Order("id").
+		Limit(number).
+		Find(&mintInventoryInfos).Error
 	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetInventoryCouldBeMintedByFairLaunchInfoId")
+		return nil, utils.AppendErrorInfo(err, "Find fairLaunchInventoryInfos")
 	}
-	allNum := len(*fairLaunchInventoryInfos)
-	if allNum < number {
+	if len(mintInventoryInfos) < number {
 		err = errors.New("not enough mint amount")
 		return nil, err
 	}
-	mintInventoryInfos := (*fairLaunchInventoryInfos)[:number]
-
-	err = middleware.DB.Model(&mintInventoryInfos).Updates(map[string]any{"state": models.FairLaunchInventoryStateLocked, "fair_launch_minted_info_id": fairLaunchMintedInfoId}).Error
+	err = tx.Model(&mintInventoryInfos).Updates(map[string]any{"state": models.FairLaunchInventoryStateLocked, "fair_launch_minted_info_id": fairLaunchMintedInfoId}).Error
 	if err != nil {
 		return nil, utils.AppendErrorInfo(err, "Updates mintInventoryInfos")
 	}
 	return &mintInventoryInfos, nil
 }
 
+// ReleaseInventoryByFairLaunchMintedInfoId opens again the inventory locked by a failed mint.
+func ReleaseInventoryByFairLaunchMintedInfoId(tx *gorm.DB, fairLaunchMintedInfoId uint) error {
+	return tx.Model(&models.FairLaunchInventoryInfo{}).
+		Where("fair_launch_minted_info_id = ? AND state = ?", fairLaunchMintedInfoId, models.FairLaunchInventoryStateLocked).
+		Updates(map[string]any{"state": models.FairLaunchInventoryStateOpen, "fair_launch_minted_info_id": 0}).Error
+}
+
 func CalculateMintAmountByFairLaunchInventoryInfos(fairLaunchInventoryInfos *[]models.FairLaunchInventoryInfo) (amount int) {
 	for _, inventory := range *fairLaunchInventoryInfos {
 		amount += inventory.Quantity
@@ -682,339 +751,31 @@ type ProcessionResult struct {
 }
 
 func ProcessAllFairLaunchInfos(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
 	allFairLaunchInfos, err := GetAllValidFairLaunchInfos()
 	if err != nil {
 		return nil, utils.AppendErrorInfo(err, "GetAllValidFairLaunchInfos")
 	}
-	for _, fairLaunchInfo := range *allFairLaunchInfos {
-		if fairLaunchInfo.State == models.FairLaunchStateNoPay {
-			err = ProcessFairLaunchStateNoPayInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		} else if fairLaunchInfo.State == models.FairLaunchStatePaidPending {
-			err = ProcessFairLaunchStatePaidPendingInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		} else if fairLaunchInfo.State == models.FairLaunchStatePaidNoIssue {
-			err = ProcessFairLaunchStatePaidNoIssueInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		} else if fairLaunchInfo.State == models.FairLaunchStateIssuedPending {
-			err = ProcessFairLaunchStateIssuedPendingInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		} else if fairLaunchInfo.State == models.FairLaunchStateReservedSentPending {
-			err = ProcessFairLaunchStateReservedSentPending(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(fairLaunchInfoWorkflow.Process(tx, *allFairLaunchInfos))
 }
 
 func ProcessAllFairLaunchStateNoPayInfoService(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	fairLaunchInfos, err := GetAllFairLaunchStateNoPayInfos()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllFairLaunchStateNoPayInfos")
-	}
-	for _, fairLaunchInfo := range *fairLaunchInfos {
-		{
-			err = IncreaseFairLaunchInfoProcessNumber(tx, &fairLaunchInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchStateNoPayInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(fairLaunchInfoWorkflow.Run(tx, int(models.FairLaunchStateNoPay)))
 }
 
 func ProcessAllFairLaunchStatePaidPendingInfoService(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	fairLaunchInfos, err := GetAllFairLaunchStatePaidPendingInfos()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllFairLaunchStatePaidPendingInfos")
-	}
-	for _, fairLaunchInfo := range *fairLaunchInfos {
-		{
-			err = IncreaseFairLaunchInfoProcessNumber(tx, &fairLaunchInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchStatePaidPendingInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(fairLaunchInfoWorkflow.Run(tx, int(models.FairLaunchStatePaidPending)))
 }
 
 func ProcessAllFairLaunchStatePaidNoIssueInfoService(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	fairLaunchInfos, err := GetAllFairLaunchStatePaidNoIssueInfos()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllFairLaunchStatePaidNoIssueInfos")
-	}
-	for _, fairLaunchInfo := range *fairLaunchInfos {
-		{
-			err = IncreaseFairLaunchInfoProcessNumber(tx, &fairLaunchInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchStatePaidNoIssueInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(fairLaunchInfoWorkflow.Run(tx, int(models.FairLaunchStatePaidNoIssue)))
 }
 
 func ProcessAllFairLaunchStateIssuedPendingInfoService(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	fairLaunchInfos, err := GetAllFairLaunchStateIssuedPendingInfos()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllFairLaunchStateIssuedPendingInfos")
-	}
-	for _, fairLaunchInfo := range *fairLaunchInfos {
-		{
-			err = IncreaseFairLaunchInfoProcessNumber(tx, &fairLaunchInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchStateIssuedPendingInfoService(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(fairLaunchInfoWorkflow.Run(tx, int(models.FairLaunchStateIssuedPending)))
 }
 
 func ProcessAllFairLaunchStateReservedSentPending(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	fairLaunchInfos, err := GetAllFairLaunchStateReservedSentPending()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllFairLaunchStateReservedSentPending")
-	}
-	for _, fairLaunchInfo := range *fairLaunchInfos {
-		{
-			err = IncreaseFairLaunchInfoProcessNumber(tx, &fairLaunchInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchStateReservedSentPending(tx, &fairLaunchInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(fairLaunchInfoWorkflow.Run(tx, int(models.FairLaunchStateReservedSentPending)))
 }
 
 func UpdateFairLaunchInfoPaidId(tx *gorm.DB, fairLaunchInfo *models.FairLaunchInfo, paidId int) (err error) {
@@ -1432,146 +1193,23 @@ func GetValidFairLaunchMintedInfosByState(state models.FairLaunchMintedState) (f
 }
 
 func ProcessAllFairLaunchMintedInfos(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
 	allFairLaunchMintedInfos, err := GetAllValidFairLaunchMintedInfosExcludeSentPending()
 	if err != nil {
 		return nil, utils.AppendErrorInfo(err, "GetAllValidFairLaunchMintedInfosExcludeSentPending")
 	}
-
-	for _, fairLaunchMintedInfo := range *allFairLaunchMintedInfos {
-		if fairLaunchMintedInfo.State == models.FairLaunchMintedStateNoPay {
-			err = IncreaseFairLaunchMintedInfoProcessNumber(tx, &fairLaunchMintedInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchMintedStateNoPayInfo(tx, &fairLaunchMintedInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchMintedInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchMintedInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		} else if fairLaunchMintedInfo.State == models.FairLaunchMintedStatePaidPending {
-			err = IncreaseFairLaunchMintedInfoProcessNumber(tx, &fairLaunchMintedInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchMintedStatePaidPendingInfo(tx, &fairLaunchMintedInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchMintedInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchMintedInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		} else if fairLaunchMintedInfo.State == models.FairLaunchMintedStatePaidNoSend {
-			err = IncreaseFairLaunchMintedInfoProcessNumber(tx, &fairLaunchMintedInfo)
-			if err != nil {
-
-			}
-			err = ProcessFairLaunchMintedStatePaidNoSendInfo(tx, &fairLaunchMintedInfo)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchMintedInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(fairLaunchMintedInfo.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(fairLaunchMintedInfoWorkflow.Process(tx, *allFairLaunchMintedInfos))
 }
 
 func ProcessAllFairLaunchMintedSentPendingInfos(tx *gorm.DB) (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	allFairLaunchMintedInfos, err := GetValidFairLaunchMintedInfosByState(models.FairLaunchMintedStateSentPending)
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllValidFairLaunchMintedInfosExcludeSentPending")
-	}
 	listTransfersResponse, err := api.ListTransfersAndGetResponse()
 	if err != nil {
 		return nil, utils.AppendErrorInfo(err, "List Transfers And Get Response")
 	}
-
-	for _, fairLaunchMintedInfo := range *allFairLaunchMintedInfos {
-
-		err = IncreaseFairLaunchMintedInfoProcessNumber(tx, &fairLaunchMintedInfo)
-		if err != nil {
-
-		}
-		err = ProcessFairLaunchMintedStateSentPendingInfo(tx, &fairLaunchMintedInfo, listTransfersResponse)
-		if err != nil {
-			processionResults = append(processionResults, ProcessionResult{
-				Id: int(fairLaunchMintedInfo.ID),
-				JsonResult: models.JsonResult{
-					Success: false,
-					Error:   err.Error(),
-					Data:    nil,
-				},
-			})
-			continue
-		} else {
-			processionResults = append(processionResults, ProcessionResult{
-				Id: int(fairLaunchMintedInfo.ID),
-				JsonResult: models.JsonResult{
-					Success: true,
-					Error:   "",
-					Data:    nil,
-				},
-			})
-		}
-	}
-
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	// The transfers are listed once for all the infos of the run.
+	results, err := fairLaunchMintedInfoWorkflow.RunWith(tx, int(models.FairLaunchMintedStateSentPending), func(tx *gorm.DB, fairLaunchMintedInfo *models.FairLaunchMintedInfo) error {
+		return ProcessFairLaunchMintedStateSentPendingInfo(tx, fairLaunchMintedInfo, listTransfersResponse)
+	})
+	return workflowProcessionResults(results, err)
 }
 
 func UpdateFairLaunchMintedInfoPaidId(tx *gorm.DB, fairLaunchMintedInfo *models.FairLaunchMintedInfo, paidId int) (err error) {
@@ -1591,7 +1229,16 @@ func ChangeFairLaunchMintedInfoStateAndUpdatePaidSuccessTime(tx *gorm.DB, fairLa
 	fairLaunchMintedInfo.State = models.FairLaunchMintedStatePaidNoSend
 	fairLaunchMintedInfo.PaidSuccessTime = utils.GetTimestamp()
 	f := btldb.FairLaunchStore{DB: middleware.DB}
-	return f.UpdateFairLaunchMintedInfo(tx, fairLaunchMintedInfo)
+	err = f.UpdateFairLaunchMintedInfo(tx, fairLaunchMintedInfo)
+	if err != nil {
+		return err
+	}
+	return satBackQueue.EnqueueClaimAsset(tx, satBackQueue.FeeInfo{
+		ID:       fairLaunchMintedInfo.ID,
+		NpubKey:  fairLaunchMintedInfo.Username,
+		AssetsID: fairLaunchMintedInfo.AssetID,
+		HandFee:  fairLaunchMintedInfo.MintedGasFee,
+	})
 }
 
 func LockInventoryByFairLaunchMintedInfo(fairLaunchMintedInfo *models.FairLaunchMintedInfo) (lockedInventory *[]models.FairLaunchInventoryInfo, err error) {
@@ -1842,7 +1489,13 @@ func ClearFairLaunchMintedInfoProcessNumber(tx *gorm.DB, fairLaunchMintedInfo *m
 }
 
 func CancelFairLaunchMintedInfo(fairLaunchMintedInfoId uint) (err error) {
-	return middleware.DB.Model(&models.FairLaunchMintedInfo{}).Where("id = ?", fairLaunchMintedInfoId).Update("state", models.FairLaunchMintedStateFail).Error
+	return middleware.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.FairLaunchMintedInfo{}).Where("id = ?", fairLaunchMintedInfoId).Update("state", models.FairLaunchMintedStateFail).Error
+		if err != nil {
+			return err
+		}
+		return ReleaseInventoryByFairLaunchMintedInfoId(tx, fairLaunchMintedInfoId)
+	})
 }
 
 func IncreaseFairLaunchMintedInfoProcessNumber(tx *gorm.DB, fairLaunchMintedInfo *models.FairLaunchMintedInfo) (err error) {
@@ -1888,7 +1541,12 @@ func ProcessFairLaunchMintedStateNoPayInfo(tx *gorm.DB, fairLaunchMintedInfo *mo
 
 	payMintedFeeResult, err := PayMintFee(fairLaunchMintedInfo.UserID, fairLaunchMintedInfo.MintedFeeRateSatPerKw)
 	if err != nil {
-		return CancelFairLaunchMintedInfo(fairLaunchMintedInfo.ID)
+		err = CancelFairLaunchMintedInfo(fairLaunchMintedInfo.ID)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "CancelFairLaunchMintedInfo")
+		}
+		fairLaunchMintedInfo.State = models.FairLaunchMintedStateFail
+		return nil
 	}
 
 	err = CreateFairLaunchIncomeOfUserPayMintedFee(tx, fairLaunchMintedInfo.AssetID, fairLaunchMintedInfo.FairLaunchInfoID, int(fairLaunchMintedInfo.ID), payMintedFeeResult.PaidId, payMintedFeeResult.Fee, fairLaunchMintedInfo.UserID, fairLaunchMintedInfo.Username)
@@ -1996,7 +1654,7 @@ func ProcessFairLaunchMintedStateSentPendingInfo(tx *gorm.DB, fairLaunchMintedIn
 			AccountId:   custodyAccount.AdminUserInfo.Account.ID,
 			BillType:    models.BillTypeAssetMintedSend,
 			Away:        models.AWAY_OUT,
-			Amount:      float64(fairLaunchMintedInfo.AddrAmount),
+			Amount:      custodyModels.NewAmountFromInt(int64(fairLaunchMintedInfo.AddrAmount)),
 			Unit:        models.UNIT_ASSET_NORMAL,
 			AssetId:     &(fairLaunchMintedInfo.AssetID),
 			Invoice:     &(fairLaunchMintedInfo.EncodedAddr),
@@ -2489,23 +2147,28 @@ func UpdateFairLaunchMintedAndAvailableInfoByFairLaunchMintedInfo(tx *gorm.DB, f
 	if fairLaunchMintedInfo == nil || fairLaunchMintedInfo.MintedNumber == 0 {
 		return errors.New("invalid fair launch minted info or minted number is zero")
 	}
-	mintedAndAvailableInfo, err := GetFairLaunchMintedAndAvailableInfoByFairLaunchInfoId(fairLaunchMintedInfo.FairLaunchInfoID)
+	var mintedAndAvailableInfo models.FairLaunchMintedAndAvailableInfo
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("fair_launch_info_id = ?", fairLaunchMintedInfo.FairLaunchInfoID).
+		First(&mintedAndAvailableInfo).Error
 	if err != nil {
 		return err
 	}
 	number := fairLaunchMintedInfo.MintedNumber
-
-	fmt.Println(number)
-	var amount int
 	if number > mintedAndAvailableInfo.AvailableNumber {
 		return errors.New("minted number " + strconv.Itoa(number) + " exceeds available number")
-	} else if number == mintedAndAvailableInfo.AvailableNumber {
-		amount = (number-1)*mintedAndAvailableInfo.MintQuantity + mintedAndAvailableInfo.FinalQuantity
-	} else {
-		amount = number * mintedAndAvailableInfo.MintQuantity
 	}
-
-	fmt.Println(number)
+	// The amount is what the inventory locked for the mint holds. SKIP LOCKED may have passed over rows
+	// of other mints, so it can not be told from the available number.
+	var mintInventoryInfos []models.FairLaunchInventoryInfo
+	err = tx.Where("fair_launch_minted_info_id = ?", fairLaunchMintedInfo.ID).Find(&mintInventoryInfos).Error
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Find fairLaunchInventoryInfos")
+	}
+	if len(mintInventoryInfos) != number {
+		return errors.New("minted info holds " + strconv.Itoa(len(mintInventoryInfos)) + " inventories, minted number is " + strconv.Itoa(number))
+	}
+	amount := CalculateInventoryAmount(&mintInventoryInfos)
 	if amount != fairLaunchMintedInfo.AddrAmount {
 		return errors.New("minted amount " + strconv.Itoa(amount) + " is not equal minted info's addr amount " + strconv.Itoa(fairLaunchMintedInfo.AddrAmount))
 	}
@@ -2526,8 +2189,7 @@ func UpdateFairLaunchMintedAndAvailableInfoByFairLaunchMintedInfo(tx *gorm.DB, f
 		return errors.New("available amount " + strconv.Itoa(mintedAndAvailableInfo.AvailableAmount) + " is less than zero")
 	}
 
-	fmt.Println(utils.ValueJsonString(mintedAndAvailableInfo))
-	return btldb.UpdateFairLaunchMintedAndAvailableInfo(tx, mintedAndAvailableInfo)
+	return btldb.UpdateFairLaunchMintedAndAvailableInfo(tx, &mintedAndAvailableInfo)
 }
 
 func GetAmountCouldBeMintByMintedNumber(fairLaunchInfoID int, mintedNumber int) (int, error) {
@@ -2654,7 +2316,11 @@ func UpdateFairLaunchMintedInfo(tx *gorm.DB, fairLaunchMintedInfo *models.FairLa
 
 func SetFairLaunchMintedInfoFail(tx *gorm.DB, fairLaunchMintedInfo *models.FairLaunchMintedInfo) error {
 	fairLaunchMintedInfo.State = models.FairLaunchMintedStateFail
-	return UpdateFairLaunchMintedInfo(tx, fairLaunchMintedInfo)
+	err := UpdateFairLaunchMintedInfo(tx, fairLaunchMintedInfo)
+	if err != nil {
+		return err
+	}
+	return ReleaseInventoryByFairLaunchMintedInfoId(tx, fairLaunchMintedInfo.ID)
 }
 
 func CancelAndRefundFairLaunchMintedInfo(tx *gorm.DB, fairLaunchMintedInfoId int) (BackAmountMissionId int, err error) {
@@ -2675,6 +2341,8 @@ func CancelAndRefundFairLaunchMintedInfo(tx *gorm.DB, fairLaunchMintedInfoId int
 	return int(missionId), nil
 }
 
+// Deprecated: the workflow fails and refunds a mint once its transition is out of attempts, there are no
+// blocked mints left to refund.
 func RefundBlockFairLaunchMintedInfos(tx *gorm.DB) (missionIds []int, err error) {
 	fairLaunchMintedInfos, err := GetFairLaunchMintedInfoWhoseProcessNumberIsMoreThanTenThousand()
 	if err != nil {
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"trade/middleware"
+	"trade/models"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/lightninglabs/taproot-assets/taprpc"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fairLaunchMysqlDsnEnv names a scratch MySQL 8 database for the inventory tests. SKIP LOCKED needs a real
+// server, so they are skipped without it. The tests drop and recreate their tables, so they refuse to run
+// against a database whose name does not say it is for tests.
+const fairLaunchMysqlDsnEnv = "TRADE_TEST_MYSQL_DSN"
+
+func setupFairLaunchMysqlTest(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv(fairLaunchMysqlDsnEnv)
+	if dsn == "" {
+		t.Skip(fairLaunchMysqlDsnEnv + " is not set")
+	}
+	cfg, err := mysqlDriver.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("parse %s: %v", fairLaunchMysqlDsnEnv, err)
+	}
+	if !strings.Contains(strings.ToLower(cfg.DBName), "test") {
+		t.Fatalf("%s names database %q, the tests drop their tables and only run on a database named for tests", fairLaunchMysqlDsnEnv, cfg.DBName)
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []any{&models.User{}, &models.FairLaunchInfo{}, &models.FairLaunchMintedInfo{}, &models.FairLaunchInventoryInfo{}}
+	if err = db.Migrator().DropTable(tables...); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	old := middleware.DB
+	middleware.DB = db
+	t.Cleanup(func() {
+		middleware.DB = old
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
+
+// stubMintCalls answers the fee rate, tapd and custody calls of a mint request: the addr decodes to amount of
+// the asset and every balance is enough.
+func stubMintCalls(t *testing.T, assetId []byte, amount int) {
+	t.Helper()
+	oldFeeRate, oldDecode, oldBalance := mintGasFeeRate, mintDecodeAddr, mintBalanceIsEnough
+	mintGasFeeRate = func(number int) (*FeeRateResponseTransformed, error) {
+		return &FeeRateResponseTransformed{SatPerKw: MempoolFeeRate{
+			FastestFee: FeeRateSatPerBToSatPerKw(5),
+			MinimumFee: FeeRateSatPerBToSatPerKw(1),
+		}}, nil
+	}
+	mintDecodeAddr = func(addr string) (*taprpc.Addr, error) {
+		return &taprpc.Addr{Encoded: addr, AssetId: assetId, Amount: uint64(amount)}, nil
+	}
+	mintBalanceIsEnough = func(userId uint, amount uint64) bool {
+		return true
+	}
+	t.Cleanup(func() {
+		mintGasFeeRate, mintDecodeAddr, mintBalanceIsEnough = oldFeeRate, oldDecode, oldBalance
+	})
+}
+
+// mintFairLaunch makes a mint request the way the mint handler does.
+func mintFairLaunch(fairLaunchInfoId int, mintedNumber int, user models.User) error {
+	fairLaunchMintedInfo, err := ProcessFairLaunchMintedInfo(fairLaunchInfoId, mintedNumber, FeeRateSatPerBToSatPerKw(10), "addr", int(user.ID), user.Username)
+	if err != nil {
+		return err
+	}
+	return SetFairLaunchMintedInfo(fairLaunchMintedInfo)
+}
+
+func TestFairLaunchMintConcurrent(t *testing.T) {
+	setupFairLaunchMysqlTest(t)
+	const (
+		userNumber   = 8
+		mintsPerUser = 5
+		mintedNumber = 2 // mintsPerUser * mintedNumber is the mint cap
+		quantity     = 100
+	)
+	assetId := []byte{0xfa, 0x12}
+	stubMintCalls(t, assetId, mintedNumber*quantity)
+	now := int(time.Now().Unix())
+	fairLaunchInfo := models.FairLaunchInfo{Name: "fair", AssetID: fmt.Sprintf("%x", assetId), StartTime: now - 60, EndTime: now + 3600}
+	if err := middleware.DB.Create(&fairLaunchInfo).Error; err != nil {
+		t.Fatal(err)
+	}
+	fairLaunchInfoId := int(fairLaunchInfo.ID)
+	inventoryNumber := userNumber * mintsPerUser * mintedNumber
+	inventories := make([]models.FairLaunchInventoryInfo, inventoryNumber)
+	for i := range inventories {
+		inventories[i] = models.FairLaunchInventoryInfo{
+			FairLaunchInfoID: fairLaunchInfoId,
+			Quantity:         quantity,
+			State:            models.FairLaunchInventoryStateOpen,
+		}
+	}
+	if err := middleware.DB.Create(&inventories).Error; err != nil {
+		t.Fatal(err)
+	}
+	users := make([]models.User, userNumber)
+	for i := range users {
+		users[i] = models.User{Username: fmt.Sprintf("minter%d", i)}
+	}
+	if err := middleware.DB.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, userNumber*mintsPerUser)
+	for _, user := range users {
+		for range mintsPerUser {
+			wg.Add(1)
+			go func(user models.User) {
+				defer wg.Done()
+				errs <- mintFairLaunch(fairLaunchInfoId, mintedNumber, user)
+			}(user)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("mint: %v", err)
+		}
+	}
+
+	var locked []models.FairLaunchInventoryInfo
+	if err := middleware.DB.Where("fair_launch_info_id = ?", fairLaunchInfoId).Find(&locked).Error; err != nil {
+		t.Fatal(err)
+	}
+	perMint := make(map[int]int)
+	for _, inventory := range locked {
+		if inventory.State != models.FairLaunchInventoryStateLocked || inventory.FairLaunchMintedInfoID == 0 {
+			t.Fatalf("inventory %d is not locked to a mint: state %d, minted info %d", inventory.ID, inventory.State, inventory.FairLaunchMintedInfoID)
+		}
+		perMint[inventory.FairLaunchMintedInfoID]++
+	}
+	if len(perMint) != userNumber*mintsPerUser {
+		t.Fatalf("inventory locked to %d mints, want %d", len(perMint), userNumber*mintsPerUser)
+	}
+	for mintedInfoId, n := range perMint {
+		if n != mintedNumber {
+			t.Errorf("mint %d holds %d inventories, want %d", mintedInfoId, n, mintedNumber)
+		}
+	}
+
+	// The inventory is sold out, and every user is at the mint cap.
+	stubMintCalls(t, assetId, quantity)
+	if err := mintFairLaunch(fairLaunchInfoId, 1, users[0]); err == nil {
+		t.Fatal("mint past the inventory succeeded")
+	}
+}
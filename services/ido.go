@@ -34,7 +34,7 @@ func GetIdoParticipateInfo(id int) (*models.IdoParticipateInfo, error) {
 
 func GetIdoPublishedInfos() (*[]models.IdoPublishInfo, error) {
 	var idoPublishInfos []models.IdoPublishInfo
-	err := middleware.DB.Where("state >= ?", models.IdoParticipateStateSent).Order("set_time").Find(&idoPublishInfos).Error
+	err := middleware.DB.Where("state >= ?", models.IdoPublishStatePublished).Order("set_time").Find(&idoPublishInfos).Error
 	errorAppendInfo := utils.ErrorAppendInfo(err)
 	if err != nil {
 		return nil, errorAppendInfo(utils.ToLowerWords("IdoPublishInfoFind"))
@@ -71,6 +71,9 @@ func ProcessIdoPublishInfo(userId int, assetID string, totalAmount int, minimumQ
 	if err != nil {
 		return nil, errorAppendInfo("validate start and end time")
 	}
+	if totalAmount <= 0 || unitPrice <= 0 {
+		return nil, errorAppendInfo("total amount and unit price must be positive")
+	}
 	var idoPublishInfo models.IdoPublishInfo
 
 	setGasFee := GetIdoPublishTransactionGasFee(feeRate)
@@ -0,0 +1,743 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/lightninglabs/taproot-assets/taprpc"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"strconv"
+	"trade/api"
+	"trade/btlLog"
+	"trade/middleware"
+	"trade/models"
+	"trade/services/btldb"
+	"trade/services/custodyAccount/defaultAccount/custodyFee"
+	"trade/services/custodyAccount/lockPayment"
+	"trade/utils"
+)
+
+// An ido publish goes NoPay -> PaidPending -> PaidNoPublish, where the issuer deposits TotalAmount to the
+// escrow address, -> PublishedPending -> Published. After EndTime it settles to RefundedPending, or straight
+// to Refunded when sold out. Participants pay the price into a lock when processed, their assets are sent
+// in one batch per ido after the settlement.
+
+const idoPaymentAssetId = "00"
+
+const (
+	// idoSendBatchSize caps the participations of an ido sent in one transaction, the rest go in later runs.
+	idoSendBatchSize = 100
+	// idoSendLeaseSecond is how long a labelled send may take to show up in tapd's transfers. A label still
+	// missing after that was never sent and is cleared for a new send.
+	idoSendLeaseSecond = 600
+)
+
+// errIdoGasFeeUnknown is a gas fee payment or back which was started and whose outcome was lost.
+var errIdoGasFeeUnknown = errors.New("gas fee outcome is unknown")
+
+// The custody and tapd calls of the ido processing, replaced in the tests.
+var (
+	idoPayGasFee  = PayGasFee
+	idoBackGasFee = func(paidId int) (int, error) {
+		missionId, err := custodyFee.BackFirLunchFee(uint(paidId))
+		return int(missionId), err
+	}
+	idoTransferByLock      = lockPayment.TransferByLock
+	idoUnlock              = lockPayment.Unlock
+	idoFindTransferByLabel = api.FindTransferByLabel
+)
+
+// findIdoTransfer looks up the transfer of a send labelled at sendTime. A nil transfer with retry set means
+// the send never reached tapd and may be made again, with neither set the outcome is not known yet.
+func findIdoTransfer(label string, sendTime int) (transfer *taprpc.AssetTransfer, retry bool, err error) {
+	transfer, err = idoFindTransferByLabel(label, int64(sendTime))
+	if err != nil {
+		return nil, false, utils.AppendErrorInfo(err, "FindTransferByLabel")
+	}
+	if transfer == nil && utils.GetTimestamp()-sendTime > idoSendLeaseSecond {
+		return nil, true, nil
+	}
+	return transfer, false, nil
+}
+
+func idoLockId(action string, idoParticipateInfoId uint) string {
+	return "ido_participate_" + action + "_" + strconv.Itoa(int(idoParticipateInfoId))
+}
+
+// payIdoGasFee pays the gas fee of an ido publish or participation once. The pay time is committed on its
+// row before the payment and the paid id right after it, outside the workflow tx, so a rolled back tx
+// neither loses the payment nor lets the retry pay again. A pay time without a paid id is a payment whose
+// outcome was lost, it is not paid again but left to the operator.
+func payIdoGasFee(model any, userId int, gasFee int, feePaidId *int, feePayTime *int) error {
+	if *feePaidId != 0 {
+		return nil
+	}
+	if *feePayTime != 0 {
+		return fmt.Errorf("%w: payment started at %d has no paid id", errIdoGasFeeUnknown, *feePayTime)
+	}
+	payTime := utils.GetTimestamp()
+	result := middleware.DB.Model(model).Where("fee_paid_id = 0 AND fee_pay_time = 0").Update("fee_pay_time", payTime)
+	if result.Error != nil {
+		return utils.AppendErrorInfo(result.Error, "Update fee_pay_time")
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: payment has already been started", errIdoGasFeeUnknown)
+	}
+	*feePayTime = payTime
+	paidId, err := idoPayGasFee(userId, gasFee)
+	if err != nil {
+		// The payment was refused, the next attempt may pay again.
+		if releaseErr := middleware.DB.Model(model).Update("fee_pay_time", 0).Error; releaseErr != nil {
+			return fmt.Errorf("%w: %w; release: %w", errIdoGasFeeUnknown, err, releaseErr)
+		}
+		*feePayTime = 0
+		return err
+	}
+	*feePaidId = paidId
+	err = middleware.DB.Model(model).Update("fee_paid_id", paidId).Error
+	if err != nil {
+		btlLog.FairLaunchDebugLogger.Error("gas fee paid as %d is not recorded: %v", paidId, err)
+		return utils.AppendErrorInfo(err, "Update fee_paid_id")
+	}
+	return nil
+}
+
+// backIdoGasFee gives back the gas fee paid as feePaidId once, claimed and recorded like payIdoGasFee.
+func backIdoGasFee(model any, feePaidId int, feeBackId *int, feeBackTime *int) error {
+	if *feeBackId != 0 {
+		return nil
+	}
+	if *feeBackTime != 0 {
+		return fmt.Errorf("%w: back started at %d has no back id", errIdoGasFeeUnknown, *feeBackTime)
+	}
+	backTime := utils.GetTimestamp()
+	result := middleware.DB.Model(model).Where("fee_back_id = 0 AND fee_back_time = 0").Update("fee_back_time", backTime)
+	if result.Error != nil {
+		return utils.AppendErrorInfo(result.Error, "Update fee_back_time")
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: back has already been started", errIdoGasFeeUnknown)
+	}
+	*feeBackTime = backTime
+	backId, err := idoBackGasFee(feePaidId)
+	if err != nil {
+		if releaseErr := middleware.DB.Model(model).Update("fee_back_time", 0).Error; releaseErr != nil {
+			return fmt.Errorf("%w: %w; release: %w", errIdoGasFeeUnknown, err, releaseErr)
+		}
+		*feeBackTime = 0
+		return err
+	}
+	*feeBackId = backId
+	err = middleware.DB.Model(model).Update("fee_back_id", backId).Error
+	if err != nil {
+		btlLog.FairLaunchDebugLogger.Error("gas fee %d given back as %d is not recorded: %v", feePaidId, backId, err)
+		return utils.AppendErrorInfo(err, "Update fee_back_id")
+	}
+	return nil
+}
+
+func GetIdoParticipateCost(idoPublishInfo *models.IdoPublishInfo, idoParticipateInfo *models.IdoParticipateInfo) decimal.Decimal {
+	return decimal.NewFromInt(int64(idoParticipateInfo.BoughtAmount)).Mul(decimal.NewFromInt(int64(idoPublishInfo.UnitPrice)))
+}
+
+func UpdateIdoPublishInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	return tx.Save(idoPublishInfo).Error
+}
+
+func UpdateIdoParticipateInfo(tx *gorm.DB, idoParticipateInfo *models.IdoParticipateInfo) error {
+	return tx.Save(idoParticipateInfo).Error
+}
+
+func SetIdoPublishInfoFail(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	idoPublishInfo.Status = models.IdoStatusDeprecated
+	return UpdateIdoPublishInfo(tx, idoPublishInfo)
+}
+
+func SetIdoParticipateInfoFail(tx *gorm.DB, idoParticipateInfo *models.IdoParticipateInfo) error {
+	idoParticipateInfo.Status = models.IdoStatusDeprecated
+	return UpdateIdoParticipateInfo(tx, idoParticipateInfo)
+}
+
+func GetAllIdoPublishInfosByState(state models.IdoPublishState) (*[]models.IdoPublishInfo, error) {
+	var idoPublishInfos []models.IdoPublishInfo
+	err := middleware.DB.Where("status = ? AND state = ?", models.IdoStatusNormal, state).Find(&idoPublishInfos).Error
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "Find idoPublishInfos")
+	}
+	return &idoPublishInfos, nil
+}
+
+// GetAllIdoPublishInfosToSettle returns the published idos whose participate time is over.
+func GetAllIdoPublishInfosToSettle() (*[]models.IdoPublishInfo, error) {
+	var idoPublishInfos []models.IdoPublishInfo
+	err := middleware.DB.Where("status = ? AND state = ? AND end_time <= ?", models.IdoStatusNormal, models.IdoPublishStatePublished, utils.GetTimestamp()).Find(&idoPublishInfos).Error
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "Find idoPublishInfos")
+	}
+	return &idoPublishInfos, nil
+}
+
+func GetAllIdoParticipateInfosByState(state models.IdoParticipateState) (*[]models.IdoParticipateInfo, error) {
+	var idoParticipateInfos []models.IdoParticipateInfo
+	err := middleware.DB.Where("status = ? AND state = ?", models.IdoStatusNormal, state).Find(&idoParticipateInfos).Error
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "Find idoParticipateInfos")
+	}
+	return &idoParticipateInfos, nil
+}
+
+// GetAllIdoParticipateInfosToSend returns the participations kept by the settlement of their ido.
+func GetAllIdoParticipateInfosToSend() (*[]models.IdoParticipateInfo, error) {
+	var idoParticipateInfos []models.IdoParticipateInfo
+	err := middleware.DB.Table("ido_participate_infos AS p").
+		Select("p.*").
+		Joins("JOIN ido_publish_infos AS i ON i.id = p.ido_publish_info_id").
+		Where("p.deleted_at IS NULL AND p.status = ? AND p.state = ? AND i.state >= ?", models.IdoStatusNormal, models.IdoParticipateStatePaidNoSend, models.IdoPublishStateRefundedPending).
+		Order("p.id").
+		Scan(&idoParticipateInfos).Error
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "Find idoParticipateInfos")
+	}
+	return &idoParticipateInfos, nil
+}
+
+func ProcessIdoPublishNoPay(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoPublishInfoWorkflow.Run(tx, int(models.IdoPublishStateNoPay)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoPublishPaidPending(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoPublishInfoWorkflow.Run(tx, int(models.IdoPublishStatePaidPending)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoPublishPaidNoPublish(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoPublishInfoWorkflow.Run(tx, int(models.IdoPublishStatePaidNoPublish)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoPublishPublishedPending(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoPublishInfoWorkflow.Run(tx, int(models.IdoPublishStatePublishedPending)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoPublishSettle(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoPublishInfoWorkflow.Run(tx, int(models.IdoPublishStatePublished)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoPublishRefundedPending(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoPublishInfoWorkflow.Run(tx, int(models.IdoPublishStateRefundedPending)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoParticipateNoPay(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoParticipateInfoWorkflow.Run(tx, int(models.IdoParticipateStateNoPay)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoParticipatePaidPending(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoParticipateInfoWorkflow.Run(tx, int(models.IdoParticipateStatePaidPending)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func ProcessIdoParticipateSentPending(tx *gorm.DB) {
+	processionResult, err := workflowProcessionResults(idoParticipateInfoWorkflow.Run(tx, int(models.IdoParticipateStateSentPending)))
+	if err != nil {
+		return
+	}
+	PrintProcessionResult(processionResult)
+}
+
+func SendIdoParticipateAsset() {
+	err := SendIdoParticipateAssetBatches()
+	if err != nil {
+		btlLog.FairLaunchDebugLogger.Info("SendIdoParticipateAsset: %v", err)
+	}
+}
+
+func ProcessIdoPublishStateNoPayInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	err := payIdoGasFee(idoPublishInfo, idoPublishInfo.UserID, idoPublishInfo.GasFee, &idoPublishInfo.FeePaidID, &idoPublishInfo.FeePayTime)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "payIdoGasFee")
+	}
+	idoPublishInfo.State = models.IdoPublishStatePaidPending
+	idoPublishInfo.ProcessNumber = 0
+	return UpdateIdoPublishInfo(tx, idoPublishInfo)
+}
+
+func ProcessIdoPublishStatePaidPendingInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	isFeePaid, err := IsFeePaid(idoPublishInfo.FeePaidID)
+	if err != nil {
+		if errors.Is(err, models.CustodyAccountPayInsideMissionFaild) {
+			err = SetIdoPublishInfoFail(tx, idoPublishInfo)
+			if err != nil {
+				return utils.AppendErrorInfo(err, "SetIdoPublishInfoFail")
+			}
+			return nil
+		}
+		return utils.AppendErrorInfo(err, "IsFeePaid")
+	}
+	if !isFeePaid {
+		return errors.New("publish gas fee is not paid yet")
+	}
+	idoPublishInfo.PaidSuccessTime = utils.GetTimestamp()
+	idoPublishInfo.State = models.IdoPublishStatePaidNoPublish
+	idoPublishInfo.ProcessNumber = 0
+	return UpdateIdoPublishInfo(tx, idoPublishInfo)
+}
+
+// GetIdoEscrowAddrEventStatus returns the status of the receive to the escrow address, false when nothing has been sent to it.
+func GetIdoEscrowAddrEventStatus(encodedAddr string) (taprpc.AddrEventStatus, bool, error) {
+	response, err := api.AddrReceivesAndGetResponse()
+	if err != nil {
+		return 0, false, utils.AppendErrorInfo(err, "AddrReceivesAndGetResponse")
+	}
+	for _, event := range response.Events {
+		if event.Addr != nil && event.Addr.Encoded == encodedAddr {
+			return event.Status, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// ProcessIdoPublishStatePaidNoPublishInfo creates the escrow address the issuer deposits the ido asset to,
+// and waits for the deposit. An ido whose asset has not arrived when the participate time ends fails and
+// gets its gas fee back.
+func ProcessIdoPublishStatePaidNoPublishInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	if idoPublishInfo.EncodedAddr == "" {
+		addr, err := api.NewAddrAndGetResponse(idoPublishInfo.AssetID, idoPublishInfo.TotalAmount)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "NewAddrAndGetResponse")
+		}
+		idoPublishInfo.EncodedAddr = addr.Encoded
+		idoPublishInfo.ScriptKey = hex.EncodeToString(addr.ScriptKey)
+		idoPublishInfo.InternalKey = hex.EncodeToString(addr.InternalKey)
+		idoPublishInfo.TaprootOutputKey = hex.EncodeToString(addr.TaprootOutputKey)
+		idoPublishInfo.ProofCourierAddr = addr.ProofCourierAddr
+		idoPublishInfo.ProcessNumber = 0
+		return UpdateIdoPublishInfo(tx, idoPublishInfo)
+	}
+	status, received, err := GetIdoEscrowAddrEventStatus(idoPublishInfo.EncodedAddr)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "GetIdoEscrowAddrEventStatus")
+	}
+	if !received {
+		if utils.GetTimestamp() < idoPublishInfo.EndTime {
+			return nil
+		}
+		err = backIdoGasFee(idoPublishInfo, idoPublishInfo.FeePaidID, &idoPublishInfo.FeeBackID, &idoPublishInfo.FeeBackTime)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "backIdoGasFee")
+		}
+		err = SetIdoPublishInfoFail(tx, idoPublishInfo)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "SetIdoPublishInfoFail")
+		}
+		return nil
+	}
+	if status == taprpc.AddrEventStatus_ADDR_EVENT_STATUS_COMPLETED {
+		idoPublishInfo.State = models.IdoPublishStatePublished
+	} else {
+		idoPublishInfo.State = models.IdoPublishStatePublishedPending
+	}
+	idoPublishInfo.ProcessNumber = 0
+	return UpdateIdoPublishInfo(tx, idoPublishInfo)
+}
+
+func ProcessIdoPublishStatePublishedPendingInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	status, received, err := GetIdoEscrowAddrEventStatus(idoPublishInfo.EncodedAddr)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "GetIdoEscrowAddrEventStatus")
+	}
+	if !received || status != taprpc.AddrEventStatus_ADDR_EVENT_STATUS_COMPLETED {
+		return nil
+	}
+	idoPublishInfo.State = models.IdoPublishStatePublished
+	idoPublishInfo.ProcessNumber = 0
+	return UpdateIdoPublishInfo(tx, idoPublishInfo)
+}
+
+// SettleIdoPublishInfo allocates the ido when the participate time is over. Every paid participation is
+// filled while the ido is not oversubscribed, after that first come by payment time: a participation that
+// no longer fits gets its payment and gas fee back. The payments of the filled participations go to the
+// issuer. Addresses fix the amount they receive, so participations are filled whole or not at all.
+func SettleIdoPublishInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	var unpaid int64
+	err := middleware.DB.Model(&models.IdoParticipateInfo{}).
+		Where("ido_publish_info_id = ? AND status = ? AND state < ?", idoPublishInfo.ID, models.IdoStatusNormal, models.IdoParticipateStatePaidNoSend).
+		Count(&unpaid).Error
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Count unpaid idoParticipateInfos")
+	}
+	if unpaid > 0 {
+		return fmt.Errorf("%d participations are still being paid", unpaid)
+	}
+	var idoParticipateInfos []models.IdoParticipateInfo
+	err = middleware.DB.Where("ido_publish_info_id = ? AND status = ? AND state = ?", idoPublishInfo.ID, models.IdoStatusNormal, models.IdoParticipateStatePaidNoSend).
+		Order("paid_success_time, id").
+		Find(&idoParticipateInfos).Error
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Find idoParticipateInfos")
+	}
+	issuer, err := btldb.ReadUser(uint(idoPublishInfo.UserID))
+	if err != nil {
+		return utils.AppendErrorInfo(err, "ReadUser")
+	}
+	remaining := idoPublishInfo.TotalAmount
+	for i := range idoParticipateInfos {
+		idoParticipateInfo := &idoParticipateInfos[i]
+		if idoParticipateInfo.BoughtAmount > remaining {
+			err = RefundIdoParticipateInfo(tx, idoPublishInfo, idoParticipateInfo)
+			if err != nil {
+				return utils.AppendErrorInfo(err, "RefundIdoParticipateInfo")
+			}
+			continue
+		}
+		participant, err := btldb.ReadUser(uint(idoParticipateInfo.UserID))
+		if err != nil {
+			return utils.AppendErrorInfo(err, "ReadUser")
+		}
+		err = idoTransferByLock(idoLockId("settle", idoParticipateInfo.ID), participant.Username, issuer.Username, idoPaymentAssetId, GetIdoParticipateCost(idoPublishInfo, idoParticipateInfo), 0)
+		if err != nil && !errors.Is(err, lockPayment.RepeatedLockId) {
+			return utils.AppendErrorInfo(err, "TransferByLock("+strconv.Itoa(int(idoParticipateInfo.ID))+")")
+		}
+		remaining -= idoParticipateInfo.BoughtAmount
+	}
+	idoPublishInfo.ParticipateAmount = idoPublishInfo.TotalAmount - remaining
+	idoPublishInfo.IsParticipateAll = remaining == 0
+	if remaining == 0 {
+		idoPublishInfo.State = models.IdoPublishStateRefunded
+	} else {
+		idoPublishInfo.State = models.IdoPublishStateRefundedPending
+	}
+	idoPublishInfo.ProcessNumber = 0
+	return UpdateIdoPublishInfo(tx, idoPublishInfo)
+}
+
+// RefundIdoParticipateInfo gives back the payment and the gas fee of a participation which is not filled.
+func RefundIdoParticipateInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo, idoParticipateInfo *models.IdoParticipateInfo) error {
+	participant, err := btldb.ReadUser(uint(idoParticipateInfo.UserID))
+	if err != nil {
+		return utils.AppendErrorInfo(err, "ReadUser")
+	}
+	err = idoUnlock(participant.Username, idoLockId("refund", idoParticipateInfo.ID), idoPaymentAssetId, GetIdoParticipateCost(idoPublishInfo, idoParticipateInfo), 0)
+	if err != nil && !errors.Is(err, lockPayment.RepeatedLockId) {
+		return utils.AppendErrorInfo(err, "Unlock")
+	}
+	if idoParticipateInfo.FeePaidID != 0 {
+		err = backIdoGasFee(idoParticipateInfo, idoParticipateInfo.FeePaidID, &idoParticipateInfo.FeeBackID, &idoParticipateInfo.FeeBackTime)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "backIdoGasFee")
+		}
+	}
+	return SetIdoParticipateInfoFail(tx, idoParticipateInfo)
+}
+
+// ProcessIdoPublishStateRefundedPendingInfo sends the unsold asset back to the refund address set by the
+// issuer, and waits for the transaction to confirm. The send is labelled and the label committed before it,
+// so a send whose tx is rolled back is found again in tapd's transfers instead of being sent twice.
+func ProcessIdoPublishStateRefundedPendingInfo(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+	if idoPublishInfo.RefundEncodedAddr == "" {
+		return errors.New("waiting for the issuer to set the refund addr")
+	}
+	if idoPublishInfo.RefundTxHash == "" && idoPublishInfo.RefundLabel != "" {
+		transfer, retry, err := findIdoTransfer(idoPublishInfo.RefundLabel, idoPublishInfo.RefundSendTime)
+		if err != nil {
+			return err
+		}
+		if transfer != nil {
+			idoPublishInfo.RefundTxHash, _ = utils.OutpointToTransactionAndIndex(transfer.Outputs[0].Anchor.Outpoint)
+			idoPublishInfo.ProcessNumber = 0
+			return UpdateIdoPublishInfo(tx, idoPublishInfo)
+		}
+		if !retry {
+			return nil
+		}
+		idoPublishInfo.RefundLabel = ""
+	}
+	if idoPublishInfo.RefundTxHash == "" {
+		idoPublishInfo.RefundLabel = fmt.Sprintf("ido-refund-%d-%d", idoPublishInfo.ID, utils.GetTimestamp())
+		idoPublishInfo.RefundSendTime = utils.GetTimestamp()
+		err := middleware.DB.Model(idoPublishInfo).Updates(map[string]any{
+			"refund_label":     idoPublishInfo.RefundLabel,
+			"refund_send_time": idoPublishInfo.RefundSendTime,
+		}).Error
+		if err != nil {
+			return utils.AppendErrorInfo(err, "Update refund_label")
+		}
+		response, err := api.SendAssetAddrSliceWithLabelAndGetResponse([]string{idoPublishInfo.RefundEncodedAddr}, idoPublishInfo.FeeRate, idoPublishInfo.RefundLabel)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "SendAssetAddrSliceWithLabelAndGetResponse")
+		}
+		idoPublishInfo.RefundTxHash, _ = utils.OutpointToTransactionAndIndex(response.Transfer.Outputs[0].Anchor.Outpoint)
+		idoPublishInfo.ProcessNumber = 0
+		return UpdateIdoPublishInfo(tx, idoPublishInfo)
+	}
+	if !IsTransactionConfirmed(idoPublishInfo.RefundTxHash) {
+		return nil
+	}
+	idoPublishInfo.State = models.IdoPublishStateRefunded
+	idoPublishInfo.ProcessNumber = 0
+	return UpdateIdoPublishInfo(tx, idoPublishInfo)
+}
+
+// SetIdoRefundAddr sets the address the unsold asset of a settled ido is sent back to. It has to receive
+// exactly the unsold amount.
+func SetIdoRefundAddr(userId int, idoPublishInfoId int, encodedAddr string) error {
+	idoPublishInfo, err := GetIdoPublishInfo(idoPublishInfoId)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "GetIdoPublishInfo")
+	}
+	if idoPublishInfo.UserID != userId {
+		return errors.New("ido is not published by the user")
+	}
+	if idoPublishInfo.State != models.IdoPublishStateRefundedPending || idoPublishInfo.RefundTxHash != "" {
+		return errors.New("ido has no unsold asset to refund")
+	}
+	decodedAddrInfo, err := api.GetDecodedAddrInfo(encodedAddr)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "GetDecodedAddrInfo")
+	}
+	if hex.EncodeToString(decodedAddrInfo.AssetId) != idoPublishInfo.AssetID {
+		return errors.New("decoded addr asset id is not equal ido publish info's asset id")
+	}
+	unsold := idoPublishInfo.TotalAmount - idoPublishInfo.ParticipateAmount
+	if int(decodedAddrInfo.Amount) != unsold {
+		return errors.New("addr amount is not the unsold amount " + strconv.Itoa(unsold))
+	}
+	return middleware.DB.Model(idoPublishInfo).Update("refund_encoded_addr", encodedAddr).Error
+}
+
+// ProcessIdoParticipateStateNoPayInfo locks the price of the participation and pays its gas fee. A
+// participation which can not be paid before the participate time ends is dropped.
+func ProcessIdoParticipateStateNoPayInfo(tx *gorm.DB, idoParticipateInfo *models.IdoParticipateInfo) error {
+	idoPublishInfo, err := GetIdoPublishInfo(idoParticipateInfo.IdoPublishInfoID)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "GetIdoPublishInfo")
+	}
+	if idoPublishInfo.State != models.IdoPublishStatePublished || !IsIdoParticipateTimeValid(idoPublishInfo) {
+		err = SetIdoParticipateInfoFail(tx, idoParticipateInfo)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "SetIdoParticipateInfoFail")
+		}
+		return nil
+	}
+	participant, err := btldb.ReadUser(uint(idoParticipateInfo.UserID))
+	if err != nil {
+		return utils.AppendErrorInfo(err, "ReadUser")
+	}
+	err = lockPayment.Lock(participant.Username, idoLockId("pay", idoParticipateInfo.ID), idoPaymentAssetId, GetIdoParticipateCost(idoPublishInfo, idoParticipateInfo), 0)
+	if err != nil && !errors.Is(err, lockPayment.RepeatedLockId) {
+		if errors.Is(err, lockPayment.NoEnoughBalance) || errors.Is(err, lockPayment.BadRequest) {
+			_ = SetIdoParticipateInfoFail(tx, idoParticipateInfo)
+		}
+		return utils.AppendErrorInfo(err, "Lock")
+	}
+	payErr := payIdoGasFee(idoParticipateInfo, idoParticipateInfo.UserID, idoParticipateInfo.GasFee, &idoParticipateInfo.FeePaidID, &idoParticipateInfo.FeePayTime)
+	if payErr != nil {
+		if errors.Is(payErr, errIdoGasFeeUnknown) {
+			// The outcome of the payment is not known, the participation waits for the operator.
+			return utils.AppendErrorInfo(payErr, "payIdoGasFee")
+		}
+		err = RefundIdoParticipateInfo(tx, idoPublishInfo, idoParticipateInfo)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "RefundIdoParticipateInfo")
+		}
+		return utils.AppendErrorInfo(payErr, "payIdoGasFee")
+	}
+	idoParticipateInfo.State = models.IdoParticipateStatePaidPending
+	idoParticipateInfo.ProcessNumber = 0
+	return UpdateIdoParticipateInfo(tx, idoParticipateInfo)
+}
+
+func ProcessIdoParticipateStatePaidPendingInfo(tx *gorm.DB, idoParticipateInfo *models.IdoParticipateInfo) error {
+	isFeePaid, err := IsFeePaid(idoParticipateInfo.FeePaidID)
+	if err != nil {
+		if errors.Is(err, models.CustodyAccountPayInsideMissionFaild) {
+			idoPublishInfo, err := GetIdoPublishInfo(idoParticipateInfo.IdoPublishInfoID)
+			if err != nil {
+				return utils.AppendErrorInfo(err, "GetIdoPublishInfo")
+			}
+			// The fee was never taken, only the payment is given back.
+			idoParticipateInfo.FeePaidID = 0
+			err = RefundIdoParticipateInfo(tx, idoPublishInfo, idoParticipateInfo)
+			if err != nil {
+				return utils.AppendErrorInfo(err, "RefundIdoParticipateInfo")
+			}
+			return nil
+		}
+		return utils.AppendErrorInfo(err, "IsFeePaid")
+	}
+	if !isFeePaid {
+		return errors.New("participate gas fee is not paid yet")
+	}
+	err = tx.Model(&models.IdoPublishInfo{}).Where("id = ?", idoParticipateInfo.IdoPublishInfoID).
+		Update("participate_amount", gorm.Expr("participate_amount + ?", idoParticipateInfo.BoughtAmount)).Error
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Update participate_amount")
+	}
+	err = tx.Model(&models.IdoPublishInfo{}).Where("id = ?", idoParticipateInfo.IdoPublishInfoID).
+		Update("is_participate_all", gorm.Expr("participate_amount >= total_amount")).Error
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Update is_participate_all")
+	}
+	idoParticipateInfo.PaidSuccessTime = utils.GetTimestamp()
+	idoParticipateInfo.State = models.IdoParticipateStatePaidNoSend
+	idoParticipateInfo.ProcessNumber = 0
+	return UpdateIdoParticipateInfo(tx, idoParticipateInfo)
+}
+
+// SendIdoParticipateAssetBatches sends the assets of the settled idos, one transaction for up to
+// idoSendBatchSize filled participations of an ido. Each batch is labelled and the label committed before
+// the send, a batch whose outcome was lost is settled by looking the label up in tapd's transfers.
+func SendIdoParticipateAssetBatches() error {
+	idoParticipateInfos, err := GetAllIdoParticipateInfosToSend()
+	if err != nil {
+		return utils.AppendErrorInfo(err, "GetAllIdoParticipateInfosToSend")
+	}
+	labelToParticipateInfos := make(map[string][]models.IdoParticipateInfo)
+	idoPublishInfoIdToParticipateInfos := make(map[int][]models.IdoParticipateInfo)
+	for _, idoParticipateInfo := range *idoParticipateInfos {
+		if idoParticipateInfo.SendLabel != "" {
+			labelToParticipateInfos[idoParticipateInfo.SendLabel] = append(labelToParticipateInfos[idoParticipateInfo.SendLabel], idoParticipateInfo)
+			continue
+		}
+		idoPublishInfoId := idoParticipateInfo.IdoPublishInfoID
+		if len(idoPublishInfoIdToParticipateInfos[idoPublishInfoId]) < idoSendBatchSize {
+			idoPublishInfoIdToParticipateInfos[idoPublishInfoId] = append(idoPublishInfoIdToParticipateInfos[idoPublishInfoId], idoParticipateInfo)
+		}
+	}
+	var errs []error
+	for label, participateInfos := range labelToParticipateInfos {
+		err = recoverIdoParticipateAssetBatch(label, participateInfos)
+		if err != nil {
+			errs = append(errs, utils.AppendErrorInfo(err, label))
+		}
+	}
+	for idoPublishInfoId, participateInfos := range idoPublishInfoIdToParticipateInfos {
+		err = sendIdoParticipateAssetBatch(idoPublishInfoId, participateInfos)
+		if err != nil {
+			errs = append(errs, utils.AppendErrorInfo(err, "ido("+strconv.Itoa(idoPublishInfoId)+")"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recoverIdoParticipateAssetBatch settles a labelled batch that was not recorded as sent.
+func recoverIdoParticipateAssetBatch(label string, idoParticipateInfos []models.IdoParticipateInfo) error {
+	transfer, retry, err := findIdoTransfer(label, idoParticipateInfos[0].SendAssetTime)
+	if err != nil {
+		return err
+	}
+	if transfer != nil {
+		return setIdoParticipateInfosSent(idoParticipateInfos, transfer)
+	}
+	if retry {
+		return setIdoParticipateInfosSendLabel(idoParticipateInfos, "", 0)
+	}
+	return nil
+}
+
+func setIdoParticipateInfosSendLabel(idoParticipateInfos []models.IdoParticipateInfo, label string, sendAssetTime int) error {
+	ids := make([]uint, 0, len(idoParticipateInfos))
+	for i := range idoParticipateInfos {
+		ids = append(ids, idoParticipateInfos[i].ID)
+		idoParticipateInfos[i].SendLabel = label
+		idoParticipateInfos[i].SendAssetTime = sendAssetTime
+	}
+	return middleware.DB.Model(&models.IdoParticipateInfo{}).
+		Where("id IN ? AND state = ?", ids, models.IdoParticipateStatePaidNoSend).
+		Updates(map[string]any{"send_label": label, "send_asset_time": sendAssetTime}).Error
+}
+
+func sendIdoParticipateAssetBatch(idoPublishInfoId int, idoParticipateInfos []models.IdoParticipateInfo) error {
+	var addrs []string
+	var amount, gasFee int
+	for _, idoParticipateInfo := range idoParticipateInfos {
+		addrs = append(addrs, idoParticipateInfo.EncodedAddr)
+		amount += idoParticipateInfo.BoughtAmount
+		gasFee += idoParticipateInfo.GasFee
+	}
+	assetId := idoParticipateInfos[0].AssetID
+	if !IsWalletBalanceEnough(gasFee) {
+		return errors.New("lnd wallet balance is not enough")
+	}
+	if !IsAssetBalanceEnough(assetId, amount) {
+		return errors.New("tapd asset(" + assetId + ") balance is not enough")
+	}
+	feeRate, err := UpdateAndGetFeeRateResponseTransformed()
+	if err != nil {
+		return utils.AppendErrorInfo(err, "UpdateAndGetFeeRateResponseTransformed")
+	}
+	label := fmt.Sprintf("ido-send-%d-%d", idoPublishInfoId, idoParticipateInfos[0].ID)
+	err = setIdoParticipateInfosSendLabel(idoParticipateInfos, label, utils.GetTimestamp())
+	if err != nil {
+		return utils.AppendErrorInfo(err, "setIdoParticipateInfosSendLabel")
+	}
+	response, err := api.SendAssetAddrSliceWithLabelAndGetResponse(addrs, feeRate.SatPerKw.FastestFee, label)
+	if err != nil {
+		// The label stays, recoverIdoParticipateAssetBatch finds out whether tapd sent the batch.
+		return utils.AppendErrorInfo(err, "SendAssetAddrSliceWithLabelAndGetResponse")
+	}
+	btlLog.FairLaunchDebugLogger.Info("ido(%d) sent to %s", idoPublishInfoId, AddrsToString(addrs))
+	return setIdoParticipateInfosSent(idoParticipateInfos, response.Transfer)
+}
+
+func setIdoParticipateInfosSent(idoParticipateInfos []models.IdoParticipateInfo, transfer *taprpc.AssetTransfer) error {
+	response := &taprpc.SendAssetResponse{Transfer: transfer}
+	tx := middleware.DB.Begin()
+	for i := range idoParticipateInfos {
+		idoParticipateInfo := &idoParticipateInfos[i]
+		outpoint, err := SendAssetResponseScriptKeyAndInternalKeyToOutpoint(response, idoParticipateInfo.ScriptKey, idoParticipateInfo.InternalKey)
+		if err != nil {
+			tx.Rollback()
+			return utils.AppendErrorInfo(err, "SendAssetResponseScriptKeyAndInternalKeyToOutpoint")
+		}
+		idoParticipateInfo.OutpointTxHash, _ = utils.GetTransactionAndIndexByOutpoint(outpoint)
+		idoParticipateInfo.Outpoint = outpoint
+		idoParticipateInfo.IsAddrSent = true
+		idoParticipateInfo.SendAssetTime = utils.GetTimestamp()
+		idoParticipateInfo.State = models.IdoParticipateStateSentPending
+		err = UpdateIdoParticipateInfo(tx, idoParticipateInfo)
+		if err != nil {
+			tx.Rollback()
+			return utils.AppendErrorInfo(err, "UpdateIdoParticipateInfo")
+		}
+	}
+	return tx.Commit().Error
+}
+
+func ProcessIdoParticipateStateSentPendingInfo(tx *gorm.DB, idoParticipateInfo *models.IdoParticipateInfo) error {
+	if !IsTransactionConfirmed(idoParticipateInfo.OutpointTxHash) {
+		return nil
+	}
+	idoParticipateInfo.State = models.IdoParticipateStateSent
+	idoParticipateInfo.ProcessNumber = 0
+	return UpdateIdoParticipateInfo(tx, idoParticipateInfo)
+}
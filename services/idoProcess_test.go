@@ -0,0 +1,349 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"trade/middleware/dbtest"
+	"trade/models"
+	"trade/utils"
+
+	"github.com/lightninglabs/taproot-assets/taprpc"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type idoCalls struct {
+	transfers []string
+	unlocks   []string
+	pays      int
+	backs     []int
+	payErr    error
+}
+
+// stubIdoCalls replaces the custody calls of the ido processing with ones recording what they are asked to do.
+func stubIdoCalls(t *testing.T) *idoCalls {
+	t.Helper()
+	calls := &idoCalls{}
+	oldPay, oldBack, oldTransfer, oldUnlock := idoPayGasFee, idoBackGasFee, idoTransferByLock, idoUnlock
+	idoPayGasFee = func(payUserId int, gasFee int) (int, error) {
+		if calls.payErr != nil {
+			return 0, calls.payErr
+		}
+		calls.pays++
+		return 100 + calls.pays, nil
+	}
+	idoBackGasFee = func(paidId int) (int, error) {
+		calls.backs = append(calls.backs, paidId)
+		return 200 + len(calls.backs), nil
+	}
+	idoTransferByLock = func(lockedId, npubkey, toNpubkey, assetId string, amount decimal.Decimal, tag int) error {
+		calls.transfers = append(calls.transfers, fmt.Sprintf("%s %s>%s %s", lockedId, npubkey, toNpubkey, amount))
+		return nil
+	}
+	idoUnlock = func(npubkey, lockedId, assetId string, amount decimal.Decimal, tag int) error {
+		calls.unlocks = append(calls.unlocks, fmt.Sprintf("%s %s %s", lockedId, npubkey, amount))
+		return nil
+	}
+	t.Cleanup(func() {
+		idoPayGasFee, idoBackGasFee, idoTransferByLock, idoUnlock = oldPay, oldBack, oldTransfer, oldUnlock
+	})
+	return calls
+}
+
+func setupIdoTest(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := dbtest.Use(t, &models.User{}, &models.IdoPublishInfo{}, &models.IdoParticipateInfo{})
+	users := []models.User{{Username: "issuer"}, {Username: "alice"}, {Username: "bob"}, {Username: "carol"}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type idoTestParticipation struct {
+	userId    int
+	amount    int
+	paidTime  int
+	state     models.IdoParticipateState
+	feePaidId int
+}
+
+func TestSettleIdoPublishInfo(t *testing.T) {
+	const alice, bob, carol = 2, 3, 4
+	tests := []struct {
+		name           string
+		total          int
+		participations []idoTestParticipation
+		wantErr        bool
+		wantTransfers  []string
+		wantUnlocks    []string
+		wantBacks      []int
+		wantRefunded   []int
+		wantSold       int
+		wantState      models.IdoPublishState
+	}{
+		{
+			name:  "sold out",
+			total: 100,
+			participations: []idoTestParticipation{
+				{userId: alice, amount: 30, paidTime: 1},
+				{userId: bob, amount: 70, paidTime: 2},
+			},
+			wantTransfers: []string{"ido_participate_settle_1 alice>issuer 60", "ido_participate_settle_2 bob>issuer 140"},
+			wantSold:      100,
+			wantState:     models.IdoPublishStateRefunded,
+		},
+		{
+			name:  "unsold rest",
+			total: 100,
+			participations: []idoTestParticipation{
+				{userId: alice, amount: 30, paidTime: 1},
+			},
+			wantTransfers: []string{"ido_participate_settle_1 alice>issuer 60"},
+			wantSold:      30,
+			wantState:     models.IdoPublishStateRefundedPending,
+		},
+		{
+			name:  "oversubscribed fills by payment time",
+			total: 100,
+			participations: []idoTestParticipation{
+				{userId: bob, amount: 50, paidTime: 2, feePaidId: 7},
+				{userId: alice, amount: 60, paidTime: 1},
+				{userId: carol, amount: 40, paidTime: 3},
+			},
+			wantTransfers: []string{"ido_participate_settle_2 alice>issuer 120", "ido_participate_settle_3 carol>issuer 80"},
+			wantUnlocks:   []string{"ido_participate_refund_1 bob 100"},
+			wantBacks:     []int{7},
+			wantRefunded:  []int{1},
+			wantSold:      100,
+			wantState:     models.IdoPublishStateRefunded,
+		},
+		{
+			name:  "participation too large is refunded whole",
+			total: 100,
+			participations: []idoTestParticipation{
+				{userId: alice, amount: 40, paidTime: 1},
+				{userId: bob, amount: 70, paidTime: 2},
+			},
+			wantTransfers: []string{"ido_participate_settle_1 alice>issuer 80"},
+			wantUnlocks:   []string{"ido_participate_refund_2 bob 140"},
+			wantRefunded:  []int{2},
+			wantSold:      40,
+			wantState:     models.IdoPublishStateRefundedPending,
+		},
+		{
+			name:  "waits for unpaid participations",
+			total: 100,
+			participations: []idoTestParticipation{
+				{userId: alice, amount: 30, paidTime: 1},
+				{userId: bob, amount: 30, state: models.IdoParticipateStatePaidPending},
+			},
+			wantErr:   true,
+			wantState: models.IdoPublishStatePublished,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupIdoTest(t)
+			calls := stubIdoCalls(t)
+			idoPublishInfo := models.IdoPublishInfo{UserID: 1, TotalAmount: tt.total, UnitPrice: 2, State: models.IdoPublishStatePublished}
+			if err := db.Create(&idoPublishInfo).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range tt.participations {
+				state := p.state
+				if state == models.IdoParticipateStateNoPay {
+					state = models.IdoParticipateStatePaidNoSend
+				}
+				err := db.Create(&models.IdoParticipateInfo{
+					IdoPublishInfoID: int(idoPublishInfo.ID),
+					UserID:           p.userId,
+					BoughtAmount:     p.amount,
+					PaidSuccessTime:  p.paidTime,
+					FeePaidID:        p.feePaidId,
+					State:            state,
+				}).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := SettleIdoPublishInfo(db, &idoPublishInfo)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(calls.transfers) != fmt.Sprint(tt.wantTransfers) {
+				t.Errorf("transfers %v, want %v", calls.transfers, tt.wantTransfers)
+			}
+			if fmt.Sprint(calls.unlocks) != fmt.Sprint(tt.wantUnlocks) {
+				t.Errorf("unlocks %v, want %v", calls.unlocks, tt.wantUnlocks)
+			}
+			if fmt.Sprint(calls.backs) != fmt.Sprint(tt.wantBacks) {
+				t.Errorf("fee backs %v, want %v", calls.backs, tt.wantBacks)
+			}
+
+			var saved models.IdoPublishInfo
+			if err = db.First(&saved, idoPublishInfo.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.State != tt.wantState {
+				t.Errorf("state %d, want %d", saved.State, tt.wantState)
+			}
+			if tt.wantErr {
+				return
+			}
+			if saved.ParticipateAmount != tt.wantSold || saved.IsParticipateAll != (tt.wantSold == tt.total) {
+				t.Errorf("sold %d all %v, want %d %v", saved.ParticipateAmount, saved.IsParticipateAll, tt.wantSold, tt.wantSold == tt.total)
+			}
+			var refunded []models.IdoParticipateInfo
+			if err = db.Where("status = ?", models.IdoStatusDeprecated).Order("id").Find(&refunded).Error; err != nil {
+				t.Fatal(err)
+			}
+			var refundedIds []int
+			for _, p := range refunded {
+				refundedIds = append(refundedIds, int(p.ID))
+				if p.FeePaidID != 0 && p.FeeBackID == 0 {
+					t.Errorf("participation %d fee %d given back without a back id", p.ID, p.FeePaidID)
+				}
+			}
+			if fmt.Sprint(refundedIds) != fmt.Sprint(tt.wantRefunded) {
+				t.Errorf("refunded participations %v, want %v", refundedIds, tt.wantRefunded)
+			}
+		})
+	}
+}
+
+func TestPayIdoGasFee(t *testing.T) {
+	db := setupIdoTest(t)
+	calls := stubIdoCalls(t)
+	idoPublishInfo := models.IdoPublishInfo{UserID: 1, GasFee: 1000}
+	if err := db.Create(&idoPublishInfo).Error; err != nil {
+		t.Fatal(err)
+	}
+	pay := func(info *models.IdoPublishInfo) error {
+		return payIdoGasFee(info, info.UserID, info.GasFee, &info.FeePaidID, &info.FeePayTime)
+	}
+	reload := func() *models.IdoPublishInfo {
+		var saved models.IdoPublishInfo
+		if err := db.First(&saved, idoPublishInfo.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return &saved
+	}
+
+	calls.payErr = errors.New("not enough balance")
+	if err := pay(&idoPublishInfo); err == nil || errors.Is(err, errIdoGasFeeUnknown) {
+		t.Fatalf("refused payment err = %v", err)
+	}
+	if saved := reload(); saved.FeePayTime != 0 || idoPublishInfo.FeePayTime != 0 {
+		t.Fatalf("refused payment keeps its claim at %d", saved.FeePayTime)
+	}
+
+	calls.payErr = nil
+	if err := pay(&idoPublishInfo); err != nil {
+		t.Fatal(err)
+	}
+	if saved := reload(); saved.FeePaidID != 101 || saved.FeePayTime == 0 {
+		t.Fatalf("paid id %d at %d, want 101 recorded", saved.FeePaidID, saved.FeePayTime)
+	}
+
+	// A retry of the rolled back workflow tx reads the recorded payment.
+	if err := pay(reload()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.pays != 1 {
+		t.Fatalf("paid %d times, want 1", calls.pays)
+	}
+
+	// A claim without a paid id is a payment whose outcome was lost.
+	if err := db.Model(&idoPublishInfo).Update("fee_paid_id", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := pay(reload()); !errors.Is(err, errIdoGasFeeUnknown) {
+		t.Fatalf("lost payment err = %v, want %v", err, errIdoGasFeeUnknown)
+	}
+	// So is a claim made since the entity was loaded.
+	stale := idoPublishInfo
+	stale.FeePaidID, stale.FeePayTime = 0, 0
+	if err := pay(&stale); !errors.Is(err, errIdoGasFeeUnknown) {
+		t.Fatalf("stale payment err = %v, want %v", err, errIdoGasFeeUnknown)
+	}
+	if calls.pays != 1 {
+		t.Fatalf("paid %d times, want 1", calls.pays)
+	}
+}
+
+func TestBackIdoGasFee(t *testing.T) {
+	db := setupIdoTest(t)
+	calls := stubIdoCalls(t)
+	idoParticipateInfo := models.IdoParticipateInfo{UserID: 2, FeePaidID: 9}
+	if err := db.Create(&idoParticipateInfo).Error; err != nil {
+		t.Fatal(err)
+	}
+	back := func(info *models.IdoParticipateInfo) error {
+		return backIdoGasFee(info, info.FeePaidID, &info.FeeBackID, &info.FeeBackTime)
+	}
+	if err := back(&idoParticipateInfo); err != nil {
+		t.Fatal(err)
+	}
+	var saved models.IdoParticipateInfo
+	if err := db.First(&saved, idoParticipateInfo.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.FeeBackID != 201 || saved.FeeBackTime == 0 {
+		t.Fatalf("back id %d at %d, want 201 recorded", saved.FeeBackID, saved.FeeBackTime)
+	}
+	if err := back(&saved); err != nil {
+		t.Fatal(err)
+	}
+	stale := idoParticipateInfo
+	stale.FeeBackID, stale.FeeBackTime = 0, 0
+	if err := back(&stale); !errors.Is(err, errIdoGasFeeUnknown) {
+		t.Fatalf("stale back err = %v, want %v", err, errIdoGasFeeUnknown)
+	}
+	if fmt.Sprint(calls.backs) != "[9]" {
+		t.Fatalf("fee backs %v, want [9]", calls.backs)
+	}
+}
+
+func TestFindIdoTransfer(t *testing.T) {
+	now := utils.GetTimestamp()
+	found := &taprpc.AssetTransfer{}
+	errTapd := errors.New("tapd is down")
+	tests := []struct {
+		name         string
+		sendTime     int
+		transfer     *taprpc.AssetTransfer
+		err          error
+		wantTransfer bool
+		wantRetry    bool
+		wantErr      bool
+	}{
+		{"sent", now - 10, found, nil, true, false, false},
+		{"sent long ago", now - 10*idoSendLeaseSecond, found, nil, true, false, false},
+		{"within lease", now - 10, nil, nil, false, false, false},
+		{"at lease end", now - idoSendLeaseSecond + 5, nil, nil, false, false, false},
+		{"lease expired", now - idoSendLeaseSecond - 5, nil, nil, false, true, false},
+		{"tapd error", now - idoSendLeaseSecond - 5, nil, errTapd, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := idoFindTransferByLabel
+			t.Cleanup(func() { idoFindTransferByLabel = old })
+			var gotLabel string
+			var gotSince int64
+			idoFindTransferByLabel = func(label string, since int64) (*taprpc.AssetTransfer, error) {
+				gotLabel, gotSince = label, since
+				return tt.transfer, tt.err
+			}
+			transfer, retry, err := findIdoTransfer("ido-send-1-1", tt.sendTime)
+			if gotLabel != "ido-send-1-1" || gotSince != int64(tt.sendTime) {
+				t.Fatalf("looked up %q since %d, want %q since %d", gotLabel, gotSince, "ido-send-1-1", tt.sendTime)
+			}
+			if (err != nil) != tt.wantErr || (transfer != nil) != tt.wantTransfer || retry != tt.wantRetry {
+				t.Fatalf("transfer %v retry %v err %v, want transfer %v retry %v error %v", transfer != nil, retry, err, tt.wantTransfer, tt.wantRetry, tt.wantErr)
+			}
+		})
+	}
+}
@@ -66,25 +66,25 @@ func ValidAndDecrypt(userName string) (string, error) {
 	}
 }
 
-func Login(req *models.User) (string, error) {
+func Login(req *models.LoginRequest, ip string) (*middleware.SessionTokens, error) {
 
 	var username string
 	var err error
 
 	if isEncrypted(req.Username) {
 		if len(req.Username) <= 0 {
-			return "", errors.New("username length negative")
+			return nil, errors.New("username length negative")
 		}
 
 		username, err = DecryptAndRestore(req.Username)
 		if err != nil {
-			return "", errors.Wrap(err, "DecryptAndRestore")
+			return nil, errors.Wrap(err, "DecryptAndRestore")
 		}
 	} else {
 		if config.GetConfig().NetWork == "mainnet" {
 			if !isAllNumbers(req.Username) {
 				if !(len(req.Username) == 92 || len(req.Username) == 91) {
-					return "", errors.New("username length wrong")
+					return nil, errors.New("username length wrong")
 				}
 			}
 		}
@@ -100,7 +100,7 @@ func Login(req *models.User) (string, error) {
 			var password string
 			password, err = hashWeakButFastPassword(req.Password)
 			if err != nil {
-				return "", errors.Wrap(err, "hashWeakButFastPassword")
+				return nil, errors.Wrap(err, "hashWeakButFastPassword")
 			}
 
 			err = middleware.DB.Model(&models.User{}).Create(&models.User{
@@ -109,49 +109,52 @@ func Login(req *models.User) (string, error) {
 			}).Error
 
 			if err != nil {
-				return "", errors.Wrap(err, "middleware.DB.Model(&models.User{}).Create")
+				return nil, errors.Wrap(err, "middleware.DB.Model(&models.User{}).Create")
 			}
 
 		} else {
-			return "", errors.Wrap(err, "middleware.DB.Model(&models.User{}).First")
+			return nil, errors.Wrap(err, "middleware.DB.Model(&models.User{}).First")
 		}
 	} else {
 		if u.WeakButFastPass == "" {
 
 			err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(req.Password))
 			if err != nil {
-				return "", errors.Wrap(err, "bcrypt.CompareHashAndPassword")
+				return nil, errors.Wrap(err, "bcrypt.CompareHashAndPassword")
 			}
 
 			var wbfPass string
 			wbfPass, err = hashWeakButFastPassword(req.Password)
 			if err != nil {
-				return "", errors.Wrap(err, "hashWeakButFastPassword")
+				return nil, errors.Wrap(err, "hashWeakButFastPassword")
 			}
 
 			err = middleware.DB.Model(&models.User{}).Where("id = ?", u.ID).Update("weak_but_fast_pass", wbfPass).Error
 			if err != nil {
-				return "", errors.Wrap(err, "middleware.DB.Model(&models.User{}).Update")
+				return nil, errors.Wrap(err, "middleware.DB.Model(&models.User{}).Update")
 			}
 
 		} else {
 
 			err = bcrypt.CompareHashAndPassword([]byte(u.WeakButFastPass), []byte(req.Password))
 			if err != nil {
-				return "", errors.Wrap(err, "bcrypt.CompareHashAndPassword")
+				return nil, errors.Wrap(err, "bcrypt.CompareHashAndPassword")
 			}
 
 		}
 	}
 
-	var token string
+	deviceId, err := ResolveSessionDeviceId(username, req.EncryptDeviceID, req.EncodedSalt)
+	if err != nil {
+		return nil, errors.Wrap(err, "ResolveSessionDeviceId")
+	}
 
-	token, err = middleware.GenerateToken(username)
+	tokens, err := middleware.CreateSession(username, deviceId, ip)
 	if err != nil {
-		return "", errors.Wrap(err, "middleware.GenerateToken")
+		return nil, errors.Wrap(err, "middleware.CreateSession")
 	}
 
-	return token, nil
+	return tokens, nil
 }
 
 func isAllNumbers(s string) bool {
@@ -267,7 +270,7 @@ func pkcs7Unpad(data []byte) ([]byte, error) {
 	return data[:length-padding], nil
 }
 
-func ValidateUserAndGenerateToken(creds models.User) (string, error) {
+func ValidateUserAndGenerateToken(creds models.LoginRequest, ip string) (*middleware.SessionTokens, error) {
 	var (
 		username = creds.Username
 		err      error
@@ -275,14 +278,14 @@ func ValidateUserAndGenerateToken(creds models.User) (string, error) {
 	var user models.User
 	result := middleware.DB.Where("user_name = ?", username).First(&user)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
 	}
 	if !CheckPassword(user.Password, creds.Password) {
 		originalString, _ := spilt(creds.Password)
 		if originalString != "" {
 			password, err := hashPassword(originalString)
 			if err != nil {
-				return "", err
+				return nil, err
 			}
 			user.Password = password
 
@@ -294,18 +297,18 @@ func ValidateUserAndGenerateToken(creds models.User) (string, error) {
 				}).
 				Error
 			if err != nil {
-				return "", err
+				return nil, err
 			}
 		}
 	}
-	token, err := middleware.GenerateToken(username)
+	deviceId, err := ResolveSessionDeviceId(username, creds.EncryptDeviceID, creds.EncodedSalt)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return token, nil
+	return middleware.CreateSession(username, deviceId, ip)
 }
 
-func ValidateUserAndReChange(creds *models.User) (string, error) {
+func ValidateUserAndReChange(creds *models.LoginRequest, ip string) (*middleware.SessionTokens, error) {
 	var (
 		username = creds.Username
 		err      error
@@ -313,12 +316,12 @@ func ValidateUserAndReChange(creds *models.User) (string, error) {
 
 	if isEncrypted(creds.Username) {
 		if len(username) <= 0 {
-			return "", fmt.Errorf("username update failed")
+			return nil, fmt.Errorf("username update failed")
 		}
 
 		username, err = DecryptAndRestore(creds.Username)
 		if err != nil {
-			return "", fmt.Errorf("update username decryption failed: %v", err)
+			return nil, fmt.Errorf("update username decryption failed: %v", err)
 		}
 		log.Println("update username：" + username)
 	} else {
@@ -326,7 +329,7 @@ func ValidateUserAndReChange(creds *models.User) (string, error) {
 			if !isAllNumbers(username) {
 				if len(username) != len(
 					"npub29Z2ncVPR3BRmm9ixwoLF2euPQxKwxXDyPRLtFnH9KepkoudUDq1zBP9MggPF5EMtT3yAfUZ6sEA5tkYm6UJLAHk") {
-					return "", fmt.Errorf("username update failed")
+					return nil, fmt.Errorf("username update failed")
 				}
 			}
 		}
@@ -337,24 +340,28 @@ func ValidateUserAndReChange(creds *models.User) (string, error) {
 		user.Username = username
 		password, err := hashPassword(creds.Password)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		user.Password = password
 		user.UpdatedAt = time.Now()
 		err = btldb.UpdateUser(&user)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 	if !CheckPassword(user.Password, creds.Password) {
-		return "", errors.New("when update invalid credentials")
+		return nil, errors.New("when update invalid credentials")
 	}
-	token, err := middleware.GenerateToken(username)
+	deviceId, err := ResolveSessionDeviceId(username, creds.EncryptDeviceID, creds.EncodedSalt)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	tokens, err := middleware.CreateSession(username, deviceId, ip)
+	if err != nil {
+		return nil, err
 	}
 	creds.Username = username
-	return token, nil
+	return tokens, nil
 }
 
 func (cs *CronService) FiveSecondTask() {
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/lightninglabs/taproot-assets/taprpc"
 	"github.com/lightninglabs/taproot-assets/taprpc/universerpc"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,6 +19,7 @@ import (
 	"trade/models"
 	"trade/services/btldb"
 	"trade/services/custodyAccount/defaultAccount/custodyFee"
+	"trade/services/satBackQueue"
 	"trade/utils"
 )
 
@@ -281,24 +284,49 @@ func IsNftPresaleAddrValid(nftPresale *models.NftPresale, addr *taprpc.Addr) (bo
 	return true, nil
 }
 
-func UpdateNftPresaleByPurchaseInfo(userId int, username string, deviceId string, addr string, scriptKey string, internalKey string, nftPresale *models.NftPresale) error {
+func UpdateNftPresaleByPurchaseInfo(tx *gorm.DB, userId int, username string, deviceId string, addr string, scriptKey string, internalKey string, price int, nftPresaleWhitelistTier *models.NftPresaleWhitelistTier, nftPresale *models.NftPresale) error {
 	var err error
 	if nftPresale == nil {
 		err = errors.New("nftPresale is nil")
 		return err
 	}
+	var whitelistTierId uint
+	if nftPresaleWhitelistTier != nil {
+		whitelistTierId = nftPresaleWhitelistTier.ID
+	}
+	boughtTime := utils.GetTimestamp()
+	// Only a launched presale is bought, so of two buyers reading it launched the later one updates no row.
+	result := tx.Model(&models.NftPresale{}).
+		Where("id = ? AND state = ?", nftPresale.ID, models.NftPresaleStateLaunched).
+		Updates(map[string]any{
+			"bought_price":      price,
+			"whitelist_tier_id": whitelistTierId,
+			"buyer_user_id":     userId,
+			"buyer_username":    username,
+			"buyer_device_id":   deviceId,
+			"receive_addr":      addr,
+			"addr_script_key":   scriptKey,
+			"addr_internal_key": internalKey,
+			"bought_time":       boughtTime,
+			"state":             models.NftPresaleStateBoughtNotPay,
+		})
+	if result.Error != nil {
+		return utils.AppendErrorInfo(result.Error, "Update nftPresale")
+	}
+	if result.RowsAffected == 0 {
+		err = errors.New("nft(" + nftPresale.AssetId + ") is no longer purchasable, it has been bought or is not launched")
+		return err
+	}
+	nftPresale.BoughtPrice = price
+	nftPresale.WhitelistTierId = whitelistTierId
 	nftPresale.BuyerUserId = userId
 	nftPresale.BuyerUsername = username
 	nftPresale.BuyerDeviceId = deviceId
 	nftPresale.ReceiveAddr = addr
 	nftPresale.AddrScriptKey = scriptKey
 	nftPresale.AddrInternalKey = internalKey
-	nftPresale.BoughtTime = utils.GetTimestamp()
+	nftPresale.BoughtTime = boughtTime
 	nftPresale.State = models.NftPresaleStateBoughtNotPay
-	err = UpdateNftPresale(nftPresale)
-	if err != nil {
-		return utils.AppendErrorInfo(err, "UpdateNftPresale")
-	}
 	return nil
 }
 
@@ -322,20 +350,19 @@ func IsPurchasableTimeValid(nftPresale *models.NftPresale) (bool, error) {
 }
 
 func IsWhitelistPass(nftPresale *models.NftPresale, username string) (bool, error) {
-	whitelists, err := GetNftPresaleWhitelistsByNftPresale(nftPresale)
+	_, err := GetNftPresaleWhitelistTierOfUsername(nftPresale, username)
 	if err != nil {
-		return false, utils.AppendErrorInfo(err, "GetNftPresaleWhitelistsByNftPresale")
+		return false, err
 	}
-	if whitelists == nil || len(*whitelists) == 0 {
+	return true, nil
+}
 
-		return true, nil
-	}
-	for _, user := range *whitelists {
-		if user == username {
-			return true, nil
-		}
+// GetNftPresalePayPrice is the price the buyer pays, presales bought before whitelist tiers have no BoughtPrice.
+func GetNftPresalePayPrice(nftPresale *models.NftPresale) int {
+	if nftPresale.BoughtPrice > 0 {
+		return nftPresale.BoughtPrice
 	}
-	return false, errors.New("username(" + username + ") not found in Whitelists")
+	return nftPresale.Price
 }
 
 func BuyNftPresale(userId int, username string, buyNftPresaleRequest models.BuyNftPresaleRequest) error {
@@ -350,28 +377,26 @@ func BuyNftPresale(userId int, username string, buyNftPresaleRequest models.BuyN
 		return utils.AppendErrorInfo(err, "IsNftPresalePurchasable")
 	}
 
-	_, err = IsPurchasableTimeValid(nftPresale)
+	nftPresaleWhitelistTier, err := GetNftPresaleWhitelistTierOfUsername(nftPresale, username)
 	if err != nil {
-		return utils.AppendErrorInfo(err, "IsPurchasableTimeValid")
+		return utils.AppendErrorInfo(err, "GetNftPresaleWhitelistTierOfUsername")
 	}
 
-	_, err = IsWhitelistPass(nftPresale, username)
+	_, err = IsPurchasableTimeValidInTier(nftPresale, nftPresaleWhitelistTier)
 	if err != nil {
-		return utils.AppendErrorInfo(err, "IsWhitelistPass")
+		return utils.AppendErrorInfo(err, "IsPurchasableTimeValidInTier")
 	}
 
-	price := nftPresale.Price
-	{
-		accountBalance, err := custodyFee.GetAccountBalance(uint(userId))
-		if err != nil {
-			return utils.AppendErrorInfo(err, "GetAccountBalance")
-		}
-		notPayAmount := CalculateAllNotPayAmount(username)
-		isEnough := accountBalance >= int64(price)+notPayAmount
-		if !isEnough {
-			err = errors.New("user(" + strconv.Itoa(userId) + ")'s account balance(" + strconv.FormatInt(accountBalance, 10) + ") not enough to pay nft presale price" + "(" + strconv.Itoa(nftPresale.Price) + ") and not pay amount(" + strconv.FormatInt(notPayAmount, 10) + ")")
-			return utils.AppendErrorInfo(err, "IsAccountBalanceEnough")
-		}
+	maxPrice := buyNftPresaleRequest.MaxPrice
+	// The price of a whitelist tier does not move, so a purchase above the max price fails before the address
+	// is decoded. Other prices are checked once priced in the transaction.
+	var tierPrice int
+	if nftPresaleWhitelistTier != nil {
+		tierPrice = nftPresaleWhitelistTier.Price
+	}
+	err = CheckNftPresaleMaxPrice(tierPrice, maxPrice)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "CheckNftPresaleMaxPrice")
 	}
 
 	var addr, scriptKey, internalKey string
@@ -395,11 +420,40 @@ func BuyNftPresale(userId int, username string, buyNftPresaleRequest models.BuyN
 
 	deviceId := buyNftPresaleRequest.DeviceId
 
-	err = UpdateNftPresaleByPurchaseInfo(userId, username, deviceId, addr, scriptKey, internalKey, nftPresale)
-	if err != nil {
-		return utils.AppendErrorInfo(err, "UpdateNftPresaleByPurchaseInfo")
-	}
-	return nil
+	return middleware.DB.Transaction(func(tx *gorm.DB) error {
+		if nftPresaleWhitelistTier != nil && nftPresaleWhitelistTier.MaxPurchases > 0 {
+			// Purchases of a user are serialized on the user row, so the max purchases of the tier hold.
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, userId).Error
+			if err != nil {
+				return utils.AppendErrorInfo(err, "lock user")
+			}
+			err = CheckNftPresaleWhitelistTierPurchases(tx, userId, nftPresaleWhitelistTier)
+			if err != nil {
+				return utils.AppendErrorInfo(err, "CheckNftPresaleWhitelistTierPurchases")
+			}
+		}
+		price, err := GetNftPresaleBuyPrice(tx, nftPresale, nftPresaleWhitelistTier, maxPrice)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "GetNftPresaleBuyPrice")
+		}
+		{
+			accountBalance, err := custodyFee.GetAccountBalance(uint(userId))
+			if err != nil {
+				return utils.AppendErrorInfo(err, "GetAccountBalance")
+			}
+			notPayAmount := CalculateAllNotPayAmount(username)
+			isEnough := accountBalance >= int64(price)+notPayAmount
+			if !isEnough {
+				err = errors.New("user(" + strconv.Itoa(userId) + ")'s account balance(" + strconv.FormatInt(accountBalance, 10) + ") not enough to pay nft presale price" + "(" + strconv.Itoa(price) + ") and not pay amount(" + strconv.FormatInt(notPayAmount, 10) + ")")
+				return utils.AppendErrorInfo(err, "IsAccountBalanceEnough")
+			}
+		}
+		err = UpdateNftPresaleByPurchaseInfo(tx, userId, username, deviceId, addr, scriptKey, internalKey, price, nftPresaleWhitelistTier, nftPresale)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "UpdateNftPresaleByPurchaseInfo")
+		}
+		return nil
+	})
 }
 
 func NftPresaleToNftPresaleSimplified(nftPresale *models.NftPresale, noMeta bool, noWhitelist bool) *models.NftPresaleSimplified {
@@ -462,6 +516,8 @@ func NftPresaleToNftPresaleSimplified(nftPresale *models.NftPresale, noMeta bool
 		State:           nftPresale.State,
 		ProcessNumber:   nftPresale.ProcessNumber,
 		IsReLaunched:    nftPresale.IsReLaunched,
+		BoughtPrice:     nftPresale.BoughtPrice,
+		WhitelistTierId: nftPresale.WhitelistTierId,
 		MetaStr:         (*assetMeta).AssetMeta,
 		Whitelist:       whitelists,
 	}
@@ -620,12 +676,23 @@ func UpdateNftPresaleAndSelfAddBatchGroupSoldNumber(nftPresale *models.NftPresal
 		tx.Rollback()
 		return err
 	}
+
+	err = satBackQueue.EnqueuePurchasePresaleNFT(tx, satBackQueue.FeeInfo{
+		ID:       nftPresale.ID,
+		NpubKey:  nftPresale.BuyerUsername,
+		AssetsID: nftPresale.AssetId,
+		HandFee:  GetNftPresalePayPrice(nftPresale),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	return tx.Commit().Error
 }
 
 func ProcessNftPresaleStateBoughtNotPayService(nftPresale *models.NftPresale) error {
 
-	paidId, err := PayGasFee(nftPresale.BuyerUserId, nftPresale.Price)
+	paidId, err := PayGasFee(nftPresale.BuyerUserId, GetNftPresalePayPrice(nftPresale))
 	if err != nil {
 		return utils.AppendErrorInfo(err, "PayGasFee for nftPresale")
 	}
@@ -725,173 +792,19 @@ func ProcessNftPresaleStateSentPendingService(nftPresale *models.NftPresale) err
 }
 
 func ProcessAllNftPresaleStateBoughtNotPayService() (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	nftPresales, err := GetAllNftPresaleStateBoughtNotPay()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllNftPresaleStateBoughtNotPay")
-	}
-	for _, nftPresale := range *nftPresales {
-		{
-			err = IncreaseNftPresaleProcessNumber(&nftPresale)
-			if err != nil {
-
-			}
-			err = ProcessNftPresaleStateBoughtNotPayService(&nftPresale)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(nftPresaleWorkflow.Run(middleware.DB, int(models.NftPresaleStateBoughtNotPay)))
 }
 
 func ProcessAllNftPresaleStatePaidPendingService() (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	nftPresales, err := GetAllNftPresaleStatePaidPending()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllNftPresaleStatePaidPending")
-	}
-	for _, nftPresale := range *nftPresales {
-		{
-			err = IncreaseNftPresaleProcessNumber(&nftPresale)
-			if err != nil {
-
-			}
-			err = ProcessNftPresaleStatePaidPendingService(&nftPresale)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(nftPresaleWorkflow.Run(middleware.DB, int(models.NftPresaleStatePaidPending)))
 }
 
 func ProcessAllNftPresaleStatePaidNotSendService() (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	nftPresales, err := GetAllNftPresaleStatePaidNotSend()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllNftPresaleStatePaidNotSend")
-	}
-	for _, nftPresale := range *nftPresales {
-		{
-			err = IncreaseNftPresaleProcessNumber(&nftPresale)
-			if err != nil {
-
-			}
-			err = ProcessNftPresaleStatePaidNotSendService(&nftPresale)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(nftPresaleWorkflow.Run(middleware.DB, int(models.NftPresaleStatePaidNotSend)))
 }
 
 func ProcessAllNftPresaleStateSentPendingService() (*[]ProcessionResult, error) {
-	var processionResults []ProcessionResult
-	nftPresales, err := GetAllNftPresaleStateSentPending()
-	if err != nil {
-		return nil, utils.AppendErrorInfo(err, "GetAllNftPresaleStateSentPending")
-	}
-	for _, nftPresale := range *nftPresales {
-		{
-			err = IncreaseNftPresaleProcessNumber(&nftPresale)
-			if err != nil {
-
-			}
-			err = ProcessNftPresaleStateSentPendingService(&nftPresale)
-			if err != nil {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: false,
-						Error:   err.Error(),
-						Data:    nil,
-					},
-				})
-				continue
-			} else {
-				processionResults = append(processionResults, ProcessionResult{
-					Id: int(nftPresale.ID),
-					JsonResult: models.JsonResult{
-						Success: true,
-						Error:   "",
-						Data:    nil,
-					},
-				})
-			}
-		}
-
-	}
-	if processionResults == nil || len(processionResults) == 0 {
-		err = errors.New("procession results null")
-		return nil, err
-	}
-	return &processionResults, nil
+	return workflowProcessionResults(nftPresaleWorkflow.Run(middleware.DB, int(models.NftPresaleStateSentPending)))
 }
 
 func ProcessNftPresaleBoughtNotPay() {
@@ -1181,7 +1094,7 @@ func IsUserBoughtNftPresale(username string) (bool, error) {
 
 func CalculateNftPresaleNotPayAmount(username string) (notPayAmount int64, err error) {
 	err = middleware.DB.Table("nft_presales").
-		Select("sum(price)").
+		Select("sum(if(bought_price > 0, bought_price, price))").
 		Where("buyer_username = ? and state = ?", username, models.NftPresaleStateBoughtNotPay).
 		Scan(&notPayAmount).
 		Error
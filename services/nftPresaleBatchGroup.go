@@ -274,6 +274,29 @@ func ProcessNftPresaleBatchGroupLaunchRequestAndCreate(nftPresaleBatchGroupLaunc
 
 	info := batchGroupSetRequest.Info
 
+	var nftPresaleBatchGroup = models.NftPresaleBatchGroup{
+		GroupKey:      groupKey,
+		GroupName:     groupName,
+		SoldNumber:    0,
+		StartTime:     startTime,
+		EndTime:       endTime,
+		Info:          info,
+		PricingMode:   batchGroupSetRequest.PricingMode,
+		StartPrice:    batchGroupSetRequest.StartPrice,
+		EndPrice:      batchGroupSetRequest.EndPrice,
+		PriceStep:     batchGroupSetRequest.PriceStep,
+		PriceInterval: batchGroupSetRequest.PriceInterval,
+		GrowthRateBp:  batchGroupSetRequest.GrowthRateBp,
+	}
+	pricer, err := GetNftPresalePricer(nftPresaleBatchGroup.PricingMode)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "GetNftPresalePricer")
+	}
+	err = pricer.Validate(&nftPresaleBatchGroup)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Validate pricing")
+	}
+
 	nftPresaleSetRequests := nftPresaleBatchGroupLaunchRequest.NftPresaleSetRequests
 	if nftPresaleSetRequests == nil {
 		return errors.New("NftPresales is nil")
@@ -288,27 +311,26 @@ func ProcessNftPresaleBatchGroupLaunchRequestAndCreate(nftPresaleBatchGroupLaunc
 	if processedResult.Supply == 0 {
 		return errors.New("processedResult.Supply is 0")
 	}
+	if processedResult.NftPresales == nil {
+		return errors.New("processedResult.NftPresales is nil")
+	}
+	nftPresaleBatchGroup.Supply = processedResult.Supply
+	if nftPresaleBatchGroup.PricingMode != models.NftPresalePricingModeFixed {
+		// The group prices its presales, their own price is only the start price shown before the first sale.
+		for i := range *processedResult.NftPresales {
+			(*processedResult.NftPresales)[i].Price = nftPresaleBatchGroup.StartPrice
+		}
+		processedResult.LowestPrice, processedResult.HighestPrice = pricer.PriceRange(&nftPresaleBatchGroup)
+	}
 	if processedResult.LowestPrice == 0 {
 		return errors.New("processedResult.LowestPrice is 0")
 	}
 	if processedResult.HighestPrice == 0 {
 		return errors.New("processedResult.HighestPrice is 0")
 	}
-	if processedResult.NftPresales == nil {
-		return errors.New("processedResult.NftPresales is nil")
-	}
+	nftPresaleBatchGroup.LowestPrice = processedResult.LowestPrice
+	nftPresaleBatchGroup.HighestPrice = processedResult.HighestPrice
 
-	var nftPresaleBatchGroup = models.NftPresaleBatchGroup{
-		GroupKey:     groupKey,
-		GroupName:    groupName,
-		SoldNumber:   0,
-		Supply:       processedResult.Supply,
-		LowestPrice:  processedResult.LowestPrice,
-		HighestPrice: processedResult.HighestPrice,
-		StartTime:    startTime,
-		EndTime:      endTime,
-		Info:         info,
-	}
 	nftPresales := processedResult.NftPresales
 
 	err = CreateBatchGroupAndNftPresales(&nftPresaleBatchGroup, nftPresales)
@@ -363,18 +385,25 @@ func NftPresaleBatchGroupToNftPresaleBatchGroupSimplified(nftPresaleBatchGroup *
 		btlLog.PreSale.Error("%v", err)
 	}
 	return &models.NftPresaleBatchGroupSimplified{
-		ID:           nftPresaleBatchGroup.ID,
-		UpdatedAt:    nftPresaleBatchGroup.UpdatedAt,
-		GroupKey:     nftPresaleBatchGroup.GroupKey,
-		GroupName:    nftPresaleBatchGroup.GroupName,
-		SoldNumber:   nftPresaleBatchGroup.SoldNumber,
-		Supply:       nftPresaleBatchGroup.Supply,
-		LowestPrice:  nftPresaleBatchGroup.LowestPrice,
-		HighestPrice: nftPresaleBatchGroup.HighestPrice,
-		StartTime:    nftPresaleBatchGroup.StartTime,
-		EndTime:      nftPresaleBatchGroup.EndTime,
-		Info:         nftPresaleBatchGroup.Info,
-		FirstAssetId: assetId,
+		ID:                  nftPresaleBatchGroup.ID,
+		UpdatedAt:           nftPresaleBatchGroup.UpdatedAt,
+		GroupKey:            nftPresaleBatchGroup.GroupKey,
+		GroupName:           nftPresaleBatchGroup.GroupName,
+		SoldNumber:          nftPresaleBatchGroup.SoldNumber,
+		Supply:              nftPresaleBatchGroup.Supply,
+		LowestPrice:         nftPresaleBatchGroup.LowestPrice,
+		HighestPrice:        nftPresaleBatchGroup.HighestPrice,
+		StartTime:           nftPresaleBatchGroup.StartTime,
+		EndTime:             nftPresaleBatchGroup.EndTime,
+		Info:                nftPresaleBatchGroup.Info,
+		FirstAssetId:        assetId,
+		WhitelistMerkleRoot: nftPresaleBatchGroup.WhitelistMerkleRoot,
+		PricingMode:         nftPresaleBatchGroup.PricingMode,
+		StartPrice:          nftPresaleBatchGroup.StartPrice,
+		EndPrice:            nftPresaleBatchGroup.EndPrice,
+		PriceStep:           nftPresaleBatchGroup.PriceStep,
+		PriceInterval:       nftPresaleBatchGroup.PriceInterval,
+		GrowthRateBp:        nftPresaleBatchGroup.GrowthRateBp,
 	}
 }
 
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"trade/middleware"
+	"trade/models"
+	"trade/utils"
+)
+
+// NftPresalePricer prices the presales of a batch group in one pricing mode.
+type NftPresalePricer interface {
+	Validate(nftPresaleBatchGroup *models.NftPresaleBatchGroup) error
+	// Price is the price of the next sale, with sold presales of the group sold before it at the time now.
+	// The presale is nil when the price is only quoted.
+	Price(nftPresaleBatchGroup *models.NftPresaleBatchGroup, nftPresale *models.NftPresale, sold int, now int) int
+	// NextPrice is the price after the current one and the time it applies at, zero when it applies to the
+	// sale after the next one.
+	NextPrice(nftPresaleBatchGroup *models.NftPresaleBatchGroup, sold int, now int) (int, int)
+	// PriceRange is the lowest and the highest price the supply of the group can be sold at.
+	PriceRange(nftPresaleBatchGroup *models.NftPresaleBatchGroup) (int, int)
+}
+
+var nftPresalePricers = map[models.NftPresalePricingMode]NftPresalePricer{
+	models.NftPresalePricingModeFixed:            fixedNftPresalePricer{},
+	models.NftPresalePricingModeDutchAuction:     dutchAuctionNftPresalePricer{},
+	models.NftPresalePricingModeLinearCurve:      linearCurveNftPresalePricer{},
+	models.NftPresalePricingModeExponentialCurve: exponentialCurveNftPresalePricer{},
+}
+
+func GetNftPresalePricer(pricingMode models.NftPresalePricingMode) (NftPresalePricer, error) {
+	pricer, ok := nftPresalePricers[pricingMode]
+	if !ok {
+		return nil, errors.New("invalid nft presale pricing mode(" + strconv.Itoa(int(pricingMode)) + ")")
+	}
+	return pricer, nil
+}
+
+// fixedNftPresalePricer sells each presale at its own price, quotes use the lowest price of the group.
+type fixedNftPresalePricer struct{}
+
+func (fixedNftPresalePricer) Validate(nftPresaleBatchGroup *models.NftPresaleBatchGroup) error {
+	return nil
+}
+
+func (fixedNftPresalePricer) Price(nftPresaleBatchGroup *models.NftPresaleBatchGroup, nftPresale *models.NftPresale, sold int, now int) int {
+	if nftPresale != nil {
+		return nftPresale.Price
+	}
+	return nftPresaleBatchGroup.LowestPrice
+}
+
+func (fixedNftPresalePricer) NextPrice(nftPresaleBatchGroup *models.NftPresaleBatchGroup, sold int, now int) (int, int) {
+	return nftPresaleBatchGroup.LowestPrice, 0
+}
+
+func (fixedNftPresalePricer) PriceRange(nftPresaleBatchGroup *models.NftPresaleBatchGroup) (int, int) {
+	return nftPresaleBatchGroup.LowestPrice, nftPresaleBatchGroup.HighestPrice
+}
+
+type dutchAuctionNftPresalePricer struct{}
+
+func (dutchAuctionNftPresalePricer) Validate(nftPresaleBatchGroup *models.NftPresaleBatchGroup) error {
+	if nftPresaleBatchGroup.EndPrice <= 0 {
+		return errors.New("dutch auction end price(" + strconv.Itoa(nftPresaleBatchGroup.EndPrice) + ") must be greater than 0")
+	}
+	if nftPresaleBatchGroup.StartPrice < nftPresaleBatchGroup.EndPrice {
+		return errors.New("dutch auction start price(" + strconv.Itoa(nftPresaleBatchGroup.StartPrice) + ") is less than end price(" + strconv.Itoa(nftPresaleBatchGroup.EndPrice) + ")")
+	}
+	if nftPresaleBatchGroup.PriceStep <= 0 {
+		return errors.New("dutch auction price step(" + strconv.Itoa(nftPresaleBatchGroup.PriceStep) + ") must be greater than 0")
+	}
+	if nftPresaleBatchGroup.PriceInterval <= 0 {
+		return errors.New("dutch auction price interval(" + strconv.Itoa(nftPresaleBatchGroup.PriceInterval) + ") must be greater than 0")
+	}
+	return nil
+}
+
+func (p dutchAuctionNftPresalePricer) Price(nftPresaleBatchGroup *models.NftPresaleBatchGroup, nftPresale *models.NftPresale, sold int, now int) int {
+	return p.priceAtStep(nftPresaleBatchGroup, p.step(nftPresaleBatchGroup, now))
+}
+
+func (p dutchAuctionNftPresalePricer) NextPrice(nftPresaleBatchGroup *models.NftPresaleBatchGroup, sold int, now int) (int, int) {
+	step := p.step(nftPresaleBatchGroup, now)
+	price := p.priceAtStep(nftPresaleBatchGroup, step)
+	if price == nftPresaleBatchGroup.EndPrice {
+		return price, 0
+	}
+	return p.priceAtStep(nftPresaleBatchGroup, step+1), nftPresaleBatchGroup.StartTime + (step+1)*nftPresaleBatchGroup.PriceInterval
+}
+
+func (dutchAuctionNftPresalePricer) PriceRange(nftPresaleBatchGroup *models.NftPresaleBatchGroup) (int, int) {
+	return nftPresaleBatchGroup.EndPrice, nftPresaleBatchGroup.StartPrice
+}
+
+// step is the number of price intervals passed since the start time.
+func (dutchAuctionNftPresalePricer) step(nftPresaleBatchGroup *models.NftPresaleBatchGroup, now int) int {
+	if now <= nftPresaleBatchGroup.StartTime {
+		return 0
+	}
+	return (now - nftPresaleBatchGroup.StartTime) / nftPresaleBatchGroup.PriceInterval
+}
+
+func (dutchAuctionNftPresalePricer) priceAtStep(nftPresaleBatchGroup *models.NftPresaleBatchGroup, step int) int {
+	maxStep := (nftPresaleBatchGroup.StartPrice - nftPresaleBatchGroup.EndPrice) / nftPresaleBatchGroup.PriceStep
+	if step > maxStep {
+		return nftPresaleBatchGroup.EndPrice
+	}
+	return nftPresaleBatchGroup.StartPrice - step*nftPresaleBatchGroup.PriceStep
+}
+
+type linearCurveNftPresalePricer struct{}
+
+func (linearCurveNftPresalePricer) Validate(nftPresaleBatchGroup *models.NftPresaleBatchGroup) error {
+	if nftPresaleBatchGroup.StartPrice <= 0 {
+		return errors.New("linear curve start price(" + strconv.Itoa(nftPresaleBatchGroup.StartPrice) + ") must be greater than 0")
+	}
+	if nftPresaleBatchGroup.PriceStep <= 0 {
+		return errors.New("linear curve price step(" + strconv.Itoa(nftPresaleBatchGroup.PriceStep) + ") must be greater than 0")
+	}
+	if nftPresaleBatchGroup.EndPrice != 0 && nftPresaleBatchGroup.EndPrice < nftPresaleBatchGroup.StartPrice {
+		return errors.New("linear curve end price(" + strconv.Itoa(nftPresaleBatchGroup.EndPrice) + ") is less than start price(" + strconv.Itoa(nftPresaleBatchGroup.StartPrice) + ")")
+	}
+	return nil
+}
+
+func (p linearCurveNftPresalePricer) Price(nftPresaleBatchGroup *models.NftPresaleBatchGroup, nftPresale *models.NftPresale, sold int, now int) int {
+	return p.priceAtSold(nftPresaleBatchGroup, sold)
+}
+
+func (p linearCurveNftPresalePricer) NextPrice(nftPresaleBatchGroup *models.NftPresaleBatchGroup, sold int, now int) (int, int) {
+	return p.priceAtSold(nftPresaleBatchGroup, sold+1), 0
+}
+
+func (p linearCurveNftPresalePricer) PriceRange(nftPresaleBatchGroup *models.NftPresaleBatchGroup) (int, int) {
+	return nftPresaleBatchGroup.StartPrice, p.priceAtSold(nftPresaleBatchGroup, nftPresaleBatchGroup.Supply-1)
+}
+
+func (linearCurveNftPresalePricer) priceAtSold(nftPresaleBatchGroup *models.NftPresaleBatchGroup, sold int) int {
+	if sold < 0 {
+		sold = 0
+	}
+	price := nftPresaleBatchGroup.StartPrice + sold*nftPresaleBatchGroup.PriceStep
+	if nftPresaleBatchGroup.EndPrice > 0 && price > nftPresaleBatchGroup.EndPrice {
+		return nftPresaleBatchGroup.EndPrice
+	}
+	return price
+}
+
+type exponentialCurveNftPresalePricer struct{}
+
+func (exponentialCurveNftPresalePricer) Validate(nftPresaleBatchGroup *models.NftPresaleBatchGroup) error {
+	if nftPresaleBatchGroup.StartPrice <= 0 {
+		return errors.New("exponential curve start price(" + strconv.Itoa(nftPresaleBatchGroup.StartPrice) + ") must be greater than 0")
+	}
+	if nftPresaleBatchGroup.GrowthRateBp <= 0 {
+		return errors.New("exponential curve growth rate bp(" + strconv.Itoa(nftPresaleBatchGroup.GrowthRateBp) + ") must be greater than 0")
+	}
+	if nftPresaleBatchGroup.EndPrice < nftPresaleBatchGroup.StartPrice {
+		return errors.New("exponential curve end price(" + strconv.Itoa(nftPresaleBatchGroup.EndPrice) + ") is less than start price(" + strconv.Itoa(nftPresaleBatchGroup.StartPrice) + ")")
+	}
+	return nil
+}
+
+func (p exponentialCurveNftPresalePricer) Price(nftPresaleBatchGroup *models.NftPresaleBatchGroup, nftPresale *models.NftPresale, sold int, now int) int {
+	return p.priceAtSold(nftPresaleBatchGroup, sold)
+}
+
+func (p exponentialCurveNftPresalePricer) NextPrice(nftPresaleBatchGroup *models.NftPresaleBatchGroup, sold int, now int) (int, int) {
+	return p.priceAtSold(nftPresaleBatchGroup, sold+1), 0
+}
+
+func (p exponentialCurveNftPresalePricer) PriceRange(nftPresaleBatchGroup *models.NftPresaleBatchGroup) (int, int) {
+	return nftPresaleBatchGroup.StartPrice, p.priceAtSold(nftPresaleBatchGroup, nftPresaleBatchGroup.Supply-1)
+}
+
+// priceAtSold compounds the growth rate once per sold presale and rounds down, stopping at the end price. Each
+// step is truncated to 8 decimals so the precision does not grow with the steps, which stop at the supply.
+func (exponentialCurveNftPresalePricer) priceAtSold(nftPresaleBatchGroup *models.NftPresaleBatchGroup, sold int) int {
+	if nftPresaleBatchGroup.Supply > 0 && sold > nftPresaleBatchGroup.Supply {
+		sold = nftPresaleBatchGroup.Supply
+	}
+	endPrice := decimal.NewFromInt(int64(nftPresaleBatchGroup.EndPrice))
+	rate := decimal.NewFromInt(int64(10000 + nftPresaleBatchGroup.GrowthRateBp)).Div(decimal.NewFromInt(10000))
+	price := decimal.NewFromInt(int64(nftPresaleBatchGroup.StartPrice))
+	for i := 0; i < sold && price.LessThan(endPrice); i++ {
+		price = price.Mul(rate).Truncate(8)
+	}
+	if price.GreaterThan(endPrice) {
+		return nftPresaleBatchGroup.EndPrice
+	}
+	return int(price.Floor().IntPart())
+}
+
+// CountNftPresaleBatchGroupSold counts the presales of the batch group which are bought and not failed or canceled.
+func CountNftPresaleBatchGroupSold(tx *gorm.DB, batchGroupId int) (int, error) {
+	var count int64
+	err := tx.Model(&models.NftPresale{}).
+		Where("batch_group_id = ? AND state >= ? AND state <= ?", batchGroupId, models.NftPresaleStateBoughtNotPay, models.NftPresaleStateSent).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// GetNftPresaleBuyPrice prices a purchase of the presale. The price of the whitelist tier comes first, then the
+// pricing mode of the batch group, presales without a group sell at their own price. A price above maxPrice
+// fails the purchase unless maxPrice is zero.
+func GetNftPresaleBuyPrice(tx *gorm.DB, nftPresale *models.NftPresale, nftPresaleWhitelistTier *models.NftPresaleWhitelistTier, maxPrice int) (int, error) {
+	price, err := getNftPresaleBuyPrice(tx, nftPresale, nftPresaleWhitelistTier)
+	if err != nil {
+		return 0, err
+	}
+	err = CheckNftPresaleMaxPrice(price, maxPrice)
+	if err != nil {
+		return 0, err
+	}
+	return price, nil
+}
+
+// CheckNftPresaleMaxPrice fails a price above the max price of the buyer, a zero max price takes any price.
+func CheckNftPresaleMaxPrice(price int, maxPrice int) error {
+	if maxPrice < 0 {
+		return errors.New("max price(" + strconv.Itoa(maxPrice) + ") is invalid")
+	}
+	if maxPrice > 0 && price > maxPrice {
+		return errors.New("nft presale price(" + strconv.Itoa(price) + ") is above max price(" + strconv.Itoa(maxPrice) + ")")
+	}
+	return nil
+}
+
+func getNftPresaleBuyPrice(tx *gorm.DB, nftPresale *models.NftPresale, nftPresaleWhitelistTier *models.NftPresaleWhitelistTier) (int, error) {
+	if nftPresaleWhitelistTier != nil && nftPresaleWhitelistTier.Price > 0 {
+		return nftPresaleWhitelistTier.Price, nil
+	}
+	if nftPresale.BatchGroupId == 0 {
+		return nftPresale.Price, nil
+	}
+	var nftPresaleBatchGroup models.NftPresaleBatchGroup
+	err := tx.First(&nftPresaleBatchGroup, nftPresale.BatchGroupId).Error
+	if err != nil {
+		return 0, utils.AppendErrorInfo(err, "First NftPresaleBatchGroup")
+	}
+	pricer, err := GetNftPresalePricer(nftPresaleBatchGroup.PricingMode)
+	if err != nil {
+		return 0, utils.AppendErrorInfo(err, "GetNftPresalePricer")
+	}
+	if nftPresaleBatchGroup.PricingMode == models.NftPresalePricingModeFixed {
+		return pricer.Price(&nftPresaleBatchGroup, nftPresale, 0, 0), nil
+	}
+	if nftPresaleBatchGroup.PricingMode != models.NftPresalePricingModeDutchAuction {
+		// Purchases of a curve priced group are serialized on the group row, so each one counts those before it.
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.NftPresaleBatchGroup{}, nftPresale.BatchGroupId).Error
+		if err != nil {
+			return 0, utils.AppendErrorInfo(err, "lock nft presale batch group")
+		}
+	}
+	sold, err := CountNftPresaleBatchGroupSold(tx, nftPresale.BatchGroupId)
+	if err != nil {
+		return 0, utils.AppendErrorInfo(err, "CountNftPresaleBatchGroupSold")
+	}
+	price := pricer.Price(&nftPresaleBatchGroup, nftPresale, sold, utils.GetTimestamp())
+	if price <= 0 {
+		err = errors.New("nft presale batch group(" + strconv.Itoa(nftPresale.BatchGroupId) + ") price(" + strconv.Itoa(price) + ") is invalid")
+		return 0, err
+	}
+	return price, nil
+}
+
+func GetNftPresaleBatchGroupPriceQuote(batchGroupId int) (*models.NftPresaleBatchGroupPriceQuote, error) {
+	nftPresaleBatchGroup, err := ReadNftPresaleBatchGroup(uint(batchGroupId))
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "ReadNftPresaleBatchGroup")
+	}
+	pricer, err := GetNftPresalePricer(nftPresaleBatchGroup.PricingMode)
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "GetNftPresalePricer")
+	}
+	sold, err := CountNftPresaleBatchGroupSold(middleware.DB, batchGroupId)
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "CountNftPresaleBatchGroupSold")
+	}
+	now := utils.GetTimestamp()
+	nextPrice, nextPriceTime := pricer.NextPrice(nftPresaleBatchGroup, sold, now)
+	return &models.NftPresaleBatchGroupPriceQuote{
+		BatchGroupId:  batchGroupId,
+		PricingMode:   nftPresaleBatchGroup.PricingMode,
+		Sold:          sold,
+		Supply:        nftPresaleBatchGroup.Supply,
+		CurrentPrice:  pricer.Price(nftPresaleBatchGroup, nil, sold, now),
+		NextPrice:     nextPrice,
+		NextPriceTime: nextPriceTime,
+	}, nil
+}
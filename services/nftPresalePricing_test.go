@@ -0,0 +1,182 @@
+package services
+
+import (
+	"testing"
+	"trade/models"
+)
+
+func TestFixedNftPresalePricer(t *testing.T) {
+	p := fixedNftPresalePricer{}
+	g := &models.NftPresaleBatchGroup{LowestPrice: 100, HighestPrice: 500}
+	if got := p.Price(g, &models.NftPresale{Price: 300}, 7, 0); got != 300 {
+		t.Fatalf("price of a presale %d, want 300", got)
+	}
+	if got := p.Price(g, nil, 7, 0); got != 100 {
+		t.Fatalf("quoted price %d, want 100", got)
+	}
+	if price, at := p.NextPrice(g, 7, 0); price != 100 || at != 0 {
+		t.Fatalf("next price %d at %d, want 100 at 0", price, at)
+	}
+	if lowest, highest := p.PriceRange(g); lowest != 100 || highest != 500 {
+		t.Fatalf("price range %d %d, want 100 500", lowest, highest)
+	}
+}
+
+func TestDutchAuctionNftPresalePricer(t *testing.T) {
+	p := dutchAuctionNftPresalePricer{}
+	even := &models.NftPresaleBatchGroup{StartPrice: 1000, EndPrice: 400, PriceStep: 100, PriceInterval: 60, StartTime: 1000}
+	uneven := &models.NftPresaleBatchGroup{StartPrice: 1000, EndPrice: 450, PriceStep: 100, PriceInterval: 60, StartTime: 1000}
+	tests := []struct {
+		name          string
+		group         *models.NftPresaleBatchGroup
+		now           int
+		wantPrice     int
+		wantNextPrice int
+		wantNextTime  int
+	}{
+		{"before start", even, 900, 1000, 900, 1060},
+		{"at start", even, 1000, 1000, 900, 1060},
+		{"within first interval", even, 1059, 1000, 900, 1060},
+		{"first step", even, 1060, 900, 800, 1120},
+		{"later step", even, 1300, 500, 400, 1360},
+		{"reaches end price", even, 1360, 400, 400, 0},
+		{"stays at end price", even, 100000, 400, 400, 0},
+		{"last full step", uneven, 1300, 500, 450, 1360},
+		{"floors at end price", uneven, 1360, 450, 450, 0},
+		{"floors far out", uneven, 100000, 450, 450, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Validate(tt.group); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Price(tt.group, nil, 0, tt.now); got != tt.wantPrice {
+				t.Fatalf("price %d, want %d", got, tt.wantPrice)
+			}
+			price, at := p.NextPrice(tt.group, 0, tt.now)
+			if price != tt.wantNextPrice || at != tt.wantNextTime {
+				t.Fatalf("next price %d at %d, want %d at %d", price, at, tt.wantNextPrice, tt.wantNextTime)
+			}
+		})
+	}
+	if lowest, highest := p.PriceRange(uneven); lowest != 450 || highest != 1000 {
+		t.Fatalf("price range %d %d, want 450 1000", lowest, highest)
+	}
+}
+
+func TestLinearCurveNftPresalePricer(t *testing.T) {
+	p := linearCurveNftPresalePricer{}
+	capped := &models.NftPresaleBatchGroup{StartPrice: 100, PriceStep: 10, EndPrice: 150, Supply: 10}
+	uncapped := &models.NftPresaleBatchGroup{StartPrice: 100, PriceStep: 10, Supply: 10}
+	tests := []struct {
+		name          string
+		group         *models.NftPresaleBatchGroup
+		sold          int
+		wantPrice     int
+		wantNextPrice int
+	}{
+		{"nothing sold", capped, 0, 100, 110},
+		{"negative sold", capped, -1, 100, 100},
+		{"steps up", capped, 3, 130, 140},
+		{"reaches cap", capped, 5, 150, 150},
+		{"stays at cap", capped, 9, 150, 150},
+		{"uncapped", uncapped, 100, 1100, 1110},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Validate(tt.group); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Price(tt.group, nil, tt.sold, 0); got != tt.wantPrice {
+				t.Fatalf("price %d, want %d", got, tt.wantPrice)
+			}
+			price, at := p.NextPrice(tt.group, tt.sold, 0)
+			if price != tt.wantNextPrice || at != 0 {
+				t.Fatalf("next price %d at %d, want %d at 0", price, at, tt.wantNextPrice)
+			}
+		})
+	}
+	if lowest, highest := p.PriceRange(capped); lowest != 100 || highest != 150 {
+		t.Fatalf("capped price range %d %d, want 100 150", lowest, highest)
+	}
+	if lowest, highest := p.PriceRange(uncapped); lowest != 100 || highest != 190 {
+		t.Fatalf("uncapped price range %d %d, want 100 190", lowest, highest)
+	}
+}
+
+func TestExponentialCurveNftPresalePricer(t *testing.T) {
+	p := exponentialCurveNftPresalePricer{}
+	capped := &models.NftPresaleBatchGroup{StartPrice: 1000, GrowthRateBp: 1000, EndPrice: 2000, Supply: 20}
+	short := &models.NftPresaleBatchGroup{StartPrice: 1000, GrowthRateBp: 1000, EndPrice: 1 << 40, Supply: 3}
+	long := &models.NftPresaleBatchGroup{StartPrice: 100000000, GrowthRateBp: 1, EndPrice: 1 << 40, Supply: 10000}
+	tests := []struct {
+		name          string
+		group         *models.NftPresaleBatchGroup
+		sold          int
+		wantPrice     int
+		wantNextPrice int
+	}{
+		{"nothing sold", capped, 0, 1000, 1100},
+		{"compounds", capped, 2, 1210, 1331},
+		{"rounds down", capped, 4, 1464, 1610},
+		{"last step under cap", capped, 7, 1948, 2000},
+		{"reaches cap", capped, 8, 2000, 2000},
+		{"stays at cap", capped, 20, 2000, 2000},
+		{"stops at supply", short, 3, 1331, 1331},
+		{"stops at supply far out", short, 1000000000, 1331, 1331},
+		{"truncates every step", long, 10000, 271814592, 271814592},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Validate(tt.group); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Price(tt.group, nil, tt.sold, 0); got != tt.wantPrice {
+				t.Fatalf("price %d, want %d", got, tt.wantPrice)
+			}
+			price, at := p.NextPrice(tt.group, tt.sold, 0)
+			if price != tt.wantNextPrice || at != 0 {
+				t.Fatalf("next price %d at %d, want %d at 0", price, at, tt.wantNextPrice)
+			}
+		})
+	}
+	if lowest, highest := p.PriceRange(short); lowest != 1000 || highest != 1210 {
+		t.Fatalf("price range %d %d, want 1000 1210", lowest, highest)
+	}
+}
+
+func TestCheckNftPresaleMaxPrice(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    int
+		maxPrice int
+		wantErr  bool
+	}{
+		{"no max price", 500, 0, false},
+		{"below max price", 400, 500, false},
+		{"at max price", 500, 500, false},
+		{"above max price", 501, 500, true},
+		{"negative max price", 500, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckNftPresaleMaxPrice(tt.price, tt.maxPrice); (err != nil) != tt.wantErr {
+				t.Fatalf("err %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetNftPresaleBuyPriceMaxPrice(t *testing.T) {
+	nftPresale := &models.NftPresale{Price: 300}
+	tier := &models.NftPresaleWhitelistTier{Price: 200}
+	if price, err := GetNftPresaleBuyPrice(nil, nftPresale, tier, 200); err != nil || price != 200 {
+		t.Fatalf("tier price %d, %v, want 200", price, err)
+	}
+	if _, err := GetNftPresaleBuyPrice(nil, nftPresale, tier, 199); err == nil {
+		t.Fatal("tier price above the max price is bought")
+	}
+	if _, err := GetNftPresaleBuyPrice(nil, nftPresale, nil, 299); err == nil {
+		t.Fatal("presale price above the max price is bought")
+	}
+}
@@ -1,9 +1,19 @@
 package services
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"errors"
+	"gorm.io/gorm"
+	"io"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"trade/btlLog"
+	"trade/middleware"
 	"trade/models"
 	"trade/services/btldb"
 	"trade/utils"
@@ -37,16 +47,45 @@ func ReadAllNftPresaleWhitelists() (*[]models.NftPresaleWhitelist, error) {
 	return btldb.ReadAllNftPresaleWhitelists()
 }
 
+// UpdateNftPresaleWhitelist updates the entry and the merkle roots of the batch groups it was and is in.
 func UpdateNftPresaleWhitelist(nftPresaleWhitelist *models.NftPresaleWhitelist) error {
-	return btldb.UpdateNftPresaleWhitelist(nftPresaleWhitelist)
+	return UpdateNftPresaleWhitelists(&[]models.NftPresaleWhitelist{*nftPresaleWhitelist})
 }
 
 func UpdateNftPresaleWhitelists(nftPresaleWhitelists *[]models.NftPresaleWhitelist) error {
-	return btldb.UpdateNftPresaleWhitelists(nftPresaleWhitelists)
+	changed := slices.Clone(*nftPresaleWhitelists)
+	for _, nftPresaleWhitelist := range *nftPresaleWhitelists {
+		old, err := ReadNftPresaleWhitelist(nftPresaleWhitelist.ID)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "ReadNftPresaleWhitelist")
+		}
+		changed = append(changed, *old)
+	}
+	err := btldb.UpdateNftPresaleWhitelists(nftPresaleWhitelists)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "UpdateNftPresaleWhitelists")
+	}
+	err = updateNftPresaleBatchGroupWhitelistMerkleRoots(&changed)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "updateNftPresaleBatchGroupWhitelistMerkleRoots")
+	}
+	return nil
 }
 
 func DeleteNftPresaleWhitelist(id uint) error {
-	return btldb.DeleteNftPresaleWhitelist(id)
+	nftPresaleWhitelist, err := ReadNftPresaleWhitelist(id)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "ReadNftPresaleWhitelist")
+	}
+	err = btldb.DeleteNftPresaleWhitelist(id)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "DeleteNftPresaleWhitelist")
+	}
+	err = updateNftPresaleBatchGroupWhitelistMerkleRoots(&[]models.NftPresaleWhitelist{*nftPresaleWhitelist})
+	if err != nil {
+		return utils.AppendErrorInfo(err, "updateNftPresaleBatchGroupWhitelistMerkleRoots")
+	}
+	return nil
 }
 
 func GetNftPresaleWhitelistsByAssetId(assetId string) (*[]models.NftPresaleWhitelist, error) {
@@ -174,6 +213,10 @@ func AddWhitelistByRequest(nftPresaleWhitelistSetRequest *models.NftPresaleWhite
 	if err != nil {
 		return utils.AppendErrorInfo(err, "CreateNftPresaleWhitelist")
 	}
+	err = updateNftPresaleBatchGroupWhitelistMerkleRoots(&[]models.NftPresaleWhitelist{*nftPresaleWhitelist})
+	if err != nil {
+		return utils.AppendErrorInfo(err, "updateNftPresaleBatchGroupWhitelistMerkleRoots")
+	}
 	return nil
 }
 
@@ -189,5 +232,457 @@ func AddWhitelistsByRequests(nftPresaleWhitelistSetRequests *[]models.NftPresale
 	if err != nil {
 		return utils.AppendErrorInfo(err, "CreateNftPresaleWhitelists")
 	}
+	err = updateNftPresaleBatchGroupWhitelistMerkleRoots(nftPresaleWhitelists)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "updateNftPresaleBatchGroupWhitelistMerkleRoots")
+	}
+	return nil
+}
+
+// GetNftPresaleWhitelistOfUsername looks the user up in the whitelist of the asset of the presale, then in
+// the one of its batch group. It returns nil when the user is on neither.
+func GetNftPresaleWhitelistOfUsername(nftPresale *models.NftPresale, username string) (*models.NftPresaleWhitelist, error) {
+	nftPresaleWhitelist, err := btldb.ReadNftPresaleWhitelistByAssetIdAndUsername(nftPresale.AssetId, username)
+	if err == nil {
+		return nftPresaleWhitelist, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.AppendErrorInfo(err, "ReadNftPresaleWhitelistByAssetIdAndUsername")
+	}
+	if nftPresale.BatchGroupId == 0 {
+		return nil, nil
+	}
+	nftPresaleWhitelist, err = btldb.ReadNftPresaleWhitelistByBatchGroupIdAndUsername(nftPresale.BatchGroupId, username)
+	if err == nil {
+		return nftPresaleWhitelist, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.AppendErrorInfo(err, "ReadNftPresaleWhitelistByBatchGroupIdAndUsername")
+	}
+	return nil, nil
+}
+
+// IsNftPresaleWhitelisted reports whether the presale is limited to a whitelist.
+func IsNftPresaleWhitelisted(nftPresale *models.NftPresale) (bool, error) {
+	isExist, err := btldb.IsNftPresaleWhitelistOfAssetIdExist(nftPresale.AssetId)
+	if err != nil {
+		return false, utils.AppendErrorInfo(err, "IsNftPresaleWhitelistOfAssetIdExist")
+	}
+	if isExist || nftPresale.BatchGroupId == 0 {
+		return isExist, nil
+	}
+	isExist, err = btldb.IsNftPresaleWhitelistOfBatchGroupIdExist(nftPresale.BatchGroupId)
+	if err != nil {
+		return false, utils.AppendErrorInfo(err, "IsNftPresaleWhitelistOfBatchGroupIdExist")
+	}
+	return isExist, nil
+}
+
+// GetNftPresaleWhitelistTierOfUsername fails when the whitelist of the presale does not pass the user. The
+// tier is nil when the presale has no whitelist or the user is on it without a tier.
+func GetNftPresaleWhitelistTierOfUsername(nftPresale *models.NftPresale, username string) (*models.NftPresaleWhitelistTier, error) {
+	if nftPresale == nil {
+		return nil, errors.New("nftPresale is nil")
+	}
+	nftPresaleWhitelist, err := GetNftPresaleWhitelistOfUsername(nftPresale, username)
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "GetNftPresaleWhitelistOfUsername")
+	}
+	if nftPresaleWhitelist == nil {
+		isWhitelisted, err := IsNftPresaleWhitelisted(nftPresale)
+		if err != nil {
+			return nil, utils.AppendErrorInfo(err, "IsNftPresaleWhitelisted")
+		}
+		if isWhitelisted {
+			return nil, errors.New("username(" + username + ") not found in Whitelists")
+		}
+		return nil, nil
+	}
+	if nftPresaleWhitelist.TierId == 0 {
+		return nil, nil
+	}
+	nftPresaleWhitelistTier, err := btldb.ReadNftPresaleWhitelistTier(nftPresaleWhitelist.TierId)
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "ReadNftPresaleWhitelistTier")
+	}
+	return nftPresaleWhitelistTier, nil
+}
+
+// IsPurchasableTimeValidInTier checks the time window of the tier, or of the presale when the tier has none.
+func IsPurchasableTimeValidInTier(nftPresale *models.NftPresale, nftPresaleWhitelistTier *models.NftPresaleWhitelistTier) (bool, error) {
+	if nftPresaleWhitelistTier == nil || (nftPresaleWhitelistTier.StartTime == 0 && nftPresaleWhitelistTier.EndTime == 0) {
+		return IsPurchasableTimeValid(nftPresale)
+	}
+	isValid := IsDuringPurchasableTime(nftPresaleWhitelistTier.StartTime, nftPresaleWhitelistTier.EndTime)
+	if !isValid {
+		return false, errors.New("whitelist tier(" + nftPresaleWhitelistTier.Name + ") StartTime(" + strconv.Itoa(nftPresaleWhitelistTier.StartTime) + ") and EndTime(" + strconv.Itoa(nftPresaleWhitelistTier.EndTime) + ") is not valid")
+	}
+	return isValid, nil
+}
+
+// CheckNftPresaleWhitelistTierPurchases fails when the user has made all the purchases the tier allows.
+// Call it in the transaction of the purchase after locking the user row.
+func CheckNftPresaleWhitelistTierPurchases(tx *gorm.DB, userId int, nftPresaleWhitelistTier *models.NftPresaleWhitelistTier) error {
+	if nftPresaleWhitelistTier == nil || nftPresaleWhitelistTier.MaxPurchases == 0 {
+		return nil
+	}
+	var purchases int64
+	err := tx.Model(&models.NftPresale{}).
+		Where("buyer_user_id = ? AND whitelist_tier_id = ? AND state <> ?", userId, nftPresaleWhitelistTier.ID, models.NftPresaleStateFailOrCanceled).
+		Count(&purchases).Error
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Count nftPresales")
+	}
+	if purchases >= int64(nftPresaleWhitelistTier.MaxPurchases) {
+		return errors.New("user(" + strconv.Itoa(userId) + ") has bought " + strconv.FormatInt(purchases, 10) + " nft presales, the max purchases of whitelist tier(" + nftPresaleWhitelistTier.Name + ") is " + strconv.Itoa(nftPresaleWhitelistTier.MaxPurchases))
+	}
+	return nil
+}
+
+// nftPresaleWhitelistLeaf encodes a user of the whitelist of a batch group with the terms of their tier. Each
+// field is written as its 4 byte big-endian length followed by its bytes, numbers in decimal, so no username
+// can shift the fields after it.
+func nftPresaleWhitelistLeaf(batchGroupId int, username string, nftPresaleWhitelistTier *models.NftPresaleWhitelistTier) []byte {
+	var tier models.NftPresaleWhitelistTier
+	if nftPresaleWhitelistTier != nil {
+		tier = *nftPresaleWhitelistTier
+	}
+	fields := []string{
+		strconv.Itoa(batchGroupId),
+		username,
+		strconv.Itoa(tier.Price),
+		strconv.Itoa(tier.MaxPurchases),
+		strconv.Itoa(tier.StartTime),
+		strconv.Itoa(tier.EndTime),
+	}
+	var leaf []byte
+	for _, field := range fields {
+		leaf = binary.BigEndian.AppendUint32(leaf, uint32(len(field)))
+		leaf = append(leaf, field...)
+	}
+	return leaf
+}
+
+// getNftPresaleBatchGroupWhitelistLeaves returns the sorted leaves of the whitelist of the batch group, a user
+// listed twice counts with the latest entry.
+func getNftPresaleBatchGroupWhitelistLeaves(tx *gorm.DB, batchGroupId int) ([][]byte, error) {
+	var nftPresaleWhitelists []models.NftPresaleWhitelist
+	err := tx.Where("whitelist_type = ? AND batch_group_id = ?", models.WhitelistTypeGroupBatch, batchGroupId).
+		Order("id").
+		Find(&nftPresaleWhitelists).Error
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "Find nftPresaleWhitelists")
+	}
+	var nftPresaleWhitelistTiers []models.NftPresaleWhitelistTier
+	err = tx.Where("whitelist_type = ? AND batch_group_id = ?", models.WhitelistTypeGroupBatch, batchGroupId).
+		Find(&nftPresaleWhitelistTiers).Error
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "Find nftPresaleWhitelistTiers")
+	}
+	tierById := make(map[uint]*models.NftPresaleWhitelistTier)
+	for i := range nftPresaleWhitelistTiers {
+		tierById[nftPresaleWhitelistTiers[i].ID] = &nftPresaleWhitelistTiers[i]
+	}
+	tierIdByUsername := make(map[string]uint)
+	for _, nftPresaleWhitelist := range nftPresaleWhitelists {
+		tierIdByUsername[nftPresaleWhitelist.Username] = nftPresaleWhitelist.TierId
+	}
+	leaves := make([][]byte, 0, len(tierIdByUsername))
+	for username, tierId := range tierIdByUsername {
+		leaves = append(leaves, nftPresaleWhitelistLeaf(batchGroupId, username, tierById[tierId]))
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i], leaves[j]) < 0
+	})
+	return leaves, nil
+}
+
+// UpdateNftPresaleBatchGroupWhitelistMerkleRoot stores the merkle root over the whitelist of the batch group.
+func UpdateNftPresaleBatchGroupWhitelistMerkleRoot(tx *gorm.DB, batchGroupId int) (string, error) {
+	leaves, err := getNftPresaleBatchGroupWhitelistLeaves(tx, batchGroupId)
+	if err != nil {
+		return "", utils.AppendErrorInfo(err, "getNftPresaleBatchGroupWhitelistLeaves")
+	}
+	merkleRoot := hex.EncodeToString(utils.MerkleRoot(leaves))
+	err = tx.Model(&models.NftPresaleBatchGroup{}).Where("id = ?", batchGroupId).Update("whitelist_merkle_root", merkleRoot).Error
+	if err != nil {
+		return "", utils.AppendErrorInfo(err, "Update whitelist_merkle_root")
+	}
+	return merkleRoot, nil
+}
+
+func updateNftPresaleBatchGroupWhitelistMerkleRoots(nftPresaleWhitelists *[]models.NftPresaleWhitelist) error {
+	updated := make(map[int]bool)
+	for _, nftPresaleWhitelist := range *nftPresaleWhitelists {
+		if nftPresaleWhitelist.WhitelistType != models.WhitelistTypeGroupBatch || updated[nftPresaleWhitelist.BatchGroupId] {
+			continue
+		}
+		_, err := UpdateNftPresaleBatchGroupWhitelistMerkleRoot(middleware.DB, nftPresaleWhitelist.BatchGroupId)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "UpdateNftPresaleBatchGroupWhitelistMerkleRoot")
+		}
+		updated[nftPresaleWhitelist.BatchGroupId] = true
+	}
 	return nil
 }
+
+// GetNftPresaleWhitelistMerkleProof returns the entry of the user in the whitelist of the batch group with
+// the proof of it against the merkle root of the group.
+func GetNftPresaleWhitelistMerkleProof(batchGroupId int, username string) (*models.NftPresaleWhitelistMerkleProof, error) {
+	nftPresaleBatchGroup, err := ReadNftPresaleBatchGroup(uint(batchGroupId))
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "ReadNftPresaleBatchGroup")
+	}
+	nftPresaleWhitelist, err := btldb.ReadNftPresaleWhitelistByBatchGroupIdAndUsername(batchGroupId, username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("username(" + username + ") not found in Whitelists")
+		}
+		return nil, utils.AppendErrorInfo(err, "ReadNftPresaleWhitelistByBatchGroupIdAndUsername")
+	}
+	var nftPresaleWhitelistTier *models.NftPresaleWhitelistTier
+	if nftPresaleWhitelist.TierId != 0 {
+		nftPresaleWhitelistTier, err = btldb.ReadNftPresaleWhitelistTier(nftPresaleWhitelist.TierId)
+		if err != nil {
+			return nil, utils.AppendErrorInfo(err, "ReadNftPresaleWhitelistTier")
+		}
+	}
+	leaves, err := getNftPresaleBatchGroupWhitelistLeaves(middleware.DB, batchGroupId)
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "getNftPresaleBatchGroupWhitelistLeaves")
+	}
+	leaf := nftPresaleWhitelistLeaf(batchGroupId, username, nftPresaleWhitelistTier)
+	index := slices.IndexFunc(leaves, func(l []byte) bool {
+		return bytes.Equal(l, leaf)
+	})
+	if index < 0 {
+		return nil, errors.New("leaf of username(" + username + ") not found in whitelist merkle tree")
+	}
+	merkleRoot := hex.EncodeToString(utils.MerkleRoot(leaves))
+	if merkleRoot != nftPresaleBatchGroup.WhitelistMerkleRoot {
+		// A proof against a root which is not published would not verify, the root is refreshed by the
+		// changes of the whitelist.
+		return nil, errors.New("whitelist merkle root of batch group(" + strconv.Itoa(batchGroupId) + ") is out of date")
+	}
+	var proof []string
+	for _, sibling := range utils.MerkleProof(leaves, index) {
+		proof = append(proof, hex.EncodeToString(sibling))
+	}
+	merkleProof := models.NftPresaleWhitelistMerkleProof{
+		BatchGroupId: batchGroupId,
+		Username:     username,
+		Leaf:         hex.EncodeToString(leaf),
+		Proof:        proof,
+		MerkleRoot:   merkleRoot,
+	}
+	if nftPresaleWhitelistTier != nil {
+		merkleProof.Price = nftPresaleWhitelistTier.Price
+		merkleProof.MaxPurchases = nftPresaleWhitelistTier.MaxPurchases
+		merkleProof.StartTime = nftPresaleWhitelistTier.StartTime
+		merkleProof.EndTime = nftPresaleWhitelistTier.EndTime
+	}
+	return &merkleProof, nil
+}
+
+const importNftPresaleWhitelistBatchSize = 1000
+
+type nftPresaleWhitelistCsvRow struct {
+	Username string
+	TierName string
+	Tier     models.NftPresaleWhitelistTier
+}
+
+func parseNftPresaleWhitelistCsvRecord(record []string) (*nftPresaleWhitelistCsvRow, error) {
+	if len(record) == 0 || len(record) > 6 {
+		return nil, errors.New("record has " + strconv.Itoa(len(record)) + " columns, expect 1 to 6")
+	}
+	fields := make([]string, 6)
+	for i, field := range record {
+		fields[i] = strings.TrimSpace(field)
+	}
+	row := nftPresaleWhitelistCsvRow{
+		Username: fields[0],
+		TierName: fields[1],
+	}
+	if row.Username == "" {
+		return nil, errors.New("username is empty")
+	}
+	terms := []*int{&row.Tier.Price, &row.Tier.MaxPurchases, &row.Tier.StartTime, &row.Tier.EndTime}
+	for i, term := range terms {
+		field := fields[i+2]
+		if field == "" {
+			continue
+		}
+		if row.TierName == "" {
+			return nil, errors.New("terms are set without a tier")
+		}
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, utils.AppendErrorInfo(err, "Atoi("+field+")")
+		}
+		if value < 0 {
+			return nil, errors.New("term(" + field + ") is negative")
+		}
+		*term = value
+	}
+	if row.Tier.EndTime != 0 && row.Tier.EndTime <= row.Tier.StartTime {
+		return nil, errors.New("end_time(" + strconv.Itoa(row.Tier.EndTime) + ") is not after start_time(" + strconv.Itoa(row.Tier.StartTime) + ")")
+	}
+	return &row, nil
+}
+
+func getUserIdsByUsernames(usernames []string) (map[string]int, error) {
+	userIds := make(map[string]int, len(usernames))
+	for start := 0; start < len(usernames); start += importNftPresaleWhitelistBatchSize {
+		end := min(start+importNftPresaleWhitelistBatchSize, len(usernames))
+		var users []models.User
+		err := middleware.DB.Select("id", "user_name").Where("user_name IN ?", usernames[start:end]).Find(&users).Error
+		if err != nil {
+			return nil, utils.AppendErrorInfo(err, "Find users")
+		}
+		for _, user := range users {
+			userIds[user.Username] = int(user.ID)
+		}
+	}
+	return userIds, nil
+}
+
+// ImportNftPresaleWhitelistCsv adds the users of a csv to the whitelist of an asset or a batch group. Each
+// row is username,tier,price,max_purchases,start_time,end_time, where all but the username may be empty, and
+// a header row starting with username is skipped. The rows of a tier must agree on its terms. Users already
+// on the whitelist get the tier of the csv.
+func ImportNftPresaleWhitelistCsv(whitelistType models.WhitelistType, assetId string, batchGroupId int, reader io.Reader) (*models.NftPresaleWhitelistImportResult, error) {
+	if whitelistType == models.WhitelistTypeAsset {
+		if assetId == "" {
+			return nil, errors.New("assetId is empty")
+		}
+		batchGroupId = 0
+	} else if whitelistType == models.WhitelistTypeGroupBatch {
+		if batchGroupId == 0 {
+			return nil, errors.New("batchGroupId is 0")
+		}
+		_, err := ReadNftPresaleBatchGroup(uint(batchGroupId))
+		if err != nil {
+			return nil, utils.AppendErrorInfo(err, "ReadNftPresaleBatchGroup")
+		}
+		assetId = ""
+	} else {
+		return nil, errors.New("whitelistType(" + strconv.Itoa(int(whitelistType)) + ") is invalid")
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "ReadAll csv")
+	}
+	var rows []nftPresaleWhitelistCsvRow
+	var usernames []string
+	var tierNames []string
+	tiers := make(map[string]models.NftPresaleWhitelistTier)
+	listed := make(map[string]bool)
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "username") {
+			continue
+		}
+		line := "line " + strconv.Itoa(i+1)
+		row, err := parseNftPresaleWhitelistCsvRecord(record)
+		if err != nil {
+			return nil, utils.AppendErrorInfo(err, line)
+		}
+		if listed[row.Username] {
+			return nil, errors.New(line + ": username(" + row.Username + ") is listed twice")
+		}
+		listed[row.Username] = true
+		if row.TierName != "" {
+			tier, ok := tiers[row.TierName]
+			if !ok {
+				tiers[row.TierName] = row.Tier
+				tierNames = append(tierNames, row.TierName)
+			} else if tier.Price != row.Tier.Price || tier.MaxPurchases != row.Tier.MaxPurchases || tier.StartTime != row.Tier.StartTime || tier.EndTime != row.Tier.EndTime {
+				return nil, errors.New(line + ": terms of tier(" + row.TierName + ") differ from its earlier rows")
+			}
+		}
+		rows = append(rows, *row)
+		usernames = append(usernames, row.Username)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("csv has no whitelist rows")
+	}
+	userIds, err := getUserIdsByUsernames(usernames)
+	if err != nil {
+		return nil, utils.AppendErrorInfo(err, "getUserIdsByUsernames")
+	}
+	for _, username := range usernames {
+		if _, ok := userIds[username]; !ok {
+			return nil, errors.New("user(" + username + ") not found")
+		}
+	}
+
+	var merkleRoot string
+	err = middleware.DB.Transaction(func(tx *gorm.DB) error {
+		tierIds := make(map[string]uint, len(tierNames))
+		for _, tierName := range tierNames {
+			var nftPresaleWhitelistTier models.NftPresaleWhitelistTier
+			err := tx.Where("whitelist_type = ? AND asset_id = ? AND batch_group_id = ? AND name = ?", whitelistType, assetId, batchGroupId, tierName).
+				First(&nftPresaleWhitelistTier).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.AppendErrorInfo(err, "First nftPresaleWhitelistTier")
+			}
+			tier := tiers[tierName]
+			nftPresaleWhitelistTier.WhitelistType = whitelistType
+			nftPresaleWhitelistTier.AssetId = assetId
+			nftPresaleWhitelistTier.BatchGroupId = batchGroupId
+			nftPresaleWhitelistTier.Name = tierName
+			nftPresaleWhitelistTier.Price = tier.Price
+			nftPresaleWhitelistTier.MaxPurchases = tier.MaxPurchases
+			nftPresaleWhitelistTier.StartTime = tier.StartTime
+			nftPresaleWhitelistTier.EndTime = tier.EndTime
+			err = tx.Save(&nftPresaleWhitelistTier).Error
+			if err != nil {
+				return utils.AppendErrorInfo(err, "Save nftPresaleWhitelistTier")
+			}
+			tierIds[tierName] = nftPresaleWhitelistTier.ID
+		}
+
+		for start := 0; start < len(usernames); start += importNftPresaleWhitelistBatchSize {
+			end := min(start+importNftPresaleWhitelistBatchSize, len(usernames))
+			err := tx.Where("whitelist_type = ? AND asset_id = ? AND batch_group_id = ? AND username IN ?", whitelistType, assetId, batchGroupId, usernames[start:end]).
+				Delete(&models.NftPresaleWhitelist{}).Error
+			if err != nil {
+				return utils.AppendErrorInfo(err, "Delete nftPresaleWhitelists")
+			}
+		}
+		nftPresaleWhitelists := make([]models.NftPresaleWhitelist, 0, len(rows))
+		for _, row := range rows {
+			nftPresaleWhitelists = append(nftPresaleWhitelists, models.NftPresaleWhitelist{
+				WhitelistType: whitelistType,
+				AssetId:       assetId,
+				BatchGroupId:  batchGroupId,
+				UserId:        userIds[row.Username],
+				Username:      row.Username,
+				TierId:        tierIds[row.TierName],
+			})
+		}
+		err := tx.CreateInBatches(&nftPresaleWhitelists, importNftPresaleWhitelistBatchSize).Error
+		if err != nil {
+			return utils.AppendErrorInfo(err, "CreateInBatches nftPresaleWhitelists")
+		}
+
+		if whitelistType == models.WhitelistTypeGroupBatch {
+			merkleRoot, err = UpdateNftPresaleBatchGroupWhitelistMerkleRoot(tx, batchGroupId)
+			if err != nil {
+				return utils.AppendErrorInfo(err, "UpdateNftPresaleBatchGroupWhitelistMerkleRoot")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.NftPresaleWhitelistImportResult{
+		TierNumber:      len(tierNames),
+		WhitelistNumber: len(rows),
+		MerkleRoot:      merkleRoot,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"trade/models"
+)
+
+func TestParseNftPresaleWhitelistCsvRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  []string
+		want    nftPresaleWhitelistCsvRow
+		wantErr bool
+	}{
+		{"username only", []string{"alice"}, nftPresaleWhitelistCsvRow{Username: "alice"}, false},
+		{"trims fields", []string{" alice ", " early "}, nftPresaleWhitelistCsvRow{Username: "alice", TierName: "early"}, false},
+		{
+			"all terms",
+			[]string{"alice", "early", "1000", "2", "100", "200"},
+			nftPresaleWhitelistCsvRow{Username: "alice", TierName: "early", Tier: models.NftPresaleWhitelistTier{Price: 1000, MaxPurchases: 2, StartTime: 100, EndTime: 200}},
+			false,
+		},
+		{
+			"empty terms are unset",
+			[]string{"alice", "early", "", "3", "", ""},
+			nftPresaleWhitelistCsvRow{Username: "alice", TierName: "early", Tier: models.NftPresaleWhitelistTier{MaxPurchases: 3}},
+			false,
+		},
+		{"no columns", []string{}, nftPresaleWhitelistCsvRow{}, true},
+		{"too many columns", []string{"alice", "early", "1", "1", "1", "2", "x"}, nftPresaleWhitelistCsvRow{}, true},
+		{"empty username", []string{" ", "early"}, nftPresaleWhitelistCsvRow{}, true},
+		{"terms without a tier", []string{"alice", "", "1000"}, nftPresaleWhitelistCsvRow{}, true},
+		{"term is not a number", []string{"alice", "early", "ten"}, nftPresaleWhitelistCsvRow{}, true},
+		{"negative term", []string{"alice", "early", "-1"}, nftPresaleWhitelistCsvRow{}, true},
+		{"end before start", []string{"alice", "early", "", "", "200", "100"}, nftPresaleWhitelistCsvRow{}, true},
+		{"end at start", []string{"alice", "early", "", "", "200", "200"}, nftPresaleWhitelistCsvRow{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNftPresaleWhitelistCsvRecord(tt.record)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Fatalf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNftPresaleWhitelistLeaf(t *testing.T) {
+	tier := &models.NftPresaleWhitelistTier{Price: 1000, MaxPurchases: 2, StartTime: 100, EndTime: 200}
+	want := []byte("\x00\x00\x00\x017\x00\x00\x00\x05alice\x00\x00\x00\x041000\x00\x00\x00\x012\x00\x00\x00\x03100\x00\x00\x00\x03200")
+	if got := nftPresaleWhitelistLeaf(7, "alice", tier); !bytes.Equal(got, want) {
+		t.Fatalf("leaf %q, want %q", got, want)
+	}
+	// With comma joined fields the username "alice,1000" with no tier read the same as "alice" with price 1000.
+	shifted := nftPresaleWhitelistLeaf(7, "alice,1000", &models.NftPresaleWhitelistTier{MaxPurchases: 2, StartTime: 100, EndTime: 200})
+	if bytes.Equal(shifted, nftPresaleWhitelistLeaf(7, "alice", &models.NftPresaleWhitelistTier{Price: 2, StartTime: 100, EndTime: 200})) {
+		t.Fatal("a username with a comma shifts the terms of the leaf")
+	}
+}
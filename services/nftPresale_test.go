@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+	"trade/middleware/dbtest"
+	"trade/models"
+)
+
+func TestUpdateNftPresaleByPurchaseInfo(t *testing.T) {
+	db := dbtest.Open(t, &models.NftPresale{})
+	launched := models.NftPresale{AssetId: "asset", Price: 300, State: models.NftPresaleStateLaunched}
+	if err := db.Create(&launched).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Both buyers read the presale while it was launched.
+	first, second := launched, launched
+	tier := &models.NftPresaleWhitelistTier{}
+	tier.ID = 4
+	err := UpdateNftPresaleByPurchaseInfo(db, 1, "alice", "device1", "addr1", "script1", "internal1", 300, tier, &first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.State != models.NftPresaleStateBoughtNotPay || first.BuyerUserId != 1 || first.WhitelistTierId != 4 {
+		t.Fatalf("bought presale %+v", first)
+	}
+	err = UpdateNftPresaleByPurchaseInfo(db, 2, "bob", "device2", "addr2", "script2", "internal2", 300, nil, &second)
+	if err == nil {
+		t.Fatal("presale is bought twice")
+	}
+	var stored models.NftPresale
+	if err = db.First(&stored, launched.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.State != models.NftPresaleStateBoughtNotPay || stored.BuyerUserId != 1 || stored.BuyerUsername != "alice" ||
+		stored.ReceiveAddr != "addr1" || stored.BoughtPrice != 300 || stored.WhitelistTierId != 4 {
+		t.Fatalf("stored presale %+v, want the purchase of alice", stored)
+	}
+}
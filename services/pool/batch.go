@@ -165,7 +165,7 @@ func ProcessPoolRemoveLiquidityBatchRequest(request *PoolRemoveLiquidityRequest,
 		err = errors.New("username is empty")
 		return new(PoolRemoveLiquidityBatch), err
 	}
-	if request.FeeK != RemoveLiquidityFeeK {
+	if request.FeeK > MaxRemoveLiquidityFeeK {
 		err = errors.New("invalid fee_k(" + strconv.FormatUint(uint64(request.FeeK), 10) + ")")
 		return new(PoolRemoveLiquidityBatch), err
 	}
@@ -199,11 +199,11 @@ func ProcessPoolSwapExactTokenForTokenNoPathBatchRequest(request *PoolSwapExactT
 		err = errors.New("username is empty")
 		return new(PoolSwapExactTokenForTokenNoPathBatch), err
 	}
-	if request.ProjectPartyFeeK != ProjectPartyFeeK {
+	if request.ProjectPartyFeeK > MaxSwapFeeK {
 		err = errors.New("invalid project_party_fee_k(" + strconv.FormatUint(uint64(request.ProjectPartyFeeK), 10) + ")")
 		return new(PoolSwapExactTokenForTokenNoPathBatch), err
 	}
-	if request.LpAwardFeeK != LpAwardFeeK {
+	if request.LpAwardFeeK > MaxSwapFeeK {
 		err = errors.New("invalid lp_award_fee_k(" + strconv.FormatUint(uint64(request.LpAwardFeeK), 10) + ")")
 		return new(PoolSwapExactTokenForTokenNoPathBatch), err
 	}
@@ -237,11 +237,11 @@ func ProcessPoolSwapTokenForExactTokenNoPathBatchRequest(request *PoolSwapTokenF
 		err = errors.New("username is empty")
 		return new(PoolSwapTokenForExactTokenNoPathBatch), err
 	}
-	if request.ProjectPartyFeeK != ProjectPartyFeeK {
+	if request.ProjectPartyFeeK > MaxSwapFeeK {
 		err = errors.New("invalid project_party_fee_k(" + strconv.FormatUint(uint64(request.ProjectPartyFeeK), 10) + ")")
 		return new(PoolSwapTokenForExactTokenNoPathBatch), err
 	}
-	if request.LpAwardFeeK != LpAwardFeeK {
+	if request.LpAwardFeeK > MaxSwapFeeK {
 		err = errors.New("invalid lp_award_fee_k(" + strconv.FormatUint(uint64(request.LpAwardFeeK), 10) + ")")
 		return new(PoolSwapTokenForExactTokenNoPathBatch), err
 	}
@@ -1,15 +1,550 @@
 package pool
 
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"strconv"
+	"time"
+	"trade/middleware"
+)
+
+type CandleStickInterval string
+
+const (
+	CandleStickInterval1m  CandleStickInterval = "1m"
+	CandleStickInterval5m  CandleStickInterval = "5m"
+	CandleStickInterval15m CandleStickInterval = "15m"
+	CandleStickInterval1h  CandleStickInterval = "1h"
+	CandleStickInterval4h  CandleStickInterval = "4h"
+	CandleStickInterval1d  CandleStickInterval = "1d"
+)
+
+const (
+	candleStickSwapRecordBatchSize = 1000
+	// candleStickSettleWindow is how long swap records behind the cursor are checked again. Their ids are
+	// taken before the swap commits, so a record can show up after a higher id has been folded.
+	candleStickSettleWindow = 10 * time.Minute
+)
+
+var CandleStickIntervals = []CandleStickInterval{
+	CandleStickInterval1m,
+	CandleStickInterval5m,
+	CandleStickInterval15m,
+	CandleStickInterval1h,
+	CandleStickInterval4h,
+	CandleStickInterval1d,
+}
+
+func (i CandleStickInterval) Seconds() (int64, error) {
+	switch i {
+	case CandleStickInterval1m:
+		return 60, nil
+	case CandleStickInterval5m:
+		return 5 * 60, nil
+	case CandleStickInterval15m:
+		return 15 * 60, nil
+	case CandleStickInterval1h:
+		return 60 * 60, nil
+	case CandleStickInterval4h:
+		return 4 * 60 * 60, nil
+	case CandleStickInterval1d:
+		return 24 * 60 * 60, nil
+	default:
+		return 0, errors.New("invalid candlestick interval(" + string(i) + ")")
+	}
+}
+
+func (i CandleStickInterval) OpenTime(timestamp int64) (int64, error) {
+	seconds, err := i.Seconds()
+	if err != nil {
+		return 0, err
+	}
+	return timestamp - timestamp%seconds, nil
+}
+
 type CandleStick struct {
-	Timestamp int `json:"timestamp"`
-	Open      int `json:"open"`
-	High      int `json:"high"`
-	Low       int `json:"low"`
-	Close     int `json:"close"`
-	Volume    int `json:"volume"`
-	Turnover  int `json:"turnover"`
+	Timestamp int64  `json:"timestamp"`
+	Open      string `json:"open"`
+	High      string `json:"high"`
+	Low       string `json:"low"`
+	Close     string `json:"close"`
+	Volume    string `json:"volume"`
+	Turnover  string `json:"turnover"`
+	Count     uint64 `json:"count"`
 }
 
 type CandleStickCharts struct {
-	List []CandleStick `json:"list"`
+	Token0   string              `json:"token0"`
+	Token1   string              `json:"token1"`
+	Interval CandleStickInterval `json:"interval"`
+	List     []CandleStick       `json:"list"`
+}
+
+// PoolCandleStick is one OHLCV bar of a pair. Price is token0 per token1 (sat per asset unit for sat pairs),
+// Volume is the traded amount of token1 and Turnover the traded amount of token0.
+type PoolCandleStick struct {
+	gorm.Model
+	PairId            uint                `json:"pair_id" gorm:"uniqueIndex:idx_pair_id_interval_open_time"`
+	Interval          CandleStickInterval `json:"interval" gorm:"type:varchar(8);uniqueIndex:idx_pair_id_interval_open_time"`
+	OpenTime          int64               `json:"open_time" gorm:"uniqueIndex:idx_pair_id_interval_open_time"`
+	Open              string              `json:"open" gorm:"type:varchar(255)"`
+	High              string              `json:"high" gorm:"type:varchar(255)"`
+	Low               string              `json:"low" gorm:"type:varchar(255)"`
+	Close             string              `json:"close" gorm:"type:varchar(255)"`
+	Volume            string              `json:"volume" gorm:"type:varchar(255)"`
+	Turnover          string              `json:"turnover" gorm:"type:varchar(255)"`
+	Count             uint64              `json:"count"`
+	FirstSwapRecordId uint                `json:"first_swap_record_id"`
+	LastSwapRecordId  uint                `json:"last_swap_record_id"`
+}
+
+// PoolCandleStickCursor remembers the last swap record of a pair already folded into its bars.
+type PoolCandleStickCursor struct {
+	gorm.Model
+	PairId           uint `json:"pair_id" gorm:"uniqueIndex"`
+	LastSwapRecordId uint `json:"last_swap_record_id"`
+}
+
+func (p *PoolCandleStick) ToCandleStick() CandleStick {
+	return CandleStick{
+		Timestamp: p.OpenTime,
+		Open:      p.Open,
+		High:      p.High,
+		Low:       p.Low,
+		Close:     p.Close,
+		Volume:    p.Volume,
+		Turnover:  p.Turnover,
+		Count:     p.Count,
+	}
+}
+
+type candleStickTrade struct {
+	SwapRecordId uint
+	Timestamp    int64
+	Price        *big.Float
+	Amount0      *big.Int
+	Amount1      *big.Int
+}
+
+// swapRecordToCandleStickTrade prices a swap by the reserves after it,
+// reserveIn + calcPriceAmountIn and reserveOut - calcPriceAmountOut.
+func swapRecordToCandleStickTrade(record *PoolSwapRecord, token0 string) (trade *candleStickTrade, err error) {
+	_reserveIn, success := new(big.Int).SetString(record.ReserveIn, 10)
+	if !success {
+		return nil, errors.New("ReserveIn SetString(" + record.ReserveIn + ") " + strconv.FormatBool(success))
+	}
+	_reserveOut, success := new(big.Int).SetString(record.ReserveOut, 10)
+	if !success {
+		return nil, errors.New("ReserveOut SetString(" + record.ReserveOut + ") " + strconv.FormatBool(success))
+	}
+	_amountIn, success := new(big.Int).SetString(record.CalcPriceAmountIn, 10)
+	if !success {
+		return nil, errors.New("CalcPriceAmountIn SetString(" + record.CalcPriceAmountIn + ") " + strconv.FormatBool(success))
+	}
+	_amountOut, success := new(big.Int).SetString(record.CalcPriceAmountOut, 10)
+	if !success {
+		return nil, errors.New("CalcPriceAmountOut SetString(" + record.CalcPriceAmountOut + ") " + strconv.FormatBool(success))
+	}
+
+	_reserveInAfter := new(big.Int).Add(_reserveIn, _amountIn)
+	_reserveOutAfter := new(big.Int).Sub(_reserveOut, _amountOut)
+	if _reserveInAfter.Sign() <= 0 || _reserveOutAfter.Sign() <= 0 {
+		return nil, errors.New("invalid reserves after swap(" + _reserveInAfter.String() + "," + _reserveOutAfter.String() + ")")
+	}
+
+	var _reserve0, _reserve1, _amount0, _amount1 *big.Int
+	if record.TokenIn == token0 {
+		_reserve0, _reserve1 = _reserveInAfter, _reserveOutAfter
+		_amount0, _amount1 = _amountIn, _amountOut
+	} else {
+		_reserve0, _reserve1 = _reserveOutAfter, _reserveInAfter
+		_amount0, _amount1 = _amountOut, _amountIn
+	}
+
+	_price, err := getToken1PriceBig(_reserve0, _reserve1)
+	if err != nil {
+		return nil, errors.Wrap(err, "getToken1PriceBig")
+	}
+
+	return &candleStickTrade{
+		SwapRecordId: record.ID,
+		Timestamp:    record.CreatedAt.Unix(),
+		Price:        _price,
+		Amount0:      _amount0,
+		Amount1:      _amount1,
+	}, nil
+}
+
+func addBigIntString(a string, _b *big.Int) (string, error) {
+	if a == "" {
+		a = ZeroValue
+	}
+	_a, success := new(big.Int).SetString(a, 10)
+	if !success {
+		return ZeroValue, errors.New("SetString(" + a + ") " + strconv.FormatBool(success))
+	}
+	return new(big.Int).Add(_a, _b).String(), nil
+}
+
+func candleStickPriceString(_price *big.Float) string {
+	return _price.Text('f', -1)
+}
+
+// compareCandleStickPrice compares the stored price a with _b.
+func compareCandleStickPrice(a string, _b *big.Float) (int, error) {
+	_a, success := new(big.Float).SetString(a)
+	if !success {
+		return 0, errors.New("price SetString(" + a + ") " + strconv.FormatBool(success))
+	}
+	return _a.Cmp(_b), nil
+}
+
+func newPoolCandleStick(pairId uint, interval CandleStickInterval, openTime int64) *PoolCandleStick {
+	return &PoolCandleStick{
+		PairId:   pairId,
+		Interval: interval,
+		OpenTime: openTime,
+		Volume:   ZeroValue,
+		Turnover: ZeroValue,
+	}
+}
+
+// fold adds a trade, or a bar of a shorter interval when count is more than one, to the bar.
+func (p *PoolCandleStick) fold(open string, high *big.Float, low *big.Float, close string, amount0 *big.Int, amount1 *big.Int, count uint64, firstSwapRecordId uint, lastSwapRecordId uint) (err error) {
+	if p.Count == 0 {
+		p.Open = open
+		p.High = candleStickPriceString(high)
+		p.Low = candleStickPriceString(low)
+		p.FirstSwapRecordId = firstSwapRecordId
+	} else {
+		cmp, err := compareCandleStickPrice(p.High, high)
+		if err != nil {
+			return errors.Wrap(err, "High")
+		}
+		if cmp < 0 {
+			p.High = candleStickPriceString(high)
+		}
+		cmp, err = compareCandleStickPrice(p.Low, low)
+		if err != nil {
+			return errors.Wrap(err, "Low")
+		}
+		if cmp > 0 {
+			p.Low = candleStickPriceString(low)
+		}
+	}
+	p.Close = close
+	p.Volume, err = addBigIntString(p.Volume, amount1)
+	if err != nil {
+		return errors.Wrap(err, "Volume")
+	}
+	p.Turnover, err = addBigIntString(p.Turnover, amount0)
+	if err != nil {
+		return errors.Wrap(err, "Turnover")
+	}
+	p.Count += count
+	p.LastSwapRecordId = lastSwapRecordId
+	return nil
+}
+
+func (p *PoolCandleStick) apply(trade *candleStickTrade) (err error) {
+	price := candleStickPriceString(trade.Price)
+	return p.fold(price, trade.Price, trade.Price, price, trade.Amount0, trade.Amount1, 1, trade.SwapRecordId, trade.SwapRecordId)
+}
+
+func (p *PoolCandleStick) merge(bar *PoolCandleStick) (err error) {
+	if bar.Count == 0 {
+		return nil
+	}
+	_high, success := new(big.Float).SetString(bar.High)
+	if !success {
+		return errors.New("High SetString(" + bar.High + ") " + strconv.FormatBool(success))
+	}
+	_low, success := new(big.Float).SetString(bar.Low)
+	if !success {
+		return errors.New("Low SetString(" + bar.Low + ") " + strconv.FormatBool(success))
+	}
+	_volume, success := new(big.Int).SetString(bar.Volume, 10)
+	if !success {
+		return errors.New("Volume SetString(" + bar.Volume + ") " + strconv.FormatBool(success))
+	}
+	_turnover, success := new(big.Int).SetString(bar.Turnover, 10)
+	if !success {
+		return errors.New("Turnover SetString(" + bar.Turnover + ") " + strconv.FormatBool(success))
+	}
+	return p.fold(bar.Open, _high, _low, bar.Close, _turnover, _volume, bar.Count, bar.FirstSwapRecordId, bar.LastSwapRecordId)
+}
+
+func savePoolCandleStick(tx *gorm.DB, bar *PoolCandleStick) (err error) {
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pair_id"}, {Name: "interval"}, {Name: "open_time"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "open", "high", "low", "close", "volume", "turnover", "count", "first_swap_record_id", "last_swap_record_id"}),
+	}).Create(bar).Error
+	if err != nil {
+		return errors.Wrap(err, "create PoolCandleStick")
+	}
+	return nil
+}
+
+// rebuildPoolCandleStick1m recomputes a minute bar from all swap records of the pair in the minute.
+func rebuildPoolCandleStick1m(tx *gorm.DB, pairId uint, token0 string, openTime int64) (err error) {
+	var records []PoolSwapRecord
+	err = tx.Model(&PoolSwapRecord{}).
+		Where("pair_id = ? AND created_at >= ? AND created_at < ?", pairId, time.Unix(openTime, 0), time.Unix(openTime+60, 0)).
+		Order("id asc").
+		Find(&records).Error
+	if err != nil {
+		return errors.Wrap(err, "find PoolSwapRecord")
+	}
+	bar := newPoolCandleStick(pairId, CandleStickInterval1m, openTime)
+	for i := range records {
+		trade, err := swapRecordToCandleStickTrade(&records[i], token0)
+		if err != nil {
+			return errors.Wrap(err, "swapRecordToCandleStickTrade("+strconv.FormatUint(uint64(records[i].ID), 10)+")")
+		}
+		err = bar.apply(trade)
+		if err != nil {
+			return errors.Wrap(err, "apply")
+		}
+	}
+	return savePoolCandleStick(tx, bar)
+}
+
+// rebuildPoolCandleStick recomputes a bar longer than a minute from the minute bars it covers.
+func rebuildPoolCandleStick(tx *gorm.DB, pairId uint, interval CandleStickInterval, openTime int64) (err error) {
+	seconds, err := interval.Seconds()
+	if err != nil {
+		return err
+	}
+	var minutes []PoolCandleStick
+	err = tx.Model(&PoolCandleStick{}).
+		Where("pair_id = ? AND `interval` = ? AND open_time >= ? AND open_time < ?", pairId, CandleStickInterval1m, openTime, openTime+seconds).
+		Order("open_time asc").
+		Find(&minutes).Error
+	if err != nil {
+		return errors.Wrap(err, "find PoolCandleStick")
+	}
+	bar := newPoolCandleStick(pairId, interval, openTime)
+	for i := range minutes {
+		err = bar.merge(&minutes[i])
+		if err != nil {
+			return errors.Wrap(err, "merge("+strconv.FormatInt(minutes[i].OpenTime, 10)+")")
+		}
+	}
+	return savePoolCandleStick(tx, bar)
+}
+
+// getPoolCandleStickStaleMinutes returns the minutes of the settle window whose bar does not count every
+// swap record of the minute, because a record committed after a higher id had already been folded.
+func getPoolCandleStickStaleMinutes(tx *gorm.DB, pairId uint) (openTimes []int64, err error) {
+	since, err := CandleStickInterval1m.OpenTime(time.Now().Add(-candleStickSettleWindow).Unix())
+	if err != nil {
+		return nil, err
+	}
+	var records []PoolSwapRecord
+	err = tx.Model(&PoolSwapRecord{}).
+		Select("id", "created_at").
+		Where("pair_id = ? AND created_at >= ?", pairId, time.Unix(since, 0)).
+		Find(&records).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "find PoolSwapRecord")
+	}
+	recordCounts := make(map[int64]uint64)
+	for i := range records {
+		openTime, err := CandleStickInterval1m.OpenTime(records[i].CreatedAt.Unix())
+		if err != nil {
+			return nil, err
+		}
+		recordCounts[openTime]++
+	}
+	var bars []PoolCandleStick
+	err = tx.Model(&PoolCandleStick{}).
+		Where("pair_id = ? AND `interval` = ? AND open_time >= ?", pairId, CandleStickInterval1m, since).
+		Find(&bars).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "find PoolCandleStick")
+	}
+	barCounts := make(map[int64]uint64)
+	for i := range bars {
+		barCounts[bars[i].OpenTime] = bars[i].Count
+	}
+	for openTime, count := range recordCounts {
+		if barCounts[openTime] != count {
+			openTimes = append(openTimes, openTime)
+		}
+	}
+	return openTimes, nil
+}
+
+// updatePairCandleSticks folds at most one batch of new swap records of the pair into its bars, together with
+// the records of the settle window which committed late. The touched minute bars are rebuilt from their swap
+// records and the longer bars from the minute bars, so folding a record again does not count it twice.
+func updatePairCandleSticks(tx *gorm.DB, pairId uint, token0 string) (processed int, err error) {
+	var cursor PoolCandleStickCursor
+	err = tx.Model(&PoolCandleStickCursor{}).Where("pair_id = ?", pairId).First(&cursor).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errors.Wrap(err, "first PoolCandleStickCursor")
+		}
+		cursor = PoolCandleStickCursor{PairId: pairId}
+	}
+
+	var records []PoolSwapRecord
+	err = tx.Model(&PoolSwapRecord{}).
+		Select("id", "created_at").
+		Where("pair_id = ? AND id > ?", pairId, cursor.LastSwapRecordId).
+		Order("id asc").
+		Limit(candleStickSwapRecordBatchSize).
+		Find(&records).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "find PoolSwapRecord")
+	}
+
+	minutes := make(map[int64]bool)
+	for i := range records {
+		openTime, err := CandleStickInterval1m.OpenTime(records[i].CreatedAt.Unix())
+		if err != nil {
+			return 0, errors.Wrap(err, "OpenTime")
+		}
+		minutes[openTime] = true
+	}
+	staleMinutes, err := getPoolCandleStickStaleMinutes(tx, pairId)
+	if err != nil {
+		return 0, errors.Wrap(err, "getPoolCandleStickStaleMinutes")
+	}
+	for _, openTime := range staleMinutes {
+		minutes[openTime] = true
+	}
+	if len(minutes) == 0 {
+		return 0, nil
+	}
+
+	bars := make(map[candleStickKey]bool)
+	for openTime := range minutes {
+		err = rebuildPoolCandleStick1m(tx, pairId, token0, openTime)
+		if err != nil {
+			return 0, errors.Wrap(err, "rebuildPoolCandleStick1m("+strconv.FormatInt(openTime, 10)+")")
+		}
+		for _, interval := range CandleStickIntervals {
+			if interval == CandleStickInterval1m {
+				continue
+			}
+			barOpenTime, err := interval.OpenTime(openTime)
+			if err != nil {
+				return 0, errors.Wrap(err, "OpenTime")
+			}
+			bars[candleStickKey{Interval: interval, OpenTime: barOpenTime}] = true
+		}
+	}
+	for key := range bars {
+		err = rebuildPoolCandleStick(tx, pairId, key.Interval, key.OpenTime)
+		if err != nil {
+			return 0, errors.Wrap(err, "rebuildPoolCandleStick("+string(key.Interval)+","+strconv.FormatInt(key.OpenTime, 10)+")")
+		}
+	}
+
+	if len(records) == 0 {
+		return 0, nil
+	}
+	cursor.LastSwapRecordId = records[len(records)-1].ID
+	err = tx.Save(&cursor).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "save PoolCandleStickCursor")
+	}
+	return len(records), nil
+}
+
+type candleStickKey struct {
+	Interval CandleStickInterval
+	OpenTime int64
+}
+
+// UpdateAllPoolCandleSticks aggregates new swap records of every pair into stored bars.
+// Each batch commits on its own so a large backlog is caught up incrementally.
+func UpdateAllPoolCandleSticks() error {
+	poolPairScan, err := getAllPoolPairScan()
+	if err != nil {
+		return errors.Wrap(err, "getAllPoolPairScan")
+	}
+	for _, pair := range poolPairScan {
+		for {
+			tx := middleware.DB.Begin()
+			processed, err := updatePairCandleSticks(tx, pair.ID, pair.Token0)
+			if err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "updatePairCandleSticks("+strconv.FormatUint(uint64(pair.ID), 10)+")")
+			}
+			err = tx.Commit().Error
+			if err != nil {
+				return errors.Wrap(err, "commit")
+			}
+			if processed < candleStickSwapRecordBatchSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func candleStickQuery(tokenA string, tokenB string, interval CandleStickInterval, start int64, end int64) (query *gorm.DB, token0 string, token1 string, err error) {
+	_, err = interval.Seconds()
+	if err != nil {
+		return nil, "", "", err
+	}
+	token0, token1, err = sortTokens(tokenA, tokenB)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "sortTokens")
+	}
+	pairId, err := QueryPairId(middleware.DB, token0, token1)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "QueryPairId")
+	}
+	if end <= 0 {
+		end = time.Now().Unix()
+	}
+	if start > end {
+		return nil, "", "", errors.New("invalid time range(" + strconv.FormatInt(start, 10) + "," + strconv.FormatInt(end, 10) + ")")
+	}
+	query = middleware.DB.Model(&PoolCandleStick{}).
+		Where("pair_id = ? AND `interval` = ? AND open_time >= ? AND open_time <= ?", pairId, interval, start, end)
+	return query, token0, token1, nil
+}
+
+func QueryCandleSticksCount(tokenA string, tokenB string, interval CandleStickInterval, start int64, end int64) (count int64, err error) {
+	query, _, _, err := candleStickQuery(tokenA, tokenB, interval, start, end)
+	if err != nil {
+		return 0, errors.Wrap(err, "candleStickQuery")
+	}
+	err = query.Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "count PoolCandleStick")
+	}
+	return count, nil
+}
+
+func QueryCandleSticks(tokenA string, tokenB string, interval CandleStickInterval, start int64, end int64, limit int, offset int) (charts *CandleStickCharts, err error) {
+	query, token0, token1, err := candleStickQuery(tokenA, tokenB, interval, start, end)
+	if err != nil {
+		return new(CandleStickCharts), errors.Wrap(err, "candleStickQuery")
+	}
+	var bars []PoolCandleStick
+	err = query.
+		Order("open_time asc").
+		Limit(limit).
+		Offset(offset).
+		Find(&bars).Error
+	if err != nil {
+		return new(CandleStickCharts), errors.Wrap(err, "find PoolCandleStick")
+	}
+	list := make([]CandleStick, 0, len(bars))
+	for i := range bars {
+		list = append(list, bars[i].ToCandleStick())
+	}
+	return &CandleStickCharts{
+		Token0:   token0,
+		Token1:   token1,
+		Interval: interval,
+		List:     list,
+	}, nil
 }
@@ -17,6 +17,7 @@ const (
 	AssetIdLength = 64
 )
 
+// Default fees of a pair without an effective PoolPairFeeTier.
 const (
 	AddLiquidityFeeK    uint16 = 0
 	RemoveLiquidityFeeK uint16 = 3
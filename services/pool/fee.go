@@ -0,0 +1,213 @@
+package pool
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+	"trade/middleware"
+)
+
+const (
+	MaxSwapFeeK            uint16 = 100
+	MaxRemoveLiquidityFeeK uint16 = 100
+	MaxMinSwapSatFee       uint   = 1e4
+)
+
+// PoolPairFeeTier is one row of a pair's fee history. Rows are never updated, a change is a new row.
+// The tier with the latest EffectiveFrom covering a timestamp wins, so a bounded promotional tier overrides
+// the open ended tier below it and the pair falls back to that tier once the promotion ends.
+type PoolPairFeeTier struct {
+	gorm.Model
+	PairId              uint   `json:"pair_id" gorm:"index"`
+	ProjectPartyFeeK    uint16 `json:"project_party_fee_k"`
+	LpAwardFeeK         uint16 `json:"lp_award_fee_k"`
+	RemoveLiquidityFeeK uint16 `json:"remove_liquidity_fee_k"`
+	MinSwapSatFee       uint   `json:"min_swap_sat_fee"`
+	EffectiveFrom       int64  `json:"effective_from" gorm:"index"`
+	EffectiveTo         int64  `json:"effective_to" gorm:"index"`
+	Operator            string `json:"operator" gorm:"type:varchar(255)"`
+	Remark              string `json:"remark" gorm:"type:varchar(255)"`
+}
+
+// PoolPairFee is the fee in effect for a pair at some timestamp. TierId is 0 for the default fee.
+type PoolPairFee struct {
+	PairId              uint   `json:"pair_id"`
+	TierId              uint   `json:"tier_id"`
+	ProjectPartyFeeK    uint16 `json:"project_party_fee_k"`
+	LpAwardFeeK         uint16 `json:"lp_award_fee_k"`
+	RemoveLiquidityFeeK uint16 `json:"remove_liquidity_fee_k"`
+	MinSwapSatFee       uint   `json:"min_swap_sat_fee"`
+	EffectiveTo         int64  `json:"effective_to"`
+}
+
+type PoolSetPairFeeTierRequest struct {
+	TokenA              string `json:"token_a"`
+	TokenB              string `json:"token_b"`
+	ProjectPartyFeeK    uint16 `json:"project_party_fee_k"`
+	LpAwardFeeK         uint16 `json:"lp_award_fee_k"`
+	RemoveLiquidityFeeK uint16 `json:"remove_liquidity_fee_k"`
+	MinSwapSatFee       uint   `json:"min_swap_sat_fee"`
+	EffectiveFrom       int64  `json:"effective_from"`
+	EffectiveTo         int64  `json:"effective_to"`
+	Operator            string `json:"operator"`
+	Remark              string `json:"remark"`
+}
+
+func defaultPairFee(pairId uint) *PoolPairFee {
+	return &PoolPairFee{
+		PairId:              pairId,
+		ProjectPartyFeeK:    ProjectPartyFeeK,
+		LpAwardFeeK:         LpAwardFeeK,
+		RemoveLiquidityFeeK: RemoveLiquidityFeeK,
+		MinSwapSatFee:       MinSwapSatFee,
+	}
+}
+
+func (f *PoolPairFee) SwapFeeK() uint16 {
+	return f.ProjectPartyFeeK + f.LpAwardFeeK
+}
+
+func (t *PoolPairFeeTier) toPairFee() *PoolPairFee {
+	return &PoolPairFee{
+		PairId:              t.PairId,
+		TierId:              t.ID,
+		ProjectPartyFeeK:    t.ProjectPartyFeeK,
+		LpAwardFeeK:         t.LpAwardFeeK,
+		RemoveLiquidityFeeK: t.RemoveLiquidityFeeK,
+		MinSwapSatFee:       t.MinSwapSatFee,
+		EffectiveTo:         t.EffectiveTo,
+	}
+}
+
+func getEffectivePairFee(tx *gorm.DB, pairId uint, timestamp int64) (fee *PoolPairFee, err error) {
+	var tier PoolPairFeeTier
+	err = tx.Model(&PoolPairFeeTier{}).
+		Where("pair_id = ? AND effective_from <= ? AND (effective_to = 0 OR effective_to > ?)", pairId, timestamp, timestamp).
+		Order("effective_from desc, id desc").
+		First(&tier).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return defaultPairFee(pairId), nil
+		}
+		return nil, errors.Wrap(err, "first PoolPairFeeTier")
+	}
+	return tier.toPairFee(), nil
+}
+
+func getEffectivePairFeeByTokens(tx *gorm.DB, tokenA string, tokenB string) (fee *PoolPairFee, err error) {
+	pairId, err := QueryPairId(tx, tokenA, tokenB)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryPairId")
+	}
+	return getEffectivePairFee(tx, pairId, time.Now().Unix())
+}
+
+// effectiveSwapFee resolves the pair's current swap fee and rejects it when it is above what the request accepts.
+func effectiveSwapFee(tx *gorm.DB, tokenIn string, tokenOut string, projectPartyFeeK uint16, lpAwardFeeK uint16) (fee *PoolPairFee, err error) {
+	fee, err = getEffectivePairFeeByTokens(tx, tokenIn, tokenOut)
+	if err != nil {
+		return nil, errors.Wrap(err, "getEffectivePairFeeByTokens")
+	}
+	if fee.SwapFeeK() > projectPartyFeeK+lpAwardFeeK {
+		return nil, errors.New("swap fee k(" + strconv.FormatUint(uint64(fee.SwapFeeK()), 10) + ") exceeds accepted fee k(" + strconv.FormatUint(uint64(projectPartyFeeK+lpAwardFeeK), 10) + ")")
+	}
+	return fee, nil
+}
+
+// effectiveRemoveLiquidityFee resolves the pair's current remove liquidity fee and rejects it when it is above feeK.
+func effectiveRemoveLiquidityFee(tx *gorm.DB, tokenA string, tokenB string, feeK uint16) (fee *PoolPairFee, err error) {
+	fee, err = getEffectivePairFeeByTokens(tx, tokenA, tokenB)
+	if err != nil {
+		return nil, errors.Wrap(err, "getEffectivePairFeeByTokens")
+	}
+	if fee.RemoveLiquidityFeeK > feeK {
+		return nil, errors.New("remove liquidity fee k(" + strconv.FormatUint(uint64(fee.RemoveLiquidityFeeK), 10) + ") exceeds accepted fee k(" + strconv.FormatUint(uint64(feeK), 10) + ")")
+	}
+	return fee, nil
+}
+
+func SetPoolPairFeeTier(request *PoolSetPairFeeTierRequest) (tier *PoolPairFeeTier, err error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if request.ProjectPartyFeeK+request.LpAwardFeeK > MaxSwapFeeK {
+		return nil, errors.New("invalid swap fee k(" + strconv.FormatUint(uint64(request.ProjectPartyFeeK+request.LpAwardFeeK), 10) + "), need le " + strconv.FormatUint(uint64(MaxSwapFeeK), 10))
+	}
+	if request.RemoveLiquidityFeeK > MaxRemoveLiquidityFeeK {
+		return nil, errors.New("invalid remove_liquidity_fee_k(" + strconv.FormatUint(uint64(request.RemoveLiquidityFeeK), 10) + "), need le " + strconv.FormatUint(uint64(MaxRemoveLiquidityFeeK), 10))
+	}
+	if request.MinSwapSatFee > MaxMinSwapSatFee {
+		return nil, errors.New("invalid min_swap_sat_fee(" + strconv.FormatUint(uint64(request.MinSwapSatFee), 10) + "), need le " + strconv.FormatUint(uint64(MaxMinSwapSatFee), 10))
+	}
+	if request.Operator == "" {
+		return nil, errors.New("operator is empty")
+	}
+	effectiveFrom := request.EffectiveFrom
+	if effectiveFrom == 0 {
+		effectiveFrom = time.Now().Unix()
+	}
+	if request.EffectiveTo != 0 && request.EffectiveTo <= effectiveFrom {
+		return nil, errors.New("invalid effective_to(" + strconv.FormatInt(request.EffectiveTo, 10) + "), need gt effective_from(" + strconv.FormatInt(effectiveFrom, 10) + ")")
+	}
+
+	pairId, err := QueryPairId(middleware.DB, request.TokenA, request.TokenB)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryPairId")
+	}
+
+	tier = &PoolPairFeeTier{
+		PairId:              pairId,
+		ProjectPartyFeeK:    request.ProjectPartyFeeK,
+		LpAwardFeeK:         request.LpAwardFeeK,
+		RemoveLiquidityFeeK: request.RemoveLiquidityFeeK,
+		MinSwapSatFee:       request.MinSwapSatFee,
+		EffectiveFrom:       effectiveFrom,
+		EffectiveTo:         request.EffectiveTo,
+		Operator:            request.Operator,
+		Remark:              request.Remark,
+	}
+	err = middleware.DB.Create(tier).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "create PoolPairFeeTier")
+	}
+	return tier, nil
+}
+
+// QueryEffectivePoolPairFee returns the fee in effect for the pair at timestamp, or now when timestamp is 0.
+func QueryEffectivePoolPairFee(tokenA string, tokenB string, timestamp int64) (fee *PoolPairFee, err error) {
+	pairId, err := QueryPairId(middleware.DB, tokenA, tokenB)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryPairId")
+	}
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
+	return getEffectivePairFee(middleware.DB, pairId, timestamp)
+}
+
+func QueryPoolPairFeeTiersCount(tokenA string, tokenB string) (count int64, err error) {
+	pairId, err := QueryPairId(middleware.DB, tokenA, tokenB)
+	if err != nil {
+		return 0, errors.Wrap(err, "QueryPairId")
+	}
+	err = middleware.DB.Model(&PoolPairFeeTier{}).Where("pair_id = ?", pairId).Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "count PoolPairFeeTier")
+	}
+	return count, nil
+}
+
+func QueryPoolPairFeeTiers(tokenA string, tokenB string, limit int, offset int) (tiers *[]PoolPairFeeTier, err error) {
+	pairId, err := QueryPairId(middleware.DB, tokenA, tokenB)
+	if err != nil {
+		return new([]PoolPairFeeTier), errors.Wrap(err, "QueryPairId")
+	}
+	tiers = new([]PoolPairFeeTier)
+	err = middleware.DB.Where("pair_id = ?", pairId).
+		Order("id desc").Limit(limit).Offset(offset).Find(tiers).Error
+	if err != nil {
+		return new([]PoolPairFeeTier), errors.Wrap(err, "find PoolPairFeeTier")
+	}
+	return tiers, nil
+}
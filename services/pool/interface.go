@@ -13,6 +13,15 @@ const (
 	PoolTypeFee uint = 1
 )
 
+// Custody calls behind the pool accounts. Tests point them at a ledger in the test database.
+var (
+	custodyCreatePoolAccount     = poolAccount.CreatePoolAccount
+	custodyPAccountToUserPay     = poolAccount.PAccountToUserPay
+	custodyUserPayToPAccount     = poolAccount.UserPayToPAccount
+	custodyPAccountToPAccountPay = poolAccount.PAccountToPAccountPay
+	custodyGetPoolAccountInfo    = poolAccount.GetPoolAccountInfo
+)
+
 func CreatePoolAccount(tx *gorm.DB, pairId uint, poolType uint, allowTokens []string) (err error) {
 	transTokens := make([]string, 0)
 	for _, token := range allowTokens {
@@ -23,28 +32,28 @@ func CreatePoolAccount(tx *gorm.DB, pairId uint, poolType uint, allowTokens []st
 		}
 	}
 
-	return poolAccount.CreatePoolAccount(tx, pairId, poolType, transTokens)
+	return custodyCreatePoolAccount(tx, pairId, poolType, transTokens)
 }
 
 func PoolAccountTransfer(tx *gorm.DB, pairId uint, poolType uint, username string, token string, _amount *big.Int, transferDescription string) (recordId uint, err error) {
 	if token == TokenSatTag {
 		token = "00"
 	}
-	return poolAccount.PAccountToUserPay(tx, username, pairId, poolType, token, _amount, transferDescription)
+	return custodyPAccountToUserPay(tx, username, pairId, poolType, token, _amount, transferDescription)
 }
 
 func TransferToPoolAccount(tx *gorm.DB, username string, pairId uint, poolType uint, token string, _amount *big.Int, transferDescription string) (recordId uint, err error) {
 	if token == TokenSatTag {
 		token = "00"
 	}
-	return poolAccount.UserPayToPAccount(tx, pairId, poolType, username, token, _amount, transferDescription)
+	return custodyUserPayToPAccount(tx, pairId, poolType, username, token, _amount, transferDescription)
 }
 
 func PoolToPoolPTransfer(tx *gorm.DB, fromPairId uint, fromType uint, toPairId uint, toType uint, token string, _amount *big.Int, transferDescription string) (recordId uint, err error) {
 	if token == TokenSatTag {
 		token = "00"
 	}
-	return poolAccount.PAccountToPAccountPay(tx, fromPairId, fromType, toPairId, toType, token, _amount, transferDescription)
+	return custodyPAccountToPAccountPay(tx, fromPairId, fromType, toPairId, toType, token, _amount, transferDescription)
 }
 
 func GetPoolAccountRecords(pairId uint, poolType uint, limit int, offset int) (records *[]pAccount.PAccountBill, err error) {
@@ -56,7 +65,7 @@ func GetPoolAccountRecordsCount(pairId uint, poolType uint) (count int64, err er
 }
 
 func GetPoolAccountInfo(pairId uint, poolType uint) (info *poolAccount.PAccountInfo, err error) {
-	return poolAccount.GetPoolAccountInfo(pairId, poolType)
+	return custodyGetPoolAccountInfo(pairId, poolType)
 }
 
 func CleanPoolAccount(pairId uint, poolType uint) {
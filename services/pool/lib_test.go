@@ -0,0 +1,335 @@
+package pool
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func bigInt(t testing.TB, s string) *big.Int {
+	t.Helper()
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("bad big int %q", s)
+	}
+	return i
+}
+
+func TestGetAmountOutBig(t *testing.T) {
+	tests := []struct {
+		name       string
+		amountIn   string
+		reserveIn  string
+		reserveOut string
+		feeK       uint16
+		want       string
+		wantErr    bool
+	}{
+		{"fee", "1000", "100000", "100000", 3, "987", false},
+		{"no fee", "1000", "100000", "100000", 0, "990", false},
+		{"rounds down", "1", "3", "10", 0, "2", false},
+		{"full fee", "1000", "100000", "100000", 1000, "0", false},
+		{"fee above 1000", "1000", "100000", "100000", 1001, "", true},
+		{"zero amount", "0", "100000", "100000", 3, "", true},
+		{"negative amount", "-1", "100000", "100000", 3, "", true},
+		{"empty reserve in", "1000", "0", "100000", 3, "", true},
+		{"empty reserve out", "1000", "100000", "0", 3, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getAmountOutBig(bigInt(t, tt.amountIn), bigInt(t, tt.reserveIn), bigInt(t, tt.reserveOut), tt.feeK)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAmountInBig(t *testing.T) {
+	tests := []struct {
+		name       string
+		amountOut  string
+		reserveIn  string
+		reserveOut string
+		feeK       uint16
+		want       string
+		wantErr    bool
+	}{
+		{"fee", "987", "100000", "100000", 3, "1000", false},
+		{"no fee", "990", "100000", "100000", 0, "1000", false},
+		{"rounds up", "1", "10", "3", 0, "5", false},
+		{"fee above 1000", "987", "100000", "100000", 1001, "", true},
+		{"zero amount", "0", "100000", "100000", 3, "", true},
+		{"empty reserve", "987", "0", "100000", 3, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getAmountInBig(bigInt(t, tt.amountOut), bigInt(t, tt.reserveIn), bigInt(t, tt.reserveOut), tt.feeK)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAmountBigWithoutFee(t *testing.T) {
+	out, err := getAmountOutBigWithoutFee(big.NewInt(1000), big.NewInt(100000), big.NewInt(100000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Int64() != 990 {
+		t.Fatalf("amount out %s, want 990", out)
+	}
+	in, err := getAmountInBigWithoutFee(big.NewInt(990), big.NewInt(100000), big.NewInt(100000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Int64() != 1000 {
+		t.Fatalf("amount in %s, want 1000", in)
+	}
+	if _, err = getAmountOutBigWithoutFee(big.NewInt(0), big.NewInt(1), big.NewInt(1)); err == nil {
+		t.Fatal("zero amount in, want error")
+	}
+	if _, err = getAmountInBigWithoutFee(big.NewInt(1), big.NewInt(0), big.NewInt(1)); err == nil {
+		t.Fatal("empty reserve, want error")
+	}
+}
+
+func TestQuoteBig(t *testing.T) {
+	got, err := quoteBig(big.NewInt(1000), big.NewInt(4000), big.NewInt(9000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Int64() != 2250 {
+		t.Fatalf("quote %s, want 2250", got)
+	}
+	if _, err = quoteBig(big.NewInt(-1), big.NewInt(4000), big.NewInt(9000)); err == nil {
+		t.Fatal("negative amount, want error")
+	}
+	if _, err = quoteBig(big.NewInt(1000), big.NewInt(0), big.NewInt(9000)); err == nil {
+		t.Fatal("empty reserve, want error")
+	}
+}
+
+func TestAddLiquidityOptimalAmounts(t *testing.T) {
+	tests := []struct {
+		name                                   string
+		desired0, desired1, min0, min1, r0, r1 int64
+		want0, want1                           int64
+		wantErr                                bool
+	}{
+		{"token1 optimal", 1000, 5000, 0, 0, 4000, 9000, 1000, 2250, false},
+		{"token0 optimal", 1000, 1800, 0, 0, 4000, 9000, 800, 1800, false},
+		{"token1 below min", 1000, 5000, 0, 2300, 4000, 9000, 0, 0, true},
+		{"token0 below min", 1000, 1800, 900, 0, 4000, 9000, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got0, got1, err := _addLiquidity(big.NewInt(tt.desired0), big.NewInt(tt.desired1), big.NewInt(tt.min0), big.NewInt(tt.min1), big.NewInt(tt.r0), big.NewInt(tt.r1))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s %s, want error", got0, got1)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got0.Int64() != tt.want0 || got1.Int64() != tt.want1 {
+				t.Fatalf("got %s %s, want %d %d", got0, got1, tt.want0, tt.want1)
+			}
+		})
+	}
+}
+
+func TestCeil(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"0", 0},
+		{"1", 1},
+		{"1.0001", 2},
+		{"41.5", 42},
+		{"-1.5", -1},
+	}
+	for _, tt := range tests {
+		value, _ := new(big.Float).SetString(tt.value)
+		if got := ceil(value); got.Int64() != tt.want {
+			t.Errorf("ceil(%s) = %s, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCeilDiv(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{0, 3, 0},
+		{9, 3, 3},
+		{10, 3, 4},
+		{1, 1000, 1},
+	}
+	for _, tt := range tests {
+		if got := CeilDiv(big.NewInt(tt.a), big.NewInt(tt.b)); got.Int64() != tt.want {
+			t.Errorf("CeilDiv(%d, %d) = %s, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAmountFee(t *testing.T) {
+	tests := []struct {
+		amount            int64
+		feeK              uint16
+		wantExcl, wantFee int64
+	}{
+		{1000, 3, 997, 3},
+		{100, 3, 99, 1},
+		{1, 3, 0, 1},
+		{1000, 0, 1000, 0},
+	}
+	for _, tt := range tests {
+		excl, fee := amountFee(big.NewInt(tt.amount), tt.feeK)
+		if excl.Int64() != tt.wantExcl || fee.Int64() != tt.wantFee {
+			t.Errorf("amountFee(%d, %d) = %s %s, want %d %d", tt.amount, tt.feeK, excl, fee, tt.wantExcl, tt.wantFee)
+		}
+	}
+}
+
+// checkSwapKeepsK fails when a swap of amountIn for the quoted amount out would shrink the pool's k.
+func checkSwapKeepsK(t testing.TB, amountIn, reserveIn, reserveOut *big.Int, feeK uint16) {
+	t.Helper()
+	amountOut, err := getAmountOutBig(amountIn, reserveIn, reserveOut, feeK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amountOut.Cmp(reserveOut) >= 0 {
+		t.Fatalf("amount out %s drains reserve out %s", amountOut, reserveOut)
+	}
+	k := new(big.Int).Mul(reserveIn, reserveOut)
+	newK := new(big.Int).Mul(new(big.Int).Add(reserveIn, amountIn), new(big.Int).Sub(reserveOut, amountOut))
+	if newK.Cmp(k) < 0 {
+		t.Fatalf("k decreased from %s to %s swapping %s into %s/%s", k, newK, amountIn, reserveIn, reserveOut)
+	}
+}
+
+// checkExactOutRoundTrip fails when the quoted amount in does not buy amountOut or is not the smallest one that does.
+func checkExactOutRoundTrip(t testing.TB, amountOut, reserveIn, reserveOut *big.Int, feeK uint16) {
+	t.Helper()
+	amountIn, err := getAmountInBig(amountOut, reserveIn, reserveOut, feeK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := getAmountOutBig(amountIn, reserveIn, reserveOut, feeK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(amountOut) < 0 {
+		t.Fatalf("amount in %s buys %s, want at least %s", amountIn, got, amountOut)
+	}
+	if amountIn.Cmp(big.NewInt(1)) > 0 {
+		less, err := getAmountOutBig(new(big.Int).Sub(amountIn, big.NewInt(1)), reserveIn, reserveOut, feeK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if less.Cmp(amountOut) >= 0 {
+			t.Fatalf("amount in %s is not minimal for %s", amountIn, amountOut)
+		}
+	}
+}
+
+// checkMintBurn fails when burning freshly minted liquidity returns more than was deposited.
+func checkMintBurn(t testing.TB, amount0, amount1, reserve0, reserve1, totalSupply *big.Int, feeK uint16) {
+	t.Helper()
+	liquidity, err := _mintBig(amount0, amount1, reserve0, reserve1, totalSupply, false)
+	if err != nil {
+		return
+	}
+	newReserve0 := new(big.Int).Add(reserve0, amount0)
+	newReserve1 := new(big.Int).Add(reserve1, amount1)
+	newTotalSupply := new(big.Int).Add(totalSupply, liquidity)
+	out0, out1, err := _burnBig(newReserve0, newReserve1, newTotalSupply, liquidity, feeK)
+	if err != nil {
+		return
+	}
+	if out0.Cmp(amount0) > 0 || out1.Cmp(amount1) > 0 {
+		t.Fatalf("burning %s returned %s %s for a deposit of %s %s", liquidity, out0, out1, amount0, amount1)
+	}
+}
+
+func TestSwapInvariants(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		reserveIn := big.NewInt(r.Int63n(1e12) + 1)
+		reserveOut := big.NewInt(r.Int63n(1e12) + 2)
+		feeK := uint16(r.Intn(31))
+		checkSwapKeepsK(t, big.NewInt(r.Int63n(1e12)+1), reserveIn, reserveOut, feeK)
+		amountOut := new(big.Int).Rand(r, new(big.Int).Sub(reserveOut, big.NewInt(1)))
+		checkExactOutRoundTrip(t, amountOut.Add(amountOut, big.NewInt(1)), reserveIn, reserveOut, feeK)
+	}
+}
+
+func TestMintBurnInvariant(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		reserve0 := big.NewInt(r.Int63n(1e12) + 1)
+		reserve1 := big.NewInt(r.Int63n(1e12) + 1)
+		totalSupply := new(big.Int).Sqrt(new(big.Int).Mul(reserve0, reserve1))
+		feeK := uint16(r.Intn(31))
+		checkMintBurn(t, big.NewInt(r.Int63n(1e10)+1), big.NewInt(r.Int63n(1e10)+1), reserve0, reserve1, totalSupply, feeK)
+		checkMintBurn(t, big.NewInt(r.Int63n(1e10)+1), big.NewInt(r.Int63n(1e10)+1), big.NewInt(0), big.NewInt(0), big.NewInt(0), feeK)
+	}
+}
+
+func FuzzGetAmountOutBig(f *testing.F) {
+	f.Add(uint64(1000), uint64(100000), uint64(100000), uint16(3))
+	f.Add(uint64(1), uint64(1), uint64(1), uint16(0))
+	f.Add(uint64(1<<62), uint64(3), uint64(1<<40), uint16(30))
+	f.Fuzz(func(t *testing.T, amountIn, reserveIn, reserveOut uint64, feeK uint16) {
+		if amountIn == 0 || reserveIn == 0 || reserveOut == 0 || feeK > 1000 {
+			t.Skip()
+		}
+		checkSwapKeepsK(t, new(big.Int).SetUint64(amountIn), new(big.Int).SetUint64(reserveIn), new(big.Int).SetUint64(reserveOut), feeK)
+	})
+}
+
+func FuzzGetAmountInBig(f *testing.F) {
+	f.Add(uint64(987), uint64(100000), uint64(100000), uint16(3))
+	f.Add(uint64(1), uint64(1), uint64(2), uint16(0))
+	f.Fuzz(func(t *testing.T, amountOut, reserveIn, reserveOut uint64, feeK uint16) {
+		if amountOut == 0 || reserveIn == 0 || amountOut >= reserveOut || feeK >= 1000 {
+			t.Skip()
+		}
+		checkExactOutRoundTrip(t, new(big.Int).SetUint64(amountOut), new(big.Int).SetUint64(reserveIn), new(big.Int).SetUint64(reserveOut), feeK)
+	})
+}
+
+func FuzzMintBurn(f *testing.F) {
+	f.Add(uint64(1000), uint64(2500), uint64(4000), uint64(9000), uint64(5990), uint16(3))
+	f.Add(uint64(4000), uint64(9000), uint64(0), uint64(0), uint64(0), uint16(0))
+	f.Fuzz(func(t *testing.T, amount0, amount1, reserve0, reserve1, totalSupply uint64, feeK uint16) {
+		// An empty pool has neither reserves nor supply, a live one has all three.
+		if feeK > 1000 || (totalSupply == 0) != (reserve0 == 0) || (totalSupply == 0) != (reserve1 == 0) {
+			t.Skip()
+		}
+		checkMintBurn(t, new(big.Int).SetUint64(amount0), new(big.Int).SetUint64(amount1), new(big.Int).SetUint64(reserve0), new(big.Int).SetUint64(reserve1), new(big.Int).SetUint64(totalSupply), feeK)
+	})
+}
@@ -0,0 +1,617 @@
+package pool
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"trade/btlLog"
+	"trade/middleware"
+	"trade/models/custodyModels"
+	"trade/services/custodyAccount/custodyBase/custodyMutex"
+	"trade/services/custodyAccount/lockPayment"
+)
+
+const (
+	LimitOrderMaxLifetime int64 = 30 * 24 * 60 * 60
+
+	limitOrderMaxMatchRounds   = 8
+	limitOrderMaxFillAttempts  = 8
+	limitOrderPendingRecoverIn = 5 * 60
+	limitOrderLockIdPrefix     = "poolLimitOrder"
+)
+
+type PoolLimitOrderStatus int64
+
+const (
+	LimitOrderStatusPending PoolLimitOrderStatus = iota
+	LimitOrderStatusOpen
+	LimitOrderStatusPartiallyFilled
+	LimitOrderStatusFilled
+	LimitOrderStatusCancelled
+	LimitOrderStatusExpired
+	LimitOrderStatusLockFailed
+)
+
+// PoolLimitOrder sells AmountIn of TokenIn for at least AmountOutMin of TokenOut, filled in parts against the pool
+// whenever the pool price crosses the order's limit. Unfilled funds stay in the user's lock account.
+type PoolLimitOrder struct {
+	gorm.Model
+	PairId          uint                 `json:"pair_id" gorm:"index"`
+	Username        string               `json:"username" gorm:"type:varchar(255);index"`
+	TokenIn         string               `json:"token_in" gorm:"type:varchar(255);index"`
+	TokenOut        string               `json:"token_out" gorm:"type:varchar(255);index"`
+	AmountIn        string               `json:"amount_in" gorm:"type:varchar(255)"`
+	AmountOutMin    string               `json:"amount_out_min" gorm:"type:varchar(255)"`
+	AmountInFilled  string               `json:"amount_in_filled" gorm:"type:varchar(255)"`
+	AmountOutFilled string               `json:"amount_out_filled" gorm:"type:varchar(255)"`
+	FillCount       uint                 `json:"fill_count"`
+	ExpireAt        int64                `json:"expire_at" gorm:"index"`
+	Status          PoolLimitOrderStatus `json:"status" gorm:"index"`
+}
+
+type PoolLimitOrderFill struct {
+	gorm.Model
+	OrderId      uint   `json:"order_id" gorm:"index"`
+	PairId       uint   `json:"pair_id" gorm:"index"`
+	SwapRecordId uint   `json:"swap_record_id" gorm:"index"`
+	AmountIn     string `json:"amount_in" gorm:"type:varchar(255)"`
+	AmountOut    string `json:"amount_out" gorm:"type:varchar(255)"`
+}
+
+type PoolCreateLimitOrderRequest struct {
+	TokenIn      string `json:"token_in"`
+	TokenOut     string `json:"token_out"`
+	AmountIn     string `json:"amount_in"`
+	AmountOutMin string `json:"amount_out_min"`
+	ExpireAt     int64  `json:"expire_at"`
+	Username     string `json:"username"`
+}
+
+type PoolCancelLimitOrderRequest struct {
+	OrderId  uint   `json:"order_id"`
+	Username string `json:"username"`
+}
+
+// limitOrderMutex keeps matching, cancellation and expiry of one process from queueing on the same order rows. The
+// row lock each fill and release takes is what keeps an order from being unlocked twice across instances.
+var limitOrderMutex sync.Mutex
+
+var (
+	limitOrderMatchSignal = make(chan struct{}, 1)
+	limitOrderMatcherOnce sync.Once
+)
+
+func limitOrderLockId(orderId uint, action string) string {
+	return limitOrderLockIdPrefix + "/" + strconv.FormatUint(uint64(orderId), 10) + "/" + action
+}
+
+func limitOrderAssetId(token string) string {
+	if token == TokenSatTag {
+		return "00"
+	}
+	return token
+}
+
+func (o *PoolLimitOrder) isActive() bool {
+	return o.Status == LimitOrderStatusOpen || o.Status == LimitOrderStatusPartiallyFilled
+}
+
+func (o *PoolLimitOrder) bigAmounts() (_amountIn *big.Int, _amountOutMin *big.Int, _amountInFilled *big.Int, _amountOutFilled *big.Int, err error) {
+	var success bool
+	_amountIn, success = new(big.Int).SetString(o.AmountIn, 10)
+	if !success {
+		return nil, nil, nil, nil, errors.New("AmountIn SetString(" + o.AmountIn + ") " + strconv.FormatBool(success))
+	}
+	_amountOutMin, success = new(big.Int).SetString(o.AmountOutMin, 10)
+	if !success {
+		return nil, nil, nil, nil, errors.New("AmountOutMin SetString(" + o.AmountOutMin + ") " + strconv.FormatBool(success))
+	}
+	_amountInFilled, success = new(big.Int).SetString(o.AmountInFilled, 10)
+	if !success {
+		return nil, nil, nil, nil, errors.New("AmountInFilled SetString(" + o.AmountInFilled + ") " + strconv.FormatBool(success))
+	}
+	_amountOutFilled, success = new(big.Int).SetString(o.AmountOutFilled, 10)
+	if !success {
+		return nil, nil, nil, nil, errors.New("AmountOutFilled SetString(" + o.AmountOutFilled + ") " + strconv.FormatBool(success))
+	}
+	return _amountIn, _amountOutMin, _amountInFilled, _amountOutFilled, nil
+}
+
+// limitOrderAmountOutMin is the minimum output of a partial fill, pro rata to the order's limit.
+func limitOrderAmountOutMin(_fillIn *big.Int, _amountIn *big.Int, _amountOutMin *big.Int) *big.Int {
+	return CeilDiv(new(big.Int).Mul(_fillIn, _amountOutMin), _amountIn)
+}
+
+/*
+*
+
+The largest amountIn whose average price still meets the limit, ignoring the minimum sat fee:
+
+	reserveOut * orderAmountIn          1000 * reserveIn
+	——————————————————————————  -  ——————————————————
+	      orderAmountOutMin             1000 - feeK
+*/
+func limitOrderMaxFillBig(_reserveIn *big.Int, _reserveOut *big.Int, _amountIn *big.Int, _amountOutMin *big.Int, feeK uint16) *big.Int {
+	thousand := big.NewInt(1000)
+	_feeRate := new(big.Int).Sub(thousand, new(big.Int).SetUint64(uint64(feeK)))
+	if _feeRate.Sign() <= 0 || _amountOutMin.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	_a := new(big.Int).Div(new(big.Int).Mul(_reserveOut, _amountIn), _amountOutMin)
+	_b := CeilDiv(new(big.Int).Mul(thousand, _reserveIn), _feeRate)
+	return new(big.Int).Sub(_a, _b)
+}
+
+func CreateLimitOrder(request *PoolCreateLimitOrderRequest) (order *PoolLimitOrder, err error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if request.Username == "" {
+		return nil, errors.New("username is empty")
+	}
+	token0, token1, err := sortTokens(request.TokenIn, request.TokenOut)
+	if err != nil {
+		return nil, errors.Wrap(err, "sortTokens")
+	}
+	if token0 != TokenSatTag {
+		return nil, errors.New("non-sat limit order not implemented yet")
+	}
+	_amountIn, success := new(big.Int).SetString(request.AmountIn, 10)
+	if !success {
+		return nil, errors.New("amountIn SetString(" + request.AmountIn + ") " + strconv.FormatBool(success))
+	}
+	if _amountIn.Sign() <= 0 {
+		return nil, errors.New("invalid amountIn(" + _amountIn.String() + ")")
+	}
+	_amountOutMin, success := new(big.Int).SetString(request.AmountOutMin, 10)
+	if !success {
+		return nil, errors.New("amountOutMin SetString(" + request.AmountOutMin + ") " + strconv.FormatBool(success))
+	}
+	if _amountOutMin.Sign() <= 0 {
+		return nil, errors.New("invalid amountOutMin(" + _amountOutMin.String() + ")")
+	}
+	fee, err := getEffectivePairFeeByTokens(middleware.DB, token0, token1)
+	if err != nil {
+		return nil, errors.Wrap(err, "getEffectivePairFeeByTokens")
+	}
+	_minSwapSat := new(big.Int).SetUint64(uint64(fee.MinSwapSatFee))
+	if request.TokenIn == TokenSatTag && _amountIn.Cmp(_minSwapSat) <= 0 {
+		return nil, errors.New("insufficient amountIn(" + _amountIn.String() + "), need more than " + _minSwapSat.String())
+	}
+	if request.TokenOut == TokenSatTag && _amountOutMin.Cmp(_minSwapSat) <= 0 {
+		return nil, errors.New("insufficient amountOutMin(" + _amountOutMin.String() + "), need more than " + _minSwapSat.String())
+	}
+
+	now := time.Now().Unix()
+	expireAt := request.ExpireAt
+	if expireAt == 0 {
+		expireAt = now + LimitOrderMaxLifetime
+	}
+	if expireAt <= now || expireAt > now+LimitOrderMaxLifetime {
+		return nil, errors.New("invalid expireAt(" + strconv.FormatInt(expireAt, 10) + ")")
+	}
+
+	order = &PoolLimitOrder{
+		PairId:          fee.PairId,
+		Username:        request.Username,
+		TokenIn:         request.TokenIn,
+		TokenOut:        request.TokenOut,
+		AmountIn:        _amountIn.String(),
+		AmountOutMin:    _amountOutMin.String(),
+		AmountInFilled:  ZeroValue,
+		AmountOutFilled: ZeroValue,
+		ExpireAt:        expireAt,
+		Status:          LimitOrderStatusPending,
+	}
+	err = middleware.DB.Create(order).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "create limit order")
+	}
+
+	err = lockPayment.Lock(order.Username, limitOrderLockId(order.ID, "lock"), limitOrderAssetId(order.TokenIn), custodyModels.AmountFromBigInt(_amountIn), 0)
+	if err != nil {
+		order.Status = LimitOrderStatusLockFailed
+		if updateErr := middleware.DB.Model(order).Update("status", order.Status).Error; updateErr != nil {
+			btlLog.PoolLimitOrder.Error("update limit order(%d) status: %v", order.ID, updateErr)
+		}
+		return order, errors.Wrap(err, "lockPayment.Lock")
+	}
+
+	order.Status = LimitOrderStatusOpen
+	err = middleware.DB.Model(order).Update("status", order.Status).Error
+	if err != nil {
+		return order, errors.Wrap(err, "update limit order status")
+	}
+
+	notifyLimitOrderMatcher()
+	return order, nil
+}
+
+// releaseLimitOrder unlocks the unfilled part of an active order and moves it to a final status in one
+// transaction, holding the order row so a fill or a release on another instance waits for it.
+func releaseLimitOrder(order *PoolLimitOrder, status PoolLimitOrderStatus, action string) (err error) {
+	var lock custodyMutex.Lock
+	tx := middleware.DB.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit().Error
+		}
+		if lock != nil {
+			lock.Unlock()
+		}
+	}()
+
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, order.ID).Error
+	if err != nil {
+		return errors.Wrap(err, "lock limit order")
+	}
+	if !order.isActive() {
+		return errors.New("limit order(" + strconv.FormatUint(uint64(order.ID), 10) + ") is not active")
+	}
+	_amountIn, _, _amountInFilled, _, err := order.bigAmounts()
+	if err != nil {
+		return err
+	}
+	_remaining := new(big.Int).Sub(_amountIn, _amountInFilled)
+	if _remaining.Sign() > 0 {
+		lock, err = lockPayment.UnlockTx(tx, order.Username, limitOrderLockId(order.ID, action), limitOrderAssetId(order.TokenIn), custodyModels.AmountFromBigInt(_remaining), 0)
+		if err != nil {
+			return errors.Wrap(err, "lockPayment.UnlockTx")
+		}
+	}
+	order.Status = status
+	err = tx.Model(order).Update("status", status).Error
+	if err != nil {
+		return errors.Wrap(err, "update limit order status")
+	}
+	return nil
+}
+
+func CancelLimitOrder(request *PoolCancelLimitOrderRequest) (order *PoolLimitOrder, err error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	limitOrderMutex.Lock()
+	defer limitOrderMutex.Unlock()
+
+	order = new(PoolLimitOrder)
+	err = middleware.DB.Where("id = ? AND username = ?", request.OrderId, request.Username).First(order).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "limit order does not exist")
+	}
+	err = releaseLimitOrder(order, LimitOrderStatusCancelled, "cancel")
+	if err != nil {
+		return order, errors.Wrap(err, "releaseLimitOrder")
+	}
+	return order, nil
+}
+
+func ExpirePoolLimitOrders() (err error) {
+	limitOrderMutex.Lock()
+	defer limitOrderMutex.Unlock()
+
+	err = recoverPendingLimitOrders()
+	if err != nil {
+		return errors.Wrap(err, "recoverPendingLimitOrders")
+	}
+
+	var orders []PoolLimitOrder
+	err = middleware.DB.Where("status IN ? AND expire_at <= ?", []PoolLimitOrderStatus{LimitOrderStatusOpen, LimitOrderStatusPartiallyFilled}, time.Now().Unix()).
+		Find(&orders).Error
+	if err != nil {
+		return errors.Wrap(err, "find expired limit orders")
+	}
+	for i := range orders {
+		err = releaseLimitOrder(&orders[i], LimitOrderStatusExpired, "expire")
+		if err != nil {
+			btlLog.PoolLimitOrder.Error("expire limit order(%d): %v", orders[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// recoverPendingLimitOrders settles orders left pending by a crash between locking funds and opening the order.
+func recoverPendingLimitOrders() (err error) {
+	var orders []PoolLimitOrder
+	err = middleware.DB.Where("status = ? AND created_at <= ?", LimitOrderStatusPending, time.Now().Add(-limitOrderPendingRecoverIn*time.Second)).
+		Find(&orders).Error
+	if err != nil {
+		return errors.Wrap(err, "find pending limit orders")
+	}
+	for _, order := range orders {
+		status := LimitOrderStatusLockFailed
+		err = middleware.DB.Where("lock_id = ?", limitOrderLockId(order.ID, "lock")).First(&custodyModels.LockBill{}).Error
+		if err == nil {
+			status = LimitOrderStatusOpen
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.Wrap(err, "find limit order lock bill")
+		}
+		err = middleware.DB.Model(&order).Update("status", status).Error
+		if err != nil {
+			return errors.Wrap(err, "update limit order status")
+		}
+	}
+	return nil
+}
+
+func notifyLimitOrderMatcher() {
+	limitOrderMatcherOnce.Do(func() {
+		go func() {
+			for range limitOrderMatchSignal {
+				if err := MatchPoolLimitOrders(); err != nil {
+					btlLog.PoolLimitOrder.Error("MatchPoolLimitOrders: %v", err)
+				}
+			}
+		}()
+	})
+	select {
+	case limitOrderMatchSignal <- struct{}{}:
+	default:
+	}
+}
+
+func MatchPoolLimitOrders() (err error) {
+	limitOrderMutex.Lock()
+	defer limitOrderMutex.Unlock()
+
+	var pairIds []uint
+	err = middleware.DB.Model(&PoolLimitOrder{}).
+		Where("status IN ? AND expire_at > ?", []PoolLimitOrderStatus{LimitOrderStatusOpen, LimitOrderStatusPartiallyFilled}, time.Now().Unix()).
+		Distinct().Pluck("pair_id", &pairIds).Error
+	if err != nil {
+		return errors.Wrap(err, "pluck limit order pair ids")
+	}
+	for _, pairId := range pairIds {
+		for round := 0; round < limitOrderMaxMatchRounds; round++ {
+			var filled bool
+			filled, err = matchPairLimitOrders(pairId)
+			if err != nil {
+				btlLog.PoolLimitOrder.Error("match pair(%d) limit orders: %v", pairId, err)
+				break
+			}
+			if !filled {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// matchPairLimitOrders walks each side of the pair from the lowest limit price up, and stops a side at the first
+// order the current price can't fill, since every later order asks for more.
+func matchPairLimitOrders(pairId uint) (filled bool, err error) {
+	var orders []PoolLimitOrder
+	err = middleware.DB.Where("pair_id = ? AND status IN ? AND expire_at > ?", pairId, []PoolLimitOrderStatus{LimitOrderStatusOpen, LimitOrderStatusPartiallyFilled}, time.Now().Unix()).
+		Order("id").Find(&orders).Error
+	if err != nil {
+		return false, errors.Wrap(err, "find limit orders")
+	}
+	sides := make(map[string][]*PoolLimitOrder)
+	var tokensIn []string
+	for i := range orders {
+		if _, ok := sides[orders[i].TokenIn]; !ok {
+			tokensIn = append(tokensIn, orders[i].TokenIn)
+		}
+		sides[orders[i].TokenIn] = append(sides[orders[i].TokenIn], &orders[i])
+	}
+	for _, tokenIn := range tokensIn {
+		side := sides[tokenIn]
+		sort.SliceStable(side, func(i, j int) bool {
+			_a := new(big.Int).Mul(limitOrderBigOrZero(side[i].AmountOutMin), limitOrderBigOrZero(side[j].AmountIn))
+			_b := new(big.Int).Mul(limitOrderBigOrZero(side[j].AmountOutMin), limitOrderBigOrZero(side[i].AmountIn))
+			return _a.Cmp(_b) < 0
+		})
+		for _, order := range side {
+			var _fillIn *big.Int
+			_fillIn, err = fillLimitOrder(order)
+			if err != nil {
+				btlLog.PoolLimitOrder.Error("fill limit order(%d): %v", order.ID, err)
+				continue
+			}
+			if _fillIn.Sign() <= 0 {
+				break
+			}
+			filled = true
+		}
+	}
+	return filled, nil
+}
+
+func limitOrderBigOrZero(value string) *big.Int {
+	_value, success := new(big.Int).SetString(value, 10)
+	if !success {
+		return big.NewInt(0)
+	}
+	return _value
+}
+
+// quoteLimitOrderFill finds the largest fill the pool accepts at the order's limit, starting from the closed form
+// bound and halving when the minimum sat fee or a before swap fee makes the quote fall short.
+func quoteLimitOrderFill(order *PoolLimitOrder, _remaining *big.Int, _amountIn *big.Int, _amountOutMin *big.Int) (_fillIn *big.Int, _fillOutMin *big.Int, fee *PoolPairFee, err error) {
+	token0, token1, err := sortTokens(order.TokenIn, order.TokenOut)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "sortTokens")
+	}
+	pair, err := getPair(token0, token1)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "getPair")
+	}
+	_reserve0, success := new(big.Int).SetString(pair.Reserve0, 10)
+	if !success {
+		return nil, nil, nil, errors.New("Reserve0 SetString(" + pair.Reserve0 + ") " + strconv.FormatBool(success))
+	}
+	_reserve1, success := new(big.Int).SetString(pair.Reserve1, 10)
+	if !success {
+		return nil, nil, nil, errors.New("Reserve1 SetString(" + pair.Reserve1 + ") " + strconv.FormatBool(success))
+	}
+	_reserveIn, _reserveOut := _reserve0, _reserve1
+	if order.TokenIn == token1 {
+		_reserveIn, _reserveOut = _reserve1, _reserve0
+	}
+
+	fee, err = getEffectivePairFee(middleware.DB, pair.ID, time.Now().Unix())
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "getEffectivePairFee")
+	}
+
+	_fillIn = minBigInt(limitOrderMaxFillBig(_reserveIn, _reserveOut, _amountIn, _amountOutMin, fee.SwapFeeK()), _remaining)
+
+	var beforeSwapFee PoolBeforeSwapFee
+	hasBeforeSwapFee := order.TokenOut == TokenSatTag &&
+		middleware.DB.Model(&PoolBeforeSwapFee{}).Where("pair_id = ?", pair.ID).First(&beforeSwapFee).Error == nil
+
+	for attempt := 0; attempt < limitOrderMaxFillAttempts && _fillIn.Sign() > 0; attempt++ {
+		_fillOutMin = limitOrderAmountOutMin(_fillIn, _amountIn, _amountOutMin)
+		quoteAmountIn := _fillIn.String()
+		err = nil
+		if hasBeforeSwapFee {
+			_, quoteAmountIn, err = beforeSwapFeeByAmountIn(beforeSwapFee.Rate, quoteAmountIn)
+		}
+		if err == nil {
+			_, _, err = calcSwapExactTokenForTokenNoPath(middleware.DB, order.TokenIn, order.TokenOut, quoteAmountIn, _fillOutMin.String(), order.Username, fee.ProjectPartyFeeK, fee.LpAwardFeeK)
+		}
+		if err == nil {
+			return _fillIn, _fillOutMin, fee, nil
+		}
+		_fillIn = new(big.Int).Rsh(_fillIn, 1)
+	}
+	return big.NewInt(0), big.NewInt(0), fee, nil
+}
+
+// fillLimitOrder unlocks one fill from the lock account and swaps it through the pool in one transaction, so the
+// fill is a regular PoolSwapRecord and accrues LP awards, and a failed swap leaves the funds locked. The order row
+// is locked for update, limitOrderMutex only serializes the goroutines of one process. The pair's LockP is held
+// until the transaction commits, like a path swap.
+func fillLimitOrder(order *PoolLimitOrder) (_fillIn *big.Int, err error) {
+	unlock, err := lockPathPairs([]string{order.TokenIn, order.TokenOut})
+	if err != nil {
+		return nil, errors.Wrap(err, "lockPathPairs")
+	}
+	defer unlock()
+	var lock custodyMutex.Lock
+	tx := middleware.DB.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit().Error
+		}
+		if lock != nil {
+			lock.Unlock()
+		}
+	}()
+
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, order.ID).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "lock limit order")
+	}
+	if !order.isActive() || order.ExpireAt <= time.Now().Unix() {
+		return nil, errors.New("limit order(" + strconv.FormatUint(uint64(order.ID), 10) + ") is not active")
+	}
+	_amountIn, _amountOutMin, _amountInFilled, _amountOutFilled, err := order.bigAmounts()
+	if err != nil {
+		return nil, err
+	}
+	_remaining := new(big.Int).Sub(_amountIn, _amountInFilled)
+	if _remaining.Sign() <= 0 {
+		return big.NewInt(0), nil
+	}
+	_fillIn, _fillOutMin, fee, err := quoteLimitOrderFill(order, _remaining, _amountIn, _amountOutMin)
+	if err != nil {
+		return nil, errors.Wrap(err, "quoteLimitOrderFill")
+	}
+	if _fillIn.Sign() <= 0 {
+		return _fillIn, nil
+	}
+
+	lockId := limitOrderLockId(order.ID, fmt.Sprintf("fill/%d", order.FillCount+1))
+	lock, err = lockPayment.UnlockTx(tx, order.Username, lockId, limitOrderAssetId(order.TokenIn), custodyModels.AmountFromBigInt(_fillIn), 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "lockPayment.UnlockTx")
+	}
+	err = swapLimitOrderFill(tx, order, fee, _fillIn, _fillOutMin, _amountIn, _amountInFilled, _amountOutFilled)
+	if err != nil {
+		return nil, errors.Wrap(err, "swapLimitOrderFill")
+	}
+	return _fillIn, nil
+}
+
+func swapLimitOrderFill(tx *gorm.DB, order *PoolLimitOrder, fee *PoolPairFee, _fillIn *big.Int, _fillOutMin *big.Int, _amountIn *big.Int, _amountInFilled *big.Int, _amountOutFilled *big.Int) (err error) {
+	amounts, swapRecordIds, err := swapExactTokensForTokens(tx, []string{order.TokenIn, order.TokenOut}, _fillIn.String(), _fillOutMin.String(), order.Username, fee.ProjectPartyFeeK, fee.LpAwardFeeK)
+	if err != nil {
+		return errors.Wrap(err, "swapExactTokensForTokens")
+	}
+	amountOut := amounts[len(amounts)-1]
+	_amountOut, success := new(big.Int).SetString(amountOut, 10)
+	if !success {
+		return errors.New("amountOut SetString(" + amountOut + ") " + strconv.FormatBool(success))
+	}
+
+	err = tx.Create(&PoolLimitOrderFill{
+		OrderId:      order.ID,
+		PairId:       order.PairId,
+		SwapRecordId: swapRecordIds[0],
+		AmountIn:     _fillIn.String(),
+		AmountOut:    amountOut,
+	}).Error
+	if err != nil {
+		return errors.Wrap(err, "create limit order fill")
+	}
+
+	_newAmountInFilled := new(big.Int).Add(_amountInFilled, _fillIn)
+	status := LimitOrderStatusPartiallyFilled
+	if _newAmountInFilled.Cmp(_amountIn) >= 0 {
+		status = LimitOrderStatusFilled
+	}
+	updates := map[string]any{
+		"amount_in_filled":  _newAmountInFilled.String(),
+		"amount_out_filled": new(big.Int).Add(_amountOutFilled, _amountOut).String(),
+		"fill_count":        order.FillCount + 1,
+		"status":            status,
+	}
+	err = tx.Model(order).Updates(updates).Error
+	if err != nil {
+		return errors.Wrap(err, "update limit order")
+	}
+	return nil
+}
+
+func QueryUserLimitOrdersCount(username string) (count int64, err error) {
+	err = middleware.DB.Model(&PoolLimitOrder{}).Where("username = ?", username).Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "count limit orders")
+	}
+	return count, nil
+}
+
+func QueryUserLimitOrders(username string, limit int, offset int) (orders *[]PoolLimitOrder, err error) {
+	orders = new([]PoolLimitOrder)
+	err = middleware.DB.Where("username = ?", username).
+		Order("id desc").Limit(limit).Offset(offset).Find(orders).Error
+	if err != nil {
+		return new([]PoolLimitOrder), errors.Wrap(err, "find limit orders")
+	}
+	return orders, nil
+}
+
+func QueryUserLimitOrderFills(username string, orderId uint) (fills *[]PoolLimitOrderFill, err error) {
+	var order PoolLimitOrder
+	err = middleware.DB.Where("id = ? AND username = ?", orderId, username).First(&order).Error
+	if err != nil {
+		return new([]PoolLimitOrderFill), errors.Wrap(err, "limit order does not exist")
+	}
+	fills = new([]PoolLimitOrderFill)
+	err = middleware.DB.Where("order_id = ?", orderId).Order("id").Find(fills).Error
+	if err != nil {
+		return new([]PoolLimitOrderFill), errors.Wrap(err, "find limit order fills")
+	}
+	return fills, nil
+}
@@ -0,0 +1,234 @@
+package pool
+
+import (
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"strconv"
+	"time"
+	"trade/middleware"
+)
+
+// PriceCumulativeDecimals is the fixed point precision of the cumulative prices, a price of 1 is stored as 1e18.
+const PriceCumulativeDecimals = 18
+
+const DefaultTwapWindowSecond int64 = 30 * 60
+
+var priceCumulativeScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(PriceCumulativeDecimals), nil)
+
+// PoolPairPriceObservation is a snapshot of a pair's cumulative prices, written on every reserve change.
+// Reserve0 and Reserve1 are the reserves after the change, so the cumulative prices at any later time
+// before the next observation can be extrapolated from the snapshot.
+type PoolPairPriceObservation struct {
+	gorm.Model
+	PairId           uint   `json:"pair_id" gorm:"uniqueIndex:idx_pair_id_timestamp"`
+	Timestamp        int64  `json:"timestamp" gorm:"uniqueIndex:idx_pair_id_timestamp"`
+	Price0Cumulative string `json:"price0_cumulative" gorm:"type:varchar(255)"`
+	Price1Cumulative string `json:"price1_cumulative" gorm:"type:varchar(255)"`
+	Reserve0         string `json:"reserve0" gorm:"type:varchar(255)"`
+	Reserve1         string `json:"reserve1" gorm:"type:varchar(255)"`
+}
+
+// PoolTwap is the time weighted average price of a pair over [Start, End).
+// Price0 is the price of token0 in token1, Price1 is the price of token1 in token0.
+type PoolTwap struct {
+	PairId uint            `json:"pair_id"`
+	Token0 string          `json:"token0"`
+	Token1 string          `json:"token1"`
+	Start  int64           `json:"start"`
+	End    int64           `json:"end"`
+	Price0 decimal.Decimal `json:"price0"`
+	Price1 decimal.Decimal `json:"price1"`
+}
+
+func parseReserves(reserve0 string, reserve1 string) (_reserve0 *big.Int, _reserve1 *big.Int, err error) {
+	_reserve0, success := new(big.Int).SetString(reserve0, 10)
+	if !success {
+		return nil, nil, errors.New("reserve0 SetString(" + reserve0 + ") " + strconv.FormatBool(success))
+	}
+	_reserve1, success = new(big.Int).SetString(reserve1, 10)
+	if !success {
+		return nil, nil, errors.New("reserve1 SetString(" + reserve1 + ") " + strconv.FormatBool(success))
+	}
+	return _reserve0, _reserve1, nil
+}
+
+func parseCumulative(cumulative string) (_cumulative *big.Int, err error) {
+	if cumulative == "" {
+		return big.NewInt(0), nil
+	}
+	_cumulative, success := new(big.Int).SetString(cumulative, 10)
+	if !success {
+		return nil, errors.New("cumulative SetString(" + cumulative + ") " + strconv.FormatBool(success))
+	}
+	return _cumulative, nil
+}
+
+// accumulatePrices adds the prices given by the reserves, held for elapsed seconds, to the cumulative prices.
+func accumulatePrices(_price0Cumulative *big.Int, _price1Cumulative *big.Int, _reserve0 *big.Int, _reserve1 *big.Int, elapsed int64) (*big.Int, *big.Int) {
+	if elapsed <= 0 || _reserve0.Sign() <= 0 || _reserve1.Sign() <= 0 {
+		return new(big.Int).Set(_price0Cumulative), new(big.Int).Set(_price1Cumulative)
+	}
+	_elapsed := big.NewInt(elapsed)
+	_price0 := new(big.Int).Quo(new(big.Int).Mul(_reserve1, priceCumulativeScale), _reserve0)
+	_price1 := new(big.Int).Quo(new(big.Int).Mul(_reserve0, priceCumulativeScale), _reserve1)
+	return new(big.Int).Add(_price0Cumulative, new(big.Int).Mul(_price0, _elapsed)),
+		new(big.Int).Add(_price1Cumulative, new(big.Int).Mul(_price1, _elapsed))
+}
+
+func savePairPriceObservation(tx *gorm.DB, pairId uint, timestamp int64, _price0Cumulative *big.Int, _price1Cumulative *big.Int, reserve0 string, reserve1 string) (err error) {
+	observation := PoolPairPriceObservation{
+		PairId:           pairId,
+		Timestamp:        timestamp,
+		Price0Cumulative: _price0Cumulative.String(),
+		Price1Cumulative: _price1Cumulative.String(),
+		Reserve0:         reserve0,
+		Reserve1:         reserve1,
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pair_id"}, {Name: "timestamp"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "price0_cumulative", "price1_cumulative", "reserve0", "reserve1"}),
+	}).Create(&observation).Error
+	if err != nil {
+		return errors.Wrap(err, "create PoolPairPriceObservation")
+	}
+	return nil
+}
+
+// initPairPriceOracle starts the accumulators of a newly created pair.
+func initPairPriceOracle(tx *gorm.DB, pair *PoolPair) (err error) {
+	return savePairPriceObservation(tx, pair.ID, pair.PriceTimestampLast, big.NewInt(0), big.NewInt(0), pair.Reserve0, pair.Reserve1)
+}
+
+// updatePairReserves writes the new reserves of the pair. The prices given by the old reserves are
+// accumulated for the time they were in effect before the reserves change.
+func updatePairReserves(tx *gorm.DB, pair *PoolPair, _newReserve0 *big.Int, _newReserve1 *big.Int) (err error) {
+	now := time.Now().Unix()
+	_price0Cumulative, err := parseCumulative(pair.Price0CumulativeLast)
+	if err != nil {
+		return errors.Wrap(err, "parseCumulative price0")
+	}
+	_price1Cumulative, err := parseCumulative(pair.Price1CumulativeLast)
+	if err != nil {
+		return errors.Wrap(err, "parseCumulative price1")
+	}
+	// Pairs created before the oracle start accumulating from their first reserve change.
+	if pair.PriceTimestampLast != 0 {
+		_reserve0, _reserve1, err := parseReserves(pair.Reserve0, pair.Reserve1)
+		if err != nil {
+			return errors.Wrap(err, "parseReserves")
+		}
+		_price0Cumulative, _price1Cumulative = accumulatePrices(_price0Cumulative, _price1Cumulative, _reserve0, _reserve1, now-pair.PriceTimestampLast)
+	}
+
+	err = tx.Model(&PoolPair{}).Where("id = ?", pair.ID).
+		Updates(map[string]any{
+			"reserve0":               _newReserve0.String(),
+			"reserve1":               _newReserve1.String(),
+			"price0_cumulative_last": _price0Cumulative.String(),
+			"price1_cumulative_last": _price1Cumulative.String(),
+			"price_timestamp_last":   now,
+		}).Error
+	if err != nil {
+		return errors.Wrap(err, "update pair")
+	}
+	pair.Reserve0 = _newReserve0.String()
+	pair.Reserve1 = _newReserve1.String()
+	pair.Price0CumulativeLast = _price0Cumulative.String()
+	pair.Price1CumulativeLast = _price1Cumulative.String()
+	pair.PriceTimestampLast = now
+
+	return savePairPriceObservation(tx, pair.ID, now, _price0Cumulative, _price1Cumulative, pair.Reserve0, pair.Reserve1)
+}
+
+// cumulativePricesAt returns the pair's cumulative prices at timestamp, extrapolated from the latest observation before it.
+func cumulativePricesAt(tx *gorm.DB, pairId uint, timestamp int64) (_price0Cumulative *big.Int, _price1Cumulative *big.Int, err error) {
+	var observation PoolPairPriceObservation
+	err = tx.Model(&PoolPairPriceObservation{}).
+		Where("pair_id = ? AND timestamp <= ?", pairId, timestamp).
+		Order("timestamp desc").
+		First(&observation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("no price observation at or before " + strconv.FormatInt(timestamp, 10))
+		}
+		return nil, nil, errors.Wrap(err, "first PoolPairPriceObservation")
+	}
+	_price0Cumulative, err = parseCumulative(observation.Price0Cumulative)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parseCumulative price0")
+	}
+	_price1Cumulative, err = parseCumulative(observation.Price1Cumulative)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parseCumulative price1")
+	}
+	_reserve0, _reserve1, err := parseReserves(observation.Reserve0, observation.Reserve1)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parseReserves")
+	}
+	_price0Cumulative, _price1Cumulative = accumulatePrices(_price0Cumulative, _price1Cumulative, _reserve0, _reserve1, timestamp-observation.Timestamp)
+	return _price0Cumulative, _price1Cumulative, nil
+}
+
+func averagePrice(_startCumulative *big.Int, _endCumulative *big.Int, elapsed int64) decimal.Decimal {
+	_delta := new(big.Int).Sub(_endCumulative, _startCumulative)
+	return decimal.NewFromBigInt(_delta, -PriceCumulativeDecimals).
+		DivRound(decimal.NewFromInt(elapsed), PriceCumulativeDecimals)
+}
+
+// QueryPoolTwap returns the time weighted average prices of the pair over [start, end).
+// end defaults to now and start defaults to DefaultTwapWindowSecond before end.
+func QueryPoolTwap(tokenA string, tokenB string, start int64, end int64) (twap *PoolTwap, err error) {
+	if end == 0 {
+		end = time.Now().Unix()
+	}
+	if start == 0 {
+		start = end - DefaultTwapWindowSecond
+	}
+	if start >= end {
+		return nil, errors.New("invalid time range(" + strconv.FormatInt(start, 10) + "," + strconv.FormatInt(end, 10) + ")")
+	}
+	if end > time.Now().Unix() {
+		return nil, errors.New("end(" + strconv.FormatInt(end, 10) + ") is in the future")
+	}
+	pair, err := getPair(tokenA, tokenB)
+	if err != nil {
+		return nil, errors.Wrap(err, "getPair")
+	}
+	_startPrice0Cumulative, _startPrice1Cumulative, err := cumulativePricesAt(middleware.DB, pair.ID, start)
+	if err != nil {
+		return nil, errors.Wrap(err, "cumulativePricesAt start")
+	}
+	_endPrice0Cumulative, _endPrice1Cumulative, err := cumulativePricesAt(middleware.DB, pair.ID, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "cumulativePricesAt end")
+	}
+	return &PoolTwap{
+		PairId: pair.ID,
+		Token0: pair.Token0,
+		Token1: pair.Token1,
+		Start:  start,
+		End:    end,
+		Price0: averagePrice(_startPrice0Cumulative, _endPrice0Cumulative, end-start),
+		Price1: averagePrice(_startPrice1Cumulative, _endPrice1Cumulative, end-start),
+	}, nil
+}
+
+// QueryTokenSatTwap returns the time weighted average price in sat of one base unit of token over the last window seconds.
+func QueryTokenSatTwap(token string, window int64) (price decimal.Decimal, err error) {
+	if token == TokenSatTag {
+		return decimal.NewFromInt(1), nil
+	}
+	if window <= 0 {
+		window = DefaultTwapWindowSecond
+	}
+	end := time.Now().Unix()
+	twap, err := QueryPoolTwap(TokenSatTag, token, end-window, end)
+	if err != nil {
+		return decimal.Zero, errors.Wrap(err, "QueryPoolTwap")
+	}
+	// Sat always sorts as token0, so the token is token1 and its price in sat is Price1.
+	return twap.Price1, nil
+}
@@ -16,6 +16,11 @@ type PoolPair struct {
 	Token1         string `json:"token1" gorm:"type:varchar(255);uniqueIndex:idx_token_0_token_1"`
 	Reserve0       string `json:"reserve0" gorm:"type:varchar(255)"`
 	Reserve1       string `json:"reserve1" gorm:"type:varchar(255)"`
+	// Price0CumulativeLast and Price1CumulativeLast are the sums of price times seconds held up to PriceTimestampLast,
+	// scaled by 10^PriceCumulativeDecimals. See oracle.go.
+	Price0CumulativeLast string `json:"price0_cumulative_last" gorm:"type:varchar(255)"`
+	Price1CumulativeLast string `json:"price1_cumulative_last" gorm:"type:varchar(255)"`
+	PriceTimestampLast   int64  `json:"price_timestamp_last"`
 }
 
 func getPair(token0 string, token1 string) (pair *PoolPair, err error) {
@@ -118,17 +123,12 @@ func updatePair(token0 string, token1 string, reserve0 string, reserve1 string)
 	if err != nil {
 		return utils.AppendErrorInfo(err, "getPair")
 	}
-	pair.Reserve0 = tokenMapReserve[_token0]
-	pair.Reserve1 = tokenMapReserve[_token1]
-
-	return middleware.DB.
-		Model(&PoolPair{}).
-		Where("token0 = ? AND token1 = ?", _token0, _token1).
-		Updates(map[string]any{
-			"reserve0": tokenMapReserve[_token0],
-			"reserve1": tokenMapReserve[_token1],
-		}).
-		Error
+	_newReserve0, _newReserve1, err := parseReserves(tokenMapReserve[_token0], tokenMapReserve[_token1])
+	if err != nil {
+		return utils.AppendErrorInfo(err, "parseReserves")
+	}
+
+	return updatePairReserves(middleware.DB, pair, _newReserve0, _newReserve1)
 }
 
 func _newPair(token0 string, token1 string, reserve0 string, reserve1 string) (pair *PoolPair, err error) {
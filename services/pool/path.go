@@ -0,0 +1,872 @@
+package pool
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"math/big"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"trade/middleware"
+)
+
+const (
+	MaxSwapPathHops = 3
+)
+
+var pathAmountInUnbounded = new(big.Int).Lsh(big.NewInt(1), 128)
+
+type PoolSwapExactTokensForTokensRequest struct {
+	Path             []string `json:"path"`
+	AmountIn         string   `json:"amount_in"`
+	AmountOutMin     string   `json:"amount_out_min"`
+	Username         string   `json:"username"`
+	ProjectPartyFeeK uint16   `json:"project_party_fee_k"`
+	LpAwardFeeK      uint16   `json:"lp_award_fee_k"`
+	Slippage         uint16   `json:"slippage"`
+}
+
+type PoolSwapTokensForExactTokensRequest struct {
+	Path             []string `json:"path"`
+	AmountOut        string   `json:"amount_out"`
+	AmountInMax      string   `json:"amount_in_max"`
+	Username         string   `json:"username"`
+	ProjectPartyFeeK uint16   `json:"project_party_fee_k"`
+	LpAwardFeeK      uint16   `json:"lp_award_fee_k"`
+	Slippage         uint16   `json:"slippage"`
+}
+
+type SwapExactTokensForTokensResult struct {
+	Path      []string `json:"path"`
+	Amounts   []string `json:"amounts"`
+	AmountOut string   `json:"amountOut"`
+}
+
+type SwapTokensForExactTokensResult struct {
+	Path     []string `json:"path"`
+	Amounts  []string `json:"amounts"`
+	AmountIn string   `json:"amountIn"`
+}
+
+type CalcSwapExactTokensForTokensResponse struct {
+	Path        []string          `json:"path"`
+	Amounts     []string          `json:"amounts"`
+	AmountOut   string            `json:"amount_out"`
+	SwapRecords []*SwapRecordInfo `json:"swap_records"`
+}
+
+type CalcSwapTokensForExactTokensResponse struct {
+	Path        []string          `json:"path"`
+	Amounts     []string          `json:"amounts"`
+	AmountIn    string            `json:"amount_in"`
+	SwapRecords []*SwapRecordInfo `json:"swap_records"`
+}
+
+type BestSwapPathResponse struct {
+	Path    []string `json:"path"`
+	Amounts []string `json:"amounts"`
+}
+
+func validatePath(path []string) (err error) {
+	if len(path) < 2 {
+		return errors.New("invalid path length(" + strconv.Itoa(len(path)) + "), need at least 2 tokens")
+	}
+	if len(path)-1 > MaxSwapPathHops {
+		return errors.New("invalid path length(" + strconv.Itoa(len(path)) + "), max hops is " + strconv.Itoa(MaxSwapPathHops))
+	}
+	visited := make(map[string]bool)
+	for i, token := range path {
+		if visited[token] {
+			return errors.New("duplicate token(" + token + ") in path")
+		}
+		visited[token] = true
+		if i == 0 {
+			continue
+		}
+		_, _, err = sortTokens(path[i-1], token)
+		if err != nil {
+			return errors.Wrap(err, "sortTokens("+path[i-1]+","+token+")")
+		}
+	}
+	return nil
+}
+
+func IsPathTokenDisabled(path []string, disabled []string) bool {
+	for _, token := range path {
+		if slices.Contains(disabled, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockPathPairs takes the LockP of every pair on the path in token order and returns the func releasing them.
+// Callers swapping several hops keep the locks until their transaction commits, so no other swap reads reserves
+// a hop has written but not committed yet.
+func lockPathPairs(path []string) (unlock func(), err error) {
+	var pairs [][2]string
+	for i := 0; i < len(path)-1; i++ {
+		token0, token1, err := sortTokens(path[i], path[i+1])
+		if err != nil {
+			return nil, errors.Wrap(err, "sortTokens("+path[i]+","+path[i+1]+")")
+		}
+		pairs = append(pairs, [2]string{token0, token1})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	pairs = slices.Compact(pairs)
+	locks := make([]*sync.Mutex, len(pairs))
+	for i, pair := range pairs {
+		locks[i] = pairMutex(pair[0], pair[1])
+		locks[i].Lock()
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}, nil
+}
+
+type pathPair struct {
+	PairId        uint
+	Token0        string
+	Token1        string
+	Reserve0      *big.Int
+	Reserve1      *big.Int
+	FeeK          uint16
+	MinSwapSatFee uint
+}
+
+func (p *pathPair) reserves(tokenIn string) (_reserveIn *big.Int, _reserveOut *big.Int) {
+	if tokenIn == p.Token0 {
+		return p.Reserve0, p.Reserve1
+	}
+	return p.Reserve1, p.Reserve0
+}
+
+func (p *pathPair) other(token string) string {
+	if token == p.Token0 {
+		return p.Token1
+	}
+	return p.Token0
+}
+
+// amountOut quotes an exact in hop with the fee rules of swapExactTokenForTokenNoPath, the minimum sat fee included.
+// Nft presale buyers pay half the fee when it is taken from the sat output.
+func (p *pathPair) amountOut(tokenIn string, _amountIn *big.Int, isNftPresaleBuyer bool) (_amountOut *big.Int, err error) {
+	if p.Token0 != TokenSatTag {
+		return nil, errors.New("non-sat swap not implemented yet")
+	}
+	_reserveIn, _reserveOut := p.reserves(tokenIn)
+	_minSwapSatFee := new(big.Int).SetUint64(uint64(p.MinSwapSatFee))
+	if tokenIn == TokenSatTag {
+		if _amountIn.Cmp(_minSwapSatFee) <= 0 {
+			return nil, errors.New("insufficient _amountIn(" + _amountIn.String() + "), need " + _minSwapSatFee.String())
+		}
+		_, _amountInFee := amountFee(_amountIn, p.FeeK)
+		if _amountInFee.Cmp(_minSwapSatFee) < 0 {
+			return getAmountOutBigWithoutFee(new(big.Int).Sub(_amountIn, _minSwapSatFee), _reserveIn, _reserveOut)
+		}
+		return getAmountOutBig(_amountIn, _reserveIn, _reserveOut, p.FeeK)
+	}
+
+	_amountOutWithFee, err := getAmountOutBig(_amountIn, _reserveIn, _reserveOut, p.FeeK)
+	if err != nil {
+		return nil, errors.Wrap(err, "getAmountOutBig")
+	}
+	if _amountOutWithFee.Cmp(_minSwapSatFee) <= 0 {
+		return nil, errors.New("insufficientAmountOutWithFee(" + _amountOutWithFee.String() + "), need gt " + _minSwapSatFee.String())
+	}
+	_amountOutWithoutFee, err := getAmountOutBigWithoutFee(_amountIn, _reserveIn, _reserveOut)
+	if err != nil {
+		return nil, errors.Wrap(err, "getAmountOutBigWithoutFee")
+	}
+	_swapFee := new(big.Int).Sub(_amountOutWithoutFee, _amountOutWithFee)
+	if _swapFee.Cmp(_minSwapSatFee) < 0 {
+		_amountOut = new(big.Int).Sub(_amountOutWithoutFee, _minSwapSatFee)
+	} else if isNftPresaleBuyer {
+		_swapFee = CeilDiv(_swapFee, big.NewInt(2))
+		if _swapFee.Cmp(_minSwapSatFee) < 0 {
+			_swapFee = _minSwapSatFee
+		}
+		_amountOut = new(big.Int).Sub(_amountOutWithoutFee, _swapFee)
+	} else {
+		_amountOut = _amountOutWithFee
+	}
+	if _amountOut.Cmp(_minSwapSatFee) <= 0 {
+		return nil, errors.New("insufficientAmountOut(" + _amountOut.String() + "), need gt " + _minSwapSatFee.String())
+	}
+	return _amountOut, nil
+}
+
+// amountIn quotes an exact out hop with the fee rules of swapTokenForExactTokenNoPath, see amountOut.
+func (p *pathPair) amountIn(tokenOut string, _amountOut *big.Int, isNftPresaleBuyer bool) (_amountIn *big.Int, err error) {
+	if p.Token0 != TokenSatTag {
+		return nil, errors.New("non-sat swap not implemented yet")
+	}
+	_reserveIn, _reserveOut := p.reserves(p.other(tokenOut))
+	if _amountOut.Cmp(_reserveOut) >= 0 {
+		return nil, errors.New("excessive _amountOut(" + _amountOut.String() + "), need lt reserveOut(" + _reserveOut.String() + ")")
+	}
+	_minSwapSatFee := new(big.Int).SetUint64(uint64(p.MinSwapSatFee))
+	if tokenOut == TokenSatTag {
+		if _amountOut.Cmp(_minSwapSatFee) <= 0 {
+			return nil, errors.New("insufficient _amountOut(" + _amountOut.String() + "), need " + _minSwapSatFee.String())
+		}
+		_, _amountOutFee := amountFee(_amountOut, p.FeeK)
+		if _amountOutFee.Cmp(_minSwapSatFee) < 0 {
+			return getAmountInBigWithoutFee(new(big.Int).Add(_amountOut, _minSwapSatFee), _reserveIn, _reserveOut)
+		}
+		return getAmountInBig(_amountOut, _reserveIn, _reserveOut, p.FeeK)
+	}
+
+	_amountInWithFee, err := getAmountInBig(_amountOut, _reserveIn, _reserveOut, p.FeeK)
+	if err != nil {
+		return nil, errors.Wrap(err, "getAmountInBig")
+	}
+	_amountInWithoutFee, err := getAmountInBigWithoutFee(_amountOut, _reserveIn, _reserveOut)
+	if err != nil {
+		return nil, errors.Wrap(err, "getAmountInBigWithoutFee")
+	}
+	_swapFee := new(big.Int).Sub(_amountInWithFee, _amountInWithoutFee)
+	if _swapFee.Cmp(_minSwapSatFee) < 0 {
+		return new(big.Int).Add(_amountInWithoutFee, _minSwapSatFee), nil
+	}
+	if isNftPresaleBuyer {
+		_swapFee = CeilDiv(_swapFee, big.NewInt(2))
+		if _swapFee.Cmp(_minSwapSatFee) < 0 {
+			_swapFee = _minSwapSatFee
+		}
+		return new(big.Int).Add(_amountInWithoutFee, _swapFee), nil
+	}
+	return _amountInWithFee, nil
+}
+
+type pathGraph struct {
+	pairs             map[string]*pathPair
+	adjacency         map[string][]*pathPair
+	beforeSwapFees    map[uint]uint16
+	isNftPresaleBuyer bool
+}
+
+func pathPairKey(token0 string, token1 string) string {
+	return token0 + "_" + token1
+}
+
+// loadPathGraph loads every pair with liquidity. Quotes are for username, whose nft presale purchase halves the swap fee.
+func loadPathGraph(tx *gorm.DB, username string) (graph *pathGraph, err error) {
+	now := time.Now().Unix()
+	var pairs []PoolPair
+	err = tx.Model(&PoolPair{}).Find(&pairs).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "find PoolPair")
+	}
+	graph = &pathGraph{
+		pairs:          make(map[string]*pathPair),
+		adjacency:      make(map[string][]*pathPair),
+		beforeSwapFees: make(map[uint]uint16),
+	}
+	if username != "" {
+		graph.isNftPresaleBuyer, err = IsUserBoughtNftPresale(username)
+		if err != nil {
+			return nil, errors.Wrap(err, "IsUserBoughtNftPresale")
+		}
+	}
+	for _, pair := range pairs {
+		_reserve0, success := new(big.Int).SetString(pair.Reserve0, 10)
+		if !success {
+			return nil, errors.New("Reserve0 SetString(" + pair.Reserve0 + ") " + strconv.FormatBool(success))
+		}
+		_reserve1, success := new(big.Int).SetString(pair.Reserve1, 10)
+		if !success {
+			return nil, errors.New("Reserve1 SetString(" + pair.Reserve1 + ") " + strconv.FormatBool(success))
+		}
+		if _reserve0.Sign() <= 0 || _reserve1.Sign() <= 0 {
+			continue
+		}
+		fee, err := getEffectivePairFee(tx, pair.ID, now)
+		if err != nil {
+			return nil, errors.Wrap(err, "getEffectivePairFee")
+		}
+		_pathPair := &pathPair{
+			PairId:        pair.ID,
+			Token0:        pair.Token0,
+			Token1:        pair.Token1,
+			Reserve0:      _reserve0,
+			Reserve1:      _reserve1,
+			FeeK:          fee.SwapFeeK(),
+			MinSwapSatFee: fee.MinSwapSatFee,
+		}
+		graph.pairs[pathPairKey(pair.Token0, pair.Token1)] = _pathPair
+		graph.adjacency[pair.Token0] = append(graph.adjacency[pair.Token0], _pathPair)
+		graph.adjacency[pair.Token1] = append(graph.adjacency[pair.Token1], _pathPair)
+	}
+
+	var beforeSwapFees []PoolBeforeSwapFee
+	err = tx.Model(&PoolBeforeSwapFee{}).Find(&beforeSwapFees).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "find PoolBeforeSwapFee")
+	}
+	for _, fee := range beforeSwapFees {
+		graph.beforeSwapFees[fee.PairId] = fee.Rate
+	}
+	return graph, nil
+}
+
+func (g *pathGraph) getPair(tokenA string, tokenB string) (pair *pathPair, err error) {
+	token0, token1, err := sortTokens(tokenA, tokenB)
+	if err != nil {
+		return nil, errors.Wrap(err, "sortTokens")
+	}
+	pair, ok := g.pairs[pathPairKey(token0, token1)]
+	if !ok {
+		return nil, errors.Wrap(PoolDoesNotExistErr, token0+"_"+token1)
+	}
+	return pair, nil
+}
+
+// getAmountsOutBig quotes every hop of the path from the cached reserves and each pair's effective fee.
+// Before swap fee is deducted from the hop input when the hop sells into sat, same as the single hop swap.
+// The before swap fee the swap rejects when it rounds to zero is skipped here, so tiny amounts may quote a little high.
+func (g *pathGraph) getAmountsOutBig(path []string, _amountIn *big.Int) (_amounts []*big.Int, err error) {
+	_amounts = make([]*big.Int, len(path))
+	_amounts[0] = _amountIn
+	for i := 0; i < len(path)-1; i++ {
+		pair, err := g.getPair(path[i], path[i+1])
+		if err != nil {
+			return nil, errors.Wrap(err, "getPair")
+		}
+		_hopAmountIn := _amounts[i]
+		if rate, ok := g.beforeSwapFees[pair.PairId]; ok && path[i+1] == TokenSatTag {
+			_beforeSwapFee := new(big.Int).Div(new(big.Int).Mul(_hopAmountIn, new(big.Int).SetUint64(uint64(rate))), big.NewInt(10000))
+			_hopAmountIn = new(big.Int).Sub(_hopAmountIn, _beforeSwapFee)
+		}
+		_amounts[i+1], err = pair.amountOut(path[i], _hopAmountIn, g.isNftPresaleBuyer)
+		if err != nil {
+			return nil, errors.Wrap(err, "amountOut")
+		}
+		if _amounts[i+1].Sign() <= 0 {
+			return nil, errors.New("insufficientOutputAmount(" + _amounts[i+1].String() + ") at hop " + strconv.Itoa(i))
+		}
+	}
+	return _amounts, nil
+}
+
+// getAmountsInBig quotes the path backwards from the desired output.
+// Hops selling into sat on a pair with before swap fee are rejected, because that fee is taken from the output.
+func (g *pathGraph) getAmountsInBig(path []string, _amountOut *big.Int) (_amounts []*big.Int, err error) {
+	_amounts = make([]*big.Int, len(path))
+	_amounts[len(path)-1] = _amountOut
+	for i := len(path) - 1; i > 0; i-- {
+		pair, err := g.getPair(path[i-1], path[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "getPair")
+		}
+		if _, ok := g.beforeSwapFees[pair.PairId]; ok && path[i] == TokenSatTag {
+			return nil, errors.New("pair(" + strconv.FormatUint(uint64(pair.PairId), 10) + ") with before swap fee does not support exact out path")
+		}
+		_amounts[i-1], err = pair.amountIn(path[i], _amounts[i], g.isNftPresaleBuyer)
+		if err != nil {
+			return nil, errors.Wrap(err, "amountIn")
+		}
+	}
+	return _amounts, nil
+}
+
+// walkPaths calls fn with every simple path from tokenIn to tokenOut of at most MaxSwapPathHops hops.
+func (g *pathGraph) walkPaths(tokenIn string, tokenOut string, fn func(path []string)) {
+	visited := map[string]bool{tokenIn: true}
+	var walk func(path []string)
+	walk = func(path []string) {
+		last := path[len(path)-1]
+		if last == tokenOut {
+			fn(append([]string{}, path...))
+			return
+		}
+		if len(path)-1 >= MaxSwapPathHops {
+			return
+		}
+		for _, pair := range g.adjacency[last] {
+			next := pair.other(last)
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			walk(append(path, next))
+			visited[next] = false
+		}
+	}
+	walk([]string{tokenIn})
+}
+
+func (g *pathGraph) bestPathExactIn(tokenIn string, tokenOut string, _amountIn *big.Int) (bestPath []string, bestAmounts []*big.Int, err error) {
+	g.walkPaths(tokenIn, tokenOut, func(path []string) {
+		_amounts, err := g.getAmountsOutBig(path, _amountIn)
+		if err != nil {
+			return
+		}
+		if bestAmounts == nil || _amounts[len(_amounts)-1].Cmp(bestAmounts[len(bestAmounts)-1]) > 0 {
+			bestPath, bestAmounts = path, _amounts
+		}
+	})
+	if bestPath == nil {
+		return nil, nil, errors.New("no path found from " + tokenIn + " to " + tokenOut)
+	}
+	return bestPath, bestAmounts, nil
+}
+
+func (g *pathGraph) bestPathExactOut(tokenIn string, tokenOut string, _amountOut *big.Int) (bestPath []string, bestAmounts []*big.Int, err error) {
+	g.walkPaths(tokenIn, tokenOut, func(path []string) {
+		_amounts, err := g.getAmountsInBig(path, _amountOut)
+		if err != nil {
+			return
+		}
+		if bestAmounts == nil || _amounts[0].Cmp(bestAmounts[0]) < 0 {
+			bestPath, bestAmounts = path, _amounts
+		}
+	})
+	if bestPath == nil {
+		return nil, nil, errors.New("no path found from " + tokenIn + " to " + tokenOut)
+	}
+	return bestPath, bestAmounts, nil
+}
+
+func bigIntsToStrings(_values []*big.Int) []string {
+	values := make([]string, len(_values))
+	for i, _value := range _values {
+		values[i] = _value.String()
+	}
+	return values
+}
+
+// FindBestPathExactIn quotes for username, see loadPathGraph.
+func FindBestPathExactIn(tokenIn string, tokenOut string, amountIn string, username string) (path []string, amounts []string, err error) {
+	_amountIn, success := new(big.Int).SetString(amountIn, 10)
+	if !success {
+		return nil, nil, errors.New("amountIn SetString(" + amountIn + ") " + strconv.FormatBool(success))
+	}
+	graph, err := loadPathGraph(middleware.DB, username)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "loadPathGraph")
+	}
+	path, _amounts, err := graph.bestPathExactIn(tokenIn, tokenOut, _amountIn)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "bestPathExactIn")
+	}
+	return path, bigIntsToStrings(_amounts), nil
+}
+
+// FindBestPathExactOut quotes for username, see loadPathGraph.
+func FindBestPathExactOut(tokenIn string, tokenOut string, amountOut string, username string) (path []string, amounts []string, err error) {
+	_amountOut, success := new(big.Int).SetString(amountOut, 10)
+	if !success {
+		return nil, nil, errors.New("amountOut SetString(" + amountOut + ") " + strconv.FormatBool(success))
+	}
+	graph, err := loadPathGraph(middleware.DB, username)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "loadPathGraph")
+	}
+	path, _amounts, err := graph.bestPathExactOut(tokenIn, tokenOut, _amountOut)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "bestPathExactOut")
+	}
+	return path, bigIntsToStrings(_amounts), nil
+}
+
+// pathBeforeSwapFeeByAmountIn charges before swap fee for one hop exactly like SwapExactTokenForTokenNoPath does.
+func pathBeforeSwapFeeByAmountIn(tx *gorm.DB, tokenIn string, tokenOut string, amountIn string, username string) (actualAmountIn string, err error) {
+	if tokenOut != TokenSatTag {
+		return amountIn, nil
+	}
+	pairId, err := QueryPairId(tx, tokenIn, tokenOut)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "QueryPairId")
+	}
+	var _poolBeforeSwapFee PoolBeforeSwapFee
+	err = tx.Model(&PoolBeforeSwapFee{}).Where("pair_id = ?", pairId).First(&_poolBeforeSwapFee).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return amountIn, nil
+	}
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "first PoolBeforeSwapFee")
+	}
+	beforeSwapFee, actualAmountIn, err := beforeSwapFeeByAmountIn(_poolBeforeSwapFee.Rate, amountIn)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "beforeSwapFeeByAmountIn")
+	}
+	err = beforeSwapFeePureAddLiquidity(tx, tokenIn, tokenOut, beforeSwapFee, ZeroValue, username)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "beforeSwapFeePureAddLiquidity")
+	}
+	return actualAmountIn, nil
+}
+
+// swapExactTokensForTokens must be called with the LockP of every pair on the path held, see lockPathPairs.
+// It returns the id of the swap record of every hop.
+func swapExactTokensForTokens(tx *gorm.DB, path []string, amountIn string, amountOutMin string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amounts []string, swapRecordIds []uint, err error) {
+	err = validatePath(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "validatePath")
+	}
+	_amountOutMin, success := new(big.Int).SetString(amountOutMin, 10)
+	if !success {
+		return nil, nil, errors.New("amountOutMin SetString(" + amountOutMin + ") " + strconv.FormatBool(success))
+	}
+
+	amounts = make([]string, len(path))
+	swapRecordIds = make([]uint, len(path)-1)
+	amounts[0] = amountIn
+	for i := 0; i < len(path)-1; i++ {
+		var actualAmountIn string
+		actualAmountIn, err = pathBeforeSwapFeeByAmountIn(tx, path[i], path[i+1], amounts[i], username)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "pathBeforeSwapFeeByAmountIn")
+		}
+
+		hopAmountOutMin := "1"
+		if i == len(path)-2 {
+			hopAmountOutMin = amountOutMin
+		}
+		amounts[i+1], swapRecordIds[i], err = swapExactTokenForTokenNoPathLocked(tx, path[i], path[i+1], actualAmountIn, hopAmountOutMin, username, projectPartyFeeK, lpAwardFeeK)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "swapExactTokenForTokenNoPathLocked("+path[i]+","+path[i+1]+")")
+		}
+	}
+
+	_amountOut, success := new(big.Int).SetString(amounts[len(amounts)-1], 10)
+	if !success {
+		return nil, nil, errors.New("amountOut SetString(" + amounts[len(amounts)-1] + ") " + strconv.FormatBool(success))
+	}
+	if _amountOut.Cmp(_amountOutMin) < 0 {
+		return nil, nil, errors.New("insufficientAmountOut(" + _amountOut.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
+	}
+	return amounts, swapRecordIds, nil
+}
+
+// planSwapTokensForExactTokens works backwards from amountOut with the same calc functions the single hop swap uses,
+// so every planned hop output is exactly what the next hop needs as input.
+func planSwapTokensForExactTokens(tx *gorm.DB, path []string, amountOut string, amountInMax string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amounts []string, swapRecords []*PoolSwapRecord, err error) {
+	amounts = make([]string, len(path))
+	swapRecords = make([]*PoolSwapRecord, len(path)-1)
+	amounts[len(path)-1] = amountOut
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i] == TokenSatTag {
+			var pairId uint
+			pairId, err = QueryPairId(tx, path[i-1], path[i])
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "QueryPairId")
+			}
+			var count int64
+			err = tx.Model(&PoolBeforeSwapFee{}).Where("pair_id = ?", pairId).Count(&count).Error
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "count PoolBeforeSwapFee")
+			}
+			if count > 0 {
+				return nil, nil, errors.New("pair(" + strconv.FormatUint(uint64(pairId), 10) + ") with before swap fee does not support exact out path")
+			}
+		}
+
+		hopAmountInMax := pathAmountInUnbounded.String()
+		if i == 1 {
+			hopAmountInMax = amountInMax
+		}
+		amounts[i-1], swapRecords[i-1], err = calcSwapTokenForExactTokenNoPath(tx, path[i-1], path[i], amounts[i], hopAmountInMax, username, projectPartyFeeK, lpAwardFeeK)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "calcSwapTokenForExactTokenNoPath("+path[i-1]+","+path[i]+")")
+		}
+	}
+	return amounts, swapRecords, nil
+}
+
+// swapTokensForExactTokens must be called with the LockP of every pair on the path held, see lockPathPairs.
+func swapTokensForExactTokens(tx *gorm.DB, path []string, amountOut string, amountInMax string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amounts []string, err error) {
+	err = validatePath(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "validatePath")
+	}
+
+	planned, _, err := planSwapTokensForExactTokens(tx, path, amountOut, amountInMax, username, projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return nil, errors.Wrap(err, "planSwapTokensForExactTokens")
+	}
+
+	amounts = make([]string, len(path))
+	amounts[len(path)-1] = amountOut
+	hopAmountInMax := amountInMax
+	for i := 0; i < len(path)-1; i++ {
+		amounts[i], err = swapTokenForExactTokenNoPathLocked(tx, path[i], path[i+1], planned[i+1], hopAmountInMax, username, projectPartyFeeK, lpAwardFeeK)
+		if err != nil {
+			return nil, errors.Wrap(err, "swapTokenForExactTokenNoPathLocked("+path[i]+","+path[i+1]+")")
+		}
+		hopAmountInMax = planned[i+1]
+	}
+	return amounts, nil
+}
+
+func checkPathFeeK(projectPartyFeeK uint16, lpAwardFeeK uint16) (err error) {
+	if projectPartyFeeK > MaxSwapFeeK {
+		return errors.New("invalid project_party_fee_k(" + strconv.FormatUint(uint64(projectPartyFeeK), 10) + ")")
+	}
+	if lpAwardFeeK > MaxSwapFeeK {
+		return errors.New("invalid lp_award_fee_k(" + strconv.FormatUint(uint64(lpAwardFeeK), 10) + ")")
+	}
+	return nil
+}
+
+// SwapExactTokensForTokens swaps amountIn of path[0] into path[len(path)-1], executing every hop in one transaction.
+func SwapExactTokensForTokens(path []string, amountIn string, amountOutMin string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amounts []string, err error) {
+	if amountIn == "" {
+		return nil, errors.New("amount_in is empty")
+	}
+	if username == "" {
+		return nil, errors.New("username is empty")
+	}
+	err = checkPathFeeK(projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validatePath(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "validatePath")
+	}
+	defer func() {
+		if err == nil {
+			notifyLimitOrderMatcher()
+		}
+	}()
+	unlock, err := lockPathPairs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "lockPathPairs")
+	}
+	defer unlock()
+	tx := middleware.DB.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit().Error
+		}
+	}()
+
+	amounts, _, err = swapExactTokensForTokens(tx, path, amountIn, amountOutMin, username, projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return nil, errors.Wrap(err, "swapExactTokensForTokens")
+	}
+	return amounts, nil
+}
+
+// SwapTokensForExactTokens buys amountOut of path[len(path)-1] with at most amountInMax of path[0] in one transaction.
+func SwapTokensForExactTokens(path []string, amountOut string, amountInMax string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amounts []string, err error) {
+	if amountOut == "" {
+		return nil, errors.New("amount_out is empty")
+	}
+	if username == "" {
+		return nil, errors.New("username is empty")
+	}
+	err = checkPathFeeK(projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validatePath(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "validatePath")
+	}
+	defer func() {
+		if err == nil {
+			notifyLimitOrderMatcher()
+		}
+	}()
+	unlock, err := lockPathPairs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "lockPathPairs")
+	}
+	defer unlock()
+	tx := middleware.DB.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit().Error
+		}
+	}()
+
+	amounts, err = swapTokensForExactTokens(tx, path, amountOut, amountInMax, username, projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return nil, errors.Wrap(err, "swapTokensForExactTokens")
+	}
+	return amounts, nil
+}
+
+func pathSlippage(slippage uint16) uint16 {
+	slippage += 1000
+	if slippage > 10000 {
+		slippage = 10000
+	}
+	return slippage
+}
+
+func applySlippageToAmountOut(slippage uint16, amountOut string) (amountOutMin string, err error) {
+	_amountOut, success := new(big.Int).SetString(amountOut, 10)
+	if !success {
+		return ZeroValue, errors.New("amountOut SetString(" + amountOut + ") " + strconv.FormatBool(success))
+	}
+	tenThousand := big.NewInt(10000)
+	_amountOutMin := new(big.Int).Div(new(big.Int).Mul(_amountOut, new(big.Int).Sub(tenThousand, new(big.Int).SetUint64(uint64(slippage)))), tenThousand)
+	if _amountOutMin.Sign() <= 0 {
+		_amountOutMin = big.NewInt(1)
+	}
+	return _amountOutMin.String(), nil
+}
+
+func applySlippageToAmountIn(slippage uint16, amountIn string) (amountInMax string, err error) {
+	_amountIn, success := new(big.Int).SetString(amountIn, 10)
+	if !success {
+		return ZeroValue, errors.New("amountIn SetString(" + amountIn + ") " + strconv.FormatBool(success))
+	}
+	tenThousand := big.NewInt(10000)
+	_amountInMax := CeilDiv(new(big.Int).Mul(_amountIn, new(big.Int).Add(tenThousand, new(big.Int).SetUint64(uint64(slippage)))), tenThousand)
+	return _amountInMax.String(), nil
+}
+
+func ProcessSwapExactTokensForTokensRequest(request *PoolSwapExactTokensForTokensRequest) (result *SwapExactTokensForTokensResult, err error) {
+	if request == nil {
+		return new(SwapExactTokensForTokensResult), errors.New("request is nil")
+	}
+	err = validatePath(request.Path)
+	if err != nil {
+		return new(SwapExactTokensForTokensResult), errors.Wrap(err, "validatePath")
+	}
+	amountOutMin := request.AmountOutMin
+	if amountOutMin == "" {
+		_, quoted, err := CalcSwapExactTokensForTokens(request)
+		if err != nil {
+			return new(SwapExactTokensForTokensResult), errors.Wrap(err, "CalcSwapExactTokensForTokens")
+		}
+		amountOutMin, err = applySlippageToAmountOut(pathSlippage(request.Slippage), quoted[len(quoted)-1])
+		if err != nil {
+			return new(SwapExactTokensForTokensResult), errors.Wrap(err, "applySlippageToAmountOut")
+		}
+	}
+	amounts, err := SwapExactTokensForTokens(request.Path, request.AmountIn, amountOutMin, request.Username, request.ProjectPartyFeeK, request.LpAwardFeeK)
+	if err != nil {
+		return new(SwapExactTokensForTokensResult), errors.Wrap(err, "SwapExactTokensForTokens")
+	}
+	return &SwapExactTokensForTokensResult{
+		Path:      request.Path,
+		Amounts:   amounts,
+		AmountOut: amounts[len(amounts)-1],
+	}, nil
+}
+
+func ProcessSwapTokensForExactTokensRequest(request *PoolSwapTokensForExactTokensRequest) (result *SwapTokensForExactTokensResult, err error) {
+	if request == nil {
+		return new(SwapTokensForExactTokensResult), errors.New("request is nil")
+	}
+	err = validatePath(request.Path)
+	if err != nil {
+		return new(SwapTokensForExactTokensResult), errors.Wrap(err, "validatePath")
+	}
+	amountInMax := request.AmountInMax
+	if amountInMax == "" {
+		_, quoted, err := CalcSwapTokensForExactTokens(request)
+		if err != nil {
+			return new(SwapTokensForExactTokensResult), errors.Wrap(err, "CalcSwapTokensForExactTokens")
+		}
+		amountInMax, err = applySlippageToAmountIn(pathSlippage(request.Slippage), quoted[0])
+		if err != nil {
+			return new(SwapTokensForExactTokensResult), errors.Wrap(err, "applySlippageToAmountIn")
+		}
+	}
+	amounts, err := SwapTokensForExactTokens(request.Path, request.AmountOut, amountInMax, request.Username, request.ProjectPartyFeeK, request.LpAwardFeeK)
+	if err != nil {
+		return new(SwapTokensForExactTokensResult), errors.Wrap(err, "SwapTokensForExactTokens")
+	}
+	return &SwapTokensForExactTokensResult{
+		Path:     request.Path,
+		Amounts:  amounts,
+		AmountIn: amounts[0],
+	}, nil
+}
+
+// CalcSwapExactTokensForTokens dry runs every hop in a transaction which is always rolled back.
+func CalcSwapExactTokensForTokens(request *PoolSwapExactTokensForTokensRequest) (swapRecords []*PoolSwapRecord, amounts []string, err error) {
+	if request == nil {
+		return nil, nil, errors.New("request is nil")
+	}
+	path := request.Path
+	err = validatePath(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "validatePath")
+	}
+	if request.AmountIn == "" {
+		return nil, nil, errors.New("amount_in is empty")
+	}
+
+	tx := middleware.DB.Begin()
+	defer func() {
+		tx.Rollback()
+	}()
+
+	amounts = make([]string, len(path))
+	swapRecords = make([]*PoolSwapRecord, len(path)-1)
+	amounts[0] = request.AmountIn
+	for i := 0; i < len(path)-1; i++ {
+		var actualAmountIn string
+		actualAmountIn, err = pathBeforeSwapFeeByAmountIn(tx, path[i], path[i+1], amounts[i], request.Username)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "pathBeforeSwapFeeByAmountIn")
+		}
+		amounts[i+1], swapRecords[i], err = calcSwapExactTokenForTokenNoPath(tx, path[i], path[i+1], actualAmountIn, "1", request.Username, request.ProjectPartyFeeK, request.LpAwardFeeK)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "calcSwapExactTokenForTokenNoPath("+path[i]+","+path[i+1]+")")
+		}
+	}
+	return swapRecords, amounts, nil
+}
+
+func CalcSwapTokensForExactTokens(request *PoolSwapTokensForExactTokensRequest) (swapRecords []*PoolSwapRecord, amounts []string, err error) {
+	if request == nil {
+		return nil, nil, errors.New("request is nil")
+	}
+	err = validatePath(request.Path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "validatePath")
+	}
+	if request.AmountOut == "" {
+		return nil, nil, errors.New("amount_out is empty")
+	}
+	amountInMax := request.AmountInMax
+	if amountInMax == "" {
+		amountInMax = pathAmountInUnbounded.String()
+	}
+
+	tx := middleware.DB.Begin()
+	defer func() {
+		tx.Rollback()
+	}()
+
+	amounts, swapRecords, err = planSwapTokensForExactTokens(tx, request.Path, request.AmountOut, amountInMax, request.Username, request.ProjectPartyFeeK, request.LpAwardFeeK)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "planSwapTokensForExactTokens")
+	}
+	return swapRecords, amounts, nil
+}
+
+func SwapRecordsToSwapRecordInfos(swapRecords []*PoolSwapRecord) []*SwapRecordInfo {
+	infos := make([]*SwapRecordInfo, 0, len(swapRecords))
+	for _, swapRecord := range swapRecords {
+		if swapRecord == nil {
+			continue
+		}
+		infos = append(infos, swapRecord.ToSwapRecordInfo())
+	}
+	return infos
+}
@@ -0,0 +1,114 @@
+package pool
+
+import (
+	"math/big"
+	"testing"
+	"trade/middleware"
+)
+
+func swapExactOut(tokenIn string, tokenOut string, amountOut string, amountInMax string, username string) (amountIn string, err error) {
+	tx := middleware.DB.Begin()
+	amountIn, err = swapTokenForExactTokenNoPath(tx, tokenIn, tokenOut, amountOut, amountInMax, username, ProjectPartyFeeK, LpAwardFeeK)
+	if err != nil {
+		tx.Rollback()
+		return amountIn, err
+	}
+	return amountIn, tx.Commit().Error
+}
+
+// TestPathQuoteMatchesSwap checks the path graph quotes the amounts the single hop swaps execute, through the
+// minimum sat fee and the half fee of nft presale buyers.
+func TestPathQuoteMatchesSwap(t *testing.T) {
+	setupPoolTest(t)
+	if err := middleware.DB.AutoMigrate(&PoolBeforeSwapFee{}); err != nil {
+		t.Fatal(err)
+	}
+	fundUser(t, "alice", 10_000_000, 40_000_000)
+	fundUser(t, "bob", 10_000_000, 40_000_000)
+	fundUser(t, "carol", 10_000_000, 40_000_000)
+	if err := middleware.DB.Exec("INSERT INTO nft_presales (buyer_username) VALUES ('carol')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := addLiquidity(TokenSatTag, testAssetId, "1000000", "4000000", "0", "0", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		exactIn  bool
+		tokenIn  string
+		tokenOut string
+		amount   string
+	}{
+		{"sat in minimum fee", "bob", true, TokenSatTag, testAssetId, "1000"},
+		{"sat in", "bob", true, TokenSatTag, testAssetId, "100000"},
+		{"sat in nft buyer", "carol", true, TokenSatTag, testAssetId, "100000"},
+		{"sat out minimum fee", "bob", true, testAssetId, TokenSatTag, "4000"},
+		{"sat out", "bob", true, testAssetId, TokenSatTag, "400000"},
+		{"sat out nft buyer", "carol", true, testAssetId, TokenSatTag, "400000"},
+		{"exact sat out minimum fee", "bob", false, testAssetId, TokenSatTag, "1000"},
+		{"exact sat out", "bob", false, testAssetId, TokenSatTag, "100000"},
+		{"exact sat out nft buyer", "carol", false, testAssetId, TokenSatTag, "100000"},
+		{"exact sat in minimum fee", "bob", false, TokenSatTag, testAssetId, "4000"},
+		{"exact sat in", "bob", false, TokenSatTag, testAssetId, "400000"},
+		{"exact sat in nft buyer", "carol", false, TokenSatTag, testAssetId, "400000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph, err := loadPathGraph(middleware.DB, tt.username)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := []string{tt.tokenIn, tt.tokenOut}
+			var quoted []*big.Int
+			var got string
+			if tt.exactIn {
+				quoted, err = graph.getAmountsOutBig(path, bigInt(t, tt.amount))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err = swapExactIn(tt.tokenIn, tt.tokenOut, tt.amount, "1", tt.username)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != quoted[1].String() {
+					t.Fatalf("swap out %s, quoted %s", got, quoted[1])
+				}
+			} else {
+				quoted, err = graph.getAmountsInBig(path, bigInt(t, tt.amount))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err = swapExactOut(tt.tokenIn, tt.tokenOut, tt.amount, pathAmountInUnbounded.String(), tt.username)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != quoted[0].String() {
+					t.Fatalf("swap in %s, quoted %s", got, quoted[0])
+				}
+			}
+			checkReservesMatchLedger(t)
+		})
+	}
+}
+
+func TestLockPathPairs(t *testing.T) {
+	unlock, err := lockPathPairs([]string{testAssetId, TokenSatTag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pairMutex(TokenSatTag, testAssetId).TryLock() {
+		t.Fatal("pair lock is free while the path holds it")
+	}
+	unlock()
+	lock := pairMutex(TokenSatTag, testAssetId)
+	if !lock.TryLock() {
+		t.Fatal("pair lock is held after unlock")
+	}
+	lock.Unlock()
+
+	if _, err = lockPathPairs([]string{TokenSatTag, TokenSatTag}); err == nil {
+		t.Fatal("path with an identical pair, want error")
+	}
+}
@@ -13,6 +13,25 @@ import (
 
 var LockP map[string]map[string]*sync.Mutex
 
+// lockPMutex guards the LockP map, the pair mutexes themselves are taken without it.
+var lockPMutex sync.Mutex
+
+// pairMutex returns the LockP mutex of the sorted pair, creating it on first use.
+func pairMutex(token0 string, token1 string) *sync.Mutex {
+	lockPMutex.Lock()
+	defer lockPMutex.Unlock()
+	if LockP == nil {
+		LockP = make(map[string]map[string]*sync.Mutex)
+	}
+	if LockP[token0] == nil {
+		LockP[token0] = make(map[string]*sync.Mutex)
+	}
+	if LockP[token0][token1] == nil {
+		LockP[token0][token1] = new(sync.Mutex)
+	}
+	return LockP[token0][token1]
+}
+
 func addLiquidity(tokenA string, tokenB string, amountADesired string, amountBDesired string, amountAMin string, amountBMin string, username string) (amountA string, amountB string, liquidity string, err error) {
 
 	token0, token1, err := sortTokens(tokenA, tokenB)
@@ -63,18 +82,10 @@ func addLiquidity(tokenA string, tokenB string, amountADesired string, amountBDe
 		return ZeroValue, ZeroValue, ZeroValue, errors.New("amount1Min(" + _amount1Min.String() + ") is greater than amount1Desired(" + _amount1Desired.String() + ")")
 	}
 
-	if LockP == nil {
-		LockP = make(map[string]map[string]*sync.Mutex)
-	}
-	if LockP[token0] == nil {
-		LockP[token0] = make(map[string]*sync.Mutex)
-	}
-	if LockP[token0][token1] == nil {
-		LockP[token0][token1] = new(sync.Mutex)
-	}
-	LockP[token0][token1].Lock()
+	pairLock := pairMutex(token0, token1)
+	pairLock.Lock()
 
-	defer LockP[token0][token1].Unlock()
+	defer pairLock.Unlock()
 
 	tx := middleware.DB.Begin()
 
@@ -100,10 +111,15 @@ func addLiquidity(tokenA string, tokenB string, amountADesired string, amountBDe
 		if err != nil {
 			return ZeroValue, ZeroValue, ZeroValue, errors.Wrap(err, "newPairBig")
 		}
+		newPair.PriceTimestampLast = time.Now().Unix()
 		err = tx.Model(&PoolPair{}).Create(&newPair).Error
 		if err != nil {
 			return ZeroValue, ZeroValue, ZeroValue, errors.Wrap(err, "create pair")
 		}
+		err = initPairPriceOracle(tx, newPair)
+		if err != nil {
+			return ZeroValue, ZeroValue, ZeroValue, errors.Wrap(err, "initPairPriceOracle")
+		}
 
 		pairId = newPair.ID
 
@@ -162,11 +178,7 @@ func addLiquidity(tokenA string, tokenB string, amountADesired string, amountBDe
 		if _newReserve1.Cmp(_reserve1) < 0 {
 			return ZeroValue, ZeroValue, ZeroValue, errors.New("invalid _newReserve1(" + _newReserve1.String() + ")")
 		}
-		err = tx.Model(&PoolPair{}).Where("token0 = ? AND token1 = ?", token0, token1).
-			Updates(map[string]any{
-				"reserve0": _newReserve0.String(),
-				"reserve1": _newReserve1.String(),
-			}).Error
+		err = updatePairReserves(tx, &_pair, _newReserve0, _newReserve1)
 		if err != nil {
 			return ZeroValue, ZeroValue, ZeroValue, errors.Wrap(err, "update pair")
 		}
@@ -258,6 +270,12 @@ func removeLiquidity(tokenA string, tokenB string, liquidity string, amountAMin
 		return ZeroValue, ZeroValue, errors.Wrap(err, "sortTokens")
 	}
 
+	fee, err := effectiveRemoveLiquidityFee(middleware.DB, tokenA, tokenB, feeK)
+	if err != nil {
+		return ZeroValue, ZeroValue, errors.Wrap(err, "effectiveRemoveLiquidityFee")
+	}
+	feeK = fee.RemoveLiquidityFeeK
+
 	isTokenZeroSat := token0 == TokenSatTag
 
 	var amount0Min, amount1Min string
@@ -290,18 +308,10 @@ func removeLiquidity(tokenA string, tokenB string, liquidity string, amountAMin
 		return ZeroValue, ZeroValue, errors.New("amount1Min(" + _amount1Min.String() + ") is negative")
 	}
 
-	if LockP == nil {
-		LockP = make(map[string]map[string]*sync.Mutex)
-	}
-	if LockP[token0] == nil {
-		LockP[token0] = make(map[string]*sync.Mutex)
-	}
-	if LockP[token0][token1] == nil {
-		LockP[token0][token1] = new(sync.Mutex)
-	}
-	LockP[token0][token1].Lock()
+	pairLock := pairMutex(token0, token1)
+	pairLock.Lock()
 
-	defer LockP[token0][token1].Unlock()
+	defer pairLock.Unlock()
 
 	tx := middleware.DB.Begin()
 
@@ -445,11 +455,7 @@ func removeLiquidity(tokenA string, tokenB string, liquidity string, amountAMin
 		return ZeroValue, ZeroValue, errors.New("invalid _newReserve1(" + _newReserve1.String() + ")")
 	}
 
-	err = tx.Model(&PoolPair{}).Where("token0 = ? AND token1 = ?", token0, token1).
-		Updates(map[string]any{
-			"reserve0": _newReserve0.String(),
-			"reserve1": _newReserve1.String(),
-		}).Error
+	err = updatePairReserves(tx, &_pair, _newReserve0, _newReserve1)
 	if err != nil {
 		return ZeroValue, ZeroValue, errors.Wrap(err, "update pair")
 	}
@@ -476,58 +482,64 @@ func removeLiquidity(tokenA string, tokenB string, liquidity string, amountAMin
 	return amountA, amountB, err
 }
 
+// swapExactTokenForTokenNoPath holds the pair's LockP for the swap. The lock is released when it returns, callers
+// swapping several hops in one transaction take the locks with lockPathPairs and call swapExactTokenForTokenNoPathLocked.
 func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string, amountIn string, amountOutMin string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amountOut string, err error) {
-	feeK := projectPartyFeeK + lpAwardFeeK
+	unlock, err := lockPathPairs([]string{tokenIn, tokenOut})
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "lockPathPairs")
+	}
+	defer unlock()
+	amountOut, _, err = swapExactTokenForTokenNoPathLocked(tx, tokenIn, tokenOut, amountIn, amountOutMin, username, projectPartyFeeK, lpAwardFeeK)
+	return amountOut, err
+}
+
+// swapExactTokenForTokenNoPathLocked must be called with the pair's LockP held. It returns the id of the swap record.
+func swapExactTokenForTokenNoPathLocked(tx *gorm.DB, tokenIn string, tokenOut string, amountIn string, amountOutMin string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amountOut string, recordId uint, err error) {
+	fee, err := effectiveSwapFee(tx, tokenIn, tokenOut, projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return ZeroValue, 0, errors.Wrap(err, "effectiveSwapFee")
+	}
+	projectPartyFeeK, lpAwardFeeK = fee.ProjectPartyFeeK, fee.LpAwardFeeK
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
-		return ZeroValue, errors.Wrap(err, "sortTokens")
+		return ZeroValue, 0, errors.Wrap(err, "sortTokens")
 	}
 
 	isTokenZeroSat := token0 == TokenSatTag
 
 	_amountIn, success := new(big.Int).SetString(amountIn, 10)
 	if !success {
-		return ZeroValue, errors.New("amountIn SetString(" + amountIn + ") " + strconv.FormatBool(success))
+		return ZeroValue, 0, errors.New("amountIn SetString(" + amountIn + ") " + strconv.FormatBool(success))
 	}
 
 	_amountOutMin, success := new(big.Int).SetString(amountOutMin, 10)
 	if !success {
-		return ZeroValue, errors.New("amountOutMin SetString(" + amountOutMin + ") " + strconv.FormatBool(success))
+		return ZeroValue, 0, errors.New("amountOutMin SetString(" + amountOutMin + ") " + strconv.FormatBool(success))
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenIn == TokenSatTag {
 			if _amountIn.Cmp(_minSwapSat) <= 0 {
-				return ZeroValue, errors.New("insufficient _amountIn(" + _amountIn.String() + "), need " + _minSwapSat.String())
+				return ZeroValue, 0, errors.New("insufficient _amountIn(" + _amountIn.String() + "), need " + _minSwapSat.String())
 			}
 		} else if tokenOut == TokenSatTag {
 			if _amountOutMin.Cmp(_minSwapSat) <= 0 {
 
-				_amountOutMin = big.NewInt(int64(MinSwapSatFee + 1))
+				_amountOutMin = big.NewInt(int64(minSwapSatFee + 1))
 			}
 		}
 	}
 
-	if LockP == nil {
-		LockP = make(map[string]map[string]*sync.Mutex)
-	}
-	if LockP[token0] == nil {
-		LockP[token0] = make(map[string]*sync.Mutex)
-	}
-	if LockP[token0][token1] == nil {
-		LockP[token0][token1] = new(sync.Mutex)
-	}
-	LockP[token0][token1].Lock()
-
-	defer LockP[token0][token1].Unlock()
-
 	var _pair PoolPair
 	err = tx.Model(&PoolPair{}).Where("token0 = ? AND token1 = ?", token0, token1).First(&_pair).Error
 	if err != nil {
 
-		return ZeroValue, errors.Wrap(err, "pair does not exist")
+		return ZeroValue, 0, errors.Wrap(err, "pair does not exist")
 	}
 	pairId := _pair.ID
 
@@ -535,12 +547,12 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 	_reserve0, success = new(big.Int).SetString(_pair.Reserve0, 10)
 	if !success {
-		return ZeroValue, errors.New("Reserve0 SetString(" + _pair.Reserve0 + ") " + strconv.FormatBool(success))
+		return ZeroValue, 0, errors.New("Reserve0 SetString(" + _pair.Reserve0 + ") " + strconv.FormatBool(success))
 	}
 
 	_reserve1, success = new(big.Int).SetString(_pair.Reserve1, 10)
 	if !success {
-		return ZeroValue, errors.New("Reserve1 SetString(" + _pair.Reserve1 + ") " + strconv.FormatBool(success))
+		return ZeroValue, 0, errors.New("Reserve1 SetString(" + _pair.Reserve1 + ") " + strconv.FormatBool(success))
 	}
 
 	var _reserveIn, _reserveOut = new(big.Int), new(big.Int)
@@ -562,7 +574,7 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 		err = CreatePoolAccount(tx, pairId, PoolTypeFee, []string{token0, token1})
 		if err != nil {
-			return ZeroValue, errors.Wrap(err, "CreatePoolAccount("+strconv.FormatUint(uint64(pairId), 10)+",PoolTypeFee)")
+			return ZeroValue, 0, errors.Wrap(err, "CreatePoolAccount("+strconv.FormatUint(uint64(pairId), 10)+",PoolTypeFee)")
 		}
 	}
 
@@ -583,21 +595,21 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 			_amountOutWithFee, err = getAmountOutBig(_amountIn, _reserveIn, _reserveOut, feeK)
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "getAmountOutBig")
+				return ZeroValue, 0, errors.Wrap(err, "getAmountOutBig")
 			}
 			if _amountOutWithFee.Cmp(_amountOutMin) < 0 {
-				return ZeroValue, errors.New("insufficientAmountOutWithFee(" + _amountOutWithFee.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
+				return ZeroValue, 0, errors.New("insufficientAmountOutWithFee(" + _amountOutWithFee.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
 			}
 
 			_amountOutWithoutFee, err = getAmountOutBigWithoutFee(_amountIn, _reserveIn, _reserveOut)
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "getAmountOutBigWithoutFee")
+				return ZeroValue, 0, errors.Wrap(err, "getAmountOutBigWithoutFee")
 			}
 			if _amountOutWithoutFee.Cmp(_amountOutMin) < 0 {
-				return ZeroValue, errors.New("insufficientAmountOutWithoutFee(" + _amountOutWithoutFee.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
+				return ZeroValue, 0, errors.New("insufficientAmountOutWithoutFee(" + _amountOutWithoutFee.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
 			}
 
-			_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 			if new(big.Int).Sub(_amountOutWithoutFee, _amountOutWithFee).Cmp(_minSwapSat) < 0 {
 
 				_amountOut = new(big.Int).Sub(_amountOutWithoutFee, _minSwapSat)
@@ -638,43 +650,43 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 			*_amountOutTransfer = *_amountOut
 
 			if _amountInExcludeFee.Sign() < 0 {
-				return ZeroValue, errors.New("invalid _amountInExcludeFee(" + _amountInExcludeFee.String() + ")")
+				return ZeroValue, 0, errors.New("invalid _amountInExcludeFee(" + _amountInExcludeFee.String() + ")")
 			}
 
 			if _amountOut.Cmp(_amountOutMin) < 0 {
-				return ZeroValue, errors.New("insufficientAmountOut(" + _amountOut.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
+				return ZeroValue, 0, errors.New("insufficientAmountOut(" + _amountOut.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
 			}
 
 			tokenInTransferRecordId, err = TransferToPoolAccount(tx, username, pairId, PoolTypeDefault, tokenIn, _amountInTransfer, "swapExactTokenForTokenNoPath")
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "TransferToPoolAccount")
+				return ZeroValue, 0, errors.Wrap(err, "TransferToPoolAccount")
 			}
 
 			swapFeeFromPool = true
 			feeTransferRecordId, err = PoolToPoolPTransfer(tx, pairId, PoolTypeDefault, pairId, PoolTypeFee, TokenSatTag, _swapFee, "swapExactTokenForTokenNoPath")
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "PoolToPoolPTransfer")
+				return ZeroValue, 0, errors.Wrap(err, "PoolToPoolPTransfer")
 			}
 
 			_, err = createOrUpdatePoolAccountFeeBalance(tx, pairId, _swapFee, false)
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "createOrUpdatePoolAccountFeeBalance")
+				return ZeroValue, 0, errors.Wrap(err, "createOrUpdatePoolAccountFeeBalance")
 			}
 
 			tokenOutTransferRecordId, err = PoolAccountTransfer(tx, pairId, PoolTypeDefault, username, tokenOut, _amountOutTransfer, "swapExactTokenForTokenNoPath")
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "PoolAccountTransfer")
+				return ZeroValue, 0, errors.Wrap(err, "PoolAccountTransfer")
 			}
 
 		} else {
 			_amountOut, err = getAmountOutBig(_amountIn, _reserveIn, _reserveOut, feeK)
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "getAmountOutBig")
+				return ZeroValue, 0, errors.Wrap(err, "getAmountOutBig")
 			}
 
 			swapFeeType = SwapFee6ThousandsNotSat
 
-			return ZeroValue, errors.New("non-sat swap not implemented yet")
+			return ZeroValue, 0, errors.New("non-sat swap not implemented yet")
 
 		}
 
@@ -683,7 +695,7 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 		*_reserveIn, *_reserveOut = *_reserve0, *_reserve1
 
 		if isTokenZeroSat {
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			_amountInExcludeFee, _amountInFee = amountFee(_amountIn, feeK)
 
@@ -691,7 +703,7 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 				_amountOut, err = getAmountOutBigWithoutFee(new(big.Int).Sub(_amountIn, _minSwapSatFee), _reserveIn, _reserveOut)
 				if err != nil {
-					return ZeroValue, errors.Wrap(err, "getAmountOutBigWithoutFee")
+					return ZeroValue, 0, errors.Wrap(err, "getAmountOutBigWithoutFee")
 				}
 
 				swapFeeType = SwapFee20Sat
@@ -705,7 +717,7 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 				*_amountOutTransfer = *_amountOut
 
 			} else {
-				_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+				_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 				swapFeeType = SwapFee6Thousands
 
 				*_swapFee = *_amountInFee
@@ -728,7 +740,7 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 				_amountOut, err = getAmountOutBig(_amountIn, _reserveIn, _reserveOut, feeK)
 				if err != nil {
-					return ZeroValue, errors.Wrap(err, "getAmountOutBig")
+					return ZeroValue, 0, errors.Wrap(err, "getAmountOutBig")
 				}
 
 				*_calcPriceAmountIn = *_amountInExcludeFee
@@ -740,41 +752,41 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 			}
 
 			if _amountInExcludeFee.Sign() < 0 {
-				return ZeroValue, errors.New("invalid _amountInExcludeFee(" + _amountInExcludeFee.String() + ")")
+				return ZeroValue, 0, errors.New("invalid _amountInExcludeFee(" + _amountInExcludeFee.String() + ")")
 			}
 
 			if _amountOut.Cmp(_amountOutMin) < 0 {
-				return ZeroValue, errors.New("insufficientAmountOut(" + _amountOut.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
+				return ZeroValue, 0, errors.New("insufficientAmountOut(" + _amountOut.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
 			}
 
 			tokenInTransferRecordId, err = TransferToPoolAccount(tx, username, pairId, PoolTypeDefault, tokenIn, _amountInTransfer, "swapExactTokenForTokenNoPath")
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "TransferToPoolAccount")
+				return ZeroValue, 0, errors.Wrap(err, "TransferToPoolAccount")
 			}
 
 			feeTransferRecordId, err = TransferToPoolAccount(tx, username, pairId, PoolTypeFee, tokenIn, _swapFee, "swapExactTokenForTokenNoPath")
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "TransferToPoolAccount")
+				return ZeroValue, 0, errors.Wrap(err, "TransferToPoolAccount")
 			}
 
 			_, err = createOrUpdatePoolAccountFeeBalance(tx, pairId, _swapFee, false)
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "createOrUpdatePoolAccountFeeBalance")
+				return ZeroValue, 0, errors.Wrap(err, "createOrUpdatePoolAccountFeeBalance")
 			}
 
 			tokenOutTransferRecordId, err = PoolAccountTransfer(tx, pairId, PoolTypeDefault, username, tokenOut, _amountOutTransfer, "swapExactTokenForTokenNoPath")
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "PoolAccountTransfer")
+				return ZeroValue, 0, errors.Wrap(err, "PoolAccountTransfer")
 			}
 
 		} else {
 			_amountOut, err = getAmountOutBig(_amountIn, _reserveIn, _reserveOut, feeK)
 			if err != nil {
-				return ZeroValue, errors.Wrap(err, "getAmountOutBig")
+				return ZeroValue, 0, errors.Wrap(err, "getAmountOutBig")
 			}
 			swapFeeType = SwapFee6ThousandsNotSat
 
-			return ZeroValue, errors.New("non-sat swap not implemented yet")
+			return ZeroValue, 0, errors.New("non-sat swap not implemented yet")
 
 		}
 
@@ -792,40 +804,34 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 		_newReserve1 = new(big.Int).Sub(_reserve1, _amountOutTransfer)
 	}
 	if _newReserve0.Sign() <= 0 {
-		return ZeroValue, errors.New("invalid _newReserve0(" + _newReserve0.String() + ")")
+		return ZeroValue, 0, errors.New("invalid _newReserve0(" + _newReserve0.String() + ")")
 	}
 	if _newReserve1.Sign() <= 0 {
-		return ZeroValue, errors.New("invalid _newReserve1(" + _newReserve1.String() + ")")
+		return ZeroValue, 0, errors.New("invalid _newReserve1(" + _newReserve1.String() + ")")
 	}
 
-	err = tx.Model(&PoolPair{}).Where("token0 = ? AND token1 = ?", token0, token1).
-		Updates(map[string]any{
-			"reserve0": _newReserve0.String(),
-			"reserve1": _newReserve1.String(),
-		}).Error
+	err = updatePairReserves(tx, &_pair, _newReserve0, _newReserve1)
 	if err != nil {
-		return ZeroValue, errors.Wrap(err, "update pair")
+		return ZeroValue, 0, errors.Wrap(err, "update pair")
 	}
 
-	var recordId uint
-
-	recordId, err = createSwapRecord(tx, pairId, username, tokenIn, tokenOut, amountIn, _amountOut.String(), _reserveIn.String(), _reserveOut.String(), tokenInTransferRecordId, feeTransferRecordId, tokenOutTransferRecordId, _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapExactTokenNoPath)
+	recordId, err = createSwapRecord(tx, pairId, username, tokenIn, tokenOut, amountIn, _amountOut.String(), _reserveIn.String(), _reserveOut.String(), tokenInTransferRecordId, feeTransferRecordId, tokenOutTransferRecordId, _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapExactTokenNoPath, fee)
 	if err != nil {
-		return ZeroValue, errors.Wrap(err, "createSwapRecord")
+		return ZeroValue, 0, errors.Wrap(err, "createSwapRecord")
 	}
 
 	var share PoolShare
 	var shareId uint
 	err = tx.Model(&PoolShare{}).Where("pair_id = ?", pairId).First(&share).Error
 	if err != nil {
-		return ZeroValue, errors.Wrap(err, "share does not exist")
+		return ZeroValue, 0, errors.Wrap(err, "share does not exist")
 	}
 	shareId = share.ID
 	totalSupply := share.TotalSupply
 
 	_totalSupplyFloat, success := new(big.Float).SetString(totalSupply)
 	if !success {
-		return ZeroValue, errors.New("TotalSupply SetString(" + totalSupply + ") " + strconv.FormatBool(success))
+		return ZeroValue, 0, errors.New("TotalSupply SetString(" + totalSupply + ") " + strconv.FormatBool(success))
 	}
 
 	type userAndShare struct {
@@ -841,7 +847,7 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 		Scan(&userAndShares).Error
 
 	if err != nil {
-		return ZeroValue, errors.Wrap(err, "get userAndShares")
+		return ZeroValue, 0, errors.Wrap(err, "get userAndShares")
 	}
 
 	for _, _userAndShare := range userAndShares {
@@ -858,30 +864,50 @@ func swapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 		_balanceFloat, success := new(big.Float).SetString(_userAndShare.Balance)
 		if !success {
-			return ZeroValue, errors.New(_userAndShare.Username + " balance SetString(" + _userAndShare.Balance + ") " + strconv.FormatBool(success))
+			return ZeroValue, 0, errors.New(_userAndShare.Username + " balance SetString(" + _userAndShare.Balance + ") " + strconv.FormatBool(success))
 		}
 
 		var _awardFloat = big.NewFloat(0)
 
 		LpAwardFeeKFloat := new(big.Float).SetUint64(uint64(lpAwardFeeK))
 		SwapFeeKFloat := new(big.Float).SetUint64(uint64(feeK))
-		_swapFeeForAwardFloat := new(big.Float).Quo(new(big.Float).Mul(_swapFeeFloat, LpAwardFeeKFloat), SwapFeeKFloat)
+		_swapFeeForAwardFloat := big.NewFloat(0)
+		if feeK > 0 {
+			_swapFeeForAwardFloat = new(big.Float).Quo(new(big.Float).Mul(_swapFeeFloat, LpAwardFeeKFloat), SwapFeeKFloat)
+		}
 
 		_awardFloat = new(big.Float).Quo(new(big.Float).Mul(_swapFeeForAwardFloat, _balanceFloat), _totalSupplyFloat)
 		err = updateLpAwardBalanceAndRecordSwap(tx, shareId, _userAndShare.Username, _awardFloat, _swapFeeFloat.String(), _userAndShare.Balance, _totalSupplyFloat.String(), recordId)
 
 		if err != nil {
-			return ZeroValue, errors.Wrap(err, "updateLpAwardBalanceAndRecordSwap")
+			return ZeroValue, 0, errors.Wrap(err, "updateLpAwardBalanceAndRecordSwap")
 		}
 	}
 
 	amountOut = _amountOut.String()
 	err = nil
-	return amountOut, err
+	return amountOut, recordId, err
 }
 
+// swapTokenForExactTokenNoPath holds the pair's LockP for the swap, see swapExactTokenForTokenNoPath.
 func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string, amountOut string, amountInMax string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amountIn string, err error) {
-	feeK := projectPartyFeeK + lpAwardFeeK
+	unlock, err := lockPathPairs([]string{tokenIn, tokenOut})
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "lockPathPairs")
+	}
+	defer unlock()
+	return swapTokenForExactTokenNoPathLocked(tx, tokenIn, tokenOut, amountOut, amountInMax, username, projectPartyFeeK, lpAwardFeeK)
+}
+
+// swapTokenForExactTokenNoPathLocked must be called with the pair's LockP held.
+func swapTokenForExactTokenNoPathLocked(tx *gorm.DB, tokenIn string, tokenOut string, amountOut string, amountInMax string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amountIn string, err error) {
+	fee, err := effectiveSwapFee(tx, tokenIn, tokenOut, projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "effectiveSwapFee")
+	}
+	projectPartyFeeK, lpAwardFeeK = fee.ProjectPartyFeeK, fee.LpAwardFeeK
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
@@ -901,7 +927,7 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenOut == TokenSatTag {
 			if _amountOut.Cmp(_minSwapSat) <= 0 {
 				return ZeroValue, errors.New("insufficient _amountOut(" + _amountOut.String() + "), need " + _minSwapSat.String())
@@ -913,19 +939,6 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 		}
 	}
 
-	if LockP == nil {
-		LockP = make(map[string]map[string]*sync.Mutex)
-	}
-	if LockP[token0] == nil {
-		LockP[token0] = make(map[string]*sync.Mutex)
-	}
-	if LockP[token0][token1] == nil {
-		LockP[token0][token1] = new(sync.Mutex)
-	}
-	LockP[token0][token1].Lock()
-
-	defer LockP[token0][token1].Unlock()
-
 	var _pair PoolPair
 	err = tx.Model(&PoolPair{}).Where("token0 = ? AND token1 = ?", token0, token1).First(&_pair).Error
 	if err != nil {
@@ -986,7 +999,7 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 		if isTokenZeroSat {
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			_amountOutExcludeFee, _amountOutFee = amountFee(_amountOut, feeK)
 
@@ -1009,7 +1022,7 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 			} else {
 
-				_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+				_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 				swapFeeType = SwapFee6Thousands
 
 				*_swapFee = *_amountOutFee
@@ -1096,7 +1109,7 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 		if isTokenZeroSat {
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			var _amountInWithFee, _amountInWithoutFee *big.Int
 
@@ -1127,7 +1140,7 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 				*_amountOutExcludeFee = *_amountOut
 			} else {
 
-				_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+				_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 				_amountIn = _amountInWithFee
 				swapFeeType = SwapFee6Thousands
@@ -1218,17 +1231,13 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 		return ZeroValue, errors.New("invalid _newReserve1(" + _newReserve1.String() + ")")
 	}
 
-	err = tx.Model(&PoolPair{}).Where("token0 = ? AND token1 = ?", token0, token1).
-		Updates(map[string]any{
-			"reserve0": _newReserve0.String(),
-			"reserve1": _newReserve1.String(),
-		}).Error
+	err = updatePairReserves(tx, &_pair, _newReserve0, _newReserve1)
 	if err != nil {
 		return ZeroValue, errors.Wrap(err, "update pair")
 	}
 
 	var recordId uint
-	recordId, err = createSwapRecord(tx, pairId, username, tokenIn, tokenOut, _amountIn.String(), amountOut, _reserveIn.String(), _reserveOut.String(), tokenInTransferRecordId, feeTransferRecordId, tokenOutTransferRecordId, _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapForExactTokenNoPath)
+	recordId, err = createSwapRecord(tx, pairId, username, tokenIn, tokenOut, _amountIn.String(), amountOut, _reserveIn.String(), _reserveOut.String(), tokenInTransferRecordId, feeTransferRecordId, tokenOutTransferRecordId, _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapForExactTokenNoPath, fee)
 	if err != nil {
 		return ZeroValue, errors.Wrap(err, "createSwapRecord")
 	}
@@ -1284,7 +1293,10 @@ func swapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string,
 
 		LpAwardFeeKFloat := new(big.Float).SetUint64(uint64(lpAwardFeeK))
 		SwapFeeKFloat := new(big.Float).SetUint64(uint64(feeK))
-		_swapFeeForAwardFloat := new(big.Float).Quo(new(big.Float).Mul(_swapFeeFloat, LpAwardFeeKFloat), SwapFeeKFloat)
+		_swapFeeForAwardFloat := big.NewFloat(0)
+		if feeK > 0 {
+			_swapFeeForAwardFloat = new(big.Float).Quo(new(big.Float).Mul(_swapFeeFloat, LpAwardFeeKFloat), SwapFeeKFloat)
+		}
 
 		_awardFloat = new(big.Float).Quo(new(big.Float).Mul(_swapFeeForAwardFloat, _balanceFloat), _totalSupplyFloat)
 		err = updateLpAwardBalanceAndRecordSwap(tx, shareId, _userAndShare.Username, _awardFloat, _swapFeeFloat.String(), _userAndShare.Balance, _totalSupplyFloat.String(), recordId)
@@ -1450,7 +1462,7 @@ func RemoveLiquidity(request *PoolRemoveLiquidityRequest) (result *RemoveLiquidi
 		err = errors.New("username is empty")
 		return new(RemoveLiquidityResult), err
 	}
-	if request.FeeK != RemoveLiquidityFeeK {
+	if request.FeeK > MaxRemoveLiquidityFeeK {
 		err = errors.New("invalid fee_k(" + strconv.FormatUint(uint64(request.FeeK), 10) + ")")
 		return new(RemoveLiquidityResult), err
 	}
@@ -1560,11 +1572,11 @@ func SwapExactTokenForTokenNoPath(request *PoolSwapExactTokenForTokenNoPathReque
 		err = errors.New("username is empty")
 		return new(SwapExactTokenForTokenNoPathResult), err
 	}
-	if request.ProjectPartyFeeK != ProjectPartyFeeK {
+	if request.ProjectPartyFeeK > MaxSwapFeeK {
 		err = errors.New("invalid project_party_fee_k(" + strconv.FormatUint(uint64(request.ProjectPartyFeeK), 10) + ")")
 		return new(SwapExactTokenForTokenNoPathResult), err
 	}
-	if request.LpAwardFeeK != LpAwardFeeK {
+	if request.LpAwardFeeK > MaxSwapFeeK {
 		err = errors.New("invalid lp_award_fee_k(" + strconv.FormatUint(uint64(request.LpAwardFeeK), 10) + ")")
 		return new(SwapExactTokenForTokenNoPathResult), err
 	}
@@ -1585,6 +1597,11 @@ func SwapExactTokenForTokenNoPath(request *PoolSwapExactTokenForTokenNoPathReque
 
 	var beforeSwapFee, actualAmountIn string
 
+	defer func() {
+		if err == nil {
+			notifyLimitOrderMatcher()
+		}
+	}()
 	tx := middleware.DB.Begin()
 	defer func() {
 		if err != nil {
@@ -1736,11 +1753,11 @@ func SwapTokenForExactTokenNoPath(request *PoolSwapTokenForExactTokenNoPathReque
 		err = errors.New("username is empty")
 		return new(SwapTokenForExactTokenNoPathResult), err
 	}
-	if request.ProjectPartyFeeK != ProjectPartyFeeK {
+	if request.ProjectPartyFeeK > MaxSwapFeeK {
 		err = errors.New("invalid project_party_fee_k(" + strconv.FormatUint(uint64(request.ProjectPartyFeeK), 10) + ")")
 		return new(SwapTokenForExactTokenNoPathResult), err
 	}
-	if request.LpAwardFeeK != LpAwardFeeK {
+	if request.LpAwardFeeK > MaxSwapFeeK {
 		err = errors.New("invalid lp_award_fee_k(" + strconv.FormatUint(uint64(request.LpAwardFeeK), 10) + ")")
 		return new(SwapTokenForExactTokenNoPathResult), err
 	}
@@ -1761,6 +1778,11 @@ func SwapTokenForExactTokenNoPath(request *PoolSwapTokenForExactTokenNoPathReque
 
 	var beforeSwapFee, actualAmountOut string
 
+	defer func() {
+		if err == nil {
+			notifyLimitOrderMatcher()
+		}
+	}()
 	tx := middleware.DB.Begin()
 	defer func() {
 		if err != nil {
@@ -2003,6 +2025,12 @@ func calcRemoveLiquidity(tokenA string, tokenB string, liquidity string, amountA
 		return ZeroValue, ZeroValue, new(PoolShareRecord), errors.Wrap(err, "sortTokens")
 	}
 
+	fee, err := effectiveRemoveLiquidityFee(middleware.DB, tokenA, tokenB, feeK)
+	if err != nil {
+		return ZeroValue, ZeroValue, new(PoolShareRecord), errors.Wrap(err, "effectiveRemoveLiquidityFee")
+	}
+	feeK = fee.RemoveLiquidityFeeK
+
 	isTokenZeroSat := token0 == TokenSatTag
 
 	var amount0Min, amount1Min string
@@ -2144,7 +2172,13 @@ func calcRemoveLiquidity(tokenA string, tokenB string, liquidity string, amountA
 }
 
 func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string, amountIn string, amountOutMin string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amountOut string, swapRecord *PoolSwapRecord, err error) {
-	feeK := projectPartyFeeK + lpAwardFeeK
+	fee, err := effectiveSwapFee(tx, tokenIn, tokenOut, projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return ZeroValue, new(PoolSwapRecord), errors.Wrap(err, "effectiveSwapFee")
+	}
+	projectPartyFeeK, lpAwardFeeK = fee.ProjectPartyFeeK, fee.LpAwardFeeK
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
@@ -2164,7 +2198,7 @@ func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenIn == TokenSatTag {
 			if _amountIn.Cmp(_minSwapSat) <= 0 {
 				return ZeroValue, new(PoolSwapRecord), errors.New("insufficient _amountIn(" + _amountIn.String() + "), need " + _minSwapSat.String())
@@ -2172,7 +2206,7 @@ func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 		} else if tokenOut == TokenSatTag {
 			if _amountOutMin.Cmp(_minSwapSat) <= 0 {
 
-				_amountOutMin = big.NewInt(int64(MinSwapSatFee + 1))
+				_amountOutMin = big.NewInt(int64(minSwapSatFee + 1))
 			}
 		}
 	}
@@ -2249,7 +2283,7 @@ func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 				return ZeroValue, new(PoolSwapRecord), errors.New("insufficientAmountOutWithoutFee(" + _amountOutWithoutFee.String() + "), need amountOutMin(" + _amountOutMin.String() + ")")
 			}
 
-			_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 			if new(big.Int).Sub(_amountOutWithoutFee, _amountOutWithFee).Cmp(_minSwapSat) < 0 {
 
 				_amountOut = new(big.Int).Sub(_amountOutWithoutFee, _minSwapSat)
@@ -2316,7 +2350,7 @@ func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 		*_reserveIn, *_reserveOut = *_reserve0, *_reserve1
 
 		if isTokenZeroSat {
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			_amountInExcludeFee, _amountInFee = amountFee(_amountIn, feeK)
 
@@ -2338,7 +2372,7 @@ func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 				*_amountOutTransfer = *_amountOut
 
 			} else {
-				_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+				_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 				swapFeeType = SwapFee6Thousands
 
 				*_swapFee = *_amountInFee
@@ -2411,7 +2445,7 @@ func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 		return ZeroValue, new(PoolSwapRecord), errors.New("invalid _newReserve1(" + _newReserve1.String() + ")")
 	}
 
-	swapRecord, err = calcSwapRecord(pairId, username, tokenIn, tokenOut, amountIn, _amountOut.String(), _reserveIn.String(), _reserveOut.String(), _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapExactTokenNoPath)
+	swapRecord, err = calcSwapRecord(pairId, username, tokenIn, tokenOut, amountIn, _amountOut.String(), _reserveIn.String(), _reserveOut.String(), _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapExactTokenNoPath, fee)
 	if err != nil {
 		return ZeroValue, new(PoolSwapRecord), errors.Wrap(err, "calcSwapRecord")
 	}
@@ -2422,7 +2456,13 @@ func calcSwapExactTokenForTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 }
 
 func calcSwapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut string, amountOut string, amountInMax string, username string, projectPartyFeeK uint16, lpAwardFeeK uint16) (amountIn string, swapRecord *PoolSwapRecord, err error) {
-	feeK := projectPartyFeeK + lpAwardFeeK
+	fee, err := effectiveSwapFee(tx, tokenIn, tokenOut, projectPartyFeeK, lpAwardFeeK)
+	if err != nil {
+		return ZeroValue, new(PoolSwapRecord), errors.Wrap(err, "effectiveSwapFee")
+	}
+	projectPartyFeeK, lpAwardFeeK = fee.ProjectPartyFeeK, fee.LpAwardFeeK
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
@@ -2442,7 +2482,7 @@ func calcSwapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenOut == TokenSatTag {
 			if _amountOut.Cmp(_minSwapSat) <= 0 {
 				return ZeroValue, new(PoolSwapRecord), errors.New("insufficient _amountOut(" + _amountOut.String() + "), need " + _minSwapSat.String())
@@ -2512,7 +2552,7 @@ func calcSwapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 
 		if isTokenZeroSat {
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			_amountOutExcludeFee, _amountOutFee = amountFee(_amountOut, feeK)
 
@@ -2535,7 +2575,7 @@ func calcSwapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 
 			} else {
 
-				_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+				_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 				swapFeeType = SwapFee6Thousands
 
 				*_swapFee = *_amountOutFee
@@ -2603,7 +2643,7 @@ func calcSwapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 
 		if isTokenZeroSat {
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			var _amountInWithFee, _amountInWithoutFee *big.Int
 
@@ -2634,7 +2674,7 @@ func calcSwapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 				*_amountOutExcludeFee = *_amountOut
 			} else {
 
-				_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+				_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 				_amountIn = _amountInWithFee
 				swapFeeType = SwapFee6Thousands
@@ -2705,7 +2745,7 @@ func calcSwapTokenForExactTokenNoPath(tx *gorm.DB, tokenIn string, tokenOut stri
 		return ZeroValue, new(PoolSwapRecord), errors.New("invalid _newReserve1(" + _newReserve1.String() + ")")
 	}
 
-	swapRecord, err = calcSwapRecord(pairId, username, tokenIn, tokenOut, _amountIn.String(), amountOut, _reserveIn.String(), _reserveOut.String(), _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapForExactTokenNoPath)
+	swapRecord, err = calcSwapRecord(pairId, username, tokenIn, tokenOut, _amountIn.String(), amountOut, _reserveIn.String(), _reserveOut.String(), _calcPriceAmountIn.String(), _calcPriceAmountOut.String(), _swapFeeFloat.String(), swapFeeType, SwapForExactTokenNoPath, fee)
 	if err != nil {
 		return ZeroValue, new(PoolSwapRecord), errors.Wrap(err, "calcSwapRecord")
 	}
@@ -2786,6 +2826,12 @@ func CalcBurnLiquidity(tokenA string, tokenB string, liquidity string, username
 		return ZeroValue, ZeroValue, errors.Wrap(err, "sortTokens")
 	}
 
+	fee, err := effectiveRemoveLiquidityFee(middleware.DB, tokenA, tokenB, feeK)
+	if err != nil {
+		return ZeroValue, ZeroValue, errors.Wrap(err, "effectiveRemoveLiquidityFee")
+	}
+	feeK = fee.RemoveLiquidityFeeK
+
 	tx := middleware.DB.Begin()
 
 	defer func() {
@@ -2917,7 +2963,11 @@ func CalcAmountOut(tokenIn string, tokenOut string, amountIn string) (amountOut
 
 	var _amountOut *big.Int
 
-	feeK := ProjectPartyFeeK + LpAwardFeeK
+	fee, err := getEffectivePairFee(tx, pairId, time.Now().Unix())
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "getEffectivePairFee")
+	}
+	feeK := fee.SwapFeeK()
 
 	_amountOut, err = getAmountOutBig(_amountIn, _reserveIn, _reserveOut, feeK)
 	if err != nil {
@@ -2927,7 +2977,12 @@ func CalcAmountOut(tokenIn string, tokenOut string, amountIn string) (amountOut
 }
 
 func CalcAmountOut2(tokenIn string, tokenOut string, amountIn string) (amountOut string, err error) {
-	feeK := ProjectPartyFeeK + LpAwardFeeK
+	fee, err := getEffectivePairFeeByTokens(middleware.DB, tokenIn, tokenOut)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "getEffectivePairFeeByTokens")
+	}
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
@@ -2942,7 +2997,7 @@ func CalcAmountOut2(tokenIn string, tokenOut string, amountIn string) (amountOut
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenIn == TokenSatTag {
 			if _amountIn.Cmp(_minSwapSat) <= 0 {
 				return ZeroValue, errors.New("insufficient _amountIn(" + _amountIn.String() + "), need " + _minSwapSat.String())
@@ -2999,7 +3054,7 @@ func CalcAmountOut2(tokenIn string, tokenOut string, amountIn string) (amountOut
 				return ZeroValue, errors.Wrap(err, "getAmountOutBigWithoutFee")
 			}
 
-			_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 			if new(big.Int).Sub(_amountOutWithoutFee, _amountOutWithFee).Cmp(_minSwapSat) < 0 {
 
 				_amountOut = new(big.Int).Sub(_amountOutWithoutFee, _minSwapSat)
@@ -3027,7 +3082,7 @@ func CalcAmountOut2(tokenIn string, tokenOut string, amountIn string) (amountOut
 		*_reserveIn, *_reserveOut = *_reserve0, *_reserve1
 
 		if isTokenZeroSat {
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			var _amountOutWithFee, _amountOutWithoutFee *big.Int
 
@@ -3051,7 +3106,7 @@ func CalcAmountOut2(tokenIn string, tokenOut string, amountIn string) (amountOut
 			}
 
 			_swapFeeToken1ValueFloat := new(big.Float).Mul(_swapFeeToken1Float, _price)
-			_minSwapSatFeeFloat := new(big.Float).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFeeFloat := new(big.Float).SetUint64(uint64(minSwapSatFee))
 
 			if _swapFeeToken1ValueFloat.Cmp(_minSwapSatFeeFloat) < 0 {
 
@@ -3140,7 +3195,11 @@ func CalcAmountIn(tokenIn string, tokenOut string, amountOut string) (amountIn s
 
 	var _amountIn *big.Int
 
-	feeK := ProjectPartyFeeK + LpAwardFeeK
+	fee, err := getEffectivePairFee(tx, pairId, time.Now().Unix())
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "getEffectivePairFee")
+	}
+	feeK := fee.SwapFeeK()
 
 	_amountIn, err = getAmountInBig(_amountOut, _reserveIn, _reserveOut, feeK)
 	if err != nil {
@@ -3150,7 +3209,12 @@ func CalcAmountIn(tokenIn string, tokenOut string, amountOut string) (amountIn s
 }
 
 func CalcAmountIn2(tokenIn string, tokenOut string, amountOut string) (amountIn string, err error) {
-	feeK := ProjectPartyFeeK + LpAwardFeeK
+	fee, err := getEffectivePairFeeByTokens(middleware.DB, tokenIn, tokenOut)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "getEffectivePairFeeByTokens")
+	}
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
@@ -3165,7 +3229,7 @@ func CalcAmountIn2(tokenIn string, tokenOut string, amountOut string) (amountIn
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenOut == TokenSatTag {
 			if _amountOut.Cmp(_minSwapSat) <= 0 {
 				return ZeroValue, errors.New("insufficient _amountOut(" + _amountOut.String() + "), need " + _minSwapSat.String())
@@ -3216,7 +3280,7 @@ func CalcAmountIn2(tokenIn string, tokenOut string, amountOut string) (amountIn
 
 			var _amountInWithFee, _amountInWithoutFee *big.Int
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 			_amountInWithFee, err = getAmountInBig(_amountOut, _reserveIn, _reserveOut, feeK)
 			if err != nil {
 				return ZeroValue, errors.Wrap(err, "getAmountInBig")
@@ -3235,7 +3299,7 @@ func CalcAmountIn2(tokenIn string, tokenOut string, amountOut string) (amountIn
 			if err != nil {
 				return ZeroValue, errors.Wrap(err, "getToken1PriceBig")
 			}
-			_minSwapSatFeeFloat := new(big.Float).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFeeFloat := new(big.Float).SetUint64(uint64(minSwapSatFee))
 			_feeValueFloat := new(big.Float).Mul(_amountInFeeFloat, _price)
 
 			if _feeValueFloat.Cmp(_minSwapSatFeeFloat) < 0 {
@@ -3275,7 +3339,7 @@ func CalcAmountIn2(tokenIn string, tokenOut string, amountOut string) (amountIn
 
 		if isTokenZeroSat {
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			var _amountInWithFee, _amountInWithoutFee *big.Int
 
@@ -3324,7 +3388,12 @@ func CalcAmountIn2(tokenIn string, tokenOut string, amountOut string) (amountIn
 }
 
 func CalcAmountOut3(tokenIn string, tokenOut string, amountIn string) (amountOut string, err error) {
-	feeK := ProjectPartyFeeK + LpAwardFeeK
+	fee, err := getEffectivePairFeeByTokens(middleware.DB, tokenIn, tokenOut)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "getEffectivePairFeeByTokens")
+	}
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
@@ -3339,7 +3408,7 @@ func CalcAmountOut3(tokenIn string, tokenOut string, amountIn string) (amountOut
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenIn == TokenSatTag {
 			if _amountIn.Cmp(_minSwapSat) <= 0 {
 				return ZeroValue, errors.New("insufficient _amountIn(" + _amountIn.String() + "), need " + _minSwapSat.String())
@@ -3414,7 +3483,7 @@ func CalcAmountOut3(tokenIn string, tokenOut string, amountIn string) (amountOut
 				return ZeroValue, errors.Wrap(err, "getAmountOutBigWithoutFee")
 			}
 
-			_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 			if new(big.Int).Sub(_amountOutWithoutFee, _amountOutWithFee).Cmp(_minSwapSat) < 0 {
 
 				_amountOut = new(big.Int).Sub(_amountOutWithoutFee, _minSwapSat)
@@ -3458,7 +3527,7 @@ func CalcAmountOut3(tokenIn string, tokenOut string, amountIn string) (amountOut
 		*_reserveIn, *_reserveOut = *_reserve0, *_reserve1
 
 		if isTokenZeroSat {
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			_amountInExcludeFee, _amountInFee = amountFee(_amountIn, feeK)
 
@@ -3516,7 +3585,12 @@ func CalcAmountOut3(tokenIn string, tokenOut string, amountIn string) (amountOut
 }
 
 func CalcAmountIn3(tokenIn string, tokenOut string, amountOut string) (amountIn string, err error) {
-	feeK := ProjectPartyFeeK + LpAwardFeeK
+	fee, err := getEffectivePairFeeByTokens(middleware.DB, tokenIn, tokenOut)
+	if err != nil {
+		return ZeroValue, errors.Wrap(err, "getEffectivePairFeeByTokens")
+	}
+	feeK := fee.SwapFeeK()
+	minSwapSatFee := fee.MinSwapSatFee
 
 	token0, token1, err := sortTokens(tokenIn, tokenOut)
 	if err != nil {
@@ -3531,7 +3605,7 @@ func CalcAmountIn3(tokenIn string, tokenOut string, amountOut string) (amountIn
 	}
 
 	if isTokenZeroSat {
-		_minSwapSat := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+		_minSwapSat := new(big.Int).SetUint64(uint64(minSwapSatFee))
 		if tokenOut == TokenSatTag {
 			if _amountOut.Cmp(_minSwapSat) <= 0 {
 				return ZeroValue, errors.New("insufficient _amountOut(" + _amountOut.String() + "), need " + _minSwapSat.String())
@@ -3598,7 +3672,7 @@ func CalcAmountIn3(tokenIn string, tokenOut string, amountOut string) (amountIn
 
 		if isTokenZeroSat {
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			_amountOutExcludeFee, _amountOutFee = amountFee(_amountOut, feeK)
 
@@ -3662,7 +3736,7 @@ func CalcAmountIn3(tokenIn string, tokenOut string, amountOut string) (amountIn
 
 		if isTokenZeroSat {
 
-			_minSwapSatFee := new(big.Int).SetUint64(uint64(MinSwapSatFee))
+			_minSwapSatFee := new(big.Int).SetUint64(uint64(minSwapSatFee))
 
 			var _amountInWithFee, _amountInWithoutFee *big.Int
 
@@ -4987,18 +5061,10 @@ func PoolTransferToFee(tokenA string, tokenB string, amount string) (err error)
 		return errors.New("token0 is not sat")
 	}
 
-	if LockP == nil {
-		LockP = make(map[string]map[string]*sync.Mutex)
-	}
-	if LockP[token0] == nil {
-		LockP[token0] = make(map[string]*sync.Mutex)
-	}
-	if LockP[token0][token1] == nil {
-		LockP[token0][token1] = new(sync.Mutex)
-	}
-	LockP[token0][token1].Lock()
+	pairLock := pairMutex(token0, token1)
+	pairLock.Lock()
 
-	defer LockP[token0][token1].Unlock()
+	defer pairLock.Unlock()
 
 	tx := middleware.DB.Begin()
 
@@ -5051,10 +5117,12 @@ func PoolTransferToFee(tokenA string, tokenB string, amount string) (err error)
 		return errors.New("invalid _newReserve0(" + _newReserve0.String() + ")")
 	}
 
-	err = tx.Model(&PoolPair{}).Where("token0 = ? AND token1 = ?", token0, token1).
-		Updates(map[string]any{
-			"reserve0": _newReserve0.String(),
-		}).Error
+	_reserve1, success := new(big.Int).SetString(_pair.Reserve1, 10)
+	if !success {
+		return errors.New("Reserve1 SetString(" + _pair.Reserve1 + ") " + strconv.FormatBool(success))
+	}
+
+	err = updatePairReserves(tx, &_pair, _newReserve0, _reserve1)
 	if err != nil {
 		return errors.Wrap(err, "update pair")
 	}
@@ -0,0 +1,275 @@
+package pool
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"trade/middleware"
+	"trade/middleware/dbtest"
+	"trade/services/custodyAccount/poolAccount"
+	"trade/services/satBackQueue"
+
+	"gorm.io/gorm"
+)
+
+var testAssetId = strings.Repeat("ab", AssetIdLength/2)
+
+// poolTestLedgerEntry is one leg of a custody transfer in the test ledger. A balance is the sum of its entries,
+// and entries are written through the pool's tx so a rolled back pool operation leaves no trace.
+type poolTestLedgerEntry struct {
+	ID     uint `gorm:"primaryKey"`
+	Owner  string
+	Token  string
+	Amount int64
+}
+
+func poolOwner(pairId uint, poolType uint) string {
+	return "pool:" + strconv.FormatUint(uint64(pairId), 10) + ":" + strconv.FormatUint(uint64(poolType), 10)
+}
+
+func ledgerBalance(tx *gorm.DB, owner string, token string) (balance int64, err error) {
+	err = tx.Model(&poolTestLedgerEntry{}).Select("COALESCE(SUM(amount), 0)").
+		Where("owner = ? AND token = ?", owner, token).Scan(&balance).Error
+	return balance, err
+}
+
+func ledgerTransfer(tx *gorm.DB, from string, to string, token string, _amount *big.Int) (uint, error) {
+	balance, err := ledgerBalance(tx, from, token)
+	if err != nil {
+		return 0, err
+	}
+	if balance < _amount.Int64() {
+		return 0, poolTestError("not enough balance of " + from)
+	}
+	debit := poolTestLedgerEntry{Owner: from, Token: token, Amount: -_amount.Int64()}
+	if err = tx.Create(&debit).Error; err != nil {
+		return 0, err
+	}
+	return debit.ID, tx.Create(&poolTestLedgerEntry{Owner: to, Token: token, Amount: _amount.Int64()}).Error
+}
+
+type poolTestError string
+
+func (e poolTestError) Error() string { return string(e) }
+
+func setupPoolTest(t *testing.T) {
+	t.Helper()
+	db := dbtest.Use(t,
+		&poolTestLedgerEntry{},
+		&PoolPair{},
+		&PoolShare{},
+		&PoolShareRecord{},
+		&PoolSwapRecord{},
+		&PoolLpAwardBalance{},
+		&PoolLpAwardRecord{},
+		&PoolAccountFeeBalance{},
+		&PoolLpAwardCumulative{},
+		&PoolPairFeeTier{},
+		&PoolPairPriceObservation{},
+		&satBackQueue.PushOutboxEvent{},
+		&satBackQueue.GenLiquidity{},
+	)
+	// SQLite index names are global, so the tables sharing idx_share_id_username get it renamed one at a time.
+	for table, model := range map[string]any{
+		"pool_share_balances":             &PoolShareBalance{},
+		"pool_share_lp_award_balances":    &PoolShareLpAwardBalance{},
+		"pool_share_lp_award_cumulatives": &PoolShareLpAwardCumulative{},
+	} {
+		err := db.AutoMigrate(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Exec("DROP INDEX idx_share_id_username").Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Exec("CREATE UNIQUE INDEX idx_" + table + "_share_id_username ON " + table + " (share_id, username)").Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.Exec("CREATE TABLE nft_presales (id integer PRIMARY KEY, buyer_username text)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldCreate, oldToUser, oldToPool, oldToPoolP, oldInfo := custodyCreatePoolAccount, custodyPAccountToUserPay, custodyUserPayToPAccount, custodyPAccountToPAccountPay, custodyGetPoolAccountInfo
+	custodyCreatePoolAccount = func(tx *gorm.DB, pairId uint, poolType uint, allowTokens []string) error {
+		return nil
+	}
+	custodyPAccountToUserPay = func(tx *gorm.DB, username string, pairId uint, poolType uint, token string, _amount *big.Int, transferDesc string) (uint, error) {
+		return ledgerTransfer(tx, poolOwner(pairId, poolType), username, token, _amount)
+	}
+	custodyUserPayToPAccount = func(tx *gorm.DB, pairId uint, poolType uint, username string, token string, _amount *big.Int, transferDesc string) (uint, error) {
+		return ledgerTransfer(tx, username, poolOwner(pairId, poolType), token, _amount)
+	}
+	custodyPAccountToPAccountPay = func(tx *gorm.DB, fromPairId uint, fromType uint, toPairId uint, toType uint, token string, _amount *big.Int, transferDesc string) (uint, error) {
+		return ledgerTransfer(tx, poolOwner(fromPairId, fromType), poolOwner(toPairId, toType), token, _amount)
+	}
+	custodyGetPoolAccountInfo = func(pairId uint, poolType uint) (*poolAccount.PAccountInfo, error) {
+		return &poolAccount.PAccountInfo{}, nil
+	}
+	t.Cleanup(func() {
+		custodyCreatePoolAccount, custodyPAccountToUserPay, custodyUserPayToPAccount, custodyPAccountToPAccountPay, custodyGetPoolAccountInfo = oldCreate, oldToUser, oldToPool, oldToPoolP, oldInfo
+	})
+}
+
+func fundUser(t *testing.T, username string, sat int64, asset int64) {
+	t.Helper()
+	for _, entry := range []poolTestLedgerEntry{{Owner: username, Token: "00", Amount: sat}, {Owner: username, Token: testAssetId, Amount: asset}} {
+		if err := middleware.DB.Create(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func mustLedgerBalance(t *testing.T, owner string, token string) int64 {
+	t.Helper()
+	balance, err := ledgerBalance(middleware.DB, owner, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+func loadPair(t *testing.T) (pair PoolPair, reserve0 *big.Int, reserve1 *big.Int) {
+	t.Helper()
+	err := middleware.DB.Where("token0 = ? AND token1 = ?", TokenSatTag, testAssetId).First(&pair).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair, bigInt(t, pair.Reserve0), bigInt(t, pair.Reserve1)
+}
+
+// checkReservesMatchLedger fails when the pair's reserves differ from what its default pool account holds.
+func checkReservesMatchLedger(t *testing.T) {
+	t.Helper()
+	pair, reserve0, reserve1 := loadPair(t)
+	owner := poolOwner(pair.ID, PoolTypeDefault)
+	if got := mustLedgerBalance(t, owner, "00"); got != reserve0.Int64() {
+		t.Fatalf("pool account holds %d sat, reserve0 is %s", got, reserve0)
+	}
+	if got := mustLedgerBalance(t, owner, testAssetId); got != reserve1.Int64() {
+		t.Fatalf("pool account holds %d asset, reserve1 is %s", got, reserve1)
+	}
+}
+
+func swapExactIn(tokenIn string, tokenOut string, amountIn string, amountOutMin string, username string) (amountOut string, err error) {
+	tx := middleware.DB.Begin()
+	amountOut, err = swapExactTokenForTokenNoPath(tx, tokenIn, tokenOut, amountIn, amountOutMin, username, ProjectPartyFeeK, LpAwardFeeK)
+	if err != nil {
+		tx.Rollback()
+		return amountOut, err
+	}
+	return amountOut, tx.Commit().Error
+}
+
+func TestAddLiquidityMintsShares(t *testing.T) {
+	setupPoolTest(t)
+	fundUser(t, "alice", 1_000_000, 4_000_000)
+	fundUser(t, "bob", 1_000_000, 4_000_000)
+
+	amountA, amountB, liquidity, err := addLiquidity(TokenSatTag, testAssetId, "100000", "400000", "0", "0", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amountA != "100000" || amountB != "400000" || liquidity != "199990" {
+		t.Fatalf("first mint got %s %s %s, want 100000 400000 199990", amountA, amountB, liquidity)
+	}
+	checkReservesMatchLedger(t)
+
+	amountA, amountB, liquidity, err = addLiquidity(testAssetId, TokenSatTag, "300000", "100000", "0", "0", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amountA != "300000" || amountB != "75000" || liquidity != "149992" {
+		t.Fatalf("second mint got %s %s %s, want 300000 75000 149992", amountA, amountB, liquidity)
+	}
+	checkReservesMatchLedger(t)
+	if got := mustLedgerBalance(t, "bob", testAssetId); got != 3_700_000 {
+		t.Fatalf("bob holds %d asset, want 3700000", got)
+	}
+
+	pair, _, _ := loadPair(t)
+	var share PoolShare
+	if err = middleware.DB.Where("pair_id = ?", pair.ID).First(&share).Error; err != nil {
+		t.Fatal(err)
+	}
+	if share.TotalSupply != "349982" {
+		t.Fatalf("total supply %s, want 349982", share.TotalSupply)
+	}
+
+	_, _, _, err = addLiquidity(TokenSatTag, testAssetId, "100000", "1", "0", "1", "bob")
+	if err == nil {
+		t.Fatal("add liquidity below the pool ratio, want error")
+	}
+	checkReservesMatchLedger(t)
+}
+
+func TestSwapExactTokenForTokenNoPath(t *testing.T) {
+	setupPoolTest(t)
+	fundUser(t, "alice", 1_000_000, 4_000_000)
+	fundUser(t, "bob", 1_000_000, 4_000_000)
+	if _, _, _, err := addLiquidity(TokenSatTag, testAssetId, "100000", "400000", "0", "0", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	pair, reserve0, reserve1 := loadPair(t)
+	feeK := ProjectPartyFeeK + LpAwardFeeK
+
+	want, err := getAmountOutBig(big.NewInt(10000), reserve0, reserve1, feeK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amountOut, err := swapExactIn(TokenSatTag, testAssetId, "10000", "1", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amountOut != want.String() {
+		t.Fatalf("sat in got %s, want %s", amountOut, want)
+	}
+	checkReservesMatchLedger(t)
+	_, newReserve0, newReserve1 := loadPair(t)
+	if new(big.Int).Mul(newReserve0, newReserve1).Cmp(new(big.Int).Mul(reserve0, reserve1)) < 0 {
+		t.Fatalf("k decreased from %s*%s to %s*%s", reserve0, reserve1, newReserve0, newReserve1)
+	}
+	if got := mustLedgerBalance(t, poolOwner(pair.ID, PoolTypeFee), "00"); got != 60 {
+		t.Fatalf("fee account holds %d sat, want 60", got)
+	}
+
+	reserve0, reserve1 = newReserve0, newReserve1
+	amountOut, err = swapExactIn(testAssetId, TokenSatTag, "40000", "1", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReservesMatchLedger(t)
+	_, newReserve0, newReserve1 = loadPair(t)
+	if new(big.Int).Mul(newReserve0, newReserve1).Cmp(new(big.Int).Mul(reserve0, reserve1)) < 0 {
+		t.Fatalf("k decreased from %s*%s to %s*%s", reserve0, reserve1, newReserve0, newReserve1)
+	}
+	if got := mustLedgerBalance(t, "bob", "00"); got != 1_000_000-10000+bigInt(t, amountOut).Int64() {
+		t.Fatalf("bob holds %d sat after swapping back %s", got, amountOut)
+	}
+
+	var total int64
+	middleware.DB.Model(&poolTestLedgerEntry{}).Select("COALESCE(SUM(amount), 0)").Where("token = ?", "00").Scan(&total)
+	if total != 2_000_000 {
+		t.Fatalf("ledger holds %d sat in total, want 2000000", total)
+	}
+	var swaps, events int64
+	middleware.DB.Model(&PoolSwapRecord{}).Count(&swaps)
+	middleware.DB.Model(&satBackQueue.PushOutboxEvent{}).Count(&events)
+	if swaps != 2 || events != 2 {
+		t.Fatalf("recorded %d swaps and %d outbox events, want 2 each", swaps, events)
+	}
+
+	_, err = swapExactIn(TokenSatTag, testAssetId, "10000", "1000000", "bob")
+	if err == nil {
+		t.Fatal("swap below amount out min, want error")
+	}
+	checkReservesMatchLedger(t)
+	middleware.DB.Model(&PoolSwapRecord{}).Count(&swaps)
+	if swaps != 2 {
+		t.Fatalf("failed swap left a record, got %d swaps", swaps)
+	}
+}
@@ -2,8 +2,10 @@ package pool
 
 import (
 	"fmt"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"trade/middleware"
+	"trade/models/custodyModels"
 	"trade/utils"
 )
 
@@ -33,15 +35,15 @@ func poolPairName(pairId uint, poolType uint, token0, token1 string) string {
 
 type PoolPairTokenAccountBalance struct {
 	gorm.Model
-	PairId  uint    `json:"pair_id" gorm:"uniqueIndex:idx_pair_id_token"`
-	Token   string  `json:"token" gorm:"type:varchar(255);uniqueIndex:idx_pair_id_token"`
-	Balance float64 `json:"balance"`
+	PairId  uint                 `json:"pair_id" gorm:"uniqueIndex:idx_pair_id_token"`
+	Token   string               `json:"token" gorm:"type:varchar(255);uniqueIndex:idx_pair_id_token"`
+	Balance custodyModels.Amount `json:"balance" gorm:"type:decimal(38,0)"`
 }
 
 type PoolPairTokenAccountBalanceInfo struct {
-	PairId  uint    `json:"pair_id"`
-	Token   string  `json:"token"`
-	Balance float64 `json:"balance"`
+	PairId  uint                 `json:"pair_id"`
+	Token   string               `json:"token"`
+	Balance custodyModels.Amount `json:"balance"`
 }
 
 func getPoolPairTokenAccountBalanceInfos(pairId uint, token0 string, token1 string) ([]PoolPairTokenAccountBalanceInfo, error) {
@@ -60,29 +62,29 @@ func getPoolPairTokenAccountBalanceInfos(pairId uint, token0 string, token1 stri
 	}
 	var poolPairTokenAccountBalances []PoolPairTokenAccountBalanceInfo
 
-	var tokenMapBalance = make(map[string]float64)
+	var tokenMapBalance = make(map[string]decimal.Decimal)
 
 	if pAccountInfo1.Balances != nil {
 		for _, balance := range *pAccountInfo1.Balances {
-			tokenMapBalance[balance.AssetId] += balance.Balance
+			tokenMapBalance[balance.AssetId] = tokenMapBalance[balance.AssetId].Add(balance.Balance.Decimal)
 		}
 	}
 	if pAccountInfo2.Balances != nil {
 		for _, balance := range *pAccountInfo2.Balances {
-			tokenMapBalance[balance.AssetId] += balance.Balance
+			tokenMapBalance[balance.AssetId] = tokenMapBalance[balance.AssetId].Add(balance.Balance.Decimal)
 		}
 	}
 
 	poolPairTokenAccountBalances = append(poolPairTokenAccountBalances, PoolPairTokenAccountBalanceInfo{
 		PairId:  pairId,
 		Token:   token0,
-		Balance: tokenMapBalance[token0],
+		Balance: custodyModels.NewAmount(tokenMapBalance[token0]),
 	})
 
 	poolPairTokenAccountBalances = append(poolPairTokenAccountBalances, PoolPairTokenAccountBalanceInfo{
 		PairId:  pairId,
 		Token:   token1,
-		Balance: tokenMapBalance[token1],
+		Balance: custodyModels.NewAmount(tokenMapBalance[token1]),
 	})
 
 	return poolPairTokenAccountBalances, nil
@@ -155,16 +157,16 @@ func UpdateAllPoolPairTokenAccountBalances() error {
 }
 
 type PoolAccountNameAndBalance struct {
-	Name    string  `json:"name"`
-	Balance float64 `json:"balance"`
+	Name    string               `json:"name"`
+	Balance custodyModels.Amount `json:"balance"`
 }
 
 type PoolPairTokenAccountBalanceScan struct {
-	AccountId string   `gorm:"column:account_id"`
-	Balance   float64  `gorm:"column:balance"`
-	Type      uint     `gorm:"column:type"`
-	PairId    uint     `gorm:"column:pair_id"`
-	Token     []string `json:"token"`
+	AccountId string               `gorm:"column:account_id"`
+	Balance   custodyModels.Amount `gorm:"column:balance"`
+	Type      uint                 `gorm:"column:type"`
+	PairId    uint                 `gorm:"column:pair_id"`
+	Token     []string             `json:"token"`
 }
 
 func GetPoolAccountNameAndBalances(token string) ([]PoolAccountNameAndBalance, error) {
@@ -0,0 +1,93 @@
+package pool
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMintBig(t *testing.T) {
+	tests := []struct {
+		name                                     string
+		amount0, amount1, reserve0, reserve1, ts int64
+		isTokenZeroSat                           bool
+		want                                     int64
+		wantErr                                  bool
+	}{
+		{"first mint locks min liquidity", 4000, 9000, 0, 0, 0, true, 5990, false},
+		{"first mint below min sat", 999, 9000, 0, 0, 0, true, 0, true},
+		{"first mint below min liquidity", 10, 10, 0, 0, 0, false, 0, true},
+		{"proportional mint", 1000, 2500, 4000, 9000, 5990, false, 1497, false},
+		{"mint takes the smaller share", 1000, 100, 4000, 9000, 5990, false, 66, false},
+		{"mint rounds to zero", 1, 1, 4000, 9000, 5990, false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := _mintBig(big.NewInt(tt.amount0), big.NewInt(tt.amount1), big.NewInt(tt.reserve0), big.NewInt(tt.reserve1), big.NewInt(tt.ts), tt.isTokenZeroSat)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Int64() != tt.want {
+				t.Fatalf("got %s, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBurnBig(t *testing.T) {
+	tests := []struct {
+		name                              string
+		reserve0, reserve1, ts, liquidity int64
+		feeK                              uint16
+		want0, want1                      int64
+		wantErr                           bool
+	}{
+		{"fee", 5000, 11500, 7487, 1497, 3, 996, 2292, false},
+		{"no fee", 5000, 11500, 7487, 1497, 0, 999, 2299, false},
+		{"all liquidity", 5000, 11500, 7487, 7487, 0, 5000, 11500, false},
+		{"more than supply", 5000, 11500, 7487, 7488, 0, 0, 0, true},
+		{"rounds to zero", 5000, 11500, 7487, 1, 3, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got0, got1, err := _burnBig(big.NewInt(tt.reserve0), big.NewInt(tt.reserve1), big.NewInt(tt.ts), big.NewInt(tt.liquidity), tt.feeK)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s %s, want error", got0, got1)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got0.Int64() != tt.want0 || got1.Int64() != tt.want1 {
+				t.Fatalf("got %s %s, want %d %d", got0, got1, tt.want0, tt.want1)
+			}
+		})
+	}
+	got0, got1, err := _burnBigWithoutFee(big.NewInt(5000), big.NewInt(11500), big.NewInt(7487), big.NewInt(1497))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got0.Int64() != 999 || got1.Int64() != 2299 {
+		t.Fatalf("burn without fee got %s %s, want 999 2299", got0, got1)
+	}
+}
+
+func TestMintBigForPureAddLiquidity(t *testing.T) {
+	got, err := _mintBigForPureAddLiquidity(big.NewInt(1000), big.NewInt(2250), big.NewInt(4000), big.NewInt(9000), big.NewInt(6000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Int64() != 1500 {
+		t.Fatalf("got %s, want 1500", got)
+	}
+	if _, err = _mintBigForPureAddLiquidity(big.NewInt(1000), big.NewInt(2250), big.NewInt(4000), big.NewInt(9000), big.NewInt(0)); err == nil {
+		t.Fatal("empty supply, want error")
+	}
+}
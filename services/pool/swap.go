@@ -4,6 +4,7 @@ import (
 	"errors"
 	"gorm.io/gorm"
 	"strconv"
+	"trade/services/satBackQueue"
 	"trade/utils"
 )
 
@@ -41,12 +42,18 @@ type PoolSwapRecord struct {
 	SwapFeeType              SwapFeeType    `json:"swap_fee_type" gorm:"index"`
 	SwapRecordType           SwapRecordType `json:"swap_record_type" gorm:"index"`
 	IsPushedQueue            bool           `json:"is_pushed_queue"`
+	FeeTierId                uint           `json:"fee_tier_id" gorm:"index"`
+	ProjectPartyFeeK         uint16         `json:"project_party_fee_k"`
+	LpAwardFeeK              uint16         `json:"lp_award_fee_k"`
 }
 
-func newSwapRecord(pairId uint, username string, tokenIn string, tokenOut string, amountIn string, amountOut string, reserveIn string, reserveOut string, tokenInTransferRecordId uint, feeTransferRecordId uint, tokenOutTransferRecordId uint, calcPriceAmountIn string, calcPriceAmountOut string, swapFee string, swapFeeType SwapFeeType, swapRecordType SwapRecordType) (swapRecord *PoolSwapRecord, err error) {
+func newSwapRecord(pairId uint, username string, tokenIn string, tokenOut string, amountIn string, amountOut string, reserveIn string, reserveOut string, tokenInTransferRecordId uint, feeTransferRecordId uint, tokenOutTransferRecordId uint, calcPriceAmountIn string, calcPriceAmountOut string, swapFee string, swapFeeType SwapFeeType, swapRecordType SwapRecordType, fee *PoolPairFee) (swapRecord *PoolSwapRecord, err error) {
 	if pairId <= 0 {
 		return new(PoolSwapRecord), errors.New("invalid pairId(" + strconv.FormatUint(uint64(pairId), 10) + ")")
 	}
+	if fee == nil {
+		fee = defaultPairFee(pairId)
+	}
 	return &PoolSwapRecord{
 		PairId:                   pairId,
 		Username:                 username,
@@ -64,15 +71,18 @@ func newSwapRecord(pairId uint, username string, tokenIn string, tokenOut string
 		SwapFee:                  swapFee,
 		SwapFeeType:              swapFeeType,
 		SwapRecordType:           swapRecordType,
+		FeeTierId:                fee.TierId,
+		ProjectPartyFeeK:         fee.ProjectPartyFeeK,
+		LpAwardFeeK:              fee.LpAwardFeeK,
 	}, nil
 }
 
-func createSwapRecord(tx *gorm.DB, pairId uint, username string, tokenIn string, tokenOut string, amountIn string, amountOut string, reserveIn string, reserveOut string, tokenInTransferRecordId uint, feeTransferRecordId uint, tokenOutTransferRecordId uint, calcPriceAmountIn string, calcPriceAmountOut string, swapFee string, swapFeeType SwapFeeType, swapRecordType SwapRecordType) (recordId uint, err error) {
+func createSwapRecord(tx *gorm.DB, pairId uint, username string, tokenIn string, tokenOut string, amountIn string, amountOut string, reserveIn string, reserveOut string, tokenInTransferRecordId uint, feeTransferRecordId uint, tokenOutTransferRecordId uint, calcPriceAmountIn string, calcPriceAmountOut string, swapFee string, swapFeeType SwapFeeType, swapRecordType SwapRecordType, fee *PoolPairFee) (recordId uint, err error) {
 	if pairId <= 0 {
 		return 0, errors.New("invalid pairId(" + strconv.FormatUint(uint64(pairId), 10) + ")")
 	}
 	var swapRecord *PoolSwapRecord
-	swapRecord, err = newSwapRecord(pairId, username, tokenIn, tokenOut, amountIn, amountOut, reserveIn, reserveOut, tokenInTransferRecordId, feeTransferRecordId, tokenOutTransferRecordId, calcPriceAmountIn, calcPriceAmountOut, swapFee, swapFeeType, swapRecordType)
+	swapRecord, err = newSwapRecord(pairId, username, tokenIn, tokenOut, amountIn, amountOut, reserveIn, reserveOut, tokenInTransferRecordId, feeTransferRecordId, tokenOutTransferRecordId, calcPriceAmountIn, calcPriceAmountOut, swapFee, swapFeeType, swapRecordType, fee)
 	if err != nil {
 		return 0, utils.AppendErrorInfo(err, "newSwapRecord")
 	}
@@ -81,14 +91,34 @@ func createSwapRecord(tx *gorm.DB, pairId uint, username string, tokenIn string,
 		return 0, utils.AppendErrorInfo(err, "create swapRecord")
 	}
 	recordId = swapRecord.ID
+	swapTr, err := satBackQueue.SwapTrsScanToSwapTr(satBackQueue.SwapTrsScan{
+		ID:                 swapRecord.ID,
+		CreatedAt:          swapRecord.CreatedAt,
+		Username:           swapRecord.Username,
+		TokenIn:            swapRecord.TokenIn,
+		TokenOut:           swapRecord.TokenOut,
+		CalcPriceAmountIn:  swapRecord.CalcPriceAmountIn,
+		CalcPriceAmountOut: swapRecord.CalcPriceAmountOut,
+		SwapFee:            swapRecord.SwapFee,
+		FeeTierId:          swapRecord.FeeTierId,
+		ProjectPartyFeeK:   swapRecord.ProjectPartyFeeK,
+		LpAwardFeeK:        swapRecord.LpAwardFeeK,
+	})
+	if err != nil {
+		return 0, utils.AppendErrorInfo(err, "SwapTrsScanToSwapTr")
+	}
+	err = satBackQueue.EnqueueSwapTr(tx, swapTr)
+	if err != nil {
+		return 0, utils.AppendErrorInfo(err, "EnqueueSwapTr")
+	}
 	return recordId, nil
 }
 
-func calcSwapRecord(pairId uint, username string, tokenIn string, tokenOut string, amountIn string, amountOut string, reserveIn string, reserveOut string, calcPriceAmountIn string, calcPriceAmountOut string, swapFee string, swapFeeType SwapFeeType, swapRecordType SwapRecordType) (swapRecord *PoolSwapRecord, err error) {
+func calcSwapRecord(pairId uint, username string, tokenIn string, tokenOut string, amountIn string, amountOut string, reserveIn string, reserveOut string, calcPriceAmountIn string, calcPriceAmountOut string, swapFee string, swapFeeType SwapFeeType, swapRecordType SwapRecordType, fee *PoolPairFee) (swapRecord *PoolSwapRecord, err error) {
 	if pairId <= 0 {
 		return new(PoolSwapRecord), errors.New("invalid pairId(" + strconv.FormatUint(uint64(pairId), 10) + ")")
 	}
-	swapRecord, err = newSwapRecord(pairId, username, tokenIn, tokenOut, amountIn, amountOut, reserveIn, reserveOut, 0, 0, 0, calcPriceAmountIn, calcPriceAmountOut, swapFee, swapFeeType, swapRecordType)
+	swapRecord, err = newSwapRecord(pairId, username, tokenIn, tokenOut, amountIn, amountOut, reserveIn, reserveOut, 0, 0, 0, calcPriceAmountIn, calcPriceAmountOut, swapFee, swapFeeType, swapRecordType, fee)
 	if err != nil {
 		return new(PoolSwapRecord), utils.AppendErrorInfo(err, "newSwapRecord")
 	}
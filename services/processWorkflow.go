@@ -0,0 +1,330 @@
+package services
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"trade/api"
+	"trade/middleware"
+	"trade/models"
+	"trade/services/workflow"
+	"trade/utils"
+)
+
+// processRetryPolicy retries a state until it gets through, backing off to ten minutes between failures.
+var processRetryPolicy = workflow.RetryPolicy{
+	Backoff:    30 * time.Second,
+	MaxBackoff: 10 * time.Minute,
+}
+
+// payRetryPolicy fails what could not pay its fee in 20 attempts, nothing has been paid or sent then.
+var payRetryPolicy = workflow.RetryPolicy{
+	MaxAttempts: 20,
+	Backoff:     30 * time.Second,
+	MaxBackoff:  10 * time.Minute,
+}
+
+var fairLaunchInfoWorkflow = workflow.New(workflow.Definition[models.FairLaunchInfo]{
+	Name: "fair_launch_info",
+	Id: func(fairLaunchInfo *models.FairLaunchInfo) uint {
+		return fairLaunchInfo.ID
+	},
+	State: func(fairLaunchInfo *models.FairLaunchInfo) workflow.State {
+		return int(fairLaunchInfo.State)
+	},
+	Attempt: IncreaseFairLaunchInfoProcessNumber,
+	Fail: func(tx *gorm.DB, fairLaunchInfo *models.FairLaunchInfo, reason string) error {
+		return SetFairLaunchInfoFail(tx, fairLaunchInfo)
+	},
+	Retry: processRetryPolicy,
+	Transitions: []workflow.Transition[models.FairLaunchInfo]{
+		{
+			From:   int(models.FairLaunchStateNoPay),
+			To:     []workflow.State{int(models.FairLaunchStatePaidPending)},
+			Load:   GetAllFairLaunchStateNoPayInfos,
+			Handle: ProcessFairLaunchStateNoPayInfoService,
+			Retry:  &payRetryPolicy,
+		},
+		{
+			From:   int(models.FairLaunchStatePaidPending),
+			To:     []workflow.State{int(models.FairLaunchStatePaidNoIssue), int(models.FairLaunchStateFail)},
+			Load:   GetAllFairLaunchStatePaidPendingInfos,
+			Handle: ProcessFairLaunchStatePaidPendingInfoService,
+		},
+		{
+			From:   int(models.FairLaunchStatePaidNoIssue),
+			To:     []workflow.State{int(models.FairLaunchStateIssuedPending)},
+			Load:   GetAllFairLaunchStatePaidNoIssueInfos,
+			Handle: ProcessFairLaunchStatePaidNoIssueInfoService,
+		},
+		{
+			From:   int(models.FairLaunchStateIssuedPending),
+			To:     []workflow.State{int(models.FairLaunchStateIssued)},
+			Load:   GetAllFairLaunchStateIssuedPendingInfos,
+			Handle: ProcessFairLaunchStateIssuedPendingInfoService,
+		},
+		{
+			From:   int(models.FairLaunchStateReservedSentPending),
+			To:     []workflow.State{int(models.FairLaunchStateReservedSent)},
+			Load:   GetAllFairLaunchStateReservedSentPending,
+			Handle: ProcessFairLaunchStateReservedSentPending,
+		},
+	},
+})
+
+var fairLaunchMintedInfoWorkflow = workflow.New(workflow.Definition[models.FairLaunchMintedInfo]{
+	Name: "fair_launch_minted_info",
+	Id: func(fairLaunchMintedInfo *models.FairLaunchMintedInfo) uint {
+		return fairLaunchMintedInfo.ID
+	},
+	State: func(fairLaunchMintedInfo *models.FairLaunchMintedInfo) workflow.State {
+		return int(fairLaunchMintedInfo.State)
+	},
+	Attempt: IncreaseFairLaunchMintedInfoProcessNumber,
+	Fail:    failFairLaunchMintedInfo,
+	Retry:   processRetryPolicy,
+	Transitions: []workflow.Transition[models.FairLaunchMintedInfo]{
+		{
+			From:   int(models.FairLaunchMintedStateNoPay),
+			To:     []workflow.State{int(models.FairLaunchMintedStatePaidPending), int(models.FairLaunchMintedStateFail)},
+			Load:   GetAllFairLaunchMintedStateNoPayInfo,
+			Handle: ProcessFairLaunchMintedStateNoPayInfo,
+			Retry:  &payRetryPolicy,
+		},
+		{
+			From:   int(models.FairLaunchMintedStatePaidPending),
+			To:     []workflow.State{int(models.FairLaunchMintedStatePaidNoSend), int(models.FairLaunchMintedStateFail)},
+			Load:   GetAllFairLaunchMintedStatePaidPendingInfo,
+			Handle: ProcessFairLaunchMintedStatePaidPendingInfo,
+		},
+		{
+			From:   int(models.FairLaunchMintedStatePaidNoSend),
+			To:     []workflow.State{int(models.FairLaunchMintedStateSentPending)},
+			Load:   GetAllFairLaunchMintedStatePaidNoSendInfo,
+			Handle: ProcessFairLaunchMintedStatePaidNoSendInfo,
+		},
+		{
+			From: int(models.FairLaunchMintedStateSentPending),
+			To:   []workflow.State{int(models.FairLaunchMintedStateSent)},
+			Load: func() (*[]models.FairLaunchMintedInfo, error) {
+				return GetValidFairLaunchMintedInfosByState(models.FairLaunchMintedStateSentPending)
+			},
+			Handle: func(tx *gorm.DB, fairLaunchMintedInfo *models.FairLaunchMintedInfo) error {
+				listTransfersResponse, err := api.ListTransfersAndGetResponse()
+				if err != nil {
+					return utils.AppendErrorInfo(err, "List Transfers And Get Response")
+				}
+				return ProcessFairLaunchMintedStateSentPendingInfo(tx, fairLaunchMintedInfo, listTransfersResponse)
+			},
+		},
+	},
+})
+
+// failFairLaunchMintedInfo fails a minted info, refunding the mint fee when it has been paid.
+func failFairLaunchMintedInfo(tx *gorm.DB, fairLaunchMintedInfo *models.FairLaunchMintedInfo, reason string) error {
+	if fairLaunchMintedInfo.MintFeePaidID == 0 {
+		return SetFairLaunchMintedInfoFail(tx, fairLaunchMintedInfo)
+	}
+	_, err := CancelAndRefundFairLaunchMintedInfo(tx, int(fairLaunchMintedInfo.ID))
+	if err != nil {
+		return utils.AppendErrorInfo(err, "CancelAndRefundFairLaunchMintedInfo")
+	}
+	fairLaunchMintedInfo.State = models.FairLaunchMintedStateFail
+	return nil
+}
+
+// The nft presale handlers write through the default db, the runs pass it as tx.
+var nftPresaleWorkflow = workflow.New(workflow.Definition[models.NftPresale]{
+	Name: "nft_presale",
+	Id: func(nftPresale *models.NftPresale) uint {
+		return nftPresale.ID
+	},
+	State: func(nftPresale *models.NftPresale) workflow.State {
+		return int(nftPresale.State)
+	},
+	Attempt: func(tx *gorm.DB, nftPresale *models.NftPresale) error {
+		return IncreaseNftPresaleProcessNumber(nftPresale)
+	},
+	Fail: func(tx *gorm.DB, nftPresale *models.NftPresale, reason string) error {
+		return SetNftPresaleFail(nftPresale)
+	},
+	Retry: processRetryPolicy,
+	Transitions: []workflow.Transition[models.NftPresale]{
+		{
+			From:   int(models.NftPresaleStateBoughtNotPay),
+			To:     []workflow.State{int(models.NftPresaleStatePaidPending)},
+			Load:   GetAllNftPresaleStateBoughtNotPay,
+			Handle: nftPresaleHandler(ProcessNftPresaleStateBoughtNotPayService),
+			Retry:  &payRetryPolicy,
+		},
+		{
+			From:   int(models.NftPresaleStatePaidPending),
+			To:     []workflow.State{int(models.NftPresaleStatePaidNotSend), models.NftPresaleStateFailOrCanceled},
+			Load:   GetAllNftPresaleStatePaidPending,
+			Handle: nftPresaleHandler(ProcessNftPresaleStatePaidPendingService),
+		},
+		{
+			From:   int(models.NftPresaleStatePaidNotSend),
+			To:     []workflow.State{int(models.NftPresaleStateSentPending)},
+			Load:   GetAllNftPresaleStatePaidNotSend,
+			Handle: nftPresaleHandler(ProcessNftPresaleStatePaidNotSendService),
+		},
+		{
+			From:   int(models.NftPresaleStateSentPending),
+			To:     []workflow.State{int(models.NftPresaleStateSent)},
+			Load:   GetAllNftPresaleStateSentPending,
+			Handle: nftPresaleHandler(ProcessNftPresaleStateSentPendingService),
+		},
+	},
+})
+
+// An ido fails by its status, it stays in the state it failed in and is no longer loaded. The attempts are
+// counted through the default db, the refund handler commits its label and the gas fee handlers their claims on
+// the same row around the calls.
+var idoPublishInfoWorkflow = workflow.New(workflow.Definition[models.IdoPublishInfo]{
+	Name: "ido_publish_info",
+	Id: func(idoPublishInfo *models.IdoPublishInfo) uint {
+		return idoPublishInfo.ID
+	},
+	State: func(idoPublishInfo *models.IdoPublishInfo) workflow.State {
+		return int(idoPublishInfo.State)
+	},
+	Attempt: func(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo) error {
+		idoPublishInfo.ProcessNumber += 1
+		return middleware.DB.Model(idoPublishInfo).Update("process_number", idoPublishInfo.ProcessNumber).Error
+	},
+	Fail: func(tx *gorm.DB, idoPublishInfo *models.IdoPublishInfo, reason string) error {
+		return SetIdoPublishInfoFail(tx, idoPublishInfo)
+	},
+	Retry: processRetryPolicy,
+	Transitions: []workflow.Transition[models.IdoPublishInfo]{
+		{
+			From: int(models.IdoPublishStateNoPay),
+			To:   []workflow.State{int(models.IdoPublishStatePaidPending)},
+			Load: func() (*[]models.IdoPublishInfo, error) {
+				return GetAllIdoPublishInfosByState(models.IdoPublishStateNoPay)
+			},
+			Handle: ProcessIdoPublishStateNoPayInfo,
+			Retry:  &payRetryPolicy,
+		},
+		{
+			From: int(models.IdoPublishStatePaidPending),
+			To:   []workflow.State{int(models.IdoPublishStatePaidNoPublish)},
+			Load: func() (*[]models.IdoPublishInfo, error) {
+				return GetAllIdoPublishInfosByState(models.IdoPublishStatePaidPending)
+			},
+			Handle: ProcessIdoPublishStatePaidPendingInfo,
+		},
+		{
+			From: int(models.IdoPublishStatePaidNoPublish),
+			To:   []workflow.State{int(models.IdoPublishStatePublishedPending), int(models.IdoPublishStatePublished)},
+			Load: func() (*[]models.IdoPublishInfo, error) {
+				return GetAllIdoPublishInfosByState(models.IdoPublishStatePaidNoPublish)
+			},
+			Handle: ProcessIdoPublishStatePaidNoPublishInfo,
+		},
+		{
+			From: int(models.IdoPublishStatePublishedPending),
+			To:   []workflow.State{int(models.IdoPublishStatePublished)},
+			Load: func() (*[]models.IdoPublishInfo, error) {
+				return GetAllIdoPublishInfosByState(models.IdoPublishStatePublishedPending)
+			},
+			Handle: ProcessIdoPublishStatePublishedPendingInfo,
+		},
+		{
+			From:   int(models.IdoPublishStatePublished),
+			To:     []workflow.State{int(models.IdoPublishStateRefundedPending), int(models.IdoPublishStateRefunded)},
+			Load:   GetAllIdoPublishInfosToSettle,
+			Handle: SettleIdoPublishInfo,
+		},
+		{
+			From: int(models.IdoPublishStateRefundedPending),
+			To:   []workflow.State{int(models.IdoPublishStateRefunded)},
+			Load: func() (*[]models.IdoPublishInfo, error) {
+				return GetAllIdoPublishInfosByState(models.IdoPublishStateRefundedPending)
+			},
+			Handle: ProcessIdoPublishStateRefundedPendingInfo,
+		},
+	},
+})
+
+// The participations paid and not sent are sent in batches by SendIdoParticipateAssetBatches, outside the
+// workflow. The payment is retried until the participate time is over, the handler drops it then. The
+// attempts are counted through the default db, the gas fee is claimed and recorded on the same row around
+// its payment.
+var idoParticipateInfoWorkflow = workflow.New(workflow.Definition[models.IdoParticipateInfo]{
+	Name: "ido_participate_info",
+	Id: func(idoParticipateInfo *models.IdoParticipateInfo) uint {
+		return idoParticipateInfo.ID
+	},
+	State: func(idoParticipateInfo *models.IdoParticipateInfo) workflow.State {
+		return int(idoParticipateInfo.State)
+	},
+	Attempt: func(tx *gorm.DB, idoParticipateInfo *models.IdoParticipateInfo) error {
+		idoParticipateInfo.ProcessNumber += 1
+		return middleware.DB.Model(idoParticipateInfo).Update("process_number", idoParticipateInfo.ProcessNumber).Error
+	},
+	Fail: func(tx *gorm.DB, idoParticipateInfo *models.IdoParticipateInfo, reason string) error {
+		return SetIdoParticipateInfoFail(tx, idoParticipateInfo)
+	},
+	Retry: processRetryPolicy,
+	Transitions: []workflow.Transition[models.IdoParticipateInfo]{
+		{
+			From: int(models.IdoParticipateStateNoPay),
+			To:   []workflow.State{int(models.IdoParticipateStatePaidPending)},
+			Load: func() (*[]models.IdoParticipateInfo, error) {
+				return GetAllIdoParticipateInfosByState(models.IdoParticipateStateNoPay)
+			},
+			Handle: ProcessIdoParticipateStateNoPayInfo,
+		},
+		{
+			From: int(models.IdoParticipateStatePaidPending),
+			To:   []workflow.State{int(models.IdoParticipateStatePaidNoSend)},
+			Load: func() (*[]models.IdoParticipateInfo, error) {
+				return GetAllIdoParticipateInfosByState(models.IdoParticipateStatePaidPending)
+			},
+			Handle: ProcessIdoParticipateStatePaidPendingInfo,
+		},
+		{
+			From: int(models.IdoParticipateStateSentPending),
+			To:   []workflow.State{int(models.IdoParticipateStateSent)},
+			Load: func() (*[]models.IdoParticipateInfo, error) {
+				return GetAllIdoParticipateInfosByState(models.IdoParticipateStateSentPending)
+			},
+			Handle: ProcessIdoParticipateStateSentPendingInfo,
+		},
+	},
+})
+
+func nftPresaleHandler(process func(nftPresale *models.NftPresale) error) workflow.Handler[models.NftPresale] {
+	return func(tx *gorm.DB, nftPresale *models.NftPresale) error {
+		return process(nftPresale)
+	}
+}
+
+// workflowProcessionResults turns the results of a workflow run into procession results.
+func workflowProcessionResults(results []workflow.Result, err error) (*[]ProcessionResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	var processionResults []ProcessionResult
+	for _, result := range results {
+		processionResult := ProcessionResult{
+			Id: int(result.Id),
+			JsonResult: models.JsonResult{
+				Success: true,
+				Error:   "",
+				Data:    nil,
+			},
+		}
+		if result.Err != nil {
+			processionResult.Success = false
+			processionResult.Error = result.Err.Error()
+		}
+		processionResults = append(processionResults, processionResult)
+	}
+	if len(processionResults) == 0 {
+		return nil, errors.New("procession results null")
+	}
+	return &processionResults, nil
+}
@@ -27,6 +27,7 @@ const (
 	LpAwardFeeK      uint16 = 3
 )
 
+// SwapFeeK is the default pool swap fee, used for swap records written before per pair fee tiers.
 const (
 	SwapFeeK uint16 = ProjectPartyFeeK + LpAwardFeeK
 )
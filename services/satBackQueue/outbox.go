@@ -0,0 +1,257 @@
+package satBackQueue
+
+import (
+	"encoding/json"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"sync"
+	"time"
+	"trade/btlLog"
+	"trade/config"
+	"trade/middleware"
+	"trade/models"
+	"trade/utils"
+)
+
+const (
+	defaultEndpoint          = "http://172.27.16.10:7040"
+	defaultTimeoutSecond     = 10
+	defaultDispatchBatchSize = 100
+	defaultMaxAttempts       = 12
+	defaultBaseBackoffSecond = 10
+	defaultMaxBackoffSecond  = 3600
+)
+
+type OutboxEventStatus int
+
+const (
+	OutboxEventStatusPending OutboxEventStatus = iota
+	OutboxEventStatusDelivered
+	OutboxEventStatusDeadLetter
+)
+
+// PushOutboxEvent is a queue message written in the same transaction as the business row it reports.
+// Qid is derived from the topic and the row id, so enqueuing a row twice keeps one event and the queue
+// receives the same qid on every retry.
+type PushOutboxEvent struct {
+	gorm.Model
+	Topic         queueTopic        `json:"topic" gorm:"type:varchar(255);index"`
+	InfoID        uint              `json:"info_id" gorm:"index"`
+	Qid           string            `json:"qid" gorm:"type:varchar(255);uniqueIndex"`
+	Data          string            `json:"data"`
+	Status        OutboxEventStatus `json:"status" gorm:"index"`
+	Attempts      int               `json:"attempts"`
+	NextAttemptAt int64             `json:"next_attempt_at" gorm:"index"`
+	LastError     string            `json:"last_error" gorm:"type:varchar(255)"`
+	ResponseBody  string            `json:"response_body"`
+	Rid           string            `json:"rid" gorm:"type:varchar(255);index"`
+	DeliveredAt   int64             `json:"delivered_at"`
+}
+
+var outboxDispatchMutex sync.Mutex
+
+func queueEndpoint() string {
+	endpoint := config.GetConfig().SatBackQueue.Endpoint
+	if endpoint == "" {
+		return defaultEndpoint
+	}
+	return endpoint
+}
+
+func queueConfigInt(value int, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// outboxBackoff doubles the delay after every failed attempt, from the base delay up to the max delay.
+func outboxBackoff(attempts int) time.Duration {
+	cfg := config.GetConfig().SatBackQueue
+	base := time.Duration(queueConfigInt(cfg.BaseBackoffSecond, defaultBaseBackoffSecond)) * time.Second
+	max := time.Duration(queueConfigInt(cfg.MaxBackoffSecond, defaultMaxBackoffSecond)) * time.Second
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+func enqueueOutboxEvent(tx *gorm.DB, topic queueTopic, infoId uint, info any) (err error) {
+	qid, err := utils.Sha256(TopicAndInfoId{
+		Topic:  topic,
+		InfoID: infoId,
+	})
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Sha256")
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Marshal info")
+	}
+	request, err := json.Marshal(Request{
+		Data: string(data),
+	})
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Marshal request")
+	}
+	event := PushOutboxEvent{
+		Topic:         topic,
+		InfoID:        infoId,
+		Qid:           qid,
+		Data:          string(request),
+		Status:        OutboxEventStatusPending,
+		NextAttemptAt: time.Now().Unix(),
+	}
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&event).Error
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Create PushOutboxEvent")
+	}
+	return nil
+}
+
+func EnqueueClaimAsset(tx *gorm.DB, info FeeInfo) error {
+	return enqueueOutboxEvent(tx, claimAsset, info.ID, info)
+}
+
+func EnqueuePurchasePresaleNFT(tx *gorm.DB, info FeeInfo) error {
+	return enqueueOutboxEvent(tx, purchasePresaleNFT, info.ID, info)
+}
+
+func EnqueueSwapTr(tx *gorm.DB, info SwapTr) error {
+	return enqueueOutboxEvent(tx, swap_tr, info.ID, info)
+}
+
+// markInfoPushed flags the source row, which keeps the backfill scans from enqueuing it again.
+func markInfoPushed(tx *gorm.DB, topic queueTopic, infoId uint) error {
+	switch topic {
+	case claimAsset:
+		return tx.Model(&models.FairLaunchMintedInfo{}).Where("id = ?", infoId).Update("is_pushed_queue", true).Error
+	case purchasePresaleNFT:
+		return tx.Model(&models.NftPresale{}).Where("id = ?", infoId).Update("is_pushed_queue", true).Error
+	case swap_tr:
+		return tx.Table("pool_swap_records").Where("id = ?", infoId).Update("is_pushed_queue", true).Error
+	default:
+		return nil
+	}
+}
+
+// deliverOutboxEvent pushes the event and records the attempt. The bookkeeping commits on its own, so a failed
+// push still spends an attempt and moves the next attempt out.
+func deliverOutboxEvent(event *PushOutboxEvent) error {
+	var request Request
+	err := json.Unmarshal([]byte(event.Data), &request)
+	if err != nil {
+		return utils.AppendErrorInfo(err, "Unmarshal request")
+	}
+	response, pushErr := Push(event.Topic, event.Qid, request)
+	if pushErr == nil && response.Errno != 0 {
+		pushErr = errors.New("errno(" + strconv.Itoa(response.Errno) + ") " + response.ErrMsg)
+	}
+
+	event.Attempts++
+	if pushErr != nil {
+		event.LastError = pushErr.Error()
+		if len(event.LastError) > 255 {
+			event.LastError = event.LastError[:255]
+		}
+		if event.Attempts >= queueConfigInt(config.GetConfig().SatBackQueue.MaxAttempts, defaultMaxAttempts) {
+			event.Status = OutboxEventStatusDeadLetter
+		} else {
+			event.NextAttemptAt = time.Now().Add(outboxBackoff(event.Attempts)).Unix()
+		}
+		err = middleware.DB.Save(event).Error
+		if err != nil {
+			return utils.AppendErrorInfo(err, "Save PushOutboxEvent")
+		}
+		return utils.AppendErrorInfo(pushErr, "Push")
+	}
+
+	responseBody, _ := json.Marshal(response)
+	event.Status = OutboxEventStatusDelivered
+	event.LastError = ""
+	event.ResponseBody = string(responseBody)
+	event.Rid = response.Data.Rid
+	event.DeliveredAt = time.Now().Unix()
+	return middleware.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Save(event).Error
+		if err != nil {
+			return utils.AppendErrorInfo(err, "Save PushOutboxEvent")
+		}
+		err = markInfoPushed(tx, event.Topic, event.InfoID)
+		if err != nil {
+			return utils.AppendErrorInfo(err, "markInfoPushed")
+		}
+		return nil
+	})
+}
+
+// DispatchOutboxEvents delivers due pending events in id order. A failed delivery is retried with
+// exponential backoff and moved to the dead letter state after the configured number of attempts.
+func DispatchOutboxEvents() {
+	outboxDispatchMutex.Lock()
+	defer outboxDispatchMutex.Unlock()
+
+	var events []PushOutboxEvent
+	err := middleware.DB.
+		Where("status = ? AND next_attempt_at <= ?", OutboxEventStatusPending, time.Now().Unix()).
+		Order("id").
+		Limit(queueConfigInt(config.GetConfig().SatBackQueue.DispatchBatchSize, defaultDispatchBatchSize)).
+		Find(&events).Error
+	if err != nil {
+		btlLog.PushQueue.Error("%v", utils.AppendErrorInfo(err, "Find PushOutboxEvent"))
+		return
+	}
+	for i := range events {
+		err = deliverOutboxEvent(&events[i])
+		if err != nil {
+			btlLog.PushQueue.Error("deliver %v(%v) qid %v: %v", events[i].Topic, events[i].InfoID, events[i].Qid, err)
+		}
+	}
+}
+
+// stuckOutboxEvents selects dead letter events and pending events that already failed at least once.
+func stuckOutboxEvents() *gorm.DB {
+	return middleware.DB.Model(&PushOutboxEvent{}).
+		Where("status = ? OR (status = ? AND attempts > 0)", OutboxEventStatusDeadLetter, OutboxEventStatusPending)
+}
+
+func QueryStuckOutboxEventsCount() (count int64, err error) {
+	err = stuckOutboxEvents().Count(&count).Error
+	if err != nil {
+		return 0, utils.AppendErrorInfo(err, "Count PushOutboxEvent")
+	}
+	return count, nil
+}
+
+func QueryStuckOutboxEvents(limit int, offset int) (events *[]PushOutboxEvent, err error) {
+	events = new([]PushOutboxEvent)
+	err = stuckOutboxEvents().Order("id").Limit(limit).Offset(offset).Find(events).Error
+	if err != nil {
+		return new([]PushOutboxEvent), utils.AppendErrorInfo(err, "Find PushOutboxEvent")
+	}
+	return events, nil
+}
+
+// ReplayOutboxEvent puts an undelivered event back in the queue with a fresh attempt budget.
+func ReplayOutboxEvent(id uint) (err error) {
+	result := middleware.DB.Model(&PushOutboxEvent{}).
+		Where("id = ? AND status <> ?", id, OutboxEventStatusDelivered).
+		Updates(map[string]any{
+			"status":          OutboxEventStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().Unix(),
+		})
+	if result.Error != nil {
+		return utils.AppendErrorInfo(result.Error, "Update PushOutboxEvent")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("outbox event(" + strconv.FormatUint(uint64(id), 10) + ") does not exist or is delivered")
+	}
+	return nil
+}
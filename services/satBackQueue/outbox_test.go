@@ -0,0 +1,186 @@
+package satBackQueue
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"trade/config"
+	"trade/middleware"
+	"trade/middleware/dbtest"
+	"trade/models"
+)
+
+// queueStub is a local sat back queue answering every push with the next queued response.
+type queueStub struct {
+	mu        sync.Mutex
+	responses []func(w http.ResponseWriter)
+	qids      []string
+}
+
+func (s *queueStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.qids = append(s.qids, r.URL.Query().Get("qid"))
+	if len(s.responses) == 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	respond := s.responses[0]
+	s.responses = s.responses[1:]
+	respond(w)
+}
+
+func respondJson(response Response) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+func respondGarbage(w http.ResponseWriter) {
+	_, _ = w.Write([]byte("bad gateway"))
+}
+
+func setupOutboxTest(t *testing.T, stub *queueStub) {
+	t.Helper()
+	db := dbtest.Use(t, &PushOutboxEvent{}, &models.RestRecord{})
+	err := db.Exec("CREATE TABLE pool_swap_records (id integer PRIMARY KEY, is_pushed_queue boolean DEFAULT false)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(stub)
+
+	oldQueue := config.GetConfig().SatBackQueue
+	config.GetConfig().SatBackQueue.Endpoint = server.URL
+	config.GetConfig().SatBackQueue.MaxAttempts = 3
+	config.GetConfig().SatBackQueue.BaseBackoffSecond = 10
+	config.GetConfig().SatBackQueue.MaxBackoffSecond = 15
+	t.Cleanup(func() {
+		server.Close()
+		config.GetConfig().SatBackQueue = oldQueue
+	})
+}
+
+func enqueueTestSwapTr(t *testing.T, id uint) PushOutboxEvent {
+	t.Helper()
+	err := middleware.DB.Exec("INSERT INTO pool_swap_records (id) VALUES (?)", id).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = EnqueueSwapTr(middleware.DB, SwapTr{ID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event PushOutboxEvent
+	err = middleware.DB.Where("info_id = ?", id).First(&event).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func reloadOutboxEvent(t *testing.T, id uint) PushOutboxEvent {
+	t.Helper()
+	var event PushOutboxEvent
+	err := middleware.DB.First(&event, id).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestDeliverOutboxEventFailureKeepsBookkeeping(t *testing.T) {
+	stub := &queueStub{responses: []func(w http.ResponseWriter){
+		respondGarbage,
+		respondJson(Response{Errno: 7, ErrMsg: "busy"}),
+		respondGarbage,
+	}}
+	setupOutboxTest(t, stub)
+	event := enqueueTestSwapTr(t, 1)
+
+	before := time.Now().Unix()
+	if err := deliverOutboxEvent(&event); err == nil {
+		t.Fatal("expected push error")
+	}
+	stored := reloadOutboxEvent(t, event.ID)
+	if stored.Attempts != 1 || stored.Status != OutboxEventStatusPending {
+		t.Fatalf("after first failure attempts %d status %d, want 1 pending", stored.Attempts, stored.Status)
+	}
+	if stored.NextAttemptAt < before+10 {
+		t.Fatalf("next attempt at %d, want at least %d", stored.NextAttemptAt, before+10)
+	}
+	if stored.LastError == "" {
+		t.Fatal("last error is empty")
+	}
+
+	if err := deliverOutboxEvent(&stored); err == nil {
+		t.Fatal("expected errno error")
+	}
+	stored = reloadOutboxEvent(t, event.ID)
+	if stored.Attempts != 2 || stored.Status != OutboxEventStatusPending {
+		t.Fatalf("after errno attempts %d status %d, want 2 pending", stored.Attempts, stored.Status)
+	}
+	if stored.NextAttemptAt > time.Now().Unix()+15 {
+		t.Fatalf("next attempt at %d exceeds the max backoff", stored.NextAttemptAt)
+	}
+
+	if err := deliverOutboxEvent(&stored); err == nil {
+		t.Fatal("expected push error")
+	}
+	stored = reloadOutboxEvent(t, event.ID)
+	if stored.Attempts != 3 || stored.Status != OutboxEventStatusDeadLetter {
+		t.Fatalf("after last attempt attempts %d status %d, want 3 dead letter", stored.Attempts, stored.Status)
+	}
+
+	var pushed bool
+	middleware.DB.Raw("SELECT is_pushed_queue FROM pool_swap_records WHERE id = ?", 1).Scan(&pushed)
+	if pushed {
+		t.Fatal("undelivered swap record is marked pushed")
+	}
+	for _, qid := range stub.qids {
+		if qid != event.Qid {
+			t.Fatalf("retry sent qid %s, want %s", qid, event.Qid)
+		}
+	}
+}
+
+func TestDeliverOutboxEventSuccessMarksInfoPushed(t *testing.T) {
+	stub := &queueStub{responses: []func(w http.ResponseWriter){
+		respondGarbage,
+		respondJson(Response{Data: ResponseData{Rid: "rid-1"}}),
+	}}
+	setupOutboxTest(t, stub)
+	event := enqueueTestSwapTr(t, 2)
+
+	if err := deliverOutboxEvent(&event); err == nil {
+		t.Fatal("expected push error")
+	}
+	stored := reloadOutboxEvent(t, event.ID)
+	if err := deliverOutboxEvent(&stored); err != nil {
+		t.Fatal(err)
+	}
+	stored = reloadOutboxEvent(t, event.ID)
+	if stored.Status != OutboxEventStatusDelivered || stored.Attempts != 2 || stored.Rid != "rid-1" || stored.LastError != "" {
+		t.Fatalf("delivered event %+v", stored)
+	}
+	var pushed bool
+	middleware.DB.Raw("SELECT is_pushed_queue FROM pool_swap_records WHERE id = ?", 2).Scan(&pushed)
+	if !pushed {
+		t.Fatal("delivered swap record is not marked pushed")
+	}
+}
+
+func TestEnqueueOutboxEventIsIdempotent(t *testing.T) {
+	setupOutboxTest(t, &queueStub{})
+	event := enqueueTestSwapTr(t, 3)
+	if err := EnqueueSwapTr(middleware.DB, SwapTr{ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	middleware.DB.Model(&PushOutboxEvent{}).Where("qid = ?", event.Qid).Count(&count)
+	if count != 1 {
+		t.Fatalf("enqueued %d events for one row, want 1", count)
+	}
+}
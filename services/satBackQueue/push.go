@@ -6,14 +6,15 @@ import (
 	"gorm.io/gorm"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 	"trade/btlLog"
+	"trade/config"
 	"trade/middleware"
 	"trade/models"
 	"trade/utils"
 )
 
-const host = "172.27.16.10:7040"
-
 type queueTopic string
 
 const (
@@ -73,7 +74,7 @@ func Push(topic queueTopic, qid string, request Request) (Response, error) {
 }
 
 func Post(topic queueTopic, qid string, data any) ([]byte, error) {
-	url := "http:
+	url := queueEndpoint() + "/" + topic.String() + "?qid=" + qid
 	requestJsonBytes, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
@@ -86,7 +87,10 @@ func Post(topic queueTopic, qid string, data any) ([]byte, error) {
 
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("content-type", "application/json")
-	res, err := http.DefaultClient.Do(req)
+	client := &http.Client{
+		Timeout: time.Duration(queueConfigInt(config.GetConfig().SatBackQueue.TimeoutSecond, defaultTimeoutSecond)) * time.Second,
+	}
+	res, err := client.Do(req)
 	if err != nil {
 
 		func(url string, method string, req *http.Request, res *http.Response, err error) {
@@ -154,67 +158,6 @@ func Post(topic queueTopic, qid string, data any) ([]byte, error) {
 	return body, nil
 }
 
-func PushClaimAsset(info FeeInfo) (string, string, Response, error) {
-	topic := claimAsset
-
-	qid, err := utils.Sha256(TopicAndInfoId{
-		Topic:  topic,
-		InfoID: info.ID,
-	})
-
-	data, err := json.Marshal(info)
-	if err != nil {
-		return "", "", Response{}, err
-	}
-	request := Request{
-		Data: string(data),
-	}
-	var response Response
-	response, err = Push(topic, qid, request)
-
-	return qid, string(data), response, err
-}
-
-func PushPurchasePresaleNFT(info FeeInfo) (string, string, Response, error) {
-	topic := purchasePresaleNFT
-
-	qid, err := utils.Sha256(TopicAndInfoId{
-		Topic:  topic,
-		InfoID: info.ID,
-	})
-
-	data, err := json.Marshal(info)
-	if err != nil {
-		return "", "", Response{}, err
-	}
-	request := Request{
-		Data: string(data),
-	}
-	var response Response
-	response, err = Push(topic, qid, request)
-	return qid, string(data), response, err
-}
-
-func PushSwapTr(info SwapTr) (qid string, data string, response Response, err error) {
-	topic := swap_tr
-
-	qid, err = utils.Sha256(TopicAndInfoId{
-		Topic:  topic,
-		InfoID: info.ID,
-	})
-
-	_data, err := json.Marshal(info)
-	if err != nil {
-		return "", "", Response{}, err
-	}
-	request := Request{
-		Data: string(_data),
-	}
-	response, err = Push(topic, qid, request)
-
-	return qid, string(_data), response, err
-}
-
 type fairLaunchMintedInfoRecord struct {
 	Id           uint   `json:"id"`
 	AssetID      string `json:"asset_id"`
@@ -298,147 +241,34 @@ type PushQueueRecord struct {
 	Error        string     `json:"error" gorm:"type:varchar(255);index"`
 }
 
+// GetAndPushClaimAsset enqueues paid fair launch mints that have no outbox event yet, such as rows written before the outbox.
+// Delivery is left to DispatchOutboxEvents.
 func GetAndPushClaimAsset() {
-	topic := claimAsset
 	feeInfos, err := GetNotPushedClaimAsset()
 	if err != nil {
 		btlLog.PushQueue.Error("%v", utils.AppendErrorInfo(err, "GetNotPushedClaimAsset"))
 	}
 	for _, feeInfo := range feeInfos {
-
-		tx := middleware.DB.Begin()
-
-		var response Response
-		var qid, data string
-		qid, data, response, err = PushClaimAsset(feeInfo)
-		responseBody, _ := json.Marshal(response)
-		if err != nil {
-			var pushQueueRecord = PushQueueRecord{
-				InfoID:       feeInfo.ID,
-				NpubKey:      feeInfo.NpubKey,
-				AssetsID:     feeInfo.AssetsID,
-				HandFee:      feeInfo.HandFee,
-				Topic:        topic,
-				Qid:          qid,
-				Data:         data,
-				IsSuccess:    false,
-				ResponseBody: "",
-				Rid:          "",
-				Error:        err.Error(),
-			}
-			_err := tx.Model(&PushQueueRecord{}).Create(&pushQueueRecord).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Create _err:\n%v\nPQR:\n%v", _err, utils.ValueJsonString(pushQueueRecord))
-				tx.Rollback()
-				continue
-			}
-		} else {
-			var pushQueueRecord = PushQueueRecord{
-				InfoID:       feeInfo.ID,
-				NpubKey:      feeInfo.NpubKey,
-				AssetsID:     feeInfo.AssetsID,
-				HandFee:      feeInfo.HandFee,
-				Topic:        topic,
-				Qid:          qid,
-				Data:         data,
-				IsSuccess:    true,
-				ResponseBody: string(responseBody),
-				Rid:          response.Data.Rid,
-				Error:        "",
-			}
-			_err := tx.Model(&PushQueueRecord{}).Create(&pushQueueRecord).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Create _err:\n%v\nPQR:\n%v", _err, utils.ValueJsonString(pushQueueRecord))
-				tx.Rollback()
-				continue
-			}
-			_err = tx.Model(&models.FairLaunchMintedInfo{}).
-				Where("id = ?", feeInfo.ID).
-				Update("is_pushed_queue", true).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Update FairLaunchMintedInfo _err:\n%v\nid:\n%v", _err, feeInfo.ID)
-				tx.Rollback()
-				continue
-			}
-		}
-		err = tx.Commit().Error
+		err = EnqueueClaimAsset(middleware.DB, feeInfo)
 		if err != nil {
-			btlLog.PushQueue.Error("Commit err:\n%v", err)
+			btlLog.PushQueue.Error("%v", utils.AppendErrorInfo(err, "EnqueueClaimAsset("+strconv.FormatUint(uint64(feeInfo.ID), 10)+")"))
 		}
 	}
-	return
 }
 
+// GetAndPushPurchasePresaleNFT enqueues paid nft presales that have no outbox event yet, such as rows written before the outbox.
+// Delivery is left to DispatchOutboxEvents.
 func GetAndPushPurchasePresaleNFT() {
-	topic := purchasePresaleNFT
 	feeInfos, err := GetNotPushedPurchasePresaleNFT()
 	if err != nil {
 		btlLog.PushQueue.Error("%v", utils.AppendErrorInfo(err, "GetNotPushedPurchasePresaleNFT"))
 	}
 	for _, feeInfo := range feeInfos {
-
-		tx := middleware.DB.Begin()
-
-		var response Response
-		var qid, data string
-		qid, data, response, err = PushPurchasePresaleNFT(feeInfo)
-		responseBody, _ := json.Marshal(response)
-
-		if err != nil {
-			var pushQueueRecord = PushQueueRecord{
-				InfoID:       feeInfo.ID,
-				NpubKey:      feeInfo.NpubKey,
-				AssetsID:     feeInfo.AssetsID,
-				HandFee:      feeInfo.HandFee,
-				Topic:        topic,
-				Qid:          qid,
-				Data:         data,
-				IsSuccess:    false,
-				ResponseBody: "",
-				Rid:          "",
-				Error:        err.Error(),
-			}
-			_err := tx.Model(&PushQueueRecord{}).Create(&pushQueueRecord).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Create _err:\n%v\nPQR:\n%v", _err, utils.ValueJsonString(pushQueueRecord))
-				tx.Rollback()
-				continue
-			}
-		} else {
-			var pushQueueRecord = PushQueueRecord{
-				InfoID:       feeInfo.ID,
-				NpubKey:      feeInfo.NpubKey,
-				AssetsID:     feeInfo.AssetsID,
-				HandFee:      feeInfo.HandFee,
-				Topic:        topic,
-				Qid:          qid,
-				Data:         data,
-				IsSuccess:    true,
-				ResponseBody: string(responseBody),
-				Rid:          response.Data.Rid,
-				Error:        "",
-			}
-			_err := tx.Model(&PushQueueRecord{}).Create(&pushQueueRecord).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Create _err:\n%v\nPQR:\n%v", _err, utils.ValueJsonString(pushQueueRecord))
-				tx.Rollback()
-				continue
-			}
-			_err = tx.Model(&models.NftPresale{}).
-				Where("id = ?", feeInfo.ID).
-				Update("is_pushed_queue", true).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Update NftPresale _err:\n%v\nid:\n%v", _err, feeInfo.ID)
-				tx.Rollback()
-				continue
-			}
-		}
-		err = tx.Commit().Error
+		err = EnqueuePurchasePresaleNFT(middleware.DB, feeInfo)
 		if err != nil {
-			btlLog.PushQueue.Error("Commit err:\n%v", err)
+			btlLog.PushQueue.Error("%v", utils.AppendErrorInfo(err, "EnqueuePurchasePresaleNFT("+strconv.FormatUint(uint64(feeInfo.ID), 10)+")"))
 		}
 	}
-	return
 }
 
 type SwapTrPushQueueRecord struct {
@@ -460,82 +290,17 @@ type SwapTrPushQueueRecord struct {
 	Error        string     `json:"error" gorm:"type:varchar(255);index"`
 }
 
+// GetAndPushSwapTrs enqueues pool swap records that have no outbox event yet, such as rows written before the outbox.
+// Delivery is left to DispatchOutboxEvents.
 func GetAndPushSwapTrs() {
-	topic := swap_tr
 	swapTrs, err := GetNotPushedSwapTrs()
 	if err != nil {
 		btlLog.PushQueue.Error("%v", utils.AppendErrorInfo(err, "GetNotPushedSwapTrs"))
 	}
 	for _, swapTr := range swapTrs {
-
-		tx := middleware.DB.Begin()
-
-		var response Response
-		var qid, data string
-		qid, data, response, err = PushSwapTr(swapTr)
-		responseBody, _ := json.Marshal(response)
-
-		if err != nil {
-			var pushQueueRecord = SwapTrPushQueueRecord{
-				SwapTrID:     swapTr.ID,
-				Price:        swapTr.Price,
-				Number:       swapTr.Number,
-				TotalPrice:   swapTr.TotalPrice,
-				NpubKey:      swapTr.NpubKey,
-				TrUnixtimeMs: swapTr.TrUnixtimeMs,
-				AssetsID:     swapTr.AssetsID,
-				Type:         swapTr.Type,
-				Topic:        topic,
-				Qid:          qid,
-				Data:         data,
-				IsSuccess:    false,
-				ResponseBody: "",
-				Rid:          "",
-				Error:        err.Error(),
-			}
-			_err := tx.Model(&SwapTrPushQueueRecord{}).Create(&pushQueueRecord).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Create _err:\n%v\nPQR:\n%v", _err, utils.ValueJsonString(pushQueueRecord))
-				tx.Rollback()
-				continue
-			}
-		} else {
-			var pushQueueRecord = SwapTrPushQueueRecord{
-				SwapTrID:     swapTr.ID,
-				Price:        swapTr.Price,
-				Number:       swapTr.Number,
-				TotalPrice:   swapTr.TotalPrice,
-				NpubKey:      swapTr.NpubKey,
-				TrUnixtimeMs: swapTr.TrUnixtimeMs,
-				AssetsID:     swapTr.AssetsID,
-				Type:         swapTr.Type,
-				Topic:        topic,
-				Qid:          qid,
-				Data:         data,
-				IsSuccess:    true,
-				ResponseBody: string(responseBody),
-				Rid:          response.Data.Rid,
-				Error:        "",
-			}
-			_err := tx.Model(&SwapTrPushQueueRecord{}).Create(&pushQueueRecord).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Create _err:\n%v\nPQR:\n%v", _err, utils.ValueJsonString(pushQueueRecord))
-				tx.Rollback()
-				continue
-			}
-			_err = tx.Table("pool_swap_records").
-				Where("id = ?", swapTr.ID).
-				Update("is_pushed_queue", true).Error
-			if _err != nil {
-				btlLog.PushQueue.Error("Update NftPresale _err:\n%v\nid:\n%v", _err, swapTr.ID)
-				tx.Rollback()
-				continue
-			}
-		}
-		err = tx.Commit().Error
+		err = EnqueueSwapTr(middleware.DB, swapTr)
 		if err != nil {
-			btlLog.PushQueue.Error("Commit err:\n%v", err)
+			btlLog.PushQueue.Error("%v", utils.AppendErrorInfo(err, "EnqueueSwapTr("+strconv.FormatUint(uint64(swapTr.ID), 10)+")"))
 		}
 	}
-	return
 }
@@ -18,6 +18,8 @@ type SwapTr struct {
 	AssetsID     string `json:"assets_id"`
 	Type         string `json:"type"`
 	SwapFee      string `json:"swap_fee"`
+	SwapFeeK     uint16 `json:"swap_fee_k"`
+	FeeTierId    uint   `json:"fee_tier_id"`
 }
 
 const (
@@ -34,6 +36,9 @@ type SwapTrsScan struct {
 	CalcPriceAmountIn  string    `json:"calc_price_amount_in"`
 	CalcPriceAmountOut string    `json:"calc_price_amount_out"`
 	SwapFee            string    `json:"swap_fee"`
+	FeeTierId          uint      `json:"fee_tier_id"`
+	ProjectPartyFeeK   uint16    `json:"project_party_fee_k"`
+	LpAwardFeeK        uint16    `json:"lp_award_fee_k"`
 }
 
 func QueryNotPushedSwapTrsScan() (swapTrsScans []SwapTrsScan, err error) {
@@ -43,7 +48,7 @@ func QueryNotPushedSwapTrsScan() (swapTrsScans []SwapTrsScan, err error) {
 	swapTrsScans = []SwapTrsScan{}
 
 	err = tx.Table("pool_swap_records").
-		Select("id,created_at,username,token_in,token_out,calc_price_amount_in,calc_price_amount_out,swap_fee").
+		Select("id,created_at,username,token_in,token_out,calc_price_amount_in,calc_price_amount_out,swap_fee,fee_tier_id,project_party_fee_k,lp_award_fee_k").
 		Order("id desc").
 		Where("is_pushed_queue = ?", false).
 		Scan(&swapTrsScans).
@@ -110,6 +115,8 @@ func SwapTrsScanToSwapTr(swapTrsScan SwapTrsScan) (swapTr SwapTr, err error) {
 			AssetsID:     token1,
 			Type:         _type,
 			SwapFee:      swapTrsScan.SwapFee,
+			SwapFeeK:     swapTrsScan.swapFeeK(),
+			FeeTierId:    swapTrsScan.FeeTierId,
 		}, nil
 
 	} else {
@@ -117,6 +124,15 @@ func SwapTrsScanToSwapTr(swapTrsScan SwapTrsScan) (swapTr SwapTr, err error) {
 	}
 }
 
+// swapFeeK is the fee rate the pool charged for the record. Records written before per pair fee tiers
+// carry no rate and were charged the default fee.
+func (s SwapTrsScan) swapFeeK() uint16 {
+	if s.FeeTierId == 0 && s.ProjectPartyFeeK == 0 && s.LpAwardFeeK == 0 {
+		return SwapFeeK
+	}
+	return s.ProjectPartyFeeK + s.LpAwardFeeK
+}
+
 func SwapTrsScansToSwapTrs(swapTrsScans []SwapTrsScan) (swapTrs []SwapTr, err error) {
 	swapTrs = []SwapTr{}
 	for _, swapTrsScan := range swapTrsScans {
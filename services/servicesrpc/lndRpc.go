@@ -16,6 +16,7 @@ import (
 	"github.com/lightningnetwork/lnd/lnrpc/chainrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/walletrpc"
 	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/lightningnetwork/lnd/lnwallet"
 	"github.com/lightningnetwork/lnd/lnwire"
@@ -264,6 +265,30 @@ func GetBalance() (*lnrpc.WalletBalanceResponse, error) {
 	return response, nil
 }
 
+// BumpFee asks lnd to sweep the unconfirmed output txid:outputIndex at satPerVbyte, which pays for its parent by CPFP.
+func BumpFee(txid string, outputIndex uint32, satPerVbyte uint64) error {
+	lndconf := config.GetConfig().ApiConfig.Lnd
+
+	grpcHost := lndconf.Host + ":" + strconv.Itoa(lndconf.Port)
+	tlsCertPath := lndconf.TlsCertPath
+	macaroonPath := lndconf.MacaroonPath
+
+	conn, connClose := utils.GetConn(grpcHost, tlsCertPath, macaroonPath)
+	defer connClose()
+
+	client := walletrpc.NewWalletKitClient(conn)
+	request := &walletrpc.BumpFeeRequest{
+		Outpoint: &lnrpc.OutPoint{
+			TxidStr:     txid,
+			OutputIndex: outputIndex,
+		},
+		SatPerVbyte: satPerVbyte,
+		Immediate:   true,
+	}
+	_, err := client.BumpFee(context.Background(), request)
+	return err
+}
+
 func GetChannelInfo() ([]*lnrpc.Channel, error) {
 	lndconf := config.GetConfig().ApiConfig.Lnd
 
@@ -446,6 +471,41 @@ func SendCoins(addr string, amount int64, satPerVbyte uint64) (string, error) {
 	return response.Txid, nil
 }
 
+// SendCoinsWithLabel sends amount sats to addr in a wallet transaction labelled with label, giving up after timeout.
+func SendCoinsWithLabel(addr string, amount int64, satPerVbyte uint64, label string, timeout time.Duration) (string, error) {
+	coon, closecoon := getLndConn()
+	defer closecoon()
+	client := lnrpc.NewLightningClient(coon)
+	request := &lnrpc.SendCoinsRequest{
+		Addr:        addr,
+		Amount:      amount,
+		SatPerVbyte: satPerVbyte,
+		Label:       label,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	response, err := client.SendCoins(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	return response.Txid, nil
+}
+
+// FindTransactionByLabel returns the txid of the wallet transaction labelled with label, confirmed at or
+// after startHeight or still unconfirmed, or "" when the wallet has none.
+func FindTransactionByLabel(label string, startHeight int32) (string, error) {
+	response, err := GetTransactions(startHeight, -1)
+	if err != nil {
+		return "", err
+	}
+	for _, transaction := range response.Transactions {
+		if transaction.Label == label {
+			return transaction.TxHash, nil
+		}
+	}
+	return "", nil
+}
+
 func Getbestblock() (*chainrpc.GetBestBlockResponse, error) {
 	coon, closecoon := getLndConn()
 	defer closecoon()
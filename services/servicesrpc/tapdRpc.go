@@ -331,6 +331,60 @@ func SendAssets(addr []string) (*taprpc.SendAssetResponse, error) {
 	return response, nil
 }
 
+// SendAssetsWithLabel sends to all addresses in one anchor transaction labelled with label,
+// giving up after timeout.
+func SendAssetsWithLabel(addr []string, label string, timeout time.Duration) (*taprpc.SendAssetResponse, error) {
+	tapdconf := config.GetConfig().ApiConfig.Tapd
+	grpcHost := tapdconf.Host + ":" + strconv.Itoa(tapdconf.Port)
+	tlsCertPath := tapdconf.TlsCertPath
+	macaroonPath := tapdconf.MacaroonPath
+	conn, connClose := utils.GetConn(grpcHost, tlsCertPath, macaroonPath)
+	defer connClose()
+
+	client := taprpc.NewTaprootAssetsClient(conn)
+	request := &taprpc.SendAssetRequest{
+		TapAddrs: addr,
+		Label:    label,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	response, err := client.SendAsset(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// transferLabelClockSkew is how far a transfer's timestamp may lag the send time the caller recorded.
+const transferLabelClockSkew = 5 * 60
+
+// FindTransferByLabel returns the transfer labelled with label that was made at or after since, or nil when
+// tapd has none. tapd lists transfers oldest first, so only the transfers made since are scanned.
+func FindTransferByLabel(label string, since int64) (*taprpc.AssetTransfer, error) {
+	tapdconf := config.GetConfig().ApiConfig.Tapd
+	grpcHost := tapdconf.Host + ":" + strconv.Itoa(tapdconf.Port)
+	tlsCertPath := tapdconf.TlsCertPath
+	macaroonPath := tapdconf.MacaroonPath
+	conn, connClose := utils.GetConn(grpcHost, tlsCertPath, macaroonPath)
+	defer connClose()
+
+	client := taprpc.NewTaprootAssetsClient(conn)
+	response, err := client.ListTransfers(context.Background(), &taprpc.ListTransfersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	for i := len(response.Transfers) - 1; i >= 0; i-- {
+		transfer := response.Transfers[i]
+		if transfer.TransferTimestamp < since-transferLabelClockSkew {
+			break
+		}
+		if transfer.Label == label {
+			return transfer, nil
+		}
+	}
+	return nil, nil
+}
+
 func QueryAssetRoot(Id string) *universerpc.QueryRootResponse {
 	tapdconf := config.GetConfig().ApiConfig.Tapd
 	grpcHost := tapdconf.Host + ":" + strconv.Itoa(tapdconf.Port)
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"trade/middleware"
+	"trade/models"
+)
+
+// decryptSessionDeviceId recovers the device ID from the pair handed out by ProcessDeviceRequest.
+// ProcessDeviceRequest returns the salt as encryptDeviceID and the ciphertext as encodedSalt,
+// clients send them back under the same names.
+func decryptSessionDeviceId(encryptDeviceID string, encodedSalt string) (string, error) {
+	if encryptDeviceID == "" && encodedSalt == "" {
+		return "", nil
+	}
+	deviceId := BuildDecrypt(encryptDeviceID, encodedSalt)
+	if deviceId == "" {
+		return "", errors.New("invalid device id")
+	}
+	return deviceId, nil
+}
+
+// ResolveSessionDeviceId returns the device the user signs in from, which must be the device registered to the user.
+// Clients that send no device get a session not bound to any device.
+func ResolveSessionDeviceId(username string, encryptDeviceID string, encodedSalt string) (string, error) {
+	deviceId, err := decryptSessionDeviceId(encryptDeviceID, encodedSalt)
+	if err != nil || deviceId == "" {
+		return deviceId, err
+	}
+	exists, registeredDeviceId := checkNpublicExists(username)
+	if !exists || registeredDeviceId != deviceId {
+		return "", errors.New("device is not registered to this user")
+	}
+	return deviceId, nil
+}
+
+func RefreshSession(req *models.RefreshSessionRequest, ip string) (*middleware.SessionTokens, error) {
+	if req.RefreshToken == "" {
+		return nil, middleware.ErrInvalidRefreshToken
+	}
+	deviceId, err := decryptSessionDeviceId(req.EncryptDeviceID, req.EncodedSalt)
+	if err != nil {
+		return nil, err
+	}
+	return middleware.RefreshSession(req.RefreshToken, deviceId, ip)
+}
+
+func ListUserSessions(username string) ([]models.UserSession, error) {
+	return middleware.ListUserSessions(username)
+}
+
+func RevokeUserSession(username string, sessionId string) error {
+	if sessionId == "" {
+		return errors.New("session id is empty")
+	}
+	return middleware.RevokeSession(username, sessionId)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -9,10 +10,16 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"trade/api"
+	"trade/btlLog"
 	"trade/middleware"
 	"trade/models"
 
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type TransactionService struct {
@@ -410,7 +417,7 @@ func (ts *TransactionService) createNewOrder(client *models.Client, order models
 
 	orderID := ts.generateOrderID()
 	order.OrderID = orderID
-	order.Status = 0
+	order.Status = models.TradeOrderStatusCreated
 	if order.OrderType == "buy" {
 		order.Buyer = client.Username
 	} else {
@@ -466,12 +473,18 @@ func (ts *TransactionService) updateOrder(client *models.Client, order models.Tr
 		ts.sendErrorResponse(client, requestID, "Order not found")
 		return
 	}
-	existingOrder.Status = 1
+	if existingOrder.Status != models.TradeOrderStatusCreated {
+		ts.sendErrorResponse(client, requestID, "Order is not open")
+		return
+	}
+	existingOrder.Status = models.TradeOrderStatusAccepted
 	ts.Orders[order.OrderID] = &existingOrder
 	if existingOrder.OrderType == "buy" {
 		existingOrder.Seller = client.Username
+		existingOrder.SellerBtcAddress = order.SellerBtcAddress
 	} else {
 		existingOrder.Buyer = client.Username
+		existingOrder.BuyerAssetAddress = order.BuyerAssetAddress
 	}
 
 	err = middleware.DB.Save(&existingOrder).Error
@@ -499,18 +512,46 @@ func (ts *TransactionService) confirmPsbtSignInfo(client *models.Client, order m
 		ts.sendErrorResponse(client, requestID, "Order not found")
 		return
 	}
+	if existingOrder.Status != models.TradeOrderStatusAccepted {
+		ts.sendErrorResponse(client, requestID, "Order is not accepted")
+		return
+	}
+	var psbtSigned, psbtCounterparty string
 	if order.OrderType == "buy" {
 		if existingOrder.Buyer != client.Username {
 			ts.sendErrorResponse(client, requestID, "Unauthorized to update order")
 			return
 		}
-		existingOrder.PSBTBuyer = order.PSBTBuyer
+		psbtSigned, psbtCounterparty = order.PSBTBuyer, existingOrder.PSBTSeller
 	} else {
 		if existingOrder.Seller != client.Username {
 			ts.sendErrorResponse(client, requestID, "Unauthorized to update order")
 			return
 		}
-		existingOrder.PSBTSeller = order.PSBTSeller
+		psbtSigned, psbtCounterparty = order.PSBTSeller, existingOrder.PSBTBuyer
+	}
+	packet, err := decodeTradePsbt(psbtSigned)
+	if err != nil {
+		ts.sendErrorResponse(client, requestID, err.Error())
+		return
+	}
+	var counterparty *psbt.Packet
+	if psbtCounterparty != "" {
+		counterparty, err = decodeTradePsbt(psbtCounterparty)
+		if err != nil {
+			ts.sendErrorResponse(client, requestID, "counterparty "+err.Error())
+			return
+		}
+	}
+	err = verifyTradePsbt(&existingOrder, packet, counterparty)
+	if err != nil {
+		ts.sendErrorResponse(client, requestID, "Invalid psbt: "+err.Error())
+		return
+	}
+	if order.OrderType == "buy" {
+		existingOrder.PSBTBuyer = psbtSigned
+	} else {
+		existingOrder.PSBTSeller = psbtSigned
 	}
 	err = middleware.DB.Save(&existingOrder).Error
 	if err != nil {
@@ -518,15 +559,158 @@ func (ts *TransactionService) confirmPsbtSignInfo(client *models.Client, order m
 		return
 	}
 	ts.Orders[order.OrderID] = &existingOrder
+
+	message := "Order updated successfully"
+	if existingOrder.PSBTSeller != "" && existingOrder.PSBTBuyer != "" {
+		err = settleTradeOrder(&existingOrder)
+		if err != nil {
+			ts.sendErrorResponse(client, requestID, "Failed to settle order: "+err.Error())
+			return
+		}
+		message = "Order broadcast successfully"
+	}
 	response := map[string]interface{}{
 		"request_id": requestID,
 		"status":     200,
-		"message":    "Order updated successfully",
+		"message":    message,
+		"order_id":   existingOrder.OrderID,
+		"txid":       existingOrder.Txid,
 		"code":       200,
 	}
 	ts.sendResponse(client, response)
 }
 
+// settleTradeOrder finalizes both signed psbts and broadcasts the transaction, moving the order
+// through signed to broadcast. Psbts that cannot be finalized fail the order, broadcasting is left
+// to broadcastTradeOrder.
+func settleTradeOrder(order *models.TradeOrder) error {
+	tx, err := finalizeTradePsbts(order)
+	if err != nil {
+		failTradeOrder(order, err)
+		return err
+	}
+	rawTx, err := serializeTx(tx)
+	if err != nil {
+		failTradeOrder(order, err)
+		return err
+	}
+	order.Status = models.TradeOrderStatusSigned
+	order.Txid = tx.TxHash().String()
+	order.RawTx = rawTx
+	err = middleware.DB.Save(order).Error
+	if err != nil {
+		return err
+	}
+	return broadcastTradeOrder(order, tx)
+}
+
+// broadcastTradeOrder broadcasts the transaction of a signed order. Only a definitive rejection by
+// the node fails the order, any other error leaves it signed for CheckBroadcastTradeOrders to retry.
+func broadcastTradeOrder(order *models.TradeOrder, tx *wire.MsgTx) error {
+	network, err := api.GetConfigNetwork()
+	if err != nil {
+		return err
+	}
+	_, err = api.SendRawTransaction(network, tx)
+	if err != nil && !isTradeTxAlreadyInChain(err) {
+		if isTradeBroadcastRejected(err) {
+			failTradeOrder(order, err)
+		}
+		return err
+	}
+	order.Status = models.TradeOrderStatusBroadcast
+	return middleware.DB.Save(order).Error
+}
+
+// isTradeBroadcastRejected reports whether the node refused the transaction itself: it does not
+// decode, spends missing or spent inputs, or breaks consensus or policy rules. Mempool fee floors
+// move with the mempool and are retried.
+func isTradeBroadcastRejected(err error) bool {
+	var rpcErr *btcjson.RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.Code {
+	case btcjson.ErrRPCDeserialization, btcjson.ErrRPCVerify:
+		return true
+	case btcjson.ErrRPCVerifyRejected:
+		return !strings.Contains(rpcErr.Message, "mempool full") && !strings.Contains(rpcErr.Message, "mempool min fee not met")
+	default:
+		return false
+	}
+}
+
+func isTradeTxAlreadyInChain(err error) bool {
+	var rpcErr *btcjson.RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCVerifyAlreadyInChain
+}
+
+func failTradeOrder(order *models.TradeOrder, reason error) {
+	order.Status = models.TradeOrderStatusFailed
+	order.FailReason = reason.Error()
+	if len(order.FailReason) > 255 {
+		order.FailReason = order.FailReason[:255]
+	}
+	err := middleware.DB.Save(order).Error
+	if err != nil {
+		btlLog.TradeOrder.Error("save failed trade order %v: %v", order.OrderID, err)
+	}
+}
+
+// RebroadcastSignedTradeOrders retries the broadcast of signed orders whose earlier broadcast hit a
+// transient error.
+func RebroadcastSignedTradeOrders() error {
+	var orders []models.TradeOrder
+	err := middleware.DB.Where("status = ? AND raw_tx <> ''", models.TradeOrderStatusSigned).Find(&orders).Error
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		tx, err := deserializeTx(orders[i].RawTx)
+		if err != nil {
+			failTradeOrder(&orders[i], err)
+			continue
+		}
+		err = broadcastTradeOrder(&orders[i], tx)
+		if err != nil {
+			btlLog.TradeOrder.Error("rebroadcast trade order %v: %v", orders[i].OrderID, err)
+		}
+	}
+	return nil
+}
+
+// CheckBroadcastTradeOrders marks broadcast orders whose transaction has confirmed as confirmed
+// and records them in the trade history.
+func CheckBroadcastTradeOrders() error {
+	network, err := api.GetConfigNetwork()
+	if err != nil {
+		return err
+	}
+	var orders []models.TradeOrder
+	err = middleware.DB.Where("status = ?", models.TradeOrderStatusBroadcast).Find(&orders).Error
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		if !api.IsTxConfirmed(network, orders[i].Txid) {
+			continue
+		}
+		err = middleware.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&orders[i]).
+				Where("status = ?", models.TradeOrderStatusBroadcast).
+				Update("status", models.TradeOrderStatusConfirmed)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			return RecordTradeHistory(tx, &orders[i])
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (ts *TransactionService) findOrdersByBaseCondition(online bool, tradingPair, orderType string, status int16) ([]models.TradeOrder, error) {
 	var orders []models.TradeOrder
 	err := middleware.DB.Where("online = ? AND trading_pair = ? AND order_type = ? and status=?", online, tradingPair, orderType, status).Find(&orders).Error
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/shopspring/decimal"
+	"strings"
+	"trade/api"
+	"trade/models"
+)
+
+func networkParams(network models.Network) (*chaincfg.Params, error) {
+	switch network {
+	case models.Mainnet:
+		return &chaincfg.MainNetParams, nil
+	case models.Testnet:
+		return &chaincfg.TestNet3Params, nil
+	case models.Regtest:
+		return &chaincfg.RegressionNetParams, nil
+	default:
+		return nil, errors.New("invalid network")
+	}
+}
+
+func decodeTradePsbt(encoded string) (*psbt.Packet, error) {
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		return nil, fmt.Errorf("decode psbt: %v", err)
+	}
+	return packet, nil
+}
+
+// tradeOrderPayoutSats is the least the seller output must pay. BitcoinAmount is in sats, a fraction of a sat
+// rounds up so the seller is never paid short.
+func tradeOrderPayoutSats(order *models.TradeOrder) (int64, error) {
+	amount := decimal.NewFromFloat(order.BitcoinAmount).Ceil()
+	if !amount.IsPositive() {
+		return 0, fmt.Errorf("invalid bitcoin amount %v", order.BitcoinAmount)
+	}
+	return amount.IntPart(), nil
+}
+
+// tradeOrderAssetUnits is TapRootAmount in the asset's base units. An asset is sent in whole base units,
+// so a fractional amount is refused rather than rounded.
+func tradeOrderAssetUnits(order *models.TradeOrder) (uint64, error) {
+	amount := decimal.NewFromFloat(order.TapRootAmount).Round(2)
+	if !amount.IsPositive() || !amount.Equal(amount.Truncate(0)) {
+		return 0, fmt.Errorf("taproot amount %v is not a whole number of asset units", order.TapRootAmount)
+	}
+	return uint64(amount.IntPart()), nil
+}
+
+// sellerPayoutScript is the output script receiving the order's BitcoinAmount.
+func sellerPayoutScript(order *models.TradeOrder) ([]byte, error) {
+	if order.SellerBtcAddress == "" {
+		return nil, errors.New("seller btc address is empty")
+	}
+	network, err := api.GetConfigNetwork()
+	if err != nil {
+		return nil, err
+	}
+	params, err := networkParams(network)
+	if err != nil {
+		return nil, err
+	}
+	address, err := btcutil.DecodeAddress(order.SellerBtcAddress, params)
+	if err != nil {
+		return nil, fmt.Errorf("decode seller btc address: %v", err)
+	}
+	return txscript.PayToAddrScript(address)
+}
+
+// buyerAssetScript is the taproot output anchoring the asset sent to the buyer's asset address.
+// The address must be for the order's asset and amount.
+func buyerAssetScript(order *models.TradeOrder) ([]byte, error) {
+	if order.BuyerAssetAddress == "" {
+		return nil, errors.New("buyer asset address is empty")
+	}
+	addr, err := api.GetDecodedAddrInfo(order.BuyerAssetAddress)
+	if err != nil {
+		return nil, fmt.Errorf("decode buyer asset address: %v", err)
+	}
+	if hex.EncodeToString(addr.AssetId) != order.AssetID {
+		return nil, fmt.Errorf("buyer asset address is for asset %x, order asset is %s", addr.AssetId, order.AssetID)
+	}
+	assetUnits, err := tradeOrderAssetUnits(order)
+	if err != nil {
+		return nil, err
+	}
+	if addr.Amount != assetUnits {
+		return nil, fmt.Errorf("buyer asset address amount %d, order amount %d", addr.Amount, assetUnits)
+	}
+	outputKey, err := schnorr.ParsePubKey(addr.TaprootOutputKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse taproot output key: %v", err)
+	}
+	return txscript.PayToTaprootScript(outputKey)
+}
+
+func findOutput(tx *wire.MsgTx, pkScript []byte) *wire.TxOut {
+	for _, txOut := range tx.TxOut {
+		if bytes.Equal(txOut.PkScript, pkScript) {
+			return txOut
+		}
+	}
+	return nil
+}
+
+func isInputSigned(input *psbt.PInput) bool {
+	return len(input.FinalScriptWitness) != 0 || len(input.FinalScriptSig) != 0 ||
+		len(input.PartialSigs) != 0 || len(input.TaprootKeySpendSig) != 0 || len(input.TaprootScriptSpendSig) != 0
+}
+
+// verifyTradePsbt checks that the transaction pays the order's BitcoinAmount sats to the seller,
+// anchors the asset at the buyer's asset address and that the submitting party signed its inputs.
+// The submitting party's inputs are the ones the counterparty's packet leaves unsigned, so once
+// counterparty is set every input is signed by one of the two packets. Before the counterparty
+// submits, the packet must sign at least one input.
+func verifyTradePsbt(order *models.TradeOrder, packet *psbt.Packet, counterparty *psbt.Packet) error {
+	payoutScript, err := sellerPayoutScript(order)
+	if err != nil {
+		return err
+	}
+	payout := findOutput(packet.UnsignedTx, payoutScript)
+	if payout == nil {
+		return errors.New("no output pays the seller btc address")
+	}
+	payoutSats, err := tradeOrderPayoutSats(order)
+	if err != nil {
+		return err
+	}
+	if payout.Value < payoutSats {
+		return fmt.Errorf("seller output value %d is less than bitcoin amount %d sats", payout.Value, payoutSats)
+	}
+	assetScript, err := buyerAssetScript(order)
+	if err != nil {
+		return err
+	}
+	if findOutput(packet.UnsignedTx, assetScript) == nil {
+		return errors.New("no output anchors the asset at the buyer asset address")
+	}
+	if counterparty == nil {
+		for i := range packet.Inputs {
+			if isInputSigned(&packet.Inputs[i]) {
+				return nil
+			}
+		}
+		return errors.New("psbt carries no signature")
+	}
+	if counterparty.UnsignedTx.TxHash() != packet.UnsignedTx.TxHash() {
+		return errors.New("psbt is for a different transaction than the counterparty's")
+	}
+	signed := false
+	for i := range packet.Inputs {
+		if isInputSigned(&counterparty.Inputs[i]) {
+			continue
+		}
+		if !isInputSigned(&packet.Inputs[i]) {
+			return fmt.Errorf("input %d is signed by neither party", i)
+		}
+		signed = true
+	}
+	if !signed {
+		return errors.New("psbt signs none of the submitting party's inputs")
+	}
+	return nil
+}
+
+// combineTradePsbts merges the buyer's signatures into the seller's packet. Both packets must be
+// for the same unsigned transaction.
+func combineTradePsbts(seller *psbt.Packet, buyer *psbt.Packet) (*psbt.Packet, error) {
+	if seller.UnsignedTx.TxHash() != buyer.UnsignedTx.TxHash() {
+		return nil, errors.New("seller and buyer psbt are for different transactions")
+	}
+	for i := range seller.Inputs {
+		to, from := &seller.Inputs[i], &buyer.Inputs[i]
+		if len(to.FinalScriptWitness) == 0 && len(to.FinalScriptSig) == 0 {
+			to.FinalScriptWitness = from.FinalScriptWitness
+			to.FinalScriptSig = from.FinalScriptSig
+		}
+		for _, sig := range from.PartialSigs {
+			exists := false
+			for _, existing := range to.PartialSigs {
+				if bytes.Equal(existing.PubKey, sig.PubKey) {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				to.PartialSigs = append(to.PartialSigs, sig)
+			}
+		}
+		if len(to.TaprootKeySpendSig) == 0 {
+			to.TaprootKeySpendSig = from.TaprootKeySpendSig
+		}
+		to.TaprootScriptSpendSig = append(to.TaprootScriptSpendSig, from.TaprootScriptSpendSig...)
+		if to.WitnessUtxo == nil {
+			to.WitnessUtxo = from.WitnessUtxo
+		}
+		if to.NonWitnessUtxo == nil {
+			to.NonWitnessUtxo = from.NonWitnessUtxo
+		}
+	}
+	return seller, nil
+}
+
+// finalizeTradePsbts combines both parties' packets and extracts the fully signed transaction.
+func finalizeTradePsbts(order *models.TradeOrder) (*wire.MsgTx, error) {
+	seller, err := decodeTradePsbt(order.PSBTSeller)
+	if err != nil {
+		return nil, fmt.Errorf("seller %v", err)
+	}
+	buyer, err := decodeTradePsbt(order.PSBTBuyer)
+	if err != nil {
+		return nil, fmt.Errorf("buyer %v", err)
+	}
+	combined, err := combineTradePsbts(seller, buyer)
+	if err != nil {
+		return nil, err
+	}
+	err = psbt.MaybeFinalizeAll(combined)
+	if err != nil {
+		return nil, fmt.Errorf("finalize psbt: %v", err)
+	}
+	tx, err := psbt.Extract(combined)
+	if err != nil {
+		return nil, fmt.Errorf("extract psbt: %v", err)
+	}
+	return tx, nil
+}
+
+func serializeTx(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	err := tx.Serialize(&buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+func deserializeTx(rawTx string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	err = tx.Deserialize(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
@@ -18,20 +18,16 @@ const (
 	AdminUploadUserName = "adminUploadUser"
 )
 
-func ValidateUser(creds models.User) (string, error) {
+func ValidateUser(creds models.User) (*middleware.SessionTokens, error) {
 	var user models.User
 	result := middleware.DB.Where("username = ?", creds.Username).First(&user)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
 	}
 	if user.Password != creds.Password {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
 	}
-	token, err := middleware.GenerateToken(creds.Username)
-	if err != nil {
-		return "", err
-	}
-	return token, nil
+	return middleware.CreateSession(creds.Username, "", "")
 }
 
 func (cs *CronService) SixSecondTask() {
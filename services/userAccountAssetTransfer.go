@@ -44,8 +44,8 @@ func BillBalanceToAccountAssetTransfer(billBalance *models.Balance, username str
 		Username:      username,
 		BillType:      billBalance.BillType.String(),
 		Away:          billBalance.Away.String(),
-		Amount:        int(billBalance.Amount),
-		ServerFee:     int(billBalance.ServerFee),
+		Amount:        int(billBalance.Amount.IntPart()),
+		ServerFee:     int(billBalance.ServerFee.IntPart()),
 		AssetId:       assetId,
 		Invoice:       invoice,
 		Outpoint:      outpoint,
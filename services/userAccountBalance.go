@@ -83,7 +83,7 @@ func GetAccountAssetBalanceExtendsByAssetId(assetId string) (*[]AccountAssetBala
 			accountAssetBalanceExtends = append(accountAssetBalanceExtends, AccountAssetBalanceExtend{
 				AccountID: accountId,
 				AssetId:   accountBalance.AssetId,
-				Amount:    int(math.Floor(accountBalance.Amount)),
+				Amount:    int(accountBalance.Amount.IntPart()),
 				UserID:    userIdAndUsername.UserId,
 				Username:  userIdAndUsername.Username,
 			})
@@ -122,7 +122,7 @@ func GetAccountAssetBalanceExtendsLimitAndOffset(assetId string, limit int, offs
 			accountAssetBalanceExtends = append(accountAssetBalanceExtends, AccountAssetBalanceExtend{
 				AccountID: accountId,
 				AssetId:   accountBalance.AssetId,
-				Amount:    int(math.Floor(accountBalance.Amount)),
+				Amount:    int(accountBalance.Amount.IntPart()),
 				UserID:    userIdAndUsername.UserId,
 				Username:  userIdAndUsername.Username,
 			})
@@ -161,7 +161,7 @@ func GetAccountAssetBalanceUserHoldTotalAmount(assetId string) (int, error) {
 	}
 	var totalAmount int
 	for _, accountBalance := range *response {
-		totalAmount += int(math.Floor(accountBalance.Amount))
+		totalAmount += int(accountBalance.Amount.IntPart())
 	}
 	return totalAmount, nil
 }
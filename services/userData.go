@@ -185,7 +185,7 @@ func GetUserAccountAssetBalanceData(accountId int) (*[]models.UserAccountAssetBa
 			CreatedAt: accountBalance.CreatedAt,
 			UpdatedAt: accountBalance.UpdatedAt,
 			AssetId:   accountBalance.AssetId,
-			Amount:    accountBalance.Amount,
+			Amount:    accountBalance.Amount.InexactFloat64(),
 		})
 	}
 	return &userAccountAssetBalanceDatas, nil
@@ -0,0 +1,306 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"slices"
+	"strconv"
+	"time"
+	"trade/models"
+)
+
+// State is the state of a workflow entity, the int value of its state field.
+type State = int
+
+// Handler runs the transition of an entity from its current state. It changes the state of the entity when
+// the transition is done, and leaves it unchanged while it waits for something, like a confirmation. An
+// error leaving the state unchanged counts as a failed attempt of the transition, once the state has changed
+// the error is only recorded with the event.
+type Handler[T any] func(tx *gorm.DB, entity *T) error
+
+// RetryPolicy says how failed attempts of a transition are retried.
+type RetryPolicy struct {
+	// MaxAttempts is how many attempts may fail in a row before the entity fails, zero retries forever.
+	MaxAttempts int
+	// Backoff is the delay after the first failed attempt, it doubles with every further one.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts && delay > 0; i++ {
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// Transition declares how entities leave the state From and the states To they may move to.
+type Transition[T any] struct {
+	From   State
+	To     []State
+	Load   func() (*[]T, error)
+	Handle Handler[T]
+	// Retry overrides the retry policy of the workflow.
+	Retry *RetryPolicy
+}
+
+type Definition[T any] struct {
+	// Name keys the tasks and events of the workflow and must not change.
+	Name  string
+	Id    func(entity *T) uint
+	State func(entity *T) State
+	// Attempt runs before every handler, to count the attempts on the entity itself.
+	Attempt Handler[T]
+	// Fail moves the entity to its failed state once a transition is out of attempts.
+	Fail        func(tx *gorm.DB, entity *T, reason string) error
+	Retry       RetryPolicy
+	Transitions []Transition[T]
+}
+
+type Result struct {
+	Id  uint
+	Err error
+}
+
+// Machine runs the transitions of a workflow. It keeps a task per entity with the attempts and the backoff of
+// its current state, and records every state change as an event.
+type Machine[T any] struct {
+	def         Definition[T]
+	transitions map[State]*Transition[T]
+}
+
+func New[T any](def Definition[T]) *Machine[T] {
+	m := &Machine[T]{
+		def:         def,
+		transitions: make(map[State]*Transition[T]),
+	}
+	for i := range def.Transitions {
+		t := &def.Transitions[i]
+		if _, ok := m.transitions[t.From]; ok {
+			panic("workflow " + def.Name + " declares state " + strconv.Itoa(t.From) + " twice")
+		}
+		m.transitions[t.From] = t
+	}
+	return m
+}
+
+// Run loads the entities in the state from and runs their transition. Each entity runs in a savepoint of tx,
+// or in its own transaction when tx is not one, so an entity whose writes fail is rolled back alone.
+func (m *Machine[T]) Run(tx *gorm.DB, from State) ([]Result, error) {
+	return m.RunWith(tx, from, nil)
+}
+
+// RunWith is Run with a handler replacing the declared one, for handlers which need data shared by the run.
+func (m *Machine[T]) RunWith(tx *gorm.DB, from State, handle Handler[T]) ([]Result, error) {
+	t, ok := m.transitions[from]
+	if !ok || t.Load == nil {
+		return nil, fmt.Errorf("workflow %s has no transition from state %d", m.def.Name, from)
+	}
+	entities, err := t.Load()
+	if err != nil {
+		return nil, err
+	}
+	var filtered []T
+	for _, entity := range *entities {
+		if m.def.State(&entity) == from {
+			filtered = append(filtered, entity)
+		}
+	}
+	return m.process(tx, filtered, handle)
+}
+
+// Process runs the transition of each entity from the state it is in, each apart like Run does. Entities in
+// states without a transition are skipped.
+func (m *Machine[T]) Process(tx *gorm.DB, entities []T) ([]Result, error) {
+	return m.process(tx, entities, nil)
+}
+
+func (m *Machine[T]) process(tx *gorm.DB, entities []T, handle Handler[T]) ([]Result, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, 0, len(entities))
+	for i := range entities {
+		ids = append(ids, m.def.Id(&entities[i]))
+	}
+	var tasks []models.WorkflowTask
+	err := tx.Where("workflow = ? AND entity_id IN ?", m.def.Name, ids).Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	taskByEntityId := make(map[uint]*models.WorkflowTask, len(tasks))
+	for i := range tasks {
+		taskByEntityId[tasks[i].EntityID] = &tasks[i]
+	}
+
+	var results []Result
+	for i := range entities {
+		entity := &entities[i]
+		t, ok := m.transitions[m.def.State(entity)]
+		if !ok {
+			continue
+		}
+		h := t.Handle
+		if handle != nil {
+			h = handle
+		}
+		id := m.def.Id(entity)
+		task := taskByEntityId[id]
+		if task == nil {
+			task = &models.WorkflowTask{Workflow: m.def.Name, EntityID: id, State: t.From}
+		}
+		var ran bool
+		var err error
+		txErr := tx.Transaction(func(entityTx *gorm.DB) error {
+			ran, err = m.step(entityTx, task, t, h, entity)
+			var storeErr storeError
+			if errors.As(err, &storeErr) {
+				return storeErr
+			}
+			return nil
+		})
+		if txErr != nil && !errors.As(txErr, new(storeError)) {
+			err = errors.Join(err, txErr)
+		}
+		if ran {
+			results = append(results, Result{Id: id, Err: err})
+		}
+	}
+	return results, nil
+}
+
+// step runs one attempt of the transition t on the entity, unless the task is failed or backing off.
+func (m *Machine[T]) step(tx *gorm.DB, task *models.WorkflowTask, t *Transition[T], handle Handler[T], entity *T) (bool, error) {
+	now := time.Now()
+	from := t.From
+	var errs []error
+	changed := task.ID == 0
+	if task.State != from {
+		// The state was changed outside the workflow, like a cancel of the user.
+		errs = append(errs, m.record(tx, task.EntityID, task.State, from, 0, ""))
+		resetTask(task, from, now)
+		changed = true
+	}
+	if task.IsFailed || task.NextRunAt.After(now) {
+		if changed && task.ID != 0 {
+			errs = append(errs, tx.Save(task).Error)
+		}
+		return false, storeErrors(errs)
+	}
+
+	var err error
+	if m.def.Attempt != nil {
+		err = m.def.Attempt(tx, entity)
+	}
+	if err == nil {
+		err = handle(tx, entity)
+	}
+	attempt := task.Attempts + 1
+
+	if to := m.def.State(entity); to != from {
+		message := ""
+		if !slices.Contains(t.To, to) {
+			message = fmt.Sprintf("undeclared transition from state %d to %d", from, to)
+		}
+		if err != nil {
+			message = joinMessages(message, err.Error())
+		}
+		errs = append(errs, m.record(tx, task.EntityID, from, to, attempt, message))
+		resetTask(task, to, now)
+		errs = append(errs, tx.Save(task).Error)
+		return true, errors.Join(err, storeErrors(errs))
+	}
+
+	if err == nil {
+		// The entity waits in its state.
+		if task.Attempts != 0 || task.LastError != "" {
+			resetTask(task, from, now)
+			changed = true
+		}
+		if changed && task.ID != 0 {
+			errs = append(errs, tx.Save(task).Error)
+		}
+		return true, storeErrors(errs)
+	}
+
+	policy := m.def.Retry
+	if t.Retry != nil {
+		policy = *t.Retry
+	}
+	task.Attempts = attempt
+	task.LastError = err.Error()
+	task.NextRunAt = now.Add(policy.delay(attempt))
+	if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts && m.def.Fail != nil {
+		reason := fmt.Sprintf("failed %d attempts, last error: %v", attempt, err)
+		failErr := m.def.Fail(tx, entity, reason)
+		if failErr != nil {
+			errs = append(errs, failErr)
+		} else {
+			to := m.def.State(entity)
+			errs = append(errs, m.record(tx, task.EntityID, from, to, attempt, reason))
+			task.State = to
+			task.IsFailed = true
+			task.FailedReason = reason
+		}
+	}
+	errs = append(errs, tx.Save(task).Error)
+	return true, errors.Join(err, storeErrors(errs))
+}
+
+// storeError is a failed write of a step, the writes of the step are rolled back with it.
+type storeError struct {
+	error
+}
+
+func (e storeError) Unwrap() error {
+	return e.error
+}
+
+func storeErrors(errs []error) error {
+	if err := errors.Join(errs...); err != nil {
+		return storeError{err}
+	}
+	return nil
+}
+
+func (m *Machine[T]) record(tx *gorm.DB, entityId uint, from State, to State, attempt int, message string) error {
+	return tx.Create(&models.WorkflowEvent{
+		Workflow:  m.def.Name,
+		EntityID:  entityId,
+		FromState: from,
+		ToState:   to,
+		Attempt:   attempt,
+		Error:     message,
+	}).Error
+}
+
+func resetTask(task *models.WorkflowTask, state State, now time.Time) {
+	task.State = state
+	task.Attempts = 0
+	task.NextRunAt = now
+	task.LastError = ""
+	task.IsFailed = false
+	task.FailedReason = ""
+}
+
+func joinMessages(messages ...string) string {
+	var joined string
+	for _, message := range messages {
+		if message == "" {
+			continue
+		}
+		if joined != "" {
+			joined += "; "
+		}
+		joined += message
+	}
+	return joined
+}
@@ -0,0 +1,355 @@
+package workflow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"trade/middleware/dbtest"
+	"trade/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	stateNew = iota
+	stateDone
+	stateOther
+	stateRetrying
+	stateFailed
+)
+
+type testEntity struct {
+	ID       uint
+	State    int
+	Attempts int
+}
+
+func newTestMachine() *Machine[testEntity] {
+	return New(Definition[testEntity]{
+		Name: "test",
+		Id: func(entity *testEntity) uint {
+			return entity.ID
+		},
+		State: func(entity *testEntity) State {
+			return entity.State
+		},
+		Attempt: func(tx *gorm.DB, entity *testEntity) error {
+			entity.Attempts++
+			return nil
+		},
+		Fail: func(tx *gorm.DB, entity *testEntity, reason string) error {
+			entity.State = stateFailed
+			return nil
+		},
+		Retry: RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 10 * time.Minute},
+		Transitions: []Transition[testEntity]{
+			{From: stateNew, To: []State{stateDone}},
+			{From: stateRetrying, To: []State{stateDone}, Retry: &RetryPolicy{Backoff: time.Minute, MaxBackoff: 5 * time.Minute}},
+		},
+	})
+}
+
+func setupWorkflowTest(t *testing.T) *gorm.DB {
+	t.Helper()
+	return dbtest.Open(t, &models.WorkflowTask{}, &models.WorkflowEvent{})
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+		want     time.Duration
+	}{
+		{"first attempt", RetryPolicy{Backoff: 30 * time.Second, MaxBackoff: 10 * time.Minute}, 1, 30 * time.Second},
+		{"doubles", RetryPolicy{Backoff: 30 * time.Second, MaxBackoff: 10 * time.Minute}, 3, 2 * time.Minute},
+		{"below cap", RetryPolicy{Backoff: 30 * time.Second, MaxBackoff: 10 * time.Minute}, 5, 8 * time.Minute},
+		{"capped", RetryPolicy{Backoff: 30 * time.Second, MaxBackoff: 10 * time.Minute}, 6, 10 * time.Minute},
+		{"capped far out", RetryPolicy{Backoff: 30 * time.Second, MaxBackoff: 10 * time.Minute}, 1000, 10 * time.Minute},
+		{"no cap", RetryPolicy{Backoff: 30 * time.Second}, 4, 4 * time.Minute},
+		{"no backoff", RetryPolicy{MaxBackoff: 10 * time.Minute}, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.delay(tt.attempts); got != tt.want {
+				t.Fatalf("delay(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMachineStep(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name string
+		// task is saved first when it has a state other than the one of the entity or attempts.
+		task   models.WorkflowTask
+		entity testEntity
+		handle Handler[testEntity]
+
+		wantRan          bool
+		wantErr          bool
+		wantHandled      bool
+		wantEntityState  int
+		wantTaskState    int
+		wantAttempts     int
+		wantDelay        time.Duration
+		wantFailed       bool
+		wantEvents       []models.WorkflowEvent
+		wantEventMessage string
+	}{
+		{
+			name:            "waits in its state",
+			entity:          testEntity{ID: 1, State: stateNew},
+			handle:          func(tx *gorm.DB, entity *testEntity) error { return nil },
+			wantRan:         true,
+			wantHandled:     true,
+			wantEntityState: stateNew,
+			wantTaskState:   stateNew,
+		},
+		{
+			name:   "declared transition",
+			entity: testEntity{ID: 1, State: stateNew},
+			handle: func(tx *gorm.DB, entity *testEntity) error {
+				entity.State = stateDone
+				return nil
+			},
+			wantRan:         true,
+			wantHandled:     true,
+			wantEntityState: stateDone,
+			wantTaskState:   stateDone,
+			wantEvents:      []models.WorkflowEvent{{FromState: stateNew, ToState: stateDone, Attempt: 1}},
+		},
+		{
+			name:   "undeclared transition",
+			entity: testEntity{ID: 1, State: stateNew},
+			handle: func(tx *gorm.DB, entity *testEntity) error {
+				entity.State = stateOther
+				return nil
+			},
+			wantRan:          true,
+			wantHandled:      true,
+			wantEntityState:  stateOther,
+			wantTaskState:    stateOther,
+			wantEvents:       []models.WorkflowEvent{{FromState: stateNew, ToState: stateOther, Attempt: 1}},
+			wantEventMessage: "undeclared transition from state 0 to 2",
+		},
+		{
+			name:            "state changed outside the engine",
+			task:            models.WorkflowTask{State: stateOther, Attempts: 2, LastError: "old"},
+			entity:          testEntity{ID: 1, State: stateNew},
+			handle:          func(tx *gorm.DB, entity *testEntity) error { return nil },
+			wantRan:         true,
+			wantHandled:     true,
+			wantEntityState: stateNew,
+			wantTaskState:   stateNew,
+			wantEvents:      []models.WorkflowEvent{{FromState: stateOther, ToState: stateNew}},
+		},
+		{
+			name:            "first failure backs off",
+			entity:          testEntity{ID: 1, State: stateNew},
+			handle:          func(tx *gorm.DB, entity *testEntity) error { return errBoom },
+			wantRan:         true,
+			wantErr:         true,
+			wantHandled:     true,
+			wantEntityState: stateNew,
+			wantTaskState:   stateNew,
+			wantAttempts:    1,
+			wantDelay:       time.Minute,
+		},
+		{
+			name:            "backoff doubles",
+			task:            models.WorkflowTask{State: stateRetrying, Attempts: 2},
+			entity:          testEntity{ID: 1, State: stateRetrying},
+			handle:          func(tx *gorm.DB, entity *testEntity) error { return errBoom },
+			wantRan:         true,
+			wantErr:         true,
+			wantHandled:     true,
+			wantEntityState: stateRetrying,
+			wantTaskState:   stateRetrying,
+			wantAttempts:    3,
+			wantDelay:       4 * time.Minute,
+		},
+		{
+			name:            "backoff capped",
+			task:            models.WorkflowTask{State: stateRetrying, Attempts: 9},
+			entity:          testEntity{ID: 1, State: stateRetrying},
+			handle:          func(tx *gorm.DB, entity *testEntity) error { return errBoom },
+			wantRan:         true,
+			wantErr:         true,
+			wantHandled:     true,
+			wantEntityState: stateRetrying,
+			wantTaskState:   stateRetrying,
+			wantAttempts:    10,
+			wantDelay:       5 * time.Minute,
+		},
+		{
+			name:             "max attempts fails",
+			task:             models.WorkflowTask{State: stateNew, Attempts: 2},
+			entity:           testEntity{ID: 1, State: stateNew},
+			handle:           func(tx *gorm.DB, entity *testEntity) error { return errBoom },
+			wantRan:          true,
+			wantErr:          true,
+			wantHandled:      true,
+			wantEntityState:  stateFailed,
+			wantTaskState:    stateFailed,
+			wantAttempts:     3,
+			wantDelay:        4 * time.Minute,
+			wantFailed:       true,
+			wantEvents:       []models.WorkflowEvent{{FromState: stateNew, ToState: stateFailed, Attempt: 3}},
+			wantEventMessage: "failed 3 attempts, last error: boom",
+		},
+		{
+			name:            "failed task is skipped",
+			task:            models.WorkflowTask{State: stateNew, Attempts: 3, IsFailed: true},
+			entity:          testEntity{ID: 1, State: stateNew},
+			handle:          func(tx *gorm.DB, entity *testEntity) error { return errBoom },
+			wantEntityState: stateNew,
+			wantTaskState:   stateNew,
+			wantAttempts:    3,
+			wantFailed:      true,
+		},
+		{
+			name:            "backing off task is skipped",
+			task:            models.WorkflowTask{State: stateNew, Attempts: 1, NextRunAt: time.Now().Add(time.Hour)},
+			entity:          testEntity{ID: 1, State: stateNew},
+			handle:          func(tx *gorm.DB, entity *testEntity) error { return errBoom },
+			wantEntityState: stateNew,
+			wantTaskState:   stateNew,
+			wantAttempts:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupWorkflowTest(t)
+			m := newTestMachine()
+			task := tt.task
+			task.Workflow = m.def.Name
+			task.EntityID = tt.entity.ID
+			if task.State != tt.entity.State || task.Attempts != 0 {
+				if err := db.Create(&task).Error; err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				task.State = tt.entity.State
+			}
+			entity := tt.entity
+			handled := false
+			handle := func(tx *gorm.DB, entity *testEntity) error {
+				handled = true
+				return tt.handle(tx, entity)
+			}
+
+			before := time.Now()
+			ran, err := m.step(db, &task, m.transitions[tt.entity.State], handle, &entity)
+			after := time.Now()
+
+			if ran != tt.wantRan {
+				t.Errorf("ran = %v, want %v", ran, tt.wantRan)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+			if entity.State != tt.wantEntityState {
+				t.Errorf("entity state = %d, want %d", entity.State, tt.wantEntityState)
+			}
+			if handled && entity.Attempts != 1 {
+				t.Errorf("entity attempts = %d, want 1", entity.Attempts)
+			}
+			if task.State != tt.wantTaskState || task.Attempts != tt.wantAttempts || task.IsFailed != tt.wantFailed {
+				t.Errorf("task state %d attempts %d failed %v, want %d %d %v", task.State, task.Attempts, task.IsFailed, tt.wantTaskState, tt.wantAttempts, tt.wantFailed)
+			}
+			if tt.wantDelay > 0 && (task.NextRunAt.Before(before.Add(tt.wantDelay)) || task.NextRunAt.After(after.Add(tt.wantDelay))) {
+				t.Errorf("next run in %s, want %s", task.NextRunAt.Sub(before), tt.wantDelay)
+			}
+
+			var saved models.WorkflowTask
+			if err := db.Where("workflow = ? AND entity_id = ?", m.def.Name, tt.entity.ID).First(&saved).Error; err == nil {
+				if saved.State != task.State || saved.Attempts != task.Attempts || saved.IsFailed != task.IsFailed {
+					t.Errorf("saved task state %d attempts %d failed %v, want %d %d %v", saved.State, saved.Attempts, saved.IsFailed, task.State, task.Attempts, task.IsFailed)
+				}
+			}
+
+			var events []models.WorkflowEvent
+			if err := db.Where("workflow = ? AND entity_id = ?", m.def.Name, tt.entity.ID).Order("id").Find(&events).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != len(tt.wantEvents) {
+				t.Fatalf("got %d events, want %d", len(events), len(tt.wantEvents))
+			}
+			for i, want := range tt.wantEvents {
+				got := events[i]
+				if got.FromState != want.FromState || got.ToState != want.ToState || got.Attempt != want.Attempt {
+					t.Errorf("event %d from %d to %d attempt %d, want %d %d %d", i, got.FromState, got.ToState, got.Attempt, want.FromState, want.ToState, want.Attempt)
+				}
+			}
+			if tt.wantEventMessage != "" && !strings.Contains(events[len(events)-1].Error, tt.wantEventMessage) {
+				t.Errorf("event error %q, want %q", events[len(events)-1].Error, tt.wantEventMessage)
+			}
+		})
+	}
+}
+
+// TestMachineProcessRollsBackEntity checks an entity whose writes fail is rolled back without the others.
+func TestMachineProcessRollsBackEntity(t *testing.T) {
+	db := setupWorkflowTest(t)
+	if err := db.AutoMigrate(&testEntity{}); err != nil {
+		t.Fatal(err)
+	}
+	m := New(Definition[testEntity]{
+		Name: "test",
+		Id: func(entity *testEntity) uint {
+			return entity.ID
+		},
+		State: func(entity *testEntity) State {
+			return entity.State
+		},
+		Fail: func(tx *gorm.DB, entity *testEntity, reason string) error {
+			return errors.New("fail is broken")
+		},
+		Retry: RetryPolicy{MaxAttempts: 1},
+		Transitions: []Transition[testEntity]{
+			{
+				From: stateNew,
+				To:   []State{stateDone},
+				Handle: func(tx *gorm.DB, entity *testEntity) error {
+					entity.Attempts++
+					if err := tx.Create(entity).Error; err != nil {
+						return err
+					}
+					if entity.ID == 1 {
+						return errors.New("boom")
+					}
+					entity.State = stateDone
+					return tx.Save(entity).Error
+				},
+			},
+		},
+	})
+
+	results, err := m.Process(db, []testEntity{{ID: 1, State: stateNew}, {ID: 2, State: stateNew}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Err == nil || results[1].Err != nil {
+		t.Fatalf("results %+v, want entity 1 failed and entity 2 done", results)
+	}
+	var entities []testEntity
+	if err = db.Order("id").Find(&entities).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 1 || entities[0].ID != 2 || entities[0].State != stateDone {
+		t.Fatalf("saved entities %+v, want only entity 2 done", entities)
+	}
+	var tasks []models.WorkflowTask
+	if err = db.Order("entity_id").Find(&tasks).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].EntityID != 2 || tasks[0].State != stateDone {
+		t.Fatalf("saved tasks %+v, want only the task of entity 2", tasks)
+	}
+}
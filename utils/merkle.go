@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// Merkle trees here hash a leaf as sha256(0x00‖leaf) and a pair of nodes as sha256(0x01‖pair in sorted
+// order), so an inner node can not pass for a leaf and a proof is only the list of siblings. An odd last node
+// is carried up a level unchanged.
+
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+func hashMerkleLeaf(leaf []byte) []byte {
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, leaf...))
+	return sum[:]
+}
+
+func hashMerklePair(a []byte, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	sum := sha256.Sum256(append(append([]byte{merkleNodePrefix}, a...), b...))
+	return sum[:]
+}
+
+func merkleLevels(leaves [][]byte) [][][]byte {
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = hashMerkleLeaf(leaf)
+	}
+	levels := [][][]byte{hashes}
+	for level := hashes; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashMerklePair(level[i], level[i+1]))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// MerkleRoot returns the root over the leaves, nil when there are none.
+func MerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return nil
+	}
+	levels := merkleLevels(leaves)
+	return levels[len(levels)-1][0]
+}
+
+// MerkleProof returns the siblings proving the leaf at index up to the root.
+func MerkleProof(leaves [][]byte, index int) [][]byte {
+	if index < 0 || index >= len(leaves) {
+		return nil
+	}
+	var proof [][]byte
+	levels := merkleLevels(leaves)
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+		index /= 2
+	}
+	return proof
+}
+
+func VerifyMerkleProof(root []byte, leaf []byte, proof [][]byte) bool {
+	hash := hashMerkleLeaf(leaf)
+	for _, sibling := range proof {
+		hash = hashMerklePair(hash, sibling)
+	}
+	return bytes.Equal(hash, root)
+}
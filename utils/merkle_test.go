@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strconv"
+	"testing"
+)
+
+func testMerkleLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = []byte("leaf" + strconv.Itoa(i))
+	}
+	return leaves
+}
+
+func testMerkleHashes(leaves [][]byte) [][]byte {
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = hashMerkleLeaf(leaf)
+	}
+	return hashes
+}
+
+func TestMerkleRoot(t *testing.T) {
+	leaves := testMerkleLeaves(5)
+	h := testMerkleHashes(leaves)
+	l01 := hashMerklePair(h[0], h[1])
+	l23 := hashMerklePair(h[2], h[3])
+	tests := []struct {
+		name   string
+		leaves [][]byte
+		want   []byte
+	}{
+		{"no leaves", nil, nil},
+		{"one leaf", leaves[:1], h[0]},
+		{"two leaves", leaves[:2], l01},
+		{"odd leaf carried up", leaves[:3], hashMerklePair(l01, h[2])},
+		{"four leaves", leaves[:4], hashMerklePair(l01, l23)},
+		{"odd leaf carried two levels", leaves[:5], hashMerklePair(hashMerklePair(l01, l23), h[4])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MerkleRoot(tt.leaves); !bytes.Equal(got, tt.want) {
+				t.Fatalf("root %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashMerklePairIsSorted(t *testing.T) {
+	h := testMerkleHashes(testMerkleLeaves(2))
+	if !bytes.Equal(hashMerklePair(h[0], h[1]), hashMerklePair(h[1], h[0])) {
+		t.Fatal("pair hash depends on the order of the nodes")
+	}
+}
+
+func TestMerkleHashesAreDomainSeparated(t *testing.T) {
+	h := testMerkleHashes(testMerkleLeaves(2))
+	a, b := h[0], h[1]
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	pair := append(append([]byte{}, a...), b...)
+	if bytes.Equal(hashMerkleLeaf(pair), hashMerklePair(a, b)) {
+		t.Fatal("a leaf of two concatenated hashes hashes to their inner node")
+	}
+	if plain := sha256.Sum256(pair); bytes.Equal(plain[:], hashMerklePair(a, b)) {
+		t.Fatal("inner node is hashed without its prefix")
+	}
+	root := MerkleRoot(testMerkleLeaves(2))
+	if VerifyMerkleProof(root, pair, nil) {
+		t.Fatal("the concatenated children of the root verify as a leaf")
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	leaves := testMerkleLeaves(3)
+	h := testMerkleHashes(leaves)
+	tests := []struct {
+		name  string
+		index int
+		want  [][]byte
+	}{
+		{"first leaf", 0, [][]byte{h[1], h[2]}},
+		{"second leaf", 1, [][]byte{h[0], h[2]}},
+		{"odd leaf", 2, [][]byte{hashMerklePair(h[0], h[1])}},
+		{"negative index", -1, nil},
+		{"index out of range", 3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MerkleProof(leaves, tt.index)
+			if len(got) != len(tt.want) {
+				t.Fatalf("proof has %d siblings, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Fatalf("sibling %d %x, want %x", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		leaves := testMerkleLeaves(n)
+		root := MerkleRoot(leaves)
+		other := testMerkleLeaves(n + 1)[n]
+		for index, leaf := range leaves {
+			proof := MerkleProof(leaves, index)
+			if !VerifyMerkleProof(root, leaf, proof) {
+				t.Fatalf("%d leaves: proof of leaf %d does not verify", n, index)
+			}
+			if VerifyMerkleProof(root, other, proof) {
+				t.Fatalf("%d leaves: proof of leaf %d verifies another leaf", n, index)
+			}
+			if len(proof) > 0 {
+				tampered := append([][]byte{}, proof...)
+				tampered[0] = hashMerkleLeaf(other)
+				if VerifyMerkleProof(root, leaf, tampered) {
+					t.Fatalf("%d leaves: tampered proof of leaf %d verifies", n, index)
+				}
+			}
+		}
+	}
+}